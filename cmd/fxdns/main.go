@@ -8,16 +8,24 @@ import (
 	"path/filepath"
 	"syscall"
 
+	"github.com/hao/fxdns/internal/config"
+	"github.com/hao/fxdns/internal/config/source"
 	"github.com/hao/fxdns/internal/dns"
 )
 
 var (
-	configPath string
+	configPath         string
+	configSource       string
+	generateConfig     string
+	printDefaultConfig bool
 )
 
 func init() {
 	// 解析命令行参数
 	flag.StringVar(&configPath, "config", "config/config.yaml", "配置文件路径")
+	flag.StringVar(&configSource, "config-source", "", "配置来源 URI：file://path、consul://host[:port]/key 或 etcd://host[:port]/key，指定时忽略 -config")
+	flag.StringVar(&generateConfig, "generate-config", "", "生成带注释的默认配置文件到指定路径后退出")
+	flag.BoolVar(&printDefaultConfig, "print-default-config", false, "将可直接使用的精简配置输出到标准输出后退出")
 	flag.Parse()
 
 	// 确保配置文件路径是绝对路径
@@ -30,8 +38,35 @@ func init() {
 }
 
 func main() {
+	// 输出精简配置
+	if printDefaultConfig {
+		data, err := config.RenderMinimalConfig(config.DefaultMinimalConfigValues())
+		if err != nil {
+			log.Fatalf("渲染精简配置失败: %v", err)
+		}
+		os.Stdout.Write(data)
+		return
+	}
+
+	// 生成默认配置文件
+	if generateConfig != "" {
+		if err := config.WriteDefaultConfigFile(generateConfig); err != nil {
+			log.Fatalf("生成默认配置文件失败: %v", err)
+		}
+		log.Printf("默认配置文件已生成: %s", generateConfig)
+		return
+	}
+
 	// 创建并启动 DNS 服务器
-	server, err := dns.NewServer(configPath)
+	uri := configSource
+	if uri == "" {
+		uri = configPath
+	}
+	src, err := source.Parse(uri)
+	if err != nil {
+		log.Fatalf("无效的配置来源: %v", err)
+	}
+	server, err := dns.NewServerFromSource(src)
 	if err != nil {
 		log.Fatalf("创建 DNS 服务器失败: %v", err)
 	}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// backupTimeFormat 备份文件名中的时间戳格式，按字典序排列即为时间顺序
+const backupTimeFormat = "20060102-150405.000000000"
+
+// backupPattern 匹配 backup_dir 中由热加载自动创建的备份文件
+const backupPattern = "config_*.yaml"
+
+// Backup 将当前生效配置的原始文件内容写入 path（保留注释与格式），所在目录不存在时自动创建。
+// 配置中可能包含密钥，备份文件仅属主可读写
+func (m *ConfigManager) Backup(path string) error {
+	m.reloadLock.RLock()
+	defer m.reloadLock.RUnlock()
+	return m.writeBackup(path)
+}
+
+// writeBackup 写入当前配置的原始内容，调用者应持有 reloadLock
+func (m *ConfigManager) writeBackup(path string) error {
+	if m.rawConfig == nil {
+		return errors.New("尚未加载配置，无法备份")
+	}
+	return writeBackupData(path, m.rawConfig)
+}
+
+// writeBackupData 将 data 写入备份文件 path，所在目录不存在时自动创建，备份文件仅属主可读写
+func writeBackupData(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("创建备份目录失败: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("写入备份 %s 失败: %w", path, err)
+	}
+	return nil
+}
+
+// backupPrevious 热加载替换配置前将当前配置备份到 dir/config_<时间戳>.yaml，
+// 并删除超出 maxBackups 的最旧备份 (maxBackups 为 0 时全部保留)。调用者应持有 reloadLock
+func (m *ConfigManager) backupPrevious(dir string, maxBackups int) error {
+	path, err := backupToDir(dir, maxBackups, m.rawConfig)
+	if err != nil {
+		return err
+	}
+	log.Printf("ConfigManager: 已备份替换前的配置到 %s", path)
+	return nil
+}
+
+// backupToDir 将 data 备份到 dir/config_<时间戳>.yaml 并删除超出 maxBackups 的最旧备份，返回备份文件路径
+func backupToDir(dir string, maxBackups int, data []byte) (string, error) {
+	if data == nil {
+		return "", errors.New("尚未加载配置，无法备份")
+	}
+	path := filepath.Join(dir, "config_"+time.Now().Format(backupTimeFormat)+".yaml")
+	if err := writeBackupData(path, data); err != nil {
+		return "", err
+	}
+	return path, trimBackups(dir, maxBackups)
+}
+
+// writeFileAtomic 先写入同目录下的临时文件再重命名为 path，避免写入中途失败留下不完整的文件
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// trimBackups 按文件名中的时间戳删除 dir 中最旧的备份，只保留最新的 maxBackups 个
+func trimBackups(dir string, maxBackups int) error {
+	if maxBackups <= 0 {
+		return nil
+	}
+	backups, err := ListBackups(dir)
+	if err != nil {
+		return err
+	}
+	for len(backups) > maxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return fmt.Errorf("删除旧备份 %s 失败: %w", backups[0], err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// ListBackups 返回 dir 中自动创建的备份文件路径，按从旧到新排列
+func ListBackups(dir string) ([]string, error) {
+	backups, err := filepath.Glob(filepath.Join(dir, backupPattern))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// Restore 用备份文件替换配置文件并立即重新加载。备份内容校验通过后才会覆盖配置文件，
+// 替换前的配置按 backup_dir 照常备份，因此恢复操作本身也可以撤销。只支持本地配置文件
+func (m *ConfigManager) Restore(backupPath string) error {
+	if m.configFilePath == "" {
+		return fmt.Errorf("配置来源 %v 不是本地文件，不支持从备份恢复", m.source)
+	}
+	data, err := os.ReadFile(backupPath)
+	if err != nil {
+		return fmt.Errorf("读取备份 %s 失败: %w", backupPath, err)
+	}
+	cfg, err := LoadConfigFromBytes(data)
+	if err != nil {
+		return fmt.Errorf("备份 %s 不是有效的配置: %w", backupPath, err)
+	}
+	if err := m.validateConfig(cfg); err != nil {
+		return fmt.Errorf("备份 %s 不是有效的配置: %w", backupPath, err)
+	}
+
+	info, err := os.Stat(m.configFilePath)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(m.configFilePath, data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+	log.Printf("ConfigManager: 已从备份 %s 恢复配置文件", backupPath)
+	return m.LoadConfig()
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// backupTestConfig 返回 workers 不同的有效配置，启用 backup_dir 并最多保留 2 个备份
+func backupTestConfig(backupDir string, workers int) string {
+	return fmt.Sprintf(`# workers: %d
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: %d
+cdn_ips:
+  - "192.168.1.0/24"
+config:
+  backup_dir: "%s"
+  max_backups: 2
+`, workers, workers, backupDir)
+}
+
+func TestConfigManagerBackupOnReload(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yaml")
+	backupDir := filepath.Join(tempDir, "backups")
+
+	write := func(workers int) {
+		if err := os.WriteFile(configPath, []byte(backupTestConfig(backupDir, workers)), 0644); err != nil {
+			t.Fatalf("写入配置文件失败: %v", err)
+		}
+	}
+
+	write(1)
+	manager := NewConfigManager(configPath)
+	if err := manager.LoadConfig(); err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	// 首次加载没有需要备份的旧配置
+	if backups, _ := ListBackups(backupDir); len(backups) != 0 {
+		t.Fatalf("首次加载不应创建备份, 实际: %v", backups)
+	}
+
+	for workers := 2; workers <= 4; workers++ {
+		write(workers)
+		if err := manager.LoadConfig(); err != nil {
+			t.Fatalf("重新加载配置失败: %v", err)
+		}
+	}
+
+	// 共替换了 3 次配置 (workers 1、2、3 被备份)，只保留最新的 2 个
+	backups, err := ListBackups(backupDir)
+	if err != nil {
+		t.Fatalf("列出备份失败: %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("应保留 2 个备份, 实际: %v", backups)
+	}
+	for i, want := range []int{2, 3} {
+		data, err := os.ReadFile(backups[i])
+		if err != nil {
+			t.Fatalf("读取备份失败: %v", err)
+		}
+		if !strings.HasPrefix(string(data), fmt.Sprintf("# workers: %d\n", want)) {
+			t.Errorf("备份 %s 内容错误, 期望 workers %d 的原始配置:\n%s", backups[i], want, data)
+		}
+		if info, _ := os.Stat(backups[i]); info.Mode().Perm() != 0600 {
+			t.Errorf("备份文件权限应为 0600, 实际: %v", info.Mode().Perm())
+		}
+	}
+
+	// 从备份恢复：配置文件被替换并立即生效，恢复前的配置同样被备份
+	if err := manager.Restore(backups[0]); err != nil {
+		t.Fatalf("恢复备份失败: %v", err)
+	}
+	if got := manager.GetConfig().Server.Workers; got != 2 {
+		t.Errorf("恢复后 workers 应为 2, 实际: %d", got)
+	}
+	if data, _ := os.ReadFile(configPath); !strings.HasPrefix(string(data), "# workers: 2\n") {
+		t.Errorf("恢复后配置文件应为备份内容:\n%s", data)
+	}
+	backups, _ = ListBackups(backupDir)
+	if len(backups) != 2 {
+		t.Fatalf("恢复后仍应只保留 2 个备份, 实际: %v", backups)
+	}
+	if data, _ := os.ReadFile(backups[1]); !strings.HasPrefix(string(data), "# workers: 4\n") {
+		t.Errorf("恢复前的配置应被备份, 最新备份内容:\n%s", data)
+	}
+}
+
+func TestConfigManagerBackupAndRestoreErrors(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yaml")
+
+	manager := NewConfigManager(configPath)
+	if err := manager.Backup(filepath.Join(tempDir, "manual.yaml")); err == nil {
+		t.Error("加载配置前备份应返回错误")
+	}
+
+	if err := os.WriteFile(configPath, []byte(backupTestConfig("", 1)), 0644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+	if err := manager.LoadConfig(); err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	manual := filepath.Join(tempDir, "manual", "snapshot.yaml")
+	if err := manager.Backup(manual); err != nil {
+		t.Fatalf("手动备份失败: %v", err)
+	}
+	if data, _ := os.ReadFile(manual); !strings.HasPrefix(string(data), "# workers: 1\n") {
+		t.Errorf("手动备份内容错误:\n%s", data)
+	}
+
+	// 无效的备份不会覆盖配置文件
+	invalid := filepath.Join(tempDir, "invalid.yaml")
+	os.WriteFile(invalid, []byte("server:\n  workers: 0\n"), 0644)
+	if err := manager.Restore(invalid); err == nil {
+		t.Error("恢复无效的备份应返回错误")
+	}
+	if data, _ := os.ReadFile(configPath); !strings.HasPrefix(string(data), "# workers: 1\n") {
+		t.Errorf("恢复失败时不应修改配置文件:\n%s", data)
+	}
+}
@@ -1,14 +1,22 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
-	"regexp"
+	"net/url"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/expr-lang/expr/vm"
+	"github.com/hao/fxdns/internal/upstream"
+	"github.com/hao/fxdns/internal/util"
+	"github.com/miekg/dns"
 	"gopkg.in/yaml.v3"
 )
 
@@ -18,6 +26,20 @@ type Config struct {
 	Server   ServerConfig   `yaml:"server"`
 	CDNIPs   []string       `yaml:"cdn_ips"`
 	Domains  []DomainRule   `yaml:"domains"`
+	// SplitHorizon 按客户端子网选择主上游
+	SplitHorizon SplitHorizonConfig `yaml:"split_horizon"`
+	// Cache 响应缓存的淘汰方式
+	Cache CacheConfig `yaml:"cache"`
+	// CacheWarm 启动时的缓存预热
+	CacheWarm CacheWarmConfig `yaml:"cache_warm"`
+	// Metrics 管理服务 /metrics 接口的访问控制
+	Metrics MetricsConfig `yaml:"metrics"`
+	// Observability 查询处理过程的链路追踪
+	Observability ObservabilityConfig `yaml:"observability"`
+	// ConfigFile 配置文件自身的热加载方式
+	ConfigFile ConfigFileConfig `yaml:"config"`
+	// ConfigVersion 配置格式版本，未设置时视为 1；低于 CurrentConfigVersion 的配置在加载时自动迁移
+	ConfigVersion string `yaml:"config_version"`
 
 	// 用于存储解析后的 CIDR
 	parsedCIDRs []*net.IPNet
@@ -27,17 +49,196 @@ type Config struct {
 // Validate 对配置进行基本校验
 func (c *Config) Validate() error {
     // 验证上游 DNS 服务器配置
-    if strings.TrimSpace(c.Upstream.Server) == "" {
-        return fmt.Errorf("上游 DNS 服务器地址不能为空")
+    switch c.Upstream.Protocol {
+    case "", UpstreamProtocolDNS:
+        if strings.TrimSpace(c.Upstream.Server) == "" {
+            return fmt.Errorf("上游 DNS 服务器地址不能为空")
+        }
+    case UpstreamProtocolJSONDoH:
+        u := strings.ToLower(c.Upstream.JSONDoHURL)
+        if !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, "http://") {
+            return fmt.Errorf("protocol 为 json-doh 时 json_doh_url 必须是 http(s):// 地址: %q", c.Upstream.JSONDoHURL)
+        }
+    default:
+        return fmt.Errorf("无效的上游协议: %s", c.Upstream.Protocol)
     }
     // 验证服务器工作协程数量
     if c.Server.Workers <= 0 {
         return fmt.Errorf("工作协程数量必须大于 0")
     }
+    if c.Server.MaxConcurrentQueries < 0 {
+        return fmt.Errorf("max_concurrent_queries 不能为负数: %d", c.Server.MaxConcurrentQueries)
+    }
     // 验证 CDN IP 列表
     if len(c.CDNIPs) == 0 {
         return fmt.Errorf("CDN IP 列表不能为空")
     }
+    // 验证监听协议
+    switch c.Server.Network {
+    case "", NetworkUDP, NetworkTCP:
+    case NetworkDoQ:
+        if c.Server.TLSCert == "" || c.Server.TLSKey == "" {
+            return fmt.Errorf("doq 监听需要配置 tls_cert 和 tls_key")
+        }
+    default:
+        return fmt.Errorf("无效的监听协议: %s", c.Server.Network)
+    }
+    if c.Server.ListenTCP != "" && c.Server.Network != "" && c.Server.Network != NetworkUDP {
+        return fmt.Errorf("listen_tcp 仅在 network 为 udp 时可用")
+    }
+    if c.Server.DoTListen != "" && (c.Server.TLSCert == "" || c.Server.TLSKey == "") {
+        return fmt.Errorf("dot_listen 需要配置 tls_cert 和 tls_key")
+    }
+    // 验证 ECS 前缀长度
+    if n := c.Upstream.ECSPrefixLenV4(); n < 0 || n > 32 {
+        return fmt.Errorf("无效的 ECS IPv4 前缀长度: %d", n)
+    }
+    if n := c.Upstream.ECSPrefixLenV6(); n < 0 || n > 128 {
+        return fmt.Errorf("无效的 ECS IPv6 前缀长度: %d", n)
+    }
+    // 验证 DoH 连接池参数
+    if c.Upstream.MaxIdleConns < 0 || c.Upstream.MaxConnsPerHost < 0 || c.Upstream.IdleConnTimeout < 0 {
+        return fmt.Errorf("max_idle_conns、max_conns_per_host 和 idle_conn_timeout 不能为负数")
+    }
+    // 验证 DoH 上游代理
+    if c.Upstream.HTTPProxy != "" {
+        u, err := url.Parse(c.Upstream.HTTPProxy)
+        if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+            return fmt.Errorf("无效的 http_proxy，应为 http:// 或 https:// 地址: %s", c.Upstream.HTTPProxy)
+        }
+    } else if c.Upstream.HTTPProxyUser != "" || c.Upstream.HTTPProxyPassword != "" {
+        return fmt.Errorf("配置 http_proxy_user / http_proxy_password 时必须同时配置 http_proxy")
+    }
+    // 验证主上游负载均衡
+    switch c.Upstream.LoadBalance {
+    case "", LoadBalanceLatency:
+    default:
+        return fmt.Errorf("无效的 upstream.load_balance: %s", c.Upstream.LoadBalance)
+    }
+    for _, addr := range c.Upstream.Servers {
+        if strings.TrimSpace(addr) == "" {
+            return fmt.Errorf("upstream.servers 中不能包含空的地址")
+        }
+    }
+    // 验证上游熔断参数
+    cb := c.Upstream.CircuitBreaker
+    if cb.FailureThreshold < 0 || cb.Window < 0 || cb.OpenDuration < 0 {
+        return fmt.Errorf("circuit_breaker 的 failure_threshold、window 和 open_duration 不能为负数")
+    }
+    // 验证分区解析配置
+    for cidr, upstream := range c.SplitHorizon.Subnets {
+        if _, _, err := net.ParseCIDR(cidr); err != nil {
+            return fmt.Errorf("split_horizon 中的子网 %s 无效: %w", cidr, err)
+        }
+        if strings.TrimSpace(upstream) == "" {
+            return fmt.Errorf("split_horizon 子网 %s 的上游地址不能为空", cidr)
+        }
+    }
+    if c.ConfigFile.PollInterval < 0 {
+        return fmt.Errorf("config.poll_interval 不能为负数: %v", c.ConfigFile.PollInterval)
+    }
+    if c.ConfigFile.MaxBackups < 0 {
+        return fmt.Errorf("config.max_backups 不能为负数: %d", c.ConfigFile.MaxBackups)
+    }
+    if c.Server.MigrationGracePeriod < 0 {
+        return fmt.Errorf("migration_grace_period 不能为负数: %v", c.Server.MigrationGracePeriod)
+    }
+    if c.Server.DoHPaddingBlockSize < 0 || c.Server.DoHPaddingBlockSize > 65535 {
+        return fmt.Errorf("doh_padding_block_size 应在 0 到 65535 之间: %d", c.Server.DoHPaddingBlockSize)
+    }
+    if c.Server.TTLJitterFactor < 0 || c.Server.TTLJitterFactor >= 1 {
+        return fmt.Errorf("ttl_jitter_factor 应在 0 到 1 之间 (不含 1): %v", c.Server.TTLJitterFactor)
+    }
+    if c.Server.StaleTTL < 0 {
+        return fmt.Errorf("stale_ttl 不能为负数: %v", c.Server.StaleTTL)
+    }
+    if c.Server.RecentQueriesSize < 0 {
+        return fmt.Errorf("recent_queries_size 不能为负数: %d", c.Server.RecentQueriesSize)
+    }
+    switch c.Cache.EvictionPolicy {
+    case "", CacheEvictionLRU, CacheEvictionLFU, CacheEvictionRandom:
+    default:
+        return fmt.Errorf("无效的 cache.eviction_policy: %s", c.Cache.EvictionPolicy)
+    }
+    if c.CacheWarm.Concurrency < 0 {
+        return fmt.Errorf("cache_warm.concurrency 不能为负数: %d", c.CacheWarm.Concurrency)
+    }
+    if errs := ValidateRules(c.Domains); len(errs) > 0 {
+        return ValidationErrors(errs)
+    }
+    if c.Upstream.TSIGKeyName != "" || c.Upstream.TSIGSecret != "" {
+        key := upstream.TSIGKey{Name: c.Upstream.TSIGKeyName, Algorithm: c.Upstream.TSIGAlgorithm, Secret: c.Upstream.TSIGSecret}
+        if err := key.Validate(); err != nil {
+            return fmt.Errorf("无效的上游 TSIG 配置: %w", err)
+        }
+    }
+    if c.Server.UpdateTSIGKeyName != "" || c.Server.UpdateTSIGSecret != "" {
+        key := upstream.TSIGKey{Name: c.Server.UpdateTSIGKeyName, Algorithm: c.Server.UpdateTSIGAlgorithm, Secret: c.Server.UpdateTSIGSecret}
+        if err := key.Validate(); err != nil {
+            return fmt.Errorf("无效的 DNS UPDATE TSIG 配置: %w", err)
+        }
+    }
+    if c.Metrics.StatsDAddress != "" {
+        if _, _, err := net.SplitHostPort(c.Metrics.StatsDAddress); err != nil {
+            return fmt.Errorf("无效的 metrics.statsd_address 地址 %s: %w", c.Metrics.StatsDAddress, err)
+        }
+    }
+    if c.Server.ForwardUpdatesTo != "" {
+        if _, _, err := net.SplitHostPort(c.Server.ForwardUpdatesTo); err != nil {
+            return fmt.Errorf("无效的 forward_updates_to 地址 %s: %w", c.Server.ForwardUpdatesTo, err)
+        }
+    }
+    for _, zone := range c.Server.DNSBLZones {
+        if strings.Trim(zone, ". ") == "" {
+            return fmt.Errorf("dnsbl_zones 中不能包含空的区域")
+        }
+        if expr, ok := strings.CutPrefix(zone, util.RegexPatternPrefix); ok {
+            if _, err := util.CompileRegex(expr); err != nil {
+                return fmt.Errorf("dnsbl_zones 中的正则表达式 %s 无效: %w", zone, err)
+            }
+        }
+    }
+    for _, pattern := range c.Server.InternalDomains {
+        if strings.Trim(pattern, ". ") == "" {
+            return fmt.Errorf("internal_domains 中不能包含空的域名")
+        }
+        if expr, ok := strings.CutPrefix(pattern, util.RegexPatternPrefix); ok {
+            if _, err := util.CompileRegex(expr); err != nil {
+                return fmt.Errorf("internal_domains 中的正则表达式 %s 无效: %w", pattern, err)
+            }
+        }
+    }
+    // 验证 RPZ 配置
+    for _, zone := range c.Server.RPZZones {
+        if strings.Trim(zone, ". ") == "" {
+            return fmt.Errorf("rpz_zones 中不能包含空的区域名")
+        }
+    }
+    if len(c.Server.RPZZones) > 0 && strings.TrimSpace(c.Server.RPZFile) == "" {
+        return fmt.Errorf("配置了 rpz_zones 时必须指定 rpz_file")
+    }
+    if c.Observability.OTelEndpoint != "" {
+        u, err := url.Parse(c.Observability.OTelEndpoint)
+        if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+            return fmt.Errorf("无效的 otel_endpoint，应为 http:// 或 https:// 地址: %s", c.Observability.OTelEndpoint)
+        }
+    }
+    if c.Server.DNS64Prefix != "" {
+        if err := ValidateDNS64Prefix(c.Server.DNS64Prefix); err != nil {
+            return err
+        }
+    }
+    switch c.Server.AnyQueryPolicy {
+    case "", AnyQueryPolicyPassthrough, AnyQueryPolicyRefuse, AnyQueryPolicyHINFO, AnyQueryPolicyEmpty:
+    default:
+        return fmt.Errorf("无效的 any_query_policy: %s", c.Server.AnyQueryPolicy)
+    }
+    // 验证备用上游触发条件
+    switch c.Upstream.FallbackTrigger {
+    case "", FallbackTriggerCDNMiss, FallbackTriggerNXDomain, FallbackTriggerError, FallbackTriggerAlways:
+    default:
+        return fmt.Errorf("无效的备用上游触发条件: %s", c.Upstream.FallbackTrigger)
+    }
     return nil
 }
 
@@ -47,6 +248,132 @@ type UpstreamConfig struct {
 	FallbackServer  string        `yaml:"fallback_server"`
 	Timeout         time.Duration `yaml:"timeout"`
 	NoRecordNoFallback bool        `yaml:"no_record_no_fallback"`
+	// FallbackTrigger 控制何时使用备用上游，默认 cdn_miss
+	FallbackTrigger string `yaml:"fallback_trigger"`
+	// InjectECS 在发往上游的查询中注入客户端子网 (EDNS Client Subnet)
+	InjectECS bool `yaml:"inject_ecs"`
+	// ECS 源前缀长度，未设置时分别为 24 和 56；设为 0 时不向上游透露客户端子网 (RFC 7871 7.1.2 节)
+	ECSSourcePrefixLenV4 *int `yaml:"ecs_source_prefix_len_v4"`
+	ECSSourcePrefixLenV6 *int `yaml:"ecs_source_prefix_len_v6"`
+	// UserAgent 上游为 DoH (https://) 时 HTTP 请求使用的 User-Agent，默认 fxdns/1.0
+	UserAgent string `yaml:"user_agent"`
+	// CDBit 在发往上游的查询中设置 CD (Checking Disabled) 位，使上游不做校验直接返回 DNSSEC 记录
+	CDBit bool `yaml:"cd_bit"`
+	// MergeResponses 并行查询主上游与备用上游，合并去重后的应答再做 CDN 检测与过滤
+	MergeResponses bool `yaml:"merge_responses"`
+	// ValidateResponses 对主上游响应做合理性检查，未通过时改用备用上游
+	ValidateResponses bool `yaml:"validate_responses"`
+	// StrictValidation 按存根解析器 (RFC 8499) 的要求检查上游响应的 ID 与问题段是否对应查询，不对应时换用新 ID 重试
+	StrictValidation bool `yaml:"strict_validation"`
+	// 以下为 DoH 上游 HTTP 连接池参数，为 0 时使用 net/http 的默认值
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	MaxConnsPerHost int           `yaml:"max_conns_per_host"`
+	IdleConnTimeout time.Duration `yaml:"idle_conn_timeout"`
+	// HTTPProxy DoH / JSON DoH 上游请求经由的 HTTP 代理，如 http://proxy.corp.example.com:8080
+	HTTPProxy string `yaml:"http_proxy"`
+	// HTTPProxyUser / HTTPProxyPassword 代理要求认证时的 Basic 认证凭据
+	HTTPProxyUser     string `yaml:"http_proxy_user"`
+	HTTPProxyPassword string `yaml:"http_proxy_password"`
+	// Protocol 主上游协议：dns（默认，server 以 https:// 开头时使用 DoH）或 json-doh
+	Protocol string `yaml:"protocol"`
+	// JSONDoHURL protocol 为 json-doh 时使用的 JSON API 地址，如 https://dns.google/resolve
+	JSONDoHURL string `yaml:"json_doh_url"`
+	// TSIGKeyName / TSIGAlgorithm / TSIGSecret 签名发往 UDP DNS 上游查询的 TSIG (RFC 2845) 密钥，
+	// 密钥名为空时不签名；算法默认 hmac-sha256，密钥为 base64 编码
+	TSIGKeyName   string `yaml:"tsig_key_name"`
+	TSIGAlgorithm string `yaml:"tsig_algorithm"`
+	TSIGSecret    string `yaml:"tsig_secret"`
+	// CircuitBreaker 主上游连续失败后暂停向其发送查询
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+	// Servers 与 server 并列的其他主上游，load_balance 为 latency 时参与选择
+	Servers []string `yaml:"servers"`
+	// LoadBalance 主上游的选择方式：为空时总是使用 server，latency 选择 RTT 的 EWMA 最低的上游
+	LoadBalance string `yaml:"load_balance"`
+}
+
+// CircuitBreakerConfig 上游熔断配置：window 内连续失败 failure_threshold 次后打开熔断，
+// open_duration 内不再向该上游发送查询，之后放行一个探测查询决定是否恢复
+type CircuitBreakerConfig struct {
+	// FailureThreshold 触发熔断的连续失败次数，为 0 时不启用
+	FailureThreshold int           `yaml:"failure_threshold"`
+	Window           time.Duration `yaml:"window"`        // 默认 10s
+	OpenDuration     time.Duration `yaml:"open_duration"` // 默认 30s
+}
+
+// DefaultCircuitBreakerWindow 未配置 circuit_breaker.window 时统计连续失败的时间窗口
+const DefaultCircuitBreakerWindow = 10 * time.Second
+
+// DefaultCircuitBreakerOpenDuration 未配置 circuit_breaker.open_duration 时熔断打开的时长
+const DefaultCircuitBreakerOpenDuration = 30 * time.Second
+
+// 未配置 ecs_source_prefix_len_v4 / ecs_source_prefix_len_v6 时使用的源前缀长度（RFC 7871 推荐值）
+const (
+	DefaultECSPrefixLenV4 = 24
+	DefaultECSPrefixLenV6 = 56
+)
+
+// intPtr 返回指向 n 的指针，用于填写区分未设置与零值的配置项
+func intPtr(n int) *int {
+	return &n
+}
+
+// ECSPrefixLenV4 返回注入 ECS 时使用的 IPv4 源前缀长度，显式配置的 0 保留
+func (u *UpstreamConfig) ECSPrefixLenV4() int {
+	if u.ECSSourcePrefixLenV4 == nil {
+		return DefaultECSPrefixLenV4
+	}
+	return *u.ECSSourcePrefixLenV4
+}
+
+// ECSPrefixLenV6 返回注入 ECS 时使用的 IPv6 源前缀长度，显式配置的 0 保留
+func (u *UpstreamConfig) ECSPrefixLenV6() int {
+	if u.ECSSourcePrefixLenV6 == nil {
+		return DefaultECSPrefixLenV6
+	}
+	return *u.ECSSourcePrefixLenV6
+}
+
+// UpdateTSIGKey 返回校验与签名 DNS UPDATE 的 TSIG 密钥 (已规范化)，未配置 update_tsig_key_name 时返回 nil
+func (s *ServerConfig) UpdateTSIGKey() *upstream.TSIGKey {
+	if s.UpdateTSIGKeyName == "" {
+		return nil
+	}
+	key := upstream.TSIGKey{Name: s.UpdateTSIGKeyName, Algorithm: s.UpdateTSIGAlgorithm, Secret: s.UpdateTSIGSecret}.Normalize()
+	return &key
+}
+
+// TSIGKey 返回配置的 TSIG 密钥，未配置 tsig_key_name 时返回 nil
+func (u *UpstreamConfig) TSIGKey() *upstream.TSIGKey {
+	if u.TSIGKeyName == "" {
+		return nil
+	}
+	return &upstream.TSIGKey{Name: u.TSIGKeyName, Algorithm: u.TSIGAlgorithm, Secret: u.TSIGSecret}
+}
+
+// 上游协议常量 (UpstreamConfig.Protocol)
+const (
+	UpstreamProtocolDNS     = "dns"      // 按 server 地址使用 UDP 或 RFC 8484 DoH（默认）
+	UpstreamProtocolJSONDoH = "json-doh" // 通过 JSON API (Google / Cloudflare 格式) 查询 json_doh_url
+)
+
+// PrimaryServers 返回参与 load_balance 选择的全部主上游：PrimaryServer 在前，之后为 servers 中不重复的地址
+func (u *UpstreamConfig) PrimaryServers() []string {
+	servers := []string{u.PrimaryServer()}
+	for _, addr := range u.Servers {
+		addr = strings.TrimSpace(addr)
+		if !slices.Contains(servers, addr) {
+			servers = append(servers, addr)
+		}
+	}
+	return servers
+}
+
+// PrimaryServer 返回实际使用的主上游地址：protocol 为 json-doh 时为 json_doh_url，否则为 server
+func (u *UpstreamConfig) PrimaryServer() string {
+	if u.Protocol == UpstreamProtocolJSONDoH {
+		return u.JSONDoHURL
+	}
+	return u.Server
 }
 
 // ServerConfig 表示 DNS 服务器的配置
@@ -55,15 +382,343 @@ type ServerConfig struct {
 	Workers   int           `yaml:"workers"`
 	CacheSize int           `yaml:"cache_size"`
 	CacheTTL  time.Duration `yaml:"cache_ttl"`
+	// MaxConcurrentQueries 同时处理（包括等待工作池）的查询数上限，超出的查询直接返回 REFUSED，0 表示不限制
+	MaxConcurrentQueries int `yaml:"max_concurrent_queries"`
+	// AdminListen 管理 HTTP 服务监听地址，为空时不启动
+	AdminListen string `yaml:"admin_listen"`
+	// ListenTCP TCP 监听地址，仅 network 为 udp 时生效；为空或与 Listen 相同时不单独监听 TCP
+	ListenTCP string `yaml:"listen_tcp"`
+	// Network 监听协议：udp(默认)、tcp、doq
+	Network string `yaml:"network"`
+	// DoTListen DNS-over-TLS (RFC 7858) 监听地址，为空时不启动
+	DoTListen string `yaml:"dot_listen"`
+	// DoHListen DNS-over-HTTPS (RFC 8484) 监听地址，为空时不启动；配置了 TLSCert / TLSKey 时使用 HTTPS，否则使用明文 HTTP
+	DoHListen string `yaml:"doh_listen"`
+	// DoHResponsePadding 查询带有 EDNS0 Padding 选项时，将 DoH 响应填充到 DoHPaddingBlockSize 的整数倍，避免响应长度暴露记录数量
+	DoHResponsePadding bool `yaml:"doh_response_padding"`
+	// DoHPaddingBlockSize DoH 响应填充的块大小（字节），0 表示使用默认值 128
+	DoHPaddingBlockSize int `yaml:"doh_padding_block_size"`
+	// TLSCert / TLSKey 加密传输（DoQ、DoT）使用的证书与私钥路径
+	TLSCert string `yaml:"tls_cert"`
+	TLSKey  string `yaml:"tls_key"`
+	// ReadBufferSize / WriteBufferSize UDP 套接字收发缓冲区大小（字节），0 表示使用系统默认值
+	ReadBufferSize  int `yaml:"read_buffer_size"`
+	WriteBufferSize int `yaml:"write_buffer_size"`
+	// ResponseCacheNegativeDomains 匹配这些模式的域名，其 NXDOMAIN 响应按 NegativeTTL 缓存
+	ResponseCacheNegativeDomains []string `yaml:"response_cache_negative_domains"`
+	// NegativeTTL NXDOMAIN 响应的缓存有效期，0 表示沿用 CacheTTL；响应带有 SOA 时不超过其 MINIMUM
+	NegativeTTL time.Duration `yaml:"negative_ttl"`
+	// TTLJitterFactor 写入缓存时将有效期随机调整 ±factor 的比例 (如 0.1 为 ±10%)，避免大量条目同时过期，0 表示不调整
+	TTLJitterFactor float64 `yaml:"ttl_jitter_factor"`
+	// StaleWhileRevalidate 缓存过期后的 StaleTTL 时间内仍立即返回过期响应，同时在后台向上游刷新
+	StaleWhileRevalidate bool `yaml:"stale_while_revalidate"`
+	// StaleTTL 过期响应的保留时长，0 表示使用默认值 1h，仅 StaleWhileRevalidate 开启时生效
+	StaleTTL time.Duration `yaml:"stale_ttl"`
+	// RecentQueriesSize 管理接口 /queries/recent 保留的最近查询条数，0 表示使用默认值 1000
+	RecentQueriesSize int `yaml:"recent_queries_size"`
+	// MigrationGracePeriod listen 变更后旧监听继续服务的时长，0 表示使用默认值 5s
+	MigrationGracePeriod time.Duration `yaml:"migration_grace_period"`
+	// ChaosVersion / ChaosHostname 对 CHAOS 类 version.bind / hostname.bind TXT 查询的本地应答内容，
+	// 为 refuse 时返回 REFUSED，为空时按普通查询转发上游
+	ChaosVersion  string `yaml:"chaos_version"`
+	ChaosHostname string `yaml:"chaos_hostname"`
+	// AnyQueryPolicy 对 ANY 类型查询的处理方式，默认 passthrough
+	AnyQueryPolicy string `yaml:"any_query_policy"`
+	// DNS64Prefix NAT64 前缀 (RFC 6052)，如 64:ff9b::/96。非空时为没有 AAAA 记录的域名由 A 记录合成 AAAA 记录
+	DNS64Prefix string `yaml:"dns64_prefix"`
+	// ForwardUpdatesTo DNS UPDATE (RFC 2136) 消息的转发地址 (host:port)，为空时对 UPDATE 返回 REFUSED
+	ForwardUpdatesTo string `yaml:"forward_updates_to"`
+	// UpdateTSIGKeyName / UpdateTSIGAlgorithm / UpdateTSIGSecret 校验客户端 DNS UPDATE 的 TSIG (RFC 2845) 签名，
+	// 并以同一密钥重新签名后转发给 forward_updates_to；密钥名为空时带签名的 UPDATE 返回 NOTAUTH
+	UpdateTSIGKeyName   string `yaml:"update_tsig_key_name"`
+	UpdateTSIGAlgorithm string `yaml:"update_tsig_algorithm"`
+	UpdateTSIGSecret    string `yaml:"update_tsig_secret"`
+	// DNSBLZones DNSBL 区域模式，查询名为 <反向 IP>.<区域> 且命中其中的模式时返回表示"已列入"的 127.0.0.2
+	DNSBLZones []string `yaml:"dnsbl_zones"`
+	// RebindingProtection 开启后，不在 InternalDomains 中的域名的应答去掉私有、链路本地与回环地址，防止 DNS 重绑定攻击
+	RebindingProtection bool `yaml:"rebinding_protection"`
+	// InternalDomains 允许解析到内网地址的域名模式，仅 RebindingProtection 开启时生效
+	InternalDomains []string `yaml:"internal_domains"`
+	// GlobalStripAdditional 未设置 strip_additional 的域名是否去掉响应附加段中除 OPT 以外的记录
+	GlobalStripAdditional bool `yaml:"global_strip_additional"`
+	// RPZZones 生效的 RPZ (Response Policy Zone) 区域名，按优先级从高到低排列，先命中的区域生效
+	RPZZones []string `yaml:"rpz_zones"`
+	// RPZFile 主文件格式的 RPZ 数据文件，可包含多个区域的记录，配置了 RPZZones 时必填
+	RPZFile string `yaml:"rpz_file"`
+}
+
+// ValidateDNS64Prefix 检查 NAT64 前缀：必须是 IPv6 网段，长度为 RFC 6052 规定的 32/40/48/56/64/96 之一，
+// 且 64-71 位 (u 字节) 为 0
+func ValidateDNS64Prefix(prefix string) error {
+	ip, ipnet, err := net.ParseCIDR(prefix)
+	if err != nil || ip.To4() != nil {
+		return fmt.Errorf("无效的 dns64_prefix: %s", prefix)
+	}
+	switch ones, _ := ipnet.Mask.Size(); ones {
+	case 32, 40, 48, 56, 64, 96:
+	default:
+		return fmt.Errorf("dns64_prefix 的长度必须是 32、40、48、56、64 或 96: %s", prefix)
+	}
+	if ipnet.IP[8] != 0 {
+		return fmt.Errorf("dns64_prefix 的 64-71 位必须为 0: %s", prefix)
+	}
+	return nil
+}
+
+// ChaosRefuse chaos_version / chaos_hostname 取此值时对相应查询返回 REFUSED
+const ChaosRefuse = "refuse"
+
+// ANY 查询处理方式常量 (ServerConfig.AnyQueryPolicy)
+const (
+	AnyQueryPolicyPassthrough = "passthrough" // 照常转发上游（默认）
+	AnyQueryPolicyRefuse      = "refuse"      // 返回 REFUSED
+	AnyQueryPolicyHINFO       = "hinfo"       // 按 RFC 8482 返回合成的 HINFO 记录
+	AnyQueryPolicyEmpty       = "empty"       // 返回不含记录的 NOERROR 响应
+)
+
+// SplitHorizonConfig 表示分区解析 (split-horizon) 配置
+type SplitHorizonConfig struct {
+	// Subnets 客户端 CIDR → 上游服务器地址 (IP:端口)，网段重叠时使用前缀最长的一个
+	Subnets map[string]string `yaml:"subnets"`
+}
+
+// CacheConfig 表示响应缓存配置
+type CacheConfig struct {
+	// EvictionPolicy 缓存已满时的淘汰策略，默认 lru
+	EvictionPolicy string `yaml:"eviction_policy"`
 }
 
+// 缓存淘汰策略常量 (CacheConfig.EvictionPolicy)
+const (
+	CacheEvictionLRU    = "lru"    // 淘汰最久未被访问的条目（默认）
+	CacheEvictionLFU    = "lfu"    // 淘汰命中次数最少的条目，次数相同时淘汰最久未被访问的条目
+	CacheEvictionRandom = "random" // 随机淘汰一个条目
+)
+
+// CacheWarmConfig 表示缓存预热配置
+type CacheWarmConfig struct {
+	// Domains 启动时预先查询 (A 记录) 并缓存的域名
+	Domains []string `yaml:"domains"`
+	// Concurrency 预热并发数，默认 5
+	Concurrency int `yaml:"concurrency"`
+}
+
+// MetricsConfig 表示指标接口配置
+type MetricsConfig struct {
+	// AuthToken 非空时 /metrics 要求 Authorization: Bearer <token>，否则返回 401
+	AuthToken string `yaml:"auth_token"`
+	// StatsDAddress 非空时以 StatsD 协议通过 UDP 向此地址 (host:port) 发送查询数、缓存命中与上游耗时等指标
+	StatsDAddress string `yaml:"statsd_address"`
+}
+
+// ObservabilityConfig 表示链路追踪配置
+type ObservabilityConfig struct {
+	// OTelEndpoint OTLP/HTTP 追踪数据的接收地址 (如 http://127.0.0.1:4318)，非空时为每个查询记录 OpenTelemetry 追踪
+	OTelEndpoint string `yaml:"otel_endpoint"`
+}
+
+// ConfigFileConfig 表示配置文件热加载的设置
+type ConfigFileConfig struct {
+	// PollInterval 大于 0 时按此间隔轮询配置文件的修改时间与大小，代替 fsnotify 监控，
+	// 用于 NFS 等文件事件不可靠的环境
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// BackupDir 非空时，热加载替换配置前将原配置文件内容备份到此目录下的 config_<时间戳>.yaml
+	BackupDir string `yaml:"backup_dir"`
+	// MaxBackups BackupDir 中保留的备份数量，超出时删除最旧的备份，0 表示全部保留
+	MaxBackups int `yaml:"max_backups"`
+}
+
+// DefaultCacheWarmConcurrency 缓存预热的默认并发数
+const DefaultCacheWarmConcurrency = 5
+
+// DefaultMigrationGracePeriod listen 变更后旧监听默认继续服务的时长
+const DefaultMigrationGracePeriod = 5 * time.Second
+
+// DefaultDoHPaddingBlockSize doh_response_padding 开启时默认的填充块大小（字节），RFC 8467 建议的响应块大小
+const DefaultDoHPaddingBlockSize = 128
+
+// DefaultStaleTTL stale_while_revalidate 开启时过期响应默认的保留时长
+const DefaultStaleTTL = time.Hour
+
+// DefaultRecentQueriesSize 默认保留的最近查询条数
+const DefaultRecentQueriesSize = 1000
+
+// 监听协议常量
+const (
+	NetworkUDP = "udp"
+	NetworkTCP = "tcp"
+	NetworkDoQ = "doq"
+)
+
 // DomainRule 表示域名处理规则
 type DomainRule struct {
-	Pattern               string  `yaml:"pattern"`
-	Strategy              string  `yaml:"strategy"`
-	TTL                   uint32  `yaml:"ttl"`       // 返回给客户端的 TTL 值（秒）
-	StripCNAMEWhenNoRecord bool    `yaml:"strip_cname_when_no_record"`
-	NoRecordNoFallback    *bool   `yaml:"no_record_no_fallback"`
+	Pattern               string  `yaml:"pattern" json:"pattern"`
+	Strategy              string  `yaml:"strategy" json:"strategy"`
+	TTL                   uint32  `yaml:"ttl" json:"ttl"`       // 返回给客户端的 TTL 值（秒）
+	StripCNAMEWhenNoRecord bool    `yaml:"strip_cname_when_no_record" json:"strip_cname_when_no_record"`
+	NoRecordNoFallback    *bool   `yaml:"no_record_no_fallback" json:"no_record_no_fallback,omitempty"`
+	// Weight return_cdn_a 策略下每次返回的 CDN IP 数量，0 表示返回全部
+	Weight int `yaml:"weight" json:"weight,omitempty"`
+	// FallbackStrategy 主上游结果中未发现 CDN IP 时的处理方式，默认 use_fallback
+	FallbackStrategy string `yaml:"fallback_strategy" json:"fallback_strategy,omitempty"`
+	// MinCDNIPs 至少检测到多少个 CDN IP 才视为命中 CDN，默认 1
+	MinCDNIPs int `yaml:"min_cdnips" json:"min_cdnips,omitempty"`
+	// ResponseTTLMultiplier 返回给客户端的记录 TTL 乘以此系数，0 视为 1.0（不调整）
+	ResponseTTLMultiplier float64 `yaml:"response_ttl_multiplier" json:"response_ttl_multiplier,omitempty"`
+	// MinTTL / MaxTTL 按 response_ttl_multiplier 调整后 TTL 的上下限（秒），0 表示不限制
+	MinTTL uint32 `yaml:"min_ttl" json:"min_ttl,omitempty"`
+	MaxTTL uint32 `yaml:"max_ttl" json:"max_ttl,omitempty"`
+	// ForceAOnly 对 AAAA 查询直接返回不含记录的 NOERROR 响应，不转发上游
+	ForceAOnly bool `yaml:"force_a_only" json:"force_a_only,omitempty"`
+	// MaxResponseIPs 通过 UDP 返回的 A/AAAA 记录数上限，优先保留 CDN IP，超出时设置 TC 位；0 表示不限制
+	MaxResponseIPs int `yaml:"max_response_ips" json:"max_response_ips,omitempty"`
+	// NormalizeResponse 去掉上游应答中重复的 A/AAAA 与 CNAME 记录
+	NormalizeResponse bool `yaml:"normalize_response" json:"normalize_response,omitempty"`
+	// UpstreamTimeout 该域名的主备上游查询超时时间，0 表示使用 upstream.timeout
+	UpstreamTimeout time.Duration `yaml:"upstream_timeout" json:"upstream_timeout,omitempty"`
+	// StripAdditional 去掉响应附加段中除 OPT 以外的记录，未设置时使用 server.global_strip_additional
+	StripAdditional *bool `yaml:"strip_additional" json:"strip_additional,omitempty"`
+	// EnforceSingleCNAME 应答中从查询域名出发的 CNAME 链超过一层时返回 SERVFAIL
+	EnforceSingleCNAME bool `yaml:"enforce_single_cname" json:"enforce_single_cname,omitempty"`
+	// CDNCIDROverride 非空时，该域名的 CDN 检测与过滤只使用这些网段，而不是全局的 cdn_ips
+	CDNCIDROverride []string `yaml:"cdn_cidr_override" json:"cdn_cidr_override,omitempty"`
+	// SyntheticSOA 非空时，fallback_strategy 为 nxdomain 时合成的 NXDOMAIN 响应在授权段附带此 SOA 记录
+	SyntheticSOA *SyntheticSOA `yaml:"synthetic_soa" json:"synthetic_soa,omitempty"`
+	// QtypeFilter 非空时规则的 strategy 只对这些查询类型 (如 ["A", "AAAA"]) 生效，其他类型按 none 处理
+	QtypeFilter []string `yaml:"qtype_filter" json:"qtype_filter,omitempty"`
+	// ModifyExpr 非空时用此 expr 表达式改写应答中的 A/AAAA 地址，表达式返回新的 IP 列表，可用变量见 ModifyExprEnv
+	ModifyExpr string `yaml:"modify_expr" json:"modify_expr,omitempty"`
+	// CDNResponseOrder 返回给客户端的 A/AAAA 记录的排列顺序，默认 original（保持上游顺序）
+	CDNResponseOrder string `yaml:"cdn_response_order" json:"cdn_response_order,omitempty"`
+	// CDNLatencyProbe 允许服务器主动 TCP 连接应答中 CDN IP 的 443 端口测量 RTT，cdn_response_order 为 latency_sorted 时必须开启
+	CDNLatencyProbe bool `yaml:"cdn_latency_probe" json:"cdn_latency_probe,omitempty"`
+	// VerifyCDNIPOwnership 检测到 CDN IP 后反查其 PTR 记录，名称不匹配 CDNOwnershipPattern 的 IP 不视为 CDN IP
+	VerifyCDNIPOwnership bool `yaml:"verify_cdnip_ownership" json:"verify_cdnip_ownership,omitempty"`
+	// CDNOwnershipPattern CDN IP 的 PTR 名称应匹配的域名模式，语法与 pattern 相同，如 *.cdn.example.net
+	CDNOwnershipPattern string `yaml:"cdn_ownership_pattern" json:"cdn_ownership_pattern,omitempty"`
+	// Tags 规则标签，仅用于分类查询，不影响匹配行为
+	Tags []string `yaml:"tags" json:"tags,omitempty"`
+
+	// cdnMatcher 由 CDNCIDROverride 构建的匹配器，加载配置时创建
+	cdnMatcher *util.CIDRMatcher
+	// qtypes 由 QtypeFilter 解析出的查询类型，加载配置时创建
+	qtypes []uint16
+	// modifyProgram 由 ModifyExpr 编译的程序，加载配置时创建
+	modifyProgram *vm.Program
+	// matcher 由 Pattern 编译的匹配器，加载配置时创建
+	matcher *util.DomainPattern
+}
+
+// Match 判断域名是否匹配规则的 pattern，使用加载配置时编译的匹配器；
+// 未经加载流程构造的规则按 Pattern 临时编译
+func (r *DomainRule) Match(domain string) bool {
+	if r.matcher == nil {
+		return util.MatchDomain(r.Pattern, domain)
+	}
+	return r.matcher.Match(domain)
+}
+
+// AppliesTo 判断规则的 strategy 是否对查询类型 qtype 生效，未配置 qtype_filter 时对所有类型生效
+func (r *DomainRule) AppliesTo(qtype uint16) bool {
+	if len(r.QtypeFilter) == 0 {
+		return true
+	}
+	for _, t := range r.qtypes {
+		if t == qtype {
+			return true
+		}
+	}
+	return false
+}
+
+// SyntheticSOA 合成 NXDOMAIN 响应中的 SOA 记录，各字段为零值时使用 DefaultSyntheticSOA 中的对应值
+type SyntheticSOA struct {
+	MName   string `yaml:"mname" json:"mname,omitempty"`
+	RName   string `yaml:"rname" json:"rname,omitempty"`
+	Serial  uint32 `yaml:"serial" json:"serial,omitempty"`
+	Refresh uint32 `yaml:"refresh" json:"refresh,omitempty"`
+	Retry   uint32 `yaml:"retry" json:"retry,omitempty"`
+	Expire  uint32 `yaml:"expire" json:"expire,omitempty"`
+	// Minimum 同时作为 SOA 记录的 TTL，即客户端缓存该 NXDOMAIN 的时长 (RFC 2308)
+	Minimum uint32 `yaml:"minimum" json:"minimum,omitempty"`
+}
+
+// DefaultSyntheticSOA synthetic_soa 中未设置的字段使用的默认值
+var DefaultSyntheticSOA = SyntheticSOA{
+	MName:   "localhost.",
+	RName:   "hostmaster.localhost.",
+	Serial:  1,
+	Refresh: 3600,
+	Retry:   600,
+	Expire:  86400,
+	Minimum: 300,
+}
+
+// WithDefaults 返回以 DefaultSyntheticSOA 补全零值字段后的副本
+func (s SyntheticSOA) WithDefaults() SyntheticSOA {
+	d := DefaultSyntheticSOA
+	if s.MName == "" {
+		s.MName = d.MName
+	}
+	if s.RName == "" {
+		s.RName = d.RName
+	}
+	if s.Serial == 0 {
+		s.Serial = d.Serial
+	}
+	if s.Refresh == 0 {
+		s.Refresh = d.Refresh
+	}
+	if s.Retry == 0 {
+		s.Retry = d.Retry
+	}
+	if s.Expire == 0 {
+		s.Expire = d.Expire
+	}
+	if s.Minimum == 0 {
+		s.Minimum = d.Minimum
+	}
+	return s
+}
+
+// CDNMatcher 返回由 cdn_cidr_override 构建的 CIDR 匹配器，未配置时返回 nil
+func (r *DomainRule) CDNMatcher() *util.CIDRMatcher {
+	return r.cdnMatcher
+}
+
+// MarshalJSON 与默认编码相同，但 upstream_timeout 以 "5s" 形式输出，与 ExportJSON 中的时长格式一致
+func (r DomainRule) MarshalJSON() ([]byte, error) {
+	type plain DomainRule
+	view := struct {
+		plain
+		UpstreamTimeout string `json:"upstream_timeout,omitempty"`
+	}{plain: plain(r)}
+	if r.UpstreamTimeout != 0 {
+		view.UpstreamTimeout = r.UpstreamTimeout.String()
+	}
+	return json.Marshal(view)
+}
+
+// UnmarshalJSON 与默认解码相同，但 upstream_timeout 按 "5s" 形式的时长解析
+func (r *DomainRule) UnmarshalJSON(data []byte) error {
+	type plain DomainRule
+	var view struct {
+		*plain
+		UpstreamTimeout string `json:"upstream_timeout"`
+	}
+	view.plain = (*plain)(r)
+	if err := json.Unmarshal(data, &view); err != nil {
+		return err
+	}
+	r.UpstreamTimeout = 0
+	if view.UpstreamTimeout != "" {
+		d, err := time.ParseDuration(view.UpstreamTimeout)
+		if err != nil {
+			return fmt.Errorf("无效的 upstream_timeout: %w", err)
+		}
+		r.UpstreamTimeout = d
+	}
+	return nil
 }
 
 // 策略常量
@@ -73,6 +728,35 @@ const (
 	StrategyNone         = "none"
 )
 
+// 备用上游触发条件常量
+const (
+	FallbackTriggerCDNMiss  = "cdn_miss" // 主上游结果中未发现 CDN IP 时使用备用上游
+	FallbackTriggerNXDomain = "nxdomain" // 主上游返回 NXDOMAIN 时使用备用上游
+	FallbackTriggerError    = "error"    // 主上游出错（含 SERVFAIL 等异常 RCODE）时使用备用上游
+	FallbackTriggerAlways   = "always"   // 并行查询主备上游，优先使用主上游结果
+)
+
+// 应答 IP 排列顺序常量 (DomainRule.CDNResponseOrder)
+const (
+	CDNOrderOriginal       = "original"         // 保持上游返回的顺序
+	CDNOrderClientIPSorted = "client_ip_sorted" // 按与客户端 IP 的 XOR 距离升序
+	CDNOrderRandom         = "random"           // 每次响应随机打乱
+	CDNOrderLatencySorted  = "latency_sorted"   // 按服务器到各 IP 的历史 RTT 升序
+)
+
+// 主上游负载均衡方式常量 (UpstreamConfig.LoadBalance)
+const (
+	LoadBalanceLatency = "latency" // 选择 RTT 的 EWMA 最低的上游
+)
+
+// CDN IP 未命中时的处理方式常量 (DomainRule.FallbackStrategy)
+const (
+	FallbackStrategyUseFallback   = "use_fallback"   // 按 fallback_trigger 转发到备用上游（默认）
+	FallbackStrategyReturnPrimary = "return_primary" // 直接返回主上游结果
+	FallbackStrategyReturnEmpty   = "return_empty"   // 返回不含记录的 NOERROR 响应
+	FallbackStrategyNXDomain      = "nxdomain"       // 返回 NXDOMAIN
+)
+
 // 全局配置实例
 
 // LoadConfig 从文件加载配置
@@ -81,16 +765,40 @@ func LoadConfig(configPath string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	return LoadConfigFromBytes(data)
+}
+
+// LoadConfigFromBytes 从 YAML 内容解析配置（旧版本的配置先在内存中迁移到 CurrentConfigVersion），
+// 应用环境变量覆盖，并完成 CIDR 解析和校验
+func LoadConfigFromBytes(data []byte) (*Config, error) {
+	// 旧版本的配置先迁移到当前版本
+	version, err := configVersion(data)
+	if err != nil {
+		return nil, err
+	}
+	if version != CurrentConfigVersion {
+		if data, err = migrateInMemory(data, version); err != nil {
+			return nil, err
+		}
+	}
 
 	var cfg Config
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, err
 	}
 
+	// 环境变量覆盖文件中的配置项
+	if err := cfg.ApplyEnvironmentOverrides(); err != nil {
+		return nil, err
+	}
+
 	// 解析 CIDR
 	if err := cfg.parseCIDRs(); err != nil {
 		return nil, err
 	}
+	cfg.compileDomainPatterns()
+	cfg.parseQtypeFilters()
+	cfg.compileModifyExprs()
 
 	// 基本校验，确保与单测期望一致
 	if err := cfg.Validate(); err != nil {
@@ -113,9 +821,43 @@ func (c *Config) parseCIDRs() error {
 		}
 		c.parsedCIDRs = append(c.parsedCIDRs, cidr)
 	}
+
+	// 为配置了 cdn_cidr_override 的规则创建各自的匹配器，无效的网段由 ValidateRules 报告
+	for i := range c.Domains {
+		rule := &c.Domains[i]
+		rule.cdnMatcher = nil
+		if len(rule.CDNCIDROverride) == 0 {
+			continue
+		}
+		matcher := util.NewCIDRMatcher()
+		if err := matcher.AddCIDRs(rule.CDNCIDROverride); err != nil {
+			continue
+		}
+		rule.cdnMatcher = matcher
+	}
 	return nil
 }
 
+// compileDomainPatterns 编译各规则的 pattern，无效的正则由 ValidateRules 报告
+func (c *Config) compileDomainPatterns() {
+	for i := range c.Domains {
+		c.Domains[i].matcher = util.CompileDomainPattern(c.Domains[i].Pattern)
+	}
+}
+
+// parseQtypeFilters 将各规则 qtype_filter 中的类型名 (不区分大小写) 转换为查询类型，无效的类型名由 ValidateRules 报告
+func (c *Config) parseQtypeFilters() {
+	for i := range c.Domains {
+		rule := &c.Domains[i]
+		rule.qtypes = nil
+		for _, name := range rule.QtypeFilter {
+			if qtype, ok := dns.StringToType[strings.ToUpper(strings.TrimSpace(name))]; ok {
+				rule.qtypes = append(rule.qtypes, qtype)
+			}
+		}
+	}
+}
+
 // IsCDNIP 检查 IP 是否属于 CDN 节点
 func (c *Config) IsCDNIP(ip net.IP) bool {
 	c.mu.RLock()
@@ -129,63 +871,110 @@ func (c *Config) IsCDNIP(ip net.IP) bool {
 	return false
 }
 
-// GetDomainStrategy 获取域名的处理策略
-func (c *Config) GetDomainStrategy(domain string) string {
-	for _, rule := range c.Domains {
-		if MatchDomain(rule.Pattern, domain) {
+// GetDomainStrategy 获取域名的处理策略，匹配规则的 qtype_filter 不包含 qtype 时返回 StrategyNone
+func (c *Config) GetDomainStrategy(domain string, qtype uint16) string {
+	for i := range c.Domains {
+		rule := &c.Domains[i]
+		if rule.Match(domain) {
+			if !rule.AppliesTo(qtype) {
+				return StrategyNone
+			}
 			return rule.Strategy
 		}
 	}
 	return StrategyNone
 }
 
-// MatchDomain 检查域名是否匹配模式（支持泛域名）
-func MatchDomain(pattern, domain string) bool {
-	// 如果域名以点结尾，去掉最后的点
-	if len(domain) > 0 && domain[len(domain)-1] == '.' {
-		domain = domain[:len(domain)-1]
-	}
-	
-	// 精确匹配
-	if pattern == domain {
-		return true
-	}
-	
-	// 泛域名匹配
-	if strings.HasPrefix(pattern, "*.") {
-		suffix := pattern[1:] // 包含开头的点
-		
-		// 检查是否以后缀结尾
-		if strings.HasSuffix(domain, suffix) {
-			return true
+// GetDomainRule 返回第一条匹配域名的规则，没有匹配时返回 nil
+func (c *Config) GetDomainRule(domain string) *DomainRule {
+	for i := range c.Domains {
+		if c.Domains[i].Match(domain) {
+			return &c.Domains[i]
 		}
-		
-		// 检查子域名
-		parts := strings.Split(domain, ".")
-		if len(parts) >= 2 {
-			// 构建可能的匹配域名
-			for i := 1; i < len(parts); i++ {
-				subDomain := "*." + strings.Join(parts[i:], ".")
-				if subDomain == pattern {
-					return true
-				}
+	}
+	return nil
+}
+
+// GetRulesForTag 返回带有指定标签的所有域名规则
+func (c *Config) GetRulesForTag(tag string) []DomainRule {
+	var rules []DomainRule
+	for _, rule := range c.Domains {
+		for _, t := range rule.Tags {
+			if t == tag {
+				rules = append(rules, rule)
+				break
 			}
 		}
 	}
-	
-	// 正则表达式匹配
-	if strings.Contains(pattern, "*") || strings.Contains(pattern, "?") {
-		// 将通配符转换为正则表达式
-		regexPattern := strings.Replace(pattern, ".", "\\.", -1)
-		regexPattern = strings.Replace(regexPattern, "*", ".*", -1)
-		regexPattern = strings.Replace(regexPattern, "?", ".", -1)
-		regexPattern = "^" + regexPattern + "$"
-		
-		reg, err := regexp.Compile(regexPattern)
-		if err == nil && reg.MatchString(domain) {
-			return true
+	return rules
+}
+
+// Hash 返回配置规范化 YAML 序列化结果的 SHA256 摘要，用于快速判断配置是否发生变化
+// 序列化失败时返回空字符串
+func (c *Config) Hash() string {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// redactedFields ExportRedactedJSON 中隐去的敏感字段，按 YAML 路径 (节, 字段) 列出
+var redactedFields = [][2]string{
+	{"metrics", "auth_token"},
+	{"upstream", "tsig_secret"},
+	{"upstream", "http_proxy_password"},
+	{"server", "update_tsig_secret"},
+}
+
+// ExportJSON 将配置的全部公开字段导出为 JSON，供外部工具检查线上配置。
+// 字段名与 YAML 配置文件一致，time.Duration 以 "5s" 形式的字符串输出
+func (c *Config) ExportJSON() ([]byte, error) {
+	fields, err := c.exportFields()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// ExportRedactedJSON 与 ExportJSON 相同，但非空的 metrics.auth_token、upstream.tsig_secret、
+// upstream.http_proxy_password 与 server.update_tsig_secret 替换为 ******，供管理接口输出
+func (c *Config) ExportRedactedJSON() ([]byte, error) {
+	fields, err := c.exportFields()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range redactedFields {
+		section, ok := fields[path[0]].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if v, ok := section[path[1]].(string); ok && v != "" {
+			section[path[1]] = "******"
 		}
 	}
-	
-	return false
+	return json.Marshal(fields)
+}
+
+// exportFields 持有读锁将配置序列化为以 yaml 标签为键的嵌套 map
+func (c *Config) exportFields() (map[string]interface{}, error) {
+	// 先经由 YAML 序列化，沿用 yaml 标签作为字段名，并由 yaml.v3 将 Duration 格式化为字符串
+	c.mu.RLock()
+	data, err := yaml.Marshal(c)
+	c.mu.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("序列化配置失败: %w", err)
+	}
+	var fields map[string]interface{}
+	if err := yaml.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("序列化配置失败: %w", err)
+	}
+	return fields, nil
+}
+
+// MatchDomain 检查域名是否匹配模式，委托给 util.MatchDomain，
+// 使配置查找与服务器匹配器共用同一套语义（泛域名、re: 正则与 IDN 规范化）
+func MatchDomain(pattern, domain string) bool {
+	return util.MatchDomain(pattern, domain)
 }
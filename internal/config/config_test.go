@@ -1,10 +1,13 @@
 package config
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/miekg/dns"
 )
 
 func TestConfigParsing(t *testing.T) {
@@ -30,11 +33,11 @@ cdn_ips:
 
 domains:
   - pattern: "example.com"
-    strategy: "filter"
+    strategy: "filter_non_cdn"
   - pattern: "*.cdn.com"
-    strategy: "replace"
+    strategy: "return_cdn_a"
   - pattern: "regex:.*\\.dynamic\\.com"
-    strategy: "filter"
+    strategy: "filter_non_cdn"
 `
 	err := os.WriteFile(configPath, []byte(configContent), 0644)
 	if err != nil {
@@ -81,12 +84,12 @@ domains:
 	if len(cfg.Domains) != 3 {
 		t.Errorf("域名规则数量错误, 期望: 3, 实际: %d", len(cfg.Domains))
 	}
-	if cfg.Domains[0].Pattern != "example.com" || cfg.Domains[0].Strategy != "filter" {
-		t.Errorf("域名规则配置错误, 期望: example.com/filter, 实际: %s/%s", 
+	if cfg.Domains[0].Pattern != "example.com" || cfg.Domains[0].Strategy != "filter_non_cdn" {
+		t.Errorf("域名规则配置错误, 期望: example.com/filter_non_cdn, 实际: %s/%s", 
 			cfg.Domains[0].Pattern, cfg.Domains[0].Strategy)
 	}
-	if cfg.Domains[1].Pattern != "*.cdn.com" || cfg.Domains[1].Strategy != "replace" {
-		t.Errorf("域名规则配置错误, 期望: *.cdn.com/replace, 实际: %s/%s", 
+	if cfg.Domains[1].Pattern != "*.cdn.com" || cfg.Domains[1].Strategy != "return_cdn_a" {
+		t.Errorf("域名规则配置错误, 期望: *.cdn.com/return_cdn_a, 实际: %s/%s", 
 			cfg.Domains[1].Pattern, cfg.Domains[1].Strategy)
 	}
 }
@@ -129,6 +132,274 @@ server:
   listen: "127.0.0.1:53"
 cdn_ips:
   - "invalid-cidr"
+`,
+		},
+		{
+			name: "无效的fallback_strategy",
+			content: `
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "example.com"
+    strategy: "filter_non_cdn"
+    fallback_strategy: "drop"
+`,
+		},
+		{
+			name: "min_ttl大于max_ttl",
+			content: `
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "example.com"
+    strategy: "filter_non_cdn"
+    response_ttl_multiplier: 0.5
+    min_ttl: 600
+    max_ttl: 60
+`,
+		},
+		{
+			name: "无效的dns64_prefix长度",
+			content: `
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+  dns64_prefix: "64:ff9b::/80"
+cdn_ips:
+  - "10.0.0.0/8"
+`,
+		},
+		{
+			name: "IPv4的dns64_prefix",
+			content: `
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+  dns64_prefix: "192.0.2.0/24"
+cdn_ips:
+  - "10.0.0.0/8"
+`,
+		},
+		{
+			name: "无效的any_query_policy",
+			content: `
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+  any_query_policy: "drop"
+cdn_ips:
+  - "10.0.0.0/8"
+`,
+		},
+		{
+			name: "无效的otel_endpoint",
+			content: `
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cdn_ips:
+  - "10.0.0.0/8"
+observability:
+  otel_endpoint: "127.0.0.1:4318"
+`,
+		},
+		{
+			name: "无效的cdn_cidr_override",
+			content: `
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    cdn_cidr_override: ["not-a-cidr"]
+`,
+		},
+		{
+			name: "无效的qtype_filter",
+			content: `
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    qtype_filter: ["A", "BOGUS"]
+`,
+		},
+		{
+			name: "无效的synthetic_soa",
+			content: `
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    fallback_strategy: "nxdomain"
+    synthetic_soa:
+      minimum: 4294967295
+`,
+		},
+		{
+			name: "rpz_zones缺少rpz_file",
+			content: `
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+  rpz_zones: ["rpz.local"]
+cdn_ips:
+  - "10.0.0.0/8"
+`,
+		},
+		{
+			name: "超出范围的ttl_jitter_factor",
+			content: `
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+  ttl_jitter_factor: 1.5
+cdn_ips:
+  - "10.0.0.0/8"
+`,
+		},
+		{
+			name: "负数的circuit_breaker.failure_threshold",
+			content: `
+upstream:
+  server: "8.8.8.8:53"
+  circuit_breaker:
+    failure_threshold: -1
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cdn_ips:
+  - "10.0.0.0/8"
+`,
+		},
+		{
+			name: "无效的cache.eviction_policy",
+			content: `
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cache:
+  eviction_policy: "fifo"
+cdn_ips:
+  - "10.0.0.0/8"
+`,
+		},
+		{
+			name: "max_concurrent_queries为负数",
+			content: `
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+  max_concurrent_queries: -1
+cdn_ips:
+  - "10.0.0.0/8"
+`,
+		},
+		{
+			name: "无效的http_proxy",
+			content: `
+upstream:
+  server: "https://dns.google/dns-query"
+  http_proxy: "proxy.corp.example.com:8080"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cdn_ips:
+  - "10.0.0.0/8"
+`,
+		},
+		{
+			name: "无效的load_balance",
+			content: `
+upstream:
+  server: "8.8.8.8:53"
+  load_balance: "round_robin"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cdn_ips:
+  - "10.0.0.0/8"
+`,
+		},
+		{
+			name: "upstream.servers包含空地址",
+			content: `
+upstream:
+  server: "8.8.8.8:53"
+  servers: ["1.1.1.1:53", " "]
+  load_balance: latency
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cdn_ips:
+  - "10.0.0.0/8"
+`,
+		},
+		{
+			name: "http_proxy_user缺少http_proxy",
+			content: `
+upstream:
+  server: "https://dns.google/dns-query"
+  http_proxy_user: "fxdns"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cdn_ips:
+  - "10.0.0.0/8"
+`,
+		},
+		{
+			name: "无效的metrics.statsd_address",
+			content: `
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+metrics:
+  statsd_address: "127.0.0.1"
+cdn_ips:
+  - "10.0.0.0/8"
 `,
 		},
 	}
@@ -147,3 +418,238 @@ cdn_ips:
 		})
 	}
 }
+
+func TestGetRulesForTag(t *testing.T) {
+	cfg := &Config{
+		Domains: []DomainRule{
+			{Pattern: "video.example.com", Strategy: StrategyFilterNonCDN, Tags: []string{"video", "tier1"}},
+			{Pattern: "*.cdn.example.com", Strategy: StrategyReturnCDNA, Tags: []string{"cdn-a"}},
+			{Pattern: "live.example.com", Strategy: StrategyFilterNonCDN, Tags: []string{"video"}},
+			{Pattern: "static.example.org", Strategy: StrategyFilterNonCDN},
+		},
+	}
+
+	rules := cfg.GetRulesForTag("video")
+	if len(rules) != 2 {
+		t.Fatalf("标签 video 的规则数量错误, 期望: 2, 实际: %d", len(rules))
+	}
+	if rules[0].Pattern != "video.example.com" || rules[1].Pattern != "live.example.com" {
+		t.Errorf("标签 video 的规则错误: %+v", rules)
+	}
+
+	if rules := cfg.GetRulesForTag("tier1"); len(rules) != 1 {
+		t.Errorf("标签 tier1 的规则数量错误, 期望: 1, 实际: %d", len(rules))
+	}
+	if rules := cfg.GetRulesForTag("unknown"); len(rules) != 0 {
+		t.Errorf("不存在的标签不应返回规则, 实际: %d", len(rules))
+	}
+
+	// 标签不影响匹配行为
+	if strategy := cfg.GetDomainStrategy("static.example.org", dns.TypeA); strategy != StrategyFilterNonCDN {
+		t.Errorf("无标签规则的策略错误, 期望: %s, 实际: %s", StrategyFilterNonCDN, strategy)
+	}
+}
+
+func TestQtypeFilter(t *testing.T) {
+	cfg, err := LoadConfigFromBytes([]byte(`
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    strategy: "filter_non_cdn"
+    qtype_filter: ["A"]
+  - pattern: "*.example.org"
+    strategy: "return_cdn_a"
+    qtype_filter: ["a", "aaaa"]
+  - pattern: "*.example.net"
+    strategy: "filter_non_cdn"
+`))
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+
+	testCases := []struct {
+		domain   string
+		qtype    uint16
+		expected string
+	}{
+		{"www.example.com", dns.TypeA, StrategyFilterNonCDN},
+		{"www.example.com", dns.TypeMX, StrategyNone},
+		{"www.example.com", dns.TypeAAAA, StrategyNone},
+		{"www.example.org", dns.TypeAAAA, StrategyReturnCDNA},
+		{"www.example.org", dns.TypeTXT, StrategyNone},
+		// 未配置 qtype_filter 时对所有类型生效
+		{"www.example.net", dns.TypeMX, StrategyFilterNonCDN},
+	}
+	for _, tc := range testCases {
+		if got := cfg.GetDomainStrategy(tc.domain, tc.qtype); got != tc.expected {
+			t.Errorf("%s %s 的策略错误, 期望: %s, 实际: %s", tc.domain, dns.TypeToString[tc.qtype], tc.expected, got)
+		}
+	}
+}
+
+func TestIDNRuleLookup(t *testing.T) {
+	cfg := &Config{
+		Domains: []DomainRule{
+			{Pattern: "münchen.de", Strategy: StrategyReturnCDNA},
+			{Pattern: "*.bücher.example", Strategy: StrategyFilterNonCDN},
+		},
+	}
+
+	// 查询名总是以 ACE 形式到达，Unicode 写法的规则也应命中
+	if got := cfg.GetDomainStrategy("xn--mnchen-3ya.de", dns.TypeA); got != StrategyReturnCDNA {
+		t.Errorf("xn--mnchen-3ya.de 的策略错误, 期望: %s, 实际: %s", StrategyReturnCDNA, got)
+	}
+	if rule := cfg.GetDomainRule("xn--mnchen-3ya.de."); rule == nil || rule.Pattern != "münchen.de" {
+		t.Errorf("xn--mnchen-3ya.de 应匹配规则 münchen.de, 实际: %+v", rule)
+	}
+	if got := cfg.GetDomainStrategy("shop.xn--bcher-kva.example", dns.TypeA); got != StrategyFilterNonCDN {
+		t.Errorf("shop.xn--bcher-kva.example 的策略错误, 期望: %s, 实际: %s", StrategyFilterNonCDN, got)
+	}
+}
+
+func TestDomainRulePatternsCompiledOnLoad(t *testing.T) {
+	cfg, err := LoadConfigFromBytes([]byte(`
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "re:^(img|static)\\.example\\.com$"
+    strategy: "return_cdn_a"
+  - pattern: "*.example.com"
+    strategy: "filter_non_cdn"
+`))
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	for i := range cfg.Domains {
+		if cfg.Domains[i].matcher == nil {
+			t.Errorf("规则 %s 的 pattern 应在加载配置时编译", cfg.Domains[i].Pattern)
+		}
+	}
+	if rule := cfg.GetDomainRule("static.example.com"); rule == nil || rule.Strategy != StrategyReturnCDNA {
+		t.Errorf("static.example.com 应匹配正则规则, 实际: %+v", rule)
+	}
+	if rule := cfg.GetDomainRule("www.example.com"); rule == nil || rule.Strategy != StrategyFilterNonCDN {
+		t.Errorf("www.example.com 应匹配泛域名规则, 实际: %+v", rule)
+	}
+}
+
+func TestConfigHash(t *testing.T) {
+	base := GenerateDefault()
+	same := GenerateDefault()
+	if base.Hash() == "" {
+		t.Fatal("Hash 不应为空")
+	}
+	if base.Hash() != same.Hash() {
+		t.Error("内容相同的配置应产生相同的 Hash")
+	}
+
+	// 格式和注释不同但内容相同的 YAML 应产生相同的 Hash
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.yaml")
+	b := filepath.Join(dir, "b.yaml")
+	os.WriteFile(a, []byte("upstream:\n  server: \"8.8.8.8:53\"\nserver:\n  workers: 2\ncdn_ips: [\"10.0.0.0/8\"]\n"), 0644)
+	os.WriteFile(b, []byte("# 注释\ncdn_ips:\n  - 10.0.0.0/8\nserver: {workers: 2}\nupstream:\n  server: 8.8.8.8:53\n"), 0644)
+	cfgA, err := LoadConfig(a)
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	cfgB, err := LoadConfig(b)
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if cfgA.Hash() != cfgB.Hash() {
+		t.Error("格式不同但内容相同的配置应产生相同的 Hash")
+	}
+
+	same.Server.Workers++
+	if base.Hash() == same.Hash() {
+		t.Error("内容不同的配置应产生不同的 Hash")
+	}
+}
+
+func TestConfigExportJSON(t *testing.T) {
+	cfg, err := LoadConfigFromBytes([]byte(`
+upstream:
+  server: "8.8.8.8:53"
+  timeout: 2s
+server:
+  listen: "127.0.0.1:5353"
+  workers: 4
+  cache_ttl: 90s
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    strategy: "filter_non_cdn"
+    ttl: 300
+    upstream_timeout: 5s
+split_horizon:
+  subnets:
+    "192.168.0.0/16": "192.168.1.53:53"
+`))
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+
+	data, err := cfg.ExportJSON()
+	if err != nil {
+		t.Fatalf("导出 JSON 失败: %v", err)
+	}
+
+	var exported struct {
+		Upstream struct {
+			Server  string `json:"server"`
+			Timeout string `json:"timeout"`
+		} `json:"upstream"`
+		Server struct {
+			Listen   string `json:"listen"`
+			Workers  int    `json:"workers"`
+			CacheTTL string `json:"cache_ttl"`
+		} `json:"server"`
+		CDNIPs       []string     `json:"cdn_ips"`
+		Domains      []DomainRule `json:"domains"`
+		SplitHorizon struct {
+			Subnets map[string]string `json:"subnets"`
+		} `json:"split_horizon"`
+	}
+	if err := json.Unmarshal(data, &exported); err != nil {
+		t.Fatalf("解析导出的 JSON 失败: %v\n%s", err, data)
+	}
+
+	if exported.Upstream.Server != "8.8.8.8:53" || exported.Upstream.Timeout != "2s" {
+		t.Errorf("upstream 导出错误: %+v", exported.Upstream)
+	}
+	if exported.Server.Listen != "127.0.0.1:5353" || exported.Server.Workers != 4 || exported.Server.CacheTTL != "1m30s" {
+		t.Errorf("server 导出错误: %+v", exported.Server)
+	}
+	if len(exported.CDNIPs) != 1 || exported.CDNIPs[0] != "10.0.0.0/8" {
+		t.Errorf("cdn_ips 导出错误: %v", exported.CDNIPs)
+	}
+	if len(exported.Domains) != 1 || exported.Domains[0].Pattern != "*.example.com" || exported.Domains[0].TTL != 300 ||
+		exported.Domains[0].UpstreamTimeout != 5*time.Second {
+		t.Errorf("domains 导出错误: %+v", exported.Domains)
+	}
+	if exported.SplitHorizon.Subnets["192.168.0.0/16"] != "192.168.1.53:53" {
+		t.Errorf("split_horizon 导出错误: %v", exported.SplitHorizon.Subnets)
+	}
+
+	// 导出的 JSON 可以重新作为配置加载，且内容不变
+	restored, err := LoadConfigFromBytes(data)
+	if err != nil {
+		t.Fatalf("重新加载导出的 JSON 失败: %v", err)
+	}
+	if restored.Hash() != cfg.Hash() {
+		t.Error("重新加载导出的 JSON 后配置内容发生变化")
+	}
+}
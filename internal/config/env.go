@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvOverridePrefix 覆盖配置项的环境变量前缀
+const EnvOverridePrefix = "FXDNS_"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// ApplyEnvironmentOverrides 用 FXDNS_<YAML 路径> 形式的环境变量覆盖配置项，路径各段为大写的 YAML 键名并以 _ 连接，
+// 如 FXDNS_UPSTREAM_SERVER 对应 upstream.server，FXDNS_SERVER_WORKERS 对应 server.workers。
+// 支持字符串、布尔、整数、浮点数、时长 ("5s") 以及逗号分隔的字符串列表 (如 FXDNS_CDN_IPS)；
+// domains 等结构体列表与映射类型的配置项不支持覆盖。环境变量的值无法解析为字段类型时返回错误
+func (c *Config) ApplyEnvironmentOverrides() error {
+	return applyEnvOverrides(reflect.ValueOf(c).Elem(), EnvOverridePrefix)
+}
+
+// applyEnvOverrides 递归遍历结构体字段，按 prefix + YAML 键名查找并应用环境变量
+func applyEnvOverrides(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		name := prefix + strings.ToUpper(key)
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct {
+			if err := applyEnvOverrides(fv, name+"_"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setFieldFromString(fv, value); err != nil {
+			return fmt.Errorf("环境变量 %s=%q 无法解析为 %s: %w", name, value, fv.Type(), err)
+		}
+	}
+	return nil
+}
+
+// setFieldFromString 将字符串解析为字段类型并赋值
+func setFieldFromString(fv reflect.Value, value string) error {
+	if fv.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.Pointer:
+		// 指针字段用于区分未设置与零值，解析到新分配的值后再赋值
+		elem := reflect.New(fv.Type().Elem())
+		if err := setFieldFromString(elem.Elem(), value); err != nil {
+			return err
+		}
+		fv.Set(elem)
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("不支持通过环境变量覆盖")
+		}
+		items := make([]string, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		fv.Set(reflect.ValueOf(items).Convert(fv.Type()))
+	default:
+		return fmt.Errorf("不支持通过环境变量覆盖")
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const envTestConfig = `
+upstream:
+  server: "8.8.8.8:53"
+  timeout: 2s
+server:
+  listen: ":53"
+  workers: 10
+cdn_ips:
+  - "192.0.2.0/24"
+`
+
+func TestApplyEnvironmentOverrides(t *testing.T) {
+	t.Setenv("FXDNS_UPSTREAM_SERVER", "1.1.1.1:53")
+	t.Setenv("FXDNS_UPSTREAM_TIMEOUT", "500ms")
+	t.Setenv("FXDNS_UPSTREAM_VALIDATE_RESPONSES", "true")
+	t.Setenv("FXDNS_SERVER_WORKERS", "20")
+	t.Setenv("FXDNS_SERVER_DNSBL_ZONES", "*.dnsbl.internal, *.10.bl.internal")
+	t.Setenv("FXDNS_CDN_IPS", "10.0.0.0/8,172.16.0.0/12")
+	t.Setenv("FXDNS_CONFIG_POLL_INTERVAL", "30s")
+	t.Setenv("FXDNS_UPSTREAM_ECS_SOURCE_PREFIX_LEN_V4", "0")
+
+	cfg, err := LoadConfigFromBytes([]byte(envTestConfig))
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+
+	if cfg.Upstream.Server != "1.1.1.1:53" {
+		t.Errorf("upstream.server 错误: %s", cfg.Upstream.Server)
+	}
+	if cfg.Upstream.Timeout != 500*time.Millisecond {
+		t.Errorf("upstream.timeout 错误: %v", cfg.Upstream.Timeout)
+	}
+	if !cfg.Upstream.ValidateResponses {
+		t.Error("upstream.validate_responses 应为 true")
+	}
+	if cfg.Server.Workers != 20 {
+		t.Errorf("server.workers 错误: %d", cfg.Server.Workers)
+	}
+	if cfg.Server.Listen != ":53" {
+		t.Errorf("未设置环境变量的配置项不应改变: %s", cfg.Server.Listen)
+	}
+	if got := strings.Join(cfg.Server.DNSBLZones, " "); got != "*.dnsbl.internal *.10.bl.internal" {
+		t.Errorf("server.dnsbl_zones 错误: %v", cfg.Server.DNSBLZones)
+	}
+	if got := strings.Join(cfg.CDNIPs, " "); got != "10.0.0.0/8 172.16.0.0/12" {
+		t.Errorf("cdn_ips 错误: %v", cfg.CDNIPs)
+	}
+	if cfg.ConfigFile.PollInterval != 30*time.Second {
+		t.Errorf("config.poll_interval 错误: %v", cfg.ConfigFile.PollInterval)
+	}
+	// 指针字段区分未设置与零值：显式设置的 0 保留，未设置的使用默认值
+	if cfg.Upstream.ECSPrefixLenV4() != 0 {
+		t.Errorf("upstream.ecs_source_prefix_len_v4 错误: %d", cfg.Upstream.ECSPrefixLenV4())
+	}
+	if cfg.Upstream.ECSPrefixLenV6() != DefaultECSPrefixLenV6 {
+		t.Errorf("upstream.ecs_source_prefix_len_v6 应使用默认值, 实际: %d", cfg.Upstream.ECSPrefixLenV6())
+	}
+}
+
+func TestApplyEnvironmentOverridesInvalid(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value string
+	}{
+		{"FXDNS_SERVER_WORKERS", "many"},
+		{"FXDNS_UPSTREAM_TIMEOUT", "5"},
+		{"FXDNS_UPSTREAM_CD_BIT", "yes"},
+		{"FXDNS_SERVER_WORKERS", "99999999999999999999"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name+"="+tc.value, func(t *testing.T) {
+			t.Setenv(tc.name, tc.value)
+			_, err := LoadConfigFromBytes([]byte(envTestConfig))
+			if err == nil {
+				t.Fatal("无法解析的环境变量应导致加载失败")
+			}
+			if !strings.Contains(err.Error(), tc.name) {
+				t.Errorf("错误信息应包含变量名 %s: %v", tc.name, err)
+			}
+		})
+	}
+}
+
+func TestApplyEnvironmentOverridesValidated(t *testing.T) {
+	t.Setenv("FXDNS_SERVER_WORKERS", "0")
+	if _, err := LoadConfigFromBytes([]byte(envTestConfig)); err == nil {
+		t.Error("覆盖后的配置应经过校验")
+	}
+}
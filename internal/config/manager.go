@@ -3,6 +3,7 @@ package config
 import (
 	"errors"
 	"fmt" // 添加 fmt 包
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -10,20 +11,44 @@ import (
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/hao/fxdns/internal/config/source"
 )
 
 // ConfigManager 配置管理器，负责配置的加载、验证和热加载
 type ConfigManager struct {
-	configFilePath  string
+	source          source.ConfigSource
+	configFilePath  string // source 为本地文件时的路径，其他来源为空
 	config          *Config
 	lastLoadTime    time.Time
+	lastError       error       // 最近一次 LoadConfig 的错误，成功时为 nil
+	lastHash        string      // 当前配置的 Hash()，内容未变化时跳过通知
+	lastStat        os.FileInfo // 最近一次加载时配置文件的状态，供 ReloadIfModified 比较
+	rawConfig       []byte      // 当前配置的原始文件内容，用于备份
 	reloadLock      sync.RWMutex
 	listeners       []ConfigChangeListener
+	watchers        map[<-chan ConfigChangeEvent]chan ConfigChangeEvent // Watch 返回的通道
 	mu              sync.RWMutex
 	watcher         *fsnotify.Watcher
 	initialLoadDone bool
 	stopWatcherChan chan struct{} // 用于通知 runWatcherLoop 停止
 	watchingStarted bool          // 标记监控是否已启动
+
+	debounceDelay time.Duration                        // 热加载防抖延迟，0 表示每次事件立即重新加载
+	after         func(time.Duration) <-chan time.Time // 计时器，测试中可替换为假时钟
+}
+
+// DefaultDebounceDelay 默认的热加载防抖延迟
+const DefaultDebounceDelay = 200 * time.Millisecond
+
+// ConfigManagerOption 配置管理器的可选项
+type ConfigManagerOption func(*ConfigManager)
+
+// WithDebounceDelay 设置热加载防抖延迟：收到文件变化事件后等待该时长，期间的新事件会重新计时，
+// 计时结束后才重新加载配置。0 表示每次事件立即重新加载。
+func WithDebounceDelay(d time.Duration) ConfigManagerOption {
+	return func(m *ConfigManager) {
+		m.debounceDelay = d
+	}
 }
 
 // ConfigChangeListener 配置变更监听器接口
@@ -31,27 +56,66 @@ type ConfigChangeListener interface {
 	OnConfigChange(oldConfig, newConfig *Config)
 }
 
-// NewConfigManager 创建新的配置管理器
-func NewConfigManager(configFilePath string) *ConfigManager {
-	return &ConfigManager{
-		configFilePath:  configFilePath,
+// ConfigChangeEvent 通过 Watch 通道发送的配置变更事件
+type ConfigChangeEvent struct {
+	Old *Config
+	New *Config
+}
+
+// NewConfigManager 创建从本地配置文件加载配置的配置管理器
+func NewConfigManager(configFilePath string, opts ...ConfigManagerOption) *ConfigManager {
+	return NewConfigManagerFromSource(source.NewFileSource(configFilePath), opts...)
+}
+
+// NewConfigManagerFromSource 创建从 src 加载配置的配置管理器。
+// 本地文件支持 fsnotify / poll_interval 监控与 Restore；其他来源以其 Watch 监听变化，不支持 Restore
+func NewConfigManagerFromSource(src source.ConfigSource, opts ...ConfigManagerOption) *ConfigManager {
+	m := &ConfigManager{
+		source:          src,
 		listeners:       make([]ConfigChangeListener, 0),
+		watchers:        make(map[<-chan ConfigChangeEvent]chan ConfigChangeEvent),
 		stopWatcherChan: make(chan struct{}), // 初始化时创建，但可能在 StartWatching 中重新创建
+		debounceDelay:   DefaultDebounceDelay,
+		after:           time.After,
+	}
+	if fs, ok := src.(*source.FileSource); ok {
+		m.configFilePath = fs.Path
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Source 返回配置来源
+func (m *ConfigManager) Source() source.ConfigSource {
+	return m.source
 }
 
 // LoadConfig 加载配置
-func (m *ConfigManager) LoadConfig() error {
+func (m *ConfigManager) LoadConfig() (err error) {
 	m.reloadLock.Lock()
 	defer m.reloadLock.Unlock()
-
-	// 检查配置文件是否存在
-	if _, err := os.Stat(m.configFilePath); os.IsNotExist(err) {
-		return errors.New("配置文件不存在: " + m.configFilePath)
+	defer func() {
+		m.lastError = err
+	}()
+
+	if m.configFilePath != "" {
+		// 检查配置文件是否存在
+		info, err := os.Stat(m.configFilePath)
+		if os.IsNotExist(err) {
+			return errors.New("配置文件不存在: " + m.configFilePath)
+		}
+		// 无论加载是否成功都记录，内容有误的文件在再次修改前不会被轮询反复加载
+		m.lastStat = info
 	}
 
 	// 加载配置
-	cfg, err := LoadConfig(m.configFilePath)
+	data, err := m.source.Read()
+	if err != nil {
+		return err
+	}
+	cfg, err := LoadConfigFromBytes(data)
 	if err != nil {
 		return err
 	}
@@ -61,17 +125,35 @@ func (m *ConfigManager) LoadConfig() error {
 		return err
 	}
 
+	// 内容与当前配置一致（如 fsnotify 误触发）时不更新也不通知
+	hash := cfg.Hash()
+	if m.config != nil && hash != "" && hash == m.lastHash {
+		m.lastLoadTime = time.Now()
+		log.Println("ConfigManager: 配置内容未变化，跳过通知")
+		return nil
+	}
+
 	// 保存旧配置用于通知监听器
 	oldConfig := m.config
 
+	// 热加载替换配置前备份当前配置，备份失败不影响加载
+	if oldConfig != nil && cfg.ConfigFile.BackupDir != "" {
+		if err := m.backupPrevious(cfg.ConfigFile.BackupDir, cfg.ConfigFile.MaxBackups); err != nil {
+			log.Printf("ConfigManager: 备份配置失败: %v", err)
+		}
+	}
+
 	// 更新配置
 	m.config = cfg
+	m.rawConfig = data
+	m.lastHash = hash
 	m.lastLoadTime = time.Now()
 	m.initialLoadDone = true
 
 	// 通知配置变更
 	if oldConfig != nil {
 		m.notifyListeners(oldConfig, cfg)
+		m.notifyWatchers(oldConfig, cfg)
 	}
 
 	return nil
@@ -80,7 +162,7 @@ func (m *ConfigManager) LoadConfig() error {
 // validateConfig 验证配置是否有效
 func (m *ConfigManager) validateConfig(cfg *Config) error {
 	// 验证上游 DNS 服务器配置
-	if cfg.Upstream.Server == "" {
+	if cfg.Upstream.PrimaryServer() == "" {
 		return errors.New("上游 DNS 服务器地址不能为空")
 	}
 
@@ -98,10 +180,78 @@ func (m *ConfigManager) validateConfig(cfg *Config) error {
 	if err := cfg.parseCIDRs(); err != nil {
 		return errors.New("无效的 CIDR 格式: " + err.Error())
 	}
+	cfg.compileDomainPatterns()
+	cfg.parseQtypeFilters()
+	cfg.compileModifyExprs()
+
+	// 验证域名规则，一次报告全部错误
+	if errs := ValidateRules(cfg.Domains); len(errs) > 0 {
+		return ValidationErrors(errs)
+	}
 
 	return nil
 }
 
+// ReloadIfModified 比较配置文件的修改时间与大小和最近一次加载时是否一致，不一致时调用 LoadConfig。
+// 返回是否重新加载了配置；文件无法访问或加载失败时返回错误。非文件来源总是调用 LoadConfig
+func (m *ConfigManager) ReloadIfModified() (bool, error) {
+	if m.configFilePath == "" {
+		if err := m.LoadConfig(); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	info, err := os.Stat(m.configFilePath)
+	if err != nil {
+		return false, err
+	}
+
+	m.reloadLock.RLock()
+	last := m.lastStat
+	m.reloadLock.RUnlock()
+	if last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+		return false, nil
+	}
+
+	if err := m.LoadConfig(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// runPollLoop 按 interval 轮询配置文件，在 stop 关闭时退出
+func (m *ConfigManager) runPollLoop(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if reloaded, err := m.ReloadIfModified(); err != nil {
+				log.Printf("ConfigManager 轮询重新加载配置失败: %v", err)
+			} else if reloaded {
+				log.Printf("ConfigManager 轮询检测到配置文件变化，已重新加载")
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// LastReloadTime 返回最近一次成功加载配置的时间（内容未变化的重新加载也计入），从未成功加载时为零值
+func (m *ConfigManager) LastReloadTime() time.Time {
+	m.reloadLock.RLock()
+	defer m.reloadLock.RUnlock()
+	return m.lastLoadTime
+}
+
+// LastReloadError 返回最近一次加载配置的错误，最近一次加载成功时返回 nil。
+// 非 nil 时当前生效的仍是之前成功加载的配置，可能与配置文件不一致
+func (m *ConfigManager) LastReloadError() error {
+	m.reloadLock.RLock()
+	defer m.reloadLock.RUnlock()
+	return m.lastError
+}
+
 // GetConfig 获取当前配置
 func (m *ConfigManager) GetConfig() *Config {
 	m.reloadLock.RLock()
@@ -109,12 +259,19 @@ func (m *ConfigManager) GetConfig() *Config {
 	return m.config
 }
 
-// runWatcherLoop 在一个单独的 goroutine 中运行，监控配置文件更改
-func (m *ConfigManager) runWatcherLoop() {
-	defer m.watcher.Close()
+// runWatcherLoop 在一个单独的 goroutine 中运行，监控配置文件更改。
+// watcher 与 stop 由调用者传入，避免 StopWatching 重置 m.watcher 后在此处读到 nil
+func (m *ConfigManager) runWatcherLoop(watcher *fsnotify.Watcher, stop <-chan struct{}) {
+	defer watcher.Close()
+	m.watchEvents(watcher.Events, watcher.Errors, stop)
+}
+
+// watchEvents 处理文件监控事件，连续的变化事件经防抖合并后只重新加载一次
+func (m *ConfigManager) watchEvents(events <-chan fsnotify.Event, errs <-chan error, stop <-chan struct{}) {
+	var reload <-chan time.Time // 防抖计时器，nil 表示没有待处理的重新加载
 	for {
 		select {
-		case event, ok := <-m.watcher.Events:
+		case event, ok := <-events:
 			if !ok {
 				log.Println("fsnotify watcher.Events 通道已关闭")
 				return
@@ -130,10 +287,11 @@ func (m *ConfigManager) runWatcherLoop() {
 			if pathMatch {
 				if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
 					log.Printf("ConfigManager 检测到配置文件变化: %s (操作: %s)", event.Name, event.Op.String())
-					if err := m.LoadConfig(); err != nil { // LoadConfig 会调用 notifyListeners
-						log.Printf("ConfigManager 重新加载配置失败: %v", err)
+					if m.debounceDelay <= 0 {
+						m.reloadFromWatcher()
 					} else {
-						log.Printf("ConfigManager 成功重新加载配置并已通知监听器")
+						// 重新计时，旧的计时器不再被监听
+						reload = m.after(m.debounceDelay)
 					}
 				}
 			} else if filepath.Clean(event.Name) == filepath.Clean(m.configFilePath) &&
@@ -142,19 +300,55 @@ func (m *ConfigManager) runWatcherLoop() {
 				// 注意：如果文件被永久删除或移走，监控可能会中断。
 				// 更健壮的实现可能需要尝试重新添加对目录的监控，或者处理监控中断的情况。
 			}
-		case err, ok := <-m.watcher.Errors:
+		case <-reload:
+			reload = nil
+			m.reloadFromWatcher()
+		case err, ok := <-errs:
 			if !ok {
 				log.Println("fsnotify watcher.Errors 通道已关闭")
 				return
 			}
 			log.Printf("ConfigManager 配置文件监控错误: %v", err)
-		case <-m.stopWatcherChan:
+		case <-stop:
 			log.Println("ConfigManager 监控 goroutine 收到停止信号，退出...")
 			return
 		}
 	}
 }
 
+// runSourceLoop 处理非文件来源 Watch 发出的变化信号，经防抖合并后重新加载，在 stop 关闭或 changes 关闭时退出
+func (m *ConfigManager) runSourceLoop(changes <-chan struct{}, stop <-chan struct{}) {
+	var reload <-chan time.Time // 防抖计时器，nil 表示没有待处理的重新加载
+	for {
+		select {
+		case _, ok := <-changes:
+			if !ok {
+				return
+			}
+			log.Printf("ConfigManager 检测到配置来源 %v 变化", m.source)
+			if m.debounceDelay <= 0 {
+				m.reloadFromWatcher()
+			} else {
+				reload = m.after(m.debounceDelay)
+			}
+		case <-reload:
+			reload = nil
+			m.reloadFromWatcher()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// reloadFromWatcher 由文件监控触发的重新加载
+func (m *ConfigManager) reloadFromWatcher() {
+	if err := m.LoadConfig(); err != nil { // LoadConfig 会调用 notifyListeners
+		log.Printf("ConfigManager 重新加载配置失败: %v", err)
+	} else {
+		log.Printf("ConfigManager 成功重新加载配置并已通知监听器")
+	}
+}
+
 // StartWatching 开始监视配置文件变化
 func (m *ConfigManager) StartWatching() error {
 	m.mu.Lock()
@@ -183,6 +377,32 @@ func (m *ConfigManager) StartWatching() error {
 		log.Println("ConfigManager 配置已由调用者预加载，准备启动监控。")
 	}
 
+	if m.configFilePath == "" {
+		changes, err := m.source.Watch()
+		if err != nil {
+			m.mu.Lock()
+			m.watchingStarted = false // 重置状态
+			m.mu.Unlock()
+			return fmt.Errorf("ConfigManager 监听配置来源 %v 失败: %w", m.source, err)
+		}
+		m.mu.Lock()
+		m.stopWatcherChan = make(chan struct{})
+		go m.runSourceLoop(changes, m.stopWatcherChan)
+		m.mu.Unlock()
+		log.Printf("ConfigManager 开始监听配置来源: %v", m.source)
+		return nil
+	}
+
+	// 配置了 config.poll_interval 时以轮询代替 fsnotify
+	if interval := m.GetConfig().ConfigFile.PollInterval; interval > 0 {
+		m.mu.Lock()
+		m.stopWatcherChan = make(chan struct{})
+		go m.runPollLoop(interval, m.stopWatcherChan)
+		m.mu.Unlock()
+		log.Printf("ConfigManager 开始以 %v 的间隔轮询配置文件: %s", interval, m.configFilePath)
+		return nil
+	}
+
 	log.Printf("ConfigManager 开始监控配置文件目录: %s (针对文件: %s)", filepath.Dir(m.configFilePath), m.configFilePath)
 
 	var err error
@@ -197,7 +417,7 @@ func (m *ConfigManager) StartWatching() error {
 
 	// 为新的监控循环重新创建/分配 channel
 	m.stopWatcherChan = make(chan struct{})
-	go m.runWatcherLoop() // 启动事件处理循环
+	go m.runWatcherLoop(newWatcher, m.stopWatcherChan) // 启动事件处理循环
 
 	err = m.watcher.Add(filepath.Dir(m.configFilePath)) // 添加监控目录
 	if err != nil {
@@ -224,20 +444,24 @@ func (m *ConfigManager) StopWatching() {
 	}
 
 	log.Println("ConfigManager 正在停止文件监控...")
+	// 首先关闭 stopWatcherChan 来通知 runWatcherLoop / runPollLoop 退出
+	// 检查 channel 是否已经关闭，避免重复关闭
+	select {
+	case <-m.stopWatcherChan:
+		// Channel 已经关闭
+	default:
+		close(m.stopWatcherChan)
+	}
 	if m.watcher != nil {
-		// 首先关闭 stopWatcherChan 来通知 runWatcherLoop 退出
-		// 检查 channel 是否已经关闭，避免重复关闭
-		select {
-		case <-m.stopWatcherChan:
-			// Channel 已经关闭
-		default:
-			close(m.stopWatcherChan)
-		}
 		// 然后关闭 fsnotify watcher。Close() 是幂等的。
 		// runWatcherLoop 中的 defer m.watcher.Close() 也会尝试关闭，这是安全的。
 		m.watcher.Close() 
 		m.watcher = nil
 	}
+	// 非文件来源的监听协程由来源自身管理
+	if closer, ok := m.source.(io.Closer); ok && m.configFilePath == "" {
+		closer.Close()
+	}
 	m.watchingStarted = false
 	log.Println("ConfigManager 文件监控已停止。")
 }
@@ -261,6 +485,45 @@ func (m *ConfigManager) RemoveListener(listener ConfigChangeListener) {
 	}
 }
 
+// Watch 返回一个在每次配置变更时接收 ConfigChangeEvent 的通道，是 AddListener 的通道形式替代。
+// 通知不会因接收方处理缓慢而阻塞：接收方尚未取走的事件会与新事件合并，
+// 合并后的事件保留最早未读事件的 Old 与最新的 New。不再需要时调用 Unwatch 关闭通道。
+func (m *ConfigManager) Watch() <-chan ConfigChangeEvent {
+	ch := make(chan ConfigChangeEvent, 1)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.watchers[ch] = ch
+	return ch
+}
+
+// Unwatch 停止向 Watch 返回的通道发送事件并关闭该通道
+func (m *ConfigManager) Unwatch(ch <-chan ConfigChangeEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.watchers[ch]; ok {
+		delete(m.watchers, ch)
+		close(c)
+	}
+}
+
+// notifyWatchers 向所有 Watch 通道发送配置变更事件
+func (m *ConfigManager) notifyWatchers(oldConfig, newConfig *Config) {
+	// 持有读锁发送，保证 Unwatch 不会在发送期间关闭通道；通知由 reloadLock 串行化
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, ch := range m.watchers {
+		event := ConfigChangeEvent{Old: oldConfig, New: newConfig}
+		select {
+		case pending := <-ch:
+			// 接收方尚未取走上一个事件，合并为一个
+			event.Old = pending.Old
+		default:
+		}
+		ch <- event
+	}
+}
+
 // notifyListeners 通知所有监听器配置已更改
 func (m *ConfigManager) notifyListeners(oldConfig, newConfig *Config) {
     m.mu.RLock() // 使用 m.mu 保护 listeners
@@ -3,7 +3,12 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
 )
 
 // 模拟配置变更监听器
@@ -41,7 +46,7 @@ cdn_ips:
 
 domains:
   - pattern: "example.com"
-    strategy: "filter"
+    strategy: "filter_non_cdn"
 `
 	err := os.WriteFile(configPath, []byte(initialConfig), 0644)
 	if err != nil {
@@ -85,9 +90,9 @@ cdn_ips:
 
 domains:
   - pattern: "example.com"
-    strategy: "filter"
+    strategy: "filter_non_cdn"
   - pattern: "*.cdn.com"
-    strategy: "replace"
+    strategy: "return_cdn_a"
 `
 	// 写入更新的配置
 	err = os.WriteFile(configPath, []byte(updatedConfig), 0644)
@@ -134,3 +139,444 @@ domains:
 		t.Error("移除后的监听器不应该被调用")
 	}
 }
+
+func TestConfigManagerSkipsUnchangedReload(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cdn_ips:
+  - "192.168.1.0/24"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("创建测试配置文件失败: %v", err)
+	}
+
+	manager := NewConfigManager(configPath)
+	if err := manager.LoadConfig(); err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	listener := &mockListener{}
+	manager.AddListener(listener)
+
+	// 仅追加注释，内容不变
+	if err := os.WriteFile(configPath, []byte(content+"# touched\n"), 0644); err != nil {
+		t.Fatalf("更新测试配置文件失败: %v", err)
+	}
+	if err := manager.LoadConfig(); err != nil {
+		t.Fatalf("重新加载配置失败: %v", err)
+	}
+	if listener.called {
+		t.Error("配置内容未变化时不应通知监听器")
+	}
+
+	// 内容变化时仍然通知
+	if err := os.WriteFile(configPath, []byte(content+"  - \"10.0.0.0/8\"\n"), 0644); err != nil {
+		t.Fatalf("更新测试配置文件失败: %v", err)
+	}
+	if err := manager.LoadConfig(); err != nil {
+		t.Fatalf("重新加载配置失败: %v", err)
+	}
+	if !listener.called {
+		t.Error("配置内容变化时应通知监听器")
+	}
+}
+
+// notifyListener 每次配置变更时向通道发送通知
+type notifyListener chan *Config
+
+func (l notifyListener) OnConfigChange(old, new *Config) { l <- new }
+
+func TestConfigManagerDebounce(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cdn_ips:
+  - "192.168.1.0/24"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("创建测试配置文件失败: %v", err)
+	}
+
+	manager := NewConfigManager(configPath, WithDebounceDelay(time.Second))
+	if err := manager.LoadConfig(); err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	notified := make(notifyListener, 10)
+	manager.AddListener(notified)
+
+	// 假时钟：记录每次计时请求，由测试决定何时触发
+	timers := make(chan chan time.Time, 10)
+	manager.after = func(d time.Duration) <-chan time.Time {
+		if d != time.Second {
+			t.Errorf("防抖延迟错误, 期望: 1s, 实际: %v", d)
+		}
+		c := make(chan time.Time, 1)
+		timers <- c
+		return c
+	}
+
+	events := make(chan fsnotify.Event)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		manager.watchEvents(events, make(chan error), stop)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	if err := os.WriteFile(configPath, []byte(content+"  - \"10.0.0.0/8\"\n"), 0644); err != nil {
+		t.Fatalf("更新测试配置文件失败: %v", err)
+	}
+
+	// 模拟编辑器保存时连续触发的多个事件，每个事件都会重新计时
+	var last chan time.Time
+	for i := 0; i < 5; i++ {
+		events <- fsnotify.Event{Name: configPath, Op: fsnotify.Write}
+		last = <-timers
+	}
+	// 无关文件的事件不计时
+	events <- fsnotify.Event{Name: configPath + ".swp", Op: fsnotify.Write}
+
+	select {
+	case <-notified:
+		t.Fatal("计时结束前不应重新加载配置")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	last <- time.Now()
+	select {
+	case cfg := <-notified:
+		if len(cfg.CDNIPs) != 2 {
+			t.Errorf("重新加载的配置错误, CDN IP 数量: %d", len(cfg.CDNIPs))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("计时结束后应重新加载配置")
+	}
+
+	select {
+	case <-notified:
+		t.Error("连续事件只应触发一次重新加载")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if len(timers) != 0 {
+		t.Errorf("无关事件不应启动计时器, 多余计时器数量: %d", len(timers))
+	}
+}
+
+func TestConfigManagerWatch(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cdn_ips:
+  - "192.168.1.0/24"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("创建测试配置文件失败: %v", err)
+	}
+
+	manager := NewConfigManager(configPath)
+	if err := manager.LoadConfig(); err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	initial := manager.GetConfig()
+	ch := manager.Watch()
+
+	reload := func(extra string) {
+		t.Helper()
+		if err := os.WriteFile(configPath, []byte(content+extra), 0644); err != nil {
+			t.Fatalf("更新测试配置文件失败: %v", err)
+		}
+		if err := manager.LoadConfig(); err != nil {
+			t.Fatalf("重新加载配置失败: %v", err)
+		}
+	}
+
+	reload("  - \"10.0.0.0/8\"\n")
+	select {
+	case event := <-ch:
+		if event.Old != initial || len(event.New.CDNIPs) != 2 {
+			t.Errorf("变更事件错误: old=%p new CDN IP 数量=%d", event.Old, len(event.New.CDNIPs))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("未收到配置变更事件")
+	}
+
+	// 接收方未及时读取时，连续的变更合并为一个事件，不阻塞重新加载
+	second := manager.GetConfig()
+	reload("  - \"10.0.0.0/8\"\n  - \"172.16.0.0/12\"\n")
+	reload("  - \"10.0.0.0/8\"\n  - \"172.16.0.0/12\"\n  - \"100.64.0.0/10\"\n")
+	select {
+	case event := <-ch:
+		if event.Old != second || event.New != manager.GetConfig() {
+			t.Errorf("合并后的事件应包含最早的 Old 与最新的 New")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("未收到合并后的配置变更事件")
+	}
+	select {
+	case event := <-ch:
+		t.Fatalf("不应收到多余的事件: %+v", event)
+	default:
+	}
+
+	// Unwatch 后通道关闭且不再接收事件
+	manager.Unwatch(ch)
+	reload("")
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("Unwatch 后不应再收到事件")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Unwatch 后通道应被关闭")
+	}
+	manager.Unwatch(ch) // 重复调用不应 panic
+}
+
+func TestConfigManagerReloadIfModified(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cdn_ips:
+  - "192.168.1.0/24"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("创建测试配置文件失败: %v", err)
+	}
+
+	manager := NewConfigManager(configPath)
+	if err := manager.LoadConfig(); err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+
+	// 文件未变化
+	if reloaded, err := manager.ReloadIfModified(); reloaded || err != nil {
+		t.Errorf("文件未变化时不应重新加载, 实际: %v, %v", reloaded, err)
+	}
+
+	// 大小变化
+	content = strings.Replace(content, "workers: 10", "workers: 20", 1) + "  - \"10.0.0.0/8\"\n"
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("更新测试配置文件失败: %v", err)
+	}
+	if reloaded, err := manager.ReloadIfModified(); !reloaded || err != nil {
+		t.Fatalf("文件大小变化时应重新加载, 实际: %v, %v", reloaded, err)
+	}
+	if cfg := manager.GetConfig(); cfg.Server.Workers != 20 || len(cfg.CDNIPs) != 2 {
+		t.Errorf("重新加载后的配置错误: workers=%d, cdn_ips=%v", cfg.Server.Workers, cfg.CDNIPs)
+	}
+
+	// 大小不变、仅修改时间变化
+	content = strings.Replace(content, "workers: 20", "workers: 30", 1)
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("更新测试配置文件失败: %v", err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(configPath, future, future); err != nil {
+		t.Fatalf("修改文件时间失败: %v", err)
+	}
+	if reloaded, err := manager.ReloadIfModified(); !reloaded || err != nil {
+		t.Fatalf("修改时间变化时应重新加载, 实际: %v, %v", reloaded, err)
+	}
+	if cfg := manager.GetConfig(); cfg.Server.Workers != 30 {
+		t.Errorf("重新加载后的 workers 错误, 期望: 30, 实际: %d", cfg.Server.Workers)
+	}
+	if reloaded, _ := manager.ReloadIfModified(); reloaded {
+		t.Error("再次检查时文件未变化，不应重新加载")
+	}
+
+	// 内容有误时返回错误，且在再次修改前不重复加载
+	if err := os.WriteFile(configPath, []byte("server:\n  workers: 0\n"), 0644); err != nil {
+		t.Fatalf("更新测试配置文件失败: %v", err)
+	}
+	if reloaded, err := manager.ReloadIfModified(); reloaded || err == nil {
+		t.Errorf("无效配置应返回错误, 实际: %v, %v", reloaded, err)
+	}
+	if reloaded, err := manager.ReloadIfModified(); reloaded || err != nil {
+		t.Errorf("无效配置未再修改时不应重复加载, 实际: %v, %v", reloaded, err)
+	}
+	if cfg := manager.GetConfig(); cfg.Server.Workers != 30 {
+		t.Errorf("加载失败时应保留原配置, 实际 workers: %d", cfg.Server.Workers)
+	}
+}
+
+func TestConfigManagerLastReload(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cdn_ips:
+  - "192.168.1.0/24"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("创建测试配置文件失败: %v", err)
+	}
+
+	manager := NewConfigManager(configPath)
+	if !manager.LastReloadTime().IsZero() || manager.LastReloadError() != nil {
+		t.Error("加载前 LastReloadTime 应为零值且 LastReloadError 应为 nil")
+	}
+
+	before := time.Now()
+	if err := manager.LoadConfig(); err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	loaded := manager.LastReloadTime()
+	if loaded.Before(before) || manager.LastReloadError() != nil {
+		t.Errorf("加载成功后状态错误: time=%v, err=%v", loaded, manager.LastReloadError())
+	}
+
+	// 加载失败时记录错误，保留上次成功的时间
+	if err := os.WriteFile(configPath, []byte("server:\n  workers: 0\n"), 0644); err != nil {
+		t.Fatalf("更新测试配置文件失败: %v", err)
+	}
+	loadErr := manager.LoadConfig()
+	if loadErr == nil {
+		t.Fatal("无效配置应加载失败")
+	}
+	if err := manager.LastReloadError(); err == nil || err.Error() != loadErr.Error() {
+		t.Errorf("LastReloadError 应为最近一次的加载错误, 实际: %v", err)
+	}
+	if !manager.LastReloadTime().Equal(loaded) {
+		t.Errorf("加载失败时不应更新 LastReloadTime, 实际: %v", manager.LastReloadTime())
+	}
+
+	// 修正后重新加载成功，错误被清除
+	if err := os.WriteFile(configPath, []byte(strings.Replace(content, "workers: 10", "workers: 20", 1)), 0644); err != nil {
+		t.Fatalf("更新测试配置文件失败: %v", err)
+	}
+	if err := manager.LoadConfig(); err != nil {
+		t.Fatalf("重新加载失败: %v", err)
+	}
+	if manager.LastReloadError() != nil || !manager.LastReloadTime().After(loaded) {
+		t.Errorf("重新加载成功后状态错误: time=%v, err=%v", manager.LastReloadTime(), manager.LastReloadError())
+	}
+}
+
+func TestConfigManagerPollInterval(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cdn_ips:
+  - "192.168.1.0/24"
+config:
+  poll_interval: 20ms
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("创建测试配置文件失败: %v", err)
+	}
+
+	manager := NewConfigManager(configPath)
+	if err := manager.StartWatching(); err != nil {
+		t.Fatalf("启动监控失败: %v", err)
+	}
+	defer manager.StopWatching()
+	if manager.watcher != nil {
+		t.Error("配置了 poll_interval 时不应创建 fsnotify watcher")
+	}
+	ch := manager.Watch()
+
+	if err := os.WriteFile(configPath, []byte(strings.Replace(content, "workers: 10", "workers: 15", 1)), 0644); err != nil {
+		t.Fatalf("更新测试配置文件失败: %v", err)
+	}
+	select {
+	case event := <-ch:
+		if event.New.Server.Workers != 15 {
+			t.Errorf("轮询加载的配置错误, 期望 workers: 15, 实际: %d", event.New.Server.Workers)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("轮询未检测到配置文件变化")
+	}
+}
+
+// memorySource 内存中的配置来源，Watch 由测试通过 changes 触发
+type memorySource struct {
+	mu      sync.Mutex
+	data    []byte
+	changes chan struct{}
+}
+
+func (s *memorySource) Read() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data, nil
+}
+
+func (s *memorySource) Watch() (<-chan struct{}, error) { return s.changes, nil }
+
+func (s *memorySource) set(data string) {
+	s.mu.Lock()
+	s.data = []byte(data)
+	s.mu.Unlock()
+	s.changes <- struct{}{}
+}
+
+func TestConfigManagerFromSource(t *testing.T) {
+	content := `
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cdn_ips:
+  - "192.168.1.0/24"
+`
+	src := &memorySource{data: []byte(content), changes: make(chan struct{}, 1)}
+	manager := NewConfigManagerFromSource(src, WithDebounceDelay(0))
+	if err := manager.LoadConfig(); err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if manager.Source() != src {
+		t.Error("Source 应返回创建时的配置来源")
+	}
+	notified := make(notifyListener, 10)
+	manager.AddListener(notified)
+	if err := manager.StartWatching(); err != nil {
+		t.Fatalf("启动监听失败: %v", err)
+	}
+	defer manager.StopWatching()
+
+	src.set(content + "  - \"10.0.0.0/8\"\n")
+	select {
+	case cfg := <-notified:
+		if len(cfg.CDNIPs) != 2 {
+			t.Errorf("重新加载的配置错误, CDN IP 数量: %d", len(cfg.CDNIPs))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("来源变化后应重新加载配置")
+	}
+
+	// 非文件来源不支持按修改时间比较，ReloadIfModified 直接重新加载
+	if reloaded, err := manager.ReloadIfModified(); !reloaded || err != nil {
+		t.Errorf("ReloadIfModified 期望重新加载, 实际 %v, %v", reloaded, err)
+	}
+	if err := manager.Restore(filepath.Join(t.TempDir(), "backup.yaml")); err == nil {
+		t.Error("非文件来源不应支持 Restore")
+	}
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hao/fxdns/internal/config/migrations"
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentConfigVersion 当前的配置格式版本，GenerateDefault 生成的配置使用此版本
+const CurrentConfigVersion = migrations.Latest
+
+// configVersion 返回原始配置内容中的 config_version，未设置时视为 migrations.Initial
+func configVersion(data []byte) (string, error) {
+	var header struct {
+		ConfigVersion string `yaml:"config_version"`
+	}
+	if err := yaml.Unmarshal(data, &header); err != nil {
+		return "", err
+	}
+	if header.ConfigVersion == "" {
+		return migrations.Initial, nil
+	}
+	return header.ConfigVersion, nil
+}
+
+// migrateRaw 将原始配置内容从 from 版本迁移到 to 版本。迁移在解析后的映射上进行，之后只把发生变化的键
+// 写回原始 YAML 文档，未变化部分的注释与键顺序保持不变。返回迁移后的内容与 "路径: 旧值 -> 新值" 形式的变更列表
+func migrateRaw(data []byte, from, to string) ([]byte, []string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	before := make(map[string]interface{})
+	after := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &before); err != nil {
+		return nil, nil, err
+	}
+	if err := yaml.Unmarshal(data, &after); err != nil {
+		return nil, nil, err
+	}
+	if err := migrations.Apply(after, from, to); err != nil {
+		return nil, nil, err
+	}
+
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("配置文件的顶层应为映射")
+	}
+	var changes []string
+	if err := patchMapping(root, before, after, "", &changes); err != nil {
+		return nil, nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), changes, nil
+}
+
+// migrateInMemory 加载配置时将版本为 version 的旧配置在内存中迁移到 CurrentConfigVersion，不修改配置文件。
+// 未设置 config_version 的配置按 migrations.Initial 处理，迁移补充的字段逐项记录警告，避免被静默接受
+func migrateInMemory(data []byte, version string) ([]byte, error) {
+	migrated, changes, err := migrateRaw(data, version, CurrentConfigVersion)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("警告: 配置的版本为 %s (未设置 config_version 时视为 %s)，已在内存中迁移到 %s，变更: %s。"+
+		"配置文件未修改，可通过 MigrateConfig 写回，或在配置中显式填写上述字段与 config_version",
+		version, migrations.Initial, CurrentConfigVersion, strings.Join(changes, "; "))
+	return migrated, nil
+}
+
+// patchMapping 按 before 与 after 的差异修改映射节点 node：新增的键追加到末尾，删除的键移除，
+// 两侧均为映射的键递归处理，其余变化的键替换其值节点。每处变更追加到 changes
+func patchMapping(node *yaml.Node, before, after map[string]interface{}, prefix string, changes *[]string) error {
+	keys := make([]string, 0, len(before)+len(after))
+	for key := range before {
+		keys = append(keys, key)
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		oldValue, hadOld := before[key]
+		newValue, hasNew := after[key]
+		if hadOld && hasNew && reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		path := prefix + key
+		index := mappingIndex(node, key)
+
+		oldMap, oldIsMap := oldValue.(map[string]interface{})
+		newMap, newIsMap := newValue.(map[string]interface{})
+		if hadOld && hasNew && oldIsMap && newIsMap && index >= 0 && node.Content[index+1].Kind == yaml.MappingNode {
+			if err := patchMapping(node.Content[index+1], oldMap, newMap, path+".", changes); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch {
+		case !hasNew:
+			if index >= 0 {
+				node.Content = append(node.Content[:index], node.Content[index+2:]...)
+			}
+			*changes = append(*changes, fmt.Sprintf("%s: %v -> <删除>", path, oldValue))
+		default:
+			var value yaml.Node
+			if err := value.Encode(newValue); err != nil {
+				return fmt.Errorf("序列化 %s 失败: %w", path, err)
+			}
+			if index >= 0 {
+				node.Content[index+1] = &value
+			} else {
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, &value)
+			}
+			old := "<未设置>"
+			if hadOld {
+				old = fmt.Sprint(oldValue)
+			}
+			*changes = append(*changes, fmt.Sprintf("%s: %s -> %v", path, old, newValue))
+		}
+	}
+	return nil
+}
+
+// mappingIndex 返回映射节点中键 key 所在的下标，不存在时返回 -1
+func mappingIndex(node *yaml.Node, key string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// MigrateConfig 将配置文件从 fromVersion 版本迁移到 toVersion 版本，写回配置文件并立即重新加载。
+// 配置文件当前的 config_version（未设置时为 1）必须等于 fromVersion；迁移后的内容校验通过后，
+// 先备份原文件 (配置了 backup_dir 时备份到其中，否则为配置文件旁的 <文件名>.v<fromVersion>.bak)，
+// 再经临时文件原子替换配置文件。只修改迁移涉及的键，其余内容的注释与键顺序保留。只支持本地配置文件
+func (m *ConfigManager) MigrateConfig(fromVersion, toVersion string) error {
+	if m.configFilePath == "" {
+		return fmt.Errorf("配置来源 %v 不是本地文件，不支持迁移配置", m.source)
+	}
+	data, err := os.ReadFile(m.configFilePath)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	version, err := configVersion(data)
+	if err != nil {
+		return fmt.Errorf("解析配置文件失败: %w", err)
+	}
+	if version != fromVersion {
+		return fmt.Errorf("配置文件的版本为 %s，不是 %s", version, fromVersion)
+	}
+
+	migrated, changes, err := migrateRaw(data, fromVersion, toVersion)
+	if err != nil {
+		return err
+	}
+	cfg, err := LoadConfigFromBytes(migrated)
+	if err != nil {
+		return fmt.Errorf("迁移后的配置无效: %w", err)
+	}
+	if err := m.validateConfig(cfg); err != nil {
+		return fmt.Errorf("迁移后的配置无效: %w", err)
+	}
+
+	var backupPath string
+	if cfg.ConfigFile.BackupDir != "" {
+		backupPath, err = backupToDir(cfg.ConfigFile.BackupDir, cfg.ConfigFile.MaxBackups, data)
+	} else {
+		backupPath = m.configFilePath + ".v" + fromVersion + ".bak"
+		err = writeBackupData(backupPath, data)
+	}
+	if err != nil {
+		return fmt.Errorf("备份配置文件失败: %w", err)
+	}
+
+	info, err := os.Stat(m.configFilePath)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(m.configFilePath, migrated, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+	log.Printf("ConfigManager: 已将配置文件从版本 %s 迁移到 %s，原文件备份为 %s，变更: %s",
+		fromVersion, toVersion, backupPath, strings.Join(changes, "; "))
+	return m.LoadConfig()
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hao/fxdns/internal/config/migrations"
+)
+
+// v1Config 版本 1 的配置：没有 config_version 与 server.workers
+const v1Config = `# 版本 1 的配置
+upstream:
+  server: "8.8.8.8:53" # 主上游
+server:
+  listen: ":53"
+cdn_ips:
+  - "10.0.0.0/8"
+`
+
+func TestMigrateRawPreservesLayout(t *testing.T) {
+	migrated, changes, err := migrateRaw([]byte(v1Config), "1", "2")
+	if err != nil {
+		t.Fatalf("迁移失败: %v", err)
+	}
+	out := string(migrated)
+	// 注释与原有键的顺序保留，只追加迁移涉及的键
+	for _, want := range []string{"# 版本 1 的配置", "# 主上游", "workers: 10", `config_version: "2"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("迁移结果缺少 %q:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "upstream:") > strings.Index(out, "server:\n") || strings.Index(out, "server:\n") > strings.Index(out, "cdn_ips:") {
+		t.Errorf("迁移不应改变原有键的顺序:\n%s", out)
+	}
+	want := []string{"config_version: <未设置> -> 2", "server.workers: <未设置> -> 10"}
+	if strings.Join(changes, "\n") != strings.Join(want, "\n") {
+		t.Errorf("变更列表错误, 期望: %v, 实际: %v", want, changes)
+	}
+}
+
+func TestLoadConfigMigratesOldVersion(t *testing.T) {
+	cfg, err := LoadConfigFromBytes([]byte(v1Config))
+	if err != nil {
+		t.Fatalf("加载版本 1 的配置失败: %v", err)
+	}
+	if cfg.ConfigVersion != CurrentConfigVersion || cfg.Server.Workers != migrations.V1Workers {
+		t.Errorf("迁移后期望版本 %s、workers %d, 实际版本 %s、workers %d", CurrentConfigVersion, migrations.V1Workers, cfg.ConfigVersion, cfg.Server.Workers)
+	}
+
+	if _, err := LoadConfigFromBytes([]byte("config_version: \"9\"\n" + v1Config)); !errors.Is(err, migrations.ErrUnsupportedVersion) {
+		t.Errorf("未知版本应返回 ErrUnsupportedVersion, 实际: %v", err)
+	}
+}
+
+func TestConfigManagerMigrateConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(v1Config), 0640); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+	manager := NewConfigManager(configPath)
+	if err := manager.LoadConfig(); err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+
+	if err := manager.MigrateConfig("2", "2"); err == nil {
+		t.Error("起始版本与配置文件不符时应返回错误")
+	}
+	if data, _ := os.ReadFile(configPath); string(data) != v1Config {
+		t.Errorf("迁移失败时不应修改配置文件:\n%s", data)
+	}
+
+	if err := manager.MigrateConfig("1", "2"); err != nil {
+		t.Fatalf("迁移配置失败: %v", err)
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("读取配置文件失败: %v", err)
+	}
+	if version, _ := configVersion(data); version != "2" || !strings.Contains(string(data), "workers: 10") {
+		t.Errorf("配置文件未迁移到版本 2:\n%s", data)
+	}
+	if !strings.Contains(string(data), "# 版本 1 的配置") {
+		t.Errorf("迁移后应保留注释:\n%s", data)
+	}
+	if info, _ := os.Stat(configPath); info.Mode().Perm() != 0640 {
+		t.Errorf("迁移后应保留文件权限, 实际 %v", info.Mode().Perm())
+	}
+	// 未配置 backup_dir 时原文件备份在配置文件旁，且不留下临时文件
+	if backup, err := os.ReadFile(configPath + ".v1.bak"); err != nil || string(backup) != v1Config {
+		t.Errorf("迁移前应备份原配置文件: %v\n%s", err, backup)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(configPath)); len(entries) != 2 {
+		t.Errorf("配置目录中应只有配置文件与备份, 实际 %d 个文件", len(entries))
+	}
+	if cfg := manager.GetConfig(); cfg.ConfigVersion != "2" || cfg.Server.Workers != 10 {
+		t.Errorf("迁移后应重新加载配置, 实际版本 %s、workers %d", cfg.ConfigVersion, cfg.Server.Workers)
+	}
+
+	if err := NewConfigManagerFromSource(&memorySource{data: []byte(v1Config)}).MigrateConfig("1", "2"); err == nil {
+		t.Error("非文件来源应返回错误")
+	}
+}
+
+func TestConfigManagerMigrateConfigBackupDir(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := filepath.Join(dir, "backups")
+	configPath := filepath.Join(dir, "config.yaml")
+	original := v1Config + "config:\n  backup_dir: \"" + backupDir + "\"\n"
+	if err := os.WriteFile(configPath, []byte(original), 0600); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+	manager := NewConfigManager(configPath)
+	if err := manager.LoadConfig(); err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if err := manager.MigrateConfig("1", "2"); err != nil {
+		t.Fatalf("迁移配置失败: %v", err)
+	}
+
+	// 配置了 backup_dir 时原文件备份到其中
+	backups, err := ListBackups(backupDir)
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("backup_dir 中应有 1 个备份, 实际: %v (%v)", backups, err)
+	}
+	if data, _ := os.ReadFile(backups[0]); string(data) != original {
+		t.Errorf("备份内容应为迁移前的配置文件:\n%s", data)
+	}
+}
@@ -0,0 +1,86 @@
+// Package migrations 提供配置格式版本 (config_version) 之间的迁移。每个迁移修改解析后的原始 YAML 映射，
+// 供 config.ConfigManager.MigrateConfig 与加载旧版本配置时使用
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+const (
+	// Latest 当前的配置格式版本
+	Latest = "2"
+	// Initial 未设置 config_version 的配置视为此版本
+	Initial = "1"
+)
+
+// ErrUnsupportedVersion 无法在两个版本之间迁移（版本未知，或目标版本早于起始版本）
+var ErrUnsupportedVersion = errors.New("不支持的配置版本")
+
+// Func 就地修改原始 YAML 映射的迁移函数
+type Func func(v map[string]interface{}) error
+
+// Migration 从 From 版本到 To 版本的一步迁移
+type Migration struct {
+	From        string
+	To          string
+	Description string
+	Apply       Func
+}
+
+// all 按版本顺序排列的迁移，每一步的 To 是下一步的 From
+var all = []Migration{
+	{From: "1", To: "2", Description: "server 补充 workers 字段", Apply: v1ToV2},
+}
+
+// Plan 返回从 from 迁移到 to 需要依次执行的迁移，from 与 to 相同时返回空列表
+func Plan(from, to string) ([]Migration, error) {
+	if from == to {
+		return nil, nil
+	}
+	for i, m := range all {
+		if m.From != from {
+			continue
+		}
+		for j := i; j < len(all); j++ {
+			if all[j].To == to {
+				return all[i : j+1], nil
+			}
+		}
+		break
+	}
+	return nil, fmt.Errorf("%w: 无法从 %q 迁移到 %q", ErrUnsupportedVersion, from, to)
+}
+
+// Apply 依次执行从 from 到 to 的迁移并记录每一步，完成后将 v 的 config_version 设为 to。
+// 出错时 v 可能已被部分修改
+func Apply(v map[string]interface{}, from, to string) error {
+	plan, err := Plan(from, to)
+	if err != nil {
+		return err
+	}
+	for _, m := range plan {
+		if err := m.Apply(v); err != nil {
+			return fmt.Errorf("配置从版本 %s 迁移到 %s 失败: %w", m.From, m.To, err)
+		}
+		log.Printf("配置已从版本 %s 迁移到 %s: %s", m.From, m.To, m.Description)
+	}
+	v["config_version"] = to
+	return nil
+}
+
+// section 返回 v 中名为 name 的映射，不存在时创建
+func section(v map[string]interface{}, name string) (map[string]interface{}, error) {
+	raw, ok := v[name]
+	if !ok || raw == nil {
+		m := make(map[string]interface{})
+		v[name] = m
+		return m, nil
+	}
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s 应为映射，实际为 %T", name, raw)
+	}
+	return m, nil
+}
@@ -0,0 +1,59 @@
+package migrations
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	testCases := []struct {
+		from, to string
+		steps    int
+		valid    bool
+	}{
+		{"2", "2", 0, true},
+		{Initial, Latest, 1, true},
+		{"2", "1", 0, false},
+		{"0", "2", 0, false},
+		{"1", "9", 0, false},
+	}
+	for _, tc := range testCases {
+		plan, err := Plan(tc.from, tc.to)
+		if tc.valid && (err != nil || len(plan) != tc.steps) {
+			t.Errorf("%s -> %s: 期望 %d 步, 实际 %d 步 (%v)", tc.from, tc.to, tc.steps, len(plan), err)
+		}
+		if !tc.valid && !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("%s -> %s: 应返回 ErrUnsupportedVersion, 实际: %v", tc.from, tc.to, err)
+		}
+	}
+}
+
+func TestApplyV1ToV2(t *testing.T) {
+	testCases := []struct {
+		name    string
+		config  map[string]interface{}
+		workers interface{}
+	}{
+		{"补充 workers", map[string]interface{}{"server": map[string]interface{}{"listen": ":53"}}, V1Workers},
+		{"保留已有的 workers", map[string]interface{}{"server": map[string]interface{}{"workers": 4}}, 4},
+		{"缺少 server", map[string]interface{}{}, V1Workers},
+		{"server 为空", map[string]interface{}{"server": nil}, V1Workers},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := Apply(tc.config, "1", "2"); err != nil {
+				t.Fatalf("迁移失败: %v", err)
+			}
+			if got := tc.config["server"].(map[string]interface{})["workers"]; got != tc.workers {
+				t.Errorf("workers 期望 %v, 实际 %v", tc.workers, got)
+			}
+			if got := tc.config["config_version"]; got != "2" {
+				t.Errorf("config_version 期望 2, 实际 %v", got)
+			}
+		})
+	}
+
+	if err := Apply(map[string]interface{}{"server": ":53"}, "1", "2"); err == nil {
+		t.Error("server 不是映射时应返回错误")
+	}
+}
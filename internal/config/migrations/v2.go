@@ -0,0 +1,16 @@
+package migrations
+
+// V1Workers 版本 1 的配置没有 server.workers 字段，固定使用此数量的工作协程，迁移到版本 2 时写入该值
+const V1Workers = 10
+
+// v1ToV2 为 server 补充 workers 字段，已设置时保留原值
+func v1ToV2(v map[string]interface{}) error {
+	server, err := section(v, "server")
+	if err != nil {
+		return err
+	}
+	if _, ok := server["workers"]; !ok {
+		server["workers"] = V1Workers
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// ModifyExprEnv 返回 modify_expr 表达式可使用的变量及其类型（以零值表示）：
+//
+//	domain      string   查询域名（不带末尾的点）
+//	ips         []string 应答中的全部 A/AAAA 地址，按出现顺序
+//	cdnIPs      []string ips 中属于 CDN 网段的地址
+//	ttl         int      应答中 A/AAAA 记录的最小 TTL（秒）
+//	cname_chain []string 应答中的 CNAME 目标，按出现顺序
+func ModifyExprEnv() map[string]interface{} {
+	return map[string]interface{}{
+		"domain":      "",
+		"ips":         []string{},
+		"cdnIPs":      []string{},
+		"ttl":         0,
+		"cname_chain": []string{},
+	}
+}
+
+// CompileModifyExpr 按 ModifyExprEnv 编译 modify_expr 表达式，表达式的结果必须是数组
+func CompileModifyExpr(src string) (*vm.Program, error) {
+	program, err := expr.Compile(src, expr.Env(ModifyExprEnv()), expr.AsKind(reflect.Slice))
+	if err != nil {
+		return nil, fmt.Errorf("编译 modify_expr 失败: %w", err)
+	}
+	return program, nil
+}
+
+// ModifyProgram 返回由 modify_expr 编译的程序，未配置或编译失败时返回 nil
+func (r *DomainRule) ModifyProgram() *vm.Program {
+	return r.modifyProgram
+}
+
+// compileModifyExprs 编译各规则的 modify_expr，编译错误由 ValidateRules 报告
+func (c *Config) compileModifyExprs() {
+	for i := range c.Domains {
+		rule := &c.Domains[i]
+		rule.modifyProgram = nil
+		if rule.ModifyExpr == "" {
+			continue
+		}
+		if program, err := CompileModifyExpr(rule.ModifyExpr); err == nil {
+			rule.modifyProgram = program
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+
+	"github.com/hao/fxdns/internal/util"
+	"github.com/miekg/dns"
+)
+
+// 域名规则校验错误类型，可通过 errors.Is 判断 ValidationError 的类别
+var (
+	ErrMissingPattern    = errors.New("缺少 pattern")
+	ErrInvalidStrategy   = errors.New("无效的策略")
+	ErrInvalidTTL        = errors.New("无效的 TTL")
+	ErrInvalidRegex      = errors.New("无效的正则表达式")
+	ErrConflictingFields = errors.New("字段相互冲突")
+	ErrInvalidFieldValue = errors.New("无效的字段值")
+)
+
+// maxRuleTTL TTL 的上限，RFC 2181 规定 TTL 的最高位必须为 0
+const maxRuleTTL = math.MaxInt32
+
+// ValidationError 单条域名规则中某个字段的校验错误
+type ValidationError struct {
+	Index   int    // 规则在 domains 中的下标，从 0 开始
+	Field   string // 出错的字段名，与配置文件中的键一致
+	Message string // 可读的错误描述
+	Err     error  // 错误类别，为 ErrMissingPattern 等之一
+}
+
+// Error 实现 error 接口
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("domains[%d].%s: %s", e.Index, e.Field, e.Message)
+}
+
+// Unwrap 返回错误类别，便于使用 errors.Is 判断
+func (e ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors 一组校验错误，作为 error 返回时一次性报告全部问题
+type ValidationErrors []ValidationError
+
+// Error 实现 error 接口，每个错误占一行
+func (errs ValidationErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap 返回全部校验错误，使 errors.Is 可以匹配其中任意一个的类别
+func (errs ValidationErrors) Unwrap() []error {
+	result := make([]error, len(errs))
+	for i, err := range errs {
+		result[i] = err
+	}
+	return result
+}
+
+// ValidateRules 校验全部域名规则并返回发现的所有错误，而不是在第一个错误处停止，
+// 便于一次性展示所有问题。没有错误时返回 nil
+func ValidateRules(rules []DomainRule) []ValidationError {
+	var errs []ValidationError
+	for i, rule := range rules {
+		add := func(field string, kind error, format string, args ...interface{}) {
+			errs = append(errs, ValidationError{Index: i, Field: field, Message: fmt.Sprintf(format, args...), Err: kind})
+		}
+
+		pattern := strings.TrimSpace(rule.Pattern)
+		if pattern == "" {
+			add("pattern", ErrMissingPattern, "pattern 不能为空")
+		} else if strings.HasPrefix(pattern, util.RegexPatternPrefix) {
+			if _, err := util.CompileRegex(strings.TrimPrefix(pattern, util.RegexPatternPrefix)); err != nil {
+				add("pattern", ErrInvalidRegex, "规则 %s 的正则表达式无法编译: %v", pattern, err)
+			}
+		}
+
+		switch rule.Strategy {
+		case "", StrategyFilterNonCDN, StrategyReturnCDNA, StrategyNone:
+		default:
+			add("strategy", ErrInvalidStrategy, "规则 %s 的 strategy 无效: %s", rule.Pattern, rule.Strategy)
+		}
+		switch rule.FallbackStrategy {
+		case "", FallbackStrategyUseFallback, FallbackStrategyReturnPrimary, FallbackStrategyReturnEmpty, FallbackStrategyNXDomain:
+		default:
+			add("fallback_strategy", ErrInvalidStrategy, "规则 %s 的 fallback_strategy 无效: %s", rule.Pattern, rule.FallbackStrategy)
+		}
+
+		if rule.TTL > maxRuleTTL {
+			add("ttl", ErrInvalidTTL, "规则 %s 的 ttl 超出上限 %d: %d", rule.Pattern, maxRuleTTL, rule.TTL)
+		}
+		if rule.MinTTL > maxRuleTTL {
+			add("min_ttl", ErrInvalidTTL, "规则 %s 的 min_ttl 超出上限 %d: %d", rule.Pattern, maxRuleTTL, rule.MinTTL)
+		}
+		if rule.MaxTTL > maxRuleTTL {
+			add("max_ttl", ErrInvalidTTL, "规则 %s 的 max_ttl 超出上限 %d: %d", rule.Pattern, maxRuleTTL, rule.MaxTTL)
+		}
+		if rule.ResponseTTLMultiplier < 0 {
+			add("response_ttl_multiplier", ErrInvalidTTL, "规则 %s 的 response_ttl_multiplier 不能为负数: %g", rule.Pattern, rule.ResponseTTLMultiplier)
+		}
+		if rule.MaxTTL > 0 && rule.MinTTL > rule.MaxTTL {
+			add("min_ttl", ErrConflictingFields, "规则 %s 的 min_ttl (%d) 不能大于 max_ttl (%d)", rule.Pattern, rule.MinTTL, rule.MaxTTL)
+		}
+
+		if rule.Weight < 0 {
+			add("weight", ErrInvalidFieldValue, "规则 %s 的 weight 不能为负数: %d", rule.Pattern, rule.Weight)
+		}
+		if rule.MaxResponseIPs < 0 {
+			add("max_response_ips", ErrInvalidFieldValue, "规则 %s 的 max_response_ips 不能为负数: %d", rule.Pattern, rule.MaxResponseIPs)
+		}
+		if rule.MinCDNIPs < 0 {
+			add("min_cdnips", ErrInvalidFieldValue, "规则 %s 的 min_cdnips 不能为负数: %d", rule.Pattern, rule.MinCDNIPs)
+		}
+		if rule.UpstreamTimeout < 0 {
+			add("upstream_timeout", ErrInvalidFieldValue, "规则 %s 的 upstream_timeout 不能为负数: %v", rule.Pattern, rule.UpstreamTimeout)
+		}
+		for _, cidr := range rule.CDNCIDROverride {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				add("cdn_cidr_override", ErrInvalidFieldValue, "规则 %s 的 cdn_cidr_override 中的网段 %s 无效", rule.Pattern, cidr)
+			}
+		}
+		for _, name := range rule.QtypeFilter {
+			if _, ok := dns.StringToType[strings.ToUpper(strings.TrimSpace(name))]; !ok {
+				add("qtype_filter", ErrInvalidFieldValue, "规则 %s 的 qtype_filter 中的查询类型 %s 无效", rule.Pattern, name)
+			}
+		}
+		switch rule.CDNResponseOrder {
+		case "", CDNOrderOriginal, CDNOrderClientIPSorted, CDNOrderRandom, CDNOrderLatencySorted:
+		default:
+			add("cdn_response_order", ErrInvalidFieldValue, "规则 %s 的 cdn_response_order 无效: %s", rule.Pattern, rule.CDNResponseOrder)
+		}
+		if rule.CDNResponseOrder == CDNOrderLatencySorted && !rule.CDNLatencyProbe {
+			add("cdn_latency_probe", ErrConflictingFields, "规则 %s 的 cdn_response_order 为 latency_sorted 但未开启 cdn_latency_probe", rule.Pattern)
+		}
+		ownership := strings.TrimSpace(rule.CDNOwnershipPattern)
+		if rule.VerifyCDNIPOwnership && ownership == "" {
+			add("cdn_ownership_pattern", ErrConflictingFields, "规则 %s 开启了 verify_cdnip_ownership 但未配置 cdn_ownership_pattern", rule.Pattern)
+		} else if strings.HasPrefix(ownership, util.RegexPatternPrefix) {
+			if _, err := util.CompileRegex(strings.TrimPrefix(ownership, util.RegexPatternPrefix)); err != nil {
+				add("cdn_ownership_pattern", ErrInvalidRegex, "规则 %s 的 cdn_ownership_pattern 正则表达式无法编译: %v", rule.Pattern, err)
+			}
+		}
+		if rule.ModifyExpr != "" {
+			if _, err := CompileModifyExpr(rule.ModifyExpr); err != nil {
+				add("modify_expr", ErrInvalidFieldValue, "规则 %s 的 modify_expr 无效: %v", rule.Pattern, err)
+			}
+		}
+		if soa := rule.SyntheticSOA; soa != nil {
+			if strings.ContainsAny(soa.MName, " \t") {
+				add("synthetic_soa.mname", ErrInvalidFieldValue, "规则 %s 的 synthetic_soa.mname 不是有效的域名: %q", rule.Pattern, soa.MName)
+			}
+			if strings.ContainsAny(soa.RName, " \t@") {
+				add("synthetic_soa.rname", ErrInvalidFieldValue, "规则 %s 的 synthetic_soa.rname 不是有效的域名 (邮箱中的 @ 应写作 .): %q", rule.Pattern, soa.RName)
+			}
+			if soa.Minimum > maxRuleTTL {
+				add("synthetic_soa.minimum", ErrInvalidTTL, "规则 %s 的 synthetic_soa.minimum 超出上限 %d: %d", rule.Pattern, maxRuleTTL, soa.Minimum)
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateRules(t *testing.T) {
+	valid := []DomainRule{
+		{Pattern: "example.com", Strategy: StrategyFilterNonCDN, TTL: 300},
+		{Pattern: "*.cdn.example.com", Strategy: StrategyReturnCDNA, Weight: 2, MinTTL: 30, MaxTTL: 600},
+		{Pattern: `re:^api[0-9]+\.example\.com$`},
+		{Pattern: "www.example.net", ModifyExpr: `filter(ips, {# in cdnIPs})`},
+		{Pattern: "img.example.net", CDNResponseOrder: CDNOrderClientIPSorted},
+		{Pattern: "video.example.net", CDNResponseOrder: CDNOrderLatencySorted, CDNLatencyProbe: true},
+		{Pattern: "cdn.example.net", VerifyCDNIPOwnership: true, CDNOwnershipPattern: "*.edge.example.net"},
+	}
+	if errs := ValidateRules(valid); errs != nil {
+		t.Fatalf("有效规则不应返回错误: %v", errs)
+	}
+
+	rules := []DomainRule{
+		{Pattern: "", Strategy: StrategyFilterNonCDN},
+		{Pattern: "a.example.com", Strategy: "replace"},
+		{Pattern: "b.example.com", TTL: 1 << 31},
+		{Pattern: "re:[", Strategy: StrategyNone},
+		{Pattern: "c.example.com", MinTTL: 600, MaxTTL: 60},
+		{Pattern: "d.example.com", FallbackStrategy: "drop", Weight: -1},
+		{Pattern: "e.example.com", CDNCIDROverride: []string{"192.0.2.0/24", "192.0.2.1"}},
+		{Pattern: "f.example.com", SyntheticSOA: &SyntheticSOA{RName: "admin@example.com"}},
+		{Pattern: "g.example.com", QtypeFilter: []string{"A", "NOTATYPE"}},
+		{Pattern: "h.example.com", ModifyExpr: `filter(ips, # startsWith`},
+		{Pattern: "i.example.com", ModifyExpr: `len(ips)`},
+		{Pattern: "j.example.com", CDNResponseOrder: "fastest"},
+		{Pattern: "k.example.com", VerifyCDNIPOwnership: true},
+		{Pattern: "l.example.com", CDNOwnershipPattern: "re:edge("},
+		{Pattern: `re:(?:[a-z]{1,100}){1,10}(?:[0-9]{1,100}){1,5}`},
+		{Pattern: "m.example.com", CDNResponseOrder: CDNOrderLatencySorted},
+	}
+	expected := []struct {
+		index int
+		field string
+		kind  error
+	}{
+		{0, "pattern", ErrMissingPattern},
+		{1, "strategy", ErrInvalidStrategy},
+		{2, "ttl", ErrInvalidTTL},
+		{3, "pattern", ErrInvalidRegex},
+		{4, "min_ttl", ErrConflictingFields},
+		{5, "fallback_strategy", ErrInvalidStrategy},
+		{5, "weight", ErrInvalidFieldValue},
+		{6, "cdn_cidr_override", ErrInvalidFieldValue},
+		{7, "synthetic_soa.rname", ErrInvalidFieldValue},
+		{8, "qtype_filter", ErrInvalidFieldValue},
+		{9, "modify_expr", ErrInvalidFieldValue},
+		{10, "modify_expr", ErrInvalidFieldValue},
+		{11, "cdn_response_order", ErrInvalidFieldValue},
+		{12, "cdn_ownership_pattern", ErrConflictingFields},
+		{13, "cdn_ownership_pattern", ErrInvalidRegex},
+		{14, "pattern", ErrInvalidRegex},
+		{15, "cdn_latency_probe", ErrConflictingFields},
+	}
+
+	errs := ValidateRules(rules)
+	if len(errs) != len(expected) {
+		t.Fatalf("错误数量错误, 期望: %d, 实际: %d (%v)", len(expected), len(errs), errs)
+	}
+	for i, want := range expected {
+		got := errs[i]
+		if got.Index != want.index || got.Field != want.field || !errors.Is(got, want.kind) {
+			t.Errorf("第 %d 个错误不符, 期望: %d/%s/%v, 实际: %d/%s/%v", i, want.index, want.field, want.kind, got.Index, got.Field, got.Err)
+		}
+		if got.Message == "" {
+			t.Errorf("第 %d 个错误缺少描述", i)
+		}
+	}
+}
+
+func TestValidateReportsAllRuleErrors(t *testing.T) {
+	_, err := LoadConfigFromBytes([]byte(`
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 10
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "example.com"
+    strategy: "filter"
+  - pattern: ""
+    strategy: "filter_non_cdn"
+`))
+	if err == nil {
+		t.Fatal("无效的域名规则应返回错误")
+	}
+
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) || len(verrs) != 2 {
+		t.Fatalf("应返回包含全部规则错误的 ValidationErrors: %v", err)
+	}
+	if !errors.Is(err, ErrInvalidStrategy) || !errors.Is(err, ErrMissingPattern) {
+		t.Errorf("errors.Is 应能匹配每个错误的类别: %v", err)
+	}
+	if !strings.Contains(err.Error(), "domains[0].strategy") || !strings.Contains(err.Error(), "domains[1].pattern") {
+		t.Errorf("错误信息应包含规则下标与字段: %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxConfigSize 从远程来源读取配置时的大小上限
+const maxConfigSize = 16 << 20
+
+// ErrKeyNotFound 远程来源中不存在配置键
+var ErrKeyNotFound = errors.New("配置键不存在")
+
+// DefaultConsulWaitTime Consul 阻塞查询的最长等待时间
+const DefaultConsulWaitTime = 5 * time.Minute
+
+// ConsulSource Consul KV 中的一个键，以 HTTP API (/v1/kv) 读取，以阻塞查询监听变化
+type ConsulSource struct {
+	// WaitTime 阻塞查询的最长等待时间，为 0 时使用 DefaultConsulWaitTime
+	WaitTime time.Duration
+	// RetryInterval 监听出错后的重试间隔，为 0 时使用 DefaultRetryInterval
+	RetryInterval time.Duration
+
+	addr   string // http://host:port
+	key    string
+	token  string
+	client *http.Client
+
+	watchMu sync.Mutex
+	ctx     context.Context // 当前监听协程的上下文，Close 时取消并替换
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	index   uint64 // 最近一次 Read 得到的 X-Consul-Index，Watch 从此开始阻塞查询
+}
+
+// NewConsulSource 创建读取 Consul (host:port) 中 key 的配置来源，token 非空时以 X-Consul-Token 发送
+func NewConsulSource(hostport, key, token string) *ConsulSource {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ConsulSource{
+		addr:   "http://" + hostport,
+		key:    key,
+		token:  token,
+		client: &http.Client{},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Read 实现 ConfigSource
+func (s *ConsulSource) Read() ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	data, index, err := s.get(ctx, 0)
+	if index != 0 {
+		s.watchMu.Lock()
+		s.index = index
+		s.watchMu.Unlock()
+	}
+	return data, err
+}
+
+// Watch 实现 ConfigSource，从上次 Read 得到的 X-Consul-Index 开始发起阻塞查询，索引变化时发送信号
+func (s *ConsulSource) Watch() (<-chan struct{}, error) {
+	s.watchMu.Lock()
+	ctx, index := s.ctx, s.index
+	s.wg.Add(1)
+	s.watchMu.Unlock()
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer s.wg.Done()
+		defer close(ch)
+		for ctx.Err() == nil {
+			_, next, err := s.get(ctx, index)
+			if err == nil && next == 0 {
+				err = errors.New("响应缺少 X-Consul-Index")
+			}
+			if err != nil && (!errors.Is(err, ErrKeyNotFound) || next == 0) {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("监听 %s 失败，%v 后重试: %v", s, s.retryInterval(), err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(s.retryInterval()):
+				}
+				continue
+			}
+			if index != 0 && next != index {
+				notify(ch)
+			}
+			// 索引回退（如 Consul 快照恢复）时按文档重新从头开始
+			if next < index {
+				next = 0
+			}
+			index = next
+		}
+	}()
+	return ch, nil
+}
+
+// get 读取键的原始值，index 非 0 时为阻塞查询。返回响应中的 X-Consul-Index
+func (s *ConsulSource) get(ctx context.Context, index uint64) ([]byte, uint64, error) {
+	query := url.Values{"raw": {""}}
+	if index != 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", s.waitTime().String())
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.addr+"/v1/kv/"+s.key+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("创建请求失败: %w", err)
+	}
+	if s.token != "" {
+		req.Header.Set("X-Consul-Token", s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("请求 %s 失败: %w", s, err)
+	}
+	defer resp.Body.Close()
+
+	next, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		// 键不存在时阻塞查询同样有效，键被创建后索引变化
+		return nil, next, fmt.Errorf("%w: %s", ErrKeyNotFound, s)
+	default:
+		return nil, next, fmt.Errorf("请求 %s 失败: 状态码 %d", s, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxConfigSize))
+	if err != nil {
+		return nil, next, fmt.Errorf("读取 %s 失败: %w", s, err)
+	}
+	return data, next, nil
+}
+
+func (s *ConsulSource) waitTime() time.Duration {
+	if s.WaitTime > 0 {
+		return s.WaitTime
+	}
+	return DefaultConsulWaitTime
+}
+
+func (s *ConsulSource) retryInterval() time.Duration {
+	if s.RetryInterval > 0 {
+		return s.RetryInterval
+	}
+	return DefaultRetryInterval
+}
+
+// Close 停止所有 Watch 并关闭其通道，等待监听协程退出后返回。之后仍可再次 Watch
+func (s *ConsulSource) Close() error {
+	s.watchMu.Lock()
+	s.cancel()
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.watchMu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+// String 返回 consul:// 形式的来源描述
+func (s *ConsulSource) String() string {
+	return "consul://" + s.addr[len("http://"):] + "/" + s.key
+}
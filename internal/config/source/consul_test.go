@@ -0,0 +1,154 @@
+package source
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockConsul 模拟 Consul KV 的 /v1/kv 接口，支持 ?raw 与 index/wait 阻塞查询
+type mockConsul struct {
+	mu      sync.Mutex
+	values  map[string][]byte
+	index   uint64
+	changed chan struct{} // 每次修改时关闭并替换，唤醒阻塞查询
+	token   string        // 非空时要求请求携带该 X-Consul-Token
+}
+
+func newMockConsul(t *testing.T) (*mockConsul, *httptest.Server) {
+	m := &mockConsul{values: make(map[string][]byte), index: 1, changed: make(chan struct{})}
+	srv := httptest.NewServer(m)
+	t.Cleanup(srv.Close)
+	return m, srv
+}
+
+func (m *mockConsul) put(key, value string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = []byte(value)
+	m.index++
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+func (m *mockConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, ok := strings.CutPrefix(r.URL.Path, "/v1/kv/")
+	if !ok || r.Method != http.MethodGet || !r.URL.Query().Has("raw") {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if m.token != "" && r.Header.Get("X-Consul-Token") != m.token {
+		http.Error(w, "ACL not found", http.StatusForbidden)
+		return
+	}
+
+	m.mu.Lock()
+	if index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); index != 0 && index == m.index {
+		changed := m.changed
+		wait, err := time.ParseDuration(r.URL.Query().Get("wait"))
+		if err != nil {
+			m.mu.Unlock()
+			http.Error(w, "bad wait", http.StatusBadRequest)
+			return
+		}
+		m.mu.Unlock()
+		select {
+		case <-changed:
+		case <-time.After(wait):
+		case <-r.Context().Done():
+			return
+		}
+		m.mu.Lock()
+	}
+	value, found := m.values[key]
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(m.index, 10))
+	m.mu.Unlock()
+
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write(value)
+}
+
+// waitSignal 等待 ch 收到信号
+func waitSignal(t *testing.T, ch <-chan struct{}, msg string) {
+	t.Helper()
+	select {
+	case _, ok := <-ch:
+		if !ok {
+			t.Fatalf("%s: 通道已关闭", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal(msg)
+	}
+}
+
+// expectNoSignal 确认 ch 在短时间内没有信号
+func expectNoSignal(t *testing.T, ch <-chan struct{}, msg string) {
+	t.Helper()
+	select {
+	case <-ch:
+		t.Error(msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestConsulSource(t *testing.T) {
+	kv, srv := newMockConsul(t)
+	kv.token = "secret"
+	kv.put("fxdns/config", "version: 1\n")
+
+	src := NewConsulSource(strings.TrimPrefix(srv.URL, "http://"), "fxdns/config", "secret")
+	src.WaitTime = time.Second
+	src.RetryInterval = 10 * time.Millisecond
+	defer src.Close()
+
+	data, err := src.Read()
+	if err != nil || string(data) != "version: 1\n" {
+		t.Fatalf("Read 期望 version: 1, 实际 %q, %v", data, err)
+	}
+
+	changes, err := src.Watch()
+	if err != nil {
+		t.Fatalf("Watch 失败: %v", err)
+	}
+	// 阻塞查询超时返回时索引不变，不应发送信号
+	expectNoSignal(t, changes, "未修改时不应收到信号")
+
+	kv.put("fxdns/config", "version: 2\n")
+	waitSignal(t, changes, "修改后应收到信号")
+	if data, _ := src.Read(); string(data) != "version: 2\n" {
+		t.Errorf("修改后 Read 期望 version: 2, 实际 %q", data)
+	}
+
+	// Close 关闭通道，之后仍可重新 Watch
+	src.Close()
+	if _, ok := <-changes; ok {
+		t.Error("Close 后通道应被关闭")
+	}
+	changes, err = src.Watch()
+	if err != nil {
+		t.Fatalf("Close 后重新 Watch 失败: %v", err)
+	}
+	kv.put("fxdns/config", "version: 3\n")
+	waitSignal(t, changes, "重新 Watch 后修改应收到信号")
+}
+
+func TestConsulSourceErrors(t *testing.T) {
+	kv, srv := newMockConsul(t)
+	kv.token = "secret"
+	kv.put("fxdns/config", "version: 1\n")
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	if _, err := NewConsulSource(host, "fxdns/config", "wrong").Read(); err == nil {
+		t.Error("token 错误时 Read 应返回错误")
+	}
+	if _, err := NewConsulSource(host, "fxdns/missing", "secret").Read(); err == nil || !strings.Contains(err.Error(), ErrKeyNotFound.Error()) {
+		t.Errorf("键不存在时期望 ErrKeyNotFound, 实际 %v", err)
+	}
+}
@@ -0,0 +1,243 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// EtcdSource etcd v3 中的一个键，通过 etcd 的 HTTP/JSON 网关 (/v3/kv/range、/v3/watch) 读取与监听
+type EtcdSource struct {
+	// RetryInterval 监听出错后的重试间隔，为 0 时使用 DefaultRetryInterval
+	RetryInterval time.Duration
+
+	addr   string // http://host:port
+	key    string
+	client *http.Client
+
+	watchMu sync.Mutex
+	ctx     context.Context // 当前监听协程的上下文，Close 时取消并替换
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+
+	mu       sync.Mutex
+	revision int64 // 最近一次 Read 时集群的 revision，Watch 从其下一个 revision 开始
+}
+
+// NewEtcdSource 创建读取 etcd (host:port) 中 key 的配置来源
+func NewEtcdSource(hostport, key string) *EtcdSource {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &EtcdSource{
+		addr:   "http://" + hostport,
+		key:    key,
+		client: &http.Client{},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// etcdHeader 响应头，grpc-gateway 将 int64 编码为字符串
+type etcdHeader struct {
+	Revision int64 `json:"revision,string"`
+}
+
+type etcdKeyValue struct {
+	Value       []byte `json:"value"` // 网关以 base64 编码
+	ModRevision int64  `json:"mod_revision,string"`
+}
+
+type etcdRangeResponse struct {
+	Header etcdHeader     `json:"header"`
+	Kvs    []etcdKeyValue `json:"kvs"`
+}
+
+// etcdWatchMessage /v3/watch 流中的一条消息
+type etcdWatchMessage struct {
+	Result *struct {
+		Header   etcdHeader `json:"header"`
+		Canceled bool       `json:"canceled"`
+		// CompactRevision 起始 revision 已被压缩时 etcd 取消监听并返回压缩到的 revision
+		CompactRevision int64  `json:"compact_revision,string"`
+		CancelReason    string `json:"cancel_reason"`
+		Events          []struct {
+			Kv etcdKeyValue `json:"kv"`
+		} `json:"events"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// errWatchRestart 起始 revision 已被压缩，etcd 取消了监听，已改为从当前 revision 之后开始，无需等待重试间隔
+var errWatchRestart = errors.New("监听的起始 revision 已被 etcd 压缩")
+
+// Read 实现 ConfigSource
+func (s *EtcdSource) Read() ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := s.post(ctx, "/v3/kv/range", map[string]any{"key": []byte(s.key)})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var r etcdRangeResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxConfigSize*2)).Decode(&r); err != nil {
+		return nil, fmt.Errorf("解析 %s 的响应失败: %w", s, err)
+	}
+	s.mu.Lock()
+	s.revision = r.Header.Revision
+	s.mu.Unlock()
+	if len(r.Kvs) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, s)
+	}
+	return r.Kvs[0].Value, nil
+}
+
+// Watch 实现 ConfigSource，从上次 Read 之后的 revision 开始监听键的修改与删除。
+// 连接断开后从最后收到的 revision 之后重新监听，期间的修改不会丢失；
+// 起始 revision 已被压缩而被 etcd 取消时，发送一次变更信号由调用者重新 Read，并从当前 revision 之后重新监听
+func (s *EtcdSource) Watch() (<-chan struct{}, error) {
+	s.watchMu.Lock()
+	ctx := s.ctx
+	s.wg.Add(1)
+	s.watchMu.Unlock()
+	s.mu.Lock()
+	revision := s.revision
+	s.mu.Unlock()
+
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer s.wg.Done()
+		defer close(ch)
+		for ctx.Err() == nil {
+			err := s.watchStream(ctx, &revision, ch)
+			if ctx.Err() != nil {
+				return
+			}
+			if errors.Is(err, errWatchRestart) {
+				log.Printf("%v，从 revision %d 之后重新监听 %s", err, revision, s)
+				continue
+			}
+			log.Printf("监听 %s 中断，%v 后重试: %v", s, s.retryInterval(), err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(s.retryInterval()):
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// watchStream 建立一次监听流并处理其中的事件直到流结束，*revision 更新为最后处理的 revision
+func (s *EtcdSource) watchStream(ctx context.Context, revision *int64, ch chan struct{}) error {
+	create := map[string]any{"key": []byte(s.key)}
+	if *revision > 0 {
+		create["start_revision"] = *revision + 1
+	}
+	resp, err := s.post(ctx, "/v3/watch", map[string]any{"create_request": create})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg etcdWatchMessage
+		if err := dec.Decode(&msg); err != nil {
+			return fmt.Errorf("读取监听流失败: %w", err)
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("etcd 返回错误: %s", msg.Error.Message)
+		}
+		if msg.Result == nil {
+			continue
+		}
+		if msg.Result.Canceled {
+			// 被取消前的修改已无法通过监听取得：以当前 revision 为起点重新监听，并通知调用者重新读取
+			current, err := s.currentRevision(ctx)
+			if err != nil {
+				return fmt.Errorf("监听被 etcd 取消 (%s)，获取当前 revision 失败: %w", msg.Result.CancelReason, err)
+			}
+			*revision = current
+			notify(ch)
+			if msg.Result.CompactRevision > 0 {
+				return fmt.Errorf("%w (压缩到 %d)", errWatchRestart, msg.Result.CompactRevision)
+			}
+			return fmt.Errorf("监听被 etcd 取消: %s", msg.Result.CancelReason)
+		}
+		for _, ev := range msg.Result.Events {
+			*revision = max(*revision, ev.Kv.ModRevision)
+		}
+		if len(msg.Result.Events) > 0 {
+			notify(ch)
+		}
+	}
+}
+
+// currentRevision 返回集群当前的 revision
+func (s *EtcdSource) currentRevision(ctx context.Context) (int64, error) {
+	resp, err := s.post(ctx, "/v3/kv/range", map[string]any{"key": []byte(s.key), "count_only": true})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var r etcdRangeResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxConfigSize*2)).Decode(&r); err != nil {
+		return 0, fmt.Errorf("解析 %s 的响应失败: %w", s, err)
+	}
+	return r.Header.Revision, nil
+}
+
+// post 以 JSON 请求体调用网关接口，状态码不为 200 时返回错误
+func (s *EtcdSource) post(ctx context.Context, path string, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.addr+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求 %s 失败: %w", s, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("请求 %s%s 失败: 状态码 %d", s.addr, path, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+func (s *EtcdSource) retryInterval() time.Duration {
+	if s.RetryInterval > 0 {
+		return s.RetryInterval
+	}
+	return DefaultRetryInterval
+}
+
+// Close 停止所有 Watch 并关闭其通道，等待监听协程退出后返回。之后仍可再次 Watch
+func (s *EtcdSource) Close() error {
+	s.watchMu.Lock()
+	s.cancel()
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.watchMu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+// String 返回 etcd:// 形式的来源描述
+func (s *EtcdSource) String() string {
+	return "etcd://" + s.addr[len("http://"):] + "/" + s.key
+}
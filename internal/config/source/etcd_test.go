@@ -0,0 +1,242 @@
+package source
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockEtcd 模拟 etcd v3 HTTP/JSON 网关的 /v3/kv/range 与 /v3/watch 接口
+type mockEtcd struct {
+	mu        sync.Mutex
+	values    map[string][]byte
+	modRev    map[string]int64
+	revision  int64
+	changed   chan struct{}
+	watches   int   // 建立过的监听流数量
+	compacted int64 // 已压缩到的 revision，从此之前开始的监听被取消
+}
+
+func newMockEtcd(t *testing.T) (*mockEtcd, *httptest.Server) {
+	m := &mockEtcd{values: make(map[string][]byte), modRev: make(map[string]int64), revision: 1, changed: make(chan struct{})}
+	srv := httptest.NewServer(m)
+	t.Cleanup(srv.Close)
+	return m, srv
+}
+
+func (m *mockEtcd) put(key, value string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revision++
+	m.values[key] = []byte(value)
+	m.modRev[key] = m.revision
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+// compact 压缩到当前 revision
+func (m *mockEtcd) compact() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.compacted = m.revision
+}
+
+// waitWatches 等待已建立的监听流达到 n 个
+func (m *mockEtcd) waitWatches(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		m.mu.Lock()
+		watches := m.watches
+		m.mu.Unlock()
+		if watches >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("期望建立 %d 个监听流, 实际 %d", n, watches)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (m *mockEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		var req struct {
+			Key []byte `json:"key"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		resp := map[string]any{"header": map[string]any{"revision": fmt.Sprint(m.revision)}}
+		if value, ok := m.values[string(req.Key)]; ok {
+			resp["kvs"] = []map[string]any{{"key": req.Key, "value": value, "mod_revision": fmt.Sprint(m.modRev[string(req.Key)])}}
+		}
+		json.NewEncoder(w).Encode(resp)
+	case "/v3/watch":
+		var req struct {
+			CreateRequest struct {
+				Key           []byte `json:"key"`
+				StartRevision int64  `json:"start_revision"`
+			} `json:"create_request"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		key := string(req.CreateRequest.Key)
+		next := req.CreateRequest.StartRevision
+		enc := json.NewEncoder(w)
+		flusher := w.(http.Flusher)
+
+		m.mu.Lock()
+		m.watches++
+		if next == 0 {
+			next = m.revision + 1
+		}
+		compacted := m.compacted
+		m.mu.Unlock()
+		enc.Encode(map[string]any{"result": map[string]any{"created": true}})
+		flusher.Flush()
+		if next <= compacted {
+			enc.Encode(map[string]any{"result": map[string]any{
+				"canceled":         true,
+				"compact_revision": fmt.Sprint(compacted),
+				"cancel_reason":    "mvcc: required revision has been compacted",
+			}})
+			flusher.Flush()
+			return
+		}
+		for {
+			m.mu.Lock()
+			changed := m.changed
+			var events []map[string]any
+			if rev := m.modRev[key]; rev >= next {
+				events = append(events, map[string]any{"kv": map[string]any{"key": req.CreateRequest.Key, "mod_revision": fmt.Sprint(rev)}})
+				next = rev + 1
+			}
+			m.mu.Unlock()
+			if len(events) > 0 {
+				enc.Encode(map[string]any{"result": map[string]any{"events": events}})
+				flusher.Flush()
+			}
+			select {
+			case <-changed:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestEtcdSource(t *testing.T) {
+	kv, srv := newMockEtcd(t)
+	kv.put("/fxdns/config", "version: 1\n")
+
+	src := NewEtcdSource(strings.TrimPrefix(srv.URL, "http://"), "/fxdns/config")
+	src.RetryInterval = 10 * time.Millisecond
+	defer src.Close()
+
+	data, err := src.Read()
+	if err != nil || string(data) != "version: 1\n" {
+		t.Fatalf("Read 期望 version: 1, 实际 %q, %v", data, err)
+	}
+
+	// Read 之后、Watch 之前的修改也应被监听到
+	kv.put("/fxdns/config", "version: 2\n")
+	changes, err := src.Watch()
+	if err != nil {
+		t.Fatalf("Watch 失败: %v", err)
+	}
+	waitSignal(t, changes, "Read 之后的修改应收到信号")
+
+	kv.put("/fxdns/other", "x")
+	expectNoSignal(t, changes, "其他键的修改不应发送信号")
+
+	kv.put("/fxdns/config", "version: 3\n")
+	waitSignal(t, changes, "修改后应收到信号")
+	if data, _ := src.Read(); string(data) != "version: 3\n" {
+		t.Errorf("修改后 Read 期望 version: 3, 实际 %q", data)
+	}
+
+	src.Close()
+	if _, ok := <-changes; ok {
+		t.Error("Close 后通道应被关闭")
+	}
+}
+
+func TestEtcdSourceReconnect(t *testing.T) {
+	kv, srv := newMockEtcd(t)
+	kv.put("fxdns/config", "version: 1\n")
+
+	src := NewEtcdSource(strings.TrimPrefix(srv.URL, "http://"), "fxdns/config")
+	src.RetryInterval = 10 * time.Millisecond
+	defer src.Close()
+	if _, err := src.Read(); err != nil {
+		t.Fatalf("Read 失败: %v", err)
+	}
+	changes, err := src.Watch()
+	if err != nil {
+		t.Fatalf("Watch 失败: %v", err)
+	}
+
+	// 断开监听流，期间的修改在重新连接后补发
+	kv.waitWatches(t, 1)
+	srv.CloseClientConnections()
+	kv.put("fxdns/config", "version: 2\n")
+	waitSignal(t, changes, "重新连接后应收到断开期间的修改")
+	kv.waitWatches(t, 2)
+}
+
+func TestEtcdSourceCompacted(t *testing.T) {
+	kv, srv := newMockEtcd(t)
+	kv.put("fxdns/config", "version: 1\n")
+
+	src := NewEtcdSource(strings.TrimPrefix(srv.URL, "http://"), "fxdns/config")
+	src.RetryInterval = time.Hour // 压缩后应立即重新监听，不等待重试间隔
+	defer src.Close()
+	if _, err := src.Read(); err != nil {
+		t.Fatalf("Read 失败: %v", err)
+	}
+
+	// Read 之后的修改在 Watch 之前已被压缩，监听会被 etcd 取消
+	kv.put("fxdns/config", "version: 2\n")
+	kv.compact()
+	changes, err := src.Watch()
+	if err != nil {
+		t.Fatalf("Watch 失败: %v", err)
+	}
+	waitSignal(t, changes, "监听因压缩被取消时应发送信号以便重新读取")
+	if data, _ := src.Read(); string(data) != "version: 2\n" {
+		t.Errorf("重新读取期望 version: 2, 实际 %q", data)
+	}
+
+	// 从当前 revision 之后重新监听，之后的修改照常收到，且不再反复以旧 revision 重试
+	kv.waitWatches(t, 2)
+	kv.put("fxdns/config", "version: 3\n")
+	waitSignal(t, changes, "重新监听后应收到新的修改")
+	kv.mu.Lock()
+	watches := kv.watches
+	kv.mu.Unlock()
+	if watches != 2 {
+		t.Errorf("压缩后应只重新监听一次, 实际建立 %d 个监听流", watches)
+	}
+}
+
+func TestEtcdSourceKeyNotFound(t *testing.T) {
+	_, srv := newMockEtcd(t)
+	_, err := NewEtcdSource(strings.TrimPrefix(srv.URL, "http://"), "missing").Read()
+	if err == nil || !strings.Contains(err.Error(), ErrKeyNotFound.Error()) {
+		t.Errorf("键不存在时期望 ErrKeyNotFound, 实际 %v", err)
+	}
+}
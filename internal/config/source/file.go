@@ -0,0 +1,82 @@
+package source
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// FileSource 本地配置文件
+type FileSource struct {
+	// Path 配置文件路径
+	Path string
+
+	mu       sync.Mutex
+	watchers []*fsnotify.Watcher
+}
+
+// NewFileSource 创建读取 path 的配置来源
+func NewFileSource(path string) *FileSource {
+	return &FileSource{Path: path}
+}
+
+// Read 实现 ConfigSource
+func (s *FileSource) Read() ([]byte, error) {
+	return os.ReadFile(s.Path)
+}
+
+// Watch 实现 ConfigSource，以 fsnotify 监听文件所在目录，文件被写入或重新创建时发送信号
+func (s *FileSource) Watch() (<-chan struct{}, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("创建 fsnotify watcher 失败: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(s.Path)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("监听目录 %s 失败: %w", filepath.Dir(s.Path), err)
+	}
+	s.mu.Lock()
+	s.watchers = append(s.watchers, watcher)
+	s.mu.Unlock()
+
+	ch := make(chan struct{}, 1)
+	path := filepath.Clean(s.Path)
+	go func() {
+		defer close(ch)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == path && event.Has(fsnotify.Write|fsnotify.Create) {
+					notify(ch)
+				}
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Close 停止所有 Watch 并关闭其通道
+func (s *FileSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.watchers {
+		w.Close()
+	}
+	s.watchers = nil
+	return nil
+}
+
+// String 返回 file:// 形式的来源描述
+func (s *FileSource) String() string {
+	return "file://" + s.Path
+}
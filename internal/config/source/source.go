@@ -0,0 +1,79 @@
+// Package source 提供配置内容的来源：本地文件、Consul KV 与 etcd，供 config.ConfigManager 读取与监听配置
+package source
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ConfigSource 配置内容的来源
+type ConfigSource interface {
+	// Read 读取完整的配置内容 (YAML)
+	Read() ([]byte, error)
+	// Watch 开始监听配置变化，内容可能已变化时向返回的通道发送一个信号。
+	// 通道带一个缓冲，接收方处理缓慢时连续的变化合并为一个信号；实现了 io.Closer 的来源在 Close 后关闭通道
+	Watch() (<-chan struct{}, error)
+}
+
+// DefaultRetryInterval 远程来源监听出错后重新连接前的等待时间
+const DefaultRetryInterval = 5 * time.Second
+
+// 远程来源未指定端口时使用的默认端口
+const (
+	DefaultConsulPort = "8500"
+	DefaultEtcdPort   = "2379"
+)
+
+// Parse 根据 URI 创建配置来源：
+//
+//	file:///etc/fxdns/config.yaml 或不带 scheme 的路径  本地文件
+//	consul://host[:port]/key                            Consul KV，key 为去掉开头 / 的路径，?token= 指定 ACL token
+//	etcd://host[:port]/key                              etcd v3 (HTTP/JSON 网关)，key 为去掉开头 / 的路径
+func Parse(uri string) (ConfigSource, error) {
+	if path, ok := strings.CutPrefix(uri, "file://"); ok {
+		return NewFileSource(path), nil
+	}
+	if !strings.Contains(uri, "://") {
+		return NewFileSource(uri), nil
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("无效的配置来源 %s: %w", uri, err)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, fmt.Errorf("配置来源 %s 应为 %s://host[:port]/key 形式", uri, u.Scheme)
+	}
+	switch u.Scheme {
+	case "consul":
+		token := u.Query().Get("token")
+		if token == "" {
+			token = os.Getenv("CONSUL_HTTP_TOKEN")
+		}
+		return NewConsulSource(withDefaultPort(u.Host, DefaultConsulPort), key, token), nil
+	case "etcd":
+		return NewEtcdSource(withDefaultPort(u.Host, DefaultEtcdPort), key), nil
+	}
+	return nil, fmt.Errorf("不支持的配置来源 %s，应为 file://、consul:// 或 etcd://", uri)
+}
+
+// withDefaultPort 为不带端口的 host 补上默认端口
+func withDefaultPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
+
+// notify 非阻塞地向 ch 发送一个信号，已有未取走的信号时丢弃
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
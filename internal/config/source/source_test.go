@@ -0,0 +1,81 @@
+package source
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	t.Setenv("CONSUL_HTTP_TOKEN", "env-token")
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{"config/config.yaml", "file://config/config.yaml"},
+		{"file:///etc/fxdns/config.yaml", "file:///etc/fxdns/config.yaml"},
+		{"consul://consul.local/fxdns/config", "consul://consul.local:8500/fxdns/config"},
+		{"consul://10.0.0.1:8501/fxdns/config?token=abc", "consul://10.0.0.1:8501/fxdns/config"},
+		{"etcd://etcd.local/fxdns/config", "etcd://etcd.local:2379/fxdns/config"},
+		{"etcd://[::1]:2380//fxdns/config", "etcd://[::1]:2380//fxdns/config"},
+	}
+	for _, tt := range tests {
+		src, err := Parse(tt.uri)
+		if err != nil {
+			t.Errorf("Parse(%q) 失败: %v", tt.uri, err)
+			continue
+		}
+		if got := src.(interface{ String() string }).String(); got != tt.want {
+			t.Errorf("Parse(%q) 期望 %s, 实际 %s", tt.uri, tt.want, got)
+		}
+	}
+
+	if src, _ := Parse("consul://consul.local/fxdns/config?token=abc"); src.(*ConsulSource).token != "abc" {
+		t.Error("URI 中的 token 应优先于环境变量")
+	}
+	if src, _ := Parse("consul://consul.local/fxdns/config"); src.(*ConsulSource).token != "env-token" {
+		t.Error("URI 未指定 token 时应使用 CONSUL_HTTP_TOKEN")
+	}
+
+	for _, uri := range []string{"redis://localhost/key", "consul://localhost", "etcd:///key", "consul://%zz/key"} {
+		if _, err := Parse(uri); err == nil {
+			t.Errorf("Parse(%q) 应返回错误", uri)
+		}
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("version: 1\n"), 0644); err != nil {
+		t.Fatalf("创建测试文件失败: %v", err)
+	}
+	src := NewFileSource(path)
+	defer src.Close()
+
+	if data, err := src.Read(); err != nil || string(data) != "version: 1\n" {
+		t.Fatalf("Read 期望 version: 1, 实际 %q, %v", data, err)
+	}
+	changes, err := src.Watch()
+	if err != nil {
+		t.Fatalf("Watch 失败: %v", err)
+	}
+
+	if err := os.WriteFile(path+".swp", []byte("x"), 0644); err != nil {
+		t.Fatalf("写入无关文件失败: %v", err)
+	}
+	select {
+	case <-changes:
+		t.Error("同目录下无关文件的变化不应发送信号")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(path, []byte("version: 2\n"), 0644); err != nil {
+		t.Fatalf("更新测试文件失败: %v", err)
+	}
+	waitSignal(t, changes, "文件修改后应收到信号")
+
+	src.Close()
+	for range changes {
+	}
+}
@@ -0,0 +1,410 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// GenerateDefault 返回一份带有合理默认值的配置
+func GenerateDefault() *Config {
+	return &Config{
+		ConfigVersion: CurrentConfigVersion,
+		Upstream: UpstreamConfig{
+			Server:               "8.8.8.8:53",
+			Timeout:              5 * time.Second,
+			FallbackTrigger:      FallbackTriggerCDNMiss,
+			ECSSourcePrefixLenV4: intPtr(DefaultECSPrefixLenV4),
+			ECSSourcePrefixLenV6: intPtr(DefaultECSPrefixLenV6),
+			UserAgent:            "fxdns/1.0",
+			Protocol:             UpstreamProtocolDNS,
+			CircuitBreaker: CircuitBreakerConfig{
+				Window:       DefaultCircuitBreakerWindow,
+				OpenDuration: DefaultCircuitBreakerOpenDuration,
+			},
+			Servers: []string{},
+		},
+		Server: ServerConfig{
+			Listen:    ":53",
+			Workers:   10,
+			CacheSize: 1000,
+			CacheTTL:  60 * time.Second,
+			Network:   NetworkUDP,
+
+			ResponseCacheNegativeDomains: []string{},
+			NegativeTTL:                  300 * time.Second,
+			RecentQueriesSize:            DefaultRecentQueriesSize,
+			MigrationGracePeriod:         DefaultMigrationGracePeriod,
+			StaleTTL:                     DefaultStaleTTL,
+			AnyQueryPolicy:               AnyQueryPolicyPassthrough,
+			DNSBLZones:                   []string{},
+			InternalDomains:              []string{},
+			RPZZones:                     []string{},
+			DoHPaddingBlockSize:          DefaultDoHPaddingBlockSize,
+		},
+		// 文档保留网段 (RFC 5737)，请替换为实际的 CDN 节点网段
+		CDNIPs:  []string{"192.0.2.0/24"},
+		Domains: []DomainRule{},
+		SplitHorizon: SplitHorizonConfig{
+			Subnets: map[string]string{},
+		},
+		Cache: CacheConfig{
+			EvictionPolicy: CacheEvictionLRU,
+		},
+		CacheWarm: CacheWarmConfig{
+			Domains:     []string{},
+			Concurrency: DefaultCacheWarmConcurrency,
+		},
+	}
+}
+
+// defaultConfigTemplate 带完整注释的配置文件模板，字段值由 GenerateDefault 的结果填充
+var defaultConfigTemplate = template.Must(template.New("config").Parse(`# fxDns 配置文件
+# 由 fxdns -generate-config 生成，所有字段均已列出并附带类型与默认值说明
+
+# string, 可选: 配置格式版本，未设置时视为 1，旧版本的配置在加载时自动迁移到当前版本
+config_version: "{{ .ConfigVersion }}"
+
+# 上游 DNS 服务器配置
+upstream:
+  # string, 必填 (protocol 为 json-doh 时可选): 主上游 DNS 服务器地址 (IP:端口)，以 https:// 开头时使用 DNS-over-HTTPS
+  server: "{{ .Upstream.Server }}"
+  # string, 可选: 主上游协议 dns / json-doh，json-doh 时通过 JSON API 查询 json_doh_url
+  protocol: "{{ .Upstream.Protocol }}"
+  # string, 可选: JSON API 地址 (Google / Cloudflare 格式)，protocol 为 json-doh 时必填
+  json_doh_url: "{{ .Upstream.JSONDoHURL }}"
+  # string, 可选: 签名 UDP DNS 上游查询的 TSIG 密钥名，为空时不签名
+  tsig_key_name: "{{ .Upstream.TSIGKeyName }}"
+  # string, 可选: TSIG 算法 hmac-sha1 / hmac-sha224 / hmac-sha256 / hmac-sha384 / hmac-sha512
+  tsig_algorithm: "{{ .Upstream.TSIGAlgorithm }}"
+  # string, 可选: base64 编码的 TSIG 密钥，配置了 tsig_key_name 时必填
+  tsig_secret: "{{ .Upstream.TSIGSecret }}"
+  # string, 可选: 备用上游 DNS 服务器地址，为空时不回退
+  fallback_server: "{{ .Upstream.FallbackServer }}"
+  # string, 可选: 备用上游触发条件 cdn_miss / nxdomain / error / always
+  fallback_trigger: "{{ .Upstream.FallbackTrigger }}"
+  # bool, 可选: 主上游没有返回任何 A/AAAA 时，不做校验且不回退
+  no_record_no_fallback: {{ .Upstream.NoRecordNoFallback }}
+  # duration, 可选: 上游查询超时时间
+  timeout: {{ .Upstream.Timeout }}
+  # bool, 可选: 在发往上游的查询中注入客户端子网 (EDNS Client Subnet)
+  inject_ecs: {{ .Upstream.InjectECS }}
+  # int, 可选: 注入 ECS 时使用的 IPv4 / IPv6 源前缀长度，0 表示不向上游透露客户端子网
+  ecs_source_prefix_len_v4: {{ .Upstream.ECSPrefixLenV4 }}
+  ecs_source_prefix_len_v6: {{ .Upstream.ECSPrefixLenV6 }}
+  # string, 可选: 上游为 DoH (https://) 时 HTTP 请求使用的 User-Agent
+  user_agent: "{{ .Upstream.UserAgent }}"
+  # bool, 可选: 在发往上游的查询中设置 CD (Checking Disabled) 位
+  cd_bit: {{ .Upstream.CDBit }}
+  # bool, 可选: 并行查询主上游与备用上游，合并去重后的应答再做 CDN 检测与过滤
+  merge_responses: {{ .Upstream.MergeResponses }}
+  # bool, 可选: 检查主上游响应 (问题段、RCODE、TTL、无效 IP)，未通过时改用备用上游
+  validate_responses: {{ .Upstream.ValidateResponses }}
+  # bool, 可选: 检查上游响应的 ID、问题段与应答段是否对应查询，不对应时换用新的查询 ID 重试
+  strict_validation: {{ .Upstream.StrictValidation }}
+  # int, 可选: DoH 上游 HTTP 客户端保留的最大空闲连接数，0 表示使用默认值
+  max_idle_conns: {{ .Upstream.MaxIdleConns }}
+  # int, 可选: DoH 上游每个主机的最大连接数，0 表示不限制
+  max_conns_per_host: {{ .Upstream.MaxConnsPerHost }}
+  # duration, 可选: DoH 上游空闲连接的保留时间，0s 表示使用默认值
+  idle_conn_timeout: {{ .Upstream.IdleConnTimeout }}
+  # string, 可选: DoH 上游请求经由的 HTTP 代理地址 (http:// 或 https://)，为空时按 HTTPS_PROXY 等环境变量决定
+  http_proxy: "{{ .Upstream.HTTPProxy }}"
+  # string, 可选: 代理 Basic 认证的用户名与密码，用户名为空时不认证
+  http_proxy_user: "{{ .Upstream.HTTPProxyUser }}"
+  http_proxy_password: "{{ .Upstream.HTTPProxyPassword }}"
+  # 可选: 主上游熔断，window 内连续失败 failure_threshold 次后 open_duration 内不再查询主上游
+  circuit_breaker:
+    # int, 可选: 触发熔断的连续失败次数，0 表示不启用
+    failure_threshold: {{ .Upstream.CircuitBreaker.FailureThreshold }}
+    # duration, 可选: 统计连续失败的时间窗口
+    window: {{ .Upstream.CircuitBreaker.Window }}
+    # duration, 可选: 熔断打开的时长，结束后放行一个探测查询
+    open_duration: {{ .Upstream.CircuitBreaker.OpenDuration }}
+  # list, 可选: 与 server 并列的其他主上游，load_balance 为 latency 时参与选择
+  servers: [{{ range $i, $d := .Upstream.Servers }}{{ if $i }}, {{ end }}"{{ $d }}"{{ end }}]
+  # string, 可选: 主上游选择方式，为空时总是使用 server；latency 选择 RTT 的 EWMA 最低的上游
+  load_balance: "{{ .Upstream.LoadBalance }}"
+
+# 服务配置
+server:
+  # string, 必填: 监听地址 (IP:端口)
+  listen: "{{ .Server.Listen }}"
+  # string, 可选: TCP 监听地址，仅 network 为 udp 时生效，为空或与 listen 相同时不单独监听 TCP
+  listen_tcp: "{{ .Server.ListenTCP }}"
+  # string, 可选: 监听协议 udp / tcp / doq
+  network: "{{ .Server.Network }}"
+  # int, 必填: 工作协程数量，必须大于 0
+  workers: {{ .Server.Workers }}
+  # int, 可选: 同时处理 (包括等待工作协程) 的查询数上限，超出的查询返回 REFUSED，0 表示不限制，支持热加载
+  max_concurrent_queries: {{ .Server.MaxConcurrentQueries }}
+  # int, 可选: DNS 缓存条目数
+  cache_size: {{ .Server.CacheSize }}
+  # duration, 可选: DNS 缓存有效期
+  cache_ttl: {{ .Server.CacheTTL }}
+  # []string, 可选: 匹配这些域名模式的 NXDOMAIN 响应按 negative_ttl 缓存
+  response_cache_negative_domains: [{{ range $i, $d := .Server.ResponseCacheNegativeDomains }}{{ if $i }}, {{ end }}"{{ $d }}"{{ end }}]
+  # duration, 可选: NXDOMAIN 响应缓存有效期，0 表示沿用 cache_ttl；上游响应带有 SOA 时不超过其 MINIMUM
+  negative_ttl: {{ .Server.NegativeTTL }}
+  # float, 可选: 缓存有效期随机调整的比例，如 0.1 表示 ±10%，0 表示不调整
+  ttl_jitter_factor: {{ .Server.TTLJitterFactor }}
+  # bool, 可选: 缓存过期后 stale_ttl 内仍立即返回过期响应，同时在后台刷新
+  stale_while_revalidate: {{ .Server.StaleWhileRevalidate }}
+  # duration, 可选: 过期响应的保留时长，0 表示使用默认值 1h
+  stale_ttl: {{ .Server.StaleTTL }}
+  # string, 可选: 管理 HTTP 服务监听地址，为空时不启动
+  admin_listen: "{{ .Server.AdminListen }}"
+  # int, 可选: 管理接口 /queries/recent 保留的最近查询条数
+  recent_queries_size: {{ .Server.RecentQueriesSize }}
+  # duration, 可选: listen 变更后旧监听继续服务的时长，期间新旧地址同时可用
+  migration_grace_period: {{ .Server.MigrationGracePeriod }}
+  # string, 可选: 对 version.bind / hostname.bind (CHAOS TXT) 查询的本地应答，refuse 表示返回 REFUSED，为空时转发上游
+  chaos_version: "{{ .Server.ChaosVersion }}"
+  chaos_hostname: "{{ .Server.ChaosHostname }}"
+  # string, 可选: ANY 查询的处理方式 passthrough / refuse / hinfo / empty
+  any_query_policy: "{{ .Server.AnyQueryPolicy }}"
+  # string, 可选: NAT64 前缀 (如 64:ff9b::/96)，非空时为没有 AAAA 记录的域名由 A 记录合成 AAAA (DNS64)
+  dns64_prefix: "{{ .Server.DNS64Prefix }}"
+  # string, 可选: DNS UPDATE (RFC 2136) 消息的转发地址 (host:port)，为空时对 UPDATE 返回 REFUSED
+  forward_updates_to: "{{ .Server.ForwardUpdatesTo }}"
+  # string, 可选: 校验客户端 DNS UPDATE 的 TSIG 签名并以同一密钥重新签名转发时使用的密钥名，为空时带签名的 UPDATE 返回 NOTAUTH
+  update_tsig_key_name: "{{ .Server.UpdateTSIGKeyName }}"
+  # string, 可选: UPDATE TSIG 签名算法，默认 hmac-sha256
+  update_tsig_algorithm: "{{ .Server.UpdateTSIGAlgorithm }}"
+  # string, 可选: base64 编码的 UPDATE TSIG 密钥，配置了 update_tsig_key_name 时必填
+  update_tsig_secret: "{{ .Server.UpdateTSIGSecret }}"
+  # []string, 可选: DNSBL 区域模式，<反向 IP>.<区域> 形式的查询命中时返回 127.0.0.2 (已列入)
+  dnsbl_zones: [{{ range $i, $d := .Server.DNSBLZones }}{{ if $i }}, {{ end }}"{{ $d }}"{{ end }}]
+  # bool, 可选: 防 DNS 重绑定，不在 internal_domains 中的域名的应答去掉私有、链路本地与回环地址
+  rebinding_protection: {{ .Server.RebindingProtection }}
+  # []string, 可选: 允许解析到内网地址的域名模式，仅 rebinding_protection 开启时生效
+  internal_domains: [{{ range $i, $d := .Server.InternalDomains }}{{ if $i }}, {{ end }}"{{ $d }}"{{ end }}]
+  # bool, 可选: 去掉响应附加段中除 OPT 以外的记录 (胶水记录等)，可被域名规则的 strip_additional 覆盖
+  global_strip_additional: {{ .Server.GlobalStripAdditional }}
+  # []string, 可选: 生效的 RPZ 区域名，按优先级从高到低排列
+  rpz_zones: [{{ range $i, $d := .Server.RPZZones }}{{ if $i }}, {{ end }}"{{ $d }}"{{ end }}]
+  # string, 可选: 主文件格式的 RPZ 数据文件，配置了 rpz_zones 时必填
+  rpz_file: "{{ .Server.RPZFile }}"
+  # string, 可选: DNS-over-TLS 监听地址，为空时不启动
+  dot_listen: "{{ .Server.DoTListen }}"
+  # string, 可选: DNS-over-HTTPS 监听地址 (路径 /dns-query)，为空时不启动；未配置证书时使用明文 HTTP
+  doh_listen: "{{ .Server.DoHListen }}"
+  # bool, 可选: 用 EDNS0 Padding 将 DoH 响应填充到 doh_padding_block_size 的整数倍，避免响应长度暴露记录数量
+  doh_response_padding: {{ .Server.DoHResponsePadding }}
+  # int, 可选: DoH 响应填充的块大小 (字节)
+  doh_padding_block_size: {{ .Server.DoHPaddingBlockSize }}
+  # string, 可选: 加密传输使用的证书与私钥路径，network 为 doq 或配置了 dot_listen 时必填
+  tls_cert: "{{ .Server.TLSCert }}"
+  tls_key: "{{ .Server.TLSKey }}"
+  # int, 可选: UDP 套接字收发缓冲区大小 (字节)，0 表示使用系统默认值
+  read_buffer_size: {{ .Server.ReadBufferSize }}
+  write_buffer_size: {{ .Server.WriteBufferSize }}
+
+# []string, 必填: CDN 节点 IP 列表 (CIDR 格式)
+cdn_ips:
+{{- range .CDNIPs }}
+  - "{{ . }}"
+{{- end }}
+
+# 可选: 分区解析 (split-horizon)，按客户端子网选择主上游
+split_horizon:
+  # map[string]string, 客户端 CIDR → 上游 DNS 服务器地址，网段重叠时使用前缀最长的一个
+  # 示例:
+  #   "192.168.0.0/16": "192.168.1.53:53"
+{{- if .SplitHorizon.Subnets }}
+  subnets:
+{{- range $cidr, $upstream := .SplitHorizon.Subnets }}
+    "{{ $cidr }}": "{{ $upstream }}"
+{{- end }}
+{{- else }}
+  subnets: {}
+{{- end }}
+
+# 可选: 响应缓存
+cache:
+  # string, 缓存已满时的淘汰策略 lru / lfu / random，默认 lru
+  eviction_policy: "{{ .Cache.EvictionPolicy }}"
+
+# 可选: 启动时的缓存预热
+cache_warm:
+  # []string, 启动时预先查询 (A 记录) 并缓存的域名
+  domains: [{{ range $i, $d := .CacheWarm.Domains }}{{ if $i }}, {{ end }}"{{ $d }}"{{ end }}]
+  # int, 预热并发数
+  concurrency: {{ .CacheWarm.Concurrency }}
+
+# 可选: 管理服务 /metrics 接口的访问控制
+metrics:
+  # string, 可选: 非空时抓取 /metrics 需携带 Authorization: Bearer <token>
+  auth_token: "{{ .Metrics.AuthToken }}"
+  # string, 可选: StatsD 服务地址 (host:port)，非空时通过 UDP 发送 fxdns.* 指标
+  statsd_address: "{{ .Metrics.StatsDAddress }}"
+
+# 可选: 查询处理过程的链路追踪
+observability:
+  # string, 可选: OTLP/HTTP 追踪数据接收地址 (如 http://127.0.0.1:4318)，非空时为每个查询记录 OpenTelemetry 追踪
+  otel_endpoint: "{{ .Observability.OTelEndpoint }}"
+
+# 可选: 配置文件热加载方式
+config:
+  # duration, 可选: 大于 0 时按此间隔轮询配置文件，代替 fsnotify 监控 (适用于 NFS 等环境)
+  poll_interval: {{ .ConfigFile.PollInterval }}
+  # string, 可选: 热加载替换配置前将原配置备份到此目录，为空时不备份
+  backup_dir: "{{ .ConfigFile.BackupDir }}"
+  # int, 可选: 保留的备份数量，超出时删除最旧的备份，0 表示全部保留
+  max_backups: {{ .ConfigFile.MaxBackups }}
+
+# []rule, 可选: 域名处理规则
+# 每条规则支持以下字段:
+#   pattern: string, 域名模式，支持泛域名 (*.example.com) 与正则表达式 (re:^mail\..*$)
+#   strategy: string, filter_non_cdn / return_cdn_a / none
+#   ttl: int, 返回给客户端的 TTL (秒)
+#   weight: int, return_cdn_a 策略下每个客户端返回的 CDN IP 数量，0 表示全部
+#   min_cdnips: int, 至少检测到多少个 CDN IP 才视为命中 CDN，默认 1；不足时按未发现 CDN IP 处理
+#   response_ttl_multiplier: float, 返回记录的 TTL 乘以此系数 (如 0.5 减半)，默认 1.0
+#   min_ttl / max_ttl: int, 按系数调整后 TTL 的上下限 (秒)，0 表示不限制
+#   force_a_only: bool, AAAA 查询直接返回空的 NOERROR 响应，不转发上游
+#   max_response_ips: int, 通过 UDP 返回的 A/AAAA 记录数上限，优先保留 CDN IP，截断时设置 TC 位；0 表示不限制
+#   normalize_response: bool, 去掉上游应答中重复的 A/AAAA 与 CNAME 记录，保持原有顺序
+#   upstream_timeout: duration, 该域名主备上游查询的超时时间，0 表示使用 upstream.timeout
+#   strip_additional: bool, 去掉响应附加段中除 OPT 以外的记录，覆盖全局的 global_strip_additional
+#   enforce_single_cname: bool, CNAME 链超过一层时返回 SERVFAIL
+#   cdn_cidr_override: []string, 该域名使用的 CDN 网段，非空时代替全局的 cdn_ips
+#   qtype_filter: []string, 规则只对这些查询类型 (如 ["A", "AAAA"]) 生效，其他类型原样返回上游响应；为空时对所有类型生效
+#   modify_expr: string, expr 表达式，返回改写后的 A/AAAA 地址列表，可用变量 domain / ips / cdnIPs / ttl / cname_chain
+#   cdn_response_order: string, CDN IP 的排列顺序：original(默认) / client_ip_sorted / random / latency_sorted，非 CDN IP 位置不变
+#   cdn_latency_probe: bool, 允许服务器主动 TCP 连接 CDN IP 的 443 端口测量 RTT，latency_sorted 必须开启
+#   verify_cdnip_ownership: bool, 检测到 CDN IP 后经备用上游反查 PTR 记录，名称不匹配 cdn_ownership_pattern 的 IP 不视为 CDN IP
+#   cdn_ownership_pattern: string, CDN IP 的 PTR 名称应匹配的域名模式 (语法同 pattern)，开启 verify_cdnip_ownership 时必填
+#   synthetic_soa: object, fallback_strategy 为 nxdomain 时 NXDOMAIN 响应附带的 SOA (mname / rname / serial / refresh / retry / expire / minimum，均可选)
+#   strip_cname_when_no_record: bool, 无 A/AAAA 时剔除对应 CNAME
+#   no_record_no_fallback: bool, 覆盖全局的 no_record_no_fallback
+#   tags: []string, 规则标签，仅用于分类查询
+# 示例:
+#   - pattern: "*.example.com"
+#     strategy: "filter_non_cdn"
+#     ttl: 300
+#     min_cdnips: 2
+{{- if .Domains }}
+domains:
+{{- range .Domains }}
+  - pattern: "{{ .Pattern }}"
+    strategy: "{{ .Strategy }}"
+    ttl: {{ .TTL }}
+{{- end }}
+{{- else }}
+domains: []
+{{- end }}
+`))
+
+// RenderDefaultConfig 使用模板渲染带注释的默认配置文件内容
+func RenderDefaultConfig() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := defaultConfigTemplate.Execute(&buf, GenerateDefault()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteDefaultConfigFile 将带注释的默认配置写入指定路径，目标文件已存在时返回错误
+func WriteDefaultConfigFile(path string) error {
+	data, err := RenderDefaultConfig()
+	if err != nil {
+		return fmt.Errorf("渲染默认配置失败: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// resolvConfPath 系统 DNS 解析配置文件路径
+const resolvConfPath = "/etc/resolv.conf"
+
+// MinimalConfigValues 精简配置模板中由运行时决定的取值
+type MinimalConfigValues struct {
+	Upstream string // 主上游 DNS 服务器地址
+	Listen   string // 监听地址
+	CDNIP    string // 示例 CDN 网段
+}
+
+// minimalConfigTemplate 只包含必填字段的精简配置模板，其余字段使用程序内置默认值
+var minimalConfigTemplate = template.Must(template.New("minimal").Parse(`# fxDns 精简配置，由 fxdns -print-default-config 生成
+# 完整的字段说明请使用 fxdns -generate-config 生成
+config_version: "` + CurrentConfigVersion + `"
+
+upstream:
+  server: "{{ .Upstream }}"
+  timeout: 5s
+
+server:
+  listen: "{{ .Listen }}"
+  workers: 10
+  cache_size: 1000
+  cache_ttl: 60s
+
+# 请替换为实际的 CDN 节点网段
+cdn_ips:
+  - "{{ .CDNIP }}"
+
+domains: []
+`))
+
+// DefaultMinimalConfigValues 返回精简配置的默认取值。
+// 上游优先使用系统 resolv.conf 中的 nameserver，找不到可用地址时使用 GenerateDefault 中的默认上游。
+func DefaultMinimalConfigValues() MinimalConfigValues {
+	def := GenerateDefault()
+	values := MinimalConfigValues{
+		Upstream: def.Upstream.Server,
+		Listen:   def.Server.Listen,
+		CDNIP:    def.CDNIPs[0],
+	}
+	if resolver := SystemResolver(resolvConfPath); resolver != "" {
+		values.Upstream = resolver
+	}
+	return values
+}
+
+// SystemResolver 返回 resolv.conf 中第一个非回环的 nameserver（IP:53 形式），读取失败或没有可用地址时返回空字符串。
+// 回环地址会被跳过，因为 fxdns 通常就监听在本机 53 端口，使用它作为上游会形成查询环路。
+func SystemResolver(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		// 去掉 IPv6 链路本地地址的 zone 后再解析
+		ip := net.ParseIP(strings.SplitN(fields[1], "%", 2)[0])
+		if ip == nil || ip.IsLoopback() {
+			continue
+		}
+		return net.JoinHostPort(fields[1], "53")
+	}
+	return ""
+}
+
+// RenderMinimalConfig 使用给定取值渲染精简配置
+func RenderMinimalConfig(values MinimalConfigValues) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := minimalConfigTemplate.Execute(&buf, values); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
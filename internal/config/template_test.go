@@ -0,0 +1,80 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteDefaultConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := WriteDefaultConfigFile(path); err != nil {
+		t.Fatalf("写入默认配置失败: %v", err)
+	}
+
+	// 生成的配置文件必须能通过加载和校验
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("生成的默认配置无效: %v", err)
+	}
+
+	def := GenerateDefault()
+	if !reflect.DeepEqual(cfg.Upstream, def.Upstream) {
+		t.Errorf("上游配置与默认值不一致, 期望: %+v, 实际: %+v", def.Upstream, cfg.Upstream)
+	}
+	if !reflect.DeepEqual(cfg.Server, def.Server) {
+		t.Errorf("服务配置与默认值不一致, 期望: %+v, 实际: %+v", def.Server, cfg.Server)
+	}
+	if !reflect.DeepEqual(cfg.SplitHorizon, def.SplitHorizon) {
+		t.Errorf("分区解析配置与默认值不一致, 期望: %+v, 实际: %+v", def.SplitHorizon, cfg.SplitHorizon)
+	}
+	if !reflect.DeepEqual(cfg.CacheWarm, def.CacheWarm) {
+		t.Errorf("缓存预热配置与默认值不一致, 期望: %+v, 实际: %+v", def.CacheWarm, cfg.CacheWarm)
+	}
+	if !reflect.DeepEqual(cfg.CDNIPs, def.CDNIPs) {
+		t.Errorf("CDN IP 与默认值不一致, 期望: %v, 实际: %v", def.CDNIPs, cfg.CDNIPs)
+	}
+
+	// 不覆盖已存在的文件
+	if err := WriteDefaultConfigFile(path); err == nil {
+		t.Error("目标文件已存在时应该返回错误")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("已有文件不应被删除: %v", err)
+	}
+}
+
+func TestSystemResolver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	content := "# generated\nsearch example.com\nnameserver 127.0.0.53\nnameserver 1.1.1.1\nnameserver 8.8.8.8\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("写入 resolv.conf 失败: %v", err)
+	}
+	if got := SystemResolver(path); got != "1.1.1.1:53" {
+		t.Errorf("系统上游错误, 期望: 1.1.1.1:53, 实际: %s", got)
+	}
+	if got := SystemResolver(filepath.Join(t.TempDir(), "missing")); got != "" {
+		t.Errorf("文件不存在时应返回空字符串, 实际: %s", got)
+	}
+}
+
+func TestRenderMinimalConfig(t *testing.T) {
+	values := DefaultMinimalConfigValues()
+	values.Upstream = "[2001:db8::1]:53"
+
+	data, err := RenderMinimalConfig(values)
+	if err != nil {
+		t.Fatalf("渲染精简配置失败: %v", err)
+	}
+	cfg, err := LoadConfigFromBytes(data)
+	if err != nil {
+		t.Fatalf("精简配置无效: %v\n%s", err, data)
+	}
+	if cfg.Upstream.Server != values.Upstream || cfg.Server.Listen != values.Listen {
+		t.Errorf("精简配置取值错误: upstream=%s listen=%s", cfg.Upstream.Server, cfg.Server.Listen)
+	}
+	if len(cfg.CDNIPs) != 1 || cfg.CDNIPs[0] != values.CDNIP {
+		t.Errorf("CDN IP 错误: %v", cfg.CDNIPs)
+	}
+}
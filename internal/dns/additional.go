@@ -0,0 +1,42 @@
+package dns
+
+import (
+	"github.com/miekg/dns"
+)
+
+// stripAdditional 对需要清理附加段的域名去掉响应附加段中除 OPT 以外的记录 (胶水记录、上游主动附带的 A 记录等)，
+// 保留携带 EDNS 信息的 OPT 记录。域名规则的 strip_additional 优先，未设置时使用 server.global_strip_additional。
+// 不需要清理或没有可去掉的记录时原样返回，否则返回清理后的副本
+func (s *Server) stripAdditional(domain string, resp *dns.Msg) *dns.Msg {
+	if resp == nil || len(resp.Extra) == 0 || !s.shouldStripAdditional(domain) {
+		return resp
+	}
+
+	kept := 0
+	for _, rr := range resp.Extra {
+		if rr.Header().Rrtype == dns.TypeOPT {
+			kept++
+		}
+	}
+	if kept == len(resp.Extra) {
+		return resp
+	}
+
+	stripped := resp.Copy()
+	extra := stripped.Extra
+	stripped.Extra = make([]dns.RR, 0, kept)
+	for _, rr := range extra {
+		if rr.Header().Rrtype == dns.TypeOPT {
+			stripped.Extra = append(stripped.Extra, rr)
+		}
+	}
+	return stripped
+}
+
+// shouldStripAdditional 判断 domain 的响应是否需要清理附加段
+func (s *Server) shouldStripAdditional(domain string) bool {
+	if rule := s.config.GetDomainRule(normalizeDomain(domain)); rule != nil && rule.StripAdditional != nil {
+		return *rule.StripAdditional
+	}
+	return s.config.Server.GlobalStripAdditional
+}
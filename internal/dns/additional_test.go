@@ -0,0 +1,74 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestStripAdditional(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := answerA(r, "198.51.100.1")
+		glue, _ := dns.NewRR("ns1.example.net. 300 IN A 192.0.2.53")
+		m.Extra = append(m.Extra, glue)
+		m.SetEdns0(dns.DefaultMsgSize, false)
+		w.WriteMsg(m)
+	})
+	newServer := func(global bool) *Server {
+		stripGlobal := "false"
+		if global {
+			stripGlobal = "true"
+		}
+		return newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 500ms
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  global_strip_additional: `+stripGlobal+`
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.strip.com"
+    strip_additional: true
+  - pattern: "*.keep.com"
+    strip_additional: false
+`)
+	}
+	// query 返回响应附加段中各记录的类型
+	query := func(server *Server, name string) []uint16 {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		req.SetEdns0(dns.DefaultMsgSize, false)
+		w := &mockResponseWriter{}
+		server.ServeDNS(w, req)
+		if w.msg == nil || len(w.msg.Answer) != 1 {
+			t.Fatalf("%s 应返回 1 条应答记录, 实际: %v", name, w.msg)
+		}
+		var types []uint16
+		for _, rr := range w.msg.Extra {
+			types = append(types, rr.Header().Rrtype)
+		}
+		return types
+	}
+	onlyOPT := func(types []uint16) bool {
+		return len(types) == 1 && types[0] == dns.TypeOPT
+	}
+
+	server := newServer(false)
+	if types := query(server, "www.strip.com."); !onlyOPT(types) {
+		t.Errorf("strip_additional 为 true 时只应保留 OPT 记录, 实际: %v", types)
+	}
+	if types := query(server, "www.other.com."); len(types) != 2 {
+		t.Errorf("未开启时附加段应保持不变, 实际: %v", types)
+	}
+
+	server = newServer(true)
+	if types := query(server, "www.other.com."); !onlyOPT(types) {
+		t.Errorf("global_strip_additional 为 true 时只应保留 OPT 记录, 实际: %v", types)
+	}
+	if types := query(server, "www.keep.com."); len(types) != 2 {
+		t.Errorf("strip_additional 为 false 时应覆盖全局设置, 实际: %v", types)
+	}
+}
@@ -0,0 +1,272 @@
+package dns
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/hao/fxdns/internal/metrics"
+	"github.com/hao/fxdns/internal/util"
+)
+
+// adminHandler 构建管理 HTTP 服务的路由
+func (s *Server) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rules", s.handleRules)
+	mux.HandleFunc("/rules/by-ip", s.handleRulesByIP)
+	mux.HandleFunc("/explain", s.handleExplain)
+	mux.HandleFunc("/trace", s.handleTrace(TraceOptions{}))
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/cdnips", s.handleCDNIPs)
+	mux.HandleFunc("/cdnips/stats", s.handleCDNIPStats)
+	mux.HandleFunc("/matcher/benchmark", s.handleMatcherBenchmark)
+	mux.HandleFunc("/matcher/stats", s.handleMatcherStats)
+	mux.HandleFunc("/upstream/latency", s.handleUpstreamLatency)
+	mux.HandleFunc("/clients/active", s.handleActiveClients)
+	mux.HandleFunc("/queries/recent", s.handleRecentQueries)
+	mux.HandleFunc("/config", s.handleConfig)
+	mux.HandleFunc("/cache/refresh", s.handleCacheRefresh)
+	mux.Handle("/metrics", metrics.RequireBearerToken(func() string {
+		return s.currentConfig().Metrics.AuthToken
+	}, metrics.Handler()))
+	return mux
+}
+
+// startAdminServer 在配置了 server.admin_listen 时启动管理 HTTP 服务。
+// 调用此方法时，调用者应持有 s.mu 的锁。
+func (s *Server) startAdminServer() error {
+	addr := s.config.Server.AdminListen
+	if addr == "" {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("管理服务监听 %s 失败: %w", addr, err)
+	}
+
+	adminServer := &http.Server{Handler: s.adminHandler()}
+	s.adminServer = adminServer
+	go func() {
+		log.Printf("DNS Server: 管理服务已在 %s 启动", ln.Addr().String())
+		if err := adminServer.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("DNS Server: 管理服务异常退出: %v", err)
+		}
+	}()
+	return nil
+}
+
+// stopAdminServer 关闭管理 HTTP 服务。调用此方法时，调用者应持有 s.mu 的锁。
+func (s *Server) stopAdminServer() {
+	if s.adminServer == nil {
+		return
+	}
+	if err := s.adminServer.Close(); err != nil {
+		log.Printf("DNS Server: 关闭管理服务失败: %v", err)
+	}
+	s.adminServer = nil
+}
+
+// currentConfig 在读锁保护下返回当前配置
+func (s *Server) currentConfig() *config.Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config
+}
+
+// writeJSON 以 JSON 格式输出响应
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("DNS Server: 写入管理服务响应失败: %v", err)
+	}
+}
+
+// handleRules 处理 GET /rules[?tag=xxx]，返回（按标签过滤后的）域名规则
+func (s *Server) handleRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg := s.currentConfig()
+	rules := cfg.Domains
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		rules = cfg.GetRulesForTag(tag)
+	}
+	if rules == nil {
+		rules = []config.DomainRule{}
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+// handleRulesByIP 处理 GET /rules/by-ip?ip=1.2.3.4，返回该 IP 所在的 CDN 网段及受其影响的域名规则
+func (s *Server) handleRulesByIP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ipStr := r.URL.Query().Get("ip")
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		http.Error(w, "invalid ip: "+ipStr, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.explainIP(ip))
+}
+
+// ServerStatus 表示 GET /status 返回的运行状态
+type ServerStatus struct {
+	Listen string `json:"listen"`
+	// ListenAddrs 按协议列出的监听地址，配置了独立的 listen_tcp 时同时包含 udp 与 tcp
+	ListenAddrs    map[string]string `json:"listen_addrs"`
+	Network        string            `json:"network"`
+	DoTListen      string            `json:"dot_listen,omitempty"`
+	DoTConnections int64             `json:"dot_connections"`
+	CacheEntries   int               `json:"cache_entries"`
+	// DrainingListen listen 变更后仍在宽限期内继续服务的旧监听地址；Listen 为当前的主监听
+	DrainingListen []string `json:"draining_listen,omitempty"`
+	// UptimeSeconds 自最近一次启动 DNS 监听以来的秒数
+	UptimeSeconds float64 `json:"uptime_seconds"`
+	// DomainRules 按类型统计的域名模式数量：exact / wildcard / regex
+	DomainRules map[string]int `json:"domain_rules"`
+	// LastReloadTime 最近一次成功加载配置的时间
+	LastReloadTime time.Time `json:"last_reload_time"`
+	// LastReloadError 最近一次加载配置的错误，非空时当前生效的配置可能已过时
+	LastReloadError string `json:"last_reload_error,omitempty"`
+}
+
+// Status 返回服务器当前的运行状态
+func (s *Server) Status() ServerStatus {
+	cfg := s.currentConfig()
+	network := cfg.Server.Network
+	if network == "" {
+		network = config.NetworkUDP
+	}
+
+	s.cache.mu.RLock()
+	cacheEntries := len(s.cache.entries)
+	s.cache.mu.RUnlock()
+
+	status := ServerStatus{
+		Listen:         s.ListenAddr(),
+		ListenAddrs:    s.ListenAddrs(),
+		Network:        network,
+		DoTListen:      s.DoTAddr(),
+		DoTConnections: s.DoTConnections(),
+		CacheEntries:   cacheEntries,
+		DrainingListen: s.DrainingAddrs(),
+		UptimeSeconds:  s.Uptime().Seconds(),
+		DomainRules:    s.domainMatcher.CountByType(),
+	}
+	if s.configManager != nil {
+		status.LastReloadTime = s.configManager.LastReloadTime()
+		if err := s.configManager.LastReloadError(); err != nil {
+			status.LastReloadError = err.Error()
+		}
+	}
+	return status
+}
+
+// handleStatus 处理 GET /status，返回监听地址、DoT 连接数等运行状态；最近一次重新加载配置失败时返回 503
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status := s.Status()
+	code := http.StatusOK
+	if status.LastReloadError != "" {
+		// 最近一次重新加载失败，运行中的配置可能与配置文件不一致
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, status)
+}
+
+// handleCDNIPs 处理 GET /cdnips，返回 CDN IP 段及其添加时间和命中次数
+func (s *Server) handleCDNIPs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.cidrMatcher)
+}
+
+// handleCDNIPStats 处理 GET /cdnips/stats，返回各 CDN IP 段的命中次数与最近命中时间，命中最多的在前
+func (s *Server) handleCDNIPStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.cidrMatcher.Statistics())
+}
+
+// MatcherBenchmark /matcher/benchmark 的响应：域名规则匹配器对给定域名的匹配耗时
+type MatcherBenchmark struct {
+	Domains    []string      `json:"domains"`
+	Iterations int           `json:"iterations"`
+	Avg        time.Duration `json:"avg_ns"`
+	P99        time.Duration `json:"p99_ns"`
+}
+
+// handleMatcherBenchmark 处理 GET /matcher/benchmark?domains=example.com,test.net，
+// 对每个域名重复执行域名规则匹配并返回单次匹配的平均耗时与 P99 耗时
+func (s *Server) handleMatcherBenchmark(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var domains []string
+	for _, domain := range strings.Split(r.URL.Query().Get("domains"), ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	if len(domains) == 0 {
+		http.Error(w, "missing domains parameter", http.StatusBadRequest)
+		return
+	}
+
+	avg, p99 := s.domainMatcher.Benchmark(domains)
+	writeJSON(w, http.StatusOK, MatcherBenchmark{
+		Domains:    domains,
+		Iterations: util.BenchmarkIterations,
+		Avg:        avg,
+		P99:        p99,
+	})
+}
+
+// handleMatcherStats 处理 GET /matcher/stats，返回域名规则匹配器的模式数量与匹配计数
+func (s *Server) handleMatcherStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.domainMatcher.Stats())
+}
+
+// handleConfig 处理 GET /config，以 JSON 返回当前生效的配置，metrics.auth_token、upstream.tsig_secret、
+// upstream.http_proxy_password 与 server.update_tsig_secret 会被隐去
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := s.currentConfig().ExportRedactedJSON()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -0,0 +1,391 @@
+package dns
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/hao/fxdns/internal/util"
+)
+
+func TestAdminRulesByTag(t *testing.T) {
+	server := &Server{
+		config: &config.Config{
+			Domains: []config.DomainRule{
+				{Pattern: "video.example.com", Strategy: config.StrategyFilterNonCDN, Tags: []string{"video"}},
+				{Pattern: "*.cdn.example.com", Strategy: config.StrategyReturnCDNA, Tags: []string{"cdn-a"}},
+			},
+		},
+	}
+	handler := server.adminHandler()
+
+	testCases := []struct {
+		url      string
+		expected []string
+	}{
+		{"/rules", []string{"video.example.com", "*.cdn.example.com"}},
+		{"/rules?tag=video", []string{"video.example.com"}},
+		{"/rules?tag=none", []string{}},
+	}
+
+	for _, tc := range testCases {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.url, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s 状态码错误, 期望: 200, 实际: %d", tc.url, rec.Code)
+		}
+
+		var rules []config.DomainRule
+		if err := json.Unmarshal(rec.Body.Bytes(), &rules); err != nil {
+			t.Fatalf("%s 解析响应失败: %v", tc.url, err)
+		}
+		if len(rules) != len(tc.expected) {
+			t.Fatalf("%s 规则数量错误, 期望: %d, 实际: %d", tc.url, len(tc.expected), len(rules))
+		}
+		for i, rule := range rules {
+			if rule.Pattern != tc.expected[i] {
+				t.Errorf("%s 第 %d 条规则错误, 期望: %s, 实际: %s", tc.url, i, tc.expected[i], rule.Pattern)
+			}
+		}
+	}
+}
+
+func TestAdminStatus(t *testing.T) {
+	server := &Server{
+		config:        &config.Config{},
+		cache:         &Cache{entries: map[string]*CacheEntry{"a": {}, "b": {}}},
+		domainMatcher: util.NewDomainMatcher(),
+	}
+	server.dotConns.Store(3)
+	server.domainMatcher.AddPattern("example.com")
+	server.domainMatcher.AddPattern("*.example.com")
+	server.domainMatcher.AddPattern("*.example.org")
+
+	rec := httptest.NewRecorder()
+	server.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码错误, 期望: 200, 实际: %d", rec.Code)
+	}
+
+	var status ServerStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if status.Network != config.NetworkUDP || status.DoTConnections != 3 || status.CacheEntries != 2 {
+		t.Errorf("状态错误: %+v", status)
+	}
+	if status.DomainRules[util.PatternTypeExact] != 1 || status.DomainRules[util.PatternTypeWildcard] != 2 ||
+		status.DomainRules[util.PatternTypeRegex] != 0 {
+		t.Errorf("域名规则统计错误: %v", status.DomainRules)
+	}
+}
+
+func TestAdminStatusReloadError(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+upstream:
+  server: "127.0.0.1:1"
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+cdn_ips:
+  - "10.0.0.0/8"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("创建测试配置文件失败: %v", err)
+	}
+	server, err := NewServer(configPath)
+	if err != nil {
+		t.Fatalf("创建服务器失败: %v", err)
+	}
+	status := func() (int, ServerStatus) {
+		rec := httptest.NewRecorder()
+		server.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+		var status ServerStatus
+		if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+		return rec.Code, status
+	}
+
+	code, st := status()
+	if code != http.StatusOK || st.LastReloadTime.IsZero() || st.LastReloadError != "" {
+		t.Errorf("加载成功时状态错误: %d %+v", code, st)
+	}
+
+	// 配置文件改为无效内容后重新加载失败，/status 返回 503
+	if err := os.WriteFile(configPath, []byte("server:\n  workers: 0\n"), 0644); err != nil {
+		t.Fatalf("更新配置文件失败: %v", err)
+	}
+	if err := server.configManager.LoadConfig(); err == nil {
+		t.Fatal("无效配置应加载失败")
+	}
+	code, st = status()
+	if code != http.StatusServiceUnavailable || st.LastReloadError == "" {
+		t.Errorf("重新加载失败时应返回 503 与错误信息: %d %+v", code, st)
+	}
+}
+
+func TestAdminCDNIPs(t *testing.T) {
+	server := &Server{cidrMatcher: util.NewCIDRMatcher()}
+	server.cidrMatcher.AddCIDRs([]string{"10.0.0.0/8", "192.168.1.0/24"})
+	server.cidrMatcher.Contains(net.ParseIP("10.0.0.1"))
+
+	rec := httptest.NewRecorder()
+	server.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cdnips", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码错误, 期望: 200, 实际: %d", rec.Code)
+	}
+
+	var infos []util.CIDRInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &infos); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if len(infos) != 2 || infos[0].CIDR != "10.0.0.0/8" || infos[0].Hits != 1 || infos[1].Hits != 0 {
+		t.Errorf("CDN IP 列表错误: %+v", infos)
+	}
+}
+
+func TestAdminCDNIPStats(t *testing.T) {
+	server := &Server{cidrMatcher: util.NewCIDRMatcher()}
+	server.cidrMatcher.AddCIDRs([]string{"10.0.0.0/8", "192.168.1.0/24"})
+	server.cidrMatcher.Contains(net.ParseIP("192.168.1.1"))
+
+	rec := httptest.NewRecorder()
+	server.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cdnips/stats", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码错误, 期望: 200, 实际: %d", rec.Code)
+	}
+
+	var stats util.CIDRStatistics
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if len(stats) != 2 || stats[0].CIDR != "192.168.1.0/24" || stats[0].Hits != 1 || stats[0].LastHit.IsZero() ||
+		stats[1].CIDR != "10.0.0.0/8" || stats[1].Hits != 0 {
+		t.Errorf("CDN IP 统计错误: %+v", stats)
+	}
+}
+
+func TestAdminMatcherBenchmark(t *testing.T) {
+	server := &Server{domainMatcher: util.NewDomainMatcher()}
+	server.domainMatcher.SetPatterns([]string{"*.example.com", "test.net"})
+
+	rec := httptest.NewRecorder()
+	server.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/matcher/benchmark?domains=www.example.com,+test.net,", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码错误, 期望: 200, 实际: %d", rec.Code)
+	}
+	var result MatcherBenchmark
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if len(result.Domains) != 2 || result.Domains[1] != "test.net" || result.Iterations != util.BenchmarkIterations ||
+		result.Avg <= 0 || result.P99 <= 0 {
+		t.Errorf("基准测试结果错误: %+v", result)
+	}
+
+	rec = httptest.NewRecorder()
+	server.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/matcher/benchmark", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("缺少 domains 参数时状态码错误, 期望: 400, 实际: %d", rec.Code)
+	}
+}
+
+func TestAdminMatcherStats(t *testing.T) {
+	server := &Server{domainMatcher: util.NewDomainMatcher()}
+	server.domainMatcher.SetPatterns([]string{"*.example.com", "test.net"})
+	server.domainMatcher.Match("www.example.com")
+	server.domainMatcher.Match("test.net")
+	server.domainMatcher.Match("other.org")
+
+	rec := httptest.NewRecorder()
+	server.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/matcher/stats", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码错误, 期望: 200, 实际: %d", rec.Code)
+	}
+	var stats util.MatcherStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if stats.TotalPatterns != 2 || stats.TotalMatchCalls != 3 || stats.ExactHits != 1 || stats.WildcardHits != 1 {
+		t.Errorf("匹配统计错误: %+v", stats)
+	}
+
+	rec = httptest.NewRecorder()
+	server.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/matcher/stats", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST 请求状态码错误, 期望: 405, 实际: %d", rec.Code)
+	}
+}
+
+func TestAdminMetricsAuthToken(t *testing.T) {
+	server := &Server{config: &config.Config{Metrics: config.MetricsConfig{AuthToken: "secret"}}}
+	handler := server.adminHandler()
+
+	testCases := []struct {
+		name          string
+		authorization string
+		expected      int
+	}{
+		{"缺少 Authorization", "", http.StatusUnauthorized},
+		{"错误的 token", "Bearer wrong", http.StatusUnauthorized},
+		{"非 Bearer 认证", "Basic c2VjcmV0", http.StatusUnauthorized},
+		{"正确的 token", "Bearer secret", http.StatusOK},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if tc.authorization != "" {
+			req.Header.Set("Authorization", tc.authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.expected {
+			t.Errorf("%s: 状态码错误, 期望: %d, 实际: %d", tc.name, tc.expected, rec.Code)
+		}
+	}
+
+	// 热加载清空 token 后不再要求认证
+	server.config = &config.Config{}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("未配置 token 时状态码错误, 期望: 200, 实际: %d", rec.Code)
+	}
+}
+
+func TestAdminConfig(t *testing.T) {
+	cfg, err := config.LoadConfigFromBytes([]byte(`
+upstream:
+  server: "8.8.8.8:53"
+  timeout: 3s
+  http_proxy: "http://proxy.corp.example.com:8080"
+  http_proxy_user: "fxdns"
+  http_proxy_password: "proxy-secret"
+  tsig_key_name: "fxdns-key"
+  tsig_secret: "c2VjcmV0LWtleS1mb3ItZnhkbnM="
+server:
+  listen: ":53"
+  workers: 2
+  update_tsig_key_name: "update-key"
+  update_tsig_secret: "dXBkYXRlLWtleS1mb3ItZnhkbnM="
+cdn_ips:
+  - "10.0.0.0/8"
+metrics:
+  auth_token: "secret"
+`))
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	server := &Server{config: cfg}
+
+	rec := httptest.NewRecorder()
+	server.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码错误, 期望: 200, 实际: %d", rec.Code)
+	}
+
+	var exported struct {
+		Upstream struct {
+			Server            string `json:"server"`
+			Timeout           string `json:"timeout"`
+			HTTPProxyPassword string `json:"http_proxy_password"`
+			TSIGSecret        string `json:"tsig_secret"`
+		} `json:"upstream"`
+		Server struct {
+			UpdateTSIGSecret string `json:"update_tsig_secret"`
+		} `json:"server"`
+		Metrics struct {
+			AuthToken string `json:"auth_token"`
+		} `json:"metrics"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &exported); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if exported.Upstream.Server != "8.8.8.8:53" || exported.Upstream.Timeout != "3s" {
+		t.Errorf("upstream 导出错误: %+v", exported.Upstream)
+	}
+	if exported.Metrics.AuthToken == "secret" {
+		t.Error("auth_token 不应明文导出")
+	}
+	if exported.Upstream.HTTPProxyPassword == "proxy-secret" {
+		t.Error("http_proxy_password 不应明文导出")
+	}
+	if exported.Upstream.TSIGSecret != "******" || exported.Server.UpdateTSIGSecret != "******" {
+		t.Errorf("TSIG 密钥不应明文导出: %q, %q", exported.Upstream.TSIGSecret, exported.Server.UpdateTSIGSecret)
+	}
+	if cfg.Metrics.AuthToken != "secret" {
+		t.Error("导出不应修改当前配置")
+	}
+
+	rec = httptest.NewRecorder()
+	server.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/config", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("状态码错误, 期望: 405, 实际: %d", rec.Code)
+	}
+}
+
+func TestAdminRulesByIP(t *testing.T) {
+	server := &Server{
+		config: &config.Config{
+			Domains: []config.DomainRule{
+				{Pattern: "video.example.com", Strategy: config.StrategyFilterNonCDN},
+				{Pattern: "static.example.com", Strategy: config.StrategyNone},
+				{Pattern: "*.cdn.example.com", Strategy: config.StrategyReturnCDNA},
+			},
+		},
+		cidrMatcher: util.NewCIDRMatcher(),
+	}
+	server.cidrMatcher.AddCIDRs([]string{"10.0.0.0/8"})
+	handler := server.adminHandler()
+
+	testCases := []struct {
+		ip       string
+		cdn      bool
+		cidr     string
+		expected []string
+	}{
+		{"10.1.2.3", true, "10.0.0.0/8", []string{"video.example.com", "*.cdn.example.com"}},
+		{"192.168.1.1", false, "", []string{}},
+	}
+	for _, tc := range testCases {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rules/by-ip?ip="+tc.ip, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s 状态码错误, 期望: 200, 实际: %d", tc.ip, rec.Code)
+		}
+
+		var result RulesByIPResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+			t.Fatalf("%s 解析响应失败: %v", tc.ip, err)
+		}
+		if result.IP != tc.ip || result.CDN != tc.cdn || result.CIDR != tc.cidr {
+			t.Errorf("%s 结果错误: %+v", tc.ip, result)
+		}
+		if len(result.Rules) != len(tc.expected) {
+			t.Fatalf("%s 规则数量错误, 期望: %d, 实际: %d", tc.ip, len(tc.expected), len(result.Rules))
+		}
+		for i, rule := range result.Rules {
+			if rule.Pattern != tc.expected[i] {
+				t.Errorf("%s 第 %d 条规则错误, 期望: %s, 实际: %s", tc.ip, i, tc.expected[i], rule.Pattern)
+			}
+		}
+	}
+
+	for _, stat := range server.cidrMatcher.Statistics() {
+		if stat.Hits != 0 {
+			t.Errorf("查询不应计入 CDN IP 命中统计: %+v", stat)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rules/by-ip?ip=bogus", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("无效 IP 状态码错误, 期望: 400, 实际: %d", rec.Code)
+	}
+}
@@ -0,0 +1,37 @@
+package dns
+
+import (
+	"github.com/hao/fxdns/internal/config"
+	"github.com/miekg/dns"
+)
+
+// anyHINFOTTL 按 RFC 8482 合成的 HINFO 记录的 TTL
+const anyHINFOTTL = 3600
+
+// anyQueryResponse 按 server.any_query_policy 为 ANY 类型查询构造本地响应，避免被利用进行放大攻击。
+// 不是 ANY 查询或策略为 passthrough (默认) 时返回 nil，按普通查询处理。
+func (s *Server) anyQueryResponse(r *dns.Msg) *dns.Msg {
+	if len(r.Question) == 0 || r.Question[0].Qtype != dns.TypeANY {
+		return nil
+	}
+	q := r.Question[0]
+
+	resp := new(dns.Msg)
+	switch s.config.Server.AnyQueryPolicy {
+	case config.AnyQueryPolicyRefuse:
+		resp.SetRcode(r, dns.RcodeRefused)
+	case config.AnyQueryPolicyEmpty:
+		resp.SetReply(r)
+	case config.AnyQueryPolicyHINFO:
+		// RFC 8482 第 4.2 节：返回一条 CPU 字段为 "RFC8482"、OS 字段为空的 HINFO 记录
+		resp.SetReply(r)
+		resp.Answer = append(resp.Answer, &dns.HINFO{
+			Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeHINFO, Class: q.Qclass, Ttl: anyHINFOTTL},
+			Cpu: "RFC8482",
+			Os:  "",
+		})
+	default:
+		return nil
+	}
+	return resp
+}
@@ -0,0 +1,81 @@
+package dns
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestAnyQueryPolicy(t *testing.T) {
+	var upstreamQueries atomic.Int32
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		upstreamQueries.Add(1)
+		w.WriteMsg(answerA(r, "10.1.1.1"))
+	})
+
+	testCases := []struct {
+		policy         string
+		expectCode     int
+		expectAnswers  int
+		expectUpstream bool
+	}{
+		{"", dns.RcodeSuccess, 1, true},
+		{"passthrough", dns.RcodeSuccess, 1, true},
+		{"refuse", dns.RcodeRefused, 0, false},
+		{"hinfo", dns.RcodeSuccess, 1, false},
+		{"empty", dns.RcodeSuccess, 0, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run("policy="+tc.policy, func(t *testing.T) {
+			server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  any_query_policy: "`+tc.policy+`"
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+			before := upstreamQueries.Load()
+
+			req := new(dns.Msg)
+			req.SetQuestion("any.example.com.", dns.TypeANY)
+			w := &mockResponseWriter{}
+			server.ServeDNS(w, req)
+
+			if w.msg == nil {
+				t.Fatal("未收到响应")
+			}
+			if w.msg.Rcode != tc.expectCode {
+				t.Errorf("RCODE 错误, 期望: %d, 实际: %d", tc.expectCode, w.msg.Rcode)
+			}
+			if len(w.msg.Answer) != tc.expectAnswers {
+				t.Fatalf("应答记录数错误, 期望: %d, 实际: %d (%v)", tc.expectAnswers, len(w.msg.Answer), w.msg.Answer)
+			}
+			if queried := upstreamQueries.Load() > before; queried != tc.expectUpstream {
+				t.Errorf("是否转发上游错误, 期望: %v, 实际: %v", tc.expectUpstream, queried)
+			}
+
+			if tc.policy == "hinfo" {
+				hinfo, ok := w.msg.Answer[0].(*dns.HINFO)
+				if !ok || hinfo.Cpu != "RFC8482" || hinfo.Os != "" || hinfo.Hdr.Name != "any.example.com." {
+					t.Errorf("HINFO 记录错误: %v", w.msg.Answer[0])
+				}
+			}
+
+			// 其他查询类型不受影响
+			req = new(dns.Msg)
+			req.SetQuestion("a.example.com.", dns.TypeA)
+			w = &mockResponseWriter{}
+			server.ServeDNS(w, req)
+			if w.msg == nil || w.msg.Rcode != dns.RcodeSuccess || len(w.msg.Answer) != 1 {
+				t.Errorf("A 查询应正常转发: %v", w.msg)
+			}
+		})
+	}
+}
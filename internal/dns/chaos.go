@@ -0,0 +1,45 @@
+package dns
+
+import (
+	"strings"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/miekg/dns"
+)
+
+// chaosResponse 对配置了 server.chaos_version / server.chaos_hostname 的 CHAOS 类 TXT 查询
+// (version.bind / hostname.bind) 构造本地响应，避免转发给上游泄露信息。
+// 不是这类查询或对应字段未配置时返回 nil，按普通查询处理。
+func (s *Server) chaosResponse(r *dns.Msg) *dns.Msg {
+	if len(r.Question) == 0 {
+		return nil
+	}
+	q := r.Question[0]
+	if q.Qclass != dns.ClassCHAOS || q.Qtype != dns.TypeTXT {
+		return nil
+	}
+
+	var value string
+	switch strings.ToLower(q.Name) {
+	case "version.bind.":
+		value = s.config.Server.ChaosVersion
+	case "hostname.bind.":
+		value = s.config.Server.ChaosHostname
+	}
+	if value == "" {
+		return nil
+	}
+
+	resp := new(dns.Msg)
+	if value == config.ChaosRefuse {
+		resp.SetRcode(r, dns.RcodeRefused)
+		return resp
+	}
+	resp.SetReply(r)
+	resp.Authoritative = true
+	resp.Answer = append(resp.Answer, &dns.TXT{
+		Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeTXT, Class: dns.ClassCHAOS, Ttl: 0},
+		Txt: []string{value},
+	})
+	return resp
+}
@@ -0,0 +1,95 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestChaosQueries(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = append(m.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassCHAOS},
+			Txt: []string{"upstream"},
+		})
+		w.WriteMsg(m)
+	})
+
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  chaos_version: "fxdns"
+  chaos_hostname: "refuse"
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+
+	testCases := []struct {
+		name       string
+		qname      string
+		qclass     uint16
+		expectCode int
+		expectTXT  string
+	}{
+		{"version.bind 返回配置的内容", "version.bind.", dns.ClassCHAOS, dns.RcodeSuccess, "fxdns"},
+		{"大小写不敏感", "VERSION.BIND.", dns.ClassCHAOS, dns.RcodeSuccess, "fxdns"},
+		{"hostname.bind 配置为 refuse", "hostname.bind.", dns.ClassCHAOS, dns.RcodeRefused, ""},
+		{"未配置的名称转发上游", "id.server.", dns.ClassCHAOS, dns.RcodeSuccess, "upstream"},
+		{"IN 类查询转发上游", "version.bind.", dns.ClassINET, dns.RcodeSuccess, "upstream"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := new(dns.Msg)
+			req.SetQuestion(tc.qname, dns.TypeTXT)
+			req.Question[0].Qclass = tc.qclass
+			w := &mockResponseWriter{}
+			server.ServeDNS(w, req)
+
+			if w.msg == nil {
+				t.Fatal("未收到响应")
+			}
+			if w.msg.Rcode != tc.expectCode {
+				t.Errorf("RCODE 错误, 期望: %d, 实际: %d", tc.expectCode, w.msg.Rcode)
+			}
+			if tc.expectTXT == "" {
+				if len(w.msg.Answer) != 0 {
+					t.Errorf("响应应不含记录, 实际: %v", w.msg.Answer)
+				}
+				return
+			}
+			if len(w.msg.Answer) != 1 {
+				t.Fatalf("响应记录数量错误, 期望: 1, 实际: %d", len(w.msg.Answer))
+			}
+			txt, ok := w.msg.Answer[0].(*dns.TXT)
+			if !ok || len(txt.Txt) != 1 || txt.Txt[0] != tc.expectTXT {
+				t.Errorf("TXT 记录错误, 期望: %s, 实际: %v", tc.expectTXT, w.msg.Answer[0])
+			}
+		})
+	}
+}
+
+func TestChaosQueriesUnconfigured(t *testing.T) {
+	server := newTestServer(t, `
+upstream:
+  server: "127.0.0.1:53"
+server:
+  listen: "127.0.0.1:0"
+  workers: 1
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+	req := new(dns.Msg)
+	req.SetQuestion("version.bind.", dns.TypeTXT)
+	req.Question[0].Qclass = dns.ClassCHAOS
+	if resp := server.chaosResponse(req); resp != nil {
+		t.Errorf("未配置时不应在本地应答, 实际: %v", resp)
+	}
+}
@@ -0,0 +1,88 @@
+package dns
+
+import (
+	"log"
+	"time"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/hao/fxdns/internal/metrics"
+	"github.com/hao/fxdns/internal/upstream"
+	"github.com/miekg/dns"
+)
+
+// circuitBreaker 返回主上游地址对应的熔断器，首次使用时按当前配置创建；未启用 circuit_breaker 时返回 nil
+func (s *Server) circuitBreaker(addr string) *upstream.CircuitBreaker {
+	s.breakerMu.Lock()
+	defer s.breakerMu.Unlock()
+
+	cfg := s.config.Upstream.CircuitBreaker
+	if cfg.FailureThreshold <= 0 {
+		return nil
+	}
+	if b, ok := s.breakers[addr]; ok {
+		return b
+	}
+	window := cfg.Window
+	if window <= 0 {
+		window = config.DefaultCircuitBreakerWindow
+	}
+	openDuration := cfg.OpenDuration
+	if openDuration <= 0 {
+		openDuration = config.DefaultCircuitBreakerOpenDuration
+	}
+	if s.breakers == nil {
+		s.breakers = make(map[string]*upstream.CircuitBreaker)
+	}
+	b := upstream.NewCircuitBreaker(cfg.FailureThreshold, window, openDuration)
+	s.breakers[addr] = b
+	return b
+}
+
+// resetCircuitBreakers 丢弃已创建的熔断器，配置变更后按新配置重新计数
+func (s *Server) resetCircuitBreakers() {
+	s.breakerMu.Lock()
+	defer s.breakerMu.Unlock()
+	for _, b := range s.breakers {
+		if b.Reset() {
+			metrics.OpenCircuits.Add(-1)
+		}
+	}
+	s.breakers = nil
+}
+
+// exchangePrimary 经熔断器向主上游发送查询：熔断打开时不发送，直接返回 upstream.ErrCircuitOpen；
+// 发送后按是否出错更新熔断器状态
+func (s *Server) exchangePrimary(m *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, time.Duration, error) {
+	b := s.circuitBreaker(addr)
+	if b == nil {
+		return s.exchangeTimeout(m, addr, timeout)
+	}
+	if !b.Allow() {
+		metrics.CircuitRejectCount.Inc()
+		return nil, 0, upstream.ErrCircuitOpen
+	}
+
+	resp, rtt, err := s.exchangeTimeout(m, addr, timeout)
+	s.recordBreakerResult(addr, b, err)
+	return resp, rtt, err
+}
+
+// recordBreakerResult 按查询结果更新熔断器状态与 OpenCircuits 指标。
+// 查询期间熔断器已被 resetCircuitBreakers 丢弃时不再更新，否则其打开不会再被任何重置抵消，指标将持续偏高
+func (s *Server) recordBreakerResult(addr string, b *upstream.CircuitBreaker, err error) {
+	s.breakerMu.Lock()
+	defer s.breakerMu.Unlock()
+	if s.breakers[addr] != b {
+		return
+	}
+	if err != nil {
+		if b.Failure() {
+			log.Printf("主上游 %s 连续失败，熔断打开: %v", addr, err)
+			metrics.CircuitOpenCount.Inc()
+			metrics.OpenCircuits.Add(1)
+		}
+	} else if b.Success() {
+		log.Printf("主上游 %s 探测成功，熔断关闭", addr)
+		metrics.OpenCircuits.Add(-1)
+	}
+}
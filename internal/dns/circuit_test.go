@@ -0,0 +1,138 @@
+package dns
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hao/fxdns/internal/metrics"
+	"github.com/miekg/dns"
+)
+
+func TestPrimaryCircuitBreaker(t *testing.T) {
+	// 主上游总是超时
+	var primaryQueries atomic.Int32
+	primary := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		primaryQueries.Add(1)
+		time.Sleep(200 * time.Millisecond)
+		w.WriteMsg(answerA(r, "198.51.100.1"))
+	})
+	fallback := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answerA(r, "198.51.100.2"))
+	})
+	server := newTestServer(t, `
+upstream:
+  server: "`+primary+`"
+  fallback_server: "`+fallback+`"
+  timeout: 50ms
+  circuit_breaker:
+    failure_threshold: 2
+    window: 10s
+    open_duration: 1m
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+
+	query := func(name string) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		w := &mockResponseWriter{}
+		server.ServeDNS(w, req)
+		if w.msg == nil {
+			t.Fatalf("%s 没有返回响应", name)
+		}
+		return w.msg
+	}
+
+	opened := metrics.CircuitOpenCount.Value()
+	rejected := metrics.CircuitRejectCount.Value()
+	openCircuits := metrics.OpenCircuits.Value()
+
+	// cdn_miss 触发条件下主上游出错返回 SERVFAIL，连续 2 次后熔断打开
+	for _, name := range []string{"a.example.com.", "b.example.com."} {
+		if resp := query(name); resp.Rcode != dns.RcodeServerFailure {
+			t.Fatalf("%s 主上游超时应返回 SERVFAIL, 实际: %s", name, dns.RcodeToString[resp.Rcode])
+		}
+	}
+	if got := metrics.CircuitOpenCount.Value() - opened; got != 1 {
+		t.Errorf("熔断打开次数错误, 期望: 1, 实际: %d", got)
+	}
+	if got := metrics.OpenCircuits.Value() - openCircuits; got != 1 {
+		t.Errorf("打开的熔断器数错误, 期望: 1, 实际: %d", got)
+	}
+
+	// 熔断打开后不再查询主上游，直接使用备用上游
+	resp := query("c.example.com.")
+	if len(resp.Answer) != 1 || resp.Answer[0].(*dns.A).A.String() != "198.51.100.2" {
+		t.Fatalf("熔断打开时应使用备用上游结果, 实际: %v", resp)
+	}
+	if got := primaryQueries.Load(); got != 2 {
+		t.Errorf("熔断打开后不应再查询主上游, 主上游收到 %d 次查询", got)
+	}
+	if got := metrics.CircuitRejectCount.Value() - rejected; got != 1 {
+		t.Errorf("被熔断拒绝的查询数错误, 期望: 1, 实际: %d", got)
+	}
+
+	// 配置变更后熔断器重新计数
+	server.resetCircuitBreakers()
+	if got := metrics.OpenCircuits.Value(); got != openCircuits {
+		t.Errorf("重置后打开的熔断器数应恢复为 %d, 实际: %d", openCircuits, got)
+	}
+}
+
+func TestCircuitBreakerResetDuringQuery(t *testing.T) {
+	server := newTestServer(t, `
+upstream:
+  server: "127.0.0.1:53"
+  circuit_breaker:
+    failure_threshold: 1
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+	openCircuits := metrics.OpenCircuits.Value()
+	timeout := errors.New("timeout")
+
+	// 查询发出后配置热加载丢弃了熔断器，查询结束时的失败不应再打开它或计入指标
+	inflight := server.circuitBreaker("127.0.0.1:53")
+	server.resetCircuitBreakers()
+	server.recordBreakerResult("127.0.0.1:53", inflight, timeout)
+	if got := metrics.OpenCircuits.Value(); got != openCircuits {
+		t.Errorf("已丢弃的熔断器不应计入打开的熔断器数, 期望: %d, 实际: %d", openCircuits, got)
+	}
+
+	// 新的熔断器照常计数，重置后恢复
+	live := server.circuitBreaker("127.0.0.1:53")
+	if live == inflight {
+		t.Fatal("重置后应创建新的熔断器")
+	}
+	server.recordBreakerResult("127.0.0.1:53", live, timeout)
+	if got := metrics.OpenCircuits.Value() - openCircuits; got != 1 {
+		t.Errorf("打开的熔断器数错误, 期望: 1, 实际: %d", got)
+	}
+	server.resetCircuitBreakers()
+	if got := metrics.OpenCircuits.Value(); got != openCircuits {
+		t.Errorf("重置后打开的熔断器数应恢复为 %d, 实际: %d", openCircuits, got)
+	}
+}
+
+func TestPrimaryCircuitBreakerDisabled(t *testing.T) {
+	server := newTestServer(t, `
+upstream:
+  server: "127.0.0.1:53"
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+	if b := server.circuitBreaker("127.0.0.1:53"); b != nil {
+		t.Error("未配置 failure_threshold 时不应创建熔断器")
+	}
+}
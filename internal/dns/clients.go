@@ -0,0 +1,175 @@
+package dns
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxQueriesPerConn 单个 TCP 连接上的查询数超过此值时记录日志，日后作为 server.max_queries_per_conn 的默认值
+	maxQueriesPerConn = 100
+	// clientReportInterval 检查 TCP 连接查询数的间隔
+	clientReportInterval = time.Minute
+)
+
+// tcpClient 一个 TCP 客户端连接的状态，以远端地址为键保存在 Server.clientRegistry 中
+type tcpClient struct {
+	conn       net.Conn
+	openedAt   time.Time
+	queries    atomic.Uint64
+	lastActive atomic.Int64 // 最近一次查询的时间 (UnixNano)，尚无查询时为建立连接的时间
+	reported   atomic.Bool  // 是否已记录过查询数超限的日志
+}
+
+// idle 返回连接自最近一次查询以来的空闲时长
+func (c *tcpClient) idle(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, c.lastActive.Load()))
+}
+
+// clientTrackingListener 将接收的 TCP 连接登记到 Server.clientRegistry，连接关闭时移除；
+// 监听存续期间定期记录查询数超过 maxQueriesPerConn 的连接
+type clientTrackingListener struct {
+	net.Listener
+	s    *Server
+	stop chan struct{}
+	once sync.Once
+}
+
+// trackClients 包装 TCP 监听以跟踪其上的客户端连接
+func (s *Server) trackClients(ln net.Listener) net.Listener {
+	l := &clientTrackingListener{Listener: ln, s: s, stop: make(chan struct{})}
+	go l.reportLoop()
+	return l
+}
+
+// Accept 接收连接并登记
+func (l *clientTrackingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	client := &tcpClient{conn: conn, openedAt: time.Now()}
+	client.lastActive.Store(client.openedAt.UnixNano())
+	key := conn.RemoteAddr().String()
+	l.s.clientRegistry.Store(key, client)
+	return &trackedConn{Conn: conn, registry: &l.s.clientRegistry, key: key, client: client}, nil
+}
+
+// Close 关闭监听并停止定期检查
+func (l *clientTrackingListener) Close() error {
+	l.once.Do(func() { close(l.stop) })
+	return l.Listener.Close()
+}
+
+// reportLoop 每隔 clientReportInterval 记录查询数首次超过 maxQueriesPerConn 的连接
+func (l *clientTrackingListener) reportLoop() {
+	ticker := time.NewTicker(clientReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.s.reportBusyClients()
+		}
+	}
+}
+
+// reportBusyClients 记录查询数超过 maxQueriesPerConn 的连接，每个连接只记录一次
+func (s *Server) reportBusyClients() {
+	s.clientRegistry.Range(func(key, value any) bool {
+		client := value.(*tcpClient)
+		if n := client.queries.Load(); n > maxQueriesPerConn && client.reported.CompareAndSwap(false, true) {
+			log.Printf("TCP 客户端 %s 在一个连接上已发送 %d 个查询 (超过 %d)，连接已建立 %v", key, n, maxQueriesPerConn, time.Since(client.openedAt).Round(time.Second))
+		}
+		return true
+	})
+}
+
+// trackedConn 在首次关闭时将连接移出 clientRegistry
+type trackedConn struct {
+	net.Conn
+	registry *sync.Map
+	key      string
+	client   *tcpClient
+	once     sync.Once
+}
+
+// Close 关闭连接
+func (c *trackedConn) Close() error {
+	c.once.Do(func() { c.registry.CompareAndDelete(c.key, c.client) })
+	return c.Conn.Close()
+}
+
+// recordClientQuery 为来自已登记 TCP 连接的查询计数并更新其最近活跃时间，其他查询忽略
+func (s *Server) recordClientQuery(remote net.Addr) {
+	if _, ok := remote.(*net.TCPAddr); !ok {
+		return
+	}
+	if value, ok := s.clientRegistry.Load(remote.String()); ok {
+		client := value.(*tcpClient)
+		client.queries.Add(1)
+		client.lastActive.Store(time.Now().UnixNano())
+	}
+}
+
+// ActiveClient 一个活跃 TCP 连接的状态，用于 GET /clients/active
+type ActiveClient struct {
+	RemoteAddr  string    `json:"remote_addr"`
+	Queries     uint64    `json:"queries"`
+	OpenedAt    time.Time `json:"opened_at"`
+	OpenSeconds float64   `json:"open_seconds"`
+	IdleSeconds float64   `json:"idle_seconds"`
+}
+
+// ActiveClients 返回当前所有 TCP 客户端连接的状态，按远端地址排序
+func (s *Server) ActiveClients() []ActiveClient {
+	now := time.Now()
+	clients := []ActiveClient{}
+	s.clientRegistry.Range(func(key, value any) bool {
+		client := value.(*tcpClient)
+		clients = append(clients, ActiveClient{
+			RemoteAddr:  key.(string),
+			Queries:     client.queries.Load(),
+			OpenedAt:    client.openedAt,
+			OpenSeconds: now.Sub(client.openedAt).Seconds(),
+			IdleSeconds: client.idle(now).Seconds(),
+		})
+		return true
+	})
+	sort.Slice(clients, func(i, j int) bool { return clients[i].RemoteAddr < clients[j].RemoteAddr })
+	return clients
+}
+
+// CloseIdleClients 关闭空闲时长超过 maxIdle 的 TCP 客户端连接，返回关闭的连接数
+func (s *Server) CloseIdleClients(maxIdle time.Duration) int {
+	now := time.Now()
+	closed := 0
+	s.clientRegistry.Range(func(key, value any) bool {
+		client := value.(*tcpClient)
+		if client.idle(now) <= maxIdle {
+			return true
+		}
+		// 关闭底层连接后 miekg/dns 的读取出错，随即关闭 trackedConn 并将其移出 clientRegistry
+		if err := client.conn.Close(); err == nil {
+			closed++
+			log.Printf("关闭空闲 %v 的 TCP 客户端连接 %s", client.idle(now).Round(time.Second), key)
+		}
+		return true
+	})
+	return closed
+}
+
+// handleActiveClients 处理 GET /clients/active，返回当前 TCP 客户端连接的查询数与空闲时长
+func (s *Server) handleActiveClients(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.ActiveClients())
+}
@@ -0,0 +1,119 @@
+package dns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestActiveTCPClients(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answerA(r, "10.1.1.1"))
+	})
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 2s
+server:
+  listen: "127.0.0.1:0"
+  network: "tcp"
+  workers: 2
+  cache_size: 10
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+	if err := server.Start(); err != nil {
+		t.Fatalf("启动服务器失败: %v", err)
+	}
+	defer server.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := server.WaitReady(ctx); err != nil {
+		t.Fatalf("等待服务器就绪失败: %v", err)
+	}
+
+	// 在同一个连接上发送多个查询
+	client := &dns.Client{Net: "tcp", Timeout: 2 * time.Second}
+	conn, err := client.Dial(server.ListenAddr())
+	if err != nil {
+		t.Fatalf("连接服务器失败: %v", err)
+	}
+	defer conn.Close()
+	const queries = maxQueriesPerConn + 1
+	for i := 0; i < queries; i++ {
+		req := new(dns.Msg)
+		req.SetQuestion("www.example.com.", dns.TypeA)
+		if _, _, err := client.ExchangeWithConn(req, conn); err != nil {
+			t.Fatalf("第 %d 个查询失败: %v", i+1, err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	server.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/clients/active", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码错误, 期望: 200, 实际: %d", rec.Code)
+	}
+	var clients []ActiveClient
+	if err := json.Unmarshal(rec.Body.Bytes(), &clients); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if len(clients) != 1 {
+		t.Fatalf("期望 1 个活跃连接, 实际: %v", clients)
+	}
+	if got := clients[0]; got.RemoteAddr != conn.LocalAddr().String() || got.Queries != queries || got.IdleSeconds > got.OpenSeconds {
+		t.Errorf("连接状态错误: %+v (本地地址 %s)", got, conn.LocalAddr())
+	}
+
+	server.reportBusyClients()
+	value, _ := server.clientRegistry.Load(conn.LocalAddr().String())
+	if !value.(*tcpClient).reported.Load() {
+		t.Error("查询数超过 maxQueriesPerConn 的连接应被记录")
+	}
+
+	if n := server.CloseIdleClients(time.Hour); n != 0 {
+		t.Errorf("没有空闲超过 1 小时的连接, 实际关闭 %d 个", n)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := server.CloseIdleClients(5 * time.Millisecond); n != 1 {
+		t.Fatalf("应关闭 1 个空闲连接, 实际 %d 个", n)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(server.ActiveClients()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("关闭后连接应移出列表: %v", server.ActiveClients())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	if _, _, err := client.ExchangeWithConn(req, conn); err == nil {
+		t.Error("连接被关闭后查询应失败")
+	}
+}
+
+func TestActiveClientsMethodNotAllowed(t *testing.T) {
+	server := newTestServer(t, `
+upstream:
+  server: "127.0.0.1:53"
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+	rec := httptest.NewRecorder()
+	server.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/clients/active", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("状态码错误, 期望: 405, 实际: %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	server.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/clients/active", nil))
+	if body := rec.Body.String(); body != "[]\n" {
+		t.Errorf("没有 TCP 连接时应返回空列表, 实际: %q", body)
+	}
+}
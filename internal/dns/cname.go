@@ -5,6 +5,8 @@ import (
 	"net"
 	"strings"
 
+	"github.com/hao/fxdns/internal/metrics"
+	"github.com/hao/fxdns/internal/util"
 	"github.com/miekg/dns"
 )
 
@@ -57,6 +59,25 @@ func (c *CNAMEChain) GetTarget(domain string) string {
 	return c.links[domain]
 }
 
+// Depth 返回从 domain 出发沿 CNAME 链经过的跳数，domain 没有 CNAME 时为 0。链中出现环时在回到已访问的域名前停止
+func (c *CNAMEChain) Depth(domain string) int {
+	domain = normalizeDomain(domain)
+	visited := map[string]bool{domain: true}
+	depth := 0
+	for {
+		target, ok := c.links[domain]
+		if !ok {
+			return depth
+		}
+		depth++
+		if visited[target] {
+			return depth
+		}
+		visited[target] = true
+		domain = target
+	}
+}
+
 // GetAllDomains 获取 CNAME 链中的所有域名
 func (c *CNAMEChain) GetAllDomains() []string {
 	domains := make([]string, 0, len(c.domains))
@@ -66,6 +87,19 @@ func (c *CNAMEChain) GetAllDomains() []string {
 	return domains
 }
 
+// FilterByMatcher 返回一个新的 CNAME 链，仅包含源域名或目标域名至少有一个匹配 matcher 的链接
+func (c *CNAMEChain) FilterByMatcher(matcher *util.DomainMatcher) *CNAMEChain {
+	filtered := NewCNAMEChain()
+	for source, target := range c.links {
+		if matcher.Match(source) || matcher.Match(target) {
+			filtered.links[source] = target
+			filtered.domains[source] = true
+			filtered.domains[target] = true
+		}
+	}
+	return filtered
+}
+
 // TraceChain 跟踪 CNAME 链，返回从源域名到最终目标的所有域名
 func (c *CNAMEChain) TraceChain(sourceDomain string) []string {
 	sourceDomain = normalizeDomain(sourceDomain)
@@ -125,3 +159,21 @@ func ExtractCDNIPs(resp *dns.Msg, chain *CNAMEChain, cidrMatcher func(net.IP) bo
 
 	return cdnIPs
 }
+
+// violatesSingleCNAME 判断配置了 enforce_single_cname 的域名的应答是否经过了多于一层的 CNAME，
+// 违反时记录安全事件并计数，调用方应返回 SERVFAIL
+func (s *Server) violatesSingleCNAME(domain string, resp *dns.Msg) bool {
+	rule := s.config.GetDomainRule(normalizeDomain(domain))
+	if rule == nil || !rule.EnforceSingleCNAME || resp == nil {
+		return false
+	}
+	chain := NewCNAMEChain()
+	chain.BuildFromResponse(resp)
+	depth := chain.Depth(domain)
+	if depth <= 1 {
+		return false
+	}
+	log.Printf("安全事件: %s 的 CNAME 链 %v 共 %d 层，违反 enforce_single_cname，返回 SERVFAIL", domain, chain.TraceChain(domain), depth)
+	metrics.CNAMEViolations.Inc()
+	return true
+}
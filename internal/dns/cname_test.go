@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/hao/fxdns/internal/config"
+	"github.com/hao/fxdns/internal/metrics"
 	"github.com/hao/fxdns/internal/util"
 	"github.com/miekg/dns"
 )
@@ -103,3 +104,180 @@ func TestCNAMEChainDetection(t *testing.T) {
 		t.Errorf("过滤后的响应应该包含 1 条 CDN IP 的 A 记录，但是包含了 %d 条", aCount)
 	}
 }
+
+func TestCNAMEChainFilterByMatcher(t *testing.T) {
+	resp := new(dns.Msg)
+	resp.Answer = []dns.RR{
+		&dns.CNAME{Hdr: dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET}, Target: "edge.cdn.net."},
+		&dns.CNAME{Hdr: dns.RR_Header{Name: "edge.cdn.net.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET}, Target: "node.cdn.net."},
+		&dns.CNAME{Hdr: dns.RR_Header{Name: "img.other.org.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET}, Target: "static.other.org."},
+		&dns.CNAME{Hdr: dns.RR_Header{Name: "a.unrelated.io.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET}, Target: "b.target.example.com."},
+	}
+	chain := NewCNAMEChain()
+	chain.BuildFromResponse(resp)
+
+	matcher := util.NewDomainMatcher()
+	matcher.AddPattern("*.example.com")
+
+	filtered := chain.FilterByMatcher(matcher)
+
+	// 源域名匹配
+	if filtered.GetTarget("www.example.com") != "edge.cdn.net" {
+		t.Error("源域名匹配的链接应该被保留")
+	}
+	// 目标域名匹配
+	if filtered.GetTarget("a.unrelated.io") != "b.target.example.com" {
+		t.Error("目标域名匹配的链接应该被保留")
+	}
+	// 两端都不匹配
+	if filtered.GetTarget("edge.cdn.net") != "" || filtered.Contains("node.cdn.net") {
+		t.Error("两端都不匹配的链接不应该被保留")
+	}
+	if filtered.Contains("img.other.org") || filtered.Contains("static.other.org") {
+		t.Error("无关的链接不应该被保留")
+	}
+	if len(filtered.GetAllDomains()) != 4 {
+		t.Errorf("过滤后的域名数量错误, 期望: 4, 实际: %d", len(filtered.GetAllDomains()))
+	}
+
+	// 原链不受影响
+	if len(chain.GetAllDomains()) != 7 {
+		t.Errorf("原 CNAME 链不应被修改, 域名数量: %d", len(chain.GetAllDomains()))
+	}
+}
+
+func TestEnforceSingleCNAME(t *testing.T) {
+	// 主上游按查询域名返回不同深度的 CNAME 链，最终解析到 CDN IP
+	primary := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		name := r.Question[0].Name
+		cname := func(owner, target string) {
+			m.Answer = append(m.Answer, &dns.CNAME{
+				Hdr:    dns.RR_Header{Name: owner, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300},
+				Target: target,
+			})
+		}
+		last := "edge.cdn.net."
+		switch name {
+		case "deep.example.com.", "deep.other.com.":
+			cname(name, "a.cdn.net.")
+			cname("a.cdn.net.", last)
+		default:
+			cname(name, last)
+		}
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: last, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+			A:   net.ParseIP("10.0.0.1"),
+		})
+		w.WriteMsg(m)
+	})
+	server := newTestServer(t, `
+upstream:
+  server: "`+primary+`"
+  timeout: 2s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    strategy: "filter_non_cdn"
+    enforce_single_cname: true
+`)
+
+	query := func(name string) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		w := &mockResponseWriter{}
+		server.ServeDNS(w, req)
+		if w.msg == nil {
+			t.Fatalf("%s 没有返回响应", name)
+		}
+		return w.msg
+	}
+
+	before := metrics.CNAMEViolations.Value()
+	if resp := query("deep.example.com."); resp.Rcode != dns.RcodeServerFailure {
+		t.Errorf("两层 CNAME 链应返回 SERVFAIL, 实际: %s", dns.RcodeToString[resp.Rcode])
+	}
+	if got := metrics.CNAMEViolations.Value() - before; got != 1 {
+		t.Errorf("CNAME 违规计数错误, 期望: 1, 实际: %d", got)
+	}
+	if resp := query("single.example.com."); resp.Rcode != dns.RcodeSuccess || len(resp.Answer) == 0 {
+		t.Errorf("一层 CNAME 应正常返回, 实际: %v", resp)
+	}
+	if resp := query("deep.other.com."); resp.Rcode != dns.RcodeSuccess {
+		t.Errorf("未开启 enforce_single_cname 的域名不应受限制, 实际: %s", dns.RcodeToString[resp.Rcode])
+	}
+}
+
+func TestCNAMEChainDepth(t *testing.T) {
+	chain := NewCNAMEChain()
+	chain.links["a.com"] = "b.com"
+	chain.links["b.com"] = "c.com"
+	chain.links["loop1.com"] = "loop2.com"
+	chain.links["loop2.com"] = "loop1.com"
+
+	for domain, want := range map[string]int{"a.com.": 2, "b.com": 1, "c.com": 0, "loop1.com": 2} {
+		if got := chain.Depth(domain); got != want {
+			t.Errorf("%s 的 CNAME 链深度错误, 期望: %d, 实际: %d", domain, want, got)
+		}
+	}
+}
+
+func TestCDNCIDROverride(t *testing.T) {
+	// 上游对所有查询返回全局 CDN 网段、规则专属网段与公网各一个地址
+	primary := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		for _, ip := range []string{"10.0.0.1", "172.16.0.1", "8.8.8.8"} {
+			m.Answer = append(m.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+				A:   net.ParseIP(ip),
+			})
+		}
+		w.WriteMsg(m)
+	})
+	server := newTestServer(t, `
+upstream:
+  server: "`+primary+`"
+  timeout: 2s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.cloudflare-backed.com"
+    strategy: "filter_non_cdn"
+    cdn_cidr_override: ["172.16.0.0/12"]
+  - pattern: "*.global.com"
+    strategy: "filter_non_cdn"
+`)
+
+	query := func(name string) []string {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		w := &mockResponseWriter{}
+		server.ServeDNS(w, req)
+		if w.msg == nil {
+			t.Fatalf("%s 没有返回响应", name)
+		}
+		var ips []string
+		for _, rr := range w.msg.Answer {
+			if a, ok := rr.(*dns.A); ok {
+				ips = append(ips, a.A.String())
+			}
+		}
+		return ips
+	}
+
+	if ips := query("www.cloudflare-backed.com."); len(ips) != 1 || ips[0] != "172.16.0.1" {
+		t.Errorf("配置了 cdn_cidr_override 的域名应只保留规则网段内的 IP, 实际: %v", ips)
+	}
+	if ips := query("www.global.com."); len(ips) != 1 || ips[0] != "10.0.0.1" {
+		t.Errorf("未配置 cdn_cidr_override 的域名应使用全局 cdn_ips, 实际: %v", ips)
+	}
+}
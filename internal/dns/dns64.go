@@ -0,0 +1,99 @@
+package dns
+
+import (
+	"log"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// dns64Applies 判断是否需要对请求做 DNS64 合成：配置了 server.dns64_prefix、查询类型为 AAAA，
+// 且域名未配置 force_a_only（该规则要求 AAAA 查询返回空响应）
+func (s *Server) dns64Applies(r *dns.Msg) bool {
+	if s.config.Server.DNS64Prefix == "" || len(r.Question) == 0 || r.Question[0].Qtype != dns.TypeAAAA {
+		return false
+	}
+	return !s.forceAOnly(r.Question[0].Name)
+}
+
+// dns64ResponseWriter 拦截 AAAA 查询的响应：为 NXDOMAIN 或不含 AAAA 记录时，以同一域名发起 A 查询，
+// 按 NAT64 前缀合成 AAAA 记录后写出；A 查询也没有结果时写出原响应
+type dns64ResponseWriter struct {
+	dns.ResponseWriter
+	server *Server
+	req    *dns.Msg
+}
+
+// WriteMsg 在需要时用合成的 AAAA 响应替换 m
+func (w *dns64ResponseWriter) WriteMsg(m *dns.Msg) error {
+	if synthesized := w.server.synthesizeDNS64(w.req, m, w.RemoteAddr()); synthesized != nil {
+		return w.ResponseWriter.WriteMsg(synthesized)
+	}
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// synthesizeDNS64 对 AAAA 请求 req 的响应 resp 做 DNS64 合成，不需要或无法合成时返回 nil。
+// A 查询走完整的处理流程（缓存、CDN 检测与过滤等），调用者应已持有工作池令牌
+func (s *Server) synthesizeDNS64(req, resp *dns.Msg, remote net.Addr) *dns.Msg {
+	if resp == nil || (resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError) {
+		return nil
+	}
+	for _, rr := range resp.Answer {
+		if rr.Header().Rrtype == dns.TypeAAAA {
+			return nil
+		}
+	}
+
+	_, prefix, err := net.ParseCIDR(s.config.Server.DNS64Prefix)
+	if err != nil {
+		return nil
+	}
+
+	aReq := req.Copy()
+	aReq.Question[0].Qtype = dns.TypeA
+	capture := &captureResponseWriter{remote: remote}
+	s.serveDNS(capture, aReq)
+	if capture.msg == nil || capture.msg.Rcode != dns.RcodeSuccess {
+		return nil
+	}
+
+	synthesized := capture.msg.Copy()
+	synthesized.Id = req.Id
+	synthesized.Question = req.Question
+	synthesized.Answer = synthesized.Answer[:0]
+	found := false
+	for _, rr := range capture.msg.Answer {
+		a, ok := rr.(*dns.A)
+		if !ok {
+			synthesized.Answer = append(synthesized.Answer, dns.Copy(rr))
+			continue
+		}
+		found = true
+		hdr := a.Hdr
+		hdr.Rrtype = dns.TypeAAAA
+		synthesized.Answer = append(synthesized.Answer, &dns.AAAA{Hdr: hdr, AAAA: embedIPv4(prefix, a.A)})
+	}
+	if !found {
+		return nil
+	}
+	log.Printf("DNS64: 由 A 记录合成 AAAA 响应: %s", req.Question[0].Name)
+	return synthesized
+}
+
+// embedIPv4 按 RFC 6052 第 2.2 节将 IPv4 地址嵌入 NAT64 前缀：从前缀末尾起依次写入 IPv4 的各字节，
+// 跳过 64-71 位的 u 字节。前缀长度须为 32/40/48/56/64/96 之一（由配置校验保证）
+func embedIPv4(prefix *net.IPNet, v4 net.IP) net.IP {
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, prefix.IP.To16())
+	ones, _ := prefix.Mask.Size()
+
+	pos := ones / 8
+	for _, b := range v4.To4() {
+		if pos == 8 {
+			pos++ // u 字节保持为 0
+		}
+		ip[pos] = b
+		pos++
+	}
+	return ip
+}
@@ -0,0 +1,122 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestEmbedIPv4(t *testing.T) {
+	// RFC 6052 第 2.4 节的示例
+	testCases := []struct {
+		prefix   string
+		expected string
+	}{
+		{"64:ff9b::/96", "64:ff9b::c000:221"},
+		{"2001:db8::/32", "2001:db8:c000:221::"},
+		{"2001:db8:100::/40", "2001:db8:1c0:2:21::"},
+		{"2001:db8:122::/48", "2001:db8:122:c000:2:2100::"},
+		{"2001:db8:122:300::/56", "2001:db8:122:3c0:0:221::"},
+		{"2001:db8:122:344::/64", "2001:db8:122:344:c0:2:2100:0"},
+		{"2001:db8:122:344::/96", "2001:db8:122:344::c000:221"},
+	}
+	for _, tc := range testCases {
+		_, prefix, err := net.ParseCIDR(tc.prefix)
+		if err != nil {
+			t.Fatalf("解析前缀 %s 失败: %v", tc.prefix, err)
+		}
+		got := embedIPv4(prefix, net.ParseIP("192.0.2.33"))
+		if !got.Equal(net.ParseIP(tc.expected)) {
+			t.Errorf("前缀 %s 合成结果错误, 期望: %s, 实际: %s", tc.prefix, tc.expected, got)
+		}
+	}
+}
+
+func TestDNS64(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		q := r.Question[0]
+		switch {
+		case q.Qtype == dns.TypeA:
+			w.WriteMsg(answerA(r, "10.1.1.1"))
+		case q.Name == "nx.example.com.":
+			m := new(dns.Msg)
+			m.SetRcode(r, dns.RcodeNameError)
+			w.WriteMsg(m)
+		case q.Name == "v6.example.com.":
+			m := new(dns.Msg)
+			m.SetReply(r)
+			m.Answer = append(m.Answer, &dns.AAAA{
+				Hdr:  dns.RR_Header{Name: q.Name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 300},
+				AAAA: net.ParseIP("2001:db8::1"),
+			})
+			w.WriteMsg(m)
+		default:
+			// 没有 AAAA 记录的 NOERROR 响应
+			m := new(dns.Msg)
+			m.SetReply(r)
+			w.WriteMsg(m)
+		}
+	})
+
+	testCases := []struct {
+		name     string
+		prefix   string
+		domain   string
+		expected string
+	}{
+		{"众所周知前缀", "64:ff9b::/96", "www.example.com.", "64:ff9b::a01:101"},
+		{"NXDOMAIN 时合成", "64:ff9b::/96", "nx.example.com.", "64:ff9b::a01:101"},
+		{"运营商前缀 /48", "2001:db8:122::/48", "www.example.com.", "2001:db8:122:a01:1:100::"},
+		{"已有 AAAA 记录时不合成", "64:ff9b::/96", "v6.example.com.", "2001:db8::1"},
+		{"force_a_only 域名不合成", "64:ff9b::/96", "a.noaaaa.example.com.", ""},
+		{"未配置前缀时不合成", "", "www.example.com.", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 1
+  cache_size: 10
+  cache_ttl: 60s
+  dns64_prefix: "`+tc.prefix+`"
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.noaaaa.example.com"
+    strategy: "filter_non_cdn"
+    force_a_only: true
+`)
+
+			req := new(dns.Msg)
+			req.SetQuestion(tc.domain, dns.TypeAAAA)
+			w := &mockResponseWriter{}
+			server.ServeDNS(w, req)
+			if w.msg == nil {
+				t.Fatal("未收到响应")
+			}
+			if w.msg.Id != req.Id || len(w.msg.Question) != 1 || w.msg.Question[0].Qtype != dns.TypeAAAA {
+				t.Errorf("响应头或问题段错误: %v", w.msg)
+			}
+
+			if tc.expected == "" {
+				if len(w.msg.Answer) != 0 {
+					t.Errorf("不应合成 AAAA 记录: %v", w.msg.Answer)
+				}
+				return
+			}
+			if w.msg.Rcode != dns.RcodeSuccess || len(w.msg.Answer) != 1 {
+				t.Fatalf("应返回一条 AAAA 记录: %v", w.msg)
+			}
+			aaaa, ok := w.msg.Answer[0].(*dns.AAAA)
+			if !ok || !aaaa.AAAA.Equal(net.ParseIP(tc.expected)) || aaaa.Hdr.Name != tc.domain {
+				t.Errorf("AAAA 记录错误, 期望: %s, 实际: %v", tc.expected, w.msg.Answer[0])
+			}
+		})
+	}
+}
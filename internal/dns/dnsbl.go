@@ -0,0 +1,41 @@
+package dns
+
+import (
+	"net"
+
+	"github.com/hao/fxdns/internal/util"
+	"github.com/miekg/dns"
+)
+
+// dnsblListedTTL 表示"已列入"的合成 A 记录的 TTL
+const dnsblListedTTL = 300
+
+// dnsblListedIP DNSBL 约定的"已列入"应答地址
+var dnsblListedIP = net.IPv4(127, 0, 0, 2)
+
+// dnsblResponse 查询名为 <反向 IP>.<区域> 且命中 server.dnsbl_zones 时构造本地响应：
+// A 查询返回 127.0.0.2，其他类型返回空的 NOERROR 响应。未命中时返回 nil，按普通查询处理
+func (s *Server) dnsblResponse(r *dns.Msg) *dns.Msg {
+	if len(r.Question) == 0 || s.dnsblMatcher == nil || s.dnsblMatcher.Count() == 0 {
+		return nil
+	}
+	q := r.Question[0]
+	if q.Qclass != dns.ClassINET {
+		return nil
+	}
+	reversedIP, zone, ok := util.SplitDNSBLName(q.Name)
+	if !ok || !s.dnsblMatcher.MatchDNSBL(reversedIP, zone) {
+		return nil
+	}
+
+	resp := new(dns.Msg)
+	resp.SetReply(r)
+	resp.Authoritative = true
+	if q.Qtype == dns.TypeA {
+		resp.Answer = append(resp.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: dnsblListedTTL},
+			A:   dnsblListedIP,
+		})
+	}
+	return resp
+}
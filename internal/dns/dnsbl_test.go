@@ -0,0 +1,85 @@
+package dns
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestDNSBLZones(t *testing.T) {
+	var forwarded atomic.Int32
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		forwarded.Add(1)
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeNameError)
+		w.WriteMsg(m)
+	})
+
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 200ms
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  dnsbl_zones:
+    - "*.10.dnsbl.internal"
+    - "2.0.0.127.dnsbl.internal"
+cdn_ips:
+  - "192.0.2.0/24"
+`)
+
+	testCases := []struct {
+		name          string
+		qname         string
+		qtype         uint16
+		expectListed  bool
+		expectForward bool
+	}{
+		{"前缀命中", "4.3.2.10.dnsbl.internal.", dns.TypeA, true, false},
+		{"精确命中", "2.0.0.127.DNSBL.internal.", dns.TypeA, true, false},
+		{"命中的非 A 查询", "4.3.2.10.dnsbl.internal.", dns.TypeTXT, false, false},
+		{"未列入的地址", "1.0.168.192.dnsbl.internal.", dns.TypeA, false, true},
+		{"不是反向 IP", "www.dnsbl.internal.", dns.TypeA, false, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			before := forwarded.Load()
+			req := new(dns.Msg)
+			req.SetQuestion(tc.qname, tc.qtype)
+			w := &mockResponseWriter{}
+			server.ServeDNS(w, req)
+			if w.msg == nil {
+				t.Fatal("未收到响应")
+			}
+
+			if tc.expectForward {
+				if forwarded.Load() == before {
+					t.Error("未命中的查询应转发上游")
+				}
+				return
+			}
+			if forwarded.Load() != before {
+				t.Error("命中 DNSBL 区域的查询不应转发上游")
+			}
+			if w.msg.Rcode != dns.RcodeSuccess {
+				t.Errorf("RCODE 错误, 期望 NOERROR, 实际: %s", dns.RcodeToString[w.msg.Rcode])
+			}
+			if !tc.expectListed {
+				if len(w.msg.Answer) != 0 {
+					t.Errorf("非 A 查询不应返回记录, 实际: %v", w.msg.Answer)
+				}
+				return
+			}
+			if len(w.msg.Answer) != 1 {
+				t.Fatalf("应返回 1 条记录, 实际: %v", w.msg.Answer)
+			}
+			if a, ok := w.msg.Answer[0].(*dns.A); !ok || a.A.String() != "127.0.0.2" {
+				t.Errorf("应返回 127.0.0.2, 实际: %v", w.msg.Answer[0])
+			}
+		})
+	}
+}
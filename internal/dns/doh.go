@@ -0,0 +1,148 @@
+package dns
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/miekg/dns"
+)
+
+// dohPath DoH 服务的查询路径 (RFC 8484)
+const dohPath = "/dns-query"
+
+// dohMediaType RFC 8484 规定的 DNS 消息媒体类型
+const dohMediaType = "application/dns-message"
+
+// startDoHServer 在配置了 server.doh_listen 时启动 DNS-over-HTTPS 服务。
+// 配置了 tls_cert / tls_key 时使用 HTTPS，否则使用明文 HTTP（适用于由反向代理终止 TLS 的部署）。
+// 调用此方法时，调用者应持有 s.mu 的锁。
+func (s *Server) startDoHServer() error {
+	addr := s.config.Server.DoHListen
+	if addr == "" {
+		return nil
+	}
+
+	var tlsConfig *tls.Config
+	if s.config.Server.TLSCert != "" && s.config.Server.TLSKey != "" {
+		var err error
+		if tlsConfig, err = s.loadTLSConfig("h2", "http/1.1"); err != nil {
+			return err
+		}
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("DoH 监听 %s 失败: %w", addr, err)
+	}
+	scheme := "http"
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+		scheme = "https"
+	} else {
+		log.Printf("DNS Server: 未配置 tls_cert / tls_key，DoH 服务使用明文 HTTP")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(dohPath, s)
+	dohServer := &http.Server{Handler: mux, TLSConfig: tlsConfig}
+	s.dohServer = dohServer
+	log.Printf("DNS Server: 已成功在 %s (doh, %s) 启动监听", ln.Addr().String(), scheme)
+
+	go func() {
+		if err := dohServer.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("DNS Server: DoH 服务在 %s 异常退出: %v", ln.Addr().String(), err)
+		}
+	}()
+	return nil
+}
+
+// stopDoHServer 关闭 DoH 服务。调用此方法时，调用者应持有 s.mu 的锁。
+func (s *Server) stopDoHServer() {
+	if s.dohServer == nil {
+		return
+	}
+	if err := s.dohServer.Close(); err != nil {
+		log.Printf("DNS Server: 关闭 DoH 服务失败: %v", err)
+	}
+	s.dohServer = nil
+}
+
+// ServeHTTP 实现 RFC 8484 DNS-over-HTTPS：支持 POST (application/dns-message 请求体)
+// 与 GET (?dns=<base64url>) 两种方式，查询经由 ServeDNS 处理，与 UDP/TCP 共用工作池与缓存
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf []byte
+	switch r.Method {
+	case http.MethodGet:
+		var err error
+		if buf, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns")); err != nil || len(buf) == 0 {
+			http.Error(w, "invalid dns parameter", http.StatusBadRequest)
+			return
+		}
+	case http.MethodPost:
+		if r.Header.Get("Content-Type") != dohMediaType {
+			http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		var err error
+		if buf, err = io.ReadAll(io.LimitReader(r.Body, dns.MaxMsgSize)); err != nil {
+			http.Error(w, "read body failed", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req := new(dns.Msg)
+	if err := req.Unpack(buf); err != nil || len(req.Question) == 0 {
+		http.Error(w, "invalid dns message", http.StatusBadRequest)
+		return
+	}
+
+	var remote net.Addr
+	if host, port, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		p, _ := strconv.Atoi(port)
+		remote = &net.TCPAddr{IP: net.ParseIP(host), Port: p}
+	}
+	resp, err := s.query(req, remote)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// 开启 doh_response_padding 时将响应填充到块大小的整数倍，避免响应长度暴露记录数量
+	if cfg := s.currentConfig(); cfg.Server.DoHResponsePadding {
+		resp = padResponse(req, resp, dohPaddingBlockSize(&cfg.Server))
+	}
+	out, err := resp.Pack()
+	if err != nil {
+		http.Error(w, "pack response failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", dohMediaType)
+	// RFC 8484 第 5.1 节：HTTP 缓存有效期不应超过响应中记录的最小 TTL
+	if ttl, ok := minAnswerTTL(resp); ok {
+		w.Header().Set("Cache-Control", "max-age="+strconv.FormatUint(uint64(ttl), 10))
+	}
+	w.Write(out)
+}
+
+// minAnswerTTL 返回响应应答段中最小的 TTL，没有记录时第二个返回值为 false
+func minAnswerTTL(resp *dns.Msg) (uint32, bool) {
+	if len(resp.Answer) == 0 {
+		return 0, false
+	}
+	ttl := resp.Answer[0].Header().Ttl
+	for _, rr := range resp.Answer[1:] {
+		if rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+	}
+	return ttl, true
+}
@@ -0,0 +1,131 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// dohExchange 解析 DoH 响应体中的 DNS 消息
+func dohExchange(t *testing.T, resp *http.Response) *dns.Msg {
+	t.Helper()
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("状态码错误, 期望: 200, 实际: %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != dohMediaType {
+		t.Fatalf("Content-Type 错误, 期望: %s, 实际: %s", dohMediaType, ct)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("读取响应失败: %v", err)
+	}
+	msg := new(dns.Msg)
+	if err := msg.Unpack(body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	return msg
+}
+
+func TestDoHServeHTTP(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answerA(r, "10.1.1.1"))
+	})
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	buf, err := req.Pack()
+	if err != nil {
+		t.Fatalf("打包请求失败: %v", err)
+	}
+
+	// POST
+	resp, err := http.Post(ts.URL+dohPath, dohMediaType, bytes.NewReader(buf))
+	if err != nil {
+		t.Fatalf("POST 请求失败: %v", err)
+	}
+	msg := dohExchange(t, resp)
+	if msg.Id != req.Id || len(msg.Answer) != 1 || msg.Answer[0].(*dns.A).A.String() != "10.1.1.1" {
+		t.Errorf("POST 响应错误: %v", msg)
+	}
+
+	// GET
+	resp, err = http.Get(ts.URL + dohPath + "?dns=" + base64.RawURLEncoding.EncodeToString(buf))
+	if err != nil {
+		t.Fatalf("GET 请求失败: %v", err)
+	}
+	if cc := resp.Header.Get("Cache-Control"); cc == "" {
+		t.Errorf("响应应包含 Cache-Control")
+	}
+	msg = dohExchange(t, resp)
+	if len(msg.Answer) != 1 || msg.Answer[0].(*dns.A).A.String() != "10.1.1.1" {
+		t.Errorf("GET 响应错误: %v", msg)
+	}
+
+	// DoH 查询应出现在查询记录中，客户端地址取自 HTTP 连接
+	entries := server.queryLog.Recent(1)
+	if len(entries) != 1 || entries[0].Domain != "www.example.com" || entries[0].ClientIP != "127.0.0.1" {
+		t.Errorf("查询记录错误: %+v", entries)
+	}
+}
+
+func TestDoHServeHTTPErrors(t *testing.T) {
+	server := newTestServer(t, `
+upstream:
+  server: "127.0.0.1:1"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 1
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+
+	testCases := []struct {
+		name     string
+		req      *http.Request
+		expected int
+	}{
+		{"不支持的方法", httptest.NewRequest(http.MethodPut, dohPath, nil), http.StatusMethodNotAllowed},
+		{"缺少 dns 参数", httptest.NewRequest(http.MethodGet, dohPath, nil), http.StatusBadRequest},
+		{"无效的 base64", httptest.NewRequest(http.MethodGet, dohPath+"?dns=!!!", nil), http.StatusBadRequest},
+		{"错误的 Content-Type", func() *http.Request {
+			r := httptest.NewRequest(http.MethodPost, dohPath, bytes.NewReader([]byte{0}))
+			r.Header.Set("Content-Type", "text/plain")
+			return r
+		}(), http.StatusUnsupportedMediaType},
+		{"无效的 DNS 消息", func() *http.Request {
+			r := httptest.NewRequest(http.MethodPost, dohPath, bytes.NewReader([]byte{1, 2, 3}))
+			r.Header.Set("Content-Type", dohMediaType)
+			return r
+		}(), http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, tc.req)
+		if rec.Code != tc.expected {
+			t.Errorf("%s: 状态码错误, 期望: %d, 实际: %d", tc.name, tc.expected, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// DoQ (RFC 9250) 相关常量
+const (
+	doqALPN          = "doq"
+	doqProtocolError = quic.ApplicationErrorCode(0x2)
+)
+
+// loadTLSConfig 根据 server.tls_cert / server.tls_key 加载 TLS 配置
+func (s *Server) loadTLSConfig(nextProtos ...string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(s.config.Server.TLSCert, s.config.Server.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("加载 TLS 证书失败: %w", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   nextProtos,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// startDoQServer 启动 DNS-over-QUIC 服务。调用此方法时，调用者应持有 s.mu 的锁。
+func (s *Server) startDoQServer() error {
+	tlsConfig, err := s.loadTLSConfig(doqALPN)
+	if err != nil {
+		return err
+	}
+	// DoQ 要求 TLS 1.3
+	tlsConfig.MinVersion = tls.VersionTLS13
+
+	listener, err := quic.ListenAddr(s.config.Server.Listen, tlsConfig, &quic.Config{})
+	if err != nil {
+		return fmt.Errorf("DoQ 监听 %s 失败: %w", s.config.Server.Listen, err)
+	}
+	s.doqListener = listener
+	log.Printf("DNS Server: 已成功在 %s (doq) 启动监听", listener.Addr().String())
+
+	go s.acceptDoQ(listener)
+	return nil
+}
+
+// stopDoQServer 关闭 DoQ 监听。调用此方法时，调用者应持有 s.mu 的锁。
+func (s *Server) stopDoQServer() {
+	if s.doqListener == nil {
+		return
+	}
+	if err := s.doqListener.Close(); err != nil {
+		log.Printf("DNS Server: 关闭 DoQ 监听失败: %v", err)
+	}
+	s.doqListener = nil
+}
+
+// acceptDoQ 接收 QUIC 连接，直到监听被关闭
+func (s *Server) acceptDoQ(listener *quic.Listener) {
+	for {
+		conn, err := listener.Accept(context.Background())
+		if err != nil {
+			log.Printf("DNS Server: DoQ 监听 %s 已停止: %v", listener.Addr().String(), err)
+			return
+		}
+		go s.serveDoQConn(conn)
+	}
+}
+
+// serveDoQConn 处理单个 QUIC 连接，每个双向流承载一次 DNS 查询
+func (s *Server) serveDoQConn(conn quic.Connection) {
+	for {
+		stream, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		go s.serveDoQStream(conn, stream)
+	}
+}
+
+// serveDoQStream 读取带 2 字节长度前缀的 DNS 消息，交由 ServeDNS 处理
+func (s *Server) serveDoQStream(conn quic.Connection, stream quic.Stream) {
+	defer stream.Close()
+
+	var lenBuf [2]byte
+	if _, err := io.ReadFull(stream, lenBuf[:]); err != nil {
+		log.Printf("DNS Server: 读取 DoQ 消息长度失败 (%s): %v", conn.RemoteAddr(), err)
+		conn.CloseWithError(doqProtocolError, "invalid message length")
+		return
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(lenBuf[:]))
+	if _, err := io.ReadFull(stream, buf); err != nil {
+		log.Printf("DNS Server: 读取 DoQ 消息失败 (%s): %v", conn.RemoteAddr(), err)
+		conn.CloseWithError(doqProtocolError, "truncated message")
+		return
+	}
+
+	req := new(dns.Msg)
+	if err := req.Unpack(buf); err != nil || len(req.Question) == 0 {
+		log.Printf("DNS Server: 解析 DoQ 消息失败 (%s): %v", conn.RemoteAddr(), err)
+		conn.CloseWithError(doqProtocolError, "malformed message")
+		return
+	}
+
+	s.ServeDNS(&doqResponseWriter{conn: conn, stream: stream}, req)
+}
+
+// doqResponseWriter 在 QUIC 流上实现 dns.ResponseWriter
+type doqResponseWriter struct {
+	conn   quic.Connection
+	stream quic.Stream
+}
+
+func (w *doqResponseWriter) LocalAddr() net.Addr { return w.conn.LocalAddr() }
+
+// RemoteAddr 返回客户端地址，Network() 为 "quic"，以便与普通 UDP 查询区分
+func (w *doqResponseWriter) RemoteAddr() net.Addr {
+	if addr, ok := w.conn.RemoteAddr().(*net.UDPAddr); ok {
+		return doqAddr{addr}
+	}
+	return w.conn.RemoteAddr()
+}
+
+// doqAddr DoQ 客户端地址。QUIC 基于 UDP，但 DNS 消息经可靠的流传输，不受 UDP 报文大小限制
+type doqAddr struct {
+	*net.UDPAddr
+}
+
+// Network 返回 "quic"
+func (doqAddr) Network() string { return "quic" }
+
+// WriteMsg 打包并写出 DNS 消息
+func (w *doqResponseWriter) WriteMsg(m *dns.Msg) error {
+	buf, err := m.Pack()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// Write 写出带 2 字节长度前缀的原始消息
+func (w *doqResponseWriter) Write(b []byte) (int, error) {
+	if len(b) > dns.MaxMsgSize {
+		return 0, fmt.Errorf("DoQ 消息过大: %d", len(b))
+	}
+	out := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(out, uint16(len(b)))
+	copy(out[2:], b)
+	if _, err := w.stream.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close 关闭当前流（发送 FIN），连接保持以便复用
+func (w *doqResponseWriter) Close() error { return w.stream.Close() }
+
+func (w *doqResponseWriter) TsigStatus() error   { return errTSIGUnverified }
+func (w *doqResponseWriter) TsigTimersOnly(bool) {}
+func (w *doqResponseWriter) Hijack()             {}
@@ -0,0 +1,198 @@
+package dns
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// writeTestCert 生成自签名证书并写入临时目录，返回证书与私钥路径
+func writeTestCert(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("生成私钥失败: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "fxdns-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("生成证书失败: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("序列化私钥失败: %v", err)
+	}
+
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certPath, keyPath
+}
+
+// doqExchange 通过 DoQ 发送一次查询
+func doqExchange(t *testing.T, addr string, req *dns.Msg) *dns.Msg {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	conn, err := quic.DialAddr(ctx, addr, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{doqALPN}}, nil)
+	if err != nil {
+		t.Fatalf("建立 DoQ 连接失败: %v", err)
+	}
+	defer conn.CloseWithError(0, "")
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatalf("打开 DoQ 流失败: %v", err)
+	}
+	buf, err := req.Pack()
+	if err != nil {
+		t.Fatalf("打包请求失败: %v", err)
+	}
+	out := make([]byte, 2+len(buf))
+	binary.BigEndian.PutUint16(out, uint16(len(buf)))
+	copy(out[2:], buf)
+	if _, err := stream.Write(out); err != nil {
+		t.Fatalf("写入 DoQ 请求失败: %v", err)
+	}
+	stream.Close()
+
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("读取 DoQ 响应失败: %v", err)
+	}
+	if len(data) < 2 || int(binary.BigEndian.Uint16(data)) != len(data)-2 {
+		t.Fatalf("DoQ 响应长度前缀错误: %d 字节", len(data))
+	}
+	resp := new(dns.Msg)
+	if err := resp.Unpack(data[2:]); err != nil {
+		t.Fatalf("解析 DoQ 响应失败: %v", err)
+	}
+	return resp
+}
+
+func TestDoQServer(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answerA(r, "10.1.1.1"))
+	})
+	certPath, keyPath := writeTestCert(t)
+
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  network: "doq"
+  tls_cert: "`+certPath+`"
+  tls_key: "`+keyPath+`"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    strategy: "filter_non_cdn"
+`)
+	if err := server.Start(); err != nil {
+		t.Fatalf("启动服务器失败: %v", err)
+	}
+	defer server.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := server.WaitReady(ctx); err != nil {
+		t.Fatalf("等待 DoQ 监听就绪失败: %v", err)
+	}
+	addr := server.ListenAddr()
+
+	for i := 0; i < 2; i++ {
+		req := new(dns.Msg)
+		req.SetQuestion("www.example.com.", dns.TypeA)
+		req.Id = 0 // RFC 9250 要求 DoQ 消息 ID 为 0
+		resp := doqExchange(t, addr, req)
+		if len(resp.Answer) != 1 {
+			t.Fatalf("DoQ 响应记录数量错误, 期望: 1, 实际: %d", len(resp.Answer))
+		}
+		if a, ok := resp.Answer[0].(*dns.A); !ok || a.A.String() != "10.1.1.1" {
+			t.Errorf("DoQ 响应记录错误: %v", resp.Answer[0])
+		}
+	}
+}
+
+func TestDoQMaxResponseIPs(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		for i := 1; i <= 5; i++ {
+			m.Answer = append(m.Answer, answerA(r, fmt.Sprintf("10.0.0.%d", i)).Answer...)
+		}
+		w.WriteMsg(m)
+	})
+	certPath, keyPath := writeTestCert(t)
+
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  network: "doq"
+  tls_cert: "`+certPath+`"
+  tls_key: "`+keyPath+`"
+  workers: 2
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    strategy: "filter_non_cdn"
+    max_response_ips: 2
+`)
+	if err := server.Start(); err != nil {
+		t.Fatalf("启动服务器失败: %v", err)
+	}
+	defer server.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := server.WaitReady(ctx); err != nil {
+		t.Fatalf("等待 DoQ 监听就绪失败: %v", err)
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	req.Id = 0
+	resp := doqExchange(t, server.ListenAddr(), req)
+	// DoQ 不受 UDP 报文大小限制，max_response_ips 不生效
+	if len(resp.Answer) != 5 || resp.Truncated {
+		t.Errorf("DoQ 响应不应被截断, 记录数: %d, TC=%v", len(resp.Answer), resp.Truncated)
+	}
+}
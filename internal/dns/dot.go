@@ -0,0 +1,105 @@
+package dns
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+)
+
+// dotALPN DNS-over-TLS (RFC 7858) 的 ALPN 标识
+const dotALPN = "dot"
+
+// startDoTServer 在配置了 server.dot_listen 时启动 DNS-over-TLS 服务。
+// 调用此方法时，调用者应持有 s.mu 的锁。
+func (s *Server) startDoTServer() error {
+	addr := s.config.Server.DoTListen
+	if addr == "" {
+		return nil
+	}
+
+	tlsConfig, err := s.loadTLSConfig(dotALPN)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("DoT 监听 %s 失败: %w", addr, err)
+	}
+
+	dotServer := &dns.Server{
+		Net:           "tcp-tls",
+		Listener:      tls.NewListener(&countingListener{Listener: ln, active: &s.dotConns}, tlsConfig),
+		Handler:       s,
+		MsgAcceptFunc: msgAcceptFunc,
+		TsigProvider:  updateTSIGProvider{s},
+	}
+	s.dotServer = dotServer
+	log.Printf("DNS Server: 已成功在 %s (dot) 启动监听", ln.Addr().String())
+
+	go func() {
+		if err := dotServer.ActivateAndServe(); err != nil {
+			log.Printf("DNS Server: DoT 服务在 %s 异常退出: %v", ln.Addr().String(), err)
+		}
+	}()
+	return nil
+}
+
+// stopDoTServer 关闭 DoT 监听。调用此方法时，调用者应持有 s.mu 的锁。
+func (s *Server) stopDoTServer() {
+	if s.dotServer == nil {
+		return
+	}
+	if err := s.dotServer.Shutdown(); err != nil {
+		log.Printf("DNS Server: 关闭 DoT 服务失败: %v", err)
+	}
+	s.dotServer = nil
+}
+
+// DoTAddr 返回 DoT 服务实际绑定的地址，未启用时返回空字符串
+func (s *Server) DoTAddr() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.dotServer == nil || s.dotServer.Listener == nil {
+		return ""
+	}
+	return s.dotServer.Listener.Addr().String()
+}
+
+// DoTConnections 返回当前活跃的 DoT 连接数
+func (s *Server) DoTConnections() int64 {
+	return s.dotConns.Load()
+}
+
+// countingListener 统计经由该监听建立且尚未关闭的连接数
+type countingListener struct {
+	net.Listener
+	active *atomic.Int64
+}
+
+// Accept 接收连接并计数
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	l.active.Add(1)
+	return &countedConn{Conn: conn, active: l.active}, nil
+}
+
+// countedConn 在首次关闭时减少活跃连接计数
+type countedConn struct {
+	net.Conn
+	active *atomic.Int64
+	once   sync.Once
+}
+
+// Close 关闭连接
+func (c *countedConn) Close() error {
+	c.once.Do(func() { c.active.Add(-1) })
+	return c.Conn.Close()
+}
@@ -0,0 +1,95 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestDoTServer(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answerA(r, "10.1.1.1"))
+	})
+	certPath, keyPath := writeTestCert(t)
+
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  dot_listen: "127.0.0.1:0"
+  tls_cert: "`+certPath+`"
+  tls_key: "`+keyPath+`"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+	if err := server.Start(); err != nil {
+		t.Fatalf("启动服务器失败: %v", err)
+	}
+	defer server.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := server.WaitReady(ctx); err != nil {
+		t.Fatalf("等待监听就绪失败: %v", err)
+	}
+	addr := server.DoTAddr()
+	if addr == "" {
+		t.Fatal("DoT 服务未启动")
+	}
+
+	client := &dns.Client{
+		Net:       "tcp-tls",
+		Timeout:   3 * time.Second,
+		TLSConfig: &tls.Config{InsecureSkipVerify: true, NextProtos: []string{dotALPN}},
+	}
+	conn, err := client.Dial(addr)
+	if err != nil {
+		t.Fatalf("建立 DoT 连接失败: %v", err)
+	}
+
+	// 同一连接上可以发送多次查询
+	for i := 0; i < 2; i++ {
+		req := new(dns.Msg)
+		req.SetQuestion("www.example.com.", dns.TypeA)
+		resp, _, err := client.ExchangeWithConn(req, conn)
+		if err != nil {
+			t.Fatalf("DoT 查询失败: %v", err)
+		}
+		if len(resp.Answer) != 1 {
+			t.Fatalf("DoT 响应记录数量错误, 期望: 1, 实际: %d", len(resp.Answer))
+		}
+		if a, ok := resp.Answer[0].(*dns.A); !ok || a.A.String() != "10.1.1.1" {
+			t.Errorf("DoT 响应记录错误: %v", resp.Answer[0])
+		}
+	}
+
+	status := server.Status()
+	if status.DoTConnections != 1 {
+		t.Errorf("DoT 连接数错误, 期望: 1, 实际: %d", status.DoTConnections)
+	}
+	if status.DoTListen != addr {
+		t.Errorf("状态中的 DoT 地址错误, 期望: %s, 实际: %s", addr, status.DoTListen)
+	}
+
+	conn.Close()
+	deadline := time.Now().Add(3 * time.Second)
+	for server.DoTConnections() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := server.DoTConnections(); n != 0 {
+		t.Errorf("连接关闭后 DoT 连接数应为 0, 实际: %d", n)
+	}
+
+	server.Stop()
+	if server.DoTAddr() != "" {
+		t.Error("Stop 后 DoT 服务应已关闭")
+	}
+}
@@ -0,0 +1,152 @@
+package dns
+
+import (
+	"net"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/miekg/dns"
+)
+
+// clientIPFromAddr 从客户端地址中提取 IP
+func clientIPFromAddr(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.TCPAddr:
+		return a.IP
+	case doqAddr:
+		return a.IP
+	case nil:
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return net.ParseIP(host)
+}
+
+// ecsSubnet 返回 ip 按源前缀长度截断后的子网，超出范围的前缀长度使用默认值，0 保留（不透露子网）
+func ecsSubnet(ip net.IP, prefixLenV4, prefixLenV6 int) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		if prefixLenV4 < 0 || prefixLenV4 > 32 {
+			prefixLenV4 = config.DefaultECSPrefixLenV4
+		}
+		mask := net.CIDRMask(prefixLenV4, 32)
+		return &net.IPNet{IP: ip4.Mask(mask), Mask: mask}
+	}
+	if prefixLenV6 < 0 || prefixLenV6 > 128 {
+		prefixLenV6 = config.DefaultECSPrefixLenV6
+	}
+	mask := net.CIDRMask(prefixLenV6, 128)
+	return &net.IPNet{IP: ip.To16().Mask(mask), Mask: mask}
+}
+
+// setClientSubnet 在消息的 OPT 记录中添加（或替换）EDNS Client Subnet 选项
+func setClientSubnet(msg *dns.Msg, ip net.IP, prefixLenV4, prefixLenV6 int) {
+	if ip == nil {
+		return
+	}
+	network := ecsSubnet(ip, prefixLenV4, prefixLenV6)
+	ones, bits := network.Mask.Size()
+	subnet := &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: uint8(ones), Address: network.IP}
+	if bits == 128 {
+		subnet.Family = 2
+	}
+
+	opt := msg.IsEdns0()
+	if opt == nil {
+		msg.SetEdns0(dns.DefaultMsgSize, false)
+		opt = msg.IsEdns0()
+	}
+
+	// 移除已有的 ECS 选项，避免向上游透传客户端（或前级代理）自带的子网
+	options := make([]dns.EDNS0, 0, len(opt.Option)+1)
+	for _, o := range opt.Option {
+		if o.Option() != dns.EDNS0SUBNET {
+			options = append(options, o)
+		}
+	}
+	opt.Option = append(options, subnet)
+}
+
+// upstreamQuery 构造发往上游的查询，按配置设置 CD 位并注入客户端子网。均未启用时直接返回原请求。
+func (s *Server) upstreamQuery(w dns.ResponseWriter, r *dns.Msg) *dns.Msg {
+	var ip net.IP
+	if s.config.Upstream.InjectECS {
+		ip = clientIPFromAddr(w.RemoteAddr())
+	}
+	if ip == nil && !s.config.Upstream.CDBit {
+		return r
+	}
+	query := r.Copy()
+	if s.config.Upstream.CDBit {
+		query.CheckingDisabled = true
+	}
+	if ip != nil {
+		setClientSubnet(query, ip, s.config.Upstream.ECSPrefixLenV4(), s.config.Upstream.ECSPrefixLenV6())
+	}
+	return query
+}
+
+// ecsCacheView 返回注入 ECS 时使用的缓存视图：上游可能按子网返回不同的应答，
+// 因此在 view 后附加客户端的源子网，使不同子网的应答分别缓存
+func (s *Server) ecsCacheView(view string, ip net.IP) string {
+	subnet := ecsSubnet(ip, s.config.Upstream.ECSPrefixLenV4(), s.config.Upstream.ECSPrefixLenV6())
+	if view == "" {
+		return "ecs:" + subnet.String()
+	}
+	return view + ",ecs:" + subnet.String()
+}
+
+// ecsResponseWriter 在注入 ECS 时包装 ResponseWriter。上游响应中的 OPT 记录对应的是代为注入的子网，
+// 写出前按客户端原始请求还原：未使用 EDNS 的客户端去掉 OPT 记录，未携带 ECS 的客户端去掉 ECS 选项，
+// 携带了 ECS 的客户端按 RFC 7871 回显其原始选项，作用域前缀取上游返回值且不超过源前缀长度
+type ecsResponseWriter struct {
+	dns.ResponseWriter
+	clientOPT *dns.OPT
+}
+
+// WriteMsg 还原 OPT 记录后写出响应，m 可能同时写入了缓存，因此在副本上修改
+func (w *ecsResponseWriter) WriteMsg(m *dns.Msg) error {
+	m = m.Copy()
+	if w.clientOPT == nil {
+		extra := m.Extra[:0]
+		for _, rr := range m.Extra {
+			if rr.Header().Rrtype != dns.TypeOPT {
+				extra = append(extra, rr)
+			}
+		}
+		m.Extra = extra
+		return w.ResponseWriter.WriteMsg(m)
+	}
+
+	opt := m.IsEdns0()
+	if opt == nil {
+		return w.ResponseWriter.WriteMsg(m)
+	}
+	var upstreamSubnet *dns.EDNS0_SUBNET
+	options := make([]dns.EDNS0, 0, len(opt.Option))
+	for _, o := range opt.Option {
+		if subnet, ok := o.(*dns.EDNS0_SUBNET); ok {
+			upstreamSubnet = subnet
+			continue
+		}
+		options = append(options, o)
+	}
+	for _, o := range w.clientOPT.Option {
+		clientSubnet, ok := o.(*dns.EDNS0_SUBNET)
+		if !ok {
+			continue
+		}
+		echo := *clientSubnet
+		echo.SourceScope = 0
+		if upstreamSubnet != nil {
+			echo.SourceScope = min(upstreamSubnet.SourceScope, clientSubnet.SourceNetmask)
+		}
+		options = append(options, &echo)
+		break
+	}
+	opt.Option = options
+	return w.ResponseWriter.WriteMsg(m)
+}
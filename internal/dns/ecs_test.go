@@ -0,0 +1,240 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// clientSubnet 返回消息中的 ECS 选项
+func clientSubnet(msg *dns.Msg) *dns.EDNS0_SUBNET {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	for _, o := range opt.Option {
+		if subnet, ok := o.(*dns.EDNS0_SUBNET); ok {
+			return subnet
+		}
+	}
+	return nil
+}
+
+func TestSetClientSubnet(t *testing.T) {
+	testCases := []struct {
+		name     string
+		ip       string
+		v4, v6   int
+		expected string
+		netmask  uint8
+	}{
+		{"IPv4 超出范围时使用默认前缀", "203.0.113.77", -1, -1, "203.0.113.0", 24},
+		{"IPv4 自定义前缀", "203.0.113.77", 16, 0, "203.0.0.0", 16},
+		{"IPv4 前缀 0 不透露子网", "203.0.113.77", 0, 56, "0.0.0.0", 0},
+		{"IPv6 超出范围时使用默认前缀", "2001:db8:1234:5678::1", 24, 129, "2001:db8:1234:5600::", 56},
+		{"IPv6 自定义前缀", "2001:db8:1234:5678::1", 0, 48, "2001:db8:1234::", 48},
+		{"IPv6 前缀 0 不透露子网", "2001:db8:1234:5678::1", 24, 0, "::", 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := new(dns.Msg)
+			msg.SetQuestion("example.com.", dns.TypeA)
+			setClientSubnet(msg, net.ParseIP(tc.ip), tc.v4, tc.v6)
+
+			subnet := clientSubnet(msg)
+			if subnet == nil {
+				t.Fatal("未注入 ECS 选项")
+			}
+			if subnet.Address.String() != tc.expected || subnet.SourceNetmask != tc.netmask {
+				t.Errorf("ECS 错误, 期望: %s/%d, 实际: %s/%d", tc.expected, tc.netmask, subnet.Address, subnet.SourceNetmask)
+			}
+		})
+	}
+
+	// 已有 ECS 选项时应被替换，其它 EDNS0 选项保留
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeA)
+	msg.SetEdns0(4096, true)
+	opt := msg.IsEdns0()
+	opt.Option = append(opt.Option,
+		&dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 24, Address: net.ParseIP("198.51.100.0").To4()},
+		&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "0123456789abcdef"},
+	)
+	setClientSubnet(msg, net.ParseIP("192.0.2.10"), 24, 56)
+
+	subnets := 0
+	for _, o := range msg.IsEdns0().Option {
+		if _, ok := o.(*dns.EDNS0_SUBNET); ok {
+			subnets++
+		}
+	}
+	if subnets != 1 || clientSubnet(msg).Address.String() != "192.0.2.0" {
+		t.Errorf("已有 ECS 选项应被替换, 数量: %d, 地址: %s", subnets, clientSubnet(msg).Address)
+	}
+	if len(msg.IsEdns0().Option) != 2 || !msg.IsEdns0().Do() {
+		t.Error("其它 EDNS0 选项和标志位应保留")
+	}
+}
+
+func TestInjectECS(t *testing.T) {
+	seen := make(chan *dns.EDNS0_SUBNET, 1)
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		seen <- clientSubnet(r)
+		w.WriteMsg(answerA(r, "10.1.1.1"))
+	})
+
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  inject_ecs: true
+  ecs_source_prefix_len_v4: 24
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	w := &mockResponseWriter{}
+	server.ServeDNS(w, req)
+
+	subnet := <-seen
+	if subnet == nil {
+		t.Fatal("上游未收到 ECS 选项")
+	}
+	// mockResponseWriter 的客户端地址为 127.0.0.1
+	if subnet.Address.String() != "127.0.0.0" || subnet.SourceNetmask != 24 {
+		t.Errorf("上游收到的 ECS 错误: %s/%d", subnet.Address, subnet.SourceNetmask)
+	}
+	// 客户端原始请求不应被修改
+	if req.IsEdns0() != nil {
+		t.Error("客户端原始请求不应被注入 ECS")
+	}
+}
+
+// ecsClientWriter 以指定的客户端地址写出响应
+type ecsClientWriter struct {
+	mockResponseWriter
+	addr net.Addr
+}
+
+func (w *ecsClientWriter) RemoteAddr() net.Addr {
+	return w.addr
+}
+
+func TestInjectECSCacheAndOPT(t *testing.T) {
+	// 上游按 ECS 子网返回不同的应答，并在响应中回显注入的 ECS 选项
+	queries := make(chan string, 10)
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		subnet := clientSubnet(r)
+		queries <- subnet.Address.String()
+		ip := "10.1.1.1"
+		if subnet.Address.String() == "198.51.100.0" {
+			ip = "10.2.2.2"
+		}
+		m := answerA(r, ip)
+		m.SetEdns0(4096, false)
+		echo := *subnet
+		echo.SourceScope = 24
+		m.IsEdns0().Option = append(m.IsEdns0().Option, &echo)
+		w.WriteMsg(m)
+	})
+
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  inject_ecs: true
+  timeout: 2s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+
+	query := func(client string, edns bool) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion("www.example.com.", dns.TypeA)
+		if edns {
+			req.SetEdns0(4096, false)
+		}
+		w := &ecsClientWriter{addr: &net.UDPAddr{IP: net.ParseIP(client), Port: 5353}}
+		server.ServeDNS(w, req)
+		if w.msg == nil {
+			t.Fatalf("%s 的查询没有返回响应", client)
+		}
+		return w.msg
+	}
+
+	// 不同子网的客户端不应共用缓存的应答
+	first := query("203.0.113.7", false)
+	second := query("198.51.100.7", false)
+	if got := first.Answer[0].(*dns.A).A.String(); got != "10.1.1.1" {
+		t.Errorf("203.0.113.7 的应答错误: %s", got)
+	}
+	if got := second.Answer[0].(*dns.A).A.String(); got != "10.2.2.2" {
+		t.Errorf("198.51.100.7 的应答不应来自其他子网的缓存: %s", got)
+	}
+	if len(queries) != 2 {
+		t.Errorf("不同子网应分别查询上游, 实际查询次数: %d", len(queries))
+	}
+
+	// 同一子网的客户端命中缓存
+	query("203.0.113.200", false)
+	if len(queries) != 2 {
+		t.Errorf("同一子网的查询应命中缓存, 实际查询次数: %d", len(queries))
+	}
+
+	// 未使用 EDNS 的客户端不应收到 OPT 记录
+	if first.IsEdns0() != nil {
+		t.Error("未使用 EDNS 的客户端不应收到上游的 OPT 记录")
+	}
+	// 使用 EDNS 但未携带 ECS 的客户端不应收到代为注入的 ECS 选项
+	resp := query("203.0.113.7", true)
+	if resp.IsEdns0() == nil {
+		t.Fatal("使用 EDNS 的客户端应收到 OPT 记录")
+	}
+	if clientSubnet(resp) != nil {
+		t.Errorf("未携带 ECS 的客户端不应收到 ECS 选项: %v", clientSubnet(resp))
+	}
+}
+
+func TestInjectECSZeroPrefix(t *testing.T) {
+	seen := make(chan *dns.EDNS0_SUBNET, 1)
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		seen <- clientSubnet(r)
+		w.WriteMsg(answerA(r, "10.1.1.1"))
+	})
+
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  inject_ecs: true
+  ecs_source_prefix_len_v4: 0
+  timeout: 2s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	server.ServeDNS(&mockResponseWriter{}, req)
+
+	// 显式配置的 0 表示不透露客户端子网，不应被替换为默认的 24
+	subnet := <-seen
+	if subnet == nil || subnet.SourceNetmask != 0 || !subnet.Address.IsUnspecified() {
+		t.Errorf("前缀长度 0 应发送 /0 的 ECS 选项, 实际: %v", subnet)
+	}
+}
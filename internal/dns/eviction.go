@@ -0,0 +1,213 @@
+package dns
+
+import (
+	"container/list"
+	"math/rand"
+
+	"github.com/hao/fxdns/internal/config"
+)
+
+// CacheEvictionPolicy 缓存淘汰策略，记录缓存键的写入与访问，缓存已满时选出被淘汰的键。
+// 实现不是并发安全的，由 Cache 在持有 policyMu 时调用
+type CacheEvictionPolicy interface {
+	// Add 记录新写入的键
+	Add(key string)
+	// Access 记录对已有键的一次访问（缓存命中或覆盖写入）
+	Access(key string)
+	// Remove 移除被主动删除的键
+	Remove(key string)
+	// Evict 移除并返回应被淘汰的键，没有可淘汰的键时返回 false
+	Evict() (string, bool)
+}
+
+// newEvictionPolicy 按 cache.eviction_policy 创建淘汰策略，为空时使用 LRU
+func newEvictionPolicy(name string) CacheEvictionPolicy {
+	switch name {
+	case config.CacheEvictionLFU:
+		return newLFUPolicy()
+	case config.CacheEvictionRandom:
+		return newRandomPolicy()
+	}
+	return newLRUPolicy()
+}
+
+// lruPolicy 淘汰最久未被访问的键
+type lruPolicy struct {
+	order *list.List // 表头为最近访问的键
+	items map[string]*list.Element
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Add 实现 CacheEvictionPolicy
+func (p *lruPolicy) Add(key string) {
+	if elem, ok := p.items[key]; ok {
+		p.order.MoveToFront(elem)
+		return
+	}
+	p.items[key] = p.order.PushFront(key)
+}
+
+// Access 实现 CacheEvictionPolicy
+func (p *lruPolicy) Access(key string) {
+	if elem, ok := p.items[key]; ok {
+		p.order.MoveToFront(elem)
+	}
+}
+
+// Remove 实现 CacheEvictionPolicy
+func (p *lruPolicy) Remove(key string) {
+	if elem, ok := p.items[key]; ok {
+		p.order.Remove(elem)
+		delete(p.items, key)
+	}
+}
+
+// Evict 实现 CacheEvictionPolicy
+func (p *lruPolicy) Evict() (string, bool) {
+	elem := p.order.Back()
+	if elem == nil {
+		return "", false
+	}
+	key := p.order.Remove(elem).(string)
+	delete(p.items, key)
+	return key, true
+}
+
+// lfuBucket 访问次数相同的键，按最近访问排序（表头为最近访问）
+type lfuBucket struct {
+	freq uint64
+	keys *list.List
+}
+
+// lfuItem 键在 lfuPolicy 中的位置
+type lfuItem struct {
+	bucket *list.Element // 所在的 lfuBucket
+	elem   *list.Element // 在 bucket.keys 中的元素
+}
+
+// lfuPolicy 淘汰访问次数最少的键，次数相同时淘汰最久未被访问的键。
+// 按访问次数升序排列的桶组成双向链表，写入、访问与淘汰都是 O(1)
+type lfuPolicy struct {
+	buckets *list.List // 元素为 *lfuBucket，表头的访问次数最少
+	items   map[string]*lfuItem
+}
+
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{buckets: list.New(), items: make(map[string]*lfuItem)}
+}
+
+// Add 实现 CacheEvictionPolicy，新键的访问次数为 1
+func (p *lfuPolicy) Add(key string) {
+	if _, ok := p.items[key]; ok {
+		p.Access(key)
+		return
+	}
+	front := p.buckets.Front()
+	if front == nil || front.Value.(*lfuBucket).freq != 1 {
+		front = p.buckets.PushFront(&lfuBucket{freq: 1, keys: list.New()})
+	}
+	p.items[key] = &lfuItem{bucket: front, elem: front.Value.(*lfuBucket).keys.PushFront(key)}
+}
+
+// Access 实现 CacheEvictionPolicy，将键移入访问次数加一的桶
+func (p *lfuPolicy) Access(key string) {
+	item, ok := p.items[key]
+	if !ok {
+		return
+	}
+	cur := item.bucket.Value.(*lfuBucket)
+	next := item.bucket.Next()
+	if next == nil || next.Value.(*lfuBucket).freq != cur.freq+1 {
+		next = p.buckets.InsertAfter(&lfuBucket{freq: cur.freq + 1, keys: list.New()}, item.bucket)
+	}
+
+	cur.keys.Remove(item.elem)
+	if cur.keys.Len() == 0 {
+		p.buckets.Remove(item.bucket)
+	}
+	item.bucket = next
+	item.elem = next.Value.(*lfuBucket).keys.PushFront(key)
+}
+
+// Remove 实现 CacheEvictionPolicy
+func (p *lfuPolicy) Remove(key string) {
+	item, ok := p.items[key]
+	if !ok {
+		return
+	}
+	bucket := item.bucket.Value.(*lfuBucket)
+	bucket.keys.Remove(item.elem)
+	if bucket.keys.Len() == 0 {
+		p.buckets.Remove(item.bucket)
+	}
+	delete(p.items, key)
+}
+
+// Evict 实现 CacheEvictionPolicy
+func (p *lfuPolicy) Evict() (string, bool) {
+	front := p.buckets.Front()
+	if front == nil {
+		return "", false
+	}
+	bucket := front.Value.(*lfuBucket)
+	key := bucket.keys.Remove(bucket.keys.Back()).(string)
+	if bucket.keys.Len() == 0 {
+		p.buckets.Remove(front)
+	}
+	delete(p.items, key)
+	return key, true
+}
+
+// randomPolicy 随机淘汰一个键
+type randomPolicy struct {
+	keys  []string
+	index map[string]int // 键在 keys 中的下标
+	rng   *rand.Rand
+}
+
+func newRandomPolicy() *randomPolicy {
+	return &randomPolicy{index: make(map[string]int), rng: rand.New(rand.NewSource(rand.Int63()))}
+}
+
+// Add 实现 CacheEvictionPolicy
+func (p *randomPolicy) Add(key string) {
+	if _, ok := p.index[key]; ok {
+		return
+	}
+	p.index[key] = len(p.keys)
+	p.keys = append(p.keys, key)
+}
+
+// Access 实现 CacheEvictionPolicy，随机淘汰不关心访问记录
+func (p *randomPolicy) Access(string) {}
+
+// Remove 实现 CacheEvictionPolicy
+func (p *randomPolicy) Remove(key string) {
+	if i, ok := p.index[key]; ok {
+		p.removeAt(i)
+	}
+}
+
+// Evict 实现 CacheEvictionPolicy
+func (p *randomPolicy) Evict() (string, bool) {
+	if len(p.keys) == 0 {
+		return "", false
+	}
+	i := p.rng.Intn(len(p.keys))
+	key := p.keys[i]
+	p.removeAt(i)
+	return key, true
+}
+
+// removeAt 以最后一个键填补下标 i 并缩短 keys
+func (p *randomPolicy) removeAt(i int) {
+	key := p.keys[i]
+	last := len(p.keys) - 1
+	p.keys[i] = p.keys[last]
+	p.index[p.keys[i]] = i
+	p.keys = p.keys[:last]
+	delete(p.index, key)
+}
@@ -0,0 +1,202 @@
+package dns
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/miekg/dns"
+)
+
+// evictAll 依次淘汰策略中的全部键
+func evictAll(p CacheEvictionPolicy) []string {
+	var keys []string
+	for {
+		key, ok := p.Evict()
+		if !ok {
+			return keys
+		}
+		keys = append(keys, key)
+	}
+}
+
+func TestLRUPolicy(t *testing.T) {
+	p := newLRUPolicy()
+	p.Add("a")
+	p.Add("b")
+	p.Add("c")
+	p.Access("a")
+
+	got := evictAll(p)
+	want := []string{"b", "c", "a"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("LRU 淘汰顺序期望 %v, 实际 %v", want, got)
+	}
+}
+
+func TestLFUPolicy(t *testing.T) {
+	p := newLFUPolicy()
+	p.Add("a")
+	p.Add("b")
+	p.Add("c")
+	p.Add("d")
+	// a 命中 3 次，c 命中 1 次，b、d 未命中：b 比 d 更早写入
+	p.Access("a")
+	p.Access("a")
+	p.Access("a")
+	p.Access("c")
+
+	got := evictAll(p)
+	want := []string{"b", "d", "c", "a"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("LFU 淘汰顺序期望 %v, 实际 %v", want, got)
+	}
+	if len(p.items) != 0 || p.buckets.Len() != 0 {
+		t.Errorf("全部淘汰后不应残留键或访问次数桶: %d, %d", len(p.items), p.buckets.Len())
+	}
+}
+
+func TestLFUPolicyTieBreakByRecency(t *testing.T) {
+	p := newLFUPolicy()
+	p.Add("a")
+	p.Add("b")
+	p.Access("b")
+	p.Access("a")
+	// 命中次数相同时淘汰最久未被访问的 b
+	if key, _ := p.Evict(); key != "b" {
+		t.Errorf("命中次数相同时应淘汰最久未被访问的键, 实际 %s", key)
+	}
+}
+
+func TestEvictionPolicyRemove(t *testing.T) {
+	for _, name := range []string{config.CacheEvictionLRU, config.CacheEvictionLFU, config.CacheEvictionRandom} {
+		p := newEvictionPolicy(name)
+		p.Add("a")
+		p.Add("b")
+		p.Access("b")
+		p.Remove("b")
+		p.Remove("missing")
+		if got := evictAll(p); fmt.Sprint(got) != "[a]" {
+			t.Errorf("%s: 删除 b 后只应淘汰 a, 实际 %v", name, got)
+		}
+	}
+}
+
+func TestRandomPolicy(t *testing.T) {
+	p := newRandomPolicy()
+	for i := 0; i < 100; i++ {
+		p.Add(fmt.Sprint(i))
+	}
+	p.Add("0")
+
+	seen := make(map[string]bool)
+	for _, key := range evictAll(p) {
+		if seen[key] {
+			t.Fatalf("键 %s 被淘汰了两次", key)
+		}
+		seen[key] = true
+	}
+	if len(seen) != 100 {
+		t.Errorf("期望淘汰 100 个键, 实际 %d", len(seen))
+	}
+}
+
+func TestCacheLFUEviction(t *testing.T) {
+	server := newTestServer(t, `
+upstream:
+  server: "127.0.0.1:53"
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 2
+  cache_ttl: 60s
+cache:
+  eviction_policy: "lfu"
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+
+	query := func(name string) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		return req
+	}
+	hot, cold, next := query("hot.example.com."), query("cold.example.com."), query("next.example.com.")
+	server.updateCache(hot, answerA(hot, "198.51.100.1"))
+	server.updateCache(cold, answerA(cold, "198.51.100.2"))
+	for i := 0; i < 3; i++ {
+		if server.checkCache(hot) == nil {
+			t.Fatal("hot.example.com 应命中缓存")
+		}
+	}
+
+	// cold 最近写入，但命中次数最少，应被淘汰
+	server.updateCache(next, answerA(next, "198.51.100.3"))
+	if server.checkCache(cold) != nil {
+		t.Error("命中次数最少的 cold.example.com 应被淘汰")
+	}
+	if server.checkCache(hot) == nil || server.checkCache(next) == nil {
+		t.Error("hot.example.com 与 next.example.com 应保留在缓存中")
+	}
+}
+
+func TestCacheSetEvictionPolicy(t *testing.T) {
+	cache := &Cache{entries: make(map[string]*CacheEntry), maxSize: 2, ttl: time.Minute}
+	resp := new(dns.Msg)
+	cache.set("a", resp, time.Minute)
+	cache.set("b", resp, time.Minute)
+
+	cache.setEvictionPolicy(config.CacheEvictionLRU)
+	cache.touch("a")
+	cache.set("c", resp, time.Minute)
+	if _, ok := cache.entries["b"]; ok {
+		t.Error("切换为 LRU 后应淘汰最久未被访问的 b")
+	}
+	if len(cache.entries) != 2 {
+		t.Errorf("缓存条目数期望 2, 实际 %d", len(cache.entries))
+	}
+}
+
+// benchmarkEviction 以 Zipf 分布的查询访问容量为 1000、键空间为 100000 的缓存，报告命中率
+func benchmarkEviction(b *testing.B, policy string) {
+	const capacity, keyspace = 1000, 100000
+	keys := make([]string, keyspace)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("www%d.example.com.:1:", i)
+	}
+	cache := &Cache{
+		entries: make(map[string]*CacheEntry),
+		maxSize: capacity,
+		ttl:     time.Hour,
+		policy:  newEvictionPolicy(policy),
+	}
+	resp := new(dns.Msg)
+	zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, keyspace-1)
+
+	hits := 0
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := keys[zipf.Uint64()]
+		if _, ok := cache.entries[key]; ok {
+			cache.touch(key)
+			hits++
+			continue
+		}
+		cache.set(key, resp, time.Hour)
+	}
+	b.ReportMetric(float64(hits)/float64(b.N), "hit-ratio")
+}
+
+func BenchmarkCacheEvictionLRU(b *testing.B) {
+	benchmarkEviction(b, config.CacheEvictionLRU)
+}
+
+func BenchmarkCacheEvictionLFU(b *testing.B) {
+	benchmarkEviction(b, config.CacheEvictionLFU)
+}
+
+func BenchmarkCacheEvictionRandom(b *testing.B) {
+	benchmarkEviction(b, config.CacheEvictionRandom)
+}
@@ -0,0 +1,134 @@
+package dns
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/miekg/dns"
+)
+
+// ExplainResult 描述 fxdns 对某个查询会做出的处理决策
+type ExplainResult struct {
+	Domain         string             `json:"domain"`
+	Qtype          string             `json:"qtype"`
+	MatchedRule    *config.DomainRule `json:"matched_rule,omitempty"`
+	Strategy       string             `json:"strategy"`
+	UpstreamUsed   string             `json:"upstream_used"`
+	CachedResponse *dns.Msg           `json:"-"`
+	CDNIPsDetected []net.IP           `json:"cdn_ips_detected,omitempty"`
+	ChainDepth     int                `json:"chain_depth"`
+	WouldFilter    bool               `json:"would_filter"`
+}
+
+// ExplainQuery 对给定域名和查询类型执行一次决策流程的演练，不会向上游发送任何查询。
+// 如果缓存中存在该查询的响应，则基于缓存条目记录的主上游原始响应 (CDN 过滤之前) 分析 CNAME 链和 CDN IP，
+// 没有记录时退回到缓存的响应；缓存中没有该查询时只能给出规则与策略层面的结论。
+func (s *Server) ExplainQuery(domain string, qtype uint16) (ExplainResult, error) {
+	domain = strings.TrimSpace(domain)
+	if domain == "" {
+		return ExplainResult{}, errors.New("域名不能为空")
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	name := normalizeDomain(domain)
+	result := ExplainResult{
+		Domain:       name,
+		Qtype:        dns.TypeToString[qtype],
+		Strategy:     s.config.GetDomainStrategy(name, qtype),
+		UpstreamUsed: s.upstream,
+	}
+	for i := range s.config.Domains {
+		if s.config.Domains[i].Match(name) {
+			rule := s.config.Domains[i]
+			result.MatchedRule = &rule
+			break
+		}
+	}
+	// force_a_only 的 AAAA 查询直接返回空响应，不会使用上游
+	if qtype == dns.TypeAAAA && s.forceAOnly(name) {
+		result.UpstreamUsed = ""
+		return result, nil
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn(name), qtype)
+	cached := s.checkCache(req)
+	if cached == nil {
+		return result, nil
+	}
+	result.CachedResponse = cached
+	// 缓存中保存的是过滤后的响应，CDN 检测应基于主上游的原始响应，与实际查询时一致
+	analyzed := cached
+	if upstream := s.cachedUpstreamResponse(req, ""); upstream != nil {
+		analyzed = upstream
+	}
+
+	chain := NewCNAMEChain()
+	chain.BuildFromResponse(analyzed)
+	if hops := len(chain.TraceChain(name)); hops > 0 {
+		result.ChainDepth = hops - 1
+	}
+
+	// 与 processResponse 一致：请求域名无特定策略时，使用 CNAME 链中匹配规则的策略
+	if result.Strategy == config.StrategyNone {
+		for d := range chain.FilterByMatcher(s.domainMatcher).domains {
+			if st := s.config.GetDomainStrategy(d, qtype); st == config.StrategyFilterNonCDN || st == config.StrategyReturnCDNA {
+				result.Strategy = st
+				break
+			}
+		}
+	}
+
+	found, cdnIPs := s.checkCNAMEForCDNIP(analyzed)
+	result.CDNIPsDetected = cdnIPs
+	if len(cdnIPs) < s.minCDNIPs(name) {
+		found = false
+	}
+	// 检测到 CDN IP 时，无论是否有特定策略都会对响应进行处理（默认过滤非 CDN IP）
+	result.WouldFilter = found
+
+	fallback := strings.TrimSpace(s.config.Upstream.FallbackServer)
+	trigger := s.fallbackTrigger()
+	if !found && fallback != "" && (trigger == config.FallbackTriggerCDNMiss || trigger == config.FallbackTriggerAlways) &&
+		s.fallbackStrategy(name) == config.FallbackStrategyUseFallback {
+		result.UpstreamUsed = fallback
+	}
+	return result, nil
+}
+
+// handleExplain 处理 GET /explain?domain=example.com&type=A
+func (s *Server) handleExplain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	qtype := dns.TypeA
+	if t := r.URL.Query().Get("type"); t != "" {
+		var ok bool
+		if qtype, ok = dns.StringToType[strings.ToUpper(t)]; !ok {
+			http.Error(w, "unknown query type: "+t, http.StatusBadRequest)
+			return
+		}
+	}
+
+	result, err := s.ExplainQuery(r.URL.Query().Get("domain"), qtype)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	view := struct {
+		ExplainResult
+		CachedResponse string `json:"cached_response,omitempty"`
+	}{ExplainResult: result}
+	if result.CachedResponse != nil {
+		view.CachedResponse = result.CachedResponse.String()
+	}
+	writeJSON(w, http.StatusOK, view)
+}
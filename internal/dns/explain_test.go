@@ -0,0 +1,192 @@
+package dns
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/miekg/dns"
+)
+
+const explainTestConfig = `
+upstream:
+  server: "192.0.2.1:53"
+  fallback_server: "192.0.2.2:53"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.filter.com"
+    strategy: "filter_non_cdn"
+  - pattern: "*.direct.com"
+    strategy: "return_cdn_a"
+    ttl: 30
+  - pattern: "edge.cdn.net"
+    strategy: "return_cdn_a"
+`
+
+// cacheResponse 将构造的响应写入缓存
+func cacheResponse(s *Server, name string, rrs ...dns.RR) {
+	req := new(dns.Msg)
+	req.SetQuestion(name, dns.TypeA)
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	resp.Answer = rrs
+	s.updateCache(req, resp)
+}
+
+func newA(name, ip string) *dns.A {
+	return &dns.A{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300}, A: net.ParseIP(ip)}
+}
+
+func newCNAME(name, target string) *dns.CNAME {
+	return &dns.CNAME{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300}, Target: target}
+}
+
+func TestExplainQuery(t *testing.T) {
+	server := newTestServer(t, explainTestConfig)
+
+	cacheResponse(server, "www.filter.com.", newA("www.filter.com.", "10.1.1.1"), newA("www.filter.com.", "8.8.8.8"))
+	cacheResponse(server, "img.direct.com.", newA("img.direct.com.", "8.8.4.4"))
+	cacheResponse(server, "www.plain.org.",
+		newCNAME("www.plain.org.", "mid.plain.org."),
+		newCNAME("mid.plain.org.", "edge.cdn.net."),
+		newA("edge.cdn.net.", "10.2.2.2"))
+
+	testCases := []struct {
+		domain      string
+		pattern     string
+		strategy    string
+		upstream    string
+		cached      bool
+		cdnIPs      int
+		chainDepth  int
+		wouldFilter bool
+	}{
+		{"www.filter.com", "*.filter.com", config.StrategyFilterNonCDN, "192.0.2.1:53", true, 1, 0, true},
+		{"img.direct.com", "*.direct.com", config.StrategyReturnCDNA, "192.0.2.2:53", true, 0, 0, false},
+		{"www.plain.org", "", config.StrategyReturnCDNA, "192.0.2.1:53", true, 1, 2, true},
+		{"uncached.filter.com", "*.filter.com", config.StrategyFilterNonCDN, "192.0.2.1:53", false, 0, 0, false},
+		{"unknown.net", "", config.StrategyNone, "192.0.2.1:53", false, 0, 0, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.domain, func(t *testing.T) {
+			result, err := server.ExplainQuery(tc.domain, dns.TypeA)
+			if err != nil {
+				t.Fatalf("ExplainQuery 失败: %v", err)
+			}
+			if tc.pattern == "" && result.MatchedRule != nil {
+				t.Errorf("不应匹配规则, 实际: %s", result.MatchedRule.Pattern)
+			}
+			if tc.pattern != "" && (result.MatchedRule == nil || result.MatchedRule.Pattern != tc.pattern) {
+				t.Errorf("匹配规则错误, 期望: %s, 实际: %+v", tc.pattern, result.MatchedRule)
+			}
+			if result.Strategy != tc.strategy {
+				t.Errorf("策略错误, 期望: %s, 实际: %s", tc.strategy, result.Strategy)
+			}
+			if result.UpstreamUsed != tc.upstream {
+				t.Errorf("上游错误, 期望: %s, 实际: %s", tc.upstream, result.UpstreamUsed)
+			}
+			if (result.CachedResponse != nil) != tc.cached {
+				t.Errorf("缓存状态错误, 期望: %v", tc.cached)
+			}
+			if len(result.CDNIPsDetected) != tc.cdnIPs {
+				t.Errorf("CDN IP 数量错误, 期望: %d, 实际: %d", tc.cdnIPs, len(result.CDNIPsDetected))
+			}
+			if result.ChainDepth != tc.chainDepth {
+				t.Errorf("CNAME 链深度错误, 期望: %d, 实际: %d", tc.chainDepth, result.ChainDepth)
+			}
+			if result.WouldFilter != tc.wouldFilter {
+				t.Errorf("WouldFilter 错误, 期望: %v, 实际: %v", tc.wouldFilter, result.WouldFilter)
+			}
+		})
+	}
+
+	if _, err := server.ExplainQuery("", dns.TypeA); err == nil {
+		t.Error("空域名应该返回错误")
+	}
+}
+
+func TestExplainQueryUsesUpstreamResponse(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = append(m.Answer, newCNAME(r.Question[0].Name, "edge.cdn.net."), newA("edge.cdn.net.", "10.2.2.2"), newA("edge.cdn.net.", "8.8.8.8"))
+		w.WriteMsg(m)
+	})
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 2s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "edge.cdn.net"
+    strategy: "return_cdn_a"
+`)
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.plain.org.", dns.TypeA)
+	w := &mockResponseWriter{}
+	server.ServeDNS(w, req)
+	// return_cdn_a 返回的响应已去掉 CNAME 链与非 CDN IP
+	if w.msg == nil || len(w.msg.Answer) != 1 {
+		t.Fatalf("查询结果错误: %v", w.msg)
+	}
+
+	// 演练基于主上游的原始响应，而不是过滤后缓存的响应
+	result, err := server.ExplainQuery("www.plain.org", dns.TypeA)
+	if err != nil {
+		t.Fatalf("ExplainQuery 失败: %v", err)
+	}
+	if result.CachedResponse == nil || len(result.CachedResponse.Answer) != 1 {
+		t.Errorf("CachedResponse 应为缓存中过滤后的响应: %v", result.CachedResponse)
+	}
+	if result.Strategy != config.StrategyReturnCDNA || result.ChainDepth != 1 || !result.WouldFilter {
+		t.Errorf("应按原始响应中的 CNAME 链分析, 实际: 策略 %s, 链深度 %d, WouldFilter %v", result.Strategy, result.ChainDepth, result.WouldFilter)
+	}
+	if len(result.CDNIPsDetected) != 1 || !result.CDNIPsDetected[0].Equal(net.ParseIP("10.2.2.2")) {
+		t.Errorf("CDN IP 检测结果错误: %v", result.CDNIPsDetected)
+	}
+}
+
+func TestAdminExplain(t *testing.T) {
+	server := newTestServer(t, explainTestConfig)
+	cacheResponse(server, "www.filter.com.", newA("www.filter.com.", "10.1.1.1"))
+	handler := server.adminHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/explain?domain=www.filter.com&type=a", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码错误, 期望: 200, 实际: %d", rec.Code)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if body["strategy"] != config.StrategyFilterNonCDN || body["would_filter"] != true || body["cached_response"] == nil {
+		t.Errorf("响应内容错误: %v", body)
+	}
+
+	for _, url := range []string{"/explain?type=A", "/explain?domain=a.com&type=BOGUS"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s 状态码错误, 期望: 400, 实际: %d", url, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package dns
+
+import (
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/hao/fxdns/internal/config"
+	"github.com/miekg/dns"
+)
+
+// modifyExprDefaultTTL 应答中原本没有 A/AAAA 记录、规则也未配置 ttl 时，modify_expr 新增记录使用的 TTL
+const modifyExprDefaultTTL = 60
+
+// applyModifyExpr 按 domain 命中的域名规则的 modify_expr 改写应答中的 A/AAAA 记录：表达式返回的地址列表
+// 取代原有地址，原应答中已有的地址保留原记录（所有者名与 TTL），新增的地址以最后一个 A/AAAA 记录的所有者名
+// （没有时为 CNAME 链末端或查询名）和变量 ttl 生成记录，与查询类型不符的地址族被忽略。
+// 只处理 NOERROR 应答；表达式执行失败或结果不是 IP 地址列表时记录日志并返回原应答
+func (s *Server) applyModifyExpr(domain string, resp *dns.Msg) *dns.Msg {
+	if resp == nil || len(resp.Question) == 0 || resp.Rcode != dns.RcodeSuccess {
+		return resp
+	}
+	rule := s.config.GetDomainRule(normalizeDomain(domain))
+	if rule == nil || rule.ModifyProgram() == nil {
+		return resp
+	}
+
+	env := s.modifyExprEnv(domain, resp)
+	ips, err := runModifyExpr(rule.ModifyProgram(), env)
+	if err != nil {
+		log.Printf("域名 %s 的 modify_expr 执行失败，返回原始应答: %v", domain, err)
+		return resp
+	}
+
+	ttl := uint32(env["ttl"].(int))
+	if ttl == 0 {
+		ttl = modifyExprDefaultTTL
+		if rule.TTL > 0 {
+			ttl = rule.TTL
+		}
+	}
+	return rewriteAnswerIPs(resp, ips, ttl)
+}
+
+// modifyExprEnv 从应答中提取 modify_expr 的变量，见 config.ModifyExprEnv
+func (s *Server) modifyExprEnv(domain string, resp *dns.Msg) map[string]interface{} {
+	ips, cdnIPs, chain := []string{}, []string{}, []string{}
+	ttl := 0
+	for _, rr := range resp.Answer {
+		if cname, ok := rr.(*dns.CNAME); ok {
+			chain = append(chain, normalizeDomain(cname.Target))
+			continue
+		}
+		ip := rrIP(rr)
+		if ip == nil {
+			continue
+		}
+		ips = append(ips, ip.String())
+		if s.cdnMatcherFor(resp, normalizeDomain(rr.Header().Name)).Contains(ip) {
+			cdnIPs = append(cdnIPs, ip.String())
+		}
+		if t := int(rr.Header().Ttl); ttl == 0 || t < ttl {
+			ttl = t
+		}
+	}
+
+	env := config.ModifyExprEnv()
+	env["domain"] = normalizeDomain(domain)
+	env["ips"] = ips
+	env["cdnIPs"] = cdnIPs
+	env["ttl"] = ttl
+	env["cname_chain"] = chain
+	return env
+}
+
+// runModifyExpr 执行 modify_expr 程序，结果应为由 IP 地址字符串组成的数组
+func runModifyExpr(program *vm.Program, env map[string]interface{}) ([]net.IP, error) {
+	out, err := expr.Run(program, env)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []interface{}
+	switch v := out.(type) {
+	case []interface{}:
+		values = v
+	case []string:
+		for _, s := range v {
+			values = append(values, s)
+		}
+	default:
+		return nil, fmt.Errorf("结果应为 IP 地址列表, 实际: %T", out)
+	}
+
+	ips := make([]net.IP, 0, len(values))
+	for _, v := range values {
+		str, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("结果中的 %v 不是字符串", v)
+		}
+		ip := net.ParseIP(str)
+		if ip == nil {
+			return nil, fmt.Errorf("结果中的 %q 不是有效的 IP 地址", str)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+// rewriteAnswerIPs 返回以 ips 取代 A/AAAA 记录的应答副本，其他记录保持原有顺序，见 applyModifyExpr
+func rewriteAnswerIPs(resp *dns.Msg, ips []net.IP, ttl uint32) *dns.Msg {
+	qtype := resp.Question[0].Qtype
+	owner := resp.Question[0].Name
+	existing := make(map[string][]dns.RR)
+	modified := resp.Copy()
+	answer := modified.Answer[:0]
+	for _, rr := range modified.Answer {
+		switch v := rr.(type) {
+		case *dns.CNAME:
+			owner = v.Target
+		case *dns.A, *dns.AAAA:
+			owner = rr.Header().Name
+			key := rrIP(rr).String()
+			existing[key] = append(existing[key], rr)
+			continue
+		}
+		answer = append(answer, rr)
+	}
+
+	for _, ip := range ips {
+		key := ip.String()
+		if rrs := existing[key]; len(rrs) > 0 {
+			answer = append(answer, rrs[0])
+			existing[key] = rrs[1:]
+			continue
+		}
+		hdr := dns.RR_Header{Name: owner, Class: dns.ClassINET, Ttl: ttl}
+		if ip4 := ip.To4(); ip4 != nil {
+			if qtype != dns.TypeA && qtype != dns.TypeANY {
+				continue
+			}
+			hdr.Rrtype = dns.TypeA
+			answer = append(answer, &dns.A{Hdr: hdr, A: ip4})
+		} else {
+			if qtype != dns.TypeAAAA && qtype != dns.TypeANY {
+				continue
+			}
+			hdr.Rrtype = dns.TypeAAAA
+			answer = append(answer, &dns.AAAA{Hdr: hdr, AAAA: ip})
+		}
+	}
+	modified.Answer = answer
+	return modified
+}
@@ -0,0 +1,115 @@
+package dns
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestModifyExpr(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		name := r.Question[0].Name
+		records := []string{name + " 300 IN A 192.0.2.1", name + " 300 IN A 198.51.100.1"}
+		if name == "cname.example.net." {
+			records = []string{name + " 300 IN CNAME edge.cdn.net.", "edge.cdn.net. 120 IN A 192.0.2.1"}
+		}
+		for _, s := range records {
+			rr, _ := dns.NewRR(s)
+			m.Answer = append(m.Answer, rr)
+		}
+		w.WriteMsg(m)
+	})
+
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 2s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "filter.example.net"
+    modify_expr: 'filter(ips, {not (# startsWith "192.0.2.")})'
+  - pattern: "cname.example.net"
+    modify_expr: 'concat(ips, ["2001:db8::1", "203.0.113.5"])'
+  - pattern: "bad.example.net"
+    modify_expr: '["not-an-ip"]'
+`)
+
+	query := func(name string) []string {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		w := &mockResponseWriter{}
+		server.ServeDNS(w, req)
+		if w.msg == nil || w.msg.Rcode != dns.RcodeSuccess {
+			t.Fatalf("%s 应返回 NOERROR, 实际: %v", name, w.msg)
+		}
+		var answer []string
+		for _, rr := range w.msg.Answer {
+			answer = append(answer, fmt.Sprintf("%s %d %s", rr.Header().Name, rr.Header().Ttl, dns.TypeToString[rr.Header().Rrtype]))
+			if ip := rrIP(rr); ip != nil {
+				answer[len(answer)-1] += " " + ip.String()
+			}
+		}
+		return answer
+	}
+
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{"filter.example.net.", "[filter.example.net. 300 A 198.51.100.1]"},
+		// 新增的地址以 CNAME 链末端为所有者名、最小 TTL 为 TTL，与查询类型不符的 IPv6 地址被忽略
+		{"cname.example.net.", "[cname.example.net. 300 CNAME edge.cdn.net. 120 A 192.0.2.1 edge.cdn.net. 120 A 203.0.113.5]"},
+		// 结果不是有效的 IP 地址时返回原应答
+		{"bad.example.net.", "[bad.example.net. 300 A 192.0.2.1 bad.example.net. 300 A 198.51.100.1]"},
+	}
+	for _, tc := range testCases {
+		if got := fmt.Sprint(query(tc.name)); got != tc.expected {
+			t.Errorf("%s 的应答错误\n期望: %s\n实际: %s", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestModifyExprEnv(t *testing.T) {
+	server := newTestServer(t, `
+upstream:
+  server: "127.0.0.1:53"
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+
+	resp := new(dns.Msg)
+	resp.SetQuestion("WWW.Example.com.", dns.TypeA)
+	for _, s := range []string{
+		"www.example.com. 300 IN CNAME www.example.com.cdn.net.",
+		"www.example.com.cdn.net. 60 IN CNAME edge.cdn.net.",
+		"edge.cdn.net. 120 IN A 10.1.1.1",
+		"edge.cdn.net. 30 IN A 192.0.2.1",
+	} {
+		rr, _ := dns.NewRR(s)
+		resp.Answer = append(resp.Answer, rr)
+	}
+
+	env := server.modifyExprEnv("WWW.Example.com.", resp)
+	expected := map[string]string{
+		"domain":      "www.example.com",
+		"ips":         "[10.1.1.1 192.0.2.1]",
+		"cdnIPs":      "[10.1.1.1]",
+		"ttl":         "30",
+		"cname_chain": "[www.example.com.cdn.net edge.cdn.net]",
+	}
+	for name, want := range expected {
+		if got := fmt.Sprint(env[name]); got != want {
+			t.Errorf("变量 %s 期望 %s, 实际 %s", name, want, got)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package dns
+
+import (
+	"math/rand"
+	"time"
+)
+
+// jitterTTL 将缓存有效期 base 在 [-factor*base, +factor*base] 范围内随机调整，
+// 使同一时刻写入的条目错开过期时间，避免过期后大量请求同时回源。factor 或 base 不大于 0 时原样返回
+func jitterTTL(base time.Duration, factor float64, rng *rand.Rand) time.Duration {
+	if factor <= 0 || base <= 0 {
+		return base
+	}
+	delta := (rng.Float64()*2 - 1) * factor * float64(base)
+	return base + time.Duration(delta)
+}
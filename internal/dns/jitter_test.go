@@ -0,0 +1,67 @@
+package dns
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestJitterTTL(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	base := 100 * time.Second
+
+	// factor 为 0 时不调整
+	for i := 0; i < 100; i++ {
+		if got := jitterTTL(base, 0, rng); got != base {
+			t.Fatalf("factor 为 0 时不应调整有效期, 实际: %v", got)
+		}
+	}
+
+	// factor 为 0.1 时结果落在 [90s, 110s] 内且不全相同
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 1000; i++ {
+		got := jitterTTL(base, 0.1, rng)
+		if got < 90*time.Second || got > 110*time.Second {
+			t.Fatalf("有效期超出 ±10%% 范围: %v", got)
+		}
+		seen[got] = true
+	}
+	if len(seen) < 2 {
+		t.Error("factor 为 0.1 时有效期应随机变化")
+	}
+
+	if got := jitterTTL(0, 0.1, rng); got != 0 {
+		t.Errorf("有效期为 0 时不应调整, 实际: %v", got)
+	}
+}
+
+func TestCacheTTLJitter(t *testing.T) {
+	server := newTestServer(t, `
+upstream:
+  server: "127.0.0.1:53"
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_ttl: 100s
+  ttl_jitter_factor: 0.1
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+
+	for i := 0; i < 50; i++ {
+		req := new(dns.Msg)
+		req.SetQuestion("www.example.com.", dns.TypeA)
+		start := time.Now()
+		server.updateCache(req, answerA(req, "198.51.100.1"))
+
+		server.cache.mu.RLock()
+		entry := server.cache.entries[cacheKey(req, "")]
+		server.cache.mu.RUnlock()
+		ttl := entry.softExpireAt.Sub(start)
+		if ttl < 90*time.Second || ttl > 110*time.Second+time.Second {
+			t.Fatalf("缓存有效期超出 ±10%% 范围: %v", ttl)
+		}
+	}
+}
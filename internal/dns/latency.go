@@ -0,0 +1,178 @@
+package dns
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/hao/fxdns/internal/metrics"
+	"github.com/hao/fxdns/internal/upstream"
+)
+
+// latencyEWMAAlpha 新 RTT 样本在指数加权移动平均中的权重
+const latencyEWMAAlpha = 0.3
+
+// latencyProbeInterval 每隔多少次选择改为探测 EWMA 最久未更新的其他上游。
+// 只选 EWMA 最低的上游时，曾经变慢的上游不再收到查询，其 EWMA 也就无法随恢复而下降
+const latencyProbeInterval = 20
+
+// latencyTracker 记录 upstream.load_balance 为 latency 时各主上游 RTT 的指数加权移动平均值 (EWMA)。
+// 由 Server 持有，热加载时保留仍在配置中的上游的记录
+type latencyTracker struct {
+	mu         sync.Mutex
+	candidates []string             // 参与选择的主上游，按配置顺序
+	ewma       map[string]float64   // 单位为毫秒，尚无样本的上游不在其中
+	updated    map[string]time.Time // 各上游 EWMA 最近一次更新的时间
+	picks      uint64               // pick 的调用次数，用于按 latencyProbeInterval 探测
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{ewma: make(map[string]float64), updated: make(map[string]time.Time)}
+}
+
+// setCandidates 替换参与选择的主上游，丢弃已不在其中的上游的记录
+func (t *latencyTracker) setCandidates(addrs []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.candidates = addrs
+	for addr := range t.ewma {
+		if !slices.Contains(addrs, addr) {
+			delete(t.ewma, addr)
+			delete(t.updated, addr)
+			metrics.UpstreamEWMA.Delete(addr)
+		}
+	}
+}
+
+// observe 以一次查询的 RTT 更新 addr 的 EWMA，不在候选中的上游被忽略
+func (t *latencyTracker) observe(addr string, rtt time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !slices.Contains(t.candidates, addr) {
+		return
+	}
+	ms := float64(rtt) / float64(time.Millisecond)
+	if old, ok := t.ewma[addr]; ok {
+		ms = latencyEWMAAlpha*ms + (1-latencyEWMAAlpha)*old
+	}
+	t.ewma[addr] = ms
+	t.updated[addr] = time.Now()
+	metrics.UpstreamEWMA.Set(addr, ms)
+}
+
+// pick 返回下一个查询使用的候选上游：通常为 EWMA 最低的上游，尚无样本的上游优先，以便先测得其 RTT；
+// 每 latencyProbeInterval 次改为选择 EWMA 最久未更新的其他上游，使变慢后恢复的上游有机会重新被选中。
+// 没有候选时返回空字符串
+func (t *latencyTracker) pick() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	best := t.bestLocked()
+	t.picks++
+	if t.picks%latencyProbeInterval == 0 {
+		if probe := t.stalestLocked(best); probe != "" {
+			return probe
+		}
+	}
+	return best
+}
+
+// selected 返回不考虑探测时的选择结果，不计入 pick 的调用次数
+func (t *latencyTracker) selected() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.bestLocked()
+}
+
+// stalestLocked 返回除 exclude 外 EWMA 最久未更新的候选上游，没有时返回空字符串。调用者应持有 t.mu
+func (t *latencyTracker) stalestLocked(exclude string) string {
+	stalest := ""
+	for _, addr := range t.candidates {
+		if addr == exclude {
+			continue
+		}
+		if stalest == "" || t.updated[addr].Before(t.updated[stalest]) {
+			stalest = addr
+		}
+	}
+	return stalest
+}
+
+// bestLocked 返回 EWMA 最低的候选上游，尚无样本的上游优先。调用者应持有 t.mu
+func (t *latencyTracker) bestLocked() string {
+	best, bestRTT := "", 0.0
+	for _, addr := range t.candidates {
+		rtt, ok := t.ewma[addr]
+		if !ok {
+			return addr
+		}
+		if best == "" || rtt < bestRTT {
+			best, bestRTT = addr, rtt
+		}
+	}
+	return best
+}
+
+// snapshot 返回各候选上游当前的 EWMA (毫秒)
+func (t *latencyTracker) snapshot() map[string]float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	values := make(map[string]float64, len(t.ewma))
+	for addr, rtt := range t.ewma {
+		values[addr] = rtt
+	}
+	return values
+}
+
+// latencyCandidates 返回按配置参与 RTT 选择的主上游，未开启 load_balance: latency 时为 nil
+func latencyCandidates(cfg *config.UpstreamConfig) []string {
+	if cfg.LoadBalance != config.LoadBalanceLatency {
+		return nil
+	}
+	return cfg.PrimaryServers()
+}
+
+// balancedUpstream 开启 load_balance: latency 时返回 EWMA 最低的主上游，否则返回 primary
+func (s *Server) balancedUpstream(primary string) string {
+	if s.currentConfig().Upstream.LoadBalance != config.LoadBalanceLatency {
+		return primary
+	}
+	if addr := s.upstreamRTT.pick(); addr != "" {
+		return addr
+	}
+	return primary
+}
+
+// recordUpstreamRTT 记录一次主上游查询的 RTT。查询失败时以超时时间计入，使持续失败的上游不再被优先选择；
+// 熔断打开而未发送的查询不计入
+func (s *Server) recordUpstreamRTT(addr string, rtt time.Duration, err error, timeout time.Duration) {
+	if s.currentConfig().Upstream.LoadBalance != config.LoadBalanceLatency || errors.Is(err, upstream.ErrCircuitOpen) {
+		return
+	}
+	if err != nil {
+		rtt = timeout
+	}
+	s.upstreamRTT.observe(addr, rtt)
+}
+
+// UpstreamLatency GET /upstream/latency 的响应
+type UpstreamLatency struct {
+	LoadBalance string             `json:"load_balance"`
+	Selected    string             `json:"selected,omitempty"` // 当前 EWMA 最低的主上游 (不含定期探测)
+	EWMAMs      map[string]float64 `json:"ewma_ms"`
+}
+
+// handleUpstreamLatency 处理 GET /upstream/latency，返回各主上游 RTT 的 EWMA
+func (s *Server) handleUpstreamLatency(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, UpstreamLatency{
+		LoadBalance: s.currentConfig().Upstream.LoadBalance,
+		Selected:    s.upstreamRTT.selected(),
+		EWMAMs:      s.upstreamRTT.snapshot(),
+	})
+}
@@ -0,0 +1,163 @@
+package dns
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/hao/fxdns/internal/metrics"
+	"github.com/miekg/dns"
+)
+
+func TestLatencyTracker(t *testing.T) {
+	tracker := newLatencyTracker()
+	if addr := tracker.pick(); addr != "" {
+		t.Errorf("没有候选上游时应返回空字符串, 实际 %s", addr)
+	}
+	tracker.setCandidates([]string{"a:53", "b:53"})
+
+	// 尚无样本的上游优先
+	if addr := tracker.pick(); addr != "a:53" {
+		t.Errorf("期望先选择尚无样本的 a:53, 实际 %s", addr)
+	}
+	tracker.observe("a:53", 10*time.Millisecond)
+	if addr := tracker.pick(); addr != "b:53" {
+		t.Errorf("期望选择尚无样本的 b:53, 实际 %s", addr)
+	}
+	tracker.observe("b:53", 20*time.Millisecond)
+	if addr := tracker.pick(); addr != "a:53" {
+		t.Errorf("期望选择 EWMA 较低的 a:53, 实际 %s", addr)
+	}
+
+	// a 变慢后 EWMA 按 alpha 逐步上升，超过 b 时改选 b
+	tracker.observe("a:53", 40*time.Millisecond)
+	want := latencyEWMAAlpha*40 + (1-latencyEWMAAlpha)*10
+	if got := tracker.snapshot()["a:53"]; math.Abs(got-want) > 1e-9 {
+		t.Errorf("a:53 的 EWMA 期望 %v, 实际 %v", want, got)
+	}
+	tracker.observe("a:53", 40*time.Millisecond)
+	if addr := tracker.pick(); addr != "b:53" {
+		t.Errorf("a:53 变慢后期望选择 b:53, 实际 %s (%v)", addr, tracker.snapshot())
+	}
+	if got := metrics.UpstreamEWMA.Snapshot()["b:53"]; got != 20 {
+		t.Errorf("指标中 b:53 的 EWMA 期望 20, 实际 %v", got)
+	}
+
+	// 不在候选中的上游不记录；移出候选后丢弃记录
+	tracker.observe("c:53", time.Millisecond)
+	tracker.setCandidates([]string{"b:53"})
+	if snap := tracker.snapshot(); len(snap) != 1 || snap["b:53"] != 20 {
+		t.Errorf("更新候选后的记录错误: %v", snap)
+	}
+	if _, ok := metrics.UpstreamEWMA.Snapshot()["a:53"]; ok {
+		t.Error("移出候选的上游应从指标中删除")
+	}
+	tracker.setCandidates(nil)
+}
+
+func TestLatencyTrackerProbe(t *testing.T) {
+	tracker := newLatencyTracker()
+	tracker.setCandidates([]string{"a:53", "b:53"})
+	defer tracker.setCandidates(nil)
+
+	// b 曾经超时，EWMA 远高于 a
+	tracker.observe("a:53", 10*time.Millisecond)
+	tracker.observe("b:53", 2*time.Second)
+
+	// b 恢复后 RTT 低于 a；只要定期探测 b，其 EWMA 就会下降并重新成为首选
+	probes := 0
+	for i := 0; i < 50*latencyProbeInterval; i++ {
+		switch tracker.pick() {
+		case "a:53":
+			tracker.observe("a:53", 10*time.Millisecond)
+		case "b:53":
+			probes++
+			tracker.observe("b:53", 5*time.Millisecond)
+		}
+		if tracker.selected() == "b:53" {
+			break
+		}
+	}
+	if probes == 0 {
+		t.Fatal("EWMA 较高的上游应被定期探测")
+	}
+	if got := tracker.selected(); got != "b:53" {
+		t.Errorf("恢复后的 b:53 应重新被选中, 实际 %s (%v)", got, tracker.snapshot())
+	}
+}
+
+func TestLatencyLoadBalance(t *testing.T) {
+	var fastCount, slowCount atomic.Int64
+	fast := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		fastCount.Add(1)
+		w.WriteMsg(answerA(r, "10.1.1.1"))
+	})
+	slow := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		slowCount.Add(1)
+		time.Sleep(30 * time.Millisecond)
+		w.WriteMsg(answerA(r, "10.1.1.2"))
+	})
+
+	configContent := `
+upstream:
+  server: "` + slow + `"
+  servers:
+    - "` + fast + `"
+  load_balance: latency
+  timeout: 2s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+cdn_ips:
+  - "10.0.0.0/8"
+`
+	server := newTestServer(t, configContent)
+	defer server.upstreamRTT.setCandidates(nil)
+
+	for i := 0; i < 20; i++ {
+		req := new(dns.Msg)
+		req.SetQuestion(fmt.Sprintf("www%d.example.com.", i), dns.TypeA)
+		w := &mockResponseWriter{}
+		server.ServeDNS(w, req)
+		if w.msg == nil || w.msg.Rcode != dns.RcodeSuccess {
+			t.Fatalf("查询 %d 失败: %v", i, w.msg)
+		}
+	}
+	if fastCount.Load() <= slowCount.Load() {
+		t.Errorf("低延迟上游应被更多地选择: fast=%d slow=%d", fastCount.Load(), slowCount.Load())
+	}
+	if slowCount.Load() == 0 {
+		t.Error("尚无样本的上游应至少被探测一次")
+	}
+
+	// 热加载后保留已测得的 EWMA
+	before := server.upstreamRTT.snapshot()
+	newCfg, err := config.LoadConfigFromBytes([]byte(configContent))
+	if err != nil {
+		t.Fatalf("解析新配置失败: %v", err)
+	}
+	server.OnConfigChange(server.currentConfig(), newCfg)
+	after := server.upstreamRTT.snapshot()
+	if len(after) != 2 || after[fast] != before[fast] || after[slow] != before[slow] {
+		t.Errorf("热加载后应保留 EWMA, 之前 %v, 之后 %v", before, after)
+	}
+
+	rec := httptest.NewRecorder()
+	server.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/upstream/latency", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码错误, 期望: 200, 实际: %d", rec.Code)
+	}
+	var resp UpstreamLatency
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if resp.LoadBalance != config.LoadBalanceLatency || resp.Selected != fast || len(resp.EWMAMs) != 2 || resp.EWMAMs[fast] >= resp.EWMAMs[slow] {
+		t.Errorf("/upstream/latency 响应错误: %+v", resp)
+	}
+}
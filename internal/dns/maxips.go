@@ -0,0 +1,62 @@
+package dns
+
+import (
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// capResponseIPs 按域名规则的 max_response_ips 限制通过 UDP 返回的 A/AAAA 记录数：优先保留 CDN IP，
+// 其次为非 CDN IP，均保持原有顺序，其他记录 (如 CNAME) 不受影响。发生截断时设置 TC 位，
+// 使支持 TCP 的客户端改用 TCP 获取完整结果，因此按 remote.Network() 只限制 UDP 查询，
+// TCP、DoT、DoH 与 DoQ (Network() 为 "quic") 均不做限制。
+// 缓存中保存的是完整响应，限制在写出前进行；需要截断时返回副本
+func (s *Server) capResponseIPs(resp *dns.Msg, remote net.Addr) *dns.Msg {
+	if resp == nil || len(resp.Question) == 0 {
+		return resp
+	}
+	if remote != nil && remote.Network() != "udp" {
+		return resp
+	}
+	rule := s.config.GetDomainRule(normalizeDomain(resp.Question[0].Name))
+	if rule == nil || rule.MaxResponseIPs <= 0 {
+		return resp
+	}
+
+	var cdn, other []int // A/AAAA 记录在应答段中的下标
+	for i, rr := range resp.Answer {
+		var ip net.IP
+		switch v := rr.(type) {
+		case *dns.A:
+			ip = v.A
+		case *dns.AAAA:
+			ip = v.AAAA
+		default:
+			continue
+		}
+		// 与 CDN 检测一致，域名规则配置了 cdn_cidr_override 时使用规则自己的网段
+		if s.cdnMatcherFor(resp, normalizeDomain(rr.Header().Name)).Contains(ip) {
+			cdn = append(cdn, i)
+		} else {
+			other = append(other, i)
+		}
+	}
+	if len(cdn)+len(other) <= rule.MaxResponseIPs {
+		return resp
+	}
+
+	drop := make(map[int]bool)
+	for _, i := range append(cdn, other...)[rule.MaxResponseIPs:] {
+		drop[i] = true
+	}
+	capped := resp.Copy()
+	answer := capped.Answer[:0]
+	for i, rr := range capped.Answer {
+		if !drop[i] {
+			answer = append(answer, rr)
+		}
+	}
+	capped.Answer = answer
+	capped.Truncated = true
+	return capped
+}
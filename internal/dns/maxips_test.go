@@ -0,0 +1,146 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/hao/fxdns/internal/util"
+	"github.com/miekg/dns"
+)
+
+func TestMaxResponseIPs(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		for i := 1; i <= 10; i++ {
+			m.Answer = append(m.Answer, answerA(r, fmt.Sprintf("10.0.0.%d", i)).Answer...)
+		}
+		w.WriteMsg(m)
+	})
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    strategy: "filter_non_cdn"
+    max_response_ips: 3
+`)
+
+	// 第二次查询来自缓存，同样应被截断
+	for _, source := range []string{"上游", "缓存"} {
+		req := new(dns.Msg)
+		req.SetQuestion("www.example.com.", dns.TypeA)
+		w := &mockResponseWriter{}
+		server.ServeDNS(w, req)
+		if w.msg == nil {
+			t.Fatalf("%s: 未收到响应", source)
+		}
+		if len(w.msg.Answer) != 3 {
+			t.Fatalf("%s: A 记录数量错误, 期望: 3, 实际: %d", source, len(w.msg.Answer))
+		}
+		for i, rr := range w.msg.Answer {
+			if expected := fmt.Sprintf("10.0.0.%d", i+1); rr.(*dns.A).A.String() != expected {
+				t.Errorf("%s: 第 %d 条记录错误, 期望: %s, 实际: %s", source, i, expected, rr.(*dns.A).A)
+			}
+		}
+		if !w.msg.Truncated {
+			t.Errorf("%s: 截断后应设置 TC 位", source)
+		}
+	}
+}
+
+func TestCapResponseIPs(t *testing.T) {
+	cidrMatcher := util.NewCIDRMatcher()
+	cidrMatcher.AddCIDRs([]string{"10.0.0.0/8"})
+	server := &Server{
+		config: &config.Config{
+			Domains: []config.DomainRule{
+				{Pattern: "www.example.com", Strategy: config.StrategyNone, MaxResponseIPs: 3},
+			},
+		},
+		cidrMatcher: cidrMatcher,
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	resp.Answer = append(resp.Answer, &dns.CNAME{
+		Hdr:    dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300},
+		Target: "www.example.com.",
+	})
+	for _, ip := range []string{"1.1.1.1", "10.0.0.1", "2.2.2.2", "10.0.0.2", "3.3.3.3"} {
+		resp.Answer = append(resp.Answer, answerA(req, ip).Answer...)
+	}
+	udp := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 5353}
+
+	// CDN IP 优先，其次为第一个非 CDN IP，保持原有顺序；CNAME 保留
+	capped := server.capResponseIPs(resp, udp)
+	var got []string
+	for _, rr := range capped.Answer {
+		if a, ok := rr.(*dns.A); ok {
+			got = append(got, a.A.String())
+		}
+	}
+	if fmt.Sprint(got) != "[1.1.1.1 10.0.0.1 10.0.0.2]" || len(capped.Answer) != 4 || !capped.Truncated {
+		t.Errorf("截断结果错误: %v (TC=%v)", capped.Answer, capped.Truncated)
+	}
+	if len(resp.Answer) != 6 || resp.Truncated {
+		t.Error("不应修改原响应")
+	}
+
+	// TCP 请求返回完整结果
+	if got := server.capResponseIPs(resp, &net.TCPAddr{IP: net.ParseIP("192.0.2.1")}); got != resp {
+		t.Error("TCP 请求不应截断")
+	}
+	// DoQ 虽基于 UDP，但消息经 QUIC 流传输，同样返回完整结果
+	if got := server.capResponseIPs(resp, doqAddr{udp}); got != resp {
+		t.Error("DoQ 请求不应截断")
+	}
+
+	// 未超出上限时原样返回
+	small := resp.Copy()
+	small.Answer = small.Answer[:3]
+	if got := server.capResponseIPs(small, udp); got != small || got.Truncated {
+		t.Error("未超出上限时不应截断")
+	}
+
+	// 配置了 cdn_cidr_override 的域名按规则自己的网段优先保留
+	cfg, err := config.LoadConfigFromBytes([]byte(`
+upstream:
+  server: "8.8.8.8:53"
+server:
+  listen: "127.0.0.1:53"
+  workers: 2
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "www.example.com"
+    strategy: "none"
+    max_response_ips: 3
+    cdn_cidr_override: ["1.1.1.0/24", "3.3.3.0/24"]
+`))
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	server.config = cfg
+	got = nil
+	for _, rr := range server.capResponseIPs(resp, udp).Answer {
+		if a, ok := rr.(*dns.A); ok {
+			got = append(got, a.A.String())
+		}
+	}
+	if fmt.Sprint(got) != "[1.1.1.1 10.0.0.1 3.3.3.3]" {
+		t.Errorf("cdn_cidr_override 的网段应优先保留, 实际: %v", got)
+	}
+}
@@ -0,0 +1,94 @@
+package dns
+
+import (
+	"log"
+	"time"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/hao/fxdns/internal/metrics"
+	"github.com/miekg/dns"
+)
+
+// drainingListener listen 变更后在宽限期内继续服务的旧监听
+type drainingListener struct {
+	server   *dns.Server
+	shutdown chan struct{} // 对应 ListenAndServe 协程的 shutdownChan
+	addr     string
+	timer    *time.Timer
+}
+
+// onlyListenChanged 判断两份配置之间的监听参数是否只有 server.listen 不同，此时可以平滑迁移
+func onlyListenChanged(oldConfig, newConfig *config.Config) bool {
+	return oldConfig.Server.Listen != newConfig.Server.Listen &&
+		oldConfig.Server.ListenTCP == newConfig.Server.ListenTCP &&
+		oldConfig.Server.Network == newConfig.Server.Network &&
+		oldConfig.Server.TLSCert == newConfig.Server.TLSCert &&
+		oldConfig.Server.TLSKey == newConfig.Server.TLSKey &&
+		newConfig.Server.Network != config.NetworkDoQ
+}
+
+// migrateListener 按当前配置在新地址上启动 DNS 监听，旧监听在宽限期内继续服务后再关闭，
+// 避免切换期间查询失败。调用此方法时，调用者应持有 s.mu 的锁。
+func (s *Server) migrateListener(grace time.Duration) {
+	if grace <= 0 {
+		grace = config.DefaultMigrationGracePeriod
+	}
+
+	old := &drainingListener{server: s.server, shutdown: s.shutdownChan, addr: s.ListenAddr()}
+	s.server = nil
+	s.shutdownChan = make(chan struct{})
+
+	log.Printf("DNS Server: 监听地址变更，旧监听 %s 将在 %v 后关闭，正在启动新监听...", old.addr, grace)
+	if err := s.startDNSServerProcess(); err != nil {
+		log.Printf("DNS Server: OnConfigChange 启动新 miekg/dns 服务器失败: %v", err)
+	}
+
+	metrics.ListenerMigrationCount.Inc()
+	s.draining = append(s.draining, old)
+	old.timer = time.AfterFunc(grace, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.closeDraining(old)
+	})
+}
+
+// closeDraining 关闭一个旧监听并将其移出列表。调用此方法时，调用者应持有 s.mu 的锁。
+func (s *Server) closeDraining(d *drainingListener) {
+	for i, cur := range s.draining {
+		if cur != d {
+			continue
+		}
+		s.draining = append(s.draining[:i], s.draining[i+1:]...)
+		select {
+		case <-d.shutdown:
+		default:
+			close(d.shutdown)
+		}
+		if err := d.server.Shutdown(); err != nil {
+			log.Printf("DNS Server: 关闭旧监听 %s 失败: %v", d.addr, err)
+		} else {
+			log.Printf("DNS Server: 旧监听 %s 宽限期结束，已关闭", d.addr)
+		}
+		return
+	}
+}
+
+// stopDraining 立即关闭所有仍在宽限期内的旧监听。调用此方法时，调用者应持有 s.mu 的锁。
+func (s *Server) stopDraining() {
+	for len(s.draining) > 0 {
+		d := s.draining[0]
+		d.timer.Stop()
+		s.closeDraining(d)
+	}
+}
+
+// DrainingAddrs 返回仍在宽限期内继续服务的旧监听地址
+func (s *Server) DrainingAddrs() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	addrs := make([]string, 0, len(s.draining))
+	for _, d := range s.draining {
+		addrs = append(addrs, d.addr)
+	}
+	return addrs
+}
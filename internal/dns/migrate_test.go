@@ -0,0 +1,114 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/miekg/dns"
+)
+
+// freeUDPAddr 返回一个当前空闲的本机 UDP 地址
+func freeUDPAddr(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("获取空闲端口失败: %v", err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().String()
+}
+
+// syncWorkers 取走并归还全部工作池令牌，使之后的 ServeDNS 调用与此前在测试协程中完成的配置变更
+// 建立先后关系。ServeDNS 读取 s.config 时不加锁，否则 -race 会报告热加载与查询之间的竞争
+func syncWorkers(s *Server) {
+	n := cap(s.workerPool)
+	for i := 0; i < n; i++ {
+		<-s.workerPool
+	}
+	for i := 0; i < n; i++ {
+		s.workerPool <- struct{}{}
+	}
+}
+
+func TestListenerMigration(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answerA(r, "10.1.1.1"))
+	})
+	configFor := func(listen string) string {
+		return `
+upstream:
+  server: "` + upstream + `"
+  timeout: 1s
+server:
+  listen: "` + listen + `"
+  migration_grace_period: 300ms
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+`
+	}
+
+	server := newTestServer(t, configFor("127.0.0.1:0"))
+	if err := server.Start(); err != nil {
+		t.Fatalf("启动服务器失败: %v", err)
+	}
+	defer server.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := server.WaitReady(ctx); err != nil {
+		t.Fatalf("等待监听就绪失败: %v", err)
+	}
+	oldAddr := server.ListenAddr()
+
+	newCfg, err := config.LoadConfigFromBytes([]byte(configFor(freeUDPAddr(t))))
+	if err != nil {
+		t.Fatalf("解析新配置失败: %v", err)
+	}
+
+	server.OnConfigChange(server.currentConfig(), newCfg)
+	if err := server.WaitReady(ctx); err != nil {
+		t.Fatalf("等待新监听就绪失败: %v", err)
+	}
+	syncWorkers(server)
+	newAddr := server.ListenAddr()
+	if newAddr == oldAddr {
+		t.Fatalf("监听地址未变化: %s", newAddr)
+	}
+
+	// 宽限期内新旧地址都能正常应答
+	client := &dns.Client{Timeout: time.Second}
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	for _, addr := range []string{oldAddr, newAddr} {
+		if resp, _, err := client.Exchange(req, addr); err != nil || resp.Rcode != dns.RcodeSuccess {
+			t.Errorf("迁移期间查询 %s 失败: %v", addr, err)
+		}
+	}
+	if draining := server.Status().DrainingListen; len(draining) != 1 || draining[0] != oldAddr {
+		t.Errorf("draining_listen 错误, 期望: [%s], 实际: %v", oldAddr, draining)
+	}
+	if server.Status().Listen != newAddr {
+		t.Errorf("主监听应为新地址 %s, 实际: %s", newAddr, server.Status().Listen)
+	}
+
+	// 宽限期结束后旧监听关闭
+	deadline := time.Now().Add(3 * time.Second)
+	for len(server.DrainingAddrs()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("宽限期结束后旧监听仍未关闭")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	client.Timeout = 200 * time.Millisecond
+	if _, _, err := client.Exchange(req, oldAddr); err == nil {
+		t.Errorf("旧地址 %s 在宽限期结束后仍在应答", oldAddr)
+	}
+	if _, _, err := client.Exchange(req, newAddr); err != nil {
+		t.Errorf("新地址 %s 查询失败: %v", newAddr, err)
+	}
+}
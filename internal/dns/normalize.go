@@ -0,0 +1,69 @@
+package dns
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// deduplicateAnswer 去掉应答段中的重复记录并保持原有顺序：同一名称下相同 IP 的 A/AAAA 记录、
+// 同一名称指向相同目标的 CNAME 记录只保留第一次出现的一条，其他类型的记录原样保留。
+// 没有重复时返回 rrs 本身
+func deduplicateAnswer(rrs []dns.RR) []dns.RR {
+	seen := make(map[string]bool, len(rrs))
+	var result []dns.RR
+	for i, rr := range rrs {
+		var key string
+		switch v := rr.(type) {
+		case *dns.A:
+			key = "A " + strings.ToLower(v.Hdr.Name) + " " + v.A.String()
+		case *dns.AAAA:
+			key = "AAAA " + strings.ToLower(v.Hdr.Name) + " " + v.AAAA.String()
+		case *dns.CNAME:
+			key = "CNAME " + strings.ToLower(v.Hdr.Name) + " " + strings.ToLower(v.Target)
+		}
+		if key != "" && seen[key] {
+			if result == nil {
+				result = append(make([]dns.RR, 0, len(rrs)), rrs[:i]...)
+			}
+			continue
+		}
+		if key != "" {
+			seen[key] = true
+		}
+		if result != nil {
+			result = append(result, rr)
+		}
+	}
+	if result == nil {
+		return rrs
+	}
+	return result
+}
+
+// normalizeResponse 对配置了 normalize_response 的域名去掉应答段中的重复记录，在写入缓存与返回客户端之前调用。
+// 规则未要求或没有重复记录时原样返回，否则返回去重后的副本
+func (s *Server) normalizeResponse(domain string, resp *dns.Msg) *dns.Msg {
+	if resp == nil || len(resp.Answer) < 2 {
+		return resp
+	}
+	rule := s.config.GetDomainRule(normalizeDomain(domain))
+	if rule == nil || !rule.NormalizeResponse {
+		return resp
+	}
+	if len(deduplicateAnswer(resp.Answer)) == len(resp.Answer) {
+		return resp
+	}
+	normalized := resp.Copy()
+	normalized.Answer = deduplicateAnswer(normalized.Answer)
+	return normalized
+}
+
+// finalizeResponse 在写入缓存与返回客户端之前依次对响应做 modify_expr 改写、防 DNS 重绑定过滤、TTL 缩放、去重与附加段清理
+func (s *Server) finalizeResponse(domain string, resp *dns.Msg) *dns.Msg {
+	resp = s.applyModifyExpr(domain, resp)
+	resp = s.filterRebinding(domain, resp)
+	resp = s.scaleResponseTTL(domain, resp)
+	resp = s.normalizeResponse(domain, resp)
+	return s.stripAdditional(domain, resp)
+}
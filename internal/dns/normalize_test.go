@@ -0,0 +1,108 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestDeduplicateAnswer(t *testing.T) {
+	parse := func(records ...string) []dns.RR {
+		rrs := make([]dns.RR, 0, len(records))
+		for _, s := range records {
+			rr, err := dns.NewRR(s)
+			if err != nil {
+				t.Fatalf("解析记录 %q 失败: %v", s, err)
+			}
+			rrs = append(rrs, rr)
+		}
+		return rrs
+	}
+	format := func(rrs []dns.RR) string {
+		parts := make([]string, 0, len(rrs))
+		for _, rr := range rrs {
+			parts = append(parts, rr.String())
+		}
+		return strings.Join(parts, "\n")
+	}
+
+	testCases := []struct {
+		name     string
+		input    []dns.RR
+		expected []dns.RR
+	}{
+		{
+			"重复的 A 记录保留第一次出现的",
+			parse("a.example.com. 60 IN A 10.0.0.1", "a.example.com. 60 IN A 10.0.0.2", "a.example.com. 30 IN A 10.0.0.1", "a.example.com. 60 IN A 10.0.0.3"),
+			parse("a.example.com. 60 IN A 10.0.0.1", "a.example.com. 60 IN A 10.0.0.2", "a.example.com. 60 IN A 10.0.0.3"),
+		},
+		{
+			"重复的 CNAME 目标",
+			parse("www.example.com. 60 IN CNAME cdn.example.net.", "WWW.example.com. 60 IN CNAME CDN.example.net.", "cdn.example.net. 60 IN A 10.0.0.1", "cdn.example.net. 60 IN A 10.0.0.1"),
+			parse("www.example.com. 60 IN CNAME cdn.example.net.", "cdn.example.net. 60 IN A 10.0.0.1"),
+		},
+		{
+			"不同名称下的相同 IP 不视为重复",
+			parse("a.example.com. 60 IN A 10.0.0.1", "b.example.com. 60 IN A 10.0.0.1"),
+			parse("a.example.com. 60 IN A 10.0.0.1", "b.example.com. 60 IN A 10.0.0.1"),
+		},
+		{
+			"重复的 AAAA 记录与其他类型",
+			parse("a.example.com. 60 IN AAAA 2001:db8::1", "a.example.com. 60 IN TXT \"x\"", "a.example.com. 60 IN AAAA 2001:DB8:0::1", "a.example.com. 60 IN TXT \"x\""),
+			parse("a.example.com. 60 IN AAAA 2001:db8::1", "a.example.com. 60 IN TXT \"x\"", "a.example.com. 60 IN TXT \"x\""),
+		},
+		{"空应答", nil, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := deduplicateAnswer(tc.input); format(got) != format(tc.expected) {
+				t.Errorf("去重结果错误\n期望:\n%s\n实际:\n%s", format(tc.expected), format(got))
+			}
+		})
+	}
+}
+
+func TestNormalizeResponse(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := answerA(r, "10.0.0.1")
+		m.Answer = append(m.Answer, answerA(r, "10.0.0.2").Answer[0], answerA(r, "10.0.0.1").Answer[0])
+		w.WriteMsg(m)
+	})
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 500ms
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.normalized.com"
+    normalize_response: true
+`)
+
+	query := func(name string) []dns.RR {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		w := &mockResponseWriter{}
+		server.ServeDNS(w, req)
+		if w.msg == nil {
+			t.Fatalf("%s 未收到响应", name)
+		}
+		return w.msg.Answer
+	}
+
+	for i := 0; i < 2; i++ { // 第二次查询命中缓存
+		if answer := query("www.normalized.com."); len(answer) != 2 ||
+			answer[0].(*dns.A).A.String() != "10.0.0.1" || answer[1].(*dns.A).A.String() != "10.0.0.2" {
+			t.Errorf("第 %d 次查询应返回去重后的 2 条记录, 实际: %v", i+1, answer)
+		}
+	}
+	if answer := query("www.other.com."); len(answer) != 3 {
+		t.Errorf("未配置 normalize_response 的域名不应去重, 实际: %v", answer)
+	}
+}
@@ -0,0 +1,214 @@
+package dns
+
+import (
+	"bytes"
+	"container/list"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/miekg/dns"
+)
+
+// cdn_response_order 为 latency_sorted 时探测各 IP RTT 的参数
+const (
+	cdnProbePort     = "443"           // 以 TCP 连接此端口的耗时作为 RTT
+	cdnProbeTimeout  = 2 * time.Second // 连接超时，失败时按此值记录
+	cdnProbeInterval = 5 * time.Minute // 同一 IP 两次探测的最短间隔
+	cdnProbeMaxIPs   = 4096            // 记录的 IP 数上限，达到后淘汰最久未参与排序的 IP
+)
+
+// cdnLatencyTable 记录服务器到各 CDN IP 的历史 RTT (指数加权移动平均)，供 latency_sorted 排序使用。
+// 排序时发现没有样本或样本已过期的 IP 会在后台探测，本次响应不等待探测结果。
+// 记录数达到上限时按 LRU 淘汰，CDN 节点更换后旧 IP 不会一直占据表项
+type cdnLatencyTable struct {
+	mu      sync.Mutex
+	entries map[string]*cdnLatencyEntry
+	order   *list.List // 表头为最近参与排序的 IP
+	maxIPs  int
+	// probe 测量到 ip 的 RTT，测试中可替换
+	probe func(ip net.IP) (time.Duration, error)
+}
+
+type cdnLatencyEntry struct {
+	rtt       float64 // 毫秒，尚无样本时为 0
+	sampled   bool
+	probing   bool
+	lastProbe time.Time
+	elem      *list.Element
+}
+
+func newCDNLatencyTable() *cdnLatencyTable {
+	return &cdnLatencyTable{
+		entries: make(map[string]*cdnLatencyEntry),
+		order:   list.New(),
+		maxIPs:  cdnProbeMaxIPs,
+		probe:   probeTCP,
+	}
+}
+
+// probeTCP 以 TCP 连接 ip:443 的耗时作为 RTT
+func probeTCP(ip net.IP) (time.Duration, error) {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip.String(), cdnProbePort), cdnProbeTimeout)
+	if err != nil {
+		return 0, err
+	}
+	conn.Close()
+	return time.Since(start), nil
+}
+
+// lookup 返回 ip 的历史 RTT，没有样本时返回 false；必要时在后台发起探测
+func (t *cdnLatencyTable) lookup(ip net.IP) (float64, bool) {
+	key := ip.String()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.entries[key]
+	if ok {
+		t.order.MoveToFront(e.elem)
+	} else {
+		for len(t.entries) >= t.maxIPs && t.order.Len() > 0 {
+			delete(t.entries, t.order.Remove(t.order.Back()).(string))
+		}
+		e = &cdnLatencyEntry{elem: t.order.PushFront(key)}
+		t.entries[key] = e
+	}
+	if !e.probing && time.Since(e.lastProbe) >= cdnProbeInterval {
+		e.probing = true
+		e.lastProbe = time.Now()
+		go t.runProbe(key, ip)
+	}
+	return e.rtt, e.sampled
+}
+
+// runProbe 探测一次并更新记录，失败时按 cdnProbeTimeout 记录
+func (t *cdnLatencyTable) runProbe(key string, ip net.IP) {
+	rtt, err := t.probe(ip)
+	if err != nil {
+		rtt = cdnProbeTimeout
+	}
+	t.observe(key, rtt)
+}
+
+// observe 以一个 RTT 样本更新 key 的记录，探测期间已被淘汰的 IP 忽略
+func (t *cdnLatencyTable) observe(key string, rtt time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.entries[key]
+	if !ok {
+		return
+	}
+	ms := float64(rtt) / float64(time.Millisecond)
+	if e.sampled {
+		ms = latencyEWMAAlpha*ms + (1-latencyEWMAAlpha)*e.rtt
+	}
+	e.rtt, e.sampled, e.probing = ms, true, false
+}
+
+// xorDistance 返回 a 与 b 按位异或的结果，字节序比较越小表示共同前缀越长。地址族不同时返回 nil
+func xorDistance(a, b net.IP) []byte {
+	if a4, b4 := a.To4(), b.To4(); a4 != nil || b4 != nil {
+		if a4 == nil || b4 == nil {
+			return nil
+		}
+		a, b = a4, b4
+	} else {
+		a, b = a.To16(), b.To16()
+	}
+	d := make([]byte, len(a))
+	for i := range a {
+		d[i] = a[i] ^ b[i]
+	}
+	return d
+}
+
+// orderIPs 按 mode 返回 ips 的新排列 (下标)，original 或无法排序时返回 nil。
+// probe 为 false 时 latency_sorted 不探测也不排序
+func (s *Server) orderIPs(ips []net.IP, mode string, probe bool, clientIP net.IP) []int {
+	order := make([]int, len(ips))
+	for i := range order {
+		order[i] = i
+	}
+	switch mode {
+	case config.CDNOrderRandom:
+		rand.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	case config.CDNOrderClientIPSorted:
+		if clientIP == nil {
+			return nil
+		}
+		dist := make([][]byte, len(ips))
+		for i, ip := range ips {
+			dist[i] = xorDistance(ip, clientIP)
+		}
+		// 与客户端地址族相同的 IP 在前，按距离升序，距离相同时保持原有顺序
+		sort.SliceStable(order, func(i, j int) bool {
+			di, dj := dist[order[i]], dist[order[j]]
+			if di == nil || dj == nil {
+				return di != nil && dj == nil
+			}
+			return bytes.Compare(di, dj) < 0
+		})
+	case config.CDNOrderLatencySorted:
+		// 只有显式开启 cdn_latency_probe 的规则才会主动连接应答中的 IP
+		if s.cdnRTT == nil || !probe {
+			return nil
+		}
+		rtts := make([]float64, len(ips))
+		sampled := make([]bool, len(ips))
+		for i, ip := range ips {
+			rtts[i], sampled[i] = s.cdnRTT.lookup(ip)
+		}
+		// 有样本的 IP 在前，按 RTT 升序；没有样本的 IP 保持原有顺序排在后面
+		sort.SliceStable(order, func(i, j int) bool {
+			si, sj := sampled[order[i]], sampled[order[j]]
+			if !si || !sj {
+				return si && !sj
+			}
+			return rtts[order[i]] < rtts[order[j]]
+		})
+	default:
+		return nil
+	}
+	return order
+}
+
+// applyResponseOrder 按域名规则的 cdn_response_order 重新排列应答中属于 CDN 网段的 A/AAAA 记录，
+// 非 CDN IP 与其他记录 (如 CNAME) 位置不变。缓存中保存的是上游顺序的响应，排序在写出前进行；需要调整时返回副本
+func (s *Server) applyResponseOrder(resp *dns.Msg, clientIP net.IP) *dns.Msg {
+	if resp == nil || len(resp.Question) == 0 {
+		return resp
+	}
+	rule := s.config.GetDomainRule(normalizeDomain(resp.Question[0].Name))
+	if rule == nil || rule.CDNResponseOrder == "" || rule.CDNResponseOrder == config.CDNOrderOriginal {
+		return resp
+	}
+
+	var slots []int // CDN IP 的 A/AAAA 记录在应答段中的下标
+	var ips []net.IP
+	for i, rr := range resp.Answer {
+		if ip := rrIP(rr); ip != nil && s.cdnMatcherFor(resp, normalizeDomain(rr.Header().Name)).Contains(ip) {
+			slots = append(slots, i)
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) < 2 {
+		return resp
+	}
+	order := s.orderIPs(ips, rule.CDNResponseOrder, rule.CDNLatencyProbe, clientIP)
+	if order == nil {
+		return resp
+	}
+
+	ordered := resp.Copy()
+	records := make([]dns.RR, len(slots))
+	for i, slot := range slots {
+		records[i] = ordered.Answer[slot]
+	}
+	for i, slot := range slots {
+		ordered.Answer[slot] = records[order[i]]
+	}
+	return ordered
+}
@@ -0,0 +1,257 @@
+package dns
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/hao/fxdns/internal/util"
+	"github.com/miekg/dns"
+)
+
+// orderedResponse 构造 name 的应答：一条 CNAME 之后依次为 ips 的 A/AAAA 记录
+func orderedResponse(name string, ips ...string) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion(name, dns.TypeA)
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	resp.Answer = append(resp.Answer, &dns.CNAME{
+		Hdr:    dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300},
+		Target: "edge.example.net.",
+	})
+	for _, ip := range ips {
+		hdr := dns.RR_Header{Name: "edge.example.net.", Class: dns.ClassINET, Ttl: 300}
+		if parsed := net.ParseIP(ip); parsed.To4() != nil {
+			hdr.Rrtype = dns.TypeA
+			resp.Answer = append(resp.Answer, &dns.A{Hdr: hdr, A: parsed})
+		} else {
+			hdr.Rrtype = dns.TypeAAAA
+			resp.Answer = append(resp.Answer, &dns.AAAA{Hdr: hdr, AAAA: parsed})
+		}
+	}
+	return resp
+}
+
+// answerIPs 返回应答中 A/AAAA 记录的地址，第一条记录不是 CNAME 时返回 nil
+func answerIPs(resp *dns.Msg) []string {
+	if _, ok := resp.Answer[0].(*dns.CNAME); !ok {
+		return nil
+	}
+	var ips []string
+	for _, rr := range resp.Answer {
+		if ip := rrIP(rr); ip != nil {
+			ips = append(ips, ip.String())
+		}
+	}
+	return ips
+}
+
+// newOrderingServer 返回 cdn.example.com 按 order 排序的服务器，192.0.2.0/24 不属于 CDN 网段
+func newOrderingServer(order string) *Server {
+	cidrMatcher := util.NewCIDRMatcher()
+	cidrMatcher.AddCIDRs([]string{"10.0.0.0/8", "198.51.100.0/24", "203.0.113.0/24", "2001:db8::/32"})
+	return &Server{
+		config: &config.Config{
+			Domains: []config.DomainRule{{Pattern: "cdn.example.com", Strategy: config.StrategyFilterNonCDN, CDNResponseOrder: order, CDNLatencyProbe: true}},
+		},
+		cidrMatcher: cidrMatcher,
+		cdnRTT:      newCDNLatencyTable(),
+	}
+}
+
+func TestResponseOrderOriginal(t *testing.T) {
+	ips := []string{"10.0.0.3", "10.0.0.1", "10.0.0.2"}
+	for _, order := range []string{"", config.CDNOrderOriginal} {
+		server := newOrderingServer(order)
+		resp := orderedResponse("cdn.example.com.", ips...)
+		if got := server.applyResponseOrder(resp, net.ParseIP("10.0.0.1")); got != resp {
+			t.Errorf("%q: 应原样返回上游顺序的响应, 实际 %v", order, answerIPs(got))
+		}
+	}
+	// 未匹配规则的域名不调整
+	server := newOrderingServer(config.CDNOrderRandom)
+	resp := orderedResponse("other.example.com.", ips...)
+	if got := server.applyResponseOrder(resp, nil); got != resp {
+		t.Error("未匹配规则的域名不应调整顺序")
+	}
+}
+
+func TestResponseOrderClientIPSorted(t *testing.T) {
+	server := newOrderingServer(config.CDNOrderClientIPSorted)
+	resp := orderedResponse("cdn.example.com.", "2001:db8::1", "203.0.113.9", "198.51.100.20", "198.51.100.7", "10.9.9.9")
+
+	got := server.applyResponseOrder(resp, net.ParseIP("198.51.100.5"))
+	want := "198.51.100.7 198.51.100.20 203.0.113.9 10.9.9.9 2001:db8::1"
+	if strings.Join(answerIPs(got), " ") != want {
+		t.Errorf("按 XOR 距离排序期望 %s, 实际 %v", want, answerIPs(got))
+	}
+	if strings.Join(answerIPs(resp), " ") != "2001:db8::1 203.0.113.9 198.51.100.20 198.51.100.7 10.9.9.9" {
+		t.Error("原始响应（缓存内容）不应被修改")
+	}
+
+	// IPv6 客户端优先同地址族的 IP
+	got = server.applyResponseOrder(resp, net.ParseIP("2001:db8::2"))
+	if ips := answerIPs(got); ips[0] != "2001:db8::1" {
+		t.Errorf("IPv6 客户端应优先得到 IPv6 地址, 实际 %v", ips)
+	}
+
+	// 无法取得客户端 IP 时保持原有顺序
+	if got := server.applyResponseOrder(resp, nil); got != resp {
+		t.Error("没有客户端 IP 时不应调整顺序")
+	}
+}
+
+func TestResponseOrderRandom(t *testing.T) {
+	server := newOrderingServer(config.CDNOrderRandom)
+	ips := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"}
+	resp := orderedResponse("cdn.example.com.", ips...)
+
+	firsts := make(map[string]int)
+	for i := 0; i < 400; i++ {
+		got := answerIPs(server.applyResponseOrder(resp, nil))
+		if len(got) != len(ips) {
+			t.Fatalf("打乱后的记录数错误或 CNAME 位置改变: %v", got)
+		}
+		firsts[got[0]]++
+	}
+	// 每个 IP 都应有机会排在第一位，期望约 100 次
+	for _, ip := range ips {
+		if n := firsts[ip]; n < 50 || n > 150 {
+			t.Errorf("%s 排在第一位的次数分布不均: %d", ip, n)
+		}
+	}
+}
+
+func TestResponseOrderOnlyCDNIPs(t *testing.T) {
+	server := newOrderingServer(config.CDNOrderRandom)
+	resp := orderedResponse("cdn.example.com.", "192.0.2.1", "10.0.0.1", "10.0.0.2", "192.0.2.2", "10.0.0.3")
+
+	moved := false
+	for i := 0; i < 100; i++ {
+		got := answerIPs(server.applyResponseOrder(resp, nil))
+		if got[0] != "192.0.2.1" || got[3] != "192.0.2.2" {
+			t.Fatalf("非 CDN IP 的位置不应改变: %v", got)
+		}
+		if got[1] != "10.0.0.1" {
+			moved = true
+		}
+	}
+	if !moved {
+		t.Error("CDN IP 应被打乱")
+	}
+
+	// 只有一个 CDN IP 时无需排序
+	resp = orderedResponse("cdn.example.com.", "192.0.2.1", "192.0.2.2", "10.0.0.1")
+	if got := server.applyResponseOrder(resp, nil); got != resp {
+		t.Error("CDN IP 少于两个时不应调整顺序")
+	}
+}
+
+func TestResponseOrderLatencySorted(t *testing.T) {
+	server := newOrderingServer(config.CDNOrderLatencySorted)
+	rtts := map[string]time.Duration{"10.0.0.1": 80 * time.Millisecond, "10.0.0.2": 5 * time.Millisecond}
+	var mu sync.Mutex
+	probed := make(map[string]int)
+	server.cdnRTT.probe = func(ip net.IP) (time.Duration, error) {
+		mu.Lock()
+		probed[ip.String()]++
+		mu.Unlock()
+		if rtt, ok := rtts[ip.String()]; ok {
+			return rtt, nil
+		}
+		return 0, net.UnknownNetworkError("unreachable")
+	}
+
+	resp := orderedResponse("cdn.example.com.", "10.0.0.3", "192.0.2.1", "10.0.0.1", "10.0.0.2")
+
+	// 未开启 cdn_latency_probe 时不探测也不排序
+	server.config.Domains[0].CDNLatencyProbe = false
+	if got := server.applyResponseOrder(resp, nil); got != resp {
+		t.Error("未开启 cdn_latency_probe 时不应调整顺序")
+	}
+	server.config.Domains[0].CDNLatencyProbe = true
+
+	// 第一次没有任何样本，保持原有顺序并在后台探测
+	if got := answerIPs(server.applyResponseOrder(resp, nil)); strings.Join(got, " ") != "10.0.0.3 192.0.2.1 10.0.0.1 10.0.0.2" {
+		t.Errorf("没有样本时应保持原有顺序, 实际 %v", got)
+	}
+	deadline := time.Now().Add(time.Second)
+	for !allSampled(server.cdnRTT, 3) {
+		if time.Now().After(deadline) {
+			t.Fatal("应在后台探测每个 IP")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// 探测失败的 10.0.0.3 按超时记录，排在最后；非 CDN IP 位置不变
+	want := "10.0.0.2 192.0.2.1 10.0.0.1 10.0.0.3"
+	if got := answerIPs(server.applyResponseOrder(resp, nil)); strings.Join(got, " ") != want {
+		t.Errorf("按 RTT 排序期望 %s, 实际 %v", want, got)
+	}
+
+	// 探测间隔内不重复探测，非 CDN IP 不探测
+	mu.Lock()
+	defer mu.Unlock()
+	if probed["192.0.2.1"] != 0 {
+		t.Error("不应探测非 CDN IP")
+	}
+	for ip, n := range probed {
+		if n != 1 {
+			t.Errorf("%s 在探测间隔内被探测了 %d 次", ip, n)
+		}
+	}
+}
+
+// allSampled 判断 table 中是否已有 n 个 IP 得到 RTT 样本
+func allSampled(table *cdnLatencyTable, n int) bool {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	sampled := 0
+	for _, e := range table.entries {
+		if e.sampled {
+			sampled++
+		}
+	}
+	return sampled == n
+}
+
+func TestCDNLatencyTableEviction(t *testing.T) {
+	table := newCDNLatencyTable()
+	table.maxIPs = 2
+	table.probe = func(ip net.IP) (time.Duration, error) { return time.Millisecond, nil }
+
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.1", "10.0.0.3"} {
+		table.lookup(net.ParseIP(ip))
+	}
+	table.mu.Lock()
+	_, kept := table.entries["10.0.0.1"]
+	_, evicted := table.entries["10.0.0.2"]
+	n, listed := len(table.entries), table.order.Len()
+	table.mu.Unlock()
+	if n != 2 || listed != 2 {
+		t.Fatalf("记录数应不超过上限 2, 实际 %d (LRU 链表 %d)", n, listed)
+	}
+	if !kept || evicted {
+		t.Error("应淘汰最久未参与排序的 10.0.0.2，保留最近使用的 10.0.0.1")
+	}
+
+	// 探测期间被淘汰的 IP 不应重新加入
+	table.observe("10.0.0.2", time.Millisecond)
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	if _, ok := table.entries["10.0.0.2"]; ok {
+		t.Error("已淘汰的 IP 的探测结果应被忽略")
+	}
+}
+
+func TestXORDistance(t *testing.T) {
+	if d := xorDistance(net.ParseIP("10.0.0.1"), net.ParseIP("2001:db8::1")); d != nil {
+		t.Errorf("地址族不同时应返回 nil, 实际 %v", d)
+	}
+	if d := xorDistance(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.3")); len(d) != 4 || d[3] != 2 {
+		t.Errorf("IPv4 的 XOR 距离错误: %v", d)
+	}
+}
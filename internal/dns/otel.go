@@ -0,0 +1,104 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName 查询处理追踪使用的 Tracer 名称
+const tracerName = "github.com/hao/fxdns/internal/dns"
+
+// tracerShutdownTimeout 替换或停止追踪时等待剩余追踪数据导出的最长时间
+const tracerShutdownTimeout = 5 * time.Second
+
+// noopTracer 未配置 observability.otel_endpoint 时使用，不产生任何开销
+var noopTracer = noop.NewTracerProvider().Tracer(tracerName)
+
+// newOTelTracerProvider 创建将追踪数据批量导出到 OTLP/HTTP 地址 endpoint 的 TracerProvider
+func newOTelTracerProvider(endpoint string) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "fxdns"))),
+	), nil
+}
+
+// configureTracing 按 observability.otel_endpoint 启用或关闭查询追踪，endpoint 为空时关闭
+func (s *Server) configureTracing(endpoint string) error {
+	if endpoint == "" {
+		s.setTracerProvider(nil)
+		return nil
+	}
+	tp, err := newOTelTracerProvider(endpoint)
+	if err != nil {
+		return fmt.Errorf("启用查询追踪失败: %w", err)
+	}
+	s.setTracerProvider(tp)
+	log.Printf("DNS Server: 查询追踪已启用，导出到 %s", endpoint)
+	return nil
+}
+
+// setTracerProvider 替换查询追踪使用的 TracerProvider，并导出、关闭原有的 TracerProvider；tp 为 nil 时关闭追踪
+func (s *Server) setTracerProvider(tp *sdktrace.TracerProvider) {
+	old := s.tracerProvider.Swap(tp)
+	if old == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tracerShutdownTimeout)
+	defer cancel()
+	if err := old.Shutdown(ctx); err != nil {
+		log.Printf("DNS Server: 关闭查询追踪失败: %v", err)
+	}
+}
+
+// tracer 返回当前的查询追踪 Tracer，未启用追踪时返回不记录任何数据的 Tracer
+func (s *Server) tracer() trace.Tracer {
+	if tp := s.tracerProvider.Load(); tp != nil {
+		return tp.Tracer(tracerName)
+	}
+	return noopTracer
+}
+
+// endQuerySpan 将查询记录中的结果写入根 span 的属性并结束 span
+func endQuerySpan(span trace.Span, entry QueryLogEntry) {
+	if span.IsRecording() {
+		span.SetAttributes(
+			attribute.String("dns.question.name", entry.Domain),
+			attribute.String("dns.question.type", entry.Qtype),
+			attribute.String("dns.response.rcode", entry.Rcode),
+			attribute.Bool("dns.cdn.detected", entry.CDNDetected),
+			attribute.Bool("dns.cache.hit", entry.CacheHit),
+			attribute.String("dns.upstream.address", entry.Upstream),
+			attribute.Float64("dns.latency_ms", float64(entry.Latency)/float64(time.Millisecond)),
+		)
+	}
+	span.End()
+}
+
+// startUpstreamSpan 在 ctx 所属的查询追踪下开始一次向 addr 的上游查询子 span
+func (s *Server) startUpstreamSpan(ctx context.Context, addr string) trace.Span {
+	_, span := s.tracer().Start(ctx, "dns.upstream.query", trace.WithAttributes(attribute.String("dns.upstream.address", addr)))
+	return span
+}
+
+// endSpan 结束 span，err 非空时记录错误并将状态设为 Error
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
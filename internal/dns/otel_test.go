@@ -0,0 +1,120 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestQueryTracing(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answerA(r, "10.0.0.1"))
+	})
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 500ms
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 1m
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.traced.com"
+    strategy: "filter_non_cdn"
+`)
+	exporter := tracetest.NewInMemoryExporter()
+	server.setTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { server.setTracerProvider(nil) })
+
+	query := func() {
+		req := new(dns.Msg)
+		req.SetQuestion("www.traced.com.", dns.TypeA)
+		w := &mockResponseWriter{}
+		server.ServeDNS(w, req)
+		if w.msg == nil {
+			t.Fatal("未收到响应")
+		}
+	}
+	attrs := func(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+		m := make(map[attribute.Key]attribute.Value)
+		for _, kv := range span.Attributes {
+			m[kv.Key] = kv.Value
+		}
+		return m
+	}
+
+	// 第一次查询未命中缓存，经过上游查询与 CDN 过滤
+	query()
+	spans := exporter.GetSpans()
+	var root tracetest.SpanStub
+	children := make(map[string]bool)
+	for _, span := range spans {
+		if span.Name == "dns.query" {
+			root = span
+		}
+	}
+	if !root.SpanContext.IsValid() {
+		t.Fatalf("应记录根 span dns.query, 实际: %d 个 span", len(spans))
+	}
+	for _, span := range spans {
+		if span.Parent.SpanID() == root.SpanContext.SpanID() {
+			children[span.Name] = true
+		}
+	}
+	for _, name := range []string{"dns.cache.lookup", "dns.upstream.query", "dns.cdn.filter"} {
+		if !children[name] {
+			t.Errorf("根 span 下应有子 span %s, 实际: %v", name, children)
+		}
+	}
+
+	a := attrs(root)
+	if a["dns.question.name"].AsString() != "www.traced.com" || a["dns.question.type"].AsString() != "A" ||
+		a["dns.response.rcode"].AsString() != "NOERROR" || !a["dns.cdn.detected"].AsBool() ||
+		a["dns.cache.hit"].AsBool() || a["dns.upstream.address"].AsString() != upstream {
+		t.Errorf("根 span 属性错误: %v", root.Attributes)
+	}
+	if _, ok := a["dns.latency_ms"]; !ok {
+		t.Error("根 span 应包含 dns.latency_ms")
+	}
+
+	// 第二次查询命中缓存，不查询上游
+	exporter.Reset()
+	query()
+	for _, span := range exporter.GetSpans() {
+		switch span.Name {
+		case "dns.query":
+			if !attrs(span)["dns.cache.hit"].AsBool() {
+				t.Errorf("缓存命中时 dns.cache.hit 应为 true: %v", span.Attributes)
+			}
+		case "dns.upstream.query", "dns.cdn.filter":
+			t.Errorf("缓存命中时不应记录 %s", span.Name)
+		}
+	}
+}
+
+func TestQueryTracingConfig(t *testing.T) {
+	server := newTestServer(t, `
+upstream:
+  server: "127.0.0.1:1"
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+cdn_ips:
+  - "10.0.0.0/8"
+observability:
+  otel_endpoint: "http://127.0.0.1:4318"
+`)
+	if server.tracerProvider.Load() == nil {
+		t.Fatal("配置了 otel_endpoint 时应启用查询追踪")
+	}
+	server.setTracerProvider(nil)
+	if server.tracer() != noopTracer {
+		t.Error("关闭追踪后应使用不记录数据的 Tracer")
+	}
+}
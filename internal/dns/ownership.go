@@ -0,0 +1,71 @@
+package dns
+
+import (
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hao/fxdns/internal/metrics"
+	"github.com/hao/fxdns/internal/util"
+	"github.com/miekg/dns"
+)
+
+// verifyCDNOwnership 查询域名命中的规则开启了 verify_cdnip_ownership 时，经备用上游 (未配置时使用主上游)
+// 并行反查每个 CDN IP 的 PTR 记录，只保留 PTR 名称匹配 cdn_ownership_pattern 的 IP；
+// 反查失败或没有 PTR 记录的 IP 同样被剔除。未开启时原样返回 ips
+func (s *Server) verifyCDNOwnership(qname string, ips []net.IP, timeout time.Duration) []net.IP {
+	rule := s.config.GetDomainRule(normalizeDomain(qname))
+	if rule == nil || !rule.VerifyCDNIPOwnership || len(ips) == 0 {
+		return ips
+	}
+	addr := strings.TrimSpace(s.config.Upstream.FallbackServer)
+	if addr == "" {
+		addr = s.upstream
+	}
+
+	pattern := util.CompileDomainPattern(rule.CDNOwnershipPattern)
+	owned := make([]bool, len(ips))
+	var wg sync.WaitGroup
+	for i, ip := range ips {
+		wg.Add(1)
+		go func(i int, ip net.IP) {
+			defer wg.Done()
+			owned[i] = s.ptrMatches(ip, pattern, addr, timeout)
+		}(i, ip)
+	}
+	wg.Wait()
+
+	verified := make([]net.IP, 0, len(ips))
+	for i, ip := range ips {
+		if owned[i] {
+			verified = append(verified, ip)
+			continue
+		}
+		metrics.CDNOwnershipRejectCount.Inc()
+		log.Printf("CDN IP %s 的 PTR 记录不匹配 %s，不视为 CDN IP。请求: %s", ip, rule.CDNOwnershipPattern, qname)
+	}
+	return verified
+}
+
+// ptrMatches 向 addr 查询 ip 的 PTR 记录，任一 PTR 名称匹配 pattern 时返回 true
+func (s *Server) ptrMatches(ip net.IP, pattern *util.DomainPattern, addr string, timeout time.Duration) bool {
+	name, err := dns.ReverseAddr(ip.String())
+	if err != nil {
+		return false
+	}
+	m := new(dns.Msg)
+	m.SetQuestion(name, dns.TypePTR)
+	resp, _, err := s.exchangeTimeout(m, addr, timeout)
+	if err != nil {
+		log.Printf("反查 CDN IP %s 的 PTR 记录失败: %v", ip, err)
+		return false
+	}
+	for _, rr := range resp.Answer {
+		if ptr, ok := rr.(*dns.PTR); ok && pattern.Match(ptr.Ptr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package dns
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hao/fxdns/internal/metrics"
+	"github.com/miekg/dns"
+)
+
+func TestVerifyCDNIPOwnership(t *testing.T) {
+	const fallbackIP = "203.0.113.9"
+	// 备用上游的 PTR 数据：10.1.1.1 属于 CDN，10.2.2.2 不属于，10.3.3.3 没有 PTR 记录
+	ptrs := map[string]string{
+		"1.1.1.10.in-addr.arpa.": "edge1.cdn.example.net.",
+		"2.2.2.10.in-addr.arpa.": "host.attacker.example.org.",
+	}
+
+	testCases := []struct {
+		name     string
+		rule     string
+		expected []string
+		rejected uint64
+	}{
+		{"未开启时不校验", "", []string{"10.1.1.1", "10.2.2.2", "10.3.3.3"}, 0},
+		{"剔除 PTR 不匹配的 IP", "verify_cdnip_ownership: true\n    cdn_ownership_pattern: \"*.cdn.example.net\"", []string{"10.1.1.1"}, 2},
+		{"全部不匹配时回退", "verify_cdnip_ownership: true\n    cdn_ownership_pattern: \"re:^edge[0-9]+\\\\.other\\\\.example\\\\.net$\"", []string{fallbackIP}, 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			primary := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+				m := new(dns.Msg)
+				m.SetReply(r)
+				for _, ip := range []string{"10.1.1.1", "10.2.2.2", "10.3.3.3", "1.2.3.4"} {
+					m.Answer = append(m.Answer, answerA(r, ip).Answer...)
+				}
+				w.WriteMsg(m)
+			})
+			fallback := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+				if r.Question[0].Qtype != dns.TypePTR {
+					w.WriteMsg(answerA(r, fallbackIP))
+					return
+				}
+				m := new(dns.Msg)
+				m.SetReply(r)
+				if target, ok := ptrs[r.Question[0].Name]; ok {
+					rr, _ := dns.NewRR(fmt.Sprintf("%s 300 IN PTR %s", r.Question[0].Name, target))
+					m.Answer = append(m.Answer, rr)
+				}
+				w.WriteMsg(m)
+			})
+
+			server := newTestServer(t, `
+upstream:
+  server: "`+primary+`"
+  fallback_server: "`+fallback+`"
+  timeout: 2s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    strategy: "filter_non_cdn"
+    `+tc.rule+`
+`)
+
+			rejected := metrics.CDNOwnershipRejectCount.Value()
+			req := new(dns.Msg)
+			req.SetQuestion("www.example.com.", dns.TypeA)
+			w := &mockResponseWriter{}
+			server.ServeDNS(w, req)
+
+			if w.msg == nil {
+				t.Fatal("未收到响应")
+			}
+			var got []string
+			for _, rr := range w.msg.Answer {
+				if a, ok := rr.(*dns.A); ok {
+					got = append(got, a.A.String())
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.expected) {
+				t.Errorf("响应记录错误, 期望: %v, 实际: %v", tc.expected, got)
+			}
+			if got := metrics.CDNOwnershipRejectCount.Value() - rejected; got != tc.rejected {
+				t.Errorf("fxdns_cdn_ownership_rejected_total 期望增加 %d, 实际 %d", tc.rejected, got)
+			}
+		})
+	}
+}
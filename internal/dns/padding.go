@@ -0,0 +1,62 @@
+package dns
+
+import (
+	"github.com/hao/fxdns/internal/config"
+	"github.com/miekg/dns"
+)
+
+// dohPaddingBlockSize 返回 DoH 响应填充的块大小，未配置时使用默认值
+func dohPaddingBlockSize(cfg *config.ServerConfig) int {
+	if cfg.DoHPaddingBlockSize > 0 {
+		return cfg.DoHPaddingBlockSize
+	}
+	return config.DefaultDoHPaddingBlockSize
+}
+
+// requestsPadding 判断请求是否带有 EDNS0 Padding 选项。按 RFC 7830，只有请求带有该选项时才填充响应
+func requestsPadding(req *dns.Msg) bool {
+	opt := req.IsEdns0()
+	if opt == nil {
+		return false
+	}
+	for _, o := range opt.Option {
+		if o.Option() == dns.EDNS0PADDING {
+			return true
+		}
+	}
+	return false
+}
+
+// padResponse 返回用 EDNS0 Padding 选项 (RFC 7830) 填充后的响应副本，使打包后的长度为 blockSize 的整数倍，
+// 避免 DoH 响应的长度暴露记录数量。请求 req 没有带 Padding 选项时原样返回，因此不会向未使用 EDNS 的客户端
+// 返回 OPT 记录 (RFC 6891 §7)；请求带有 OPT 而响应没有时添加一个，原有的 Padding 选项会被替换。
+// blockSize 不大于 0 或填充后超过 DNS 消息长度上限时原样返回
+func padResponse(req, msg *dns.Msg, blockSize int) *dns.Msg {
+	if msg == nil || blockSize <= 0 || !requestsPadding(req) {
+		return msg
+	}
+
+	padded := msg.Copy()
+	opt := padded.IsEdns0()
+	if opt == nil {
+		padded.SetEdns0(dns.DefaultMsgSize, false)
+		opt = padded.IsEdns0()
+	}
+	options := opt.Option[:0]
+	for _, o := range opt.Option {
+		if o.Option() != dns.EDNS0PADDING {
+			options = append(options, o)
+		}
+	}
+	padding := &dns.EDNS0_PADDING{}
+	opt.Option = append(options, padding)
+
+	// 先以空的 Padding 选项计算长度，再补足到 blockSize 的整数倍
+	if rem := padded.Len() % blockSize; rem != 0 {
+		padding.Padding = make([]byte, blockSize-rem)
+	}
+	if padded.Len() > dns.MaxMsgSize {
+		return msg
+	}
+	return padded
+}
@@ -0,0 +1,166 @@
+package dns
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// paddedQuery 返回带 EDNS0 Padding 选项的查询
+func paddedQuery(name string) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion(name, dns.TypeA)
+	req.SetEdns0(dns.DefaultMsgSize, false)
+	opt := req.IsEdns0()
+	opt.Option = append(opt.Option, &dns.EDNS0_PADDING{Padding: make([]byte, 16)})
+	return req
+}
+
+func TestPadResponse(t *testing.T) {
+	query := paddedQuery("www.example.com.")
+	build := func(records int, edns bool) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion("www.example.com.", dns.TypeA)
+		m := new(dns.Msg)
+		m.SetReply(req)
+		for i := 0; i < records; i++ {
+			m.Answer = append(m.Answer, answerA(req, fmt.Sprintf("10.0.0.%d", i+1)).Answer[0])
+		}
+		if edns {
+			m.SetEdns0(dns.DefaultMsgSize, true)
+		}
+		return m
+	}
+
+	for _, blockSize := range []int{64, 128, 468} {
+		for _, records := range []int{0, 1, 3, 10} {
+			for _, edns := range []bool{false, true} {
+				msg := build(records, edns)
+				padded := padResponse(query, msg, blockSize)
+				out, err := padded.Pack()
+				if err != nil {
+					t.Fatalf("打包填充后的响应失败: %v", err)
+				}
+				if len(out)%blockSize != 0 {
+					t.Errorf("块大小 %d、%d 条记录、EDNS=%v: 长度 %d 不是块大小的整数倍", blockSize, records, edns, len(out))
+				}
+				if len(padded.Answer) != records || (edns && !padded.IsEdns0().Do()) {
+					t.Errorf("填充不应改变应答记录与 EDNS 标志: %v", padded)
+				}
+				if opt := msg.IsEdns0(); (opt != nil) != edns || (opt != nil && len(opt.Option) != 0) {
+					t.Errorf("填充不应修改原响应: %v", msg)
+				}
+			}
+		}
+	}
+
+	// 已有的 Padding 选项被替换而不是叠加
+	msg := padResponse(query, padResponse(query, build(2, true), 128), 64)
+	count := 0
+	for _, o := range msg.IsEdns0().Option {
+		if o.Option() == dns.EDNS0PADDING {
+			count++
+		}
+	}
+	if out, _ := msg.Pack(); count != 1 || len(out)%64 != 0 {
+		t.Errorf("重复填充应只保留一个 Padding 选项, 实际: %d 个, 长度 %d", count, len(out))
+	}
+
+	// 请求没有 EDNS 或没有带 Padding 选项时不填充，也不添加 OPT 记录
+	plain := new(dns.Msg)
+	plain.SetQuestion("www.example.com.", dns.TypeA)
+	ednsOnly := plain.Copy()
+	ednsOnly.SetEdns0(dns.DefaultMsgSize, false)
+	for _, req := range []*dns.Msg{plain, ednsOnly} {
+		msg := build(2, false)
+		if got := padResponse(req, msg, 128); got != msg || got.IsEdns0() != nil {
+			t.Errorf("请求未要求填充时应原样返回响应, 实际: %v", got)
+		}
+	}
+}
+
+func TestDoHResponsePadding(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		// 子域名的首个标签决定返回的记录数
+		var n int
+		fmt.Sscanf(r.Question[0].Name, "n%d.", &n)
+		for i := 0; i < n; i++ {
+			m.Answer = append(m.Answer, answerA(r, fmt.Sprintf("10.0.0.%d", i+1)).Answer[0])
+		}
+		w.WriteMsg(m)
+	})
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  doh_response_padding: true
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	for _, n := range []int{1, 2, 5, 12} {
+		req := paddedQuery(fmt.Sprintf("n%d.example.com.", n))
+		buf, _ := req.Pack()
+		resp, err := http.Post(ts.URL+dohPath, dohMediaType, bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("POST 请求失败: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if len(body)%128 != 0 {
+			t.Errorf("%d 条记录的响应长度 %d 不是 128 的整数倍", n, len(body))
+		}
+		msg := new(dns.Msg)
+		if err := msg.Unpack(body); err != nil || len(msg.Answer) != n {
+			t.Errorf("响应应包含 %d 条记录, 实际: %v, %v", n, msg, err)
+		}
+	}
+}
+
+func TestDoHResponsePaddingWithoutEDNS(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answerA(r, "10.0.0.1"))
+	})
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  doh_response_padding: true
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	buf, _ := req.Pack()
+	resp, err := http.Post(ts.URL+dohPath, dohMediaType, bytes.NewReader(buf))
+	if err != nil {
+		t.Fatalf("POST 请求失败: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	msg := new(dns.Msg)
+	if err := msg.Unpack(body); err != nil || len(msg.Answer) != 1 {
+		t.Fatalf("响应应包含 1 条记录, 实际: %v, %v", msg, err)
+	}
+	if msg.IsEdns0() != nil {
+		t.Error("未使用 EDNS 的查询的响应不应包含 OPT 记录")
+	}
+}
@@ -0,0 +1,57 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// PreloadEntry 预先写入缓存的一条响应
+type PreloadEntry struct {
+	QuestionName string
+	Qtype        uint16
+	Response     *dns.Msg
+	TTL          time.Duration // 缓存有效期，0 表示使用 cache_ttl
+}
+
+// Preload 将给定的响应写入全局上游的缓存视图，主要用于测试或嵌入场景下预置查询结果。
+// 任一条目无效时返回错误，此前的条目已写入缓存。
+func (c *Cache) Preload(entries []PreloadEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, entry := range entries {
+		name := strings.TrimSpace(entry.QuestionName)
+		if name == "" {
+			return fmt.Errorf("第 %d 条预加载条目的域名为空", i)
+		}
+		if entry.Response == nil {
+			return fmt.Errorf("预加载条目 %s 缺少响应", name)
+		}
+
+		req := new(dns.Msg)
+		req.SetQuestion(dns.Fqdn(name), entry.Qtype)
+
+		resp := entry.Response
+		// 响应中没有问题段时补上，使从缓存返回的响应与真实应答一致
+		if len(resp.Question) == 0 {
+			resp = resp.Copy()
+			resp.Question = req.Question
+			resp.Response = true
+		}
+
+		ttl := entry.TTL
+		if ttl <= 0 {
+			ttl = c.ttl
+		}
+		c.set(cacheKey(req, ""), resp, ttl)
+	}
+	return nil
+}
+
+// PreloadCache 将给定的响应写入服务器缓存，见 Cache.Preload
+func (s *Server) PreloadCache(entries []PreloadEntry) error {
+	return s.cache.Preload(entries)
+}
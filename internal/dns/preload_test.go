@@ -0,0 +1,70 @@
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestPreloadCache(t *testing.T) {
+	// 上游不可达，响应只能来自预加载的缓存
+	server := newTestServer(t, `
+upstream:
+  server: "127.0.0.1:1"
+  timeout: 200ms
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+
+	resp := new(dns.Msg)
+	resp.Answer = append(resp.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+		A:   net.ParseIP("10.1.1.1"),
+	})
+	err := server.PreloadCache([]PreloadEntry{
+		{QuestionName: "www.example.com", Qtype: dns.TypeA, Response: resp},
+		{QuestionName: "expired.example.com", Qtype: dns.TypeA, Response: new(dns.Msg), TTL: time.Nanosecond},
+	})
+	if err != nil {
+		t.Fatalf("预加载缓存失败: %v", err)
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	w := &mockResponseWriter{}
+	server.ServeDNS(w, req)
+	if w.msg == nil || len(w.msg.Answer) != 1 {
+		t.Fatalf("应返回预加载的响应, 实际: %v", w.msg)
+	}
+	if w.msg.Id != req.Id || len(w.msg.Question) != 1 || w.msg.Question[0].Name != "www.example.com." {
+		t.Errorf("响应 ID 或问题段错误: %v", w.msg)
+	}
+	if a, ok := w.msg.Answer[0].(*dns.A); !ok || a.A.String() != "10.1.1.1" {
+		t.Errorf("响应记录错误: %v", w.msg.Answer[0])
+	}
+
+	// 过期的预加载条目不会被使用
+	req = new(dns.Msg)
+	req.SetQuestion("expired.example.com.", dns.TypeA)
+	if cached := server.checkCache(req); cached != nil {
+		t.Errorf("过期的预加载条目不应命中: %v", cached)
+	}
+}
+
+func TestPreloadCacheInvalid(t *testing.T) {
+	cache := &Cache{entries: make(map[string]*CacheEntry), maxSize: 10, ttl: time.Minute}
+
+	if err := cache.Preload([]PreloadEntry{{QuestionName: "", Qtype: dns.TypeA, Response: new(dns.Msg)}}); err == nil {
+		t.Error("域名为空时应返回错误")
+	}
+	if err := cache.Preload([]PreloadEntry{{QuestionName: "example.com", Qtype: dns.TypeA}}); err == nil {
+		t.Error("缺少响应时应返回错误")
+	}
+}
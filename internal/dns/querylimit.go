@@ -0,0 +1,40 @@
+package dns
+
+// newQuerySlots 创建容量为 max 的并发查询信号量，max 不大于 0 时返回 nil 表示不限制
+func newQuerySlots(max int) *chan struct{} {
+	if max <= 0 {
+		return nil
+	}
+	slots := make(chan struct{}, max)
+	return &slots
+}
+
+// acquireQuerySlot 非阻塞地占用一个并发查询名额，已达 server.max_concurrent_queries 时返回 false。
+// 返回占用名额时所用的信号量，热重载替换信号量后，进行中的查询仍须归还到原信号量
+func (s *Server) acquireQuerySlot() (chan struct{}, bool) {
+	slots := s.querySlots.Load()
+	if slots == nil {
+		return nil, true
+	}
+	select {
+	case *slots <- struct{}{}:
+		return *slots, true
+	default:
+		return nil, false
+	}
+}
+
+// releaseQuerySlot 归还 acquireQuerySlot 在 slots 上占用的名额
+func releaseQuerySlot(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
+
+// queriesInFlight 返回当前信号量上已占用的名额数，未限制并发时返回 0
+func (s *Server) queriesInFlight() int {
+	if slots := s.querySlots.Load(); slots != nil {
+		return len(*slots)
+	}
+	return 0
+}
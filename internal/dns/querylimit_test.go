@@ -0,0 +1,159 @@
+package dns
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/hao/fxdns/internal/metrics"
+	"github.com/miekg/dns"
+)
+
+func TestMaxConcurrentQueries(t *testing.T) {
+	received := make(chan struct{}, 4)
+	release := make(chan struct{})
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		received <- struct{}{}
+		<-release
+		w.WriteMsg(answerA(r, "10.1.1.1"))
+	})
+
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 2s
+server:
+  listen: "127.0.0.1:0"
+  workers: 1
+  max_concurrent_queries: 2
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+
+	query := func(name string) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		w := &mockResponseWriter{}
+		server.ServeDNS(w, req)
+		return w.msg
+	}
+
+	// 第一个查询占用唯一的工作协程并阻塞在上游，第二个查询等待工作池，两者共占满 2 个名额
+	var wg sync.WaitGroup
+	results := make([]*dns.Msg, 2)
+	for i, name := range []string{"a.example.com.", "b.example.com."} {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			results[i] = query(name)
+		}(i, name)
+	}
+	<-received
+	deadline := time.Now().Add(2 * time.Second)
+	for server.queriesInFlight() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	dropped := metrics.QueriesDropped.Value()
+	start := time.Now()
+	resp := query("c.example.com.")
+	if resp == nil || resp.Rcode != dns.RcodeRefused {
+		t.Fatalf("超过并发上限的查询应返回 REFUSED, 实际: %v", resp)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("超过并发上限的查询应立即返回, 耗时: %v", elapsed)
+	}
+	if got := metrics.QueriesDropped.Value() - dropped; got != 1 {
+		t.Errorf("QueriesDropped 期望增加 1, 实际增加 %d", got)
+	}
+
+	close(release)
+	wg.Wait()
+	for i, resp := range results {
+		if resp == nil || resp.Rcode != dns.RcodeSuccess {
+			t.Errorf("上限内的查询 %d 应正常应答, 实际: %v", i, resp)
+		}
+	}
+	if n := server.queriesInFlight(); n != 0 {
+		t.Errorf("查询结束后应归还全部名额, 剩余占用: %d", n)
+	}
+	if resp := query("d.example.com."); resp == nil || resp.Rcode != dns.RcodeSuccess {
+		t.Errorf("名额归还后查询应正常应答, 实际: %v", resp)
+	}
+}
+
+func TestMaxConcurrentQueriesUnlimited(t *testing.T) {
+	server := &Server{}
+	server.querySlots.Store(newQuerySlots(0))
+	for i := 0; i < 100; i++ {
+		slots, ok := server.acquireQuerySlot()
+		if !ok {
+			t.Fatal("max_concurrent_queries 为 0 时不应限制并发")
+		}
+		releaseQuerySlot(slots)
+	}
+}
+
+func TestMaxConcurrentQueriesReload(t *testing.T) {
+	configContent := `
+upstream:
+  server: "127.0.0.1:53"
+  timeout: 2s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  max_concurrent_queries: 1
+cdn_ips:
+  - "10.0.0.0/8"
+`
+	server := newTestServer(t, configContent)
+
+	held, ok := server.acquireQuerySlot()
+	if !ok {
+		t.Fatal("上限内应能占用名额")
+	}
+	if _, ok := server.acquireQuerySlot(); ok {
+		t.Fatal("已达上限 1 时应拒绝新的查询")
+	}
+
+	// 热加载把上限调到 3 后立即生效
+	newCfg, err := config.LoadConfigFromBytes([]byte(strings.Replace(configContent, "max_concurrent_queries: 1", "max_concurrent_queries: 3", 1)))
+	if err != nil {
+		t.Fatalf("解析新配置失败: %v", err)
+	}
+	server.OnConfigChange(server.currentConfig(), newCfg)
+	var acquired []chan struct{}
+	for i := 0; i < 3; i++ {
+		slots, ok := server.acquireQuerySlot()
+		if !ok {
+			t.Fatalf("上限调整为 3 后第 %d 个查询不应被拒绝", i+1)
+		}
+		acquired = append(acquired, slots)
+	}
+	if _, ok := server.acquireQuerySlot(); ok {
+		t.Error("已达新上限 3 时应拒绝新的查询")
+	}
+
+	// 热加载前占用的名额归还到旧信号量，不影响新信号量的计数
+	releaseQuerySlot(held)
+	if n := server.queriesInFlight(); n != 3 {
+		t.Errorf("旧查询归还名额后新信号量占用应仍为 3, 实际: %d", n)
+	}
+	for _, slots := range acquired {
+		releaseQuerySlot(slots)
+	}
+
+	// 上限改为 0 后不再限制
+	newCfg, err = config.LoadConfigFromBytes([]byte(strings.Replace(configContent, "max_concurrent_queries: 1", "max_concurrent_queries: 0", 1)))
+	if err != nil {
+		t.Fatalf("解析新配置失败: %v", err)
+	}
+	server.OnConfigChange(server.currentConfig(), newCfg)
+	for i := 0; i < 10; i++ {
+		if _, ok := server.acquireQuerySlot(); !ok {
+			t.Fatal("上限改为 0 后不应限制并发")
+		}
+	}
+}
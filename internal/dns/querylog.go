@@ -0,0 +1,147 @@
+package dns
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/miekg/dns"
+)
+
+// defaultRecentQueriesLimit GET /queries/recent 未指定 n 时返回的条数
+const defaultRecentQueriesLimit = 100
+
+// QueryLogEntry 一次查询的处理记录
+type QueryLogEntry struct {
+	Time        time.Time     `json:"time"`
+	ClientIP    string        `json:"client_ip"`
+	Domain      string        `json:"domain"`
+	Qtype       string        `json:"qtype"`
+	Rcode       string        `json:"rcode"`
+	CacheHit    bool          `json:"cache_hit"`
+	Upstream    string        `json:"upstream,omitempty"` // 实际给出结果的上游，缓存命中时为空
+	CDNDetected bool          `json:"cdn_detected"`
+	Latency     time.Duration `json:"latency_ns"`
+}
+
+// RecentQueryLog 基于定长环形缓冲区的最近查询记录，写满后覆盖最旧的记录
+type RecentQueryLog struct {
+	mu      sync.Mutex
+	entries []QueryLogEntry
+	next    int // 下一条记录写入的位置
+	count   int // 当前保存的记录数
+}
+
+// NewRecentQueryLog 创建容量为 size 的查询记录，size <= 0 时使用默认容量
+func NewRecentQueryLog(size int) *RecentQueryLog {
+	if size <= 0 {
+		size = config.DefaultRecentQueriesSize
+	}
+	return &RecentQueryLog{entries: make([]QueryLogEntry, size)}
+}
+
+// Add 追加一条记录
+func (l *RecentQueryLog) Add(entry QueryLogEntry) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % len(l.entries)
+	if l.count < len(l.entries) {
+		l.count++
+	}
+}
+
+// Recent 返回最近的 n 条记录，最新的在前；n <= 0 或超过现有记录数时返回全部
+func (l *RecentQueryLog) Recent(n int) []QueryLogEntry {
+	if l == nil {
+		return []QueryLogEntry{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if n <= 0 || n > l.count {
+		n = l.count
+	}
+	result := make([]QueryLogEntry, 0, n)
+	for i := 1; i <= n; i++ {
+		result = append(result, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return result
+}
+
+// Len 返回当前保存的记录数
+func (l *RecentQueryLog) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.count
+}
+
+// Cap 返回缓冲区容量
+func (l *RecentQueryLog) Cap() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+// Resize 调整缓冲区容量，保留最近的记录。size <= 0 时使用默认容量
+func (l *RecentQueryLog) Resize(size int) {
+	if size <= 0 {
+		size = config.DefaultRecentQueriesSize
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if size == len(l.entries) {
+		return
+	}
+
+	keep := l.count
+	if keep > size {
+		keep = size
+	}
+	entries := make([]QueryLogEntry, size)
+	// 按从旧到新的顺序复制最近的 keep 条记录
+	for i := 0; i < keep; i++ {
+		entries[i] = l.entries[(l.next-keep+i+len(l.entries))%len(l.entries)]
+	}
+	l.entries = entries
+	l.count = keep
+	l.next = keep % size
+}
+
+// rcodeResponseWriter 记录写出的响应 RCODE，供查询记录使用
+type rcodeResponseWriter struct {
+	dns.ResponseWriter
+	rcode   int
+	written bool
+}
+
+// WriteMsg 记录 RCODE 后写出响应
+func (w *rcodeResponseWriter) WriteMsg(m *dns.Msg) error {
+	w.rcode = m.Rcode
+	w.written = true
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// handleRecentQueries 处理 GET /queries/recent?n=100，返回最近处理的查询，最新的在前
+func (s *Server) handleRecentQueries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	n := defaultRecentQueriesLimit
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n <= 0 {
+			http.Error(w, "invalid n: "+v, http.StatusBadRequest)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, s.queryLog.Recent(n))
+}
@@ -0,0 +1,136 @@
+package dns
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// queryLogDomains 按顺序返回记录中的域名
+func queryLogDomains(entries []QueryLogEntry) []string {
+	domains := make([]string, 0, len(entries))
+	for _, e := range entries {
+		domains = append(domains, e.Domain)
+	}
+	return domains
+}
+
+func TestRecentQueryLogWrap(t *testing.T) {
+	l := NewRecentQueryLog(3)
+	if got := l.Recent(10); len(got) != 0 {
+		t.Fatalf("空记录应返回空列表, 实际: %v", got)
+	}
+
+	for i := 1; i <= 5; i++ {
+		l.Add(QueryLogEntry{Domain: "d" + strconv.Itoa(i)})
+	}
+	if l.Len() != 3 || l.Cap() != 3 {
+		t.Fatalf("记录数量错误, Len: %d, Cap: %d", l.Len(), l.Cap())
+	}
+
+	testCases := []struct {
+		n        int
+		expected []string
+	}{
+		{0, []string{"d5", "d4", "d3"}},
+		{2, []string{"d5", "d4"}},
+		{10, []string{"d5", "d4", "d3"}},
+	}
+	for _, tc := range testCases {
+		got := queryLogDomains(l.Recent(tc.n))
+		if len(got) != len(tc.expected) {
+			t.Fatalf("Recent(%d) 数量错误, 期望: %v, 实际: %v", tc.n, tc.expected, got)
+		}
+		for i := range got {
+			if got[i] != tc.expected[i] {
+				t.Errorf("Recent(%d) 错误, 期望: %v, 实际: %v", tc.n, tc.expected, got)
+				break
+			}
+		}
+	}
+}
+
+func TestRecentQueryLogResize(t *testing.T) {
+	l := NewRecentQueryLog(4)
+	for i := 1; i <= 6; i++ {
+		l.Add(QueryLogEntry{Domain: "d" + strconv.Itoa(i)})
+	}
+
+	// 缩小时保留最近的记录
+	l.Resize(2)
+	if got := queryLogDomains(l.Recent(0)); len(got) != 2 || got[0] != "d6" || got[1] != "d5" {
+		t.Fatalf("缩小后记录错误: %v", got)
+	}
+
+	// 扩大后继续按顺序写入
+	l.Resize(3)
+	l.Add(QueryLogEntry{Domain: "d7"})
+	l.Add(QueryLogEntry{Domain: "d8"})
+	if got := queryLogDomains(l.Recent(0)); len(got) != 3 || got[0] != "d8" || got[1] != "d7" || got[2] != "d6" {
+		t.Errorf("扩大后记录错误: %v", got)
+	}
+}
+
+func TestRecentQueriesEndpoint(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answerA(r, "10.1.1.1"))
+	})
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    strategy: "filter_non_cdn"
+`)
+
+	// 第一次查询上游，第二次命中缓存
+	for i := 0; i < 2; i++ {
+		req := new(dns.Msg)
+		req.SetQuestion("www.example.com.", dns.TypeA)
+		server.ServeDNS(&mockResponseWriter{}, req)
+	}
+
+	rec := httptest.NewRecorder()
+	server.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/queries/recent?n=5", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码错误, 期望: 200, 实际: %d", rec.Code)
+	}
+	var entries []QueryLogEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("记录数量错误, 期望: 2, 实际: %d", len(entries))
+	}
+
+	hit, miss := entries[0], entries[1]
+	if !hit.CacheHit || hit.Upstream != "" {
+		t.Errorf("最新的记录应为缓存命中: %+v", hit)
+	}
+	if miss.CacheHit || miss.Upstream != upstream || !miss.CDNDetected {
+		t.Errorf("第一条记录应来自上游且检测到 CDN IP: %+v", miss)
+	}
+	for _, e := range entries {
+		if e.Domain != "www.example.com" || e.Qtype != "A" || e.Rcode != "NOERROR" || e.ClientIP != "127.0.0.1" {
+			t.Errorf("记录内容错误: %+v", e)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	server.adminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/queries/recent?n=abc", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("无效的 n 应返回 400, 实际: %d", rec.Code)
+	}
+}
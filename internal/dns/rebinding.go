@@ -0,0 +1,48 @@
+package dns
+
+import (
+	"log"
+	"net"
+
+	"github.com/hao/fxdns/internal/metrics"
+	"github.com/miekg/dns"
+)
+
+// isRebindingIP 判断地址是否属于外部域名不应解析到的内网范围：
+// RFC 1918 / RFC 4193 私有地址、链路本地地址、回环地址与未指定地址
+func isRebindingIP(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLoopback() || ip.IsUnspecified()
+}
+
+// filterRebinding 开启 server.rebinding_protection 时，对不在 internal_domains 中的域名去掉应答段里
+// 指向内网地址的 A/AAAA 记录，防止 DNS 重绑定攻击。没有需要去掉的记录时原样返回，否则返回过滤后的副本
+func (s *Server) filterRebinding(domain string, resp *dns.Msg) *dns.Msg {
+	if resp == nil || !s.config.Server.RebindingProtection {
+		return resp
+	}
+	if s.internalDomainMatcher != nil && s.internalDomainMatcher.Match(normalizeDomain(domain)) {
+		return resp
+	}
+
+	var blocked []string
+	for _, rr := range resp.Answer {
+		if ip := rrIP(rr); ip != nil && isRebindingIP(ip) {
+			blocked = append(blocked, ip.String())
+		}
+	}
+	if len(blocked) == 0 {
+		return resp
+	}
+
+	log.Printf("警告: 疑似 DNS 重绑定，已去掉 %s 应答中的内网地址 %v", domain, blocked)
+	metrics.RebindingBlockedCount.Add(uint64(len(blocked)))
+	filtered := resp.Copy()
+	answer := filtered.Answer
+	filtered.Answer = make([]dns.RR, 0, len(answer)-len(blocked))
+	for _, rr := range answer {
+		if ip := rrIP(rr); ip == nil || !isRebindingIP(ip) {
+			filtered.Answer = append(filtered.Answer, rr)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,88 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestIsRebindingIP(t *testing.T) {
+	testCases := []struct {
+		ip       string
+		expected bool
+	}{
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"127.0.0.1", true},
+		{"169.254.169.254", true},
+		{"0.0.0.0", true},
+		{"::1", true},
+		{"fe80::1", true},
+		{"fd00::1", true},
+		{"172.32.0.1", false},
+		{"203.0.113.1", false},
+		{"2001:db8::1", false},
+	}
+	for _, tc := range testCases {
+		if got := isRebindingIP(net.ParseIP(tc.ip)); got != tc.expected {
+			t.Errorf("isRebindingIP(%s) = %v, 期望 %v", tc.ip, got, tc.expected)
+		}
+	}
+}
+
+func TestRebindingProtection(t *testing.T) {
+	// 模拟重绑定攻击：外部域名的应答中混入内网地址
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := answerA(r, "203.0.113.1")
+		for _, ip := range []string{"192.168.1.10", "127.0.0.1", "169.254.169.254"} {
+			m.Answer = append(m.Answer, answerA(r, ip).Answer[0])
+		}
+		w.WriteMsg(m)
+	})
+	newServer := func(protection string) *Server {
+		return newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 500ms
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  rebinding_protection: `+protection+`
+  internal_domains:
+    - "*.corp.example.com"
+cdn_ips:
+  - "198.51.100.0/24"
+`)
+	}
+	query := func(server *Server, name string) []string {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		w := &mockResponseWriter{}
+		server.ServeDNS(w, req)
+		if w.msg == nil {
+			t.Fatalf("%s 未收到响应", name)
+		}
+		var ips []string
+		for _, rr := range w.msg.Answer {
+			ips = append(ips, rr.(*dns.A).A.String())
+		}
+		return ips
+	}
+
+	server := newServer("true")
+	for i := 0; i < 2; i++ { // 第二次查询命中缓存
+		if ips := query(server, "evil.example.net."); len(ips) != 1 || ips[0] != "203.0.113.1" {
+			t.Errorf("第 %d 次查询应只保留公网地址, 实际: %v", i+1, ips)
+		}
+	}
+	if ips := query(server, "intranet.corp.example.com."); len(ips) != 4 {
+		t.Errorf("internal_domains 中的域名不应过滤内网地址, 实际: %v", ips)
+	}
+
+	if ips := query(newServer("false"), "evil.example.net."); len(ips) != 4 {
+		t.Errorf("未开启 rebinding_protection 时不应过滤, 实际: %v", ips)
+	}
+}
@@ -0,0 +1,92 @@
+package dns
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ForceRefresh 删除 (domain, qtype) 在所有缓存视图中的条目，并立即以完整查询流程重新解析，
+// 新的响应照常写入全局上游的缓存视图；其他视图的条目在下次查询时重新解析。
+// 上游查询失败 (SERVFAIL) 时返回错误，原有条目仍已被删除
+func (s *Server) ForceRefresh(domain string, qtype uint16) error {
+	domain = strings.TrimSpace(domain)
+	if domain == "" {
+		return fmt.Errorf("缺少域名")
+	}
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn(domain), qtype)
+	question := cacheKey(req, "")
+
+	s.cache.mu.Lock()
+	removed := 0
+	for key := range s.cache.entries {
+		// 非全局视图的键为 <上游>|<问题>
+		if key == question || strings.HasSuffix(key, "|"+question) {
+			if s.cache.delete(key) {
+				removed++
+			}
+		}
+	}
+	s.cache.mu.Unlock()
+	log.Printf("强制刷新 %s %s，已删除 %d 个缓存条目", req.Question[0].Name, dns.TypeToString[qtype], removed)
+
+	resp, err := s.TestQuery(domain, qtype)
+	if err != nil {
+		return err
+	}
+	if resp.Rcode == dns.RcodeServerFailure {
+		return fmt.Errorf("重新解析 %s 失败: 上游返回 %s", req.Question[0].Name, dns.RcodeToString[resp.Rcode])
+	}
+	return nil
+}
+
+// CacheRefreshResult /cache/refresh 的响应：重新解析后缓存中的结果
+type CacheRefreshResult struct {
+	Domain string   `json:"domain"`
+	Type   string   `json:"type"`
+	Rcode  string   `json:"rcode"`
+	Answer []string `json:"answer"`
+}
+
+// handleCacheRefresh 处理 POST /cache/refresh?domain=example.com&type=A，type 默认为 A。
+// 重新解析失败时返回 502
+func (s *Server) handleCacheRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	domain := strings.TrimSpace(r.URL.Query().Get("domain"))
+	if domain == "" {
+		http.Error(w, "missing domain parameter", http.StatusBadRequest)
+		return
+	}
+	qtype := dns.TypeA
+	if t := r.URL.Query().Get("type"); t != "" {
+		var ok bool
+		if qtype, ok = dns.StringToType[strings.ToUpper(t)]; !ok {
+			http.Error(w, "unknown query type: "+t, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := s.ForceRefresh(domain, qtype); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn(domain), qtype)
+	result := CacheRefreshResult{Domain: req.Question[0].Name, Type: dns.TypeToString[qtype], Answer: []string{}}
+	if resp := s.checkCache(req); resp != nil {
+		result.Rcode = dns.RcodeToString[resp.Rcode]
+		for _, rr := range resp.Answer {
+			result.Answer = append(result.Answer, rr.String())
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
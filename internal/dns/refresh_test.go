@@ -0,0 +1,108 @@
+package dns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestForceRefresh(t *testing.T) {
+	// 每次查询返回不同的地址，servfail 为 true 时返回 SERVFAIL
+	var queries atomic.Int32
+	var servfail atomic.Bool
+	upstreamAddr := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		if servfail.Load() {
+			resp := new(dns.Msg)
+			resp.SetRcode(r, dns.RcodeServerFailure)
+			w.WriteMsg(resp)
+			return
+		}
+		n := queries.Add(1)
+		w.WriteMsg(answerA(r, fmt.Sprintf("198.51.100.%d", n)))
+	})
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstreamAddr+`"
+  timeout: 2s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	cachedIP := func() string {
+		resp := server.checkCache(req)
+		if resp == nil || len(resp.Answer) != 1 {
+			t.Fatalf("缓存中应有 1 条记录, 实际: %v", resp)
+		}
+		return resp.Answer[0].(*dns.A).A.String()
+	}
+
+	if _, err := server.TestQuery("www.example.com", dns.TypeA); err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if ip := cachedIP(); ip != "198.51.100.1" {
+		t.Fatalf("缓存的地址期望 198.51.100.1, 实际 %s", ip)
+	}
+
+	if err := server.ForceRefresh("www.example.com", dns.TypeA); err != nil {
+		t.Fatalf("强制刷新失败: %v", err)
+	}
+	if ip := cachedIP(); ip != "198.51.100.2" {
+		t.Errorf("强制刷新后缓存的地址期望 198.51.100.2, 实际 %s", ip)
+	}
+	if queries.Load() != 2 {
+		t.Errorf("强制刷新应查询一次上游, 实际共查询 %d 次", queries.Load())
+	}
+
+	// 通过管理接口刷新
+	handler := server.adminHandler()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/cache/refresh?domain=www.example.com&type=a", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /cache/refresh 期望 200, 实际 %d: %s", rec.Code, rec.Body.String())
+	}
+	var result CacheRefreshResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if result.Type != "A" || result.Rcode != "NOERROR" || len(result.Answer) != 1 {
+		t.Errorf("刷新结果不符: %+v", result)
+	}
+	if ip := cachedIP(); ip != "198.51.100.3" {
+		t.Errorf("管理接口刷新后缓存的地址期望 198.51.100.3, 实际 %s", ip)
+	}
+
+	for _, tc := range []struct {
+		method, url string
+		code        int
+	}{
+		{http.MethodGet, "/cache/refresh?domain=www.example.com", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/cache/refresh", http.StatusBadRequest},
+		{http.MethodPost, "/cache/refresh?domain=www.example.com&type=BOGUS", http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.url, nil))
+		if rec.Code != tc.code {
+			t.Errorf("%s %s 期望 %d, 实际 %d", tc.method, tc.url, tc.code, rec.Code)
+		}
+	}
+
+	// 上游失败时返回错误，旧条目已被删除
+	servfail.Store(true)
+	if err := server.ForceRefresh("www.example.com", dns.TypeA); err == nil {
+		t.Error("上游返回 SERVFAIL 时应返回错误")
+	}
+	if resp := server.checkCache(req); resp != nil && len(resp.Answer) > 0 {
+		t.Errorf("刷新失败后不应保留旧的缓存条目: %v", resp.Answer)
+	}
+}
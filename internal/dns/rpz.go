@@ -0,0 +1,254 @@
+package dns
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/hao/fxdns/internal/metrics"
+	"github.com/miekg/dns"
+)
+
+// rpzAction RPZ 规则的处理动作
+type rpzAction int
+
+const (
+	rpzNXDomain  rpzAction = iota // CNAME .：返回 NXDOMAIN
+	rpzNoData                     // CNAME *.：返回空的 NOERROR 响应
+	rpzPassthru                   // CNAME rpz-passthru.：按普通查询处理，不再检查后续区域
+	rpzDrop                       // CNAME rpz-drop.：不返回任何响应
+	rpzLocalData                  // 其他记录：以规则中的记录应答
+)
+
+// String 返回动作名称
+func (a rpzAction) String() string {
+	switch a {
+	case rpzNXDomain:
+		return "NXDOMAIN"
+	case rpzNoData:
+		return "NODATA"
+	case rpzPassthru:
+		return "PASSTHRU"
+	case rpzDrop:
+		return "DROP"
+	case rpzLocalData:
+		return "LOCAL-DATA"
+	}
+	return "UNKNOWN"
+}
+
+// rpzRule 一条 QNAME 触发规则
+type rpzRule struct {
+	action rpzAction
+	// records rpzLocalData 动作应答的记录，所有者名在应答时替换为查询名
+	records []dns.RR
+}
+
+// rpzZone 一个 RPZ 区域，规则按触发域名（相对区域名，通配符规则以 *. 开头）索引
+type rpzZone struct {
+	name  string
+	rules map[string]*rpzRule
+}
+
+// rpzPolicy 按 server.rpz_zones 顺序排列的 RPZ 区域，先命中的区域生效
+type rpzPolicy struct {
+	zones []*rpzZone
+}
+
+// rpzTriggerSuffixes 非 QNAME 触发器（响应 IP、客户端 IP、NS 名称与 NS IP），当前不支持，解析时跳过
+var rpzTriggerSuffixes = []string{".rpz-ip", ".rpz-client-ip", ".rpz-nsdname", ".rpz-nsip"}
+
+// loadRPZ 从 path 读取主文件格式 (RFC 1035) 的 RPZ 数据，只保留属于 zones 中区域的规则
+func loadRPZ(path string, zones []string) (*rpzPolicy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	policy, err := parseRPZ(f, path, zones)
+	if err != nil {
+		return nil, fmt.Errorf("解析 RPZ 文件 %s 失败: %w", path, err)
+	}
+	return policy, nil
+}
+
+// parseRPZ 解析 RPZ 数据。记录的所有者名必须位于某个区域之下，去掉区域名后即为触发域名；
+// 区域顶点的 SOA/NS 记录、其他区域的记录与不支持的触发器被忽略。
+// CNAME 记录的目标为 .、*.、rpz-passthru.、rpz-drop. 时表示对应动作，其余记录作为本地应答数据
+func parseRPZ(r io.Reader, file string, zones []string) (*rpzPolicy, error) {
+	policy := &rpzPolicy{}
+	for _, name := range zones {
+		policy.zones = append(policy.zones, &rpzZone{name: normalizeDomain(name), rules: make(map[string]*rpzRule)})
+	}
+
+	zp := dns.NewZoneParser(r, "", file)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		owner := normalizeDomain(rr.Header().Name)
+		zone, trigger := policy.zoneFor(owner)
+		if zone == nil || trigger == "" || unsupportedRPZTrigger(trigger) {
+			continue
+		}
+
+		rule := zone.rules[trigger]
+		if cname, ok := rr.(*dns.CNAME); ok {
+			if action, ok := rpzCNAMEAction(cname.Target); ok {
+				zone.rules[trigger] = &rpzRule{action: action}
+				continue
+			}
+			// rpz-tcp-only. 等其他特殊目标不支持
+			if strings.HasPrefix(strings.ToLower(cname.Target), "rpz-") {
+				log.Printf("忽略不支持的 RPZ 动作 %s: %s", cname.Target, owner)
+				continue
+			}
+		}
+		if rule == nil || rule.action != rpzLocalData {
+			rule = &rpzRule{action: rpzLocalData}
+			zone.rules[trigger] = rule
+		}
+		rule.records = append(rule.records, rr)
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// zoneFor 返回 owner 所属的区域及去掉区域名后的触发域名，owner 为区域顶点时触发域名为空
+func (p *rpzPolicy) zoneFor(owner string) (*rpzZone, string) {
+	for _, zone := range p.zones {
+		if owner == zone.name {
+			return zone, ""
+		}
+		if trigger, ok := strings.CutSuffix(owner, "."+zone.name); ok {
+			return zone, trigger
+		}
+	}
+	return nil, ""
+}
+
+// unsupportedRPZTrigger 判断触发域名是否为 QNAME 以外的触发器
+func unsupportedRPZTrigger(trigger string) bool {
+	for _, suffix := range rpzTriggerSuffixes {
+		if strings.HasSuffix(trigger, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// rpzCNAMEAction 将表示动作的 CNAME 目标转换为动作，其他目标返回 false
+func rpzCNAMEAction(target string) (rpzAction, bool) {
+	switch strings.ToLower(target) {
+	case ".":
+		return rpzNXDomain, true
+	case "*.":
+		return rpzNoData, true
+	case "rpz-passthru.":
+		return rpzPassthru, true
+	case "rpz-drop.":
+		return rpzDrop, true
+	}
+	return 0, false
+}
+
+// Lookup 按区域顺序查找命中 qname 的规则：每个区域内精确规则优先，其次是最长的通配符规则。
+// *.example.com 只匹配子域名，不匹配 example.com 本身
+func (p *rpzPolicy) Lookup(qname string) (string, *rpzRule) {
+	if p == nil {
+		return "", nil
+	}
+	qname = normalizeDomain(qname)
+	for _, zone := range p.zones {
+		if rule, ok := zone.rules[qname]; ok {
+			return zone.name, rule
+		}
+		for name := qname; ; {
+			i := strings.IndexByte(name, '.')
+			if i < 0 {
+				break
+			}
+			name = name[i+1:]
+			if rule, ok := zone.rules["*."+name]; ok {
+				return zone.name, rule
+			}
+		}
+	}
+	return "", nil
+}
+
+// Count 返回所有区域的规则总数
+func (p *rpzPolicy) Count() int {
+	n := 0
+	for _, zone := range p.zones {
+		n += len(zone.rules)
+	}
+	return n
+}
+
+// loadRPZConfig 按配置加载 RPZ 数据，未配置 rpz_zones 时返回 nil
+func loadRPZConfig(cfg *config.ServerConfig) (*rpzPolicy, error) {
+	if len(cfg.RPZZones) == 0 {
+		return nil, nil
+	}
+	policy, err := loadRPZ(cfg.RPZFile, cfg.RPZZones)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("已加载 RPZ 区域 %v，共 %d 条规则", cfg.RPZZones, policy.Count())
+	return policy, nil
+}
+
+// rpzLocalTTL 未在规则记录中指定 TTL 时本地应答使用的 TTL
+const rpzLocalTTL = 300
+
+// rpzResponse 按 server.rpz_zones 检查查询名，命中时返回构造的响应；
+// drop 为 true 时调用方不应返回任何响应。未命中或命中 PASSTHRU 时返回 nil, false，按普通查询处理
+func (s *Server) rpzResponse(r *dns.Msg) (resp *dns.Msg, drop bool) {
+	if len(r.Question) == 0 {
+		return nil, false
+	}
+	q := r.Question[0]
+	zone, rule := s.rpz.Load().Lookup(q.Name)
+	if rule == nil {
+		return nil, false
+	}
+	log.Printf("RPZ 区域 %s 命中 %s: %s", zone, q.Name, rule.action)
+	metrics.RPZHitCount.Inc()
+
+	resp = new(dns.Msg)
+	resp.SetReply(r)
+	switch rule.action {
+	case rpzPassthru:
+		return nil, false
+	case rpzDrop:
+		return nil, true
+	case rpzNXDomain:
+		resp.Rcode = dns.RcodeNameError
+	case rpzLocalData:
+		resp.Answer = rpzLocalAnswer(rule.records, q)
+	}
+	return resp, false
+}
+
+// rpzLocalAnswer 从规则记录中选出与查询类型相符的记录（CNAME 对任何类型都适用），所有者名改为查询名；
+// 没有相符的记录时返回 nil，即 NODATA
+func rpzLocalAnswer(records []dns.RR, q dns.Question) []dns.RR {
+	var answer []dns.RR
+	for _, rr := range records {
+		rrtype := rr.Header().Rrtype
+		if rrtype != q.Qtype && rrtype != dns.TypeCNAME && q.Qtype != dns.TypeANY {
+			continue
+		}
+		rr = dns.Copy(rr)
+		rr.Header().Name = q.Name
+		if rr.Header().Ttl == 0 {
+			rr.Header().Ttl = rpzLocalTTL
+		}
+		answer = append(answer, rr)
+	}
+	return answer
+}
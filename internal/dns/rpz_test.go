@@ -0,0 +1,136 @@
+package dns
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+const testRPZ = `$TTL 60
+$ORIGIN rpz.local.
+@                   SOA localhost. root.localhost. 1 3600 600 86400 60
+@                   NS  localhost.
+bad.com             CNAME .
+*.bad.com           CNAME .
+empty.com           CNAME *.
+ok.bad.com          CNAME rpz-passthru.
+drop.com            CNAME rpz-drop.
+walled.com          A     10.0.0.1
+walled.com          AAAA  2001:db8::1
+garden.com          CNAME walled.example.net.
+32.1.0.0.127.rpz-ip CNAME .
+$ORIGIN rpz.second.
+bad.com             A     192.0.2.1
+other.com           CNAME .
+$ORIGIN rpz.unused.
+unused.com          CNAME .
+`
+
+func TestRPZLookup(t *testing.T) {
+	policy, err := parseRPZ(strings.NewReader(testRPZ), "test.rpz", []string{"rpz.local", "rpz.second"})
+	if err != nil {
+		t.Fatalf("解析 RPZ 失败: %v", err)
+	}
+
+	tests := []struct {
+		qname  string
+		zone   string
+		action rpzAction
+		found  bool
+	}{
+		{"bad.com.", "rpz.local", rpzNXDomain, true},
+		{"www.bad.com.", "rpz.local", rpzNXDomain, true},
+		{"ok.bad.com.", "rpz.local", rpzPassthru, true},
+		{"empty.com.", "rpz.local", rpzNoData, true},
+		{"sub.empty.com.", "", 0, false},
+		{"drop.com.", "rpz.local", rpzDrop, true},
+		{"walled.com.", "rpz.local", rpzLocalData, true},
+		{"other.com.", "rpz.second", rpzNXDomain, true},
+		{"unused.com.", "", 0, false},
+		{"127.0.0.1.", "", 0, false},
+		{"example.com.", "", 0, false},
+	}
+	for _, tt := range tests {
+		zone, rule := policy.Lookup(tt.qname)
+		if (rule != nil) != tt.found {
+			t.Errorf("%s 命中结果错误, 期望: %v, 实际: %v", tt.qname, tt.found, rule != nil)
+			continue
+		}
+		if rule != nil && (zone != tt.zone || rule.action != tt.action) {
+			t.Errorf("%s 命中规则错误, 期望: %s %s, 实际: %s %s", tt.qname, tt.zone, tt.action, zone, rule.action)
+		}
+	}
+}
+
+func TestRPZLocalAnswer(t *testing.T) {
+	policy, err := parseRPZ(strings.NewReader(testRPZ), "test.rpz", []string{"rpz.local"})
+	if err != nil {
+		t.Fatalf("解析 RPZ 失败: %v", err)
+	}
+	_, rule := policy.Lookup("walled.com.")
+
+	answer := rpzLocalAnswer(rule.records, dns.Question{Name: "walled.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET})
+	if len(answer) != 1 || answer[0].(*dns.A).A.String() != "10.0.0.1" || answer[0].Header().Name != "walled.com." {
+		t.Errorf("A 查询的本地应答错误: %v", answer)
+	}
+	if answer := rpzLocalAnswer(rule.records, dns.Question{Name: "walled.com.", Qtype: dns.TypeMX, Qclass: dns.ClassINET}); len(answer) != 0 {
+		t.Errorf("没有相符的记录时应返回 NODATA, 实际: %v", answer)
+	}
+
+	_, rule = policy.Lookup("garden.com.")
+	answer = rpzLocalAnswer(rule.records, dns.Question{Name: "garden.com.", Qtype: dns.TypeAAAA, Qclass: dns.ClassINET})
+	if len(answer) != 1 || answer[0].(*dns.CNAME).Target != "walled.example.net." {
+		t.Errorf("CNAME 本地数据应对任何查询类型生效: %v", answer)
+	}
+}
+
+func TestServerRPZ(t *testing.T) {
+	primary := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answerA(r, "198.51.100.1"))
+	})
+	rpzFile := filepath.Join(t.TempDir(), "rpz.zone")
+	if err := os.WriteFile(rpzFile, []byte(testRPZ), 0644); err != nil {
+		t.Fatalf("创建 RPZ 文件失败: %v", err)
+	}
+	server := newTestServer(t, `
+upstream:
+  server: "`+primary+`"
+  timeout: 2s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  rpz_zones: ["rpz.local"]
+  rpz_file: "`+rpzFile+`"
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion(name, qtype)
+		w := &mockResponseWriter{}
+		server.ServeDNS(w, req)
+		return w.msg
+	}
+
+	if resp := query("www.bad.com.", dns.TypeA); resp == nil || resp.Rcode != dns.RcodeNameError {
+		t.Errorf("命中 CNAME . 规则应返回 NXDOMAIN, 实际: %v", resp)
+	}
+	if resp := query("empty.com.", dns.TypeA); resp == nil || resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 0 {
+		t.Errorf("命中 CNAME *. 规则应返回 NODATA, 实际: %v", resp)
+	}
+	if resp := query("drop.com.", dns.TypeA); resp != nil {
+		t.Errorf("命中 rpz-drop 规则不应返回响应, 实际: %v", resp)
+	}
+	if resp := query("walled.com.", dns.TypeAAAA); resp == nil || len(resp.Answer) != 1 || resp.Answer[0].(*dns.AAAA).AAAA.String() != "2001:db8::1" {
+		t.Errorf("命中本地数据规则应返回规则中的记录, 实际: %v", resp)
+	}
+	for _, name := range []string{"ok.bad.com.", "example.com."} {
+		if resp := query(name, dns.TypeA); resp == nil || len(resp.Answer) != 1 || resp.Answer[0].(*dns.A).A.String() != "198.51.100.1" {
+			t.Errorf("%s 应转发到上游, 实际: %v", name, resp)
+		}
+	}
+}
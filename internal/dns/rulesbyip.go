@@ -0,0 +1,44 @@
+package dns
+
+import (
+	"net"
+
+	"github.com/hao/fxdns/internal/config"
+)
+
+// RulesByIPResult 表示 GET /rules/by-ip 的返回结果
+type RulesByIPResult struct {
+	IP string `json:"ip"`
+	// CDN 该 IP 是否会被识别为 CDN IP；CIDR 为其所在的 cdn_ips 网段
+	CDN   bool                `json:"cdn"`
+	CIDR  string              `json:"cidr,omitempty"`
+	Rules []config.DomainRule `json:"rules"`
+}
+
+// RulesMatchingIP 返回当解析结果中出现该 IP 时会影响处理结果的域名规则：IP 落在某个 CDN 网段内时，
+// 策略为 filter_non_cdn 或 return_cdn_a 的规则会因它被识别为 CDN IP 而过滤或改写应答
+// （无论 IP 出现在请求域名本身还是其 CNAME 链的 A 记录中）。IP 不属于任何 CDN 网段时返回 nil。
+// 策略为 none 的域名只按默认方式过滤，不视为受规则控制
+func (s *Server) RulesMatchingIP(ip net.IP) []config.DomainRule {
+	if _, ok := s.cidrMatcher.Lookup(ip); !ok {
+		return nil
+	}
+
+	var rules []config.DomainRule
+	for _, rule := range s.currentConfig().Domains {
+		if rule.Strategy == config.StrategyFilterNonCDN || rule.Strategy == config.StrategyReturnCDNA {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// explainIP 汇总 IP 所在的 CDN 网段及受其影响的域名规则
+func (s *Server) explainIP(ip net.IP) RulesByIPResult {
+	result := RulesByIPResult{IP: ip.String(), Rules: []config.DomainRule{}}
+	result.CIDR, result.CDN = s.cidrMatcher.Lookup(ip)
+	if rules := s.RulesMatchingIP(ip); rules != nil {
+		result.Rules = rules
+	}
+	return result
+}
@@ -1,16 +1,27 @@
 package dns
 
 import (
-	// "errors" // 移除未使用的 errors 包
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"math"
+	"math/rand"
 	"net"
+	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hao/fxdns/internal/config"
+	"github.com/hao/fxdns/internal/config/source"
+	"github.com/hao/fxdns/internal/metrics"
+	"github.com/hao/fxdns/internal/upstream"
 	"github.com/hao/fxdns/internal/util"
 	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 // 备用上游从配置读取，不再使用硬编码常量
@@ -24,31 +35,105 @@ type Server struct {
 	config        *config.Config
 	cache         *Cache
 	workerPool    chan struct{}
+	querySlots    atomic.Pointer[chan struct{}] // 限制同时处理的查询数 (server.max_concurrent_queries)，为 nil 时不限制
 	cidrMatcher   *util.CIDRMatcher
 	domainMatcher *util.DomainMatcher
 	configManager *config.ConfigManager
 	mu            sync.RWMutex // 添加互斥锁
 	shutdownChan  chan struct{} // 用于通知 ListenAndServe 协程停止
+	adminServer   *http.Server  // 管理 HTTP 服务，未配置时为 nil
+	doqListener   *quic.Listener // DoQ 监听，仅 server.network 为 doq 时使用
+	dotServer     *dns.Server    // DoT 服务，未配置 server.dot_listen 时为 nil
+	tcpServer     *dns.Server    // 独立的 TCP 服务，仅 server.listen_tcp 与 listen 不同时使用
+	dohServer     *http.Server   // DoH 服务，未配置 server.doh_listen 时为 nil
+	draining      []*drainingListener // listen 变更后仍在宽限期内的旧监听
+	dotConns      atomic.Int64   // 当前活跃的 DoT 连接数
+	clientRegistry sync.Map      // TCP 客户端连接的状态，键为远端地址，值为 *tcpClient
+
+	resolverMu   sync.Mutex                   // 保护 dohResolvers
+	dohResolvers map[string]upstream.Resolver // 按地址复用的 DoH (及 TSIG 签名 DNS) 解析器
+
+	breakerMu sync.Mutex                          // 保护 breakers
+	breakers  map[string]*upstream.CircuitBreaker // 按主上游地址的熔断器，未启用 circuit_breaker 时为空
+
+	// upstreamRTT load_balance 为 latency 时各主上游 RTT 的 EWMA，热加载时保留
+	upstreamRTT *latencyTracker
+	// cdnRTT cdn_response_order 为 latency_sorted 时服务器到各 CDN IP 的历史 RTT
+	cdnRTT *cdnLatencyTable
+
+	// rpz 按 server.rpz_zones 从 server.rpz_file 加载的 RPZ 规则，未配置时为 nil
+	rpz atomic.Pointer[rpzPolicy]
+
+	// rng 计算缓存有效期的随机调整量 (server.ttl_jitter_factor)，rand.Rand 不是并发安全的，仅在持有 cache.mu 的写锁时使用
+	rng *rand.Rand
+
+	// splitHorizon 按客户端子网选择主上游的路由表，按前缀长度从长到短排序
+	splitHorizon []splitHorizonRoute
+
+	// negativeCacheMatcher 匹配 server.response_cache_negative_domains，命中的 NXDOMAIN 响应按 negative_ttl 缓存
+	negativeCacheMatcher *util.DomainMatcher
+
+	// dnsblMatcher 匹配 server.dnsbl_zones，命中的 <反向 IP>.<区域> 查询在本地应答
+	dnsblMatcher *util.DomainMatcher
+
+	// internalDomainMatcher 匹配 server.internal_domains，命中的域名不做防 DNS 重绑定过滤
+	internalDomainMatcher *util.DomainMatcher
+
+	// tracerProvider 配置了 observability.otel_endpoint 时的查询追踪，未启用时为 nil
+	tracerProvider atomic.Pointer[sdktrace.TracerProvider]
+
+	// statsd 配置了 metrics.statsd_address 时发送 StatsD 指标的客户端，未启用时为 nil
+	statsd atomic.Pointer[metrics.StatsDClient]
+
+	// queryLog 最近处理的查询记录，容量由 server.recent_queries_size 控制
+	queryLog *RecentQueryLog
+
+	readyMu    sync.Mutex    // 保护以下监听状态字段
+	ready      chan struct{} // 监听就绪或启动失败时关闭
+	readyErr   error         // 启动失败时的错误
+	listenAddr string        // 实际绑定的监听地址
+	startedAt  time.Time     // 最近一次启动 DNS 监听的时间，每次重启时重置
+	warmed     chan struct{} // 缓存预热完成时关闭，未配置预热时为 nil
 }
 
 // Cache 表示 DNS 缓存
 type Cache struct {
-	entries map[string]*CacheEntry
-	mu      sync.RWMutex
-	maxSize int
-	ttl     time.Duration
+	entries     map[string]*CacheEntry
+	mu          sync.RWMutex
+	maxSize     int
+	ttl         time.Duration
+	negativeTTL time.Duration // 匹配 negativeCacheMatcher 的 NXDOMAIN 响应使用的有效期
+	staleTTL    time.Duration // 过期响应的保留时长，未开启 stale_while_revalidate 时为 0
+	jitter      float64       // 有效期随机调整的比例 (server.ttl_jitter_factor)
+
+	// policy 缓存已满时选择被淘汰条目的策略 (cache.eviction_policy)，为 nil 时淘汰任意一个条目。
+	// 缓存命中时只持有 mu 的读锁，因此 policy 另由 policyMu 保护
+	policy     CacheEvictionPolicy
+	policyName string
+	policyMu   sync.Mutex
 }
 
 // CacheEntry 表示缓存条目
 type CacheEntry struct {
-	msg      *dns.Msg
-	expireAt time.Time
+	msg *dns.Msg
+	// upstream 主上游的原始响应 (CDN 检测与过滤之前)，供 ExplainQuery 分析；主上游查询失败时为 nil
+	upstream *dns.Msg
+	// softExpireAt 之后条目视为过期，开启 stale_while_revalidate 时在 hardExpireAt 之前仍可返回并在后台刷新；
+	// 未开启时两者相同
+	softExpireAt time.Time
+	hardExpireAt time.Time
+	refreshing   atomic.Bool // 是否正在后台刷新
 }
 
-// NewServer 创建一个新的 DNS 代理服务器
+// NewServer 创建一个从本地配置文件加载配置的 DNS 代理服务器
 func NewServer(configPath string) (*Server, error) {
+	return NewServerFromSource(source.NewFileSource(configPath))
+}
+
+// NewServerFromSource 创建一个从 src（本地文件、Consul KV 或 etcd）加载配置的 DNS 代理服务器
+func NewServerFromSource(src source.ConfigSource) (*Server, error) {
 	// 创建配置管理器
-	configManager := config.NewConfigManager(configPath)
+	configManager := config.NewConfigManagerFromSource(src)
 	if err := configManager.LoadConfig(); err != nil {
 		return nil, err
 	}
@@ -57,9 +142,14 @@ func NewServer(configPath string) (*Server, error) {
 	
 	// 创建缓存
 	cache := &Cache{
-		entries: make(map[string]*CacheEntry),
-		maxSize: cfg.Server.CacheSize,
-		ttl:     cfg.Server.CacheTTL,
+		entries:     make(map[string]*CacheEntry),
+		maxSize:     cfg.Server.CacheSize,
+		ttl:         cfg.Server.CacheTTL,
+		negativeTTL: cfg.Server.NegativeTTL,
+		staleTTL:    staleTTL(&cfg.Server),
+		jitter:      cfg.Server.TTLJitterFactor,
+		policy:      newEvictionPolicy(cfg.Cache.EvictionPolicy),
+		policyName:  cfg.Cache.EvictionPolicy,
 	}
 
 	// 创建工作池
@@ -80,12 +170,26 @@ func NewServer(configPath string) (*Server, error) {
 		domainMatcher.AddPattern(rule.Pattern)
 	}
 
+	// 创建需要缓存 NXDOMAIN 的域名匹配器
+	negativeCacheMatcher := util.NewDomainMatcher()
+	for _, pattern := range cfg.Server.ResponseCacheNegativeDomains {
+		negativeCacheMatcher.AddPattern(pattern)
+	}
+
+	// 创建 DNSBL 区域匹配器
+	dnsblMatcher := util.NewDomainMatcher()
+	dnsblMatcher.SetPatterns(cfg.Server.DNSBLZones)
+
+	// 创建防 DNS 重绑定的内部域名匹配器
+	internalDomainMatcher := util.NewDomainMatcher()
+	internalDomainMatcher.SetPatterns(cfg.Server.InternalDomains)
+
 	server := &Server{
 		client: &dns.Client{
 			Net:     "udp",
 			Timeout: cfg.Upstream.Timeout,
 		},
-		upstream:      cfg.Upstream.Server,
+		upstream:      cfg.Upstream.PrimaryServer(),
 		timeout:       cfg.Upstream.Timeout,
 		config:        cfg,
 		cache:         cache,
@@ -93,12 +197,36 @@ func NewServer(configPath string) (*Server, error) {
 		cidrMatcher:   cidrMatcher,
 		domainMatcher: domainMatcher,
 		configManager: configManager,
+
+		splitHorizon:          buildSplitHorizon(cfg.SplitHorizon.Subnets),
+		negativeCacheMatcher:  negativeCacheMatcher,
+		dnsblMatcher:          dnsblMatcher,
+		internalDomainMatcher: internalDomainMatcher,
+		queryLog:              NewRecentQueryLog(cfg.Server.RecentQueriesSize),
+		rng:                   rand.New(rand.NewSource(time.Now().UnixNano())),
+		upstreamRTT:           newLatencyTracker(),
+		cdnRTT:                newCDNLatencyTable(),
 	}
+	server.upstreamRTT.setCandidates(latencyCandidates(&cfg.Upstream))
+	server.querySlots.Store(newQuerySlots(cfg.Server.MaxConcurrentQueries))
+
+	if err := server.configureTracing(cfg.Observability.OTelEndpoint); err != nil {
+		return nil, err
+	}
+	if err := server.configureStatsD(cfg.Metrics.StatsDAddress); err != nil {
+		return nil, err
+	}
+	rpz, err := loadRPZConfig(&cfg.Server)
+	if err != nil {
+		return nil, err
+	}
+	server.rpz.Store(rpz)
 
 	// 注册配置变更监听器
 	configManager.AddListener(server)
 
 	server.shutdownChan = make(chan struct{}) // 初始化 shutdownChan
+	server.ready = make(chan struct{})
 	return server, nil
 }
 
@@ -113,8 +241,32 @@ func (s *Server) Start() error {
 		return err
 	}
 
+	// 启动管理 HTTP 服务（如已配置）
+	if err := s.startAdminServer(); err != nil {
+		log.Printf("DNS Server: 启动管理服务失败: %v", err)
+		return err
+	}
+
+	// 启动 DoT 服务（如已配置）
+	if err := s.startDoTServer(); err != nil {
+		log.Printf("DNS Server: 启动 DoT 服务失败: %v", err)
+		return err
+	}
+
+	// 启动 DoH 服务（如已配置）
+	if err := s.startDoHServer(); err != nil {
+		log.Printf("DNS Server: 启动 DoH 服务失败: %v", err)
+		return err
+	}
+
 	// 初始化并启动 miekg/dns 服务器
-	return s.startDNSServerProcess()
+	if err := s.startDNSServerProcess(); err != nil {
+		return err
+	}
+
+	// 启动缓存预热（如已配置）
+	s.startCacheWarm()
+	return nil
 }
 
 // startDNSServerProcess 负责实际创建和启动 miekg/dns 服务器实例。
@@ -132,32 +284,87 @@ func (s *Server) startDNSServerProcess() error {
 		s.server = nil
 	}
 
-	// TODO: 未来可以从 cfg.Server.Network 读取网络类型，如果该字段被添加
-	// 目前 config.ServerConfig 中没有 Network 字段，所以默认使用 "udp"
-	network := "udp" 
+	// 从 cfg.Server.Network 读取网络类型，未配置时默认使用 "udp"
+	network := cfg.Server.Network
+	if network == "" {
+		network = config.NetworkUDP
+	}
+
+	// 重置就绪状态，新的监听启动后再标记就绪
+	s.resetReady()
+
+	s.readyMu.Lock()
+	s.startedAt = time.Now()
+	s.readyMu.Unlock()
 
-	dnsServer := &dns.Server{
+	// DoQ 使用独立的 QUIC 监听，不经过 miekg/dns 服务器
+	s.stopDoQServer()
+	s.stopTCPServer()
+	if network == config.NetworkDoQ {
+		if err := s.startDoQServer(); err != nil {
+			s.markReady("", err)
+			return err
+		}
+		s.markReady(s.doqListener.Addr().String(), nil)
+		return nil
+	}
+
+	var dnsServer *dns.Server
+	dnsServer = &dns.Server{
 		Addr:    cfg.Server.Listen,
 		Net:     network, // 使用确定的 network 类型
 		Handler: s, // Server 类型实现了 ServeDNS 方法
+		MsgAcceptFunc: msgAcceptFunc,
+		TsigProvider: updateTSIGProvider{s},
 		NotifyStartedFunc: func() {
-			log.Printf("DNS Server: 已成功在 %s (%s) 启动监听", cfg.Server.Listen, network)
+			var addr string
+			if dnsServer.PacketConn != nil {
+				addr = dnsServer.PacketConn.LocalAddr().String()
+			} else if dnsServer.Listener != nil {
+				addr = dnsServer.Listener.Addr().String()
+			}
+			log.Printf("DNS Server: 已成功在 %s (%s) 启动监听", addr, network)
+			if conn, ok := dnsServer.PacketConn.(*net.UDPConn); ok {
+				applyUDPBufferSizes(conn, cfg.Server.ReadBufferSize, cfg.Server.WriteBufferSize)
+			}
+			s.markReady(addr, nil)
 		},
 		// ShutdownTimeout: 5 * time.Second, // 移除：miekg/dns.Server 没有此字段
 	}
+	// TCP 模式下预先监听，以便跟踪每个客户端连接
+	if network == config.NetworkTCP {
+		ln, err := net.Listen("tcp", cfg.Server.Listen)
+		if err != nil {
+			s.markReady("", err)
+			return fmt.Errorf("TCP 监听 %s 失败: %w", cfg.Server.Listen, err)
+		}
+		dnsServer.Listener = s.trackClients(ln)
+	}
 	s.server = dnsServer
+	shutdownChan := s.shutdownChan
+
+	// listen_tcp 与 listen 不同时，TCP 在独立地址上监听
+	if err := s.startTCPServer(); err != nil {
+		s.markReady("", err)
+		return err
+	}
 
 	// 在新的 goroutine 中启动服务器，以便 Start 可以返回
 	go func() {
 		log.Printf("DNS Server: 尝试在 %s (%s) 启动 miekg/dns 服务器...", cfg.Server.Listen, network)
-		if err := s.server.ListenAndServe(); err != nil {
+		serve := dnsServer.ListenAndServe
+		if dnsServer.Listener != nil {
+			serve = dnsServer.ActivateAndServe
+		}
+		if err := serve(); err != nil {
 			// 检查是否是因为我们主动关闭导致的错误
 			select {
-			case <-s.shutdownChan:
+			case <-shutdownChan:
 				log.Printf("DNS Server: ListenAndServe 在 %s (%s) 正常关闭。", cfg.Server.Listen, network)
 			default:
 				log.Printf("DNS Server: ListenAndServe 在 %s (%s) 失败: %v", cfg.Server.Listen, network, err)
-				// 这里可以考虑如何通知主程序启动失败，例如通过一个 channel
+				// 通过就绪状态通知等待方启动失败
+				s.markReady("", err)
 			}
 		}
 	}()
@@ -165,6 +372,85 @@ func (s *Server) startDNSServerProcess() error {
 	return nil // Start() 本身返回 nil，表示启动过程已开始
 }
 
+// resetReady 为新一轮启动重置就绪状态
+func (s *Server) resetReady() {
+	s.readyMu.Lock()
+	defer s.readyMu.Unlock()
+
+	select {
+	case <-s.ready:
+		s.ready = make(chan struct{})
+	default:
+		if s.ready == nil {
+			s.ready = make(chan struct{})
+		}
+	}
+	s.readyErr = nil
+	s.listenAddr = ""
+}
+
+// markReady 记录实际监听地址（或启动错误）并唤醒 WaitReady 的调用者
+func (s *Server) markReady(addr string, err error) {
+	s.readyMu.Lock()
+	defer s.readyMu.Unlock()
+
+	select {
+	case <-s.ready:
+		// 已经标记过，忽略重复通知
+		return
+	default:
+	}
+	s.listenAddr = addr
+	s.readyErr = err
+	close(s.ready)
+}
+
+// WaitReady 等待 DNS 服务器完成监听绑定（以及缓存预热，如已配置），返回启动过程中的错误
+func (s *Server) WaitReady(ctx context.Context) error {
+	s.readyMu.Lock()
+	ready := s.ready
+	s.readyMu.Unlock()
+
+	select {
+	case <-ready:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	s.readyMu.Lock()
+	err, warmed := s.readyErr, s.warmed
+	s.readyMu.Unlock()
+	if err != nil || warmed == nil {
+		return err
+	}
+
+	// 配置了缓存预热时，等待预热完成
+	select {
+	case <-warmed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ListenAddr 返回 DNS 服务器当前实际绑定的地址，尚未就绪时返回空字符串。
+// 当 server.listen 使用 0 端口时，可通过此方法获取系统分配的端口。
+func (s *Server) ListenAddr() string {
+	s.readyMu.Lock()
+	defer s.readyMu.Unlock()
+	return s.listenAddr
+}
+
+// Uptime 返回自最近一次启动（包括配置变更引起的重启）以来的运行时长，尚未启动时返回 0
+func (s *Server) Uptime() time.Duration {
+	s.readyMu.Lock()
+	defer s.readyMu.Unlock()
+	if s.startedAt.IsZero() {
+		return 0
+	}
+	return time.Since(s.startedAt)
+}
+
 // Stop 停止 DNS 代理服务器
 func (s *Server) Stop() error {
 	s.mu.Lock()
@@ -179,6 +465,24 @@ func (s *Server) Stop() error {
 		log.Println("DNS Server: 配置监控已停止。")
 	}
 
+	// 关闭管理 HTTP 服务
+	s.stopAdminServer()
+
+	// 关闭 DoT 服务
+	s.stopDoTServer()
+
+	// 关闭 DoH 服务
+	s.stopDoHServer()
+
+	// 关闭 DoQ 监听
+	s.stopDoQServer()
+
+	// 关闭独立的 TCP 监听
+	s.stopTCPServer()
+
+	// 关闭仍在宽限期内的旧监听
+	s.stopDraining()
+
 	// 关闭底层的 miekg/dns 服务器
 	if s.server != nil {
 		log.Println("DNS Server: 正在关闭 miekg/dns 服务器...")
@@ -202,30 +506,257 @@ func (s *Server) Stop() error {
 		log.Println("DNS Server: miekg/dns 服务器未运行或已停止。")
 	}
 
+	// 清除监听状态
+	s.resetReady()
+
+	// 导出剩余的追踪数据
+	s.setTracerProvider(nil)
+	s.configureStatsD("")
+
 	log.Println("DNS Server: 服务已成功停止。")
 	return nil
 }
 
 // ServeDNS 实现 dns.Handler 接口，处理 DNS 请求
 func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	s.recordClientQuery(w.RemoteAddr())
+
+	// 超过并发查询上限时立即拒绝，不再排队等待工作池
+	slots, ok := s.acquireQuerySlot()
+	if !ok {
+		metrics.QueriesDropped.Inc()
+		resp := new(dns.Msg)
+		resp.SetRcode(r, dns.RcodeRefused)
+		w.WriteMsg(resp)
+		return
+	}
+	defer releaseQuerySlot(slots)
+
 	// 获取工作池令牌
 	<-s.workerPool
 	defer func() {
 		s.workerPool <- struct{}{}
 	}()
 
-	// 1. 检查缓存
-	if cachedResp := s.checkCache(r); cachedResp != nil {
-		log.Printf("缓存命中: %s", r.Question[0].Name)
-		w.WriteMsg(cachedResp)
+	// 配置了 dns64_prefix 时，没有 AAAA 记录的应答改为由 A 记录合成
+	if s.dns64Applies(r) {
+		w = &dns64ResponseWriter{ResponseWriter: w, server: s, req: r}
+	}
+	s.serveDNS(w, r)
+}
+
+// serveDNS 处理单个 DNS 请求，调用者应已持有工作池令牌
+func (s *Server) serveDNS(w dns.ResponseWriter, r *dns.Msg) {
+	// 后台刷新过期缓存的查询不经过缓存，也不计入最近查询记录
+	_, refreshing := w.(*staleRefreshWriter)
+
+	// 记录本次查询的处理过程，返回时写入最近查询记录
+	start := time.Now()
+	clientIP := clientIPFromAddr(w.RemoteAddr())
+	entry := QueryLogEntry{Time: start}
+	if clientIP != nil {
+		entry.ClientIP = clientIP.String()
+	}
+	if len(r.Question) > 0 {
+		entry.Domain = normalizeDomain(r.Question[0].Name)
+		entry.Qtype = dns.TypeToString[r.Question[0].Qtype]
+	}
+	// 每个查询一个根 span，子 span 记录缓存查找、上游查询与 CDN 过滤，返回时写入查询结果属性
+	ctx, span := s.tracer().Start(context.Background(), "dns.query")
+	rw := &rcodeResponseWriter{ResponseWriter: w}
+	w = rw
+	defer func() {
+		if rw.written {
+			entry.Rcode = dns.RcodeToString[rw.rcode]
+		}
+		entry.Latency = time.Since(start)
+		endQuerySpan(span, entry)
+		if !refreshing {
+			s.queryLog.Add(entry)
+			s.recordStatsD(entry)
+		}
+	}()
+
+	// DNS UPDATE 消息不按查询处理，按 server.forward_updates_to 转发或拒绝
+	if r.Opcode == dns.OpcodeUpdate {
+		s.handleUpdate(w, r)
+		return
+	}
+
+	// CHAOS 类 version.bind / hostname.bind 查询按配置在本地应答
+	if resp := s.chaosResponse(r); resp != nil {
+		w.WriteMsg(resp)
+		return
+	}
+
+	// ANY 查询按 server.any_query_policy 在本地应答
+	if resp := s.anyQueryResponse(r); resp != nil {
+		w.WriteMsg(resp)
+		return
+	}
+
+	// 命中 server.dnsbl_zones 的 DNSBL 查询在本地应答
+	if resp := s.dnsblResponse(r); resp != nil {
+		w.WriteMsg(resp)
+		return
+	}
+
+	// 命中 server.rpz_zones 规则的查询按 RPZ 动作应答或丢弃，PASSTHRU 按普通查询处理
+	if resp, drop := s.rpzResponse(r); drop {
+		return
+	} else if resp != nil {
+		w.WriteMsg(resp)
+		return
+	}
+
+	// 配置了 force_a_only 的域名不转发 AAAA 查询，直接返回空的 NOERROR 响应
+	if len(r.Question) > 0 && r.Question[0].Qtype == dns.TypeAAAA && s.forceAOnly(r.Question[0].Name) {
+		log.Printf("域名规则 force_a_only 生效，AAAA 查询直接返回空响应: %s", r.Question[0].Name)
+		metrics.AAAASuppressCount.Inc()
+		resp := new(dns.Msg)
+		resp.SetReply(r)
+		w.WriteMsg(resp)
+		return
+	}
+
+	// 为上游设置的 CD 位不应出现在返回给客户端的响应中
+	if s.config.Upstream.CDBit {
+		w = &cdBitResponseWriter{ResponseWriter: w, checkingDisabled: r.CheckingDisabled}
+	}
+
+	// 主上游（按 split_horizon 根据客户端子网选择），非全局上游时使用独立的缓存视图
+	primary := s.upstreamForClient(clientIP)
+	cacheView := ""
+	if primary != s.upstream {
+		cacheView = primary
+	} else {
+		// load_balance 为 latency 时在全局主上游之间选择，它们共用全局缓存视图
+		primary = s.balancedUpstream(primary)
+	}
+	// 注入 ECS 时按客户端子网分别缓存，写出前按客户端原始请求还原 OPT 记录
+	if s.config.Upstream.InjectECS && clientIP != nil {
+		cacheView = s.ecsCacheView(cacheView, clientIP)
+		w = &ecsResponseWriter{ResponseWriter: w, clientOPT: r.IsEdns0()}
+	}
+
+	// 1. 检查缓存（后台刷新过期条目时跳过缓存直接查询上游）
+	_, cacheSpan := s.tracer().Start(ctx, "dns.cache.lookup")
+	cachedResp, cacheEntry, stale := s.lookupCacheView(r, cacheView)
+	cacheSpan.End()
+	if cachedResp != nil && !refreshing {
+		if stale {
+			log.Printf("缓存已过期，返回过期响应并在后台刷新: %s", r.Question[0].Name)
+			metrics.StaleServedCount.Inc()
+			s.refreshStale(cacheEntry, r, w.RemoteAddr())
+		} else {
+			log.Printf("缓存命中: %s", r.Question[0].Name)
+		}
+		entry.CacheHit = true
+		w.WriteMsg(s.capResponseIPs(s.applyResponseOrder(s.applyWeight(cachedResp, clientIP), clientIP), w.RemoteAddr()))
 		return
 	}
 	log.Printf("缓存未命中: %s", r.Question[0].Name)
 
-	// 2. 转发到主上游服务器 (s.upstream)
-	initialResp, _, err := s.client.Exchange(r, s.upstream)
+	trigger := s.fallbackTrigger()
+	fallback := strings.TrimSpace(s.config.Upstream.FallbackServer)
+	// 主备上游查询各自的超时时间，按域名规则的 upstream_timeout 或 upstream.timeout
+	timeout := s.upstreamTimeout(r.Question[0].Name)
+	// 发往上游的查询（可能注入了客户端子网）
+	query := s.upstreamQuery(w, r)
+
+	// merge_responses 模式下备用上游参与合并，不再单独回退
+	merge := s.config.Upstream.MergeResponses
+	mergeUpstreams := []string{primary}
+	if merge {
+		if fallback != "" && fallback != primary {
+			mergeUpstreams = append(mergeUpstreams, fallback)
+		}
+		fallback = ""
+	}
+
+	// always 模式下与主上游并行查询备用上游
+	var prefetched chan exchangeResult
+	if trigger == config.FallbackTriggerAlways && fallback != "" {
+		prefetched = make(chan exchangeResult, 1)
+		go func(req *dns.Msg) {
+			resp, rtt, err := s.exchangeTimeout(req, fallback, timeout)
+			prefetched <- exchangeResult{resp: resp, rtt: rtt, err: err}
+		}(query.Copy())
+	}
+	queryFallback := func() (resp *dns.Msg, rtt time.Duration, err error) {
+		fallbackSpan := s.startUpstreamSpan(ctx, fallback)
+		defer func() { endSpan(fallbackSpan, err) }()
+		if prefetched != nil {
+			res := <-prefetched
+			return res.resp, res.rtt, res.err
+		}
+		fallbackStart := time.Now()
+		defer func() { s.statsD().Timing("upstream.fallback_latency", time.Since(fallbackStart)) }()
+		return s.exchangeTimeout(query, fallback, timeout)
+	}
+
+	// 2. 转发到主上游服务器（merge_responses 模式下并行查询所有上游并合并应答）
+	var initialResp *dns.Msg
+	var err error
+	if merge {
+		entry.Upstream = strings.Join(mergeUpstreams, ",")
+	} else {
+		entry.Upstream = primary
+	}
+	upstreamSpan := s.startUpstreamSpan(ctx, entry.Upstream)
+	upstreamStart := time.Now()
+	if merge {
+		initialResp, err = s.exchangeMerged(query, mergeUpstreams, timeout)
+	} else {
+		var rtt time.Duration
+		initialResp, rtt, err = s.exchangePrimary(query, primary, timeout)
+		s.recordUpstreamRTT(primary, rtt, err, timeout)
+	}
+	endSpan(upstreamSpan, err)
+	// 主上游熔断打开时查询未发送，无论 fallback_trigger 为何值都改用备用上游
+	circuitOpen := errors.Is(err, upstream.ErrCircuitOpen)
+	if !circuitOpen {
+		s.statsD().Timing("upstream.latency", time.Since(upstreamStart))
+	}
+
+	// 2.0 validate_responses 开启时，未通过检查的主上游响应按出错处理，并且总是改用备用上游
+	invalid := false
+	if err == nil && s.config.Upstream.ValidateResponses {
+		if verr := upstream.ValidateResponse(query, initialResp); verr != nil {
+			log.Printf("主上游 %s 的响应未通过检查: %v, 请求: %s", primary, verr, r.Question[0].Name)
+			metrics.InvalidResponseCount.Inc()
+			invalid = true
+			err = verr
+		}
+	}
+
+	// 根据触发条件判断主上游结果是否需要直接切换到备用上游
+	if fallback != "" && (invalid || circuitOpen || primaryNeedsFallback(trigger, initialResp, err)) {
+		log.Printf("主上游 %s 结果触发备用上游 (%s): err=%v, 请求: %s", primary, trigger, err, r.Question[0].Name)
+		fallbackResp, RTT, ferr := queryFallback()
+		if ferr != nil {
+			log.Printf("转发请求到 %s 失败: %v, 请求: %s", fallback, ferr, r.Question[0].Name)
+			dns.HandleFailed(w, r)
+			return
+		}
+		log.Printf("从 %s 获取到响应, RTT: %v, 请求: %s", fallback, RTT, r.Question[0].Name)
+		entry.Upstream = fallback
+		if s.violatesSingleCNAME(r.Question[0].Name, fallbackResp) {
+			dns.HandleFailed(w, r)
+			return
+		}
+		fallbackResp = s.finalizeResponse(r.Question[0].Name, fallbackResp)
+		s.updateCacheView(r, cacheView, fallbackResp)
+		w.WriteMsg(s.capResponseIPs(s.applyResponseOrder(fallbackResp, clientIP), w.RemoteAddr()))
+		return
+	}
 	if err != nil {
-		log.Printf("转发请求到主上游 %s 失败: %v, 请求: %s", s.upstream, err, r.Question[0].Name)
+		log.Printf("转发请求到主上游 %s 失败: %v, 请求: %s", primary, err, r.Question[0].Name)
+		dns.HandleFailed(w, r)
+		return
+	}
+	// 2.0.1 enforce_single_cname 要求最多一层 CNAME
+	if s.violatesSingleCNAME(r.Question[0].Name, initialResp) {
 		dns.HandleFailed(w, r)
 		return
 	}
@@ -234,42 +765,83 @@ func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
 	if s.noAorAAAA(initialResp) && s.shouldNoRecordNoFallback(r.Question[0].Name) {
 		// 针对 return_cdn_a 且启用剔除的规则，移除对应 CNAME
 		if effStrategy, domainForStrategy := s.effectiveStrategyForNoRecord(r, initialResp); effStrategy == config.StrategyReturnCDNA && s.shouldStripCNAMEWhenNoRecord(domainForStrategy) {
-			cleaned := s.stripCNAMEsForDomain(initialResp, domainForStrategy)
-			s.updateCache(r, cleaned)
+			cleaned := s.finalizeResponse(r.Question[0].Name, s.stripCNAMEsForDomain(initialResp, domainForStrategy))
+			s.updateCacheView(r, cacheView, cleaned)
 			w.WriteMsg(cleaned)
 			return
 		}
-		s.updateCache(r, initialResp)
-		w.WriteMsg(initialResp)
+		resp := s.finalizeResponse(r.Question[0].Name, initialResp)
+		s.updateCacheView(r, cacheView, resp)
+		w.WriteMsg(resp)
 		return
 	}
 
 	// 3. 检查主上游响应的 CNAME 解析结果是否包含我司 CDN IP
-	//    checkCNAMEForCDNIP 会使用 s.upstream 解析 CNAME 记录
+	_, cdnSpan := s.tracer().Start(ctx, "dns.cdn.filter")
 	cdnIPsFound, cdnIPsList := s.checkCNAMEForCDNIP(initialResp)
+	// 域名规则开启 verify_cdnip_ownership 时剔除 PTR 记录不匹配 cdn_ownership_pattern 的 IP
+	if cdnIPsFound {
+		cdnIPsList = s.verifyCDNOwnership(r.Question[0].Name, cdnIPsList, timeout)
+		cdnIPsFound = len(cdnIPsList) > 0
+	}
+	// 检测到的 CDN IP 数量未达到域名规则的 min_cdnips 时视为未发现，按回退逻辑处理
+	if minIPs := s.minCDNIPs(r.Question[0].Name); cdnIPsFound && len(cdnIPsList) < minIPs {
+		log.Printf("检测到 %d 个 CDN IP，少于 min_cdnips (%d)，视为未发现。请求: %s", len(cdnIPsList), minIPs, r.Question[0].Name)
+		cdnIPsFound = false
+	}
+	entry.CDNDetected = cdnIPsFound
 
 	var finalResp *dns.Msg
 
 	if !cdnIPsFound {
-		// 4. 我司 CDN IP 未在主上游的 CNAME 解析结果中找到，则固定转发给 fallbackUpstream
+		cdnSpan.End()
+		// 4. 我司 CDN IP 未在主上游的 CNAME 解析结果中找到，按域名规则的 fallback_strategy 处理；
+		// 默认 use_fallback 时 cdn_miss/always 模式下转发给 fallbackUpstream
 		questionName := ""
 		if len(r.Question) > 0 {
 			questionName = r.Question[0].Name
 		}
-		fallback := strings.TrimSpace(s.config.Upstream.FallbackServer)
-		if fallback == "" {
-			log.Printf("CDN IP 未在 %s 的 CNAME 解析结果中找到，且未配置备用上游。直接返回主上游响应。请求: %s", s.upstream, questionName)
+		switch fallbackStrategy := s.fallbackStrategy(questionName); fallbackStrategy {
+		case config.FallbackStrategyReturnPrimary:
+			log.Printf("CDN IP 未在 %s 的 CNAME 解析结果中找到，域名规则要求直接返回主上游响应。请求: %s", primary, questionName)
 			finalResp = initialResp
-		} else {
-			log.Printf("CDN IP 未在 %s (主上游) 的 CNAME 解析结果中找到。转发到 %s, 原始请求: %s", s.upstream, fallback, questionName)
-			var RTT time.Duration
-			finalResp, RTT, err = s.client.Exchange(r, fallback)
-			if err != nil {
-				log.Printf("转发请求到 %s 失败: %v, 请求: %s", fallback, err, questionName)
-				dns.HandleFailed(w, r)
-				return
+		case config.FallbackStrategyReturnEmpty, config.FallbackStrategyNXDomain:
+			log.Printf("CDN IP 未在 %s 的 CNAME 解析结果中找到，按域名规则返回 %s。请求: %s", primary, fallbackStrategy, questionName)
+			finalResp = new(dns.Msg)
+			finalResp.SetReply(r)
+			if fallbackStrategy == config.FallbackStrategyNXDomain {
+				finalResp.Rcode = dns.RcodeNameError
+				// 配置了 synthetic_soa 时在授权段附带 SOA，供客户端缓存否定应答
+				if soa := s.syntheticSOA(questionName); soa != nil {
+					finalResp.Ns = append(finalResp.Ns, soa)
+				}
+			}
+		default:
+			if merge {
+				log.Printf("CDN IP 未在合并后的解析结果中找到。直接返回合并结果。请求: %s", questionName)
+				finalResp = initialResp
+			} else if fallback == "" {
+				log.Printf("CDN IP 未在 %s 的 CNAME 解析结果中找到，且未配置备用上游。直接返回主上游响应。请求: %s", primary, questionName)
+				finalResp = initialResp
+			} else if trigger != config.FallbackTriggerCDNMiss && trigger != config.FallbackTriggerAlways {
+				log.Printf("CDN IP 未在 %s 的 CNAME 解析结果中找到，备用上游触发条件为 %s。直接返回主上游响应。请求: %s", primary, trigger, questionName)
+				finalResp = initialResp
+			} else {
+				log.Printf("CDN IP 未在 %s (主上游) 的 CNAME 解析结果中找到。转发到 %s, 原始请求: %s", primary, fallback, questionName)
+				var RTT time.Duration
+				finalResp, RTT, err = queryFallback()
+				if err != nil {
+					log.Printf("转发请求到 %s 失败: %v, 请求: %s", fallback, err, questionName)
+					dns.HandleFailed(w, r)
+					return
+				}
+				log.Printf("从 %s 获取到响应, RTT: %v, 请求: %s", fallback, RTT, questionName)
+				entry.Upstream = fallback
+				if s.violatesSingleCNAME(questionName, finalResp) {
+					dns.HandleFailed(w, r)
+					return
+				}
 			}
-			log.Printf("从 %s 获取到响应, RTT: %v, 请求: %s", fallback, RTT, questionName)
 		}
 		// 根据需求第四点：“返回其解析结果”，所以不对 finalResp 进行 further processing
 	} else {
@@ -278,23 +850,74 @@ func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
 		if len(r.Question) > 0 {
 			questionName = r.Question[0].Name
 		}
-		log.Printf("CDN IP 在 %s (主上游) 的 CNAME 解析结果中找到。处理响应, 原始请求: %s", s.upstream, questionName)
+		log.Printf("CDN IP 在 %s (主上游) 的 CNAME 解析结果中找到。处理响应, 原始请求: %s", primary, questionName)
 		finalResp = s.processResponse(r, initialResp, cdnIPsList) // 注意：传入 cdnIPsList
+		cdnSpan.End()
 	}
 
-	// 6. 更新缓存并发送响应
+	// 6. 防 DNS 重绑定过滤，按域名规则缩放 TTL、去除重复记录、清理附加段，更新缓存并发送响应
 	if finalResp != nil {
-		s.updateCache(r, finalResp)
-		w.WriteMsg(finalResp)
+		finalResp = s.finalizeResponse(r.Question[0].Name, finalResp)
+		s.updateCacheView(r, cacheView, finalResp)
+		s.recordUpstreamResponse(r, cacheView, initialResp)
+		w.WriteMsg(s.capResponseIPs(s.applyResponseOrder(s.applyWeight(finalResp, clientIP), clientIP), w.RemoteAddr()))
 	} else {
 		// Should not happen if logic is correct, but as a fallback
 		dns.HandleFailed(w, r)
 	}
 }
 
+// exchangeResult 保存一次上游查询的结果，用于并行查询
+type exchangeResult struct {
+	resp *dns.Msg
+	rtt  time.Duration
+	err  error
+}
+
+// cdBitResponseWriter 在写出响应前将 CD 位恢复为客户端请求中的值
+type cdBitResponseWriter struct {
+	dns.ResponseWriter
+	checkingDisabled bool
+}
+
+// WriteMsg 恢复 CD 位后写出响应
+func (w *cdBitResponseWriter) WriteMsg(m *dns.Msg) error {
+	m.CheckingDisabled = w.checkingDisabled
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// fallbackTrigger 返回当前生效的备用上游触发条件
+func (s *Server) fallbackTrigger() string {
+	if s.config.Upstream.FallbackTrigger == "" {
+		return config.FallbackTriggerCDNMiss
+	}
+	return s.config.Upstream.FallbackTrigger
+}
+
+// primaryNeedsFallback 判断主上游的查询结果是否直接触发备用上游
+func primaryNeedsFallback(trigger string, resp *dns.Msg, err error) bool {
+	switch trigger {
+	case config.FallbackTriggerNXDomain:
+		return err == nil && resp != nil && resp.Rcode == dns.RcodeNameError
+	case config.FallbackTriggerError:
+		return err != nil || resp == nil || (resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError)
+	case config.FallbackTriggerAlways:
+		return err != nil || resp == nil || resp.Rcode == dns.RcodeServerFailure
+	}
+	return false
+}
+
 // forwardRequest 将请求转发到上游 DNS 服务器
+// 开启 validate_responses 时，未通过检查的响应以错误返回；开启 strict_validation 时，
+// 与请求不对应的响应由 exchangeContext 换用新 ID 重试
 func (s *Server) forwardRequest(r *dns.Msg) (*dns.Msg, error) {
-	resp, _, err := s.client.Exchange(r, s.upstream)
+	resp, _, err := s.exchange(r, s.upstream)
+	if err == nil && s.config.Upstream.ValidateResponses {
+		if err := upstream.ValidateResponse(r, resp); err != nil {
+			metrics.InvalidResponseCount.Inc()
+			return nil, err
+		}
+	}
 	return resp, err
 }
 
@@ -313,24 +936,29 @@ func (s *Server) processResponse(req, originalResp *dns.Msg, cdnIPsFromInitialCh
 
 	qName := req.Question[0].Name
 	domainForStrategy := normalizeDomain(qName)
-	strategy := s.config.GetDomainStrategy(domainForStrategy)
+	qtype := req.Question[0].Qtype
+	// 域名规则的 qtype_filter 不包含该查询类型时规则不生效，原样返回上游响应
+	if rule := s.config.GetDomainRule(domainForStrategy); rule != nil && !rule.AppliesTo(qtype) {
+		return originalResp
+	}
+	strategy := s.config.GetDomainStrategy(domainForStrategy, qtype)
 
 	// 如果请求的域名本身没有特定策略 (Filter/ReturnA)，检查其 CNAME 链中是否有域名配置了此类策略
 	if strategy == config.StrategyNone { // If no specific strategy, or if strategy is explicitly 'none' (which implies forward)
 		chain := NewCNAMEChain()
 		chain.BuildFromResponse(originalResp) // originalResp 是来自主上游的响应
+		// 只关心与我们配置的域名模式相关的 CNAME 链接
+		matchedChain := chain.FilterByMatcher(s.domainMatcher)
 
 		foundOverrideStrategyInChain := false
-		for domainInChain := range chain.domains {
-			if s.domainMatcher.Match(domainInChain) { // 确保是我们关心的域名模式
-				chainStrategy := s.config.GetDomainStrategy(domainInChain)
-				if chainStrategy == config.StrategyFilterNonCDN || chainStrategy == config.StrategyReturnCDNA {
-					strategy = chainStrategy
-					domainForStrategy = domainInChain // 更新应用策略的域名为 CNAME 链中的域名
-					log.Printf("策略应用于 CNAME 链中的域名 %s: %s (原始请求 %s)", domainForStrategy, strategy, qName)
-					foundOverrideStrategyInChain = true
-					break
-				}
+		for domainInChain := range matchedChain.domains {
+			chainStrategy := s.config.GetDomainStrategy(domainInChain, qtype)
+			if chainStrategy == config.StrategyFilterNonCDN || chainStrategy == config.StrategyReturnCDNA {
+				strategy = chainStrategy
+				domainForStrategy = domainInChain // 更新应用策略的域名为 CNAME 链中的域名
+				log.Printf("策略应用于 CNAME 链中的域名 %s: %s (原始请求 %s)", domainForStrategy, strategy, qName)
+				foundOverrideStrategyInChain = true
+				break
 			}
 		}
 		// 如果遍历 CNAME 链后策略仍为 None，说明没有匹配到 Filter/ReturnA 策略
@@ -395,8 +1023,8 @@ func (s *Server) checkCNAMEForCDNIP(resp *dns.Msg) (bool, []net.IP) {
 			
 			// 如果该 A 记录属于 CNAME 链或者原始域名匹配我们的规则
 			if cnameTargets[owner] || s.domainMatcher.Match(owner) {
-				// 检查 IP 是否属于 CDN IP
-				if s.cidrMatcher.Contains(ip) {
+				// 检查 IP 是否属于 CDN IP（域名规则配置了 cdn_cidr_override 时使用规则自己的网段）
+				if s.cdnMatcherFor(resp, owner).Contains(ip) {
 					cdnIPs = append(cdnIPs, ip)
 					log.Printf("检测到 CDN IP: %s 属于域名: %s", ip.String(), owner)
 				}
@@ -407,8 +1035,31 @@ func (s *Server) checkCNAMEForCDNIP(resp *dns.Msg) (bool, []net.IP) {
 	return len(cdnIPs) > 0, cdnIPs
 }
 
-// filterNonCDNIPs 过滤掉非 CDN 节点的 IP
+// cdnMatcherFor 返回判断 resp 中属于 owner 的 IP 是否为 CDN IP 时使用的匹配器：
+// 查询域名或 owner 命中的域名规则配置了 cdn_cidr_override 时（查询域名优先）使用规则自己的匹配器，否则使用全局 cdn_ips
+func (s *Server) cdnMatcherFor(resp *dns.Msg, owner string) *util.CIDRMatcher {
+	names := []string{owner}
+	if len(resp.Question) > 0 {
+		names = []string{normalizeDomain(resp.Question[0].Name), owner}
+	}
+	for _, name := range names {
+		if rule := s.config.GetDomainRule(name); rule != nil {
+			if matcher := rule.CDNMatcher(); matcher != nil {
+				return matcher
+			}
+		}
+	}
+	return s.cidrMatcher
+}
+
+// filterNonCDNIPs 过滤掉非 CDN 节点的 IP，只保留出现在 cdnIPs 中的 IP
+// (未通过 verify_cdnip_ownership 校验的 IP 已从 cdnIPs 中剔除，即使位于 CDN 网段内也被过滤)
 func (s *Server) filterNonCDNIPs(resp *dns.Msg, cdnIPs []net.IP) *dns.Msg {
+	kept := make(map[string]bool, len(cdnIPs))
+	for _, ip := range cdnIPs {
+		kept[ip.String()] = true
+	}
+
 	// 创建新的响应
 	newResp := resp.Copy()
 	newResp.Answer = make([]dns.RR, 0, len(resp.Answer))
@@ -466,8 +1117,8 @@ func (s *Server) filterNonCDNIPs(resp *dns.Msg, cdnIPs []net.IP) *dns.Msg {
 
 			// 如果 A 记录属于匹配的域名或者 CNAME 链中的域名
 			if matchedDomains[owner] || s.domainMatcher.Match(owner) {
-				// 只保留 CDN IP
-				if s.cidrMatcher.Contains(a.A) {
+				// 只保留 CDN IP（域名规则配置了 cdn_cidr_override 时使用规则自己的网段）
+				if s.cdnMatcherFor(resp, owner).Contains(a.A) && kept[a.A.String()] {
 					newResp.Answer = append(newResp.Answer, a)
 					log.Printf("保留 CDN IP: %s 属于域名: %s", a.A.String(), owner)
 				} else {
@@ -498,8 +1149,7 @@ func (s *Server) returnCDNARecords(req *dns.Msg, cdnIPs []net.IP) *dns.Msg {
 	// 获取域名的 TTL 设置
 	ttl := uint32(60) // 默认 60 秒
 	for _, rule := range s.config.Domains {
-		pattern := rule.Pattern
-		if util.MatchDomain(pattern, strings.TrimSuffix(domain, ".")) {
+		if rule.Match(strings.TrimSuffix(domain, ".")) {
 			if rule.TTL > 0 {
 				ttl = rule.TTL
 			}
@@ -540,19 +1190,18 @@ func (s *Server) effectiveStrategyForNoRecord(req *dns.Msg, originalResp *dns.Ms
     }
     qName := req.Question[0].Name
     domain := normalizeDomain(qName)
-    strategy := s.config.GetDomainStrategy(domain)
+    qtype := req.Question[0].Qtype
+    strategy := s.config.GetDomainStrategy(domain, qtype)
     if strategy == config.StrategyReturnCDNA {
         return strategy, domain
     }
     if strategy == config.StrategyNone {
         chain := NewCNAMEChain()
         chain.BuildFromResponse(originalResp)
-        for d := range chain.domains {
-            if s.domainMatcher.Match(d) {
-                s2 := s.config.GetDomainStrategy(d)
-                if s2 == config.StrategyReturnCDNA {
-                    return s2, d
-                }
+        for d := range chain.FilterByMatcher(s.domainMatcher).domains {
+            s2 := s.config.GetDomainStrategy(d, qtype)
+            if s2 == config.StrategyReturnCDNA {
+                return s2, d
             }
         }
     }
@@ -563,7 +1212,7 @@ func (s *Server) effectiveStrategyForNoRecord(req *dns.Msg, originalResp *dns.Ms
 func (s *Server) shouldStripCNAMEWhenNoRecord(domain string) bool {
     d := strings.TrimSuffix(strings.ToLower(domain), ".")
     for _, rule := range s.config.Domains {
-        if util.MatchDomain(rule.Pattern, d) {
+        if rule.Match(d) {
             return rule.StripCNAMEWhenNoRecord
         }
     }
@@ -619,7 +1268,7 @@ func (s *Server) stripCNAMEsForDomain(resp *dns.Msg, domain string) *dns.Msg {
 func (s *Server) shouldNoRecordNoFallback(domain string) bool {
     d := strings.TrimSuffix(strings.ToLower(domain), ".")
     for _, rule := range s.config.Domains {
-        if util.MatchDomain(rule.Pattern, d) {
+        if rule.Match(d) {
             if rule.NoRecordNoFallback != nil {
                 return *rule.NoRecordNoFallback
             }
@@ -629,55 +1278,275 @@ func (s *Server) shouldNoRecordNoFallback(domain string) bool {
     return s.config.Upstream.NoRecordNoFallback
 }
 
+// fallbackStrategy 返回域名在主上游结果中未发现 CDN IP 时的处理方式，未配置时为 use_fallback
+func (s *Server) fallbackStrategy(domain string) string {
+	d := strings.TrimSuffix(strings.ToLower(domain), ".")
+	for _, rule := range s.config.Domains {
+		if rule.Match(d) {
+			if rule.FallbackStrategy != "" {
+				return rule.FallbackStrategy
+			}
+			break
+		}
+	}
+	return config.FallbackStrategyUseFallback
+}
+
+// minCDNIPs 返回域名被视为命中 CDN 所需的最少 CDN IP 数量，未配置时为 1
+func (s *Server) minCDNIPs(domain string) int {
+	d := strings.TrimSuffix(strings.ToLower(domain), ".")
+	for _, rule := range s.config.Domains {
+		if rule.Match(d) {
+			if rule.MinCDNIPs > 0 {
+				return rule.MinCDNIPs
+			}
+			break
+		}
+	}
+	return 1
+}
+
+// forceAOnly 判断域名规则是否要求不转发 AAAA 查询
+func (s *Server) forceAOnly(domain string) bool {
+	d := strings.TrimSuffix(strings.ToLower(domain), ".")
+	for _, rule := range s.config.Domains {
+		if rule.Match(d) {
+			return rule.ForceAOnly
+		}
+	}
+	return false
+}
+
+// scaleResponseTTL 按域名规则的 response_ttl_multiplier 缩放响应应答段中各记录的 TTL，
+// 并限制在 [min_ttl, max_ttl] 内。规则未要求调整时原样返回，否则返回调整后的副本。
+func (s *Server) scaleResponseTTL(domain string, resp *dns.Msg) *dns.Msg {
+	if resp == nil || len(resp.Answer) == 0 {
+		return resp
+	}
+	d := strings.TrimSuffix(strings.ToLower(domain), ".")
+	var rule *config.DomainRule
+	for i := range s.config.Domains {
+		if s.config.Domains[i].Match(d) {
+			rule = &s.config.Domains[i]
+			break
+		}
+	}
+	if rule == nil {
+		return resp
+	}
+	multiplier := rule.ResponseTTLMultiplier
+	if multiplier == 0 {
+		multiplier = 1
+	}
+	if multiplier == 1 && rule.MinTTL == 0 && rule.MaxTTL == 0 {
+		return resp
+	}
+
+	scaled := resp.Copy()
+	for _, rr := range scaled.Answer {
+		ttl := math.Round(float64(rr.Header().Ttl) * multiplier)
+		if ttl > math.MaxUint32 {
+			ttl = math.MaxUint32
+		}
+		newTTL := uint32(ttl)
+		if newTTL < rule.MinTTL {
+			newTTL = rule.MinTTL
+		}
+		if rule.MaxTTL > 0 && newTTL > rule.MaxTTL {
+			newTTL = rule.MaxTTL
+		}
+		rr.Header().Ttl = newTTL
+	}
+	return scaled
+}
+
 // checkCache 检查缓存
 func (s *Server) checkCache(r *dns.Msg) *dns.Msg {
+	return s.checkCacheView(r, "")
+}
+
+// cacheKey 返回缓存键。view 为空表示全局上游的缓存视图，
+// split_horizon 子网的响应以其上游地址作为视图单独缓存，避免不同子网的结果互相覆盖
+func cacheKey(req *dns.Msg, view string) string {
+	if view == "" {
+		return req.Question[0].String()
+	}
+	return view + "|" + req.Question[0].String()
+}
+
+// checkCacheView 在指定视图中检查缓存，开启 stale_while_revalidate 时可能返回过期的响应
+func (s *Server) checkCacheView(r *dns.Msg, view string) *dns.Msg {
+	resp, _, _ := s.lookupCacheView(r, view)
+	return resp
+}
+
+// lookupCacheView 在指定视图中查找缓存，返回响应副本与对应条目；stale 表示条目已过软过期时间，
+// 返回的响应中记录的 TTL 已改为 staleAnswerTTL。超过硬过期时间的条目视为不存在
+func (s *Server) lookupCacheView(r *dns.Msg, view string) (resp *dns.Msg, entry *CacheEntry, stale bool) {
 	if len(r.Question) == 0 {
-		return nil
+		return nil, nil, false
 	}
 
-	key := r.Question[0].String()
+	key := cacheKey(r, view)
 	s.cache.mu.RLock()
 	defer s.cache.mu.RUnlock()
 
 	entry, found := s.cache.entries[key]
 	if !found {
-		return nil
+		return nil, nil, false
 	}
 
 	// 检查是否过期
-	if time.Now().After(entry.expireAt) {
-		return nil
+	now := time.Now()
+	if now.After(entry.hardExpireAt) {
+		return nil, nil, false
 	}
+	s.cache.touch(key)
 
 	// 返回缓存的响应副本
-	resp := entry.msg.Copy()
+	resp = entry.msg.Copy()
 	resp.Id = r.Id
-	return resp
+	if now.After(entry.softExpireAt) {
+		setStaleTTL(resp)
+		return resp, entry, true
+	}
+	return resp, entry, false
 }
 
 // updateCache 更新缓存
 func (s *Server) updateCache(req, resp *dns.Msg) {
+	s.updateCacheView(req, "", resp)
+}
+
+// updateCacheView 更新指定视图中的缓存
+func (s *Server) updateCacheView(req *dns.Msg, view string, resp *dns.Msg) {
 	if len(req.Question) == 0 || resp == nil {
 		return
 	}
 
-	key := req.Question[0].String()
+	key := cacheKey(req, view)
 	s.cache.mu.Lock()
 	defer s.cache.mu.Unlock()
 
-	// 如果缓存已满，清除一个随机条目
-	if len(s.cache.entries) >= s.cache.maxSize {
-		// 简单实现：删除第一个找到的条目
-		for k := range s.cache.entries {
-			delete(s.cache.entries, k)
-			break
+	ttl := s.cache.ttl
+	// 对指定的域名，NXDOMAIN 响应按 negative_ttl 缓存；授权段带有 SOA 时不超过其 MINIMUM (RFC 2308)
+	if resp.Rcode == dns.RcodeNameError && s.cache.negativeTTL > 0 &&
+		s.negativeCacheMatcher.Match(req.Question[0].Name) {
+		ttl = s.cache.negativeTTL
+		if minimum, ok := extractSOAMinimum(resp); ok {
+			ttl = min(ttl, time.Duration(minimum)*time.Second)
 		}
 	}
+	ttl = jitterTTL(ttl, s.cache.jitter, s.rng)
+
+	s.cache.set(key, resp, ttl)
+}
+
+// recordUpstreamResponse 在 view 视图中 req 的缓存条目上记录主上游的原始响应，条目不存在时忽略
+func (s *Server) recordUpstreamResponse(req *dns.Msg, view string, upstream *dns.Msg) {
+	if len(req.Question) == 0 || upstream == nil {
+		return
+	}
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	if entry, ok := s.cache.entries[cacheKey(req, view)]; ok {
+		entry.upstream = upstream.Copy()
+	}
+}
+
+// cachedUpstreamResponse 返回 view 视图中 req 的缓存条目记录的主上游原始响应副本，没有时返回 nil
+func (s *Server) cachedUpstreamResponse(req *dns.Msg, view string) *dns.Msg {
+	if len(req.Question) == 0 {
+		return nil
+	}
+	s.cache.mu.RLock()
+	defer s.cache.mu.RUnlock()
+	if entry, ok := s.cache.entries[cacheKey(req, view)]; ok && entry.upstream != nil {
+		return entry.upstream.Copy()
+	}
+	return nil
+}
+
+// set 写入缓存条目，缓存已满且 key 不存在时先按淘汰策略淘汰一个条目。调用此方法时，调用者应持有 c.mu 的写锁。
+func (c *Cache) set(key string, resp *dns.Msg, ttl time.Duration) {
+	c.policyMu.Lock()
+	defer c.policyMu.Unlock()
+
+	_, exists := c.entries[key]
+	if !exists && len(c.entries) >= c.maxSize {
+		c.evict()
+	}
 
 	// 添加到缓存
-	s.cache.entries[key] = &CacheEntry{
-		msg:      resp.Copy(),
-		expireAt: time.Now().Add(s.cache.ttl),
+	now := time.Now()
+	entry := &CacheEntry{
+		msg:          resp.Copy(),
+		softExpireAt: now.Add(ttl),
+		hardExpireAt: now.Add(ttl + c.staleTTL),
+	}
+	if c.policy != nil {
+		if exists {
+			c.policy.Access(key)
+		} else {
+			c.policy.Add(key)
+		}
+	}
+	c.entries[key] = entry
+}
+
+// delete 删除 key 对应的条目，不存在时返回 false。调用此方法时，调用者应持有 c.mu 的写锁。
+func (c *Cache) delete(key string) bool {
+	c.policyMu.Lock()
+	defer c.policyMu.Unlock()
+
+	if _, ok := c.entries[key]; !ok {
+		return false
+	}
+	delete(c.entries, key)
+	if c.policy != nil {
+		c.policy.Remove(key)
+	}
+	return true
+}
+
+// evict 淘汰一个条目。调用此方法时，调用者应持有 c.mu 的写锁与 c.policyMu。
+func (c *Cache) evict() {
+	if c.policy == nil {
+		// 未设置淘汰策略时删除第一个找到的条目
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+		return
+	}
+	if key, ok := c.policy.Evict(); ok {
+		delete(c.entries, key)
+	}
+}
+
+// touch 记录一次缓存命中。调用此方法时，调用者应持有 c.mu 的读锁或写锁。
+func (c *Cache) touch(key string) {
+	c.policyMu.Lock()
+	defer c.policyMu.Unlock()
+
+	if c.policy != nil {
+		c.policy.Access(key)
+	}
+}
+
+// setEvictionPolicy 切换淘汰策略，已有条目加入新策略，原策略的访问记录不保留。
+// 调用此方法时，调用者应持有 c.mu 的写锁。
+func (c *Cache) setEvictionPolicy(name string) {
+	c.policyMu.Lock()
+	defer c.policyMu.Unlock()
+
+	if c.policy != nil && name == c.policyName {
+		return
+	}
+	c.policy = newEvictionPolicy(name)
+	c.policyName = name
+	for key := range c.entries {
+		c.policy.Add(key)
 	}
 }
 
@@ -688,38 +1557,90 @@ func (s *Server) OnConfigChange(oldConfig, newConfig *config.Config) {
 
 	log.Println("DNS Server: 检测到配置变更，开始处理...")
 
-	// 检查监听地址或网络类型是否发生变化 (当前只检查 Listen)
-	// TODO: 如果未来 config.ServerConfig 支持 Network 字段，也需要检查 oldConfig.Server.Network vs newConfig.Server.Network
-	listenChanged := oldConfig.Server.Listen != newConfig.Server.Listen
+	// 检查监听地址、网络类型或证书是否发生变化
+	listenChanged := oldConfig.Server.Listen != newConfig.Server.Listen ||
+		oldConfig.Server.ListenTCP != newConfig.Server.ListenTCP ||
+		oldConfig.Server.Network != newConfig.Server.Network ||
+		oldConfig.Server.TLSCert != newConfig.Server.TLSCert ||
+		oldConfig.Server.TLSKey != newConfig.Server.TLSKey
 
 	// 更新核心配置指针总是需要的
 	s.config = newConfig
 
 	// 更新其他依赖配置的组件
 	s.client.Timeout = newConfig.Upstream.Timeout
-	s.upstream = newConfig.Upstream.Server
+	s.upstream = newConfig.Upstream.PrimaryServer()
 	s.timeout = newConfig.Upstream.Timeout
+	s.splitHorizon = buildSplitHorizon(newConfig.SplitHorizon.Subnets)
+	s.resetResolvers()
+	s.resetCircuitBreakers()
+	s.upstreamRTT.setCandidates(latencyCandidates(&newConfig.Upstream))
+	if oldConfig.Server.MaxConcurrentQueries != newConfig.Server.MaxConcurrentQueries {
+		// 进行中的查询仍归还到旧信号量，新上限只约束此后到达的查询
+		s.querySlots.Store(newQuerySlots(newConfig.Server.MaxConcurrentQueries))
+		log.Printf("DNS Server: 并发查询上限已变更为 %d", newConfig.Server.MaxConcurrentQueries)
+	}
 
-	s.cidrMatcher.Clear()
-	if err := s.cidrMatcher.AddCIDRs(newConfig.CDNIPs); err != nil {
+	// 只增删发生变化的 CIDR，未变化的网段保留其添加时间和命中统计
+	newCIDRs := util.NewCIDRMatcher()
+	if err := newCIDRs.AddCIDRs(newConfig.CDNIPs); err != nil {
 		log.Printf("DNS Server: OnConfigChange 更新 CIDR 匹配器失败: %v", err)
 		// 根据策略，可能需要返回或标记服务为不稳定状态
 	}
+	added, removed := s.cidrMatcher.Diff(newCIDRs)
+	for _, cidr := range removed {
+		s.cidrMatcher.RemoveCIDR(cidr)
+	}
+	if err := s.cidrMatcher.AddCIDRs(added); err != nil {
+		log.Printf("DNS Server: OnConfigChange 更新 CIDR 匹配器失败: %v", err)
+	}
+	if len(added) > 0 || len(removed) > 0 {
+		log.Printf("DNS Server: CDN IP 段已变更，新增: %v, 移除: %v", added, removed)
+	}
 
-	s.domainMatcher.Clear()
+	// 整体替换域名模式，避免查询在替换过程中看到不完整的匹配器
+	patterns := make([]string, 0, len(newConfig.Domains))
 	for _, rule := range newConfig.Domains {
-		s.domainMatcher.AddPattern(rule.Pattern)
+		patterns = append(patterns, rule.Pattern)
+	}
+	for _, err := range s.domainMatcher.SetPatternsWithErrors(patterns) {
+		log.Printf("DNS Server: OnConfigChange 忽略无效的域名模式: %v", err)
 	}
 
 	s.cache.mu.Lock()
 	s.cache.maxSize = newConfig.Server.CacheSize
 	s.cache.ttl = newConfig.Server.CacheTTL
+	s.cache.negativeTTL = newConfig.Server.NegativeTTL
+	s.cache.staleTTL = staleTTL(&newConfig.Server)
+	s.cache.jitter = newConfig.Server.TTLJitterFactor
+	s.cache.setEvictionPolicy(newConfig.Cache.EvictionPolicy)
 	s.cache.mu.Unlock()
 
-	log.Printf("DNS Server: 内部配置已更新。新监听地址: %s, 上游 DNS: %s, CDN IP 数量: %d, 域名规则数量: %d", 
-		newConfig.Server.Listen, newConfig.Upstream.Server, len(newConfig.CDNIPs), len(newConfig.Domains))
+	s.queryLog.Resize(newConfig.Server.RecentQueriesSize)
+	s.negativeCacheMatcher.SetPatterns(newConfig.Server.ResponseCacheNegativeDomains)
+	s.dnsblMatcher.SetPatterns(newConfig.Server.DNSBLZones)
+	s.internalDomainMatcher.SetPatterns(newConfig.Server.InternalDomains)
+	if rpz, err := loadRPZConfig(&newConfig.Server); err != nil {
+		log.Printf("DNS Server: OnConfigChange 加载 RPZ 失败，继续使用原有规则: %v", err)
+	} else {
+		s.rpz.Store(rpz)
+	}
+	if oldConfig.Observability.OTelEndpoint != newConfig.Observability.OTelEndpoint {
+		if err := s.configureTracing(newConfig.Observability.OTelEndpoint); err != nil {
+			log.Printf("DNS Server: OnConfigChange 启用查询追踪失败: %v", err)
+		}
+	}
+	if err := s.configureStatsD(newConfig.Metrics.StatsDAddress); err != nil {
+		log.Printf("DNS Server: OnConfigChange 启用 StatsD 指标失败: %v", err)
+	}
+
+	log.Printf("DNS Server: 内部配置已更新。新监听地址: %s, 上游 DNS: %s, 域名规则数量: %d",
+		newConfig.Server.Listen, newConfig.Upstream.PrimaryServer(), len(newConfig.Domains))
 
-	if listenChanged {
+	if listenChanged && s.server != nil && onlyListenChanged(oldConfig, newConfig) {
+		// 只有监听地址变化时平滑迁移：新旧地址在宽限期内同时服务
+		s.migrateListener(newConfig.Server.MigrationGracePeriod)
+	} else if listenChanged {
 		log.Printf("DNS Server: 监听到地址从 '%s' 变为 '%s'。准备重启 DNS 服务...", oldConfig.Server.Listen, newConfig.Server.Listen)
 
 		// 1. 关闭当前服务器 (如果正在运行)
@@ -757,5 +1678,34 @@ func (s *Server) OnConfigChange(oldConfig, newConfig *config.Config) {
 		}
 	} else {
 		log.Println("DNS Server: 监听地址未更改，无需重启服务。配置已动态应用。")
+		// 缓冲区大小可以直接应用到当前套接字
+		if oldConfig.Server.ReadBufferSize != newConfig.Server.ReadBufferSize ||
+			oldConfig.Server.WriteBufferSize != newConfig.Server.WriteBufferSize {
+			if s.server != nil {
+				if conn, ok := s.server.PacketConn.(*net.UDPConn); ok {
+					applyUDPBufferSizes(conn, newConfig.Server.ReadBufferSize, newConfig.Server.WriteBufferSize)
+				}
+			}
+		}
+	}
+
+	// DoT 监听地址或证书变化时重启 DoT 服务
+	if oldConfig.Server.DoTListen != newConfig.Server.DoTListen ||
+		oldConfig.Server.TLSCert != newConfig.Server.TLSCert ||
+		oldConfig.Server.TLSKey != newConfig.Server.TLSKey {
+		s.stopDoTServer()
+		if err := s.startDoTServer(); err != nil {
+			log.Printf("DNS Server: OnConfigChange 启动 DoT 服务失败: %v", err)
+		}
+	}
+
+	// DoH 监听地址或证书变化时重启 DoH 服务
+	if oldConfig.Server.DoHListen != newConfig.Server.DoHListen ||
+		oldConfig.Server.TLSCert != newConfig.Server.TLSCert ||
+		oldConfig.Server.TLSKey != newConfig.Server.TLSKey {
+		s.stopDoHServer()
+		if err := s.startDoHServer(); err != nil {
+			log.Printf("DNS Server: OnConfigChange 启动 DoH 服务失败: %v", err)
+		}
 	}
 }
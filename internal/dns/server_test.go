@@ -1,11 +1,19 @@
 package dns
 
 import (
+	"context"
+	"fmt"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/hao/fxdns/internal/config"
+	"github.com/hao/fxdns/internal/metrics"
 	"github.com/hao/fxdns/internal/util"
 	"github.com/miekg/dns"
 )
@@ -262,3 +270,989 @@ func TestCacheOperations(t *testing.T) {
 		t.Error("过期的缓存项不应该命中")
 	}
 }
+
+// startTestUpstream 在本地随机端口启动一个测试用的上游 DNS 服务器，返回其地址
+func startTestUpstream(t *testing.T, handler dns.HandlerFunc) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("启动测试上游失败: %v", err)
+	}
+	started := make(chan struct{})
+	srv := &dns.Server{PacketConn: pc, Handler: handler, MsgAcceptFunc: msgAcceptFunc, NotifyStartedFunc: func() { close(started) }}
+	go srv.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { srv.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+// newTestServer 使用给定的 YAML 配置内容创建服务器（不启动监听）
+func newTestServer(t *testing.T, configContent string) *Server {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("创建测试配置文件失败: %v", err)
+	}
+	server, err := NewServer(configPath)
+	if err != nil {
+		t.Fatalf("创建服务器失败: %v", err)
+	}
+	return server
+}
+
+// answerA 构造一个包含单条 A 记录的应答
+func answerA(r *dns.Msg, ip string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Answer = append(m.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+		A:   net.ParseIP(ip),
+	})
+	return m
+}
+
+func TestFallbackTrigger(t *testing.T) {
+	const fallbackIP = "9.9.9.9"
+
+	testCases := []struct {
+		name       string
+		trigger    string
+		primary    func(r *dns.Msg) *dns.Msg
+		expectIP   string
+		expectCode int
+	}{
+		{
+			name:     "cdn_miss 未发现 CDN IP 时回退",
+			trigger:  config.FallbackTriggerCDNMiss,
+			primary:  func(r *dns.Msg) *dns.Msg { return answerA(r, "8.8.4.4") },
+			expectIP: fallbackIP,
+		},
+		{
+			name:     "cdn_miss 发现 CDN IP 时不回退",
+			trigger:  config.FallbackTriggerCDNMiss,
+			primary:  func(r *dns.Msg) *dns.Msg { return answerA(r, "10.1.1.1") },
+			expectIP: "10.1.1.1",
+		},
+		{
+			name:    "nxdomain 主上游返回 NXDOMAIN 时回退",
+			trigger: config.FallbackTriggerNXDomain,
+			primary: func(r *dns.Msg) *dns.Msg {
+				m := new(dns.Msg)
+				m.SetRcode(r, dns.RcodeNameError)
+				return m
+			},
+			expectIP: fallbackIP,
+		},
+		{
+			name:     "nxdomain 未发现 CDN IP 时返回主上游结果",
+			trigger:  config.FallbackTriggerNXDomain,
+			primary:  func(r *dns.Msg) *dns.Msg { return answerA(r, "8.8.4.4") },
+			expectIP: "8.8.4.4",
+		},
+		{
+			name:    "error 主上游 SERVFAIL 时回退",
+			trigger: config.FallbackTriggerError,
+			primary: func(r *dns.Msg) *dns.Msg {
+				m := new(dns.Msg)
+				m.SetRcode(r, dns.RcodeServerFailure)
+				return m
+			},
+			expectIP: fallbackIP,
+		},
+		{
+			name:    "error 主上游 NXDOMAIN 时不回退",
+			trigger: config.FallbackTriggerError,
+			primary: func(r *dns.Msg) *dns.Msg {
+				m := new(dns.Msg)
+				m.SetRcode(r, dns.RcodeNameError)
+				return m
+			},
+			expectCode: dns.RcodeNameError,
+		},
+		{
+			name:     "always 主上游正常时优先使用主上游",
+			trigger:  config.FallbackTriggerAlways,
+			primary:  func(r *dns.Msg) *dns.Msg { return answerA(r, "10.1.1.1") },
+			expectIP: "10.1.1.1",
+		},
+		{
+			name:    "always 主上游 SERVFAIL 时使用备用上游",
+			trigger: config.FallbackTriggerAlways,
+			primary: func(r *dns.Msg) *dns.Msg {
+				m := new(dns.Msg)
+				m.SetRcode(r, dns.RcodeServerFailure)
+				return m
+			},
+			expectIP: fallbackIP,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			primary := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+				w.WriteMsg(tc.primary(r))
+			})
+			fallback := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+				w.WriteMsg(answerA(r, fallbackIP))
+			})
+
+			server := newTestServer(t, `
+upstream:
+  server: "`+primary+`"
+  fallback_server: "`+fallback+`"
+  fallback_trigger: "`+tc.trigger+`"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    strategy: "filter_non_cdn"
+`)
+
+			req := new(dns.Msg)
+			req.SetQuestion("www.example.com.", dns.TypeA)
+			w := &mockResponseWriter{}
+			server.ServeDNS(w, req)
+
+			if w.msg == nil {
+				t.Fatal("未收到响应")
+			}
+			if w.msg.Rcode != tc.expectCode {
+				t.Errorf("RCODE 错误, 期望: %d, 实际: %d", tc.expectCode, w.msg.Rcode)
+			}
+			if tc.expectIP == "" {
+				return
+			}
+			if len(w.msg.Answer) == 0 {
+				t.Fatal("响应中没有记录")
+			}
+			a, ok := w.msg.Answer[0].(*dns.A)
+			if !ok || a.A.String() != tc.expectIP {
+				t.Errorf("响应记录错误, 期望: %s, 实际: %v", tc.expectIP, w.msg.Answer[0])
+			}
+		})
+	}
+}
+
+func TestListenAddr(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answerA(r, "10.1.1.1"))
+	})
+
+	for _, network := range []string{"udp", "tcp"} {
+		t.Run(network, func(t *testing.T) {
+			server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  network: "`+network+`"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+			if addr := server.ListenAddr(); addr != "" {
+				t.Errorf("启动前 ListenAddr 应为空, 实际: %s", addr)
+			}
+			if err := server.Start(); err != nil {
+				t.Fatalf("启动服务器失败: %v", err)
+			}
+			defer server.Stop()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+			if err := server.WaitReady(ctx); err != nil {
+				t.Fatalf("等待服务器就绪失败: %v", err)
+			}
+
+			addr := server.ListenAddr()
+			_, port, err := net.SplitHostPort(addr)
+			if err != nil || port == "0" {
+				t.Fatalf("ListenAddr 应返回实际绑定的端口, 实际: %q", addr)
+			}
+
+			req := new(dns.Msg)
+			req.SetQuestion("www.example.com.", dns.TypeA)
+			client := &dns.Client{Net: network, Timeout: 2 * time.Second}
+			resp, _, err := client.Exchange(req, addr)
+			if err != nil {
+				t.Fatalf("向 %s 查询失败: %v", addr, err)
+			}
+			if len(resp.Answer) != 1 {
+				t.Errorf("响应记录数量错误, 期望: 1, 实际: %d", len(resp.Answer))
+			}
+		})
+	}
+}
+
+func TestFallbackStrategy(t *testing.T) {
+	const (
+		primaryIP  = "1.2.3.4"
+		fallbackIP = "9.9.9.9"
+	)
+
+	testCases := []struct {
+		strategy   string
+		expectCode int
+		expectIP   string
+	}{
+		{"", dns.RcodeSuccess, fallbackIP},
+		{config.FallbackStrategyUseFallback, dns.RcodeSuccess, fallbackIP},
+		{config.FallbackStrategyReturnPrimary, dns.RcodeSuccess, primaryIP},
+		{config.FallbackStrategyReturnEmpty, dns.RcodeSuccess, ""},
+		{config.FallbackStrategyNXDomain, dns.RcodeNameError, ""},
+	}
+
+	primary := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answerA(r, primaryIP))
+	})
+	fallback := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answerA(r, fallbackIP))
+	})
+
+	for _, tc := range testCases {
+		t.Run("strategy="+tc.strategy, func(t *testing.T) {
+			server := newTestServer(t, `
+upstream:
+  server: "`+primary+`"
+  fallback_server: "`+fallback+`"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    strategy: "filter_non_cdn"
+    fallback_strategy: "`+tc.strategy+`"
+`)
+
+			req := new(dns.Msg)
+			req.SetQuestion("www.example.com.", dns.TypeA)
+			w := &mockResponseWriter{}
+			server.ServeDNS(w, req)
+
+			if w.msg == nil {
+				t.Fatal("未收到响应")
+			}
+			if w.msg.Rcode != tc.expectCode {
+				t.Errorf("RCODE 错误, 期望: %d, 实际: %d", tc.expectCode, w.msg.Rcode)
+			}
+			if tc.expectIP == "" {
+				if len(w.msg.Answer) != 0 {
+					t.Errorf("响应应不含记录, 实际: %v", w.msg.Answer)
+				}
+				return
+			}
+			if len(w.msg.Answer) != 1 {
+				t.Fatalf("响应记录数量错误, 期望: 1, 实际: %d", len(w.msg.Answer))
+			}
+			if a, ok := w.msg.Answer[0].(*dns.A); !ok || a.A.String() != tc.expectIP {
+				t.Errorf("响应记录错误, 期望: %s, 实际: %v", tc.expectIP, w.msg.Answer[0])
+			}
+		})
+	}
+}
+
+func TestMinCDNIPs(t *testing.T) {
+	const fallbackIP = "9.9.9.9"
+
+	testCases := []struct {
+		name     string
+		answers  []string
+		expected []string
+	}{
+		{"一个 CDN IP 时回退", []string{"10.1.1.1", "1.2.3.4"}, []string{fallbackIP}},
+		{"两个 CDN IP 时过滤", []string{"10.1.1.1", "10.2.2.2", "1.2.3.4"}, []string{"10.1.1.1", "10.2.2.2"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			primary := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+				m := new(dns.Msg)
+				m.SetReply(r)
+				for _, ip := range tc.answers {
+					m.Answer = append(m.Answer, answerA(r, ip).Answer...)
+				}
+				w.WriteMsg(m)
+			})
+			fallback := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+				w.WriteMsg(answerA(r, fallbackIP))
+			})
+
+			server := newTestServer(t, `
+upstream:
+  server: "`+primary+`"
+  fallback_server: "`+fallback+`"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    strategy: "filter_non_cdn"
+    min_cdnips: 2
+`)
+
+			req := new(dns.Msg)
+			req.SetQuestion("www.example.com.", dns.TypeA)
+			w := &mockResponseWriter{}
+			server.ServeDNS(w, req)
+
+			if w.msg == nil {
+				t.Fatal("未收到响应")
+			}
+			var got []string
+			for _, rr := range w.msg.Answer {
+				if a, ok := rr.(*dns.A); ok {
+					got = append(got, a.A.String())
+				}
+			}
+			if len(got) != len(tc.expected) {
+				t.Fatalf("响应记录错误, 期望: %v, 实际: %v", tc.expected, got)
+			}
+			for i := range got {
+				if got[i] != tc.expected[i] {
+					t.Errorf("响应记录错误, 期望: %v, 实际: %v", tc.expected, got)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestResponseTTLMultiplier(t *testing.T) {
+	// 上游返回的 A 记录 TTL 为 300
+	testCases := []struct {
+		name     string
+		rule     string
+		expected uint32
+	}{
+		{"未配置时不调整", "", 300},
+		{"减半", "response_ttl_multiplier: 0.5", 150},
+		{"加倍", "response_ttl_multiplier: 2.0", 600},
+		{"不足下限时取 min_ttl", "response_ttl_multiplier: 0.1\n    min_ttl: 60", 60},
+		{"超过上限时取 max_ttl", "response_ttl_multiplier: 3\n    max_ttl: 500", 500},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+				m := answerA(r, "10.1.1.1")
+				m.Answer = append(m.Answer, answerA(r, "1.2.3.4").Answer...)
+				w.WriteMsg(m)
+			})
+			server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    strategy: "filter_non_cdn"
+    `+tc.rule+`
+`)
+
+			// 第二次查询命中缓存，TTL 应与首次一致
+			for i := 0; i < 2; i++ {
+				req := new(dns.Msg)
+				req.SetQuestion("www.example.com.", dns.TypeA)
+				w := &mockResponseWriter{}
+				server.ServeDNS(w, req)
+
+				if w.msg == nil || len(w.msg.Answer) != 1 {
+					t.Fatalf("过滤后应只保留 CDN IP: %v", w.msg)
+				}
+				if ttl := w.msg.Answer[0].Header().Ttl; ttl != tc.expected {
+					t.Errorf("第 %d 次查询 TTL 错误, 期望: %d, 实际: %d", i+1, tc.expected, ttl)
+				}
+			}
+		})
+	}
+}
+
+func TestServerUptime(t *testing.T) {
+	server := newTestServer(t, `
+upstream:
+  server: "127.0.0.1:53"
+server:
+  listen: "127.0.0.1:0"
+  workers: 1
+  cache_size: 10
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+	if uptime := server.Uptime(); uptime != 0 {
+		t.Errorf("启动前 Uptime 应为 0, 实际: %v", uptime)
+	}
+	if err := server.Start(); err != nil {
+		t.Fatalf("启动服务器失败: %v", err)
+	}
+	defer server.Stop()
+
+	time.Sleep(100 * time.Millisecond)
+	if uptime := server.Uptime(); uptime < 100*time.Millisecond {
+		t.Errorf("Uptime 错误, 期望 >= 100ms, 实际: %v", uptime)
+	}
+	if status := server.Status(); status.UptimeSeconds < 0.1 {
+		t.Errorf("状态中的运行时长错误, 期望 >= 0.1, 实际: %v", status.UptimeSeconds)
+	}
+}
+
+func TestWaitReadyStartFailure(t *testing.T) {
+	// 先占用一个端口，使服务器绑定失败
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("占用端口失败: %v", err)
+	}
+	defer pc.Close()
+
+	server := newTestServer(t, `
+upstream:
+  server: "127.0.0.1:53"
+server:
+  listen: "`+pc.LocalAddr().String()+`"
+  workers: 1
+  cache_size: 10
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+	if err := server.Start(); err != nil {
+		t.Fatalf("启动服务器失败: %v", err)
+	}
+	defer server.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := server.WaitReady(ctx); err == nil || err == context.DeadlineExceeded {
+		t.Errorf("端口被占用时 WaitReady 应返回绑定错误, 实际: %v", err)
+	}
+}
+
+func TestNegativeCacheDomains(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeNameError)
+		w.WriteMsg(m)
+	})
+
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 2s
+  fallback_trigger: "error"
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+  negative_ttl: 1h
+  response_cache_negative_domains:
+    - "*.corp.internal"
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+
+	expireAt := func(name string) time.Duration {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		w := &mockResponseWriter{}
+		server.ServeDNS(w, req)
+		if w.msg == nil || w.msg.Rcode != dns.RcodeNameError {
+			t.Fatalf("%s 应返回 NXDOMAIN, 实际: %v", name, w.msg)
+		}
+		entry, ok := server.cache.entries[req.Question[0].String()]
+		if !ok {
+			t.Fatalf("%s 的 NXDOMAIN 响应未被缓存", name)
+		}
+		return time.Until(entry.softExpireAt)
+	}
+
+	if ttl := expireAt("host.corp.internal."); ttl <= 10*time.Minute {
+		t.Errorf("匹配的域名应按 negative_ttl 缓存, 实际剩余: %v", ttl)
+	}
+	if ttl := expireAt("missing.example.com."); ttl > time.Minute {
+		t.Errorf("未匹配的域名应按 cache_ttl 缓存, 实际剩余: %v", ttl)
+	}
+}
+
+func TestNegativeCacheSOAMinimum(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeNameError)
+		switch r.Question[0].Name {
+		case "short.corp.internal.":
+			soa, _ := dns.NewRR("corp.internal. 3600 IN SOA ns1.corp.internal. admin.corp.internal. 1 3600 600 86400 30")
+			m.Ns = []dns.RR{soa}
+		case "long.corp.internal.":
+			soa, _ := dns.NewRR("corp.internal. 3600 IN SOA ns1.corp.internal. admin.corp.internal. 1 3600 600 86400 86400")
+			m.Ns = []dns.RR{soa}
+		}
+		w.WriteMsg(m)
+	})
+
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 2s
+  fallback_trigger: "error"
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+  negative_ttl: 1h
+  response_cache_negative_domains:
+    - "*.corp.internal"
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+
+	expireAt := func(name string) time.Duration {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		w := &mockResponseWriter{}
+		server.ServeDNS(w, req)
+		if w.msg == nil || w.msg.Rcode != dns.RcodeNameError {
+			t.Fatalf("%s 应返回 NXDOMAIN, 实际: %v", name, w.msg)
+		}
+		entry, ok := server.cache.entries[req.Question[0].String()]
+		if !ok {
+			t.Fatalf("%s 的 NXDOMAIN 响应未被缓存", name)
+		}
+		return time.Until(entry.softExpireAt)
+	}
+
+	if ttl := expireAt("short.corp.internal."); ttl > 30*time.Second || ttl < 25*time.Second {
+		t.Errorf("SOA MINIMUM 小于 negative_ttl 时应按 MINIMUM 缓存, 实际剩余: %v", ttl)
+	}
+	if ttl := expireAt("long.corp.internal."); ttl > time.Hour || ttl < 59*time.Minute {
+		t.Errorf("SOA MINIMUM 大于 negative_ttl 时应按 negative_ttl 缓存, 实际剩余: %v", ttl)
+	}
+	if ttl := expireAt("nosoa.corp.internal."); ttl > time.Hour || ttl < 59*time.Minute {
+		t.Errorf("没有 SOA 时应按 negative_ttl 缓存, 实际剩余: %v", ttl)
+	}
+}
+
+func TestUpstreamCDBit(t *testing.T) {
+	seen := make(chan bool, 1)
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		seen <- r.CheckingDisabled
+		// SetReply 会回显请求中的 CD 位
+		w.WriteMsg(answerA(r, "10.1.1.1"))
+	})
+
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  cd_bit: true
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	w := &mockResponseWriter{}
+	server.ServeDNS(w, req)
+
+	if !<-seen {
+		t.Error("发往上游的查询应设置 CD 位")
+	}
+	if req.CheckingDisabled {
+		t.Error("客户端原始请求不应被修改")
+	}
+	if w.msg == nil {
+		t.Fatal("未收到响应")
+	}
+	if w.msg.CheckingDisabled {
+		t.Error("返回给客户端的响应不应带有为上游设置的 CD 位")
+	}
+
+	// 缓存命中时同样不应带有 CD 位
+	w = &mockResponseWriter{}
+	server.ServeDNS(w, req)
+	if w.msg == nil || w.msg.CheckingDisabled {
+		t.Errorf("缓存响应的 CD 位错误: %v", w.msg)
+	}
+}
+
+func TestJSONDoHUpstream(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("name") != "www.example.com." {
+			http.Error(w, "unexpected name", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"Status": 0, "RD": true, "RA": true, "Answer": [
+  {"name": "www.example.com", "type": 1, "TTL": 120, "data": "10.1.1.1"},
+  {"name": "www.example.com", "type": 1, "TTL": 120, "data": "1.2.3.4"}]}`))
+	}))
+	defer ts.Close()
+
+	server := newTestServer(t, `
+upstream:
+  protocol: "json-doh"
+  json_doh_url: "`+ts.URL+`/resolve"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    strategy: "filter_non_cdn"
+`)
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	w := &mockResponseWriter{}
+	server.ServeDNS(w, req)
+
+	if w.msg == nil || len(w.msg.Answer) != 1 {
+		t.Fatalf("应只返回 CDN IP: %v", w.msg)
+	}
+	if a, ok := w.msg.Answer[0].(*dns.A); !ok || a.A.String() != "10.1.1.1" {
+		t.Errorf("响应记录错误: %v", w.msg.Answer[0])
+	}
+}
+
+func TestForceAOnly(t *testing.T) {
+	var queried []uint16
+	var mu sync.Mutex
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		mu.Lock()
+		queried = append(queried, r.Question[0].Qtype)
+		mu.Unlock()
+		w.WriteMsg(answerA(r, "10.1.1.1"))
+	})
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    strategy: "filter_non_cdn"
+    force_a_only: true
+`)
+
+	suppressed := metrics.AAAASuppressCount.Value()
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeAAAA)
+	w := &mockResponseWriter{}
+	server.ServeDNS(w, req)
+	if w.msg == nil || w.msg.Rcode != dns.RcodeSuccess || len(w.msg.Answer) != 0 {
+		t.Fatalf("AAAA 查询应返回空的 NOERROR 响应: %v", w.msg)
+	}
+	if got := metrics.AAAASuppressCount.Value() - suppressed; got != 1 {
+		t.Errorf("AAAASuppressCount 增量错误, 期望: 1, 实际: %d", got)
+	}
+
+	req = new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	w = &mockResponseWriter{}
+	server.ServeDNS(w, req)
+	if w.msg == nil || len(w.msg.Answer) != 1 {
+		t.Fatalf("A 查询应正常转发: %v", w.msg)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(queried) != 1 || queried[0] != dns.TypeA {
+		t.Errorf("上游收到的查询错误, 期望只有 A, 实际: %v", queried)
+	}
+}
+
+func TestMergeResponses(t *testing.T) {
+	primary := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := answerA(r, "10.1.1.1")
+		m.Answer = append(m.Answer, answerA(r, "1.2.3.4").Answer...)
+		w.WriteMsg(m)
+	})
+	// 只有备用上游返回 10.2.2.2
+	fallback := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := answerA(r, "10.2.2.2")
+		m.Answer = append(m.Answer, answerA(r, "10.1.1.1").Answer...)
+		w.WriteMsg(m)
+	})
+
+	server := newTestServer(t, `
+upstream:
+  server: "`+primary+`"
+  fallback_server: "`+fallback+`"
+  merge_responses: true
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    strategy: "filter_non_cdn"
+`)
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	w := &mockResponseWriter{}
+	server.ServeDNS(w, req)
+	if w.msg == nil {
+		t.Fatal("未收到响应")
+	}
+
+	got := make(map[string]int)
+	for _, rr := range w.msg.Answer {
+		if a, ok := rr.(*dns.A); ok {
+			got[a.A.String()]++
+		}
+	}
+	if len(got) != 2 || got["10.1.1.1"] != 1 || got["10.2.2.2"] != 1 {
+		t.Errorf("应返回去重合并后的 CDN IP, 实际: %v", got)
+	}
+}
+
+func TestValidateResponses(t *testing.T) {
+	// 主上游返回 0.0.0.0，备用上游返回正常结果
+	primary := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answerA(r, "0.0.0.0"))
+	})
+	fallback := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answerA(r, "10.2.2.2"))
+	})
+
+	testCases := []struct {
+		name       string
+		validate   bool
+		fallback   string
+		expectIP   string
+		expectCode int
+	}{
+		{"未开启时返回主上游结果", false, fallback, "0.0.0.0", dns.RcodeSuccess},
+		{"开启后改用备用上游", true, fallback, "10.2.2.2", dns.RcodeSuccess},
+		{"开启且无备用上游时返回 SERVFAIL", true, "", "", dns.RcodeServerFailure},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// fallback_trigger 为 nxdomain，仅检查未通过时才会回退
+			server := newTestServer(t, fmt.Sprintf(`
+upstream:
+  server: "%s"
+  fallback_server: "%s"
+  fallback_trigger: "nxdomain"
+  validate_responses: %v
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    strategy: "filter_non_cdn"
+    fallback_strategy: "return_primary"
+`, primary, tc.fallback, tc.validate))
+
+			invalid := metrics.InvalidResponseCount.Value()
+
+			req := new(dns.Msg)
+			req.SetQuestion("www.example.com.", dns.TypeA)
+			w := &mockResponseWriter{}
+			server.ServeDNS(w, req)
+			if w.msg == nil {
+				t.Fatal("未收到响应")
+			}
+			if w.msg.Rcode != tc.expectCode {
+				t.Fatalf("RCODE 错误, 期望: %d, 实际: %d", tc.expectCode, w.msg.Rcode)
+			}
+			if tc.expectIP != "" {
+				if len(w.msg.Answer) != 1 || w.msg.Answer[0].(*dns.A).A.String() != tc.expectIP {
+					t.Errorf("应答错误, 期望: %s, 实际: %v", tc.expectIP, w.msg.Answer)
+				}
+			}
+
+			expectInvalid := uint64(0)
+			if tc.validate {
+				expectInvalid = 1
+			}
+			if got := metrics.InvalidResponseCount.Value() - invalid; got != expectInvalid {
+				t.Errorf("InvalidResponseCount 增量错误, 期望: %d, 实际: %d", expectInvalid, got)
+			}
+		})
+	}
+}
+
+func TestConcurrentQueriesKeepOwnID(t *testing.T) {
+	upstreamAddr := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		time.Sleep(20 * time.Millisecond)
+		w.WriteMsg(answerA(r, "198.51.100.1"))
+	})
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstreamAddr+`"
+  timeout: 2s
+server:
+  listen: "127.0.0.1:0"
+  workers: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+
+	// 第一轮同时查询上游，第二轮同时命中缓存，每个客户端都应收到带有自己事务 ID 的响应
+	for round := 0; round < 2; round++ {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(id uint16) {
+				defer wg.Done()
+				req := new(dns.Msg)
+				req.SetQuestion("www.example.com.", dns.TypeA)
+				req.Id = id
+				w := &mockResponseWriter{}
+				server.ServeDNS(w, req)
+				if w.msg == nil {
+					t.Errorf("查询 %d 没有返回响应", id)
+					return
+				}
+				if w.msg.Id != id {
+					t.Errorf("第 %d 轮: 查询 ID %d 收到的响应 ID 为 %d", round+1, id, w.msg.Id)
+				}
+			}(uint16(1000*(round+1) + i))
+		}
+		wg.Wait()
+	}
+}
+
+func TestQtypeFilter(t *testing.T) {
+	// 任何类型的查询都返回一个 CDN IP 与一个非 CDN IP
+	upstreamAddr := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := answerA(r, "10.0.0.1")
+		m.Answer = append(m.Answer, answerA(r, "8.8.8.8").Answer...)
+		if r.Question[0].Qtype == dns.TypeMX {
+			m.Answer = append([]dns.RR{&dns.MX{
+				Hdr:        dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeMX, Class: dns.ClassINET, Ttl: 300},
+				Preference: 10,
+				Mx:         r.Question[0].Name,
+			}}, m.Answer...)
+		}
+		w.WriteMsg(m)
+	})
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstreamAddr+`"
+  timeout: 2s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    strategy: "filter_non_cdn"
+    qtype_filter: ["A"]
+`)
+
+	query := func(qtype uint16) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion("www.example.com.", qtype)
+		w := &mockResponseWriter{}
+		server.ServeDNS(w, req)
+		if w.msg == nil {
+			t.Fatalf("%s 查询没有返回响应", dns.TypeToString[qtype])
+		}
+		return w.msg
+	}
+
+	if resp := query(dns.TypeA); len(resp.Answer) != 1 {
+		t.Errorf("A 查询应过滤非 CDN IP, 实际: %v", resp.Answer)
+	}
+	// MX 不在 qtype_filter 中，上游响应原样返回
+	if resp := query(dns.TypeMX); len(resp.Answer) != 3 {
+		t.Errorf("MX 查询不应被规则处理, 实际: %v", resp.Answer)
+	}
+}
+
+func TestRegexRuleStrategy(t *testing.T) {
+	upstreamAddr := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := answerA(r, "10.0.0.1")
+		m.Answer = append(m.Answer, answerA(r, "8.8.8.8").Answer...)
+		w.WriteMsg(m)
+	})
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstreamAddr+`"
+  timeout: 2s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: 're:^(img|static)\.example\.com$'
+    strategy: "return_cdn_a"
+    ttl: 42
+`)
+
+	query := func(name string) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		w := &mockResponseWriter{}
+		server.ServeDNS(w, req)
+		if w.msg == nil {
+			t.Fatalf("%s 查询没有返回响应", name)
+		}
+		return w.msg
+	}
+
+	// re: 规则命中时按 return_cdn_a 直接返回 CDN A 记录，TTL 取自规则
+	resp := query("img.example.com.")
+	if len(resp.Answer) != 1 || resp.Answer[0].Header().Ttl != 42 {
+		t.Errorf("re: 规则应按 return_cdn_a 处理, 实际: %v", resp.Answer)
+	}
+	// 未命中正则的域名保持上游响应
+	resp = query("www.example.com.")
+	if len(resp.Answer) != 2 || resp.Answer[0].Header().Ttl != 300 {
+		t.Errorf("未命中规则的域名不应按 return_cdn_a 处理, 实际: %v", resp.Answer)
+	}
+}
@@ -0,0 +1,45 @@
+package dns
+
+import (
+	"strings"
+
+	"github.com/hao/fxdns/internal/util"
+	"github.com/miekg/dns"
+)
+
+// syntheticSOA 返回 qname 匹配的域名规则 synthetic_soa 对应的 SOA 记录，未配置时返回 nil。
+// 所有者名为规则的域名（泛域名去掉 *.），正则规则没有固定的区域，使用查询名；
+// 记录的 TTL 取 minimum，使客户端按 RFC 2308 以此时长缓存否定应答
+func (s *Server) syntheticSOA(qname string) *dns.SOA {
+	rule := s.config.GetDomainRule(normalizeDomain(qname))
+	if rule == nil || rule.SyntheticSOA == nil {
+		return nil
+	}
+	soa := rule.SyntheticSOA.WithDefaults()
+
+	owner := dns.Fqdn(qname)
+	if !strings.HasPrefix(rule.Pattern, util.RegexPatternPrefix) {
+		owner = dns.Fqdn(strings.TrimPrefix(rule.Pattern, "*."))
+	}
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: owner, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: soa.Minimum},
+		Ns:      dns.Fqdn(soa.MName),
+		Mbox:    dns.Fqdn(soa.RName),
+		Serial:  soa.Serial,
+		Refresh: soa.Refresh,
+		Retry:   soa.Retry,
+		Expire:  soa.Expire,
+		Minttl:  soa.Minimum,
+	}
+}
+
+// extractSOAMinimum 返回响应授权段中第一条 SOA 记录的 MINIMUM 字段，即 RFC 2308 规定的否定应答缓存时长（秒），
+// 授权段没有 SOA 记录时返回 false
+func extractSOAMinimum(resp *dns.Msg) (uint32, bool) {
+	for _, rr := range resp.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Minttl, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,89 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestSyntheticSOA(t *testing.T) {
+	primary := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answerA(r, "1.2.3.4"))
+	})
+	server := newTestServer(t, `
+upstream:
+  server: "`+primary+`"
+  timeout: 2s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    strategy: "filter_non_cdn"
+    fallback_strategy: "nxdomain"
+    synthetic_soa:
+      mname: "ns1.example.com"
+      rname: "dns-admin.example.com."
+      serial: 2024010101
+      minimum: 60
+  - pattern: "*.example.net"
+    strategy: "filter_non_cdn"
+    fallback_strategy: "nxdomain"
+`)
+
+	query := func(name string) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		w := &mockResponseWriter{}
+		server.ServeDNS(w, req)
+		if w.msg == nil {
+			t.Fatalf("%s 没有返回响应", name)
+		}
+		if w.msg.Rcode != dns.RcodeNameError {
+			t.Fatalf("%s 期望 NXDOMAIN, 实际: %s", name, dns.RcodeToString[w.msg.Rcode])
+		}
+		return w.msg
+	}
+
+	resp := query("www.example.com.")
+	if len(resp.Ns) != 1 {
+		t.Fatalf("授权段应包含 1 条 SOA 记录, 实际: %v", resp.Ns)
+	}
+	soa, ok := resp.Ns[0].(*dns.SOA)
+	if !ok {
+		t.Fatalf("授权段记录应为 SOA, 实际: %v", resp.Ns[0])
+	}
+	if soa.Hdr.Name != "example.com." {
+		t.Errorf("SOA 所有者名期望 example.com., 实际: %s", soa.Hdr.Name)
+	}
+	if soa.Ns != "ns1.example.com." || soa.Mbox != "dns-admin.example.com." || soa.Serial != 2024010101 {
+		t.Errorf("SOA 应使用规则中的 mname/rname/serial, 实际: %v", soa)
+	}
+	if soa.Minttl != 60 || soa.Hdr.Ttl != 60 {
+		t.Errorf("SOA 的 minimum 与 TTL 期望 60, 实际: %d / %d", soa.Minttl, soa.Hdr.Ttl)
+	}
+	// 未设置的字段使用默认值
+	if soa.Refresh != 3600 || soa.Retry != 600 || soa.Expire != 86400 {
+		t.Errorf("未设置的字段应使用默认值, 实际: %v", soa)
+	}
+
+	if resp := query("www.example.net."); len(resp.Ns) != 0 {
+		t.Errorf("未配置 synthetic_soa 的规则不应附带 SOA, 实际: %v", resp.Ns)
+	}
+}
+
+func TestExtractSOAMinimum(t *testing.T) {
+	resp := new(dns.Msg)
+	if _, ok := extractSOAMinimum(resp); ok {
+		t.Error("授权段没有 SOA 时应返回 false")
+	}
+
+	ns, _ := dns.NewRR("example.com. 300 IN NS ns1.example.com.")
+	soa, _ := dns.NewRR("example.com. 300 IN SOA ns1.example.com. admin.example.com. 1 3600 600 86400 120")
+	resp.Ns = []dns.RR{ns, soa}
+	if minimum, ok := extractSOAMinimum(resp); !ok || minimum != 120 {
+		t.Errorf("SOA MINIMUM 期望 120, 实际 %d (%v)", minimum, ok)
+	}
+}
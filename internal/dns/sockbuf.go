@@ -0,0 +1,33 @@
+package dns
+
+import (
+	"log"
+	"net"
+)
+
+// applyUDPBufferSizes 为 UDP 套接字设置收发缓冲区大小（字节），值为 0 时保持系统默认。
+// 如果系统实际分配的缓冲区小于请求值（例如受 net.core.rmem_max 限制），打印警告日志。
+func applyUDPBufferSizes(conn *net.UDPConn, readSize, writeSize int) {
+	if readSize > 0 {
+		if err := conn.SetReadBuffer(readSize); err != nil {
+			log.Printf("DNS Server: 设置 UDP 读缓冲区 %d 字节失败: %v", readSize, err)
+		}
+	}
+	if writeSize > 0 {
+		if err := conn.SetWriteBuffer(writeSize); err != nil {
+			log.Printf("DNS Server: 设置 UDP 写缓冲区 %d 字节失败: %v", writeSize, err)
+		}
+	}
+
+	actualRead, actualWrite, err := socketBufferSizes(conn)
+	if err != nil {
+		log.Printf("DNS Server: 无法读取 UDP 缓冲区实际大小: %v", err)
+		return
+	}
+	if readSize > 0 && actualRead < readSize {
+		log.Printf("DNS Server: 警告: 系统拒绝了请求的 UDP 读缓冲区大小, 请求: %d, 实际: %d", readSize, actualRead)
+	}
+	if writeSize > 0 && actualWrite < writeSize {
+		log.Printf("DNS Server: 警告: 系统拒绝了请求的 UDP 写缓冲区大小, 请求: %d, 实际: %d", writeSize, actualWrite)
+	}
+}
@@ -0,0 +1,46 @@
+//go:build !windows
+
+package dns
+
+import (
+	"net"
+	"testing"
+)
+
+func TestApplyUDPBufferSizes(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听 UDP 失败: %v", err)
+	}
+	defer pc.Close()
+	conn := pc.(*net.UDPConn)
+
+	beforeRead, beforeWrite, err := socketBufferSizes(conn)
+	if err != nil {
+		t.Fatalf("读取缓冲区大小失败: %v", err)
+	}
+
+	// 选择一个与默认值不同且通常不超过系统上限的大小
+	readSize := beforeRead/2 + 4096
+	writeSize := beforeWrite/2 + 4096
+	applyUDPBufferSizes(conn, readSize, writeSize)
+
+	actualRead, actualWrite, err := socketBufferSizes(conn)
+	if err != nil {
+		t.Fatalf("读取缓冲区大小失败: %v", err)
+	}
+	// Linux 内核会将请求值翻倍以预留管理开销，这里只要求不小于请求值
+	if actualRead < readSize || actualRead == beforeRead {
+		t.Errorf("读缓冲区未生效, 请求: %d, 之前: %d, 实际: %d", readSize, beforeRead, actualRead)
+	}
+	if actualWrite < writeSize || actualWrite == beforeWrite {
+		t.Errorf("写缓冲区未生效, 请求: %d, 之前: %d, 实际: %d", writeSize, beforeWrite, actualWrite)
+	}
+
+	// 0 表示保持当前值不变
+	applyUDPBufferSizes(conn, 0, 0)
+	read, write, _ := socketBufferSizes(conn)
+	if read != actualRead || write != actualWrite {
+		t.Errorf("大小为 0 时不应修改缓冲区, 之前: %d/%d, 之后: %d/%d", actualRead, actualWrite, read, write)
+	}
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+
+package dns
+
+import (
+	"net"
+	"syscall"
+)
+
+// socketBufferSizes 读取套接字当前的收发缓冲区大小
+func socketBufferSizes(conn *net.UDPConn) (int, int, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var readSize, writeSize int
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		readSize, sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+		if sockErr != nil {
+			return
+		}
+		writeSize, sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return readSize, writeSize, sockErr
+}
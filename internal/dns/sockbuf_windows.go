@@ -0,0 +1,13 @@
+//go:build windows
+
+package dns
+
+import (
+	"errors"
+	"net"
+)
+
+// socketBufferSizes 在 Windows 上不支持读取缓冲区实际大小
+func socketBufferSizes(conn *net.UDPConn) (int, int, error) {
+	return 0, 0, errors.New("当前平台不支持读取套接字缓冲区大小")
+}
@@ -0,0 +1,50 @@
+package dns
+
+import (
+	"log"
+	"net"
+	"sort"
+)
+
+// splitHorizonRoute 分区解析的一条路由：来自该子网的客户端使用指定的上游
+type splitHorizonRoute struct {
+	subnet   *net.IPNet
+	upstream string
+}
+
+// buildSplitHorizon 根据 split_horizon.subnets 构建路由表，按前缀长度从长到短排序
+func buildSplitHorizon(subnets map[string]string) []splitHorizonRoute {
+	routes := make([]splitHorizonRoute, 0, len(subnets))
+	for cidr, upstream := range subnets {
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Printf("DNS Server: 忽略无效的 split_horizon 子网 %s: %v", cidr, err)
+			continue
+		}
+		routes = append(routes, splitHorizonRoute{subnet: subnet, upstream: upstream})
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		oi, _ := routes[i].subnet.Mask.Size()
+		oj, _ := routes[j].subnet.Mask.Size()
+		if oi != oj {
+			return oi > oj
+		}
+		return routes[i].subnet.String() < routes[j].subnet.String()
+	})
+	return routes
+}
+
+// upstreamForClient 返回客户端应使用的主上游：命中 split_horizon 子网时使用对应上游，否则使用全局上游
+func (s *Server) upstreamForClient(clientIP net.IP) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if clientIP != nil {
+		for _, route := range s.splitHorizon {
+			if route.subnet.Contains(clientIP) {
+				return route.upstream
+			}
+		}
+	}
+	return s.upstream
+}
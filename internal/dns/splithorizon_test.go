@@ -0,0 +1,106 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// remoteAddrWriter 使用指定客户端地址的 mockResponseWriter
+type remoteAddrWriter struct {
+	mockResponseWriter
+	remote net.Addr
+}
+
+func (w *remoteAddrWriter) RemoteAddr() net.Addr { return w.remote }
+
+func TestBuildSplitHorizon(t *testing.T) {
+	routes := buildSplitHorizon(map[string]string{
+		"10.0.0.0/8":  "a:53",
+		"10.1.0.0/16": "b:53",
+		"bad":         "c:53",
+	})
+	if len(routes) != 2 {
+		t.Fatalf("路由数量错误, 期望: 2, 实际: %d", len(routes))
+	}
+	if routes[0].upstream != "b:53" {
+		t.Errorf("前缀更长的子网应排在前面: %v", routes)
+	}
+
+	server := &Server{upstream: "global:53", splitHorizon: routes}
+	testCases := []struct {
+		ip       string
+		expected string
+	}{
+		{"10.1.2.3", "b:53"},
+		{"10.2.3.4", "a:53"},
+		{"192.0.2.1", "global:53"},
+	}
+	for _, tc := range testCases {
+		if got := server.upstreamForClient(net.ParseIP(tc.ip)); got != tc.expected {
+			t.Errorf("客户端 %s 的上游错误, 期望: %s, 实际: %s", tc.ip, tc.expected, got)
+		}
+	}
+	if got := server.upstreamForClient(nil); got != "global:53" {
+		t.Errorf("无客户端地址时应使用全局上游, 实际: %s", got)
+	}
+}
+
+func TestSplitHorizon(t *testing.T) {
+	global := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answerA(r, "10.1.1.1"))
+	})
+	internal := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := answerA(r, "10.2.2.2")
+		m.Answer = append(m.Answer, answerA(r, "192.168.5.5").Answer...)
+		w.WriteMsg(m)
+	})
+
+	server := newTestServer(t, `
+upstream:
+  server: "`+global+`"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.example.com"
+    strategy: "filter_non_cdn"
+split_horizon:
+  subnets:
+    "192.168.0.0/16": "`+internal+`"
+`)
+
+	query := func(client string) []string {
+		req := new(dns.Msg)
+		req.SetQuestion("www.example.com.", dns.TypeA)
+		w := &remoteAddrWriter{remote: &net.UDPAddr{IP: net.ParseIP(client), Port: 10053}}
+		server.ServeDNS(w, req)
+		if w.msg == nil {
+			t.Fatalf("客户端 %s 未收到响应", client)
+		}
+		var ips []string
+		for _, rr := range w.msg.Answer {
+			if a, ok := rr.(*dns.A); ok {
+				ips = append(ips, a.A.String())
+			}
+		}
+		return ips
+	}
+
+	// 办公网客户端使用内部上游，CDN 过滤逻辑依然生效
+	for i := 0; i < 2; i++ {
+		if ips := query("192.168.1.10"); len(ips) != 1 || ips[0] != "10.2.2.2" {
+			t.Errorf("办公网客户端的响应错误 (第 %d 次): %v", i+1, ips)
+		}
+		// 其他客户端使用全局上游，且不会命中办公网的缓存
+		if ips := query("198.51.100.7"); len(ips) != 1 || ips[0] != "10.1.1.1" {
+			t.Errorf("外部客户端的响应错误 (第 %d 次): %v", i+1, ips)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package dns
+
+import (
+	"log"
+	"net"
+	"time"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/miekg/dns"
+)
+
+// staleAnswerTTL 返回过期缓存响应时记录使用的 TTL (RFC 8767 第 4 节建议 30 秒)
+const staleAnswerTTL = 30
+
+// staleTTL 返回缓存条目过期后仍可返回的时长，未开启 stale_while_revalidate 时为 0
+func staleTTL(cfg *config.ServerConfig) time.Duration {
+	if !cfg.StaleWhileRevalidate {
+		return 0
+	}
+	if cfg.StaleTTL > 0 {
+		return cfg.StaleTTL
+	}
+	return config.DefaultStaleTTL
+}
+
+// setStaleTTL 将响应中记录的 TTL 改为 staleAnswerTTL（OPT 伪记录除外），避免客户端长时间缓存过期数据
+func setStaleTTL(resp *dns.Msg) {
+	for _, section := range [][]dns.RR{resp.Answer, resp.Ns, resp.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype != dns.TypeOPT && rr.Header().Ttl > staleAnswerTTL {
+				rr.Header().Ttl = staleAnswerTTL
+			}
+		}
+	}
+}
+
+// staleRefreshWriter 后台刷新过期缓存时使用的 ResponseWriter，serveDNS 据此跳过缓存直接查询上游
+type staleRefreshWriter struct {
+	captureResponseWriter
+}
+
+// refreshStale 在后台以完整查询流程（包括 CDN 检测与过滤）重新查询 r 并写入缓存。
+// remote 为触发刷新的客户端地址，用于选择相同的上游与缓存视图。同一条目同时只刷新一次
+func (s *Server) refreshStale(entry *CacheEntry, r *dns.Msg, remote net.Addr) {
+	if !entry.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+	req := r.Copy()
+	go func() {
+		defer entry.refreshing.Store(false)
+
+		<-s.workerPool
+		defer func() {
+			s.workerPool <- struct{}{}
+		}()
+
+		w := &staleRefreshWriter{captureResponseWriter{remote: remote}}
+		s.serveDNS(w, req)
+		if w.msg == nil || w.msg.Rcode == dns.RcodeServerFailure {
+			log.Printf("后台刷新过期缓存失败: %s", req.Question[0].Name)
+		}
+	}()
+}
@@ -0,0 +1,118 @@
+package dns
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hao/fxdns/internal/metrics"
+	"github.com/miekg/dns"
+)
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	var queries atomic.Int32
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		n := queries.Add(1)
+		w.WriteMsg(answerA(r, fmt.Sprintf("10.0.0.%d", n)))
+	})
+
+	newServer := func(extra string) *Server {
+		return newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 500ms
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  cache_ttl: 100ms
+`+extra+`
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+	}
+	query := func(server *Server) *dns.A {
+		t.Helper()
+		req := new(dns.Msg)
+		req.SetQuestion("www.example.com.", dns.TypeA)
+		w := &mockResponseWriter{}
+		server.ServeDNS(w, req)
+		if w.msg == nil || len(w.msg.Answer) != 1 {
+			t.Fatalf("应返回 1 条记录, 实际: %v", w.msg)
+		}
+		return w.msg.Answer[0].(*dns.A)
+	}
+	waitQueries := func(n int32) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for queries.Load() < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("等待上游查询超时, 期望: %d, 实际: %d", n, queries.Load())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	t.Run("软过期后返回过期响应并在后台刷新", func(t *testing.T) {
+		queries.Store(0)
+		server := newServer(`  stale_while_revalidate: true
+  stale_ttl: 1h`)
+		if a := query(server); a.A.String() != "10.0.0.1" {
+			t.Fatalf("首次查询结果错误: %v", a)
+		}
+		time.Sleep(150 * time.Millisecond)
+
+		staleBefore := metrics.StaleServedCount.Value()
+		a := query(server)
+		if a.A.String() != "10.0.0.1" {
+			t.Errorf("软过期后应立即返回过期响应, 实际: %v", a)
+		}
+		if a.Hdr.Ttl != staleAnswerTTL {
+			t.Errorf("过期响应的 TTL 应为 %d, 实际: %d", staleAnswerTTL, a.Hdr.Ttl)
+		}
+		if metrics.StaleServedCount.Value() != staleBefore+1 {
+			t.Error("返回过期响应应计入 StaleServedCount")
+		}
+
+		// 后台刷新完成后，缓存中是新的响应
+		waitQueries(2)
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if a := query(server); a.A.String() == "10.0.0.2" {
+				if a.Hdr.Ttl != 300 {
+					t.Errorf("刷新后的响应 TTL 错误: %d", a.Hdr.Ttl)
+				}
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("后台刷新后缓存未更新")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		if n := queries.Load(); n != 2 {
+			t.Errorf("刷新后的查询应命中缓存, 上游查询次数: %d", n)
+		}
+	})
+
+	t.Run("硬过期后正常查询上游", func(t *testing.T) {
+		queries.Store(0)
+		server := newServer(`  stale_while_revalidate: true
+  stale_ttl: 50ms`)
+		query(server)
+		time.Sleep(250 * time.Millisecond)
+		if a := query(server); a.A.String() != "10.0.0.2" || a.Hdr.Ttl != 300 {
+			t.Errorf("硬过期后应同步查询上游, 实际: %v", a)
+		}
+	})
+
+	t.Run("未开启时过期即失效", func(t *testing.T) {
+		queries.Store(0)
+		server := newServer("")
+		query(server)
+		time.Sleep(150 * time.Millisecond)
+		if a := query(server); a.A.String() != "10.0.0.2" {
+			t.Errorf("未开启 stale_while_revalidate 时过期条目不应返回, 实际: %v", a)
+		}
+	})
+}
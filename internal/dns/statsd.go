@@ -0,0 +1,48 @@
+package dns
+
+import (
+	"log"
+
+	"github.com/hao/fxdns/internal/metrics"
+)
+
+// configureStatsD 按 metrics.statsd_address 创建或关闭 StatsD 客户端，地址未变化时保留原客户端
+func (s *Server) configureStatsD(addr string) error {
+	if s.statsD().Addr() == addr {
+		return nil
+	}
+	var client *metrics.StatsDClient
+	if addr != "" {
+		var err error
+		if client, err = metrics.NewStatsDClient(addr); err != nil {
+			return err
+		}
+		log.Printf("DNS Server: StatsD 指标已启用，发送到 %s", addr)
+	}
+	if old := s.statsd.Swap(client); old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// statsD 返回当前的 StatsD 客户端，未配置时为 nil（其方法不做任何事）
+func (s *Server) statsD() *metrics.StatsDClient {
+	return s.statsd.Load()
+}
+
+// recordStatsD 发送一次查询的 StatsD 指标：查询数、缓存命中与未命中数（命中率由两者计算）以及处理耗时。
+// 上游查询耗时在查询上游时单独发送
+func (s *Server) recordStatsD(entry QueryLogEntry) {
+	client := s.statsD()
+	if client == nil {
+		return
+	}
+	client.Incr("queries")
+	if entry.CacheHit {
+		client.Incr("cache.hit")
+	} else if entry.Upstream != "" {
+		// 在本地应答 (CHAOS、RPZ 等) 的查询不经过缓存，不计入未命中
+		client.Incr("cache.miss")
+	}
+	client.Timing("query.latency", entry.Latency)
+}
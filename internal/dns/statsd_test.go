@@ -0,0 +1,73 @@
+package dns
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestServerStatsD(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听 UDP 失败: %v", err)
+	}
+	defer conn.Close()
+
+	upstreamAddr := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answerA(r, "198.51.100.1"))
+	})
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstreamAddr+`"
+  timeout: 2s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_ttl: 60s
+metrics:
+  statsd_address: "`+conn.LocalAddr().String()+`"
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+
+	// 第一次查询上游，第二次命中缓存
+	for i := 0; i < 2; i++ {
+		req := new(dns.Msg)
+		req.SetQuestion("www.example.com.", dns.TypeA)
+		w := &mockResponseWriter{}
+		server.ServeDNS(w, req)
+		if w.msg == nil {
+			t.Fatal("没有返回响应")
+		}
+	}
+
+	counts := make(map[string]int)
+	buf := make([]byte, 1500)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		name, _, _ := strings.Cut(string(buf[:n]), ":")
+		counts[name]++
+		if counts["fxdns.queries"] == 2 && counts["fxdns.query.latency"] == 2 {
+			break
+		}
+	}
+
+	for name, want := range map[string]int{
+		"fxdns.queries":          2,
+		"fxdns.cache.hit":        1,
+		"fxdns.cache.miss":       1,
+		"fxdns.query.latency":    2,
+		"fxdns.upstream.latency": 1,
+	} {
+		if counts[name] != want {
+			t.Errorf("%s 期望 %d 条, 实际 %d 条", name, want, counts[name])
+		}
+	}
+}
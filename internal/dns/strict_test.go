@@ -0,0 +1,160 @@
+package dns
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hao/fxdns/internal/metrics"
+	"github.com/hao/fxdns/internal/upstream"
+	"github.com/miekg/dns"
+)
+
+// scriptedResolver 依次以 replies 中的函数应答查询的上游解析器，记录收到的查询 ID
+type scriptedResolver struct {
+	mu      sync.Mutex
+	replies []func(m *dns.Msg) *dns.Msg
+	ids     []uint16
+}
+
+func (r *scriptedResolver) Exchange(m *dns.Msg) (*dns.Msg, time.Duration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ids = append(r.ids, m.Id)
+	reply := r.replies[min(len(r.ids), len(r.replies))-1]
+	return reply(m), time.Millisecond, nil
+}
+
+func (r *scriptedResolver) Address() string { return "https://doh.example.com/dns-query" }
+
+func TestStrictValidationRetriesMismatchedQuestion(t *testing.T) {
+	var mu sync.Mutex
+	var ids []uint16
+	upstreamAddr := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		mu.Lock()
+		ids = append(ids, r.Id)
+		first := len(ids) == 1
+		mu.Unlock()
+		resp := answerA(r, "198.51.100.1")
+		if first {
+			// 第一次以其他域名的问题段应答
+			resp.Question[0].Name = "evil.example.net."
+		}
+		w.WriteMsg(resp)
+	})
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstreamAddr+`"
+  timeout: 2s
+  strict_validation: true
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+
+	failures := metrics.UpstreamValidationFailures.Value()
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	resp, _, err := server.exchange(req, upstreamAddr)
+	if err != nil {
+		t.Fatalf("重试后应得到对应的响应: %v", err)
+	}
+	if resp.Id != req.Id || resp.Question[0].Name != "www.example.com." {
+		t.Errorf("响应应对应原查询, ID %d 问题段 %s", resp.Id, resp.Question[0].Name)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ids) != 2 || ids[0] == ids[1] {
+		t.Errorf("应换用新的查询 ID 重试一次, 上游收到的 ID: %v", ids)
+	}
+	if got := metrics.UpstreamValidationFailures.Value() - failures; got != 1 {
+		t.Errorf("fxdns_upstream_validation_failures_total 期望增加 1, 实际 %d", got)
+	}
+}
+
+func TestStrictValidationMismatchedID(t *testing.T) {
+	server := newTestServer(t, `
+upstream:
+  server: "https://doh.example.com/dns-query"
+  timeout: 2s
+  strict_validation: true
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+	wrongID := func(m *dns.Msg) *dns.Msg {
+		resp := answerA(m, "198.51.100.1")
+		resp.Id = m.Id + 1
+		return resp
+	}
+	correct := func(m *dns.Msg) *dns.Msg { return answerA(m, "198.51.100.1") }
+
+	t.Run("重试成功", func(t *testing.T) {
+		resolver := &scriptedResolver{replies: []func(*dns.Msg) *dns.Msg{wrongID, correct}}
+		server.dohResolvers = map[string]upstream.Resolver{server.upstream: resolver}
+
+		failures := metrics.UpstreamValidationFailures.Value()
+		req := new(dns.Msg)
+		req.SetQuestion("www.example.com.", dns.TypeA)
+		resp, err := server.forwardRequest(req)
+		if err != nil {
+			t.Fatalf("重试后应得到对应的响应: %v", err)
+		}
+		if resp.Id != req.Id {
+			t.Errorf("重试成功的响应 ID 应恢复为 %d, 实际 %d", req.Id, resp.Id)
+		}
+		if len(resolver.ids) != 2 || resolver.ids[1] == req.Id {
+			t.Errorf("应换用新的查询 ID 重试一次, 上游收到的 ID: %v", resolver.ids)
+		}
+		if got := metrics.UpstreamValidationFailures.Value() - failures; got != 1 {
+			t.Errorf("fxdns_upstream_validation_failures_total 期望增加 1, 实际 %d", got)
+		}
+	})
+
+	t.Run("重试次数用尽", func(t *testing.T) {
+		resolver := &scriptedResolver{replies: []func(*dns.Msg) *dns.Msg{wrongID}}
+		server.dohResolvers = map[string]upstream.Resolver{server.upstream: resolver}
+
+		req := new(dns.Msg)
+		req.SetQuestion("www.example.com.", dns.TypeA)
+		if _, err := server.forwardRequest(req); !errors.Is(err, upstream.ErrResponseMismatch) {
+			t.Errorf("始终不对应时应返回 ErrResponseMismatch, 实际: %v", err)
+		}
+		if len(resolver.ids) != 1+strictValidationRetries {
+			t.Errorf("期望查询 %d 次, 实际 %d", 1+strictValidationRetries, len(resolver.ids))
+		}
+	})
+}
+
+func TestStrictValidationDisabled(t *testing.T) {
+	server := newTestServer(t, `
+upstream:
+  server: "https://doh.example.com/dns-query"
+  timeout: 2s
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+	resolver := &scriptedResolver{replies: []func(*dns.Msg) *dns.Msg{func(m *dns.Msg) *dns.Msg {
+		resp := answerA(m, "198.51.100.1")
+		resp.Id = m.Id + 1
+		return resp
+	}}}
+	server.dohResolvers = map[string]upstream.Resolver{server.upstream: resolver}
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	if _, err := server.forwardRequest(req); err != nil {
+		t.Errorf("未开启 strict_validation 时不应检查响应: %v", err)
+	}
+	if len(resolver.ids) != 1 {
+		t.Errorf("未开启 strict_validation 时不应重试, 查询 %d 次", len(resolver.ids))
+	}
+}
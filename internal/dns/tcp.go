@@ -0,0 +1,87 @@
+package dns
+
+import (
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/miekg/dns"
+)
+
+// separateTCPListen 返回需要单独启动 TCP 服务的地址。
+// 仅在 UDP 监听下且 server.listen_tcp 与 server.listen 不同时生效，否则返回空字符串。
+func separateTCPListen(cfg *config.ServerConfig) string {
+	if cfg.Network != "" && cfg.Network != config.NetworkUDP {
+		return ""
+	}
+	if cfg.ListenTCP == "" || cfg.ListenTCP == cfg.Listen {
+		return ""
+	}
+	return cfg.ListenTCP
+}
+
+// startTCPServer 在 server.listen_tcp 指定了与 UDP 不同的地址时，启动独立的 TCP 服务。
+// 调用此方法时，调用者应持有 s.mu 的锁。
+func (s *Server) startTCPServer() error {
+	addr := separateTCPListen(&s.config.Server)
+	if addr == "" {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("TCP 监听 %s 失败: %w", addr, err)
+	}
+	tcpServer := &dns.Server{
+		Net:           "tcp",
+		Listener:      s.trackClients(ln),
+		Handler:       s,
+		MsgAcceptFunc: msgAcceptFunc,
+		TsigProvider:  updateTSIGProvider{s},
+	}
+	s.tcpServer = tcpServer
+	log.Printf("DNS Server: 已成功在 %s (tcp) 启动监听", ln.Addr().String())
+
+	go func() {
+		if err := tcpServer.ActivateAndServe(); err != nil {
+			log.Printf("DNS Server: TCP 服务在 %s 异常退出: %v", ln.Addr().String(), err)
+		}
+	}()
+	return nil
+}
+
+// stopTCPServer 关闭独立的 TCP 监听。调用此方法时，调用者应持有 s.mu 的锁。
+func (s *Server) stopTCPServer() {
+	if s.tcpServer == nil {
+		return
+	}
+	if err := s.tcpServer.Shutdown(); err != nil {
+		log.Printf("DNS Server: 关闭 TCP 服务失败: %v", err)
+	}
+	s.tcpServer = nil
+}
+
+// ListenAddrs 按协议返回实际绑定的监听地址，如 {"udp": "...", "tcp": "..."}。
+// 未单独配置 listen_tcp 时只包含 server.network 对应的一项；尚未就绪时返回空映射。
+func (s *Server) ListenAddrs() map[string]string {
+	s.mu.RLock()
+	network := s.config.Server.Network
+	var tcpAddr string
+	if s.tcpServer != nil && s.tcpServer.Listener != nil {
+		tcpAddr = s.tcpServer.Listener.Addr().String()
+	}
+	s.mu.RUnlock()
+
+	if network == "" {
+		network = config.NetworkUDP
+	}
+	addrs := make(map[string]string)
+	if addr := s.ListenAddr(); addr != "" {
+		addrs[network] = addr
+	}
+	if tcpAddr != "" {
+		addrs[config.NetworkTCP] = tcpAddr
+	}
+	return addrs
+}
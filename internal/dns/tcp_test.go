@@ -0,0 +1,81 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestSeparateTCPListen(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answerA(r, "10.1.1.1"))
+	})
+
+	// 先取得一个空闲端口作为 TCP 监听地址
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("获取空闲端口失败: %v", err)
+	}
+	tcpAddr := ln.Addr().String()
+	ln.Close()
+
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  listen_tcp: "`+tcpAddr+`"
+  workers: 2
+  cache_size: 10
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+	if err := server.Start(); err != nil {
+		t.Fatalf("启动服务器失败: %v", err)
+	}
+	stopped := false
+	defer func() {
+		if !stopped {
+			server.Stop()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := server.WaitReady(ctx); err != nil {
+		t.Fatalf("等待服务器就绪失败: %v", err)
+	}
+
+	addrs := server.ListenAddrs()
+	if addrs["tcp"] != tcpAddr || addrs["udp"] == "" || addrs["udp"] != server.ListenAddr() {
+		t.Fatalf("监听地址错误: %v", addrs)
+	}
+
+	for network, addr := range addrs {
+		req := new(dns.Msg)
+		req.SetQuestion("www.example.com.", dns.TypeA)
+		client := &dns.Client{Net: network, Timeout: 2 * time.Second}
+		resp, _, err := client.Exchange(req, addr)
+		if err != nil {
+			t.Fatalf("通过 %s 向 %s 查询失败: %v", network, addr, err)
+		}
+		if len(resp.Answer) != 1 {
+			t.Errorf("%s 响应记录数量错误, 期望: 1, 实际: %d", network, len(resp.Answer))
+		}
+	}
+
+	// Stop 后独立的 TCP 监听也应关闭
+	server.Stop()
+	stopped = true
+	if conn, err := net.DialTimeout("tcp", tcpAddr, time.Second); err == nil {
+		conn.Close()
+		t.Errorf("Stop 后 TCP 地址 %s 仍可连接", tcpAddr)
+	}
+	if addrs := server.ListenAddrs(); len(addrs) != 0 {
+		t.Errorf("Stop 后 ListenAddrs 应为空, 实际: %v", addrs)
+	}
+}
@@ -0,0 +1,66 @@
+package dns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestDomainUpstreamTimeout(t *testing.T) {
+	// 主上游对所有查询都需要 300ms 才能应答
+	primary := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		time.Sleep(300 * time.Millisecond)
+		w.WriteMsg(answerA(r, "198.51.100.1"))
+	})
+	fallback := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answerA(r, "198.51.100.2"))
+	})
+	server := newTestServer(t, `
+upstream:
+  server: "`+primary+`"
+  fallback_server: "`+fallback+`"
+  fallback_trigger: "error"
+  timeout: 100ms
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+cdn_ips:
+  - "10.0.0.0/8"
+domains:
+  - pattern: "*.slow.com"
+    upstream_timeout: 1s
+  - pattern: "*.fast.com"
+    upstream_timeout: 50ms
+`)
+
+	query := func(name string) (string, time.Duration) {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		w := &mockResponseWriter{}
+		start := time.Now()
+		server.ServeDNS(w, req)
+		elapsed := time.Since(start)
+		if w.msg == nil || len(w.msg.Answer) != 1 {
+			t.Fatalf("%s 应返回 1 条记录, 实际: %v", name, w.msg)
+		}
+		return w.msg.Answer[0].(*dns.A).A.String(), elapsed
+	}
+
+	if ip, _ := query("www.slow.com."); ip != "198.51.100.1" {
+		t.Errorf("upstream_timeout 长于主上游耗时时应使用主上游结果, 实际: %s", ip)
+	}
+	if ip, _ := query("www.other.com."); ip != "198.51.100.2" {
+		t.Errorf("未配置 upstream_timeout 的域名按 upstream.timeout 超时后应回退, 实际: %s", ip)
+	}
+	if ip, elapsed := query("www.fast.com."); ip != "198.51.100.2" || elapsed >= 100*time.Millisecond {
+		t.Errorf("upstream_timeout 超时后应立即回退到备用上游, 实际: %s, 耗时 %v", ip, elapsed)
+	}
+
+	if got := server.upstreamTimeout("www.slow.com."); got != time.Second {
+		t.Errorf("www.slow.com 的超时时间错误, 期望: 1s, 实际: %v", got)
+	}
+	if got := server.upstreamTimeout("www.other.com."); got != 100*time.Millisecond {
+		t.Errorf("未配置 upstream_timeout 时应使用 upstream.timeout, 实际: %v", got)
+	}
+}
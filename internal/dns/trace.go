@@ -0,0 +1,327 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// maxTraceSteps 单次跟踪最多发送的查询数，防止委派或 CNAME 循环
+const maxTraceSteps = 64
+
+// maxTraceCNAMEs 单次跟踪最多跟随的 CNAME 数
+const maxTraceCNAMEs = 8
+
+// defaultTraceRoots 迭代解析的起点：IANA 根服务器的 IPv4 地址 (a 到 m)
+var defaultTraceRoots = []string{
+	"198.41.0.4", "170.247.170.2", "192.33.4.12", "199.7.91.13", "192.203.230.10", "192.5.5.241", "192.112.36.4",
+	"198.97.190.53", "192.36.148.17", "192.58.128.30", "193.0.14.129", "199.7.83.42", "202.12.27.33",
+}
+
+// TraceOptions TraceDomain 的参数，零值表示从 IANA 根服务器开始、使用 53 端口
+type TraceOptions struct {
+	// Roots 迭代解析起点的根服务器 IP，为空时使用 IANA 根服务器
+	Roots []string
+	// Port 向根服务器与各级权威服务器查询使用的端口，为空时使用 53
+	Port string
+}
+
+// tracer 一次 TraceDomain 使用的参数，上游客户端与地址在开始时从 Server 取快照
+type tracer struct {
+	s        *Server
+	client   *dns.Client
+	upstream string
+	roots    []string
+	port     string
+}
+
+// TraceStep 迭代解析中的一次查询
+type TraceStep struct {
+	// Zone 被查询服务器负责的区域，根服务器为 "."
+	Zone   string `json:"zone"`
+	Server string `json:"server"`
+	Query  string `json:"query"`
+	Rcode  string `json:"rcode,omitempty"`
+	// LatencyMs 本次查询的往返耗时（毫秒）
+	LatencyMs float64 `json:"latency_ms"`
+	// Referral 服务器返回的下一级委派区域及其 NS，没有委派时为空
+	Referral   string   `json:"referral,omitempty"`
+	NameServer []string `json:"name_servers,omitempty"`
+	Answers    []string `json:"answers,omitempty"`
+	// CDNIPs 应答中属于 cdn_ips 的地址
+	CDNIPs []string `json:"cdn_ips,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// TraceResult 从根服务器开始迭代解析一个域名的完整过程
+type TraceResult struct {
+	Domain string      `json:"domain"`
+	Steps  []TraceStep `json:"steps"`
+	// CNAMEChain 从查询域名开始依次跟随的域名，没有 CNAME 时只有查询域名本身
+	CNAMEChain []string `json:"cname_chain"`
+	Rcode      string   `json:"rcode"`
+	IPs        []string `json:"ips,omitempty"`
+	CDNIPs     []string `json:"cdn_ips,omitempty"`
+	// TotalLatencyMs 所有查询的耗时之和（毫秒）
+	TotalLatencyMs float64 `json:"total_latency_ms"`
+	// Diagram 每个查询一行的文本表示，可直接逐行绘制为解析路径图
+	Diagram []string `json:"diagram"`
+}
+
+// TraceDomain 类似 dig +trace，从根服务器开始迭代查询 domain 的 A 记录：跟随 NS 委派、跟随 CNAME 链，
+// 记录每一步的服务器、耗时与应答，并标出属于 cdn_ips 的地址。用于调试，不经过缓存与域名规则。
+// 解析中途失败时返回已完成的部分结果与错误
+func (s *Server) TraceDomain(domain string, opts TraceOptions) (*TraceResult, error) {
+	name := normalizeDomain(strings.TrimSpace(domain))
+	if name == "" {
+		return nil, errors.New("域名不能为空")
+	}
+	name = dns.Fqdn(name)
+
+	t := &tracer{s: s, roots: opts.Roots, port: opts.Port}
+	if len(t.roots) == 0 {
+		t.roots = defaultTraceRoots
+	}
+	if t.port == "" {
+		t.port = "53"
+	}
+	s.mu.RLock()
+	t.client = s.client
+	t.upstream = s.upstream
+	s.mu.RUnlock()
+
+	result := &TraceResult{Domain: name, CNAMEChain: []string{name}}
+	err := t.trace(result, name)
+	for _, step := range result.Steps {
+		result.TotalLatencyMs += step.LatencyMs
+		result.Diagram = append(result.Diagram, step.diagramLine())
+	}
+	return result, err
+}
+
+// trace 从根服务器开始迭代解析 name，遇到 CNAME 时从根服务器重新解析目标域名
+func (t *tracer) trace(result *TraceResult, name string) error {
+	zone, servers := ".", t.rootAddrs()
+	for len(result.Steps) < maxTraceSteps {
+		step, resp := t.query(zone, servers, name)
+		result.Steps = append(result.Steps, step)
+		if resp == nil {
+			return fmt.Errorf("区域 %s 的服务器均无响应: %s", zone, step.Error)
+		}
+		result.Rcode = dns.RcodeToString[resp.Rcode]
+		if resp.Rcode != dns.RcodeSuccess {
+			return nil
+		}
+
+		if len(resp.Answer) > 0 {
+			target, ips := traceAnswer(resp, name)
+			if len(ips) > 0 || target == "" {
+				for _, ip := range ips {
+					result.IPs = append(result.IPs, ip.String())
+				}
+				result.CDNIPs = append(result.CDNIPs, step.CDNIPs...)
+				return nil
+			}
+			if len(result.CNAMEChain) > maxTraceCNAMEs {
+				return fmt.Errorf("CNAME 链超过 %d 层", maxTraceCNAMEs)
+			}
+			result.CNAMEChain = append(result.CNAMEChain, target)
+			name = target
+			zone, servers = ".", t.rootAddrs()
+			continue
+		}
+
+		next, nsNames := traceReferral(resp)
+		if next == "" {
+			// 没有应答也没有委派：域名存在但没有 A 记录
+			return nil
+		}
+		if !dns.IsSubDomain(zone, next) || dns.CountLabel(next) <= dns.CountLabel(zone) || !dns.IsSubDomain(next, name) {
+			return fmt.Errorf("%s 返回了无效的委派: %s", step.Server, next)
+		}
+		if servers = t.nsAddrs(resp, nsNames); len(servers) == 0 {
+			return fmt.Errorf("无法获取区域 %s 的服务器地址", next)
+		}
+		zone = next
+	}
+	return fmt.Errorf("查询次数超过 %d 次", maxTraceSteps)
+}
+
+// query 依次向 servers 发送不要求递归的 A 查询，返回第一个成功的响应；全部失败时 resp 为 nil
+func (t *tracer) query(zone string, servers []string, name string) (TraceStep, *dns.Msg) {
+	step := TraceStep{Zone: zone, Query: name}
+	req := new(dns.Msg)
+	req.SetQuestion(name, dns.TypeA)
+	req.RecursionDesired = false
+	req.SetEdns0(dns.DefaultMsgSize, false)
+
+	var errs []string
+	for _, server := range servers {
+		step.Server = server
+		resp, rtt, err := t.client.Exchange(req, server)
+		if err == nil && resp.Truncated {
+			tcp := &dns.Client{Net: "tcp", Timeout: t.client.Timeout}
+			resp, rtt, err = tcp.Exchange(req, server)
+		}
+		step.LatencyMs += float64(rtt) / float64(time.Millisecond)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", server, err))
+			continue
+		}
+
+		step.Rcode = dns.RcodeToString[resp.Rcode]
+		for _, rr := range resp.Answer {
+			step.Answers = append(step.Answers, rr.String())
+			if ip := rrIP(rr); ip != nil {
+				if _, ok := t.s.cidrMatcher.Lookup(ip); ok {
+					step.CDNIPs = append(step.CDNIPs, ip.String())
+				}
+			}
+		}
+		step.Referral, step.NameServer = traceReferral(resp)
+		return step, resp
+	}
+	step.Error = strings.Join(errs, "; ")
+	return step, nil
+}
+
+// traceAnswer 从应答中跟随 name 的 CNAME 链：链的末端有地址记录时返回这些地址，
+// 否则返回需要继续解析的 CNAME 目标；两者都没有时返回空
+func traceAnswer(resp *dns.Msg, name string) (target string, ips []net.IP) {
+	for seen := 0; seen <= len(resp.Answer); seen++ {
+		next := ""
+		for _, rr := range resp.Answer {
+			if !strings.EqualFold(rr.Header().Name, name) {
+				continue
+			}
+			switch v := rr.(type) {
+			case *dns.A:
+				ips = append(ips, v.A)
+			case *dns.CNAME:
+				next = v.Target
+			}
+		}
+		if len(ips) > 0 || next == "" {
+			break
+		}
+		name = next
+		target = next
+	}
+	if len(ips) > 0 {
+		return "", ips
+	}
+	return target, nil
+}
+
+// traceReferral 返回响应权威部分中的委派区域及其 NS 名称，不是委派时返回空
+func traceReferral(resp *dns.Msg) (zone string, nsNames []string) {
+	for _, rr := range resp.Ns {
+		if ns, ok := rr.(*dns.NS); ok {
+			zone = ns.Hdr.Name
+			nsNames = append(nsNames, ns.Ns)
+		}
+	}
+	return zone, nsNames
+}
+
+// nsAddrs 返回委派 NS 的地址：优先使用附加部分的胶水记录，没有胶水时向上游查询 NS 的 A 记录
+func (t *tracer) nsAddrs(resp *dns.Msg, nsNames []string) []string {
+	var addrs []string
+	for _, nsName := range nsNames {
+		for _, rr := range resp.Extra {
+			if a, ok := rr.(*dns.A); ok && strings.EqualFold(a.Hdr.Name, nsName) {
+				addrs = append(addrs, net.JoinHostPort(a.A.String(), t.port))
+			}
+		}
+	}
+	if len(addrs) > 0 {
+		return addrs
+	}
+
+	for _, nsName := range nsNames {
+		req := new(dns.Msg)
+		req.SetQuestion(nsName, dns.TypeA)
+		glue, _, err := t.client.Exchange(req, t.upstream)
+		if err != nil {
+			continue
+		}
+		for _, rr := range glue.Answer {
+			if a, ok := rr.(*dns.A); ok {
+				addrs = append(addrs, net.JoinHostPort(a.A.String(), t.port))
+			}
+		}
+		if len(addrs) > 0 {
+			break
+		}
+	}
+	return addrs
+}
+
+// rootAddrs 返回根服务器地址列表
+func (t *tracer) rootAddrs() []string {
+	addrs := make([]string, 0, len(t.roots))
+	for _, root := range t.roots {
+		addrs = append(addrs, net.JoinHostPort(root, t.port))
+	}
+	return addrs
+}
+
+// rrIP 返回 A / AAAA 记录中的地址，其他类型返回 nil
+func rrIP(rr dns.RR) net.IP {
+	switch v := rr.(type) {
+	case *dns.A:
+		return v.A
+	case *dns.AAAA:
+		return v.AAAA
+	}
+	return nil
+}
+
+// diagramLine 返回该步骤在解析路径图中的一行，如 ". @198.41.0.4:53 -> com. (12.3ms)"
+func (step TraceStep) diagramLine() string {
+	var outcome string
+	switch {
+	case step.Error != "":
+		outcome = "error: " + step.Error
+	case step.Referral != "":
+		outcome = "-> " + step.Referral
+	case len(step.Answers) > 0:
+		outcome = "=> " + strings.Join(step.Answers, ", ")
+		if len(step.CDNIPs) > 0 {
+			outcome += " [CDN: " + strings.Join(step.CDNIPs, ", ") + "]"
+		}
+	default:
+		outcome = "=> " + step.Rcode
+	}
+	return fmt.Sprintf("%s @%s %s %s (%.1fms)", step.Zone, step.Server, step.Query, outcome, step.LatencyMs)
+}
+
+// handleTrace 返回处理 GET /trace?domain=example.com 的处理器，按 opts 执行 TraceDomain，
+// 解析失败时以 502 返回已完成的部分结果与错误
+func (s *Server) handleTrace(opts TraceOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		result, err := s.TraceDomain(r.URL.Query().Get("domain"), opts)
+		if result == nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusBadGateway, struct {
+				*TraceResult
+				Error string `json:"error"`
+			}{result, err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
@@ -0,0 +1,179 @@
+package dns
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// startTraceNameserver 在指定地址启动一个模拟的权威服务器
+func startTraceNameserver(t *testing.T, addr string, handler dns.HandlerFunc) {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		t.Fatalf("启动模拟服务器 %s 失败: %v", addr, err)
+	}
+	started := make(chan struct{})
+	srv := &dns.Server{PacketConn: pc, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go srv.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { srv.Shutdown() })
+}
+
+// referral 构造把 zone 委派给 ns (胶水地址 glue) 的响应
+func referral(r *dns.Msg, zone, ns, glue string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Ns = append(m.Ns, &dns.NS{Hdr: dns.RR_Header{Name: zone, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 3600}, Ns: ns})
+	m.Extra = append(m.Extra, &dns.A{Hdr: dns.RR_Header{Name: ns, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 3600}, A: net.ParseIP(glue)})
+	return m
+}
+
+// newTraceTestServer 启动模拟的根 (127.0.0.1)、com. (127.0.0.2) 与 example.com. / cdn.com. 权威 (127.0.0.3) 服务器，
+// 返回的 TraceOptions 指向这些模拟服务器
+func newTraceTestServer(t *testing.T) (*Server, TraceOptions) {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("获取端口失败: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(pc.LocalAddr().String())
+	pc.Close()
+
+	startTraceNameserver(t, net.JoinHostPort("127.0.0.1", port), func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(referral(r, "com.", "a.gtld.test.", "127.0.0.2"))
+	})
+	startTraceNameserver(t, net.JoinHostPort("127.0.0.2", port), func(w dns.ResponseWriter, r *dns.Msg) {
+		if dns.IsSubDomain("cdn.com.", r.Question[0].Name) {
+			w.WriteMsg(referral(r, "cdn.com.", "ns.cdn.com.", "127.0.0.3"))
+			return
+		}
+		w.WriteMsg(referral(r, "example.com.", "ns1.example.com.", "127.0.0.3"))
+	})
+	startTraceNameserver(t, net.JoinHostPort("127.0.0.3", port), func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Authoritative = true
+		switch r.Question[0].Name {
+		case "www.example.com.":
+			rr, _ := dns.NewRR("www.example.com. 300 IN CNAME edge.cdn.com.")
+			m.Answer = append(m.Answer, rr)
+		case "edge.cdn.com.":
+			a1, _ := dns.NewRR("edge.cdn.com. 60 IN A 10.1.1.1")
+			a2, _ := dns.NewRR("edge.cdn.com. 60 IN A 203.0.113.5")
+			m.Answer = append(m.Answer, a1, a2)
+		default:
+			m.SetRcode(r, dns.RcodeNameError)
+		}
+		w.WriteMsg(m)
+	})
+
+	server := newTestServer(t, `
+upstream:
+  server: "127.0.0.1:1"
+  timeout: 500ms
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+	return server, TraceOptions{Roots: []string{"127.0.0.1"}, Port: port}
+}
+
+func TestTraceDomain(t *testing.T) {
+	server, opts := newTraceTestServer(t)
+
+	result, err := server.TraceDomain("WWW.example.com", opts)
+	if err != nil {
+		t.Fatalf("跟踪失败: %v", err)
+	}
+	if result.Rcode != "NOERROR" {
+		t.Errorf("RCODE 错误: %s", result.Rcode)
+	}
+	if got := strings.Join(result.CNAMEChain, " "); got != "www.example.com. edge.cdn.com." {
+		t.Errorf("CNAME 链错误: %v", result.CNAMEChain)
+	}
+	if got := strings.Join(result.IPs, " "); got != "10.1.1.1 203.0.113.5" {
+		t.Errorf("解析结果错误: %v", result.IPs)
+	}
+	if len(result.CDNIPs) != 1 || result.CDNIPs[0] != "10.1.1.1" {
+		t.Errorf("CDN IP 错误: %v", result.CDNIPs)
+	}
+
+	// 根 -> com. -> example.com. (CNAME)，再从根开始 -> com. -> cdn.com. (A)
+	expectZones := []string{".", "com.", "example.com.", ".", "com.", "cdn.com."}
+	if len(result.Steps) != len(expectZones) {
+		t.Fatalf("步骤数错误, 期望: %d, 实际: %d (%v)", len(expectZones), len(result.Steps), result.Diagram)
+	}
+	for i, zone := range expectZones {
+		if result.Steps[i].Zone != zone {
+			t.Errorf("第 %d 步区域错误, 期望: %s, 实际: %s", i, zone, result.Steps[i].Zone)
+		}
+	}
+	if result.Steps[1].Referral != "example.com." || result.Steps[1].Server != net.JoinHostPort("127.0.0.2", opts.Port) {
+		t.Errorf("委派步骤错误: %+v", result.Steps[1])
+	}
+	if len(result.Diagram) != len(result.Steps) || !strings.Contains(result.Diagram[5], "[CDN: 10.1.1.1]") {
+		t.Errorf("路径图错误: %v", result.Diagram)
+	}
+}
+
+func TestTraceDomainNXDomain(t *testing.T) {
+	server, opts := newTraceTestServer(t)
+
+	result, err := server.TraceDomain("missing.example.com", opts)
+	if err != nil {
+		t.Fatalf("跟踪失败: %v", err)
+	}
+	if result.Rcode != "NXDOMAIN" || len(result.Steps) != 3 || len(result.IPs) != 0 {
+		t.Errorf("NXDOMAIN 结果错误: %+v", result)
+	}
+}
+
+func TestTraceDomainUnreachable(t *testing.T) {
+	server, opts := newTraceTestServer(t)
+	opts.Roots = []string{"127.0.0.4"}
+
+	result, err := server.TraceDomain("www.example.com", opts)
+	if err == nil {
+		t.Fatal("根服务器不可达时应返回错误")
+	}
+	if result == nil || len(result.Steps) != 1 || result.Steps[0].Error == "" {
+		t.Errorf("应返回包含失败步骤的部分结果: %+v", result)
+	}
+
+	if _, err := server.TraceDomain(" ", opts); err == nil {
+		t.Error("空域名应返回错误")
+	}
+}
+
+func TestAdminTrace(t *testing.T) {
+	server, opts := newTraceTestServer(t)
+	handler := server.handleTrace(opts)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/trace?domain=www.example.com", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码错误: %d, %s", rec.Code, rec.Body.String())
+	}
+	var result TraceResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if len(result.Steps) != 6 || len(result.CDNIPs) != 1 {
+		t.Errorf("响应内容错误: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/trace", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("缺少 domain 时应返回 400, 实际: %d", rec.Code)
+	}
+}
@@ -0,0 +1,62 @@
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestUpstreamTSIG(t *testing.T) {
+	const secret = "c2VjcmV0LWtleS1mb3ItZnhkbnM="
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("启动测试上游失败: %v", err)
+	}
+	started := make(chan struct{})
+	srv := &dns.Server{
+		PacketConn:        pc,
+		TsigSecret:        map[string]string{"fxdns-key.": secret},
+		NotifyStartedFunc: func() { close(started) },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			if r.IsTsig() == nil || w.TsigStatus() != nil {
+				m := new(dns.Msg)
+				m.SetRcode(r, dns.RcodeNotAuth)
+				w.WriteMsg(m)
+				return
+			}
+			m := answerA(r, "10.1.1.1")
+			m.SetTsig("fxdns-key.", dns.HmacSHA256, 300, time.Now().Unix())
+			w.WriteMsg(m)
+		}),
+	}
+	go srv.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { srv.Shutdown() })
+
+	server := newTestServer(t, `
+upstream:
+  server: "`+pc.LocalAddr().String()+`"
+  timeout: 500ms
+  tsig_key_name: "fxdns-key"
+  tsig_secret: "`+secret+`"
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	w := &mockResponseWriter{}
+	server.ServeDNS(w, req)
+	if w.msg == nil || w.msg.Rcode != dns.RcodeSuccess || len(w.msg.Answer) != 1 {
+		t.Fatalf("签名查询应得到上游应答, 实际: %v", w.msg)
+	}
+	if w.msg.IsTsig() != nil {
+		t.Error("返回给客户端的响应不应包含上游的 TSIG 记录")
+	}
+}
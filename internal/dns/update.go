@@ -0,0 +1,147 @@
+package dns
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"log"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// updateTSIGFudge 重新签名转发的 UPDATE 及其响应时允许的时钟偏差 (秒)
+const updateTSIGFudge = 300
+
+// errTSIGUnverified DoH / DoQ 等不经过 miekg/dns 服务器的传输无法校验 TSIG 签名
+var errTSIGUnverified = errors.New("该传输方式不支持校验 TSIG 签名")
+
+// msgAcceptFunc 在 miekg/dns 默认的报文过滤基础上放行 UPDATE 请求，
+// 默认过滤会在进入 ServeDNS 之前直接以 NOTIMP 拒绝它们
+func msgAcceptFunc(dh dns.Header) dns.MsgAcceptAction {
+	const qr = 1 << 15
+	opcode := int(dh.Bits>>11) & 0xF
+	if opcode == dns.OpcodeUpdate && dh.Bits&qr == 0 {
+		return dns.MsgAccept
+	}
+	return dns.DefaultMsgAcceptFunc(dh)
+}
+
+// updateTSIGProvider 按当前配置的 server.update_tsig_* 密钥计算与校验 TSIG 签名，热加载后立即使用新密钥。
+// 用于监听的 dns.Server (校验客户端签名并签名响应) 与转发 UPDATE 的 dns.Client
+type updateTSIGProvider struct {
+	s *Server
+}
+
+// Generate 实现 dns.TsigProvider
+func (p updateTSIGProvider) Generate(msg []byte, t *dns.TSIG) ([]byte, error) {
+	key := p.s.currentConfig().Server.UpdateTSIGKey()
+	if key == nil || dns.CanonicalName(t.Hdr.Name) != key.Name {
+		return nil, dns.ErrSecret
+	}
+	secret, err := base64.StdEncoding.DecodeString(key.Secret)
+	if err != nil {
+		return nil, err
+	}
+	var h hash.Hash
+	switch dns.CanonicalName(t.Algorithm) {
+	case dns.HmacSHA1:
+		h = hmac.New(sha1.New, secret)
+	case dns.HmacSHA224:
+		h = hmac.New(sha256.New224, secret)
+	case dns.HmacSHA256:
+		h = hmac.New(sha256.New, secret)
+	case dns.HmacSHA384:
+		h = hmac.New(sha512.New384, secret)
+	case dns.HmacSHA512:
+		h = hmac.New(sha512.New, secret)
+	default:
+		return nil, dns.ErrKeyAlg
+	}
+	h.Write(msg)
+	return h.Sum(nil), nil
+}
+
+// Verify 实现 dns.TsigProvider
+func (p updateTSIGProvider) Verify(msg []byte, t *dns.TSIG) error {
+	expected, err := p.Generate(msg, t)
+	if err != nil {
+		return err
+	}
+	mac, err := hex.DecodeString(t.MAC)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(expected, mac) {
+		return dns.ErrSig
+	}
+	return nil
+}
+
+// withoutTSIG 返回去掉附加段中 TSIG 记录的 m 的副本
+func withoutTSIG(m *dns.Msg) *dns.Msg {
+	stripped := m.Copy()
+	extra := stripped.Extra[:0]
+	for _, rr := range stripped.Extra {
+		if rr.Header().Rrtype != dns.TypeTSIG {
+			extra = append(extra, rr)
+		}
+	}
+	stripped.Extra = extra
+	return stripped
+}
+
+// handleUpdate 处理 DNS UPDATE (RFC 2136) 消息：配置了 server.forward_updates_to 时转发给该地址，
+// 并将其响应返回给客户端，转发失败时返回 SERVFAIL；未配置时返回 REFUSED。
+// 带 TSIG 签名的 UPDATE 由监听的 dns.Server 按 update_tsig_* 密钥校验，校验通过后以同一密钥重新签名转发，
+// 响应同样重新签名后返回；未配置密钥、签名无效或传输方式无法校验签名时返回 NOTAUTH
+func (s *Server) handleUpdate(w dns.ResponseWriter, r *dns.Msg) {
+	cfg := s.currentConfig()
+	addr := cfg.Server.ForwardUpdatesTo
+	if addr == "" {
+		resp := new(dns.Msg)
+		resp.SetRcode(r, dns.RcodeRefused)
+		w.WriteMsg(resp)
+		return
+	}
+
+	req, client := r, s.client
+	key := cfg.Server.UpdateTSIGKey()
+	signed := r.IsTsig() != nil
+	if signed {
+		status := w.TsigStatus()
+		if key == nil {
+			status = dns.ErrSecret
+		}
+		if status != nil {
+			log.Printf("拒绝来自 %s 的 DNS UPDATE: TSIG 签名校验失败: %v", w.RemoteAddr(), status)
+			resp := new(dns.Msg)
+			resp.SetRcode(r, dns.RcodeNotAuth)
+			w.WriteMsg(resp)
+			return
+		}
+		// 转发时报文会重新打包，客户端的签名无法保留，以同一密钥重新签名
+		req = withoutTSIG(r)
+		req.SetTsig(key.Name, key.Algorithm, updateTSIGFudge, time.Now().Unix())
+		client = &dns.Client{Net: s.client.Net, Timeout: s.client.Timeout, TsigProvider: updateTSIGProvider{s}}
+	}
+
+	resp, _, err := client.Exchange(req, addr)
+	if err != nil {
+		log.Printf("转发 DNS UPDATE 到 %s 失败: %v", addr, err)
+		dns.HandleFailed(w, r)
+		return
+	}
+	log.Printf("DNS UPDATE 已转发到 %s, 结果: %s", addr, dns.RcodeToString[resp.Rcode])
+	if signed {
+		// 权威服务器响应的签名已由 dns.Client 校验，写出时由 ResponseWriter 按客户端请求的 MAC 重新签名
+		resp = withoutTSIG(resp)
+		resp.SetTsig(key.Name, key.Algorithm, updateTSIGFudge, time.Now().Unix())
+	}
+	w.WriteMsg(resp)
+}
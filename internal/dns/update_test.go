@@ -0,0 +1,230 @@
+package dns
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestForwardUpdates(t *testing.T) {
+	var queries atomic.Int32
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		queries.Add(1)
+		w.WriteMsg(answerA(r, "10.1.1.1"))
+	})
+	var updates atomic.Int32
+	authority := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		updates.Add(1)
+		m := new(dns.Msg)
+		if r.Opcode != dns.OpcodeUpdate || len(r.Ns) != 1 {
+			m.SetRcode(r, dns.RcodeFormatError)
+		} else if r.Question[0].Name == "example.com." {
+			m.SetReply(r)
+		} else {
+			m.SetRcode(r, dns.RcodeNotAuth)
+		}
+		w.WriteMsg(m)
+	})
+
+	newUpdate := func(zone string) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetUpdate(zone)
+		rr, _ := dns.NewRR("host." + zone + " 300 IN A 192.0.2.10")
+		m.Insert([]dns.RR{rr})
+		return m
+	}
+
+	testCases := []struct {
+		name          string
+		forward       string
+		zone          string
+		expectCode    int
+		expectForward bool
+	}{
+		{"未配置时拒绝", "", "example.com.", dns.RcodeRefused, false},
+		{"转发并返回上游结果", authority, "example.com.", dns.RcodeSuccess, true},
+		{"返回上游的错误 RCODE", authority, "other.org.", dns.RcodeNotAuth, true},
+		{"转发失败时返回 SERVFAIL", "127.0.0.1:1", "example.com.", dns.RcodeServerFailure, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 200ms
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  forward_updates_to: "`+tc.forward+`"
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+			queriesBefore, updatesBefore := queries.Load(), updates.Load()
+
+			req := newUpdate(tc.zone)
+			w := &mockResponseWriter{}
+			server.ServeDNS(w, req)
+			if w.msg == nil {
+				t.Fatal("未收到响应")
+			}
+			if w.msg.Rcode != tc.expectCode {
+				t.Errorf("RCODE 错误, 期望: %s, 实际: %s", dns.RcodeToString[tc.expectCode], dns.RcodeToString[w.msg.Rcode])
+			}
+			if w.msg.Id != req.Id || w.msg.Opcode != dns.OpcodeUpdate {
+				t.Errorf("响应头错误: id=%d opcode=%d", w.msg.Id, w.msg.Opcode)
+			}
+			if forwarded := updates.Load() > updatesBefore; forwarded != tc.expectForward {
+				t.Errorf("是否转发错误, 期望: %v, 实际: %v", tc.expectForward, forwarded)
+			}
+			if queries.Load() != queriesBefore {
+				t.Error("UPDATE 消息不应按普通查询转发给上游")
+			}
+		})
+	}
+}
+
+func TestForwardSignedUpdates(t *testing.T) {
+	const secret = "c2VjcmV0LWtleS1mb3ItZnhkbnM="
+	const wrongSecret = "d3Jvbmcta2V5LWZvci1meGRucw=="
+
+	// 权威服务器要求 UPDATE 带有有效签名，并签名其响应
+	var updates atomic.Int32
+	apc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("启动测试权威服务器失败: %v", err)
+	}
+	started := make(chan struct{})
+	authority := &dns.Server{
+		PacketConn:        apc,
+		MsgAcceptFunc:     msgAcceptFunc,
+		TsigSecret:        map[string]string{"update-key.": secret},
+		NotifyStartedFunc: func() { close(started) },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			updates.Add(1)
+			m := new(dns.Msg)
+			if r.IsTsig() == nil || w.TsigStatus() != nil {
+				m.SetRcode(r, dns.RcodeNotAuth)
+				w.WriteMsg(m)
+				return
+			}
+			m.SetReply(r)
+			m.SetTsig("update-key.", dns.HmacSHA256, 300, time.Now().Unix())
+			w.WriteMsg(m)
+		}),
+	}
+	go authority.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { authority.Shutdown() })
+
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(answerA(r, "10.1.1.1"))
+	})
+
+	// serve 以真实的 UDP 监听运行 server，由 dns.Server 校验客户端签名并签名响应
+	serve := func(server *Server) string {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("启动监听失败: %v", err)
+		}
+		started := make(chan struct{})
+		srv := &dns.Server{
+			PacketConn:        pc,
+			Handler:           server,
+			MsgAcceptFunc:     msgAcceptFunc,
+			TsigProvider:      updateTSIGProvider{server},
+			NotifyStartedFunc: func() { close(started) },
+		}
+		go srv.ActivateAndServe()
+		<-started
+		t.Cleanup(func() { srv.Shutdown() })
+		return pc.LocalAddr().String()
+	}
+
+	testCases := []struct {
+		name          string
+		keyConfig     string
+		clientSecret  string
+		expectCode    int
+		expectForward bool
+	}{
+		{"校验并重新签名转发", `
+  update_tsig_key_name: "Update-Key"
+  update_tsig_secret: "` + secret + `"`, secret, dns.RcodeSuccess, true},
+		{"签名无效时返回 NOTAUTH", `
+  update_tsig_key_name: "update-key."
+  update_tsig_secret: "` + secret + `"`, wrongSecret, dns.RcodeNotAuth, false},
+		{"未配置密钥时返回 NOTAUTH", "", secret, dns.RcodeNotAuth, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 500ms
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  forward_updates_to: "`+apc.LocalAddr().String()+`"`+tc.keyConfig+`
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+			addr := serve(server)
+			before := updates.Load()
+
+			req := new(dns.Msg)
+			req.SetUpdate("example.com.")
+			rr, _ := dns.NewRR("host.example.com. 300 IN A 192.0.2.10")
+			req.Insert([]dns.RR{rr})
+			req.SetTsig("update-key.", dns.HmacSHA256, 300, time.Now().Unix())
+
+			// 客户端校验响应的签名，签名无效时 Exchange 返回错误
+			client := &dns.Client{Timeout: time.Second, TsigSecret: map[string]string{"update-key.": tc.clientSecret}}
+			resp, _, err := client.Exchange(req, addr)
+			if err != nil {
+				t.Fatalf("发送签名的 UPDATE 失败: %v", err)
+			}
+			if resp.Rcode != tc.expectCode {
+				t.Errorf("RCODE 错误, 期望: %s, 实际: %s", dns.RcodeToString[tc.expectCode], dns.RcodeToString[resp.Rcode])
+			}
+			if tc.expectCode == dns.RcodeSuccess && resp.IsTsig() == nil {
+				t.Error("签名的 UPDATE 的响应应带有签名")
+			}
+			if forwarded := updates.Load() > before; forwarded != tc.expectForward {
+				t.Errorf("是否转发错误, 期望: %v, 实际: %v", tc.expectForward, forwarded)
+			}
+		})
+	}
+
+	// DoQ / DoH 无法校验签名，带签名的 UPDATE 不转发
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 500ms
+server:
+  listen: "127.0.0.1:0"
+  workers: 2
+  cache_size: 10
+  forward_updates_to: "`+apc.LocalAddr().String()+`"
+  update_tsig_key_name: "update-key."
+  update_tsig_secret: "`+secret+`"
+cdn_ips:
+  - "10.0.0.0/8"
+`)
+	req := new(dns.Msg)
+	req.SetUpdate("example.com.")
+	req.SetTsig("update-key.", dns.HmacSHA256, 300, time.Now().Unix())
+	before := updates.Load()
+	if resp, err := server.query(req, nil); err != nil || resp.Rcode != dns.RcodeNotAuth {
+		t.Errorf("无法校验签名的传输方式应返回 NOTAUTH, 实际: %v, %v", resp, err)
+	}
+	if updates.Load() != before {
+		t.Error("无法校验签名时不应转发")
+	}
+}
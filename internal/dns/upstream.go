@@ -0,0 +1,177 @@
+package dns
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/hao/fxdns/internal/metrics"
+	"github.com/hao/fxdns/internal/upstream"
+	"github.com/miekg/dns"
+)
+
+// exchange 向指定上游发送查询：json-doh 主上游使用 JSON API，https:// 地址使用 DoH，
+// 配置了 TSIG 时使用签名查询的 DNS 解析器，其余使用 s.client (UDP)
+func (s *Server) exchange(m *dns.Msg, addr string) (*dns.Msg, time.Duration, error) {
+	return s.exchangeContext(context.Background(), m, addr)
+}
+
+// strictValidationRetries strict_validation 开启时响应与查询不对应后换用新 ID 重试的最大次数
+const strictValidationRetries = 2
+
+// exchangeContext 与 exchange 相同，ctx 设置了截止时间时以其代替 upstream.timeout 作为 UDP 查询的超时时间 (可长于 upstream.timeout)。
+// DoH / TSIG 解析器仍受自身 upstream.timeout 的限制，ctx 结束时不再等待其结果，返回 ctx.Err()。
+// 开启 strict_validation 时检查响应是否对应查询 (见 upstream.ValidateStubResponse)，不对应时换用新的查询 ID 重试，
+// 重试成功的响应 ID 恢复为 m.Id；重试次数用尽仍不对应时返回最后一次的错误
+func (s *Server) exchangeContext(ctx context.Context, m *dns.Msg, addr string) (*dns.Msg, time.Duration, error) {
+	resp, rtt, err := s.exchangeOnce(ctx, m, addr)
+	if err != nil || !s.config.Upstream.StrictValidation {
+		return resp, rtt, err
+	}
+
+	req := m
+	for attempt := 0; ; attempt++ {
+		verr := upstream.ValidateStubResponse(req, resp)
+		if verr == nil {
+			if req != m {
+				resp.Id = m.Id
+			}
+			return resp, rtt, nil
+		}
+		metrics.UpstreamValidationFailures.Inc()
+		if attempt >= strictValidationRetries {
+			log.Printf("上游 %s 的响应与查询 (ID %d) 不对应，已重试 %d 次: %v", addr, req.Id, attempt, verr)
+			return nil, rtt, verr
+		}
+		log.Printf("上游 %s 的响应与查询 (ID %d) 不对应，换用新 ID 重试: %v", addr, req.Id, verr)
+
+		req = m.Copy()
+		req.Id = dns.Id()
+		if resp, rtt, err = s.exchangeOnce(ctx, req, addr); err != nil {
+			return nil, rtt, err
+		}
+	}
+}
+
+// exchangeOnce 向 addr 发送一次查询，不检查响应，见 exchangeContext
+func (s *Server) exchangeOnce(ctx context.Context, m *dns.Msg, addr string) (*dns.Msg, time.Duration, error) {
+	if !upstream.IsDoH(addr) && !s.isJSONDoH(addr) && s.config.Upstream.TSIGKeyName == "" {
+		client := s.client
+		// dns.Client 取 Timeout 与 ctx 截止时间中较早的一个，截止时间更晚时改用放宽了 Timeout 的副本
+		if deadline, ok := ctx.Deadline(); ok {
+			if remaining := time.Until(deadline); remaining > client.Timeout {
+				relaxed := *client
+				relaxed.Timeout = remaining
+				client = &relaxed
+			}
+		}
+		return client.ExchangeContext(ctx, m, addr)
+	}
+	resolver := s.dohResolver(addr)
+	if ctx.Done() == nil {
+		return resolver.Exchange(m)
+	}
+
+	result := make(chan exchangeResult, 1)
+	go func() {
+		resp, rtt, err := resolver.Exchange(m)
+		result <- exchangeResult{resp: resp, rtt: rtt, err: err}
+	}()
+	select {
+	case res := <-result:
+		return res.resp, res.rtt, res.err
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	}
+}
+
+// exchangeTimeout 以 timeout 为超时时间向指定上游发送查询，见 exchangeContext
+func (s *Server) exchangeTimeout(m *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.exchangeContext(ctx, m, addr)
+}
+
+// upstreamTimeout 返回查询 domain 时上游查询的超时时间：匹配的域名规则设置了 upstream_timeout 时使用该值，
+// 否则使用 upstream.timeout
+func (s *Server) upstreamTimeout(domain string) time.Duration {
+	if rule := s.config.GetDomainRule(normalizeDomain(domain)); rule != nil && rule.UpstreamTimeout > 0 {
+		return rule.UpstreamTimeout
+	}
+	return s.config.Upstream.Timeout
+}
+
+// exchangeMerged 以 timeout 为超时时间并行向 addrs 中的所有上游发送查询，合并成功的响应（见 upstream.MergeResponses）。
+// 全部失败时返回第一个上游的错误
+func (s *Server) exchangeMerged(m *dns.Msg, addrs []string, timeout time.Duration) (*dns.Msg, error) {
+	resps := make([]*dns.Msg, len(addrs))
+	errs := make([]error, len(addrs))
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			resps[i], _, errs[i] = s.exchangeTimeout(m.Copy(), addr, timeout)
+			if errs[i] != nil {
+				log.Printf("合并查询上游 %s 失败: %v", addr, errs[i])
+			}
+		}(i, addr)
+	}
+	wg.Wait()
+
+	if merged := upstream.MergeResponses(resps); merged != nil {
+		return merged, nil
+	}
+	return nil, errs[0]
+}
+
+// dohResolver 返回指定地址的 DoH / JSON DoH / TSIG 签名 DNS 解析器，首次使用时按当前配置创建，之后复用其连接与密钥
+func (s *Server) dohResolver(addr string) upstream.Resolver {
+	s.resolverMu.Lock()
+	defer s.resolverMu.Unlock()
+
+	if r, ok := s.dohResolvers[addr]; ok {
+		return r
+	}
+	if s.dohResolvers == nil {
+		s.dohResolvers = make(map[string]upstream.Resolver)
+	}
+	var r upstream.Resolver
+	if s.isJSONDoH(addr) {
+		r = upstream.NewHTTPSResolver(addr, upstreamOptions(&s.config.Upstream))
+	} else {
+		r = upstream.New(addr, upstreamOptions(&s.config.Upstream))
+	}
+	s.dohResolvers[addr] = r
+	return r
+}
+
+// isJSONDoH 判断地址是否为通过 JSON API 查询的主上游 (upstream.protocol: json-doh)
+func (s *Server) isJSONDoH(addr string) bool {
+	return s.config.Upstream.Protocol == config.UpstreamProtocolJSONDoH && addr == s.config.Upstream.JSONDoHURL
+}
+
+// resetResolvers 丢弃已创建的 DoH 解析器，配置变更后按新配置重新创建
+func (s *Server) resetResolvers() {
+	s.resolverMu.Lock()
+	defer s.resolverMu.Unlock()
+	s.dohResolvers = nil
+}
+
+// upstreamOptions 根据上游配置构造解析器参数
+func upstreamOptions(cfg *config.UpstreamConfig) upstream.Options {
+	return upstream.Options{
+		Timeout:         cfg.Timeout,
+		UserAgent:       cfg.UserAgent,
+		MaxIdleConns:    cfg.MaxIdleConns,
+		MaxConnsPerHost: cfg.MaxConnsPerHost,
+		IdleConnTimeout: cfg.IdleConnTimeout,
+		TSIG:            cfg.TSIGKey(),
+
+		HTTPProxy:         cfg.HTTPProxy,
+		HTTPProxyUser:     cfg.HTTPProxyUser,
+		HTTPProxyPassword: cfg.HTTPProxyPassword,
+	}
+}
@@ -0,0 +1,118 @@
+package dns
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/hao/fxdns/internal/metrics"
+	"github.com/miekg/dns"
+)
+
+// TestQuery 以本机客户端的身份对域名执行一次完整的查询流程（包括缓存、上游查询与 CDN 处理），返回最终响应
+func (s *Server) TestQuery(domain string, qtype uint16) (*dns.Msg, error) {
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn(domain), qtype)
+	return s.query(req, nil)
+}
+
+// query 以 remote 为客户端地址（为 nil 时视为本机）将请求交给 ServeDNS 处理，返回写出的响应
+func (s *Server) query(req *dns.Msg, remote net.Addr) (*dns.Msg, error) {
+	w := &captureResponseWriter{remote: remote}
+	s.ServeDNS(w, req)
+	if w.msg == nil {
+		name := ""
+		if len(req.Question) > 0 {
+			name = req.Question[0].Name
+		}
+		return nil, fmt.Errorf("查询 %s 未得到响应", name)
+	}
+	return w.msg, nil
+}
+
+// startCacheWarm 在配置了 cache_warm.domains 时启动缓存预热，WaitReady 会等待预热完成。
+// 调用此方法时，调用者应持有 s.mu 的锁。
+func (s *Server) startCacheWarm() {
+	domains := s.config.CacheWarm.Domains
+	if len(domains) == 0 {
+		return
+	}
+	concurrency := s.config.CacheWarm.Concurrency
+	if concurrency <= 0 {
+		concurrency = config.DefaultCacheWarmConcurrency
+	}
+
+	done := make(chan struct{})
+	s.readyMu.Lock()
+	s.warmed = done
+	s.readyMu.Unlock()
+
+	go func() {
+		defer close(done)
+		s.warmCache(domains, concurrency)
+	}()
+}
+
+// warmCache 以给定并发数查询所有预热域名，结果由 ServeDNS 写入缓存
+func (s *Server) warmCache(domains []string, concurrency int) {
+	log.Printf("DNS Server: 开始缓存预热，共 %d 个域名，并发数 %d", len(domains), concurrency)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		finished int
+	)
+	sem := make(chan struct{}, concurrency)
+	for _, domain := range domains {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(domain string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			resp, err := s.TestQuery(domain, dns.TypeA)
+			mu.Lock()
+			finished++
+			progress := finished
+			mu.Unlock()
+			if err != nil || resp.Rcode == dns.RcodeServerFailure {
+				log.Printf("DNS Server: 缓存预热 %s 失败 (%d/%d): %v", domain, progress, len(domains), err)
+				return
+			}
+			metrics.CacheWarmCount.Inc()
+			log.Printf("DNS Server: 缓存预热 %s 完成 (%d/%d)", domain, progress, len(domains))
+		}(domain)
+	}
+	wg.Wait()
+	log.Printf("DNS Server: 缓存预热结束")
+}
+
+// captureResponseWriter 记录写出的响应，用于服务器内部发起的查询及 DoH 请求
+type captureResponseWriter struct {
+	msg    *dns.Msg
+	remote net.Addr // 客户端地址，为 nil 时视为本机
+}
+
+func (w *captureResponseWriter) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}
+}
+func (w *captureResponseWriter) RemoteAddr() net.Addr {
+	if w.remote != nil {
+		return w.remote
+	}
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+}
+
+// WriteMsg 记录响应
+func (w *captureResponseWriter) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return nil
+}
+
+func (w *captureResponseWriter) Write([]byte) (int, error) { return 0, nil }
+func (w *captureResponseWriter) Close() error              { return nil }
+func (w *captureResponseWriter) TsigStatus() error         { return errTSIGUnverified }
+func (w *captureResponseWriter) TsigTimersOnly(bool)       {}
+func (w *captureResponseWriter) Hijack()                   {}
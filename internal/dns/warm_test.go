@@ -0,0 +1,70 @@
+package dns
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hao/fxdns/internal/metrics"
+	"github.com/miekg/dns"
+)
+
+func TestCacheWarm(t *testing.T) {
+	var mu sync.Mutex
+	queried := make(map[string]int)
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		mu.Lock()
+		queried[r.Question[0].Name]++
+		mu.Unlock()
+		w.WriteMsg(answerA(r, "10.1.1.1"))
+	})
+
+	server := newTestServer(t, `
+upstream:
+  server: "`+upstream+`"
+  timeout: 1s
+server:
+  listen: "127.0.0.1:0"
+  workers: 4
+  cache_size: 10
+  cache_ttl: 60s
+cdn_ips:
+  - "10.0.0.0/8"
+cache_warm:
+  concurrency: 2
+  domains:
+    - "a.example.com"
+    - "b.example.com"
+    - "c.example.com"
+`)
+	before := metrics.CacheWarmCount.Value()
+	if err := server.Start(); err != nil {
+		t.Fatalf("启动服务器失败: %v", err)
+	}
+	defer server.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := server.WaitReady(ctx); err != nil {
+		t.Fatalf("等待就绪失败: %v", err)
+	}
+
+	// WaitReady 返回时预热查询已完成并写入缓存
+	for _, name := range []string{"a.example.com.", "b.example.com.", "c.example.com."} {
+		mu.Lock()
+		n := queried[name]
+		mu.Unlock()
+		if n != 1 {
+			t.Errorf("%s 的预热查询次数错误, 期望: 1, 实际: %d", name, n)
+		}
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		if server.checkCache(req) == nil {
+			t.Errorf("%s 未被预热到缓存中", name)
+		}
+	}
+	if got := metrics.CacheWarmCount.Value() - before; got != 3 {
+		t.Errorf("CacheWarmCount 增量错误, 期望: 3, 实际: %d", got)
+	}
+}
@@ -0,0 +1,84 @@
+package dns
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"net"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/miekg/dns"
+)
+
+// clientSeed 根据客户端 IP 计算随机种子，同一客户端总是得到相同的种子
+func clientSeed(ip net.IP) int64 {
+	h := fnv.New64a()
+	if ip4 := ip.To4(); ip4 != nil {
+		h.Write(ip4)
+	} else {
+		h.Write(ip)
+	}
+	return int64(h.Sum64())
+}
+
+// selectCDNIPs 使用给定种子从 ips 中稳定地随机选出 n 个，保持其在原列表中的相对顺序。
+// n <= 0 或 n >= len(ips) 时返回全部。
+func selectCDNIPs(ips []net.IP, n int, seed int64) []net.IP {
+	if n <= 0 || n >= len(ips) {
+		return ips
+	}
+	picked := make([]bool, len(ips))
+	for _, i := range rand.New(rand.NewSource(seed)).Perm(len(ips))[:n] {
+		picked[i] = true
+	}
+	selected := make([]net.IP, 0, n)
+	for i, ip := range ips {
+		if picked[i] {
+			selected = append(selected, ip)
+		}
+	}
+	return selected
+}
+
+// applyWeight 对 return_cdn_a 策略且配置了 weight 的域名，从响应的 CDN A 记录中为客户端选出 weight 个。
+// 选择以客户端 IP 为种子，同一客户端在 CDN IP 列表不变时总是得到相同的结果。
+// 缓存中保存的是完整响应，选择在写出前进行，因此不同客户端共享缓存时互不影响。
+func (s *Server) applyWeight(resp *dns.Msg, clientIP net.IP) *dns.Msg {
+	if resp == nil || len(resp.Question) == 0 {
+		return resp
+	}
+	rule := s.config.GetDomainRule(normalizeDomain(resp.Question[0].Name))
+	if rule == nil || rule.Strategy != config.StrategyReturnCDNA || rule.Weight <= 0 {
+		return resp
+	}
+
+	var ips []net.IP
+	for _, rr := range resp.Answer {
+		a, ok := rr.(*dns.A)
+		if !ok {
+			continue
+		}
+		// 仅处理全部为 CDN IP 的响应（即 return_cdn_a 生成的响应），回退等路径的响应原样返回
+		if !s.cidrMatcher.Contains(a.A) {
+			return resp
+		}
+		ips = append(ips, a.A)
+	}
+	if rule.Weight >= len(ips) {
+		return resp
+	}
+
+	keep := make(map[string]bool, rule.Weight)
+	for _, ip := range selectCDNIPs(ips, rule.Weight, clientSeed(clientIP)) {
+		keep[ip.String()] = true
+	}
+	weighted := resp.Copy()
+	answer := weighted.Answer[:0]
+	for _, rr := range weighted.Answer {
+		if a, ok := rr.(*dns.A); ok && !keep[a.A.String()] {
+			continue
+		}
+		answer = append(answer, rr)
+	}
+	weighted.Answer = answer
+	return weighted
+}
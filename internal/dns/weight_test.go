@@ -0,0 +1,108 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/hao/fxdns/internal/config"
+	"github.com/hao/fxdns/internal/util"
+	"github.com/miekg/dns"
+)
+
+func testCDNIPs(n int) []net.IP {
+	ips := make([]net.IP, n)
+	for i := range ips {
+		ips[i] = net.ParseIP(fmt.Sprintf("10.0.0.%d", i+1))
+	}
+	return ips
+}
+
+func TestSelectCDNIPs(t *testing.T) {
+	ips := testCDNIPs(5)
+
+	// 数量
+	for _, n := range []int{0, 1, 3, 5, 8} {
+		expected := n
+		if n <= 0 || n >= len(ips) {
+			expected = len(ips)
+		}
+		if got := selectCDNIPs(ips, n, 42); len(got) != expected {
+			t.Errorf("weight=%d 时返回数量错误, 期望: %d, 实际: %d", n, expected, len(got))
+		}
+	}
+
+	// 相同种子结果稳定，且保持原有顺序
+	first := selectCDNIPs(ips, 2, 42)
+	second := selectCDNIPs(ips, 2, 42)
+	for i := range first {
+		if !first[i].Equal(second[i]) {
+			t.Fatalf("相同种子的选择结果不一致: %v / %v", first, second)
+		}
+	}
+	if first[0][15] > first[1][15] {
+		t.Errorf("选择结果应保持原有顺序: %v", first)
+	}
+
+	// 不同种子下各 IP 被选中的次数大致均匀
+	const rounds = 10000
+	counts := make(map[string]int)
+	for seed := int64(0); seed < rounds; seed++ {
+		for _, ip := range selectCDNIPs(ips, 2, seed) {
+			counts[ip.String()]++
+		}
+	}
+	expected := rounds * 2 / len(ips)
+	for _, ip := range ips {
+		if c := counts[ip.String()]; c < expected*9/10 || c > expected*11/10 {
+			t.Errorf("IP %s 被选中次数分布不均, 期望约: %d, 实际: %d", ip, expected, c)
+		}
+	}
+}
+
+func TestApplyWeight(t *testing.T) {
+	cidrMatcher := util.NewCIDRMatcher()
+	cidrMatcher.AddCIDRs([]string{"10.0.0.0/8"})
+	server := &Server{
+		config: &config.Config{
+			Domains: []config.DomainRule{
+				{Pattern: "cdn.example.com", Strategy: config.StrategyReturnCDNA, Weight: 2},
+				{Pattern: "all.example.com", Strategy: config.StrategyReturnCDNA},
+			},
+		},
+		cidrMatcher: cidrMatcher,
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("cdn.example.com.", dns.TypeA)
+	resp := server.returnCDNARecords(req, testCDNIPs(4))
+
+	clientA := net.ParseIP("192.0.2.10")
+	got := server.applyWeight(resp, clientA)
+	if len(got.Answer) != 2 {
+		t.Fatalf("返回的 A 记录数量错误, 期望: 2, 实际: %d", len(got.Answer))
+	}
+	if len(resp.Answer) != 4 {
+		t.Error("原始响应（缓存内容）不应被修改")
+	}
+	again := server.applyWeight(resp, clientA)
+	for i := range got.Answer {
+		if got.Answer[i].String() != again.Answer[i].String() {
+			t.Errorf("同一客户端的选择结果应保持一致: %v / %v", got.Answer, again.Answer)
+		}
+	}
+
+	// 未配置 weight 的域名返回全部
+	req.SetQuestion("all.example.com.", dns.TypeA)
+	resp = server.returnCDNARecords(req, testCDNIPs(4))
+	if got := server.applyWeight(resp, clientA); len(got.Answer) != 4 {
+		t.Errorf("未配置 weight 时应返回全部记录, 实际: %d", len(got.Answer))
+	}
+
+	// 包含非 CDN IP 的响应（如备用上游结果）原样返回
+	req.SetQuestion("cdn.example.com.", dns.TypeA)
+	resp = server.returnCDNARecords(req, append(testCDNIPs(3), net.ParseIP("198.51.100.1")))
+	if got := server.applyWeight(resp, clientA); len(got.Answer) != 4 {
+		t.Errorf("包含非 CDN IP 的响应不应被裁剪, 实际: %d", len(got.Answer))
+	}
+}
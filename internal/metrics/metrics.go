@@ -0,0 +1,224 @@
+// Package metrics 提供进程内的运行指标，并以 Prometheus 文本格式导出
+package metrics
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter 并发安全的单调递增计数器
+type Counter struct {
+	name  string
+	help  string
+	value atomic.Uint64
+}
+
+// Gauge 并发安全的可增可减的数值指标
+type Gauge struct {
+	name  string
+	help  string
+	value atomic.Int64
+}
+
+// GaugeMap 并发安全的按标签值区分的浮点数值指标，导出为 name{label="key"} 形式的多条样本
+type GaugeMap struct {
+	name   string
+	help   string
+	label  string
+	mu     sync.RWMutex
+	values map[string]float64
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []*Counter
+	gauges     []*Gauge
+	gaugeMaps  []*GaugeMap
+)
+
+// NewCounter 创建计数器并注册到全局指标列表
+func NewCounter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	registryMu.Lock()
+	registry = append(registry, c)
+	registryMu.Unlock()
+	return c
+}
+
+// Inc 计数加一
+func (c *Counter) Inc() { c.value.Add(1) }
+
+// Add 计数增加 n
+func (c *Counter) Add(n uint64) { c.value.Add(n) }
+
+// Value 返回当前计数
+func (c *Counter) Value() uint64 { return c.value.Load() }
+
+// Name 返回指标名称
+func (c *Counter) Name() string { return c.name }
+
+// NewGauge 创建数值指标并注册到全局指标列表
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	registryMu.Lock()
+	gauges = append(gauges, g)
+	registryMu.Unlock()
+	return g
+}
+
+// Set 设置当前值
+func (g *Gauge) Set(v int64) { g.value.Store(v) }
+
+// Add 当前值增加 delta，delta 可以为负数
+func (g *Gauge) Add(delta int64) { g.value.Add(delta) }
+
+// Value 返回当前值
+func (g *Gauge) Value() int64 { return g.value.Load() }
+
+// Name 返回指标名称
+func (g *Gauge) Name() string { return g.name }
+
+// NewGaugeMap 创建以 label 区分样本的数值指标并注册到全局指标列表
+func NewGaugeMap(name, help, label string) *GaugeMap {
+	g := &GaugeMap{name: name, help: help, label: label, values: make(map[string]float64)}
+	registryMu.Lock()
+	gaugeMaps = append(gaugeMaps, g)
+	registryMu.Unlock()
+	return g
+}
+
+// Set 设置标签值为 key 的样本
+func (g *GaugeMap) Set(key string, v float64) {
+	g.mu.Lock()
+	g.values[key] = v
+	g.mu.Unlock()
+}
+
+// Delete 删除标签值为 key 的样本
+func (g *GaugeMap) Delete(key string) {
+	g.mu.Lock()
+	delete(g.values, key)
+	g.mu.Unlock()
+}
+
+// Snapshot 返回当前所有样本的副本
+func (g *GaugeMap) Snapshot() map[string]float64 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	values := make(map[string]float64, len(g.values))
+	for k, v := range g.values {
+		values[k] = v
+	}
+	return values
+}
+
+// Name 返回指标名称
+func (g *GaugeMap) Name() string { return g.name }
+
+// WritePrometheus 以 Prometheus 文本格式输出所有已注册的指标
+func WritePrometheus(w io.Writer) error {
+	registryMu.Lock()
+	counters := make([]*Counter, len(registry))
+	copy(counters, registry)
+	gaugeList := make([]*Gauge, len(gauges))
+	copy(gaugeList, gauges)
+	gaugeMapList := make([]*GaugeMap, len(gaugeMaps))
+	copy(gaugeMapList, gaugeMaps)
+	registryMu.Unlock()
+
+	for _, c := range counters {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", c.name, c.help, c.name, c.name, c.Value()); err != nil {
+			return err
+		}
+	}
+	for _, g := range gaugeList {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", g.name, g.help, g.name, g.name, g.Value()); err != nil {
+			return err
+		}
+	}
+	for _, g := range gaugeMapList {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name); err != nil {
+			return err
+		}
+		values := g.Snapshot()
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if _, err := fmt.Fprintf(w, "%s{%s=%q} %g\n", g.name, g.label, k, values[k]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Handler 返回输出所有指标的 HTTP 处理器
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WritePrometheus(w)
+	})
+}
+
+// RequireBearerToken 包装 h，要求请求携带 Authorization: Bearer <token>，缺失或不匹配时返回 401。
+// token 在每次请求时调用以支持热加载，返回空字符串时不做校验。
+func RequireBearerToken(token func() string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expected := token()
+		if expected != "" {
+			// 使用常量时间比较，避免通过响应时间逐字节猜测 token
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(expected)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// 运行指标
+var (
+	// CacheWarmCount 启动时缓存预热成功的查询数
+	CacheWarmCount = NewCounter("fxdns_cache_warm_total", "启动时缓存预热成功的域名数")
+	// AAAASuppressCount 因域名规则 force_a_only 未转发而直接返回空响应的 AAAA 查询数
+	AAAASuppressCount = NewCounter("fxdns_aaaa_suppressed_total", "按 force_a_only 直接返回空响应的 AAAA 查询数")
+	// ListenerMigrationCount listen 变更时平滑迁移监听的次数
+	ListenerMigrationCount = NewCounter("fxdns_listener_migrations_total", "listen 变更时平滑迁移监听的次数")
+	// InvalidResponseCount 未通过 validate_responses 检查的主上游响应数
+	InvalidResponseCount = NewCounter("fxdns_upstream_invalid_responses_total", "未通过合理性检查的主上游响应数")
+	// CDNOwnershipRejectCount 因 PTR 记录不匹配 cdn_ownership_pattern 而不视为 CDN IP 的次数
+	CDNOwnershipRejectCount = NewCounter("fxdns_cdn_ownership_rejected_total", "PTR 记录未通过所有权校验的 CDN IP 数")
+	// UpstreamValidationFailures 未通过 strict_validation 检查 (ID 或问题段与查询不对应) 的上游响应数
+	UpstreamValidationFailures = NewCounter("fxdns_upstream_validation_failures_total", "ID 或问题段与查询不对应的上游响应数")
+	// CIDRWarmCacheMissCount CIDR 匹配器预热后查询了未预热地址的次数
+	CIDRWarmCacheMissCount = NewCounter("fxdns_cidr_warm_cache_misses_total", "CIDR 匹配器预热后查询未预热地址的次数")
+	// StaleServedCount stale_while_revalidate 模式下返回过期缓存响应的次数
+	StaleServedCount = NewCounter("fxdns_cache_stale_served_total", "返回过期缓存响应并在后台刷新的次数")
+	// RebindingBlockedCount rebinding_protection 从应答中去掉的内网地址数
+	RebindingBlockedCount = NewCounter("fxdns_rebinding_blocked_total", "防 DNS 重绑定从应答中去掉的内网地址数")
+	// CNAMEViolations 因 enforce_single_cname 返回 SERVFAIL 的查询数
+	CNAMEViolations = NewCounter("fxdns_cname_violations_total", "CNAME 链超过一层而返回 SERVFAIL 的查询数")
+	// RPZHitCount 命中 RPZ 规则的查询数
+	RPZHitCount = NewCounter("fxdns_rpz_hits_total", "命中 RPZ 规则的查询数")
+	// CircuitOpenCount 上游熔断器从关闭转为打开的次数
+	CircuitOpenCount = NewCounter("fxdns_upstream_circuit_opened_total", "上游连续失败触发熔断的次数")
+	// CircuitRejectCount 因上游熔断打开而未发送到上游的查询数
+	CircuitRejectCount = NewCounter("fxdns_upstream_circuit_rejected_total", "因上游熔断打开而未发送的查询数")
+	// QueriesDropped 超过 max_concurrent_queries 而直接返回 REFUSED 的查询数
+	QueriesDropped = NewCounter("fxdns_queries_dropped_total", "超过并发查询上限而返回 REFUSED 的查询数")
+	// OpenCircuits 当前处于打开或半开状态的上游熔断器数
+	OpenCircuits = NewGauge("fxdns_upstream_circuits_open", "当前处于打开或半开状态的上游熔断器数")
+	// UpstreamEWMA load_balance 为 latency 时各主上游 RTT 的指数加权移动平均值，单位为毫秒
+	UpstreamEWMA = NewGaugeMap("fxdns_upstream_ewma_rtt_ms", "主上游 RTT 的指数加权移动平均值 (毫秒)", "upstream")
+)
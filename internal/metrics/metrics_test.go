@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCounterPrometheusOutput(t *testing.T) {
+	c := NewCounter("fxdns_test_total", "Test counter.")
+	c.Inc()
+	c.Add(2)
+	if c.Value() != 3 {
+		t.Fatalf("计数错误, 期望: 3, 实际: %d", c.Value())
+	}
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# HELP fxdns_test_total Test counter.",
+		"# TYPE fxdns_test_total counter",
+		"fxdns_test_total 3",
+		"# TYPE fxdns_cache_warm_total counter",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("输出中缺少 %q:\n%s", line, body)
+		}
+	}
+}
+
+func TestGaugePrometheusOutput(t *testing.T) {
+	g := NewGauge("fxdns_test_gauge", "Test gauge.")
+	g.Add(3)
+	g.Add(-1)
+	if g.Value() != 2 {
+		t.Fatalf("数值错误, 期望: 2, 实际: %d", g.Value())
+	}
+
+	var buf strings.Builder
+	if err := WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# HELP fxdns_test_gauge Test gauge.",
+		"# TYPE fxdns_test_gauge gauge",
+		"fxdns_test_gauge 2",
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("输出中缺少 %q:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestGaugeMapPrometheusOutput(t *testing.T) {
+	g := NewGaugeMap("fxdns_test_gauge_map", "Test gauge map.", "upstream")
+	g.Set("b:53", 2.5)
+	g.Set("a:53", 10)
+	g.Set("c:53", 1)
+	g.Delete("c:53")
+	if snap := g.Snapshot(); len(snap) != 2 || snap["b:53"] != 2.5 {
+		t.Fatalf("Snapshot 错误: %v", snap)
+	}
+
+	var buf strings.Builder
+	if err := WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "# HELP fxdns_test_gauge_map Test gauge map.\n# TYPE fxdns_test_gauge_map gauge\n" +
+		"fxdns_test_gauge_map{upstream=\"a:53\"} 10\nfxdns_test_gauge_map{upstream=\"b:53\"} 2.5\n"
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("输出中缺少按标签排序的样本 %q:\n%s", want, buf.String())
+	}
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"time"
+)
+
+// StatsDPrefix StatsD 指标名称的命名空间前缀
+const StatsDPrefix = "fxdns."
+
+// StatsDClient 以 StatsD 文本协议 (<name>:<value>|<type>) 通过 UDP 发送指标，每个指标一个数据报。
+// 发送失败不影响调用方；所有方法可被多个协程并发调用，nil 客户端的方法不做任何事
+type StatsDClient struct {
+	conn net.Conn
+	addr string
+	// Debug 为 true 时以调试日志记录发送失败。统计服务不可用时每个指标都会失败，默认不记录以免日志刷屏
+	Debug bool
+}
+
+// NewStatsDClient 创建发往 addr (host:port) 的 StatsD 客户端。UDP 无连接，地址可解析即创建成功
+func NewStatsDClient(addr string) (*StatsDClient, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("连接 StatsD 服务 %s 失败: %w", addr, err)
+	}
+	return &StatsDClient{conn: conn, addr: addr}, nil
+}
+
+// Addr 返回 StatsD 服务地址
+func (c *StatsDClient) Addr() string {
+	if c == nil {
+		return ""
+	}
+	return c.addr
+}
+
+// Count 发送计数器指标 fxdns.<name>，增加 n
+func (c *StatsDClient) Count(name string, n int64) {
+	c.send(name, fmt.Sprintf("%d|c", n))
+}
+
+// Incr 发送计数器指标 fxdns.<name>，增加 1
+func (c *StatsDClient) Incr(name string) {
+	c.Count(name, 1)
+}
+
+// Timing 发送计时指标 fxdns.<name>，单位为毫秒
+func (c *StatsDClient) Timing(name string, d time.Duration) {
+	c.send(name, fmt.Sprintf("%.3f|ms", float64(d)/float64(time.Millisecond)))
+}
+
+// Gauge 发送数值指标 fxdns.<name>
+func (c *StatsDClient) Gauge(name string, v int64) {
+	c.send(name, fmt.Sprintf("%d|g", v))
+}
+
+// send 写入一条 <前缀><name>:<value> 数据报
+func (c *StatsDClient) send(name, value string) {
+	if c == nil {
+		return
+	}
+	if _, err := c.conn.Write([]byte(StatsDPrefix + name + ":" + value)); err != nil && c.Debug {
+		log.Printf("[DEBUG] 发送 StatsD 指标 %s 到 %s 失败: %v", name, c.addr, err)
+	}
+}
+
+// Close 关闭底层的 UDP 连接
+func (c *StatsDClient) Close() error {
+	if c == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
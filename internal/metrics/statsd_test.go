@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startMockStatsD 启动本地 UDP 服务，返回其地址与接收到的数据报
+func startMockStatsD(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听 UDP 失败: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	packets := make(chan string, 16)
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			packets <- string(buf[:n])
+		}
+	}()
+	return conn.LocalAddr().String(), packets
+}
+
+// receive 读取一个数据报，超时时测试失败
+func receive(t *testing.T, packets <-chan string) string {
+	t.Helper()
+	select {
+	case p := <-packets:
+		return p
+	case <-time.After(2 * time.Second):
+		t.Fatal("等待 StatsD 数据报超时")
+	}
+	return ""
+}
+
+func TestStatsDClient(t *testing.T) {
+	addr, packets := startMockStatsD(t)
+	client, err := NewStatsDClient(addr)
+	if err != nil {
+		t.Fatalf("创建 StatsD 客户端失败: %v", err)
+	}
+	defer client.Close()
+
+	client.Incr("queries")
+	client.Count("cache.hit", 3)
+	client.Timing("upstream.latency", 1500*time.Microsecond)
+	client.Gauge("open_circuits", 2)
+
+	for _, want := range []string{
+		"fxdns.queries:1|c",
+		"fxdns.cache.hit:3|c",
+		"fxdns.upstream.latency:1.500|ms",
+		"fxdns.open_circuits:2|g",
+	} {
+		if got := receive(t, packets); got != want {
+			t.Errorf("数据报期望 %q, 实际 %q", want, got)
+		}
+	}
+}
+
+func TestStatsDClientWriteFailure(t *testing.T) {
+	// 发往无人监听的端口时，写入失败（ICMP 端口不可达）不应影响调用方
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听 UDP 失败: %v", err)
+	}
+	addr := conn.LocalAddr().String()
+	conn.Close()
+
+	client, err := NewStatsDClient(addr)
+	if err != nil {
+		t.Fatalf("创建 StatsD 客户端失败: %v", err)
+	}
+	client.Debug = true
+	for i := 0; i < 3; i++ {
+		client.Incr("queries")
+	}
+	client.Close()
+	// 关闭后写入同样只记录日志
+	client.Incr("queries")
+}
+
+func TestStatsDClientNil(t *testing.T) {
+	var client *StatsDClient
+	client.Incr("queries")
+	client.Timing("upstream.latency", time.Millisecond)
+	if client.Addr() != "" || client.Close() != nil {
+		t.Error("nil 客户端的方法不应做任何事")
+	}
+}
+
+func TestNewStatsDClientInvalidAddress(t *testing.T) {
+	if _, err := NewStatsDClient("127.0.0.1"); err == nil || !strings.Contains(err.Error(), "127.0.0.1") {
+		t.Errorf("缺少端口的地址应返回错误, 实际: %v", err)
+	}
+}
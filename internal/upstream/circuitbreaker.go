@@ -0,0 +1,122 @@
+package upstream
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrCircuitOpen 上游熔断处于打开状态，查询未发送
+var ErrCircuitOpen = errors.New("上游熔断已打开")
+
+// CircuitState 熔断器状态
+type CircuitState int32
+
+const (
+	CircuitClosed   CircuitState = iota // 正常转发
+	CircuitOpen                         // 拒绝转发，等待 open_duration 结束
+	CircuitHalfOpen                     // 放行一个探测查询，根据结果关闭或重新打开
+)
+
+// String 返回状态名称
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker 单个上游的熔断器：window 内连续失败 threshold 次后打开，
+// 打开 openDuration 后进入半开状态并只放行一个探测查询，探测成功则关闭，失败则重新打开。
+// 所有状态保存在原子变量中，可被多个协程并发使用
+type CircuitBreaker struct {
+	threshold    int32
+	window       time.Duration
+	openDuration time.Duration
+
+	state       atomic.Int32
+	failures    atomic.Int32
+	windowStart atomic.Int64 // 本轮连续失败中第一次失败的时间 (UnixNano)
+	openedAt    atomic.Int64 // 最近一次打开的时间 (UnixNano)
+
+	now func() time.Time
+}
+
+// NewCircuitBreaker 创建熔断器，threshold 必须大于 0
+func NewCircuitBreaker(threshold int, window, openDuration time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold:    int32(threshold),
+		window:       window,
+		openDuration: openDuration,
+		now:          time.Now,
+	}
+}
+
+// State 返回当前状态
+func (b *CircuitBreaker) State() CircuitState {
+	return CircuitState(b.state.Load())
+}
+
+// Allow 判断是否可以向上游发送查询。打开状态下 openDuration 已过时转为半开，
+// 只有完成这次转换的调用方获得探测机会，其余调用在探测结果返回前仍被拒绝
+func (b *CircuitBreaker) Allow() bool {
+	switch b.State() {
+	case CircuitClosed:
+		return true
+	case CircuitOpen:
+		if b.now().UnixNano()-b.openedAt.Load() < int64(b.openDuration) {
+			return false
+		}
+		return b.state.CompareAndSwap(int32(CircuitOpen), int32(CircuitHalfOpen))
+	}
+	return false
+}
+
+// Success 记录一次成功的查询，半开状态下关闭熔断。
+// 从非关闭状态转为关闭时返回 true
+func (b *CircuitBreaker) Success() bool {
+	switch b.State() {
+	case CircuitClosed:
+		b.failures.Store(0)
+	case CircuitHalfOpen:
+		if b.state.CompareAndSwap(int32(CircuitHalfOpen), int32(CircuitClosed)) {
+			b.failures.Store(0)
+			return true
+		}
+	}
+	return false
+}
+
+// Failure 记录一次失败的查询：关闭状态下累计连续失败次数，达到阈值时打开；半开状态下重新打开。
+// 从关闭状态转为打开时返回 true
+func (b *CircuitBreaker) Failure() bool {
+	now := b.now().UnixNano()
+	switch b.State() {
+	case CircuitClosed:
+		// 距本轮第一次失败已超过 window 时重新计数
+		if b.failures.Load() == 0 || now-b.windowStart.Load() > int64(b.window) {
+			b.windowStart.Store(now)
+			b.failures.Store(0)
+		}
+		if b.failures.Add(1) < b.threshold {
+			return false
+		}
+		b.openedAt.Store(now)
+		return b.state.CompareAndSwap(int32(CircuitClosed), int32(CircuitOpen))
+	case CircuitHalfOpen:
+		b.openedAt.Store(now)
+		b.state.CompareAndSwap(int32(CircuitHalfOpen), int32(CircuitOpen))
+	}
+	return false
+}
+
+// Reset 将熔断器恢复为关闭状态，原状态不是关闭时返回 true
+func (b *CircuitBreaker) Reset() bool {
+	b.failures.Store(0)
+	return CircuitState(b.state.Swap(int32(CircuitClosed))) != CircuitClosed
+}
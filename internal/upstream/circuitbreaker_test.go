@@ -0,0 +1,137 @@
+package upstream
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestBreaker 创建使用可控时钟的熔断器
+func newTestBreaker(threshold int, window, openDuration time.Duration) (*CircuitBreaker, *time.Time) {
+	now := time.Unix(1700000000, 0)
+	b := NewCircuitBreaker(threshold, window, openDuration)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	b, _ := newTestBreaker(3, 10*time.Second, 30*time.Second)
+
+	for i := 0; i < 2; i++ {
+		if b.Failure() {
+			t.Fatalf("第 %d 次失败不应打开熔断", i+1)
+		}
+	}
+	if !b.Allow() {
+		t.Fatal("未达到阈值时应放行")
+	}
+	if !b.Failure() {
+		t.Fatal("达到阈值时应打开熔断")
+	}
+	if b.State() != CircuitOpen {
+		t.Fatalf("期望状态 open, 实际 %s", b.State())
+	}
+	if b.Allow() {
+		t.Error("熔断打开时不应放行")
+	}
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	b, _ := newTestBreaker(2, 10*time.Second, 30*time.Second)
+
+	b.Failure()
+	b.Success()
+	if b.Failure() {
+		t.Error("成功后应重新计数连续失败")
+	}
+	if b.State() != CircuitClosed {
+		t.Errorf("期望状态 closed, 实际 %s", b.State())
+	}
+}
+
+func TestCircuitBreakerWindow(t *testing.T) {
+	b, now := newTestBreaker(2, 10*time.Second, 30*time.Second)
+
+	b.Failure()
+	*now = now.Add(11 * time.Second)
+	if b.Failure() {
+		t.Error("超出 window 的失败不应累计")
+	}
+	*now = now.Add(5 * time.Second)
+	if !b.Failure() {
+		t.Error("window 内连续失败达到阈值时应打开熔断")
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	b, now := newTestBreaker(1, 10*time.Second, 30*time.Second)
+	b.Failure()
+
+	*now = now.Add(31 * time.Second)
+	if !b.Allow() {
+		t.Fatal("open_duration 结束后应放行一个探测查询")
+	}
+	if b.State() != CircuitHalfOpen {
+		t.Fatalf("期望状态 half-open, 实际 %s", b.State())
+	}
+	if b.Allow() {
+		t.Error("半开状态下探测结果返回前不应放行其他查询")
+	}
+
+	// 探测失败重新打开
+	b.Failure()
+	if b.State() != CircuitOpen || b.Allow() {
+		t.Fatalf("探测失败后应重新打开, 实际 %s", b.State())
+	}
+
+	// 再次探测成功后关闭
+	*now = now.Add(31 * time.Second)
+	if !b.Allow() {
+		t.Fatal("open_duration 结束后应再次放行探测查询")
+	}
+	if !b.Success() {
+		t.Error("探测成功应关闭熔断")
+	}
+	if b.State() != CircuitClosed || !b.Allow() {
+		t.Errorf("期望状态 closed, 实际 %s", b.State())
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	b, now := newTestBreaker(1, 10*time.Second, 30*time.Second)
+	b.Failure()
+	*now = now.Add(31 * time.Second)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if b.Allow() {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 1 {
+		t.Errorf("半开状态应只放行 1 个探测查询, 实际 %d", allowed)
+	}
+}
+
+func TestCircuitBreakerReset(t *testing.T) {
+	b, _ := newTestBreaker(1, 10*time.Second, 30*time.Second)
+	if b.Reset() {
+		t.Error("关闭状态下 Reset 应返回 false")
+	}
+	b.Failure()
+	if !b.Reset() {
+		t.Error("打开状态下 Reset 应返回 true")
+	}
+	if b.State() != CircuitClosed || !b.Allow() {
+		t.Errorf("Reset 后期望状态 closed, 实际 %s", b.State())
+	}
+}
@@ -0,0 +1,119 @@
+package upstream
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// dohMediaType RFC 8484 规定的 DNS 消息媒体类型
+const dohMediaType = "application/dns-message"
+
+// DoHResolver 使用 DNS-over-HTTPS (RFC 8484) 查询上游
+type DoHResolver struct {
+	url       string
+	userAgent string
+	client    *http.Client
+}
+
+// NewDoHResolver 创建 DoH 解析器
+func NewDoHResolver(url string, opts Options) *DoHResolver {
+	userAgent := opts.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	return &DoHResolver{
+		url:       url,
+		userAgent: userAgent,
+		client:    &http.Client{Timeout: opts.Timeout, Transport: newTransport(opts)},
+	}
+}
+
+// newTransport 基于 http.DefaultTransport 构造 DoH 使用的连接池，opts 中非 0 的参数覆盖默认值，
+// 配置了 HTTPProxy 时所有请求经由该代理发送
+func newTransport(opts Options) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.MaxIdleConns > 0 {
+		transport.MaxIdleConns = opts.MaxIdleConns
+		// 每个解析器只访问一个主机，默认每主机 2 个空闲连接的限制会使 MaxIdleConns 失去意义
+		transport.MaxIdleConnsPerHost = opts.MaxIdleConns
+	}
+	if opts.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = opts.MaxConnsPerHost
+	}
+	if opts.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = opts.IdleConnTimeout
+	}
+	if opts.HTTPProxy != "" {
+		setProxy(transport, opts)
+	}
+	return transport
+}
+
+// setProxy 使 transport 经由 opts.HTTPProxy 发送请求。配置了用户名时，https:// 上游通过 CONNECT 建立隧道，
+// 认证信息放在 ProxyConnectHeader 中；http:// 上游的请求直接发给代理，认证信息来自代理地址中的用户信息。
+// 代理地址无效时每个请求都返回错误，而不是绕过代理直连
+func setProxy(transport *http.Transport, opts Options) {
+	proxyURL, err := url.Parse(opts.HTTPProxy)
+	if err != nil {
+		err = fmt.Errorf("无效的 HTTP 代理地址 %s: %w", opts.HTTPProxy, err)
+		transport.Proxy = func(*http.Request) (*url.URL, error) { return nil, err }
+		return
+	}
+	if opts.HTTPProxyUser != "" {
+		proxyURL.User = url.UserPassword(opts.HTTPProxyUser, opts.HTTPProxyPassword)
+		auth := base64.StdEncoding.EncodeToString([]byte(opts.HTTPProxyUser + ":" + opts.HTTPProxyPassword))
+		transport.ProxyConnectHeader = http.Header{"Proxy-Authorization": {"Basic " + auth}}
+	}
+	transport.Proxy = http.ProxyURL(proxyURL)
+}
+
+// Exchange 以 POST 方式发送查询。按 RFC 8484 建议，发送时消息 ID 置 0，收到响应后恢复为原 ID
+func (r *DoHResolver) Exchange(m *dns.Msg) (*dns.Msg, time.Duration, error) {
+	query := m.Copy()
+	query.Id = 0
+	buf, err := query.Pack()
+	if err != nil {
+		return nil, 0, fmt.Errorf("打包 DoH 请求失败: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, r.url, bytes.NewReader(buf))
+	if err != nil {
+		return nil, 0, fmt.Errorf("创建 DoH 请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", dohMediaType)
+	req.Header.Set("Accept", dohMediaType)
+	req.Header.Set("User-Agent", r.userAgent)
+
+	start := time.Now()
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("DoH 请求 %s 失败: %w", r.url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	rtt := time.Since(start)
+	if err != nil {
+		return nil, rtt, fmt.Errorf("读取 DoH 响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, rtt, fmt.Errorf("DoH 上游 %s 返回状态码 %d", r.url, resp.StatusCode)
+	}
+
+	answer := new(dns.Msg)
+	if err := answer.Unpack(body); err != nil {
+		return nil, rtt, fmt.Errorf("解析 DoH 响应失败: %w", err)
+	}
+	answer.Id = m.Id
+	return answer, rtt, nil
+}
+
+// Address 实现 Resolver 接口
+func (r *DoHResolver) Address() string { return r.url }
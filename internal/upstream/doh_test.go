@@ -0,0 +1,120 @@
+package upstream
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// startTestDoH 启动一个返回固定 A 记录的 DoH 服务，通过 seen 回传收到的 HTTP 请求
+func startTestDoH(t *testing.T, seen chan<- *http.Request) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- r
+		body, _ := io.ReadAll(r.Body)
+		req := new(dns.Msg)
+		if err := req.Unpack(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		resp.Answer = append(resp.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.ParseIP("10.1.1.1"),
+		})
+		buf, _ := resp.Pack()
+		w.Header().Set("Content-Type", dohMediaType)
+		w.Write(buf)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// newTestDoHResolver 创建信任测试服务证书的 DoH 解析器
+func newTestDoHResolver(ts *httptest.Server, opts Options) *DoHResolver {
+	r := New(ts.URL, opts).(*DoHResolver)
+	r.client.Transport = ts.Client().Transport
+	return r
+}
+
+func TestDoHUserAgent(t *testing.T) {
+	seen := make(chan *http.Request, 1)
+	ts := startTestDoH(t, seen)
+
+	testCases := []struct {
+		userAgent string
+		expected  string
+	}{
+		{"", DefaultUserAgent},
+		{"fxdns-test/2.0", "fxdns-test/2.0"},
+	}
+	for _, tc := range testCases {
+		r := newTestDoHResolver(ts, Options{Timeout: 2 * time.Second, UserAgent: tc.userAgent})
+
+		req := new(dns.Msg)
+		req.SetQuestion("www.example.com.", dns.TypeA)
+		resp, _, err := r.Exchange(req)
+		if err != nil {
+			t.Fatalf("DoH 查询失败: %v", err)
+		}
+
+		httpReq := <-seen
+		if ua := httpReq.Header.Get("User-Agent"); ua != tc.expected {
+			t.Errorf("User-Agent 错误, 期望: %s, 实际: %s", tc.expected, ua)
+		}
+		if ct := httpReq.Header.Get("Content-Type"); ct != dohMediaType {
+			t.Errorf("Content-Type 错误, 期望: %s, 实际: %s", dohMediaType, ct)
+		}
+		if resp.Id != req.Id {
+			t.Errorf("响应 ID 应恢复为请求 ID, 期望: %d, 实际: %d", req.Id, resp.Id)
+		}
+		if len(resp.Answer) != 1 {
+			t.Errorf("响应记录数量错误, 期望: 1, 实际: %d", len(resp.Answer))
+		}
+	}
+}
+
+func TestNewResolver(t *testing.T) {
+	if _, ok := New("https://dns.example/dns-query", Options{}).(*DoHResolver); !ok {
+		t.Error("https:// 地址应创建 DoH 解析器")
+	}
+	if _, ok := New("8.8.8.8:53", Options{}).(*DNSResolver); !ok {
+		t.Error("IP:端口 地址应创建 UDP 解析器")
+	}
+}
+
+func TestDoHTransport(t *testing.T) {
+	r := NewDoHResolver("https://dns.example/dns-query", Options{
+		MaxIdleConns:    256,
+		MaxConnsPerHost: 64,
+		IdleConnTimeout: 30 * time.Second,
+	})
+	transport, ok := r.client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("DoH 客户端应使用 *http.Transport, 实际: %T", r.client.Transport)
+	}
+	if transport.MaxIdleConns != 256 || transport.MaxIdleConnsPerHost != 256 {
+		t.Errorf("空闲连接数错误, MaxIdleConns: %d, MaxIdleConnsPerHost: %d", transport.MaxIdleConns, transport.MaxIdleConnsPerHost)
+	}
+	if transport.MaxConnsPerHost != 64 {
+		t.Errorf("每主机连接数错误, 期望: 64, 实际: %d", transport.MaxConnsPerHost)
+	}
+	if transport.IdleConnTimeout != 30*time.Second {
+		t.Errorf("空闲超时错误, 期望: 30s, 实际: %v", transport.IdleConnTimeout)
+	}
+
+	// 未配置时保留 net/http 的默认值
+	def := http.DefaultTransport.(*http.Transport)
+	transport = NewDoHResolver("https://dns.example/dns-query", Options{}).client.Transport.(*http.Transport)
+	if transport.MaxIdleConns != def.MaxIdleConns || transport.MaxConnsPerHost != def.MaxConnsPerHost ||
+		transport.IdleConnTimeout != def.IdleConnTimeout {
+		t.Errorf("未配置时应使用默认连接池参数, 实际: MaxIdleConns=%d MaxConnsPerHost=%d IdleConnTimeout=%v",
+			transport.MaxIdleConns, transport.MaxConnsPerHost, transport.IdleConnTimeout)
+	}
+}
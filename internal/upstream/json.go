@@ -0,0 +1,172 @@
+package upstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// jsonMediaType Cloudflare JSON API 要求的媒体类型，Google 会忽略此 Accept 头
+const jsonMediaType = "application/dns-json"
+
+// maxJSONResponseSize JSON 响应体的读取上限
+const maxJSONResponseSize = 1 << 20
+
+// HTTPSResolver 通过 JSON API (?name=example.com&type=A) 查询上游，
+// 兼容 Google (dns.google/resolve) 与 Cloudflare (cloudflare-dns.com/dns-query) 两种格式
+type HTTPSResolver struct {
+	url       string
+	userAgent string
+	client    *http.Client
+}
+
+// NewHTTPSResolver 创建 JSON API 解析器，url 为不含查询参数的 API 地址
+func NewHTTPSResolver(url string, opts Options) *HTTPSResolver {
+	userAgent := opts.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	return &HTTPSResolver{
+		url:       url,
+		userAgent: userAgent,
+		client:    &http.Client{Timeout: opts.Timeout, Transport: newTransport(opts)},
+	}
+}
+
+// jsonResponse JSON API 的响应，两种格式共用字段名
+type jsonResponse struct {
+	Status     int          `json:"Status"`
+	TC         bool         `json:"TC"`
+	RD         bool         `json:"RD"`
+	RA         bool         `json:"RA"`
+	AD         bool         `json:"AD"`
+	CD         bool         `json:"CD"`
+	Answer     []jsonRecord `json:"Answer"`
+	Authority  []jsonRecord `json:"Authority"`
+	Additional []jsonRecord `json:"Additional"`
+}
+
+// jsonRecord JSON API 中的一条资源记录
+type jsonRecord struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+	TTL  uint32 `json:"TTL"`
+	Data string `json:"data"`
+}
+
+// Exchange 以 GET 方式发送查询，将 JSON 应答转换为 *dns.Msg。只使用第一个问题
+func (r *HTTPSResolver) Exchange(m *dns.Msg) (*dns.Msg, time.Duration, error) {
+	if len(m.Question) == 0 {
+		return nil, 0, fmt.Errorf("JSON DoH 请求缺少问题")
+	}
+	q := m.Question[0]
+
+	params := url.Values{}
+	params.Set("name", q.Name)
+	params.Set("type", strconv.Itoa(int(q.Qtype)))
+	if m.CheckingDisabled {
+		params.Set("cd", "1")
+	}
+	if opt := m.IsEdns0(); opt != nil && opt.Do() {
+		params.Set("do", "1")
+	}
+	reqURL := r.url + "?" + params.Encode()
+	if strings.Contains(r.url, "?") {
+		reqURL = r.url + "&" + params.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("创建 JSON DoH 请求失败: %w", err)
+	}
+	req.Header.Set("Accept", jsonMediaType)
+	req.Header.Set("User-Agent", r.userAgent)
+
+	start := time.Now()
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("JSON DoH 请求 %s 失败: %w", r.url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxJSONResponseSize))
+	rtt := time.Since(start)
+	if err != nil {
+		return nil, rtt, fmt.Errorf("读取 JSON DoH 响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, rtt, fmt.Errorf("JSON DoH 上游 %s 返回状态码 %d", r.url, resp.StatusCode)
+	}
+
+	var parsed jsonResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, rtt, fmt.Errorf("解析 JSON DoH 响应失败: %w", err)
+	}
+	answer, err := parsed.toMsg(m)
+	if err != nil {
+		return nil, rtt, err
+	}
+	return answer, rtt, nil
+}
+
+// Address 实现 Resolver 接口
+func (r *HTTPSResolver) Address() string { return r.url }
+
+// toMsg 将 JSON 应答转换为对 req 的 DNS 响应
+func (p *jsonResponse) toMsg(req *dns.Msg) (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	msg.SetReply(req)
+	msg.Rcode = p.Status
+	msg.Truncated = p.TC
+	msg.RecursionDesired = p.RD
+	msg.RecursionAvailable = p.RA
+	msg.AuthenticatedData = p.AD
+	msg.CheckingDisabled = p.CD
+
+	var err error
+	if msg.Answer, err = jsonRecordsToRRs(p.Answer); err != nil {
+		return nil, err
+	}
+	if msg.Ns, err = jsonRecordsToRRs(p.Authority); err != nil {
+		return nil, err
+	}
+	if msg.Extra, err = jsonRecordsToRRs(p.Additional); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// jsonRecordsToRRs 将 JSON 记录按区域文件格式解析为资源记录
+func jsonRecordsToRRs(records []jsonRecord) ([]dns.RR, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+	rrs := make([]dns.RR, 0, len(records))
+	for _, rec := range records {
+		typ, ok := dns.TypeToString[rec.Type]
+		if !ok {
+			return nil, fmt.Errorf("JSON DoH 记录 %s 的类型 %d 不受支持", rec.Name, rec.Type)
+		}
+		data := rec.Data
+		// Cloudflare 返回的 TXT 数据带引号，Google 不带
+		if rec.Type == dns.TypeTXT && !strings.HasPrefix(data, `"`) {
+			data = strconv.Quote(data)
+		}
+		// Google 返回的名称带结尾的点，Cloudflare 不带
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(rec.Name), rec.TTL, typ, data))
+		if err != nil {
+			return nil, fmt.Errorf("解析 JSON DoH 记录 %s %s 失败: %w", rec.Name, typ, err)
+		}
+		if rr != nil {
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs, nil
+}
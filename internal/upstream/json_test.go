@@ -0,0 +1,145 @@
+package upstream
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Google JSON API 示例：名称带结尾的点，TXT 数据不带引号
+const googleJSONPayload = `{
+  "Status": 0, "TC": false, "RD": true, "RA": true, "AD": false, "CD": false,
+  "Question": [{"name": "www.example.com.", "type": 1}],
+  "Answer": [
+    {"name": "www.example.com.", "type": 5, "TTL": 300, "data": "cdn.example.net."},
+    {"name": "cdn.example.net.", "type": 1, "TTL": 60, "data": "10.1.1.1"},
+    {"name": "cdn.example.net.", "type": 16, "TTL": 60, "data": "hello world"}
+  ],
+  "Comment": "Response from 192.0.2.1."
+}`
+
+// Cloudflare JSON API 示例：名称不带结尾的点，TXT 数据带引号
+const cloudflareJSONPayload = `{
+  "Status": 0, "TC": false, "RD": true, "RA": true, "AD": true, "CD": false,
+  "Question": [{"name": "www.example.com", "type": 1}],
+  "Answer": [
+    {"name": "www.example.com", "type": 5, "TTL": 300, "data": "cdn.example.net."},
+    {"name": "cdn.example.net", "type": 1, "TTL": 60, "data": "10.1.1.1"},
+    {"name": "cdn.example.net", "type": 16, "TTL": 60, "data": "\"hello world\""}
+  ]
+}`
+
+func TestHTTPSResolverFormats(t *testing.T) {
+	testCases := []struct {
+		name    string
+		payload string
+		ad      bool
+	}{
+		{"Google", googleJSONPayload, false},
+		{"Cloudflare", cloudflareJSONPayload, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			seen := make(chan *http.Request, 1)
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen <- r
+				w.Header().Set("Content-Type", jsonMediaType)
+				w.Write([]byte(tc.payload))
+			}))
+			defer ts.Close()
+
+			r := NewHTTPSResolver(ts.URL+"/resolve", Options{Timeout: 2 * time.Second})
+			req := new(dns.Msg)
+			req.SetQuestion("www.example.com.", dns.TypeA)
+			resp, _, err := r.Exchange(req)
+			if err != nil {
+				t.Fatalf("查询失败: %v", err)
+			}
+
+			got := <-seen
+			if got.Method != http.MethodGet || got.URL.Path != "/resolve" {
+				t.Errorf("请求错误: %s %s", got.Method, got.URL.Path)
+			}
+			if q := got.URL.Query(); q.Get("name") != "www.example.com." || q.Get("type") != "1" {
+				t.Errorf("查询参数错误: %s", got.URL.RawQuery)
+			}
+			if accept := got.Header.Get("Accept"); accept != jsonMediaType {
+				t.Errorf("Accept 错误, 期望: %s, 实际: %s", jsonMediaType, accept)
+			}
+
+			if resp.Id != req.Id || resp.Rcode != dns.RcodeSuccess || !resp.RecursionAvailable || resp.AuthenticatedData != tc.ad {
+				t.Errorf("响应头错误: %v", resp.MsgHdr)
+			}
+			if len(resp.Answer) != 3 {
+				t.Fatalf("应答数量错误, 期望: 3, 实际: %d", len(resp.Answer))
+			}
+			cname, ok := resp.Answer[0].(*dns.CNAME)
+			if !ok || cname.Hdr.Name != "www.example.com." || cname.Target != "cdn.example.net." || cname.Hdr.Ttl != 300 {
+				t.Errorf("CNAME 记录错误: %v", resp.Answer[0])
+			}
+			a, ok := resp.Answer[1].(*dns.A)
+			if !ok || a.Hdr.Name != "cdn.example.net." || a.A.String() != "10.1.1.1" || a.Hdr.Ttl != 60 {
+				t.Errorf("A 记录错误: %v", resp.Answer[1])
+			}
+			txt, ok := resp.Answer[2].(*dns.TXT)
+			if !ok || len(txt.Txt) != 1 || txt.Txt[0] != "hello world" {
+				t.Errorf("TXT 记录错误: %v", resp.Answer[2])
+			}
+		})
+	}
+}
+
+func TestHTTPSResolverNXDomain(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Status": 3, "RD": true, "RA": true,
+  "Authority": [{"name": "example.com.", "type": 6, "TTL": 1800,
+    "data": "ns.example.com. admin.example.com. 2024010101 7200 3600 1209600 3600"}]}`))
+	}))
+	defer ts.Close()
+
+	r := NewHTTPSResolver(ts.URL, Options{Timeout: 2 * time.Second})
+	req := new(dns.Msg)
+	req.SetQuestion("missing.example.com.", dns.TypeA)
+	resp, _, err := r.Exchange(req)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if resp.Rcode != dns.RcodeNameError || len(resp.Answer) != 0 {
+		t.Errorf("应返回 NXDOMAIN: %v", resp)
+	}
+	if len(resp.Ns) != 1 || resp.Ns[0].Header().Rrtype != dns.TypeSOA {
+		t.Errorf("授权段应包含 SOA: %v", resp.Ns)
+	}
+}
+
+func TestHTTPSResolverErrors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		status  int
+		payload string
+	}{
+		{"HTTP 错误", http.StatusBadGateway, `{}`},
+		{"无效 JSON", http.StatusOK, `not json`},
+		{"无效记录", http.StatusOK, `{"Status": 0, "Answer": [{"name": "a.example.com.", "type": 1, "TTL": 60, "data": "not-an-ip"}]}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.payload))
+			}))
+			defer ts.Close()
+
+			r := NewHTTPSResolver(ts.URL, Options{Timeout: 2 * time.Second})
+			req := new(dns.Msg)
+			req.SetQuestion("a.example.com.", dns.TypeA)
+			if _, _, err := r.Exchange(req); err == nil {
+				t.Errorf("应返回错误")
+			}
+		})
+	}
+}
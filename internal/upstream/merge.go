@@ -0,0 +1,103 @@
+package upstream
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// MergeResponses 合并多个上游对同一查询的响应。应答段以基准响应为准：CNAME 链只取自基准响应，
+// 其余响应只贡献各自 CNAME 链终点上的 A/AAAA 记录，并改挂到基准响应的链终点上，
+// 避免不同上游返回的不同 CNAME 目标拼接成互相矛盾的链。重复记录（A/AAAA 按 IP，
+// 其余按记录内容）只保留一条并使用其中最小的 TTL。基准响应为第一个 NOERROR 响应，
+// 没有 NOERROR 响应时为第一个非 nil 响应，响应头、授权段与附加段均取自基准响应。全部为 nil 时返回 nil
+func MergeResponses(msgs []*dns.Msg) *dns.Msg {
+	var base *dns.Msg
+	for _, m := range msgs {
+		if m == nil {
+			continue
+		}
+		if base == nil || (base.Rcode != dns.RcodeSuccess && m.Rcode == dns.RcodeSuccess) {
+			base = m
+		}
+	}
+	if base == nil {
+		return nil
+	}
+
+	merged := base.Copy()
+	merged.Answer = nil
+	index := make(map[string]int) // 去重键 -> merged.Answer 中的位置
+	add := func(rr dns.RR) {
+		key := answerKey(rr)
+		if i, ok := index[key]; ok {
+			if rr.Header().Ttl < merged.Answer[i].Header().Ttl {
+				merged.Answer[i].Header().Ttl = rr.Header().Ttl
+			}
+			return
+		}
+		index[key] = len(merged.Answer)
+		merged.Answer = append(merged.Answer, rr)
+	}
+
+	for _, rr := range base.Answer {
+		add(dns.Copy(rr))
+	}
+	terminal := chainTerminal(base)
+	if terminal == "" {
+		return merged
+	}
+	for _, m := range msgs {
+		if m == nil || m == base || m.Rcode != base.Rcode {
+			continue
+		}
+		owner := chainTerminal(m)
+		for _, rr := range m.Answer {
+			rrtype := rr.Header().Rrtype
+			if (rrtype != dns.TypeA && rrtype != dns.TypeAAAA) || !strings.EqualFold(rr.Header().Name, owner) {
+				continue
+			}
+			c := dns.Copy(rr)
+			c.Header().Name = terminal
+			add(c)
+		}
+	}
+	return merged
+}
+
+// chainTerminal 从问题名开始沿响应中的 CNAME 记录查找链的终点名称，响应没有问题段时返回空字符串
+func chainTerminal(m *dns.Msg) string {
+	if len(m.Question) == 0 {
+		return ""
+	}
+	name := m.Question[0].Name
+	// 最多跟随应答段记录数次，避免 CNAME 环路
+	for range m.Answer {
+		next := ""
+		for _, rr := range m.Answer {
+			if cname, ok := rr.(*dns.CNAME); ok && strings.EqualFold(cname.Hdr.Name, name) {
+				next = cname.Target
+				break
+			}
+		}
+		if next == "" {
+			break
+		}
+		name = next
+	}
+	return name
+}
+
+// answerKey 返回记录的去重键：忽略 TTL 与名称大小写后的记录内容
+func answerKey(rr dns.RR) string {
+	switch v := rr.(type) {
+	case *dns.A:
+		return dns.CanonicalName(v.Hdr.Name) + " A " + v.A.String()
+	case *dns.AAAA:
+		return dns.CanonicalName(v.Hdr.Name) + " AAAA " + v.AAAA.String()
+	}
+	c := dns.Copy(rr)
+	c.Header().Ttl = 0
+	c.Header().Name = dns.CanonicalName(c.Header().Name)
+	return c.String()
+}
@@ -0,0 +1,126 @@
+package upstream
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// mergeRecord 测试响应中的一条 A 记录
+type mergeRecord struct {
+	ip  string
+	ttl uint32
+}
+
+// mergeTestMsg 构造包含给定 A 记录的响应，cname 为 true 时先加入一条 CNAME 并把 A 记录挂在其目标上
+func mergeTestMsg(rcode int, cname bool, records ...mergeRecord) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion("www.example.com.", dns.TypeA)
+	m.Response = true
+	m.Rcode = rcode
+	owner := "www.example.com."
+	if cname {
+		m.Answer = append(m.Answer, &dns.CNAME{
+			Hdr:    dns.RR_Header{Name: owner, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300},
+			Target: "cdn.example.net.",
+		})
+		owner = "cdn.example.net."
+	}
+	for _, r := range records {
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: owner, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: r.ttl},
+			A:   net.ParseIP(r.ip),
+		})
+	}
+	return m
+}
+
+func TestMergeResponses(t *testing.T) {
+	first := mergeTestMsg(dns.RcodeSuccess, true, mergeRecord{"10.1.1.1", 60}, mergeRecord{"1.2.3.4", 300})
+	second := mergeTestMsg(dns.RcodeSuccess, true, mergeRecord{"1.2.3.4", 120}, mergeRecord{"10.2.2.2", 30})
+
+	merged := MergeResponses([]*dns.Msg{nil, first, second})
+	if merged == nil {
+		t.Fatal("合并结果不应为 nil")
+	}
+
+	var cnames int
+	ttls := make(map[string]uint32)
+	for _, rr := range merged.Answer {
+		switch v := rr.(type) {
+		case *dns.CNAME:
+			cnames++
+		case *dns.A:
+			if _, dup := ttls[v.A.String()]; dup {
+				t.Errorf("A 记录 %s 重复", v.A)
+			}
+			ttls[v.A.String()] = v.Hdr.Ttl
+		}
+	}
+	if cnames != 1 {
+		t.Errorf("CNAME 记录应去重, 实际数量: %d", cnames)
+	}
+	expected := map[string]uint32{"10.1.1.1": 60, "1.2.3.4": 120, "10.2.2.2": 30}
+	if len(ttls) != len(expected) {
+		t.Fatalf("A 记录数量错误, 期望: %v, 实际: %v", expected, ttls)
+	}
+	for ip, ttl := range expected {
+		if ttls[ip] != ttl {
+			t.Errorf("%s 的 TTL 错误, 期望: %d, 实际: %d", ip, ttl, ttls[ip])
+		}
+	}
+
+	// 合并不应修改原始响应
+	if first.Answer[2].Header().Ttl != 300 {
+		t.Errorf("原始响应的 TTL 被修改: %d", first.Answer[2].Header().Ttl)
+	}
+}
+
+func TestMergeResponsesDivergentCNAME(t *testing.T) {
+	first := mergeTestMsg(dns.RcodeSuccess, true, mergeRecord{"10.1.1.1", 60})
+	// 第二个上游把同一域名解析到另一个 CNAME 目标
+	second := mergeTestMsg(dns.RcodeSuccess, true, mergeRecord{"10.2.2.2", 60}, mergeRecord{"10.1.1.1", 30})
+	second.Answer[0].(*dns.CNAME).Target = "edge.example.org."
+	for _, rr := range second.Answer[1:] {
+		rr.Header().Name = "edge.example.org."
+	}
+
+	merged := MergeResponses([]*dns.Msg{first, second})
+	var cnames []string
+	ips := make(map[string]uint32)
+	for _, rr := range merged.Answer {
+		switch v := rr.(type) {
+		case *dns.CNAME:
+			cnames = append(cnames, v.Target)
+		case *dns.A:
+			if v.Hdr.Name != "cdn.example.net." {
+				t.Errorf("A 记录应挂在基准响应的链终点上, 实际: %s", v.Hdr.Name)
+			}
+			ips[v.A.String()] = v.Hdr.Ttl
+		}
+	}
+	// CNAME 链只取自基准响应
+	if len(cnames) != 1 || cnames[0] != "cdn.example.net." {
+		t.Errorf("CNAME 链应只取自基准响应, 实际: %v", cnames)
+	}
+	if len(ips) != 2 || ips["10.1.1.1"] != 30 || ips["10.2.2.2"] != 60 {
+		t.Errorf("应合并两个上游链终点上的 A 记录, 实际: %v", ips)
+	}
+}
+
+func TestMergeResponsesRcode(t *testing.T) {
+	nx := mergeTestMsg(dns.RcodeNameError, false)
+	ok := mergeTestMsg(dns.RcodeSuccess, false, mergeRecord{"10.1.1.1", 60})
+
+	merged := MergeResponses([]*dns.Msg{nx, ok})
+	if merged.Rcode != dns.RcodeSuccess || len(merged.Answer) != 1 {
+		t.Errorf("有 NOERROR 响应时应以其为准: %v", merged)
+	}
+	if merged := MergeResponses([]*dns.Msg{nx}); merged.Rcode != dns.RcodeNameError {
+		t.Errorf("只有 NXDOMAIN 时应返回 NXDOMAIN: %v", merged)
+	}
+	if MergeResponses([]*dns.Msg{nil, nil}) != nil {
+		t.Error("全部为 nil 时应返回 nil")
+	}
+}
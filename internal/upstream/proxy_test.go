@@ -0,0 +1,110 @@
+package upstream
+
+import (
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// startTestProxy 启动一个要求 Basic 认证的 HTTP CONNECT 代理，认证通过后将连接转发到目标地址，
+// 返回代理地址与已建立的隧道数量
+func startTestProxy(t *testing.T, user, password string) (string, *atomic.Int32) {
+	t.Helper()
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+	tunnels := new(atomic.Int32)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Header.Get("Proxy-Authorization") != want {
+			w.Header().Set("Proxy-Authenticate", `Basic realm="proxy"`)
+			http.Error(w, "proxy authentication required", http.StatusProxyAuthRequired)
+			return
+		}
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			target.Close()
+			return
+		}
+		tunnels.Add(1)
+		go func() {
+			defer target.Close()
+			io.Copy(target, buf)
+		}()
+		go func() {
+			defer conn.Close()
+			io.Copy(conn, target)
+		}()
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy.URL, tunnels
+}
+
+// newProxiedDoHResolver 创建经由代理访问 ts 的 DoH 解析器，信任测试服务的证书
+func newProxiedDoHResolver(ts *httptest.Server, opts Options) *DoHResolver {
+	r := New(ts.URL, opts).(*DoHResolver)
+	r.client.Transport.(*http.Transport).TLSClientConfig = ts.Client().Transport.(*http.Transport).TLSClientConfig
+	return r
+}
+
+func TestDoHHTTPProxy(t *testing.T) {
+	seen := make(chan *http.Request, 10)
+	ts := startTestDoH(t, seen)
+	proxyURL, tunnels := startTestProxy(t, "alice", "s3cret")
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+
+	r := newProxiedDoHResolver(ts, Options{
+		Timeout:           2 * time.Second,
+		HTTPProxy:         proxyURL,
+		HTTPProxyUser:     "alice",
+		HTTPProxyPassword: "s3cret",
+	})
+	resp, _, err := r.Exchange(req)
+	if err != nil {
+		t.Fatalf("经由代理的 DoH 查询失败: %v", err)
+	}
+	if len(resp.Answer) != 1 {
+		t.Errorf("响应记录数量错误, 期望: 1, 实际: %d", len(resp.Answer))
+	}
+	if tunnels.Load() != 1 {
+		t.Errorf("查询应经由代理隧道发送, 隧道数: %d", tunnels.Load())
+	}
+
+	// 凭据错误或缺失时代理拒绝建立隧道
+	for _, opts := range []Options{
+		{Timeout: 2 * time.Second, HTTPProxy: proxyURL, HTTPProxyUser: "alice", HTTPProxyPassword: "wrong"},
+		{Timeout: 2 * time.Second, HTTPProxy: proxyURL},
+	} {
+		if _, _, err := newProxiedDoHResolver(ts, opts).Exchange(req); err == nil {
+			t.Errorf("代理认证失败时查询应返回错误 (用户: %q)", opts.HTTPProxyUser)
+		}
+	}
+	if tunnels.Load() != 1 {
+		t.Errorf("认证失败时不应建立隧道, 隧道数: %d", tunnels.Load())
+	}
+}
+
+func TestDoHHTTPProxyInvalidURL(t *testing.T) {
+	r := NewDoHResolver("https://dns.example/dns-query", Options{Timeout: time.Second, HTTPProxy: "http://[::1"})
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	if _, _, err := r.Exchange(req); err == nil {
+		t.Error("代理地址无效时查询应返回错误，而不是绕过代理")
+	}
+}
@@ -0,0 +1,97 @@
+// Package upstream 实现向上游 DNS 服务器发送查询的解析器
+package upstream
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultUserAgent DoH 请求默认使用的 User-Agent
+const DefaultUserAgent = "fxdns/1.0"
+
+// Resolver 上游解析器
+type Resolver interface {
+	// Exchange 向上游发送查询，返回响应与往返时间
+	Exchange(m *dns.Msg) (*dns.Msg, time.Duration, error)
+	// Address 返回上游地址
+	Address() string
+}
+
+// Options 创建解析器的参数
+type Options struct {
+	// Timeout 单次查询超时时间
+	Timeout time.Duration
+	// UserAgent DoH 请求的 User-Agent，为空时使用 DefaultUserAgent
+	UserAgent string
+	// MaxIdleConns DoH 客户端保留的最大空闲连接数，为 0 时使用 net/http 默认值
+	MaxIdleConns int
+	// MaxConnsPerHost DoH 客户端每个主机的最大连接数，为 0 时不限制
+	MaxConnsPerHost int
+	// IdleConnTimeout DoH 空闲连接的保留时间，为 0 时使用 net/http 默认值
+	IdleConnTimeout time.Duration
+	// TSIG 非空时用该密钥签名 UDP DNS 查询并校验响应的签名，DoH 上游不使用
+	TSIG *TSIGKey
+	// HTTPProxy DoH 请求经由的 HTTP 代理地址，如 http://proxy.corp.example.com:8080，为空时按环境变量决定是否使用代理
+	HTTPProxy string
+	// HTTPProxyUser / HTTPProxyPassword 代理的 Basic 认证凭据，用户名为空时不认证
+	HTTPProxyUser     string
+	HTTPProxyPassword string
+}
+
+// IsDoH 判断上游地址是否为 DNS-over-HTTPS 地址 (https://...)
+func IsDoH(addr string) bool {
+	return strings.HasPrefix(strings.ToLower(addr), "https://")
+}
+
+// New 根据地址创建解析器：https:// 开头的地址使用 DoH，其余按 IP:端口 使用 UDP
+func New(addr string, opts Options) Resolver {
+	if IsDoH(addr) {
+		return NewDoHResolver(addr, opts)
+	}
+	return NewDNSResolver(addr, opts)
+}
+
+// DNSResolver 使用传统 UDP DNS 查询上游
+type DNSResolver struct {
+	addr   string
+	client *dns.Client
+	tsig   *TSIGKey // 非空时签名查询并要求响应带有有效签名
+}
+
+// NewDNSResolver 创建 UDP DNS 解析器
+func NewDNSResolver(addr string, opts Options) *DNSResolver {
+	r := &DNSResolver{
+		addr:   addr,
+		client: &dns.Client{Net: "udp", Timeout: opts.Timeout},
+	}
+	if opts.TSIG != nil {
+		key := opts.TSIG.Normalize()
+		r.tsig = &key
+		r.client.TsigSecret = map[string]string{key.Name: key.Secret}
+	}
+	return r
+}
+
+// Exchange 实现 Resolver 接口。配置了 TSIG 时签名查询，响应签名无效 (由 dns.Client 校验) 或缺少签名时返回错误，
+// 返回的响应不含 TSIG 记录
+func (r *DNSResolver) Exchange(m *dns.Msg) (*dns.Msg, time.Duration, error) {
+	if r.tsig == nil {
+		return r.client.Exchange(m, r.addr)
+	}
+	resp, rtt, err := r.client.Exchange(r.tsig.sign(m), r.addr)
+	if err != nil {
+		return nil, rtt, err
+	}
+	if resp.IsTsig() == nil {
+		return nil, rtt, fmt.Errorf("%w (%s, rcode %s)", ErrTSIGMissing, r.addr, dns.RcodeToString[resp.Rcode])
+	}
+	// 签名已校验，去掉 TSIG 记录，避免响应原样返回给客户端时被当作需要本地签名的消息
+	resp.Extra = resp.Extra[:len(resp.Extra)-1]
+	return resp, rtt, nil
+}
+
+// Address 实现 Resolver 接口
+func (r *DNSResolver) Address() string { return r.addr }
@@ -0,0 +1,71 @@
+package upstream
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// tsigFudge TSIG 签名允许的时钟偏差（秒）
+const tsigFudge = 300
+
+// ErrTSIGMissing 查询带有 TSIG 签名，但上游的响应没有签名
+var ErrTSIGMissing = errors.New("上游响应缺少 TSIG 签名")
+
+// TSIGKey 签名发往上游查询的 TSIG (RFC 2845) 密钥
+type TSIGKey struct {
+	// Name 密钥名，如 fxdns-key.
+	Name string
+	// Algorithm 签名算法，如 hmac-sha256.，为空时使用 hmac-sha256
+	Algorithm string
+	// Secret base64 编码的共享密钥
+	Secret string
+}
+
+// tsigAlgorithms 支持的 TSIG 算法
+var tsigAlgorithms = map[string]bool{
+	dns.HmacSHA1:   true,
+	dns.HmacSHA224: true,
+	dns.HmacSHA256: true,
+	dns.HmacSHA384: true,
+	dns.HmacSHA512: true,
+}
+
+// Normalize 返回密钥名与算法转换为小写完整域名形式后的密钥，算法为空时使用 hmac-sha256
+func (k TSIGKey) Normalize() TSIGKey {
+	k.Name = dns.Fqdn(strings.ToLower(k.Name))
+	if k.Algorithm == "" {
+		k.Algorithm = dns.HmacSHA256
+	}
+	k.Algorithm = dns.Fqdn(strings.ToLower(k.Algorithm))
+	return k
+}
+
+// Validate 检查密钥名、算法与 base64 编码的密钥
+func (k TSIGKey) Validate() error {
+	k = k.Normalize()
+	if k.Name == "." {
+		return errors.New("TSIG 密钥名不能为空")
+	}
+	if !tsigAlgorithms[k.Algorithm] {
+		return fmt.Errorf("不支持的 TSIG 算法: %s", k.Algorithm)
+	}
+	if k.Secret == "" {
+		return errors.New("TSIG 密钥不能为空")
+	}
+	if _, err := base64.StdEncoding.DecodeString(k.Secret); err != nil {
+		return fmt.Errorf("TSIG 密钥不是有效的 base64: %w", err)
+	}
+	return nil
+}
+
+// sign 返回带 TSIG 签名记录的 m 的副本，实际签名在 dns.Client 发送时完成
+func (k TSIGKey) sign(m *dns.Msg) *dns.Msg {
+	signed := m.Copy()
+	signed.SetTsig(k.Name, k.Algorithm, tsigFudge, time.Now().Unix())
+	return signed
+}
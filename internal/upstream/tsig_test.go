@@ -0,0 +1,127 @@
+package upstream
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	testTSIGName   = "fxdns-key."
+	testTSIGSecret = "c2VjcmV0LWtleS1mb3ItZnhkbnM="
+	otherSecret    = "b3RoZXItc2VjcmV0LWtleQ=="
+)
+
+// startTSIGUpstream 启动要求 TSIG 的模拟上游：用 secret 校验查询签名，校验通过时返回签名的应答，
+// 否则返回未签名的 NOTAUTH。verify 为 false 时不检查查询签名，总是签名应答（用于模拟用错误密钥签名的上游）
+func startTSIGUpstream(t *testing.T, secret string, verify bool) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("启动测试上游失败: %v", err)
+	}
+	started := make(chan struct{})
+	srv := &dns.Server{
+		PacketConn:        pc,
+		TsigSecret:        map[string]string{testTSIGName: secret},
+		NotifyStartedFunc: func() { close(started) },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			if verify && (r.IsTsig() == nil || w.TsigStatus() != nil) {
+				m.SetRcode(r, dns.RcodeNotAuth)
+				w.WriteMsg(m)
+				return
+			}
+			m.SetReply(r)
+			m.Answer = append(m.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.ParseIP("10.1.1.1"),
+			})
+			if t := r.IsTsig(); t != nil {
+				m.SetTsig(t.Hdr.Name, t.Algorithm, 300, time.Now().Unix())
+			}
+			w.WriteMsg(m)
+		}),
+	}
+	go srv.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { srv.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+func TestDNSResolverTSIG(t *testing.T) {
+	signed := startTSIGUpstream(t, testTSIGSecret, true)
+	forged := startTSIGUpstream(t, otherSecret, false)
+
+	testCases := []struct {
+		name        string
+		addr        string
+		key         *TSIGKey
+		expectErr   bool
+		expectRcode int
+	}{
+		{"签名正确", signed, &TSIGKey{Name: "FXDNS-key", Secret: testTSIGSecret}, false, dns.RcodeSuccess},
+		{"指定算法", signed, &TSIGKey{Name: testTSIGName, Algorithm: "hmac-sha256", Secret: testTSIGSecret}, false, dns.RcodeSuccess},
+		{"未配置 TSIG", signed, nil, false, dns.RcodeNotAuth},
+		{"密钥错误时上游返回未签名响应", signed, &TSIGKey{Name: testTSIGName, Secret: otherSecret}, true, 0},
+		{"响应签名无效", forged, &TSIGKey{Name: testTSIGName, Secret: testTSIGSecret}, true, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewDNSResolver(tc.addr, Options{Timeout: time.Second, TSIG: tc.key})
+			req := new(dns.Msg)
+			req.SetQuestion("www.example.com.", dns.TypeA)
+			resp, _, err := r.Exchange(req)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("应返回错误, 实际响应: %v", resp)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("查询失败: %v", err)
+			}
+			if resp.Rcode != tc.expectRcode {
+				t.Errorf("RCODE 错误, 期望: %s, 实际: %s", dns.RcodeToString[tc.expectRcode], dns.RcodeToString[resp.Rcode])
+			}
+			if resp.IsTsig() != nil {
+				t.Error("返回的响应不应包含 TSIG 记录")
+			}
+			if req.IsTsig() != nil {
+				t.Error("不应修改调用方的查询")
+			}
+		})
+	}
+
+	r := NewDNSResolver(signed, Options{Timeout: time.Second, TSIG: &TSIGKey{Name: testTSIGName, Secret: otherSecret}})
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	if _, _, err := r.Exchange(req); !errors.Is(err, ErrTSIGMissing) {
+		t.Errorf("上游未签名响应时应返回 ErrTSIGMissing, 实际: %v", err)
+	}
+}
+
+func TestTSIGKeyValidate(t *testing.T) {
+	testCases := []struct {
+		name  string
+		key   TSIGKey
+		valid bool
+	}{
+		{"默认算法", TSIGKey{Name: "key", Secret: testTSIGSecret}, true},
+		{"hmac-sha512", TSIGKey{Name: "key.", Algorithm: "HMAC-SHA512.", Secret: testTSIGSecret}, true},
+		{"缺少密钥名", TSIGKey{Secret: testTSIGSecret}, false},
+		{"缺少密钥", TSIGKey{Name: "key"}, false},
+		{"不支持的算法", TSIGKey{Name: "key", Algorithm: "hmac-md5", Secret: testTSIGSecret}, false},
+		{"密钥不是 base64", TSIGKey{Name: "key", Secret: "not base64!"}, false},
+	}
+
+	for _, tc := range testCases {
+		if err := tc.key.Validate(); (err == nil) != tc.valid {
+			t.Errorf("%s: Validate() = %v, 期望有效: %v", tc.name, err, tc.valid)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package upstream
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ErrInvalidResponse 上游响应未通过 ValidateResponse 的合理性检查
+var ErrInvalidResponse = errors.New("上游响应无效")
+
+// ErrResponseMismatch 上游响应与查询不对应，未通过 ValidateStubResponse 的检查
+var ErrResponseMismatch = errors.New("上游响应与查询不对应")
+
+// ValidateResponse 检查上游对 req 的响应是否明显异常：问题段与查询不一致、RCODE 未定义、
+// 应答记录 TTL 为 0，或包含 0.0.0.0 / 255.255.255.255 / :: 这类不可能是真实地址的 IP。
+// 检查不通过时返回包装了 ErrInvalidResponse 的错误
+func ValidateResponse(req, resp *dns.Msg) error {
+	if resp == nil {
+		return fmt.Errorf("%w: 响应为空", ErrInvalidResponse)
+	}
+	if err := checkQuestion(req, resp); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	if _, ok := dns.RcodeToString[resp.Rcode]; !ok {
+		return fmt.Errorf("%w: 未定义的 RCODE %d", ErrInvalidResponse, resp.Rcode)
+	}
+
+	for _, rr := range resp.Answer {
+		if rr.Header().Ttl == 0 {
+			return fmt.Errorf("%w: 记录 %s 的 TTL 为 0", ErrInvalidResponse, rr.String())
+		}
+		switch v := rr.(type) {
+		case *dns.A:
+			if v.A.IsUnspecified() || v.A.Equal(net.IPv4bcast) {
+				return fmt.Errorf("%w: 记录 %s 包含无效的 IP", ErrInvalidResponse, rr.String())
+			}
+		case *dns.AAAA:
+			if v.AAAA.IsUnspecified() {
+				return fmt.Errorf("%w: 记录 %s 包含无效的 IP", ErrInvalidResponse, rr.String())
+			}
+		}
+	}
+	return nil
+}
+
+// checkQuestion 检查响应的问题段与查询是否一致，名称不区分大小写
+func checkQuestion(req, resp *dns.Msg) error {
+	if len(resp.Question) != len(req.Question) {
+		return fmt.Errorf("问题段数量 %d 与查询 %d 不一致", len(resp.Question), len(req.Question))
+	}
+	for i, q := range req.Question {
+		got := resp.Question[i]
+		if !strings.EqualFold(got.Name, q.Name) || got.Qtype != q.Qtype || got.Qclass != q.Qclass {
+			return fmt.Errorf("问题段 %s 与查询 %s 不一致", got.String(), q.String())
+		}
+	}
+	return nil
+}
+
+// ValidateStubResponse 按存根解析器 (RFC 8499) 的要求检查响应是否对应 req：ID 相同、QR 位已设置、
+// 问题段与查询一致，且应答段确实回答了该问题——每条记录的所有者名是查询名或从查询名出发的 CNAME 链上的名称
+// (DNAME 的所有者为查询名的上级域名)，类型为查询类型、CNAME、DNAME 或 RRSIG (ANY 查询不限类型)。
+// 检查不通过时返回包装了 ErrResponseMismatch 的错误
+func ValidateStubResponse(req, resp *dns.Msg) error {
+	if resp == nil {
+		return fmt.Errorf("%w: 响应为空", ErrResponseMismatch)
+	}
+	if resp.Id != req.Id {
+		return fmt.Errorf("%w: 响应 ID %d 与查询 ID %d 不一致", ErrResponseMismatch, resp.Id, req.Id)
+	}
+	if !resp.Response {
+		return fmt.Errorf("%w: 未设置 QR 位", ErrResponseMismatch)
+	}
+	if err := checkQuestion(req, resp); err != nil {
+		return fmt.Errorf("%w: %v", ErrResponseMismatch, err)
+	}
+	if len(req.Question) == 0 {
+		return nil
+	}
+
+	q := req.Question[0]
+	owners := map[string]bool{strings.ToLower(dns.Fqdn(q.Name)): true}
+	// CNAME 记录可能不按链的顺序排列，先收集整条链
+	for changed := true; changed; {
+		changed = false
+		for _, rr := range resp.Answer {
+			if cname, ok := rr.(*dns.CNAME); ok && owners[strings.ToLower(cname.Hdr.Name)] {
+				if target := strings.ToLower(cname.Target); !owners[target] {
+					owners[target] = true
+					changed = true
+				}
+			}
+		}
+	}
+	for _, rr := range resp.Answer {
+		hdr := rr.Header()
+		owner := strings.ToLower(hdr.Name)
+		switch {
+		case hdr.Rrtype == dns.TypeDNAME:
+			if !dns.IsSubDomain(owner, strings.ToLower(q.Name)) {
+				return fmt.Errorf("%w: DNAME 记录 %s 与查询 %s 无关", ErrResponseMismatch, hdr.Name, q.Name)
+			}
+			continue
+		case !owners[owner]:
+			return fmt.Errorf("%w: 应答记录 %s 的所有者名不在查询 %s 的 CNAME 链上", ErrResponseMismatch, hdr.Name, q.Name)
+		}
+		switch hdr.Rrtype {
+		case q.Qtype, dns.TypeCNAME, dns.TypeRRSIG:
+		default:
+			if q.Qtype != dns.TypeANY {
+				return fmt.Errorf("%w: 应答记录类型 %s 与查询类型 %s 不符", ErrResponseMismatch, dns.TypeToString[hdr.Rrtype], dns.TypeToString[q.Qtype])
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package upstream
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestValidateResponse(t *testing.T) {
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+
+	reply := func(ip string, ttl uint32) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+			A:   net.ParseIP(ip),
+		})
+		return m
+	}
+
+	testCases := []struct {
+		name  string
+		resp  func() *dns.Msg
+		valid bool
+	}{
+		{"正常响应", func() *dns.Msg { return reply("93.184.216.34", 300) }, true},
+		{"问题段名称大小写不同", func() *dns.Msg {
+			m := reply("93.184.216.34", 300)
+			m.Question[0].Name = "WWW.Example.COM."
+			return m
+		}, true},
+		{"NXDOMAIN 无应答", func() *dns.Msg {
+			m := new(dns.Msg)
+			m.SetRcode(req, dns.RcodeNameError)
+			return m
+		}, true},
+		{"空响应", func() *dns.Msg { return nil }, false},
+		{"问题段名称不符", func() *dns.Msg {
+			m := reply("93.184.216.34", 300)
+			m.Question[0].Name = "evil.example.net."
+			return m
+		}, false},
+		{"问题段类型不符", func() *dns.Msg {
+			m := reply("93.184.216.34", 300)
+			m.Question[0].Qtype = dns.TypeAAAA
+			return m
+		}, false},
+		{"缺少问题段", func() *dns.Msg {
+			m := reply("93.184.216.34", 300)
+			m.Question = nil
+			return m
+		}, false},
+		{"未定义的 RCODE", func() *dns.Msg {
+			m := reply("93.184.216.34", 300)
+			m.Rcode = 15
+			return m
+		}, false},
+		{"TTL 为 0", func() *dns.Msg { return reply("93.184.216.34", 0) }, false},
+		{"0.0.0.0", func() *dns.Msg { return reply("0.0.0.0", 300) }, false},
+		{"255.255.255.255", func() *dns.Msg { return reply("255.255.255.255", 300) }, false},
+		{"AAAA ::", func() *dns.Msg {
+			m := reply("93.184.216.34", 300)
+			m.Answer = append(m.Answer, &dns.AAAA{
+				Hdr:  dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 300},
+				AAAA: net.ParseIP("::"),
+			})
+			return m
+		}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateResponse(req, tc.resp())
+			if tc.valid && err != nil {
+				t.Errorf("响应应通过检查: %v", err)
+			}
+			if !tc.valid && !errors.Is(err, ErrInvalidResponse) {
+				t.Errorf("响应应返回 ErrInvalidResponse, 实际: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateStubResponse(t *testing.T) {
+	req := new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+
+	a := func(name, ip string) dns.RR {
+		return &dns.A{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300}, A: net.ParseIP(ip)}
+	}
+	cname := func(name, target string) dns.RR {
+		return &dns.CNAME{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300}, Target: target}
+	}
+	reply := func(answer ...dns.RR) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Answer = answer
+		return m
+	}
+
+	testCases := []struct {
+		name  string
+		resp  func() *dns.Msg
+		valid bool
+	}{
+		{"正常响应", func() *dns.Msg { return reply(a("www.example.com.", "93.184.216.34")) }, true},
+		{"CNAME 链", func() *dns.Msg {
+			// 记录不按链的顺序排列
+			return reply(a("edge.cdn.example.net.", "93.184.216.34"), cname("cdn.example.net.", "edge.cdn.example.net."), cname("WWW.example.com.", "cdn.example.net."))
+		}, true},
+		{"DNAME", func() *dns.Msg {
+			dname := &dns.DNAME{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeDNAME, Class: dns.ClassINET, Ttl: 300}, Target: "example.net."}
+			return reply(dname, cname("www.example.com.", "www.example.net."), a("www.example.net.", "93.184.216.34"))
+		}, true},
+		{"NXDOMAIN 无应答", func() *dns.Msg {
+			m := new(dns.Msg)
+			m.SetRcode(req, dns.RcodeNameError)
+			return m
+		}, true},
+		{"空响应", func() *dns.Msg { return nil }, false},
+		{"ID 不符", func() *dns.Msg {
+			m := reply(a("www.example.com.", "93.184.216.34"))
+			m.Id = req.Id + 1
+			return m
+		}, false},
+		{"未设置 QR 位", func() *dns.Msg {
+			m := reply(a("www.example.com.", "93.184.216.34"))
+			m.Response = false
+			return m
+		}, false},
+		{"问题段名称不符", func() *dns.Msg {
+			m := reply(a("www.example.com.", "93.184.216.34"))
+			m.Question[0].Name = "evil.example.net."
+			return m
+		}, false},
+		{"应答记录所有者名不符", func() *dns.Msg { return reply(a("evil.example.net.", "93.184.216.34")) }, false},
+		{"CNAME 链外的记录", func() *dns.Msg {
+			return reply(cname("www.example.com.", "cdn.example.net."), a("evil.example.net.", "93.184.216.34"))
+		}, false},
+		{"应答记录类型不符", func() *dns.Msg {
+			return reply(&dns.TXT{Hdr: dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300}, Txt: []string{"x"}})
+		}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateStubResponse(req, tc.resp())
+			if tc.valid && err != nil {
+				t.Errorf("响应应通过检查: %v", err)
+			}
+			if !tc.valid && !errors.Is(err, ErrResponseMismatch) {
+				t.Errorf("响应应返回 ErrResponseMismatch, 实际: %v", err)
+			}
+		})
+	}
+}
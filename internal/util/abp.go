@@ -0,0 +1,99 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrUnsupportedABPRule 表示该 ABP 规则无法表示为域名模式（如元素隐藏、URL 路径或带选项的规则）
+var ErrUnsupportedABPRule = errors.New("不支持的 ABP 规则")
+
+// AddABPPattern 解析一行 Adblock Plus / uBlock Origin 语法的规则并添加到匹配器。
+// 仅支持域名锚定规则：||example.com^ 添加 example.com 与 *.example.com 两个模式，
+// @@||example.com^ 将二者添加为例外模式。空行、! 开头的注释和 [Adblock Plus x.y] 头部被忽略。
+// 无法转换为域名模式的规则返回 ErrUnsupportedABPRule。
+func (m *DomainMatcher) AddABPPattern(abpLine string) error {
+	line := strings.TrimSpace(abpLine)
+	if line == "" || strings.HasPrefix(line, "!") || strings.HasPrefix(line, "[") {
+		return nil
+	}
+
+	negate := false
+	rule := line
+	if strings.HasPrefix(rule, "@@") {
+		negate = true
+		rule = rule[2:]
+	}
+
+	domain, err := parseABPDomain(rule)
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, line)
+	}
+
+	add := m.AddPattern
+	if negate {
+		add = m.AddNegationPattern
+	}
+	add(domain)
+	add("*." + domain)
+	return nil
+}
+
+// parseABPDomain 从 ||domain^ 形式的规则中取出域名
+func parseABPDomain(rule string) (string, error) {
+	if !strings.HasPrefix(rule, "||") {
+		return "", ErrUnsupportedABPRule
+	}
+	rule = rule[2:]
+
+	// 域名以分隔符 ^ 结尾，其后只允许行尾锚点 |，带 $ 选项的规则无法在 DNS 层面表达
+	end := strings.IndexByte(rule, '^')
+	if end < 0 {
+		return "", ErrUnsupportedABPRule
+	}
+	if rest := rule[end+1:]; rest != "" && rest != "|" {
+		return "", ErrUnsupportedABPRule
+	}
+
+	domain, err := toASCIIDomain(rule[:end])
+	if err != nil {
+		return "", fmt.Errorf("无效的域名 %s: %w", rule[:end], err)
+	}
+	if !isHostname(domain) {
+		return "", ErrUnsupportedABPRule
+	}
+	return domain, nil
+}
+
+// isHostname 判断字符串是否为由字母、数字、- 和 _ 组成的多标签主机名
+func isHostname(s string) bool {
+	if s == "" || strings.HasPrefix(s, ".") || strings.HasSuffix(s, ".") || strings.Contains(s, "..") {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadABPFile 从 ABP / uBlock Origin 格式的过滤列表文件中加载域名规则。
+// 无法表示为域名模式的规则（元素隐藏、URL 路径、带选项的规则等）会被跳过，其他解析错误附带行号返回。
+func (m *DomainMatcher) LoadABPFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return scanLines(f, func(lineNo int, line string) error {
+		if err := m.AddABPPattern(line); err != nil && !errors.Is(err, ErrUnsupportedABPRule) {
+			return fmt.Errorf("%s 第 %d 行: %w", path, lineNo, err)
+		}
+		return nil
+	})
+}
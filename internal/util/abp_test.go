@@ -0,0 +1,100 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// sampleUBlockList 摘自 uBlock Origin / EasyList 风格过滤列表的样例
+const sampleUBlockList = `[Adblock Plus 2.0]
+! Title: fxdns test list
+! Expires: 4 days
+||ads.example.com^
+||tracker.example.net^|
+||Analytics.Example.ORG^
+
+! 例外规则
+@@||good.ads.example.com^
+
+! 以下规则无法在 DNS 层面表达，应被跳过
+example.com##.banner
+||cdn.example.com/ads/*
+||popup.example.com^$popup,third-party
+/banner/*/img^
+|https://static.example.com/track.js
+`
+
+func TestAddABPPattern(t *testing.T) {
+	testCases := []struct {
+		line     string
+		patterns []string
+		negation []string
+		err      error
+	}{
+		{"||example.com^", []string{"example.com", "*.example.com"}, []string{}, nil},
+		{"@@||example.com^", []string{}, []string{"example.com", "*.example.com"}, nil},
+		{"! comment", []string{}, []string{}, nil},
+		{"   ", []string{}, []string{}, nil},
+		{"[Adblock Plus 2.0]", []string{}, []string{}, nil},
+		{"example.com##.ad", []string{}, []string{}, ErrUnsupportedABPRule},
+		{"||example.com^$third-party", []string{}, []string{}, ErrUnsupportedABPRule},
+		{"||example.com/path", []string{}, []string{}, ErrUnsupportedABPRule},
+		{"||*.example.com^", []string{}, []string{}, ErrUnsupportedABPRule},
+	}
+
+	for _, tc := range testCases {
+		m := NewDomainMatcher()
+		err := m.AddABPPattern(tc.line)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%q 错误不符, 期望: %v, 实际: %v", tc.line, tc.err, err)
+		}
+		if got := m.GetPatterns(); !reflect.DeepEqual(got, tc.patterns) {
+			t.Errorf("%q 模式错误, 期望: %v, 实际: %v", tc.line, tc.patterns, got)
+		}
+		if got := m.GetNegationPatterns(); !reflect.DeepEqual(got, tc.negation) {
+			t.Errorf("%q 例外模式错误, 期望: %v, 实际: %v", tc.line, tc.negation, got)
+		}
+	}
+}
+
+func TestLoadABPFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filters.txt")
+	if err := os.WriteFile(path, []byte(sampleUBlockList), 0644); err != nil {
+		t.Fatalf("写入过滤列表失败: %v", err)
+	}
+
+	m := NewDomainMatcher()
+	if err := m.LoadABPFile(path); err != nil {
+		t.Fatalf("加载过滤列表失败: %v", err)
+	}
+	if m.Count() != 6 {
+		t.Errorf("模式数量错误, 期望: 6, 实际: %d (%v)", m.Count(), m.GetPatterns())
+	}
+
+	testCases := []struct {
+		domain   string
+		expected bool
+	}{
+		{"ads.example.com", true},
+		{"x.ads.example.com", true},
+		{"tracker.example.net", true},
+		{"analytics.example.org", true},
+		{"good.ads.example.com", false},
+		{"a.good.ads.example.com", false},
+		{"example.com", false},
+		{"cdn.example.com", false},
+		{"popup.example.com", false},
+	}
+	for _, tc := range testCases {
+		if got := m.Match(tc.domain); got != tc.expected {
+			t.Errorf("域名 %s 匹配结果错误, 期望: %v, 实际: %v", tc.domain, tc.expected, got)
+		}
+	}
+
+	if err := m.LoadABPFile(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("文件不存在时应返回错误")
+	}
+}
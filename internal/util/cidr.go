@@ -1,21 +1,58 @@
 package util
 
 import (
+	"encoding/json"
+	"fmt"
 	"net"
 	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hao/fxdns/internal/metrics"
 )
 
 // CIDRMatcher CIDR 匹配器，用于高效匹配 IP 地址是否在 CIDR 范围内
+// 内部使用二进制前缀树存储 CIDR，查找开销与 CIDR 数量无关
 type CIDRMatcher struct {
-	cidrs []*net.IPNet
-	mu    sync.RWMutex
+	trie *cidrTrie
+	mu   sync.RWMutex
+	// warm WarmLookupCache 预先计算的查找结果，键为 16 字节形式的 IP，值为包含该 IP 的 *cidrEntry (不在任何 CIDR 内时为 nil)。
+	// 未预热或 CIDR 变更后为 nil
+	warm *sync.Map
+	// warmMisses 预热后 Contains 查询未预热 IP 的次数
+	warmMisses atomic.Uint64
+}
+
+// cidrEntry 前缀树中存储的 CIDR 及其元数据
+type cidrEntry struct {
+	cidr    *net.IPNet
+	addedAt time.Time
+	hits    atomic.Uint64 // Contains 命中次数
+	lastHit atomic.Int64  // 最近一次命中的时间 (UnixNano)，从未命中时为 0
+}
+
+// CIDRInfo 表示 CIDR 及其统计信息，用于 JSON 序列化
+type CIDRInfo struct {
+	CIDR    string    `json:"cidr"`
+	AddedAt time.Time `json:"added_at"`
+	Hits    uint64    `json:"hits"`
 }
 
+// CIDRStat 单个 CIDR 的命中统计
+type CIDRStat struct {
+	CIDR    string    `json:"cidr"`
+	Hits    uint64    `json:"hits"`
+	LastHit time.Time `json:"last_hit"` // 从未命中时为零值
+}
+
+// CIDRStatistics 所有 CIDR 的命中统计快照，按命中次数从高到低排序
+type CIDRStatistics []CIDRStat
+
 // NewCIDRMatcher 创建新的 CIDR 匹配器
 func NewCIDRMatcher() *CIDRMatcher {
 	return &CIDRMatcher{
-		cidrs: make([]*net.IPNet, 0),
+		trie: newCIDRTrie(),
 	}
 }
 
@@ -29,14 +66,9 @@ func (m *CIDRMatcher) AddCIDR(cidrStr string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// 检查是否已存在
-	for _, existing := range m.cidrs {
-		if existing.String() == cidr.String() {
-			return nil
-		}
-	}
-
-	m.cidrs = append(m.cidrs, cidr)
+	// 已存在时 Insert 返回 false，这里无需额外处理
+	m.trie.Insert(cidr)
+	m.warm = nil
 	return nil
 }
 
@@ -60,25 +92,96 @@ func (m *CIDRMatcher) RemoveCIDR(cidrStr string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	for i, existing := range m.cidrs {
-		if existing.String() == cidr.String() {
-			m.cidrs = append(m.cidrs[:i], m.cidrs[i+1:]...)
-			break
-		}
-	}
+	m.trie.Delete(cidr)
+	m.warm = nil
 }
 
-// Contains 检查 IP 是否在任何 CIDR 范围内
+// Contains 检查 IP 是否在任何 CIDR 范围内，IPv4 映射的 IPv6 地址按 ContainsMapped 处理
 func (m *CIDRMatcher) Contains(ip net.IP) bool {
+	return m.ContainsMapped(ip)
+}
+
+// ContainsMapped 检查 IP 是否在任何 CIDR 内。IPv4 映射的 IPv6 地址 (::ffff:1.2.3.4，Go 中 16 字节形式的 IPv4)
+// 先转换为 4 字节的 IPv4 地址与 IPv4 CIDR 比较，未命中时再按映射形式与 IPv6 CIDR (如 ::ffff:0:0/96) 比较；
+// 4 字节与 16 字节形式的同一 IPv4 地址结果相同
+func (m *CIDRMatcher) ContainsMapped(ip net.IP) bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	for _, cidr := range m.cidrs {
-		if cidr.Contains(ip) {
-			return true
+	var entry *cidrEntry
+	if cached, ok := m.warmLookup(ip); ok {
+		entry = cached
+	} else {
+		entry = m.trie.lookupMappedEntry(ip)
+	}
+	if entry == nil {
+		return false
+	}
+	entry.hits.Add(1)
+	entry.lastHit.Store(time.Now().UnixNano())
+	return true
+}
+
+// WarmLookupCache 预先计算 ips 中每个地址的 Contains 结果并缓存，之后对这些地址的 Contains 直接使用缓存结果，
+// 命中统计照常累加。适用于已知的高频地址（如 /queries/recent 中的应答地址）。
+// 缓存在 AddCIDR / RemoveCIDR / Clear 等修改 CIDR 的操作后失效，需要重新预热
+func (m *CIDRMatcher) WarmLookupCache(ips []net.IP) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.warm == nil {
+		m.warm = &sync.Map{}
+	}
+	for _, ip := range ips {
+		if key := ip.To16(); key != nil {
+			m.warm.Store(string(key), m.trie.lookupMappedEntry(ip))
 		}
 	}
-	return false
+}
+
+// WarmCacheMisses 返回预热后 Contains 查询了未预热地址的次数，未预热时不计数
+func (m *CIDRMatcher) WarmCacheMisses() uint64 {
+	return m.warmMisses.Load()
+}
+
+// warmLookup 从预热缓存中查找 IP，调用方需持有读锁。已预热但 IP 不在缓存中时计入未命中
+func (m *CIDRMatcher) warmLookup(ip net.IP) (*cidrEntry, bool) {
+	if m.warm == nil {
+		return nil, false
+	}
+	if key := ip.To16(); key != nil {
+		if v, ok := m.warm.Load(string(key)); ok {
+			return v.(*cidrEntry), true
+		}
+	}
+	m.warmMisses.Add(1)
+	metrics.CIDRWarmCacheMissCount.Inc()
+	return nil, false
+}
+
+// Lookup 返回包含该 IP 的 CIDR（存在嵌套时为前缀最短的一个）。与 Contains 不同，不计入命中统计，
+// 适用于调试查询
+func (m *CIDRMatcher) Lookup(ip net.IP) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	cidr := m.trie.Lookup(ip)
+	if cidr == nil {
+		return "", false
+	}
+	return cidr.String(), true
+}
+
+// Complement 返回 universe 范围内不被任何 CIDR 覆盖的网段（按地址从小到大），即限定在 universe 内的补集。
+// 可用于生成放行非 CDN 流量的防火墙规则。universe 整体已被覆盖时返回空，universe 为 nil 时返回 nil
+func (m *CIDRMatcher) Complement(universe *net.IPNet) []*net.IPNet {
+	if universe == nil {
+		return nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.trie.Complement(universe)
 }
 
 // GetCIDRs 获取所有 CIDR
@@ -86,28 +189,126 @@ func (m *CIDRMatcher) GetCIDRs() []string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	result := make([]string, len(m.cidrs))
-	for i, cidr := range m.cidrs {
-		result[i] = cidr.String()
-	}
+	result := make([]string, 0, m.trie.Len())
+	m.trie.Walk(func(cidr *net.IPNet) {
+		result = append(result, cidr.String())
+	})
 
 	// 排序以保持一致性
 	sort.Strings(result)
 	return result
 }
 
+// Diff 比较两个匹配器中的 CIDR：added 为 other 中有而 m 中没有的，removed 为 m 中有而 other 中没有的，均按字符串排序
+func (m *CIDRMatcher) Diff(other *CIDRMatcher) (added, removed []string) {
+	mine := m.GetCIDRs()
+	theirs := other.GetCIDRs()
+
+	// 两个列表均已排序，按归并方式一次遍历
+	i, j := 0, 0
+	for i < len(mine) && j < len(theirs) {
+		switch {
+		case mine[i] == theirs[j]:
+			i++
+			j++
+		case mine[i] < theirs[j]:
+			removed = append(removed, mine[i])
+			i++
+		default:
+			added = append(added, theirs[j])
+			j++
+		}
+	}
+	removed = append(removed, mine[i:]...)
+	added = append(added, theirs[j:]...)
+	return added, removed
+}
+
+// Stats 返回所有 CIDR 及其添加时间和命中次数，按 CIDR 字符串排序
+func (m *CIDRMatcher) Stats() []CIDRInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]CIDRInfo, 0, m.trie.Len())
+	m.trie.walkEntries(func(entry *cidrEntry) {
+		result = append(result, CIDRInfo{
+			CIDR:    entry.cidr.String(),
+			AddedAt: entry.addedAt,
+			Hits:    entry.hits.Load(),
+		})
+	})
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CIDR < result[j].CIDR })
+	return result
+}
+
+// Statistics 返回各 CIDR 命中次数与最近命中时间的快照，按命中次数从高到低排序（相同时按 CIDR 字符串），
+// 从未命中（可能已失效）的 CIDR 排在最后
+func (m *CIDRMatcher) Statistics() CIDRStatistics {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(CIDRStatistics, 0, m.trie.Len())
+	m.trie.walkEntries(func(entry *cidrEntry) {
+		stat := CIDRStat{CIDR: entry.cidr.String(), Hits: entry.hits.Load()}
+		if ns := entry.lastHit.Load(); ns != 0 {
+			stat.LastHit = time.Unix(0, ns)
+		}
+		result = append(result, stat)
+	})
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Hits != result[j].Hits {
+			return result[i].Hits > result[j].Hits
+		}
+		return result[i].CIDR < result[j].CIDR
+	})
+	return result
+}
+
+// MarshalJSON 将匹配器序列化为 [{"cidr": ..., "added_at": ..., "hits": ...}] 形式的数组
+func (m *CIDRMatcher) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Stats())
+}
+
+// UnmarshalJSON 从 MarshalJSON 的输出恢复匹配器内容（包括添加时间和命中次数），替换现有的全部 CIDR
+func (m *CIDRMatcher) UnmarshalJSON(data []byte) error {
+	var infos []CIDRInfo
+	if err := json.Unmarshal(data, &infos); err != nil {
+		return err
+	}
+
+	trie := newCIDRTrie()
+	for _, info := range infos {
+		_, cidr, err := net.ParseCIDR(info.CIDR)
+		if err != nil {
+			return fmt.Errorf("解析 CIDR %s 失败: %w", info.CIDR, err)
+		}
+		entry := &cidrEntry{cidr: cidr, addedAt: info.AddedAt}
+		entry.hits.Store(info.Hits)
+		trie.insertEntry(entry)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.trie = trie
+	m.warm = nil
+	return nil
+}
+
 // Clear 清除所有 CIDR
 func (m *CIDRMatcher) Clear() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.cidrs = make([]*net.IPNet, 0)
+	m.trie = newCIDRTrie()
+	m.warm = nil
 }
 
 // Count 返回 CIDR 数量
 func (m *CIDRMatcher) Count() int {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return len(m.cidrs)
+	return m.trie.Len()
 }
 
 // IPInCIDRs 检查 IP 是否在给定的 CIDR 列表中
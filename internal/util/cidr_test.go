@@ -1,8 +1,11 @@
 package util
 
 import (
+	"encoding/json"
 	"net"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestCIDRMatcher(t *testing.T) {
@@ -49,3 +52,315 @@ func TestCIDRMatcher(t *testing.T) {
 		t.Error("添加无效CIDR应该返回错误")
 	}
 }
+
+func TestCIDRMatcherContainsMapped(t *testing.T) {
+	matcher := NewCIDRMatcher()
+	if err := matcher.AddCIDRs([]string{"1.2.3.0/24", "2001:db8::/32", "::ffff:198.51.100.0/120"}); err != nil {
+		t.Fatalf("添加CIDR失败: %v", err)
+	}
+
+	testCases := []struct {
+		ip       net.IP
+		expected bool
+	}{
+		// 16 字节的 IPv4 映射地址与 IPv4 CIDR 比较
+		{net.ParseIP("::ffff:1.2.3.4"), true},
+		{net.IPv4(1, 2, 3, 4), true},
+		{net.ParseIP("1.2.3.4").To4(), true},
+		{net.ParseIP("::ffff:1.2.4.1"), false},
+		// IPv6 CIDR 不受影响，映射地址不在 2001:db8::/32 内
+		{net.ParseIP("2001:db8::1"), true},
+		{net.ParseIP("::ffff:32.1.13.184"), false},
+		// 以 IPv6 形式配置的映射网段
+		{net.ParseIP("::ffff:198.51.100.7"), true},
+		{net.ParseIP("198.51.100.7").To4(), true},
+		{net.ParseIP("::ffff:203.0.113.1"), false},
+	}
+	for _, tc := range testCases {
+		if got := matcher.ContainsMapped(tc.ip); got != tc.expected {
+			t.Errorf("ContainsMapped(%v, %d 字节) 期望: %v, 实际: %v", tc.ip, len(tc.ip), tc.expected, got)
+		}
+		if got := matcher.Contains(tc.ip); got != tc.expected {
+			t.Errorf("Contains(%v, %d 字节) 期望: %v, 实际: %v", tc.ip, len(tc.ip), tc.expected, got)
+		}
+	}
+
+	// 预热后结果不变
+	ips := make([]net.IP, len(testCases))
+	for i, tc := range testCases {
+		ips[i] = tc.ip
+	}
+	matcher.WarmLookupCache(ips)
+	if !matcher.ContainsMapped(net.ParseIP("::ffff:198.51.100.7")) {
+		t.Error("预热后 ::ffff:198.51.100.7 应命中 ::ffff:198.51.100.0/120")
+	}
+}
+
+func TestCIDRMatcherJSON(t *testing.T) {
+	matcher := NewCIDRMatcher()
+	matcher.AddCIDRs([]string{"10.0.0.0/8", "192.168.1.0/24", "2001:db8::/32"})
+
+	matcher.Contains(net.ParseIP("10.1.2.3"))
+	matcher.Contains(net.ParseIP("10.4.5.6"))
+	matcher.Contains(net.ParseIP("2001:db8::1"))
+	matcher.Contains(net.ParseIP("172.16.0.1")) // 未命中
+
+	data, err := json.Marshal(matcher)
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+
+	var infos []CIDRInfo
+	if err := json.Unmarshal(data, &infos); err != nil {
+		t.Fatalf("解析 JSON 数组失败: %v", err)
+	}
+	expectedHits := map[string]uint64{"10.0.0.0/8": 2, "192.168.1.0/24": 0, "2001:db8::/32": 1}
+	if len(infos) != len(expectedHits) {
+		t.Fatalf("CIDR 数量错误, 期望: %d, 实际: %d", len(expectedHits), len(infos))
+	}
+	for _, info := range infos {
+		if info.Hits != expectedHits[info.CIDR] {
+			t.Errorf("CIDR %s 命中次数错误, 期望: %d, 实际: %d", info.CIDR, expectedHits[info.CIDR], info.Hits)
+		}
+		if info.AddedAt.IsZero() {
+			t.Errorf("CIDR %s 缺少添加时间", info.CIDR)
+		}
+	}
+
+	// 反序列化后内容、添加时间与命中次数保持一致
+	restored := NewCIDRMatcher()
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatalf("反序列化失败: %v", err)
+	}
+	again, err := json.Marshal(restored)
+	if err != nil {
+		t.Fatalf("再次序列化失败: %v", err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("往返序列化结果不一致:\n%s\n%s", data, again)
+	}
+	if !restored.Contains(net.ParseIP("192.168.1.1")) {
+		t.Error("反序列化后的匹配器应该能正常匹配")
+	}
+
+	if err := json.Unmarshal([]byte(`[{"cidr":"bad"}]`), restored); err == nil {
+		t.Error("无效的 CIDR 应该返回错误")
+	}
+}
+
+func TestCIDRMatcherDiff(t *testing.T) {
+	old := NewCIDRMatcher()
+	old.AddCIDRs([]string{"10.0.0.0/8", "192.168.1.0/24", "2001:db8::/32"})
+	updated := NewCIDRMatcher()
+	updated.AddCIDRs([]string{"10.0.0.0/8", "172.16.0.0/12", "2001:db8::/32", "203.0.113.0/24"})
+
+	added, removed := old.Diff(updated)
+	if !reflect.DeepEqual(added, []string{"172.16.0.0/12", "203.0.113.0/24"}) {
+		t.Errorf("新增的 CIDR 错误: %v", added)
+	}
+	if !reflect.DeepEqual(removed, []string{"192.168.1.0/24"}) {
+		t.Errorf("移除的 CIDR 错误: %v", removed)
+	}
+
+	// 反向比较时新增与移除互换
+	added, removed = updated.Diff(old)
+	if !reflect.DeepEqual(added, []string{"192.168.1.0/24"}) || len(removed) != 2 {
+		t.Errorf("反向比较结果错误, 新增: %v, 移除: %v", added, removed)
+	}
+
+	// 内容相同时没有差异
+	if added, removed := old.Diff(old); len(added) != 0 || len(removed) != 0 {
+		t.Errorf("相同匹配器不应有差异, 新增: %v, 移除: %v", added, removed)
+	}
+	if added, removed := NewCIDRMatcher().Diff(old); len(added) != 3 || len(removed) != 0 {
+		t.Errorf("与空匹配器比较结果错误, 新增: %v, 移除: %v", added, removed)
+	}
+}
+
+func TestCIDRMatcherStatistics(t *testing.T) {
+	m := NewCIDRMatcher()
+	m.AddCIDRs([]string{"10.0.0.0/8", "172.16.0.0/12", "192.168.1.0/24"})
+
+	before := time.Now()
+	m.Contains(net.ParseIP("192.168.1.1"))
+	m.Contains(net.ParseIP("10.1.1.1"))
+	m.Contains(net.ParseIP("10.2.2.2"))
+	m.Contains(net.ParseIP("8.8.8.8")) // 未命中任何 CIDR
+
+	stats := m.Statistics()
+	if len(stats) != 3 {
+		t.Fatalf("统计数量错误, 期望: 3, 实际: %d", len(stats))
+	}
+	expected := []struct {
+		cidr string
+		hits uint64
+	}{
+		{"10.0.0.0/8", 2},
+		{"192.168.1.0/24", 1},
+		{"172.16.0.0/12", 0},
+	}
+	for i, e := range expected {
+		if stats[i].CIDR != e.cidr || stats[i].Hits != e.hits {
+			t.Errorf("第 %d 项错误, 期望: %s (%d), 实际: %s (%d)", i, e.cidr, e.hits, stats[i].CIDR, stats[i].Hits)
+		}
+	}
+	if stats[0].LastHit.Before(before) || stats[1].LastHit.Before(before) {
+		t.Errorf("命中的 CIDR 应记录最近命中时间: %+v", stats)
+	}
+	if !stats[2].LastHit.IsZero() {
+		t.Errorf("未命中的 CIDR 最近命中时间应为零值: %v", stats[2].LastHit)
+	}
+
+	// 命中次数继续递增
+	m.Contains(net.ParseIP("172.16.0.1"))
+	m.Contains(net.ParseIP("172.16.0.2"))
+	m.Contains(net.ParseIP("172.16.0.3"))
+	if stats = m.Statistics(); stats[0].CIDR != "172.16.0.0/12" || stats[0].Hits != 3 {
+		t.Errorf("命中次数递增后排序错误: %+v", stats)
+	}
+}
+
+func TestCIDRMatcherLookup(t *testing.T) {
+	m := NewCIDRMatcher()
+	m.AddCIDRs([]string{"10.0.0.0/8", "10.1.0.0/16", "2001:db8::/32"})
+
+	testCases := []struct {
+		ip       string
+		expected string
+		found    bool
+	}{
+		{"10.1.2.3", "10.0.0.0/8", true},
+		{"10.200.0.1", "10.0.0.0/8", true},
+		{"2001:db8::1", "2001:db8::/32", true},
+		{"192.168.1.1", "", false},
+	}
+	for _, tc := range testCases {
+		cidr, found := m.Lookup(net.ParseIP(tc.ip))
+		if cidr != tc.expected || found != tc.found {
+			t.Errorf("Lookup(%s) 错误, 期望: %q %v, 实际: %q %v", tc.ip, tc.expected, tc.found, cidr, found)
+		}
+	}
+
+	for _, stat := range m.Statistics() {
+		if stat.Hits != 0 {
+			t.Errorf("Lookup 不应计入命中统计: %+v", stat)
+		}
+	}
+}
+
+func TestCIDRMatcherWarmLookupCache(t *testing.T) {
+	cidrs := []string{"10.0.0.0/8", "192.168.1.0/24", "2001:db8::/32"}
+	ips := []net.IP{
+		net.ParseIP("10.1.2.3"),
+		net.ParseIP("192.168.1.10"),
+		net.ParseIP("192.168.2.10"),
+		net.ParseIP("2001:db8::1"),
+		net.ParseIP("2001:db9::1"),
+		net.ParseIP("8.8.8.8"),
+	}
+
+	direct := NewCIDRMatcher()
+	direct.AddCIDRs(cidrs)
+	warmed := NewCIDRMatcher()
+	warmed.AddCIDRs(cidrs)
+	warmed.WarmLookupCache(ips)
+
+	for _, ip := range ips {
+		// IPv4 地址的 16 字节形式应命中同一缓存条目
+		for _, form := range []net.IP{ip, ip.To16()} {
+			if got, want := warmed.Contains(form), direct.Contains(form); got != want {
+				t.Errorf("Contains(%s) 缓存结果与直接计算不一致, 缓存: %v, 直接: %v", form, got, want)
+			}
+		}
+	}
+	if misses := warmed.WarmCacheMisses(); misses != 0 {
+		t.Errorf("预热过的地址不应计入未命中, 实际: %d", misses)
+	}
+	if warmed.Statistics()[0].Hits != direct.Statistics()[0].Hits {
+		t.Errorf("缓存查找的命中统计应与直接计算一致: %+v / %+v", warmed.Statistics(), direct.Statistics())
+	}
+
+	warmed.Contains(net.ParseIP("10.9.9.9"))
+	if misses := warmed.WarmCacheMisses(); misses != 1 {
+		t.Errorf("未预热的地址应计入未命中, 实际: %d", misses)
+	}
+
+	// 修改 CIDR 后缓存失效，结果按新的 CIDR 计算
+	warmed.RemoveCIDR("10.0.0.0/8")
+	if warmed.Contains(net.ParseIP("10.1.2.3")) {
+		t.Error("RemoveCIDR 后缓存应失效")
+	}
+	warmed.WarmLookupCache(ips)
+	warmed.AddCIDR("8.8.8.0/24")
+	if !warmed.Contains(net.ParseIP("8.8.8.8")) {
+		t.Error("AddCIDR 后缓存应失效")
+	}
+	warmed.WarmLookupCache(ips)
+	warmed.Clear()
+	if warmed.Contains(net.ParseIP("192.168.1.10")) {
+		t.Error("Clear 后缓存应失效")
+	}
+	if misses := warmed.WarmCacheMisses(); misses != 1 {
+		t.Errorf("缓存失效后不应计入未命中, 实际: %d", misses)
+	}
+}
+
+func TestCIDRMatcherComplement(t *testing.T) {
+	complement := func(m *CIDRMatcher, universe string) []string {
+		_, u, err := net.ParseCIDR(universe)
+		if err != nil {
+			t.Fatalf("解析 %s 失败: %v", universe, err)
+		}
+		result := make([]string, 0)
+		for _, cidr := range m.Complement(u) {
+			result = append(result, cidr.String())
+		}
+		return result
+	}
+
+	m := NewCIDRMatcher()
+	m.AddCIDRs([]string{"10.0.0.0/9", "10.128.0.0/10", "10.192.0.0/16", "10.255.0.0/24", "192.168.0.0/16", "2001:db8::/32"})
+
+	testCases := []struct {
+		universe string
+		expected []string
+	}{
+		{"10.0.0.0/8", []string{
+			"10.193.0.0/16", "10.194.0.0/15", "10.196.0.0/14", "10.200.0.0/13", "10.208.0.0/12", "10.224.0.0/12",
+			"10.240.0.0/13", "10.248.0.0/14", "10.252.0.0/15", "10.254.0.0/16", "10.255.1.0/24", "10.255.2.0/23",
+			"10.255.4.0/22", "10.255.8.0/21", "10.255.16.0/20", "10.255.32.0/19", "10.255.64.0/18", "10.255.128.0/17",
+		}},
+		// 被单个 CIDR 完全覆盖
+		{"10.64.0.0/10", []string{}},
+		{"192.168.1.0/24", []string{}},
+		// 与任何 CIDR 都不相交
+		{"172.16.0.0/12", []string{"172.16.0.0/12"}},
+		// 未对齐的 universe 按网络地址处理
+		{"10.255.0.5/23", []string{"10.255.1.0/24"}},
+		{"2001:db8::/31", []string{"2001:db9::/32"}},
+	}
+	for _, tc := range testCases {
+		if got := complement(m, tc.universe); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("Complement(%s) 错误\n期望: %v\n实际: %v", tc.universe, tc.expected, got)
+		}
+	}
+
+	// 补集与已有 CIDR 恰好拼成 universe：补集中的每个网段都不与匹配器相交，且地址总数相符
+	_, universe, _ := net.ParseCIDR("10.0.0.0/8")
+	var uncovered uint64
+	for _, cidr := range m.Complement(universe) {
+		if m.Contains(cidr.IP) {
+			t.Errorf("补集网段 %s 不应被匹配器覆盖", cidr)
+		}
+		ones, bits := cidr.Mask.Size()
+		uncovered += 1 << uint(bits-ones)
+	}
+	covered := uint64(1<<23 + 1<<22 + 1<<16 + 1<<8)
+	if uncovered+covered != 1<<24 {
+		t.Errorf("补集地址数错误: %d + %d != %d", uncovered, covered, 1<<24)
+	}
+
+	if m.Complement(nil) != nil {
+		t.Error("universe 为 nil 时应返回 nil")
+	}
+}
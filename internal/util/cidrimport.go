@@ -0,0 +1,263 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxCIDRListSize 从 URL 导入 CIDR 列表时响应体的读取上限
+const maxCIDRListSize = 32 << 20
+
+// ImportFromURL 从 URL 下载 CIDR 列表并添加到匹配器，返回新增的 CIDR 数量，ctx 控制取消与超时。
+// 支持的格式按内容自动识别：
+//   - 每行一个 CIDR 的纯文本，忽略空行与 # 注释，不带前缀长度的 IP 视为单个地址
+//   - AWS ip-ranges.json ({"prefixes": [{"ip_prefix": ...}], "ipv6_prefixes": [{"ipv6_prefix": ...}]})
+//   - GCP cloud.json / goog.json ({"prefixes": [{"ipv4Prefix": ...}, {"ipv6Prefix": ...}]})
+//
+// 其他 JSON 格式可在 URL 末尾以 #$.prefixes[*].ip_prefix 形式的路径指定 CIDR 所在位置。
+// 列表全部解析成功后才会添加，任一条目无效或响应超过 32 MiB 时不修改匹配器
+func (m *CIDRMatcher) ImportFromURL(ctx context.Context, url string) (int, error) {
+	url, path := splitJSONPath(url)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("创建请求失败: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("下载 %s 失败: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("下载 %s 失败: 状态码 %d", url, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCIDRListSize+1))
+	if err != nil {
+		return 0, fmt.Errorf("读取 %s 失败: %w", url, err)
+	}
+	if len(body) > maxCIDRListSize {
+		return 0, fmt.Errorf("%s 的响应超过 %d 字节上限", url, maxCIDRListSize)
+	}
+
+	var cidrs []string
+	switch trimmed := bytes.TrimSpace(body); {
+	case path != "":
+		cidrs, err = extractJSONPath(trimmed, path)
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		cidrs, err = parseCloudIPRanges(trimmed)
+	default:
+		cidrs, err = parseCIDRLines(trimmed)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("解析 %s 失败: %w", url, err)
+	}
+
+	for i, cidr := range cidrs {
+		if cidrs[i], err = normalizeCIDR(cidr); err != nil {
+			return 0, fmt.Errorf("解析 %s 失败: %w", url, err)
+		}
+	}
+	added := 0
+	for _, cidr := range cidrs {
+		before := m.Count()
+		if err := m.AddCIDR(cidr); err != nil {
+			return added, err
+		}
+		if m.Count() > before {
+			added++
+		}
+	}
+	return added, nil
+}
+
+// splitJSONPath 拆分 URL 末尾以 #$ 开头的 JSON 路径，没有路径时 path 为空
+func splitJSONPath(rawURL string) (url, path string) {
+	if i := strings.LastIndex(rawURL, "#$"); i >= 0 {
+		return rawURL[:i], rawURL[i+1:]
+	}
+	return rawURL, ""
+}
+
+// normalizeCIDR 校验 CIDR，不带前缀长度的 IP 转换为 /32 或 /128
+func normalizeCIDR(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return "", fmt.Errorf("无效的 CIDR: %q", s)
+		}
+		if ip.To4() != nil {
+			return s + "/32", nil
+		}
+		return s + "/128", nil
+	}
+	if _, _, err := net.ParseCIDR(s); err != nil {
+		return "", fmt.Errorf("无效的 CIDR: %q", s)
+	}
+	return s, nil
+}
+
+// parseCIDRLines 解析每行一个 CIDR 的纯文本列表
+func parseCIDRLines(data []byte) ([]string, error) {
+	var cidrs []string
+	err := scanLines(bytes.NewReader(data), func(_ int, line string) error {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			cidrs = append(cidrs, line)
+		}
+		return nil
+	})
+	return cidrs, err
+}
+
+// cloudIPRanges AWS 与 GCP 发布的 IP 段 JSON 中与 CIDR 相关的字段
+type cloudIPRanges struct {
+	Prefixes []struct {
+		IPPrefix   string `json:"ip_prefix"`  // AWS
+		IPv4Prefix string `json:"ipv4Prefix"` // GCP
+		IPv6Prefix string `json:"ipv6Prefix"` // GCP
+	} `json:"prefixes"`
+	IPv6Prefixes []struct {
+		IPv6Prefix string `json:"ipv6_prefix"` // AWS
+	} `json:"ipv6_prefixes"`
+}
+
+// parseCloudIPRanges 解析 AWS ip-ranges.json 或 GCP cloud.json 格式的 IP 段列表
+func parseCloudIPRanges(data []byte) ([]string, error) {
+	var ranges cloudIPRanges
+	if err := json.Unmarshal(data, &ranges); err != nil {
+		return nil, err
+	}
+
+	var cidrs []string
+	for _, p := range ranges.Prefixes {
+		for _, cidr := range []string{p.IPPrefix, p.IPv4Prefix, p.IPv6Prefix} {
+			if cidr != "" {
+				cidrs = append(cidrs, cidr)
+			}
+		}
+	}
+	for _, p := range ranges.IPv6Prefixes {
+		if p.IPv6Prefix != "" {
+			cidrs = append(cidrs, p.IPv6Prefix)
+		}
+	}
+	if len(cidrs) == 0 {
+		return nil, fmt.Errorf("未识别的 JSON 格式，请在 URL 末尾用 #$.path 指定 CIDR 所在位置")
+	}
+	return cidrs, nil
+}
+
+// jsonPathStep JSON 路径中的一步：对象键、数组下标或数组全部元素
+type jsonPathStep struct {
+	key   string
+	index int
+	array bool // 为 true 时按数组下标 index 取值，index < 0 表示全部元素
+}
+
+// extractJSONPath 按 $.a.b[*].c 形式的路径从 JSON 中取出字符串值。
+// 支持 .key、['key']、[*] (数组全部元素) 与 [N] (数组下标) 四种步骤
+func extractJSONPath(data []byte, path string) ([]string, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var root interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	nodes := []interface{}{root}
+	for _, step := range steps {
+		var next []interface{}
+		for _, node := range nodes {
+			if step.array {
+				arr, ok := node.([]interface{})
+				if !ok {
+					continue
+				}
+				if step.index < 0 {
+					next = append(next, arr...)
+				} else if step.index < len(arr) {
+					next = append(next, arr[step.index])
+				}
+				continue
+			}
+			if obj, ok := node.(map[string]interface{}); ok {
+				if v, ok := obj[step.key]; ok {
+					next = append(next, v)
+				}
+			}
+		}
+		nodes = next
+	}
+
+	result := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		s, ok := node.(string)
+		if !ok {
+			return nil, fmt.Errorf("路径 %s 指向的值不是字符串: %v", path, node)
+		}
+		result = append(result, s)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("路径 %s 没有匹配到任何值", path)
+	}
+	return result, nil
+}
+
+// parseJSONPath 将 $.a['b'][*][0] 形式的路径拆分为步骤
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("JSON 路径必须以 $ 开头: %s", path)
+	}
+	var steps []jsonPathStep
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("JSON 路径中的键不能为空: %s", path)
+			}
+			steps = append(steps, jsonPathStep{key: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("JSON 路径缺少 ]: %s", path)
+			}
+			inner := rest[1:end]
+			switch {
+			case inner == "*":
+				steps = append(steps, jsonPathStep{array: true, index: -1})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				steps = append(steps, jsonPathStep{key: inner[1 : len(inner)-1]})
+			default:
+				idx, err := strconv.Atoi(inner)
+				if err != nil || idx < 0 {
+					return nil, fmt.Errorf("JSON 路径中无效的下标 [%s]: %s", inner, path)
+				}
+				steps = append(steps, jsonPathStep{array: true, index: idx})
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("无效的 JSON 路径: %s", path)
+		}
+	}
+	return steps, nil
+}
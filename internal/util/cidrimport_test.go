@@ -0,0 +1,137 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const sampleAWSIPRanges = `{
+  "syncToken": "1700000000",
+  "prefixes": [
+    {"ip_prefix": "3.5.140.0/22", "region": "ap-northeast-2", "service": "AMAZON"},
+    {"ip_prefix": "13.32.0.0/15", "region": "GLOBAL", "service": "CLOUDFRONT"}
+  ],
+  "ipv6_prefixes": [
+    {"ipv6_prefix": "2600:9000::/28", "region": "GLOBAL", "service": "CLOUDFRONT"}
+  ]
+}`
+
+const sampleGCPIPRanges = `{
+  "syncToken": "1700000000",
+  "prefixes": [
+    {"ipv4Prefix": "34.1.208.0/20", "service": "Google Cloud", "scope": "africa-south1"},
+    {"ipv6Prefix": "2600:1900:8000::/44", "service": "Google Cloud", "scope": "africa-south1"}
+  ]
+}`
+
+const sampleCustomJSON = `{"data": {"ranges": [{"cidr": "198.51.100.0/24"}, {"cidr": "203.0.113.0/24"}]}}`
+
+func newCIDRListServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	lists := map[string]string{
+		"/plain.txt":  "# CDN 节点\n192.0.2.0/24\n\n198.51.100.7  # 单个地址\n2001:db8::/32\n",
+		"/aws.json":   sampleAWSIPRanges,
+		"/gcp.json":   sampleGCPIPRanges,
+		"/custom":     sampleCustomJSON,
+		"/invalid":    "192.0.2.0/24\nnot-a-cidr\n",
+		"/unknown":    `{"items": ["192.0.2.0/24"]}`,
+		"/not-string": `{"items": [1, 2]}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oversized" {
+			// 上限内是有效列表，截断后同样可以解析
+			w.Write([]byte("192.0.2.0/24\n"))
+			w.Write(bytes.Repeat([]byte("# padding\n"), maxCIDRListSize/10+1))
+			return
+		}
+		if r.URL.Path == "/slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		body, ok := lists[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCIDRMatcherImportFromURL(t *testing.T) {
+	server := newCIDRListServer(t)
+
+	testCases := []struct {
+		name     string
+		path     string
+		expected []string
+	}{
+		{"纯文本", "/plain.txt", []string{"192.0.2.0/24", "198.51.100.7/32", "2001:db8::/32"}},
+		{"AWS JSON", "/aws.json", []string{"13.32.0.0/15", "2600:9000::/28", "3.5.140.0/22"}},
+		{"GCP JSON", "/gcp.json", []string{"2600:1900:8000::/44", "34.1.208.0/20"}},
+		{"自定义路径", "/custom#$.data.ranges[*].cidr", []string{"198.51.100.0/24", "203.0.113.0/24"}},
+		{"括号形式的路径", "/custom#$['data']['ranges'][1].cidr", []string{"203.0.113.0/24"}},
+		{"AWS 指定路径", "/aws.json#$.prefixes[*].ip_prefix", []string{"13.32.0.0/15", "3.5.140.0/22"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewCIDRMatcher()
+			added, err := m.ImportFromURL(context.Background(), server.URL+tc.path)
+			if err != nil {
+				t.Fatalf("导入失败: %v", err)
+			}
+			if added != len(tc.expected) {
+				t.Errorf("新增数量错误, 期望: %d, 实际: %d", len(tc.expected), added)
+			}
+			if got := m.GetCIDRs(); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("导入的 CIDR 错误, 期望: %v, 实际: %v", tc.expected, got)
+			}
+		})
+	}
+
+	// 已存在的 CIDR 不计入新增数量
+	m := NewCIDRMatcher()
+	m.AddCIDR("192.0.2.0/24")
+	added, err := m.ImportFromURL(context.Background(), server.URL+"/plain.txt")
+	if err != nil || added != 2 {
+		t.Errorf("重复导入结果错误, 期望: 2, nil, 实际: %d, %v", added, err)
+	}
+	if !m.Contains(net.ParseIP("198.51.100.7")) {
+		t.Error("单个地址应按 /32 导入")
+	}
+}
+
+func TestCIDRMatcherImportFromURLErrors(t *testing.T) {
+	server := newCIDRListServer(t)
+
+	for _, path := range []string{"/missing", "/invalid", "/unknown", "/not-string", "/custom#$.data.none[*]", "/custom#data", "/oversized"} {
+		m := NewCIDRMatcher()
+		if _, err := m.ImportFromURL(context.Background(), server.URL+path); err == nil {
+			t.Errorf("%s 应返回错误", path)
+		}
+		if m.Count() != 0 {
+			t.Errorf("%s 出错时不应修改匹配器, 实际包含: %v", path, m.GetCIDRs())
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := NewCIDRMatcher().ImportFromURL(ctx, server.URL+"/slow"); err == nil {
+		t.Error("超时应返回错误")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("ctx 超时后应尽快返回, 实际耗时: %v", elapsed)
+	}
+}
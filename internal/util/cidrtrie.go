@@ -0,0 +1,243 @@
+package util
+
+import (
+	"net"
+	"time"
+)
+
+// cidrTrie 基于二进制前缀树（按位展开的 IPv4/IPv6 地址）实现的 CIDR 集合
+// 查找复杂度只与地址位数相关（IPv4 最多 32 层，IPv6 最多 128 层），与 CIDR 数量无关
+// 注意：cidrTrie 本身不是并发安全的，由 CIDRMatcher 负责加锁
+type cidrTrie struct {
+	v4   *trieNode
+	v6   *trieNode
+	size int
+}
+
+// trieNode 前缀树节点
+type trieNode struct {
+	children [2]*trieNode
+	// entry 非空表示有一个 CIDR 在此节点结束
+	entry *cidrEntry
+}
+
+// newCIDRTrie 创建空的前缀树
+func newCIDRTrie() *cidrTrie {
+	return &cidrTrie{
+		v4: &trieNode{},
+		v6: &trieNode{},
+	}
+}
+
+// root 根据地址长度选择对应的根节点，并返回标准化后的地址
+func (t *cidrTrie) root(ip net.IP) (*trieNode, net.IP) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return t.v4, ip4
+	}
+	if ip16 := ip.To16(); ip16 != nil {
+		return t.v6, ip16
+	}
+	return nil, nil
+}
+
+// netRoot 根据 CIDR 的掩码长度选择根节点，返回地址与前缀长度
+func (t *cidrTrie) netRoot(cidr *net.IPNet) (*trieNode, net.IP, int) {
+	ones, bits := cidr.Mask.Size()
+	switch bits {
+	case 8 * net.IPv4len:
+		return t.v4, cidr.IP.To4(), ones
+	case 8 * net.IPv6len:
+		return t.v6, cidr.IP.To16(), ones
+	}
+	return nil, nil, 0
+}
+
+// bitAt 返回地址第 i 位（从最高位开始计数）
+func bitAt(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
+
+// Insert 插入 CIDR，已存在时返回 false
+func (t *cidrTrie) Insert(cidr *net.IPNet) bool {
+	return t.insertEntry(&cidrEntry{cidr: cidr, addedAt: time.Now()})
+}
+
+// insertEntry 插入带元数据的 CIDR 条目，已存在时返回 false
+func (t *cidrTrie) insertEntry(entry *cidrEntry) bool {
+	node, ip, ones := t.netRoot(entry.cidr)
+	if node == nil || ip == nil {
+		return false
+	}
+
+	for i := 0; i < ones; i++ {
+		b := bitAt(ip, i)
+		if node.children[b] == nil {
+			node.children[b] = &trieNode{}
+		}
+		node = node.children[b]
+	}
+
+	if node.entry != nil {
+		return false
+	}
+	node.entry = entry
+	t.size++
+	return true
+}
+
+// Delete 删除 CIDR，不存在时返回 false
+func (t *cidrTrie) Delete(cidr *net.IPNet) bool {
+	node, ip, ones := t.netRoot(cidr)
+	if node == nil || ip == nil {
+		return false
+	}
+
+	// 记录路径以便删除后回收空节点
+	path := make([]*trieNode, 0, ones+1)
+	path = append(path, node)
+	for i := 0; i < ones; i++ {
+		node = node.children[bitAt(ip, i)]
+		if node == nil {
+			return false
+		}
+		path = append(path, node)
+	}
+
+	if node.entry == nil {
+		return false
+	}
+	node.entry = nil
+	t.size--
+
+	// 自底向上回收不再承载任何 CIDR 的节点（根节点保留）
+	for i := len(path) - 1; i > 0; i-- {
+		n := path[i]
+		if n.entry != nil || n.children[0] != nil || n.children[1] != nil {
+			break
+		}
+		path[i-1].children[bitAt(ip, i-1)] = nil
+	}
+	return true
+}
+
+// Contains 检查 IP 是否落在任何已插入的 CIDR 中
+func (t *cidrTrie) Contains(ip net.IP) bool {
+	return t.Lookup(ip) != nil
+}
+
+// Lookup 返回包含该 IP 的最短前缀 CIDR，不存在时返回 nil
+func (t *cidrTrie) Lookup(ip net.IP) *net.IPNet {
+	if entry := t.lookupEntry(ip); entry != nil {
+		return entry.cidr
+	}
+	return nil
+}
+
+// lookupEntry 返回包含该 IP 的最短前缀 CIDR 条目，不存在时返回 nil
+func (t *cidrTrie) lookupEntry(ip net.IP) *cidrEntry {
+	node, addr := t.root(ip)
+	if node == nil {
+		return nil
+	}
+	return lookupFrom(node, addr)
+}
+
+// lookupMappedEntry 与 lookupEntry 相同，但 IPv4 地址（4 字节或 IPv4 映射的 16 字节形式）在 IPv4 CIDR 中未命中时，
+// 再以映射形式 ::ffff:a.b.c.d 在 IPv6 CIDR (如 ::ffff:0:0/96) 中查找
+func (t *cidrTrie) lookupMappedEntry(ip net.IP) *cidrEntry {
+	if entry := t.lookupEntry(ip); entry != nil {
+		return entry
+	}
+	if ip.To4() != nil {
+		return lookupFrom(t.v6, ip.To16())
+	}
+	return nil
+}
+
+// lookupFrom 从 node 开始按 addr 的各位向下查找第一个承载 CIDR 的节点
+func lookupFrom(node *trieNode, addr net.IP) *cidrEntry {
+	total := len(addr) * 8
+	for i := 0; ; i++ {
+		if node.entry != nil {
+			return node.entry
+		}
+		if i >= total {
+			return nil
+		}
+		node = node.children[bitAt(addr, i)]
+		if node == nil {
+			return nil
+		}
+	}
+}
+
+// Complement 返回 universe 中不被任何已插入 CIDR 覆盖的部分，按地址从小到大排列。
+// 沿 universe 的前缀向下，再对其子树递归：空子树整体未覆盖，承载 CIDR 的节点整体已覆盖，其余继续按下一位拆分
+func (t *cidrTrie) Complement(universe *net.IPNet) []*net.IPNet {
+	node, ip, ones := t.netRoot(universe)
+	if node == nil || ip == nil {
+		return nil
+	}
+	prefix := make(net.IP, len(ip))
+	copy(prefix, ip.Mask(net.CIDRMask(ones, len(ip)*8)))
+
+	for i := 0; i < ones; i++ {
+		if node.entry != nil {
+			return nil
+		}
+		if node = node.children[bitAt(prefix, i)]; node == nil {
+			break
+		}
+	}
+
+	var result []*net.IPNet
+	complementTrie(node, prefix, ones, &result)
+	return result
+}
+
+// complementTrie 将 prefix/ones 对应子树中未被覆盖的部分追加到 result
+func complementTrie(node *trieNode, prefix net.IP, ones int, result *[]*net.IPNet) {
+	if node == nil {
+		*result = append(*result, &net.IPNet{IP: prefix, Mask: net.CIDRMask(ones, len(prefix)*8)})
+		return
+	}
+	if node.entry != nil {
+		return
+	}
+	for b := 0; b < 2; b++ {
+		child := make(net.IP, len(prefix))
+		copy(child, prefix)
+		if b == 1 {
+			child[ones/8] |= 1 << (7 - uint(ones%8))
+		}
+		complementTrie(node.children[b], child, ones+1, result)
+	}
+}
+
+// Walk 按前序遍历所有 CIDR
+func (t *cidrTrie) Walk(fn func(cidr *net.IPNet)) {
+	t.walkEntries(func(entry *cidrEntry) { fn(entry.cidr) })
+}
+
+// walkEntries 按前序遍历所有 CIDR 条目
+func (t *cidrTrie) walkEntries(fn func(entry *cidrEntry)) {
+	walkTrie(t.v4, fn)
+	walkTrie(t.v6, fn)
+}
+
+// walkTrie 递归遍历子树
+func walkTrie(node *trieNode, fn func(entry *cidrEntry)) {
+	if node == nil {
+		return
+	}
+	if node.entry != nil {
+		fn(node.entry)
+	}
+	walkTrie(node.children[0], fn)
+	walkTrie(node.children[1], fn)
+}
+
+// Len 返回 CIDR 数量
+func (t *cidrTrie) Len() int {
+	return t.size
+}
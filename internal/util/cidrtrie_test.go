@@ -0,0 +1,149 @@
+package util
+
+import (
+	"math/rand"
+	"net"
+	"testing"
+)
+
+func TestCIDRTrie(t *testing.T) {
+	trie := newCIDRTrie()
+
+	cidrs := []string{"10.0.0.0/8", "192.168.1.0/24", "192.168.1.128/25", "2001:db8::/32"}
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			t.Fatalf("解析CIDR失败: %v", err)
+		}
+		if !trie.Insert(n) {
+			t.Errorf("插入 %s 应该成功", c)
+		}
+	}
+
+	// 重复插入
+	_, dup, _ := net.ParseCIDR("10.0.0.0/8")
+	if trie.Insert(dup) {
+		t.Error("重复插入应该返回 false")
+	}
+	if trie.Len() != len(cidrs) {
+		t.Errorf("CIDR 数量错误, 期望: %d, 实际: %d", len(cidrs), trie.Len())
+	}
+
+	testCases := []struct {
+		ip       string
+		expected bool
+	}{
+		{"10.255.0.1", true},
+		{"11.0.0.1", false},
+		{"192.168.1.1", true},
+		{"192.168.1.200", true},
+		{"192.168.2.1", false},
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+		{"::ffff:10.1.2.3", true}, // IPv4 映射地址按 IPv4 处理
+	}
+	for _, tc := range testCases {
+		if got := trie.Contains(net.ParseIP(tc.ip)); got != tc.expected {
+			t.Errorf("IP %s 匹配结果错误, 期望: %v, 实际: %v", tc.ip, tc.expected, got)
+		}
+	}
+
+	// 删除外层网段后，内层网段仍然生效
+	_, outer, _ := net.ParseCIDR("192.168.1.0/24")
+	if !trie.Delete(outer) {
+		t.Fatal("删除 192.168.1.0/24 应该成功")
+	}
+	if trie.Delete(outer) {
+		t.Error("重复删除应该返回 false")
+	}
+	if trie.Contains(net.ParseIP("192.168.1.1")) {
+		t.Error("192.168.1.1 在删除 /24 后不应该匹配")
+	}
+	if !trie.Contains(net.ParseIP("192.168.1.200")) {
+		t.Error("192.168.1.200 仍应匹配 192.168.1.128/25")
+	}
+
+	var walked []string
+	trie.Walk(func(n *net.IPNet) { walked = append(walked, n.String()) })
+	if len(walked) != trie.Len() {
+		t.Errorf("遍历数量错误, 期望: %d, 实际: %d", trie.Len(), len(walked))
+	}
+}
+
+// randomCIDRs 生成固定随机种子的 IPv4 CIDR 列表
+func randomCIDRs(n int) []*net.IPNet {
+	rng := rand.New(rand.NewSource(1))
+	result := make([]*net.IPNet, 0, n)
+	for len(result) < n {
+		ip := net.IPv4(byte(rng.Intn(224)), byte(rng.Intn(256)), byte(rng.Intn(256)), 0)
+		ones := 16 + rng.Intn(9)
+		mask := net.CIDRMask(ones, 32)
+		result = append(result, &net.IPNet{IP: ip.Mask(mask), Mask: mask})
+	}
+	return result
+}
+
+// missIPs 生成不落在任何 CIDR 中的 IP
+func missIPs(cidrs []*net.IPNet, n int) []net.IP {
+	rng := rand.New(rand.NewSource(2))
+	result := make([]net.IP, 0, n)
+	for len(result) < n {
+		ip := net.IPv4(byte(rng.Intn(224)), byte(rng.Intn(256)), byte(rng.Intn(256)), byte(rng.Intn(256)))
+		hit := false
+		for _, c := range cidrs {
+			if c.Contains(ip) {
+				hit = true
+				break
+			}
+		}
+		if !hit {
+			result = append(result, ip)
+		}
+	}
+	return result
+}
+
+func BenchmarkCIDRLookupMiss(b *testing.B) {
+	cidrs := randomCIDRs(5000)
+	ips := missIPs(cidrs, 1024)
+
+	b.Run("linear", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			ip := ips[i%len(ips)]
+			for _, c := range cidrs {
+				if c.Contains(ip) {
+					break
+				}
+			}
+		}
+	})
+
+	b.Run("trie", func(b *testing.B) {
+		matcher := NewCIDRMatcher()
+		for _, c := range cidrs {
+			matcher.AddCIDR(c.String())
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			matcher.Contains(ips[i%len(ips)])
+		}
+	})
+}
+
+func BenchmarkCIDRLookupParallel(b *testing.B) {
+	cidrs := randomCIDRs(5000)
+	ips := missIPs(cidrs, 1024)
+	matcher := NewCIDRMatcher()
+	for _, c := range cidrs {
+		matcher.AddCIDR(c.String())
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			matcher.Contains(ips[i%len(ips)])
+			i++
+		}
+	})
+}
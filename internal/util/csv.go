@@ -0,0 +1,95 @@
+package util
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// csvOptions LoadFromCSV 的可选参数
+type csvOptions struct {
+	skipHeader bool
+	comment    rune
+}
+
+// CSVOption LoadFromCSV 的可选项
+type CSVOption func(*csvOptions)
+
+// WithCSVHeader 跳过 CSV 的第一行（表头）
+func WithCSVHeader() CSVOption {
+	return func(o *csvOptions) {
+		o.skipHeader = true
+	}
+}
+
+// WithCSVComment 以 c 开头的行视为注释并忽略，如 '#'
+func WithCSVComment(c rune) CSVOption {
+	return func(o *csvOptions) {
+		o.comment = c
+	}
+}
+
+// LoadFromCSV 从 CSV 中读取第 patternCol 列（从 0 开始）的域名模式并添加到匹配器，其余列（备注、负责人等元数据）被忽略。
+// 返回成功新增的模式数量，以及无法处理的行对应的错误（格式错误、列数不足、无效的正则表达式），
+// 出错的行被跳过，不影响其他行的添加；空模式与已存在的模式不计入数量也不视为错误
+func (m *DomainMatcher) LoadFromCSV(r io.Reader, patternCol int, opts ...CSVOption) (int, []error) {
+	var o csvOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if patternCol < 0 {
+		return 0, []error{fmt.Errorf("无效的列序号: %d", patternCol)}
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = o.comment
+	reader.TrimLeadingSpace = true
+
+	added := 0
+	var errs []error
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errs = append(errs, err)
+			// 单行的格式错误可以跳过继续读取，底层读取失败时停止
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				continue
+			}
+			break
+		}
+		if first && o.skipHeader {
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+		if patternCol >= len(record) {
+			errs = append(errs, fmt.Errorf("第 %d 行: 只有 %d 列，缺少第 %d 列", line, len(record), patternCol))
+			continue
+		}
+		pattern := strings.TrimSpace(record[patternCol])
+		if pattern == "" {
+			continue
+		}
+
+		before := m.Count()
+		if strings.HasPrefix(pattern, RegexPatternPrefix) {
+			if err := m.AddRegexPattern(pattern); err != nil {
+				errs = append(errs, fmt.Errorf("第 %d 行: %w", line, err))
+				continue
+			}
+		} else {
+			m.AddPattern(pattern)
+		}
+		if m.Count() > before {
+			added++
+		}
+	}
+	return added, errs
+}
@@ -0,0 +1,100 @@
+package util
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDomainMatcherLoadFromCSV(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		col      int
+		opts     []CSVOption
+		added    int
+		errs     int
+		patterns []string
+	}{
+		{
+			name: "带表头",
+			input: `pattern,owner,note
+example.com,ops,主站
+*.cdn.example.com,cdn,"静态资源, 图片"
+`,
+			col:      0,
+			opts:     []CSVOption{WithCSVHeader()},
+			added:    2,
+			patterns: []string{"example.com", "*.cdn.example.com"},
+		},
+		{
+			name: "模式在第二列并带注释",
+			input: `# 导出自运维表格
+1,example.org,tier1
+# 2,disabled.example.org,tier2
+3,re:^api[0-9]+\.example\.org$,tier1
+`,
+			col:      1,
+			opts:     []CSVOption{WithCSVComment('#')},
+			added:    2,
+			patterns: []string{"example.org", "re:^api[0-9]+\\.example\\.org$"},
+		},
+		{
+			name: "空模式与重复模式",
+			input: `example.net,a
+,b
+example.net,c
+`,
+			col:      0,
+			added:    1,
+			patterns: []string{"example.net"},
+		},
+		{
+			name: "无效正则",
+			input: `example.com,ops
+re:[invalid,ops
+www.example.com,ops
+`,
+			col:      0,
+			added:    2,
+			errs:     1,
+			patterns: []string{"example.com", "www.example.com"},
+		},
+		{
+			name: "缺少模式列",
+			input: `example.com
+www.example.com,ops
+`,
+			col:      1,
+			added:    1,
+			errs:     1,
+			patterns: []string{"ops"},
+		},
+		{
+			name: "格式错误的行被跳过",
+			input: `example.com,ops
+"unterminated,ops
+`,
+			col:      0,
+			added:    1,
+			errs:     1,
+			patterns: []string{"example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewDomainMatcher()
+			added, errs := m.LoadFromCSV(strings.NewReader(tt.input), tt.col, tt.opts...)
+			if added != tt.added {
+				t.Errorf("新增数量错误, 期望: %d, 实际: %d", tt.added, added)
+			}
+			if len(errs) != tt.errs {
+				t.Errorf("错误数量错误, 期望: %d, 实际: %d (%v)", tt.errs, len(errs), errs)
+			}
+			if got := m.GetPatterns(); !reflect.DeepEqual(got, tt.patterns) {
+				t.Errorf("模式错误, 期望: %v, 实际: %v", tt.patterns, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package util
+
+import (
+	"net"
+	"strings"
+)
+
+// ParseReversedIP 解析 DNSBL 查询使用的反向 IP 表示：IPv4 为逆序的 4 个十进制字节 (2.0.0.127 表示 127.0.0.2)，
+// IPv6 为逆序的 32 个十六进制半字节 (与 ip6.arpa 相同)
+func ParseReversedIP(reversed string) (net.IP, bool) {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(reversed, ".")), ".")
+	switch len(labels) {
+	case net.IPv4len:
+		for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+			labels[i], labels[j] = labels[j], labels[i]
+		}
+		ip := net.ParseIP(strings.Join(labels, "."))
+		if ip == nil || ip.To4() == nil {
+			return nil, false
+		}
+		return ip.To4(), true
+	case net.IPv6len * 2:
+		var b strings.Builder
+		for i := len(labels) - 1; i >= 0; i-- {
+			if len(labels[i]) != 1 || !strings.Contains("0123456789abcdef", labels[i]) {
+				return nil, false
+			}
+			b.WriteString(labels[i])
+			if i%4 == 0 && i > 0 {
+				b.WriteByte(':')
+			}
+		}
+		ip := net.ParseIP(b.String())
+		if ip == nil {
+			return nil, false
+		}
+		return ip, true
+	}
+	return nil, false
+}
+
+// SplitDNSBLName 将 <反向 IP>.<区域> 形式的 DNSBL 查询名拆分为反向 IP 与区域两部分，
+// 优先按 IPv6 (32 个半字节) 拆分，查询名不是这种形式或区域为空时 ok 为 false
+func SplitDNSBLName(name string) (reversedIP, zone string, ok bool) {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(name, ".")), ".")
+	for _, n := range []int{net.IPv6len * 2, net.IPv4len} {
+		if len(labels) <= n {
+			continue
+		}
+		reversedIP = strings.Join(labels[:n], ".")
+		if _, valid := ParseReversedIP(reversedIP); valid {
+			return reversedIP, strings.Join(labels[n:], "."), true
+		}
+	}
+	return "", "", false
+}
+
+// MatchDNSBL 检查反向表示的 IP 是否列入了给定的 DNSBL 区域：将两者组合为 <反向 IP>.<区域> 后按已有模式匹配。
+// 模式左侧的通配符对应 IP 前缀，如 *.dnsbl.example.com 列入所有地址，*.10.dnsbl.example.com 列入 10.0.0.0/8。
+// reversedIP 不是有效的反向 IP 或 zone 为空时返回 false
+func (m *DomainMatcher) MatchDNSBL(reversedIP, zone string) bool {
+	if _, ok := ParseReversedIP(reversedIP); !ok {
+		return false
+	}
+	zone = strings.Trim(strings.ToLower(zone), ".")
+	if zone == "" {
+		return false
+	}
+	return m.Match(strings.ToLower(strings.TrimSuffix(reversedIP, ".")) + "." + zone)
+}
@@ -0,0 +1,87 @@
+package util
+
+import "testing"
+
+func TestParseReversedIP(t *testing.T) {
+	testCases := []struct {
+		reversed string
+		expected string
+	}{
+		{"2.0.0.127", "127.0.0.2"},
+		{"4.3.2.1.", "1.2.3.4"},
+		{"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2", "2001:db8::1"},
+		{"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.B.D.0.1.0.0.2", "2001:db8::1"},
+		{"256.0.0.127", ""},
+		{"02.0.0.127", ""},
+		{"0.0.127", ""},
+		{"a.b.c.d", ""},
+		{"10.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2", ""},
+	}
+
+	for _, tc := range testCases {
+		ip, ok := ParseReversedIP(tc.reversed)
+		if tc.expected == "" {
+			if ok {
+				t.Errorf("ParseReversedIP(%q) 应该失败, 实际: %v", tc.reversed, ip)
+			}
+			continue
+		}
+		if !ok || ip.String() != tc.expected {
+			t.Errorf("ParseReversedIP(%q) 错误, 期望: %s, 实际: %v (%v)", tc.reversed, tc.expected, ip, ok)
+		}
+	}
+}
+
+func TestSplitDNSBLName(t *testing.T) {
+	testCases := []struct {
+		name       string
+		expectIP   string
+		expectZone string
+		expectOK   bool
+	}{
+		{"2.0.0.127.dnsbl.example.com.", "2.0.0.127", "dnsbl.example.com", true},
+		{"4.3.2.1.Zen.Example.", "4.3.2.1", "zen.example", true},
+		{"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.dnsbl.example.com.",
+			"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2", "dnsbl.example.com", true},
+		{"2.0.0.127.", "", "", false},
+		{"www.example.com.", "", "", false},
+		{"2.0.127.dnsbl.example.com.", "", "", false},
+	}
+
+	for _, tc := range testCases {
+		ip, zone, ok := SplitDNSBLName(tc.name)
+		if ok != tc.expectOK || ip != tc.expectIP || zone != tc.expectZone {
+			t.Errorf("SplitDNSBLName(%q) = (%q, %q, %v), 期望 (%q, %q, %v)",
+				tc.name, ip, zone, ok, tc.expectIP, tc.expectZone, tc.expectOK)
+		}
+	}
+}
+
+func TestMatchDNSBL(t *testing.T) {
+	matcher := NewDomainMatcher()
+	matcher.AddPattern("*.dnsbl.example.com")
+	matcher.AddPattern("*.10.partial.example.com")
+	matcher.AddPattern("2.0.0.127.partial.example.com")
+
+	testCases := []struct {
+		reversedIP string
+		zone       string
+		expected   bool
+	}{
+		{"4.3.2.1", "dnsbl.example.com", true},
+		{"4.3.2.1", "DNSBL.example.com.", true},
+		{"1.0.0.10", "partial.example.com", true},
+		{"2.0.0.127", "partial.example.com", true},
+		{"3.0.0.127", "partial.example.com", false},
+		{"1.0.168.192", "partial.example.com", false},
+		{"4.3.2.1", "other.example.com", false},
+		{"www", "dnsbl.example.com", false},
+		{"4.3.2.1", "", false},
+	}
+
+	for _, tc := range testCases {
+		if got := matcher.MatchDNSBL(tc.reversedIP, tc.zone); got != tc.expected {
+			t.Errorf("MatchDNSBL(%q, %q) 错误, 期望: %v, 实际: %v", tc.reversedIP, tc.zone, tc.expected, got)
+		}
+	}
+}
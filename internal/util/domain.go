@@ -1,17 +1,66 @@
 package util
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"regexp"
+	"regexp/syntax"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
+// RegexPatternPrefix 以此前缀开头的模式按原始 Go 正则表达式处理，不做通配符转换
+const RegexPatternPrefix = "re:"
+
+// re: 模式的复杂度上限。Go 的 regexp 匹配耗时与编译后的指令数和输入长度成线性关系，
+// 而域名不超过 253 个字符，因此限制模式长度与指令数即可约束单次匹配的耗时
+const (
+	MaxRegexPatternLength = 512
+	MaxRegexProgramSize   = 2000
+)
+
+// ErrRegexTooComplex 正则表达式超出 MaxRegexPatternLength 或 MaxRegexProgramSize
+var ErrRegexTooComplex = errors.New("正则表达式过于复杂")
+
+// CompileRegex 编译 re: 模式中的正则表达式 (不含前缀)，超出复杂度上限时返回 ErrRegexTooComplex
+func CompileRegex(expr string) (*regexp.Regexp, error) {
+	if len(expr) > MaxRegexPatternLength {
+		return nil, fmt.Errorf("%w: 长度 %d 超过上限 %d", ErrRegexTooComplex, len(expr), MaxRegexPatternLength)
+	}
+	parsed, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil {
+		return nil, err
+	}
+	if n := len(prog.Inst); n > MaxRegexProgramSize {
+		return nil, fmt.Errorf("%w: 编译后指令数 %d 超过上限 %d", ErrRegexTooComplex, n, MaxRegexProgramSize)
+	}
+	return regexp.Compile(expr)
+}
+
 // DomainMatcher 域名匹配器，用于高效匹配域名是否符合特定模式
 type DomainMatcher struct {
-	patterns     []string
-	regexCache   map[string]*regexp.Regexp
-	exactMatches map[string]bool
-	mu           sync.RWMutex
+	patterns      []string
+	regexCache    map[string]*regexp.Regexp
+	exactMatches  map[string]bool
+	regexPatterns []string
+	rawRegexes    map[string]*regexp.Regexp
+	// priorities 由 AddPatternPriority 设置的模式优先级，键为 GetPatterns 返回的形式，未设置的模式优先级为 0
+	priorities map[string]int
+	// negations 例外模式，匹配的域名即使命中其他模式也视为不匹配，未添加例外时为 nil
+	negations *DomainMatcher
+	mu        sync.RWMutex
+	// stats 匹配计数，SetPatterns 替换模式时保留
+	stats matcherCounters
 }
 
 // NewDomainMatcher 创建新的域名匹配器
@@ -20,14 +69,30 @@ func NewDomainMatcher() *DomainMatcher {
 		patterns:     make([]string, 0),
 		regexCache:   make(map[string]*regexp.Regexp),
 		exactMatches: make(map[string]bool),
+		rawRegexes:   make(map[string]*regexp.Regexp),
 	}
 }
 
 // AddPattern 添加域名匹配模式
+// 包含 Unicode 字符的国际化域名会被转换为 punycode 形式后存储，转换失败时按原样存储
+// 以 re: 开头的模式按正则表达式处理，编译失败时忽略，需要错误信息请使用 AddRegexPattern
 func (m *DomainMatcher) AddPattern(pattern string) {
+	if strings.HasPrefix(pattern, RegexPatternPrefix) {
+		_ = m.AddRegexPattern(pattern)
+		return
+	}
+
+	if ace, err := toASCIIDomain(pattern); err == nil {
+		pattern = ace
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.addPatternLocked(pattern)
+}
 
+// addPatternLocked 添加已转换为 ACE 形式的精确或通配符模式，调用方需持有写锁
+func (m *DomainMatcher) addPatternLocked(pattern string) {
 	// 检查是否已存在
 	for _, p := range m.patterns {
 		if p == pattern {
@@ -46,6 +111,200 @@ func (m *DomainMatcher) AddPattern(pattern string) {
 	}
 }
 
+// AddPatternPriority 添加带优先级的域名匹配模式，语法与 AddPattern 相同。同一域名命中多个模式时，
+// MatchWithPriority 返回优先级最高的模式；通过 AddPattern 添加的模式优先级为 0。
+// 模式已存在时只更新其优先级，无效的正则表达式被忽略
+func (m *DomainMatcher) AddPatternPriority(pattern string, priority int) {
+	var reg *regexp.Regexp
+	if strings.HasPrefix(pattern, RegexPatternPrefix) {
+		var err error
+		if reg, err = m.compileRawRegex(pattern); err != nil {
+			return
+		}
+	} else if ace, err := toASCIIDomain(pattern); err == nil {
+		pattern = ace
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if reg != nil {
+		m.addRegexLocked(strings.TrimPrefix(pattern, RegexPatternPrefix), reg)
+	} else {
+		m.addPatternLocked(pattern)
+	}
+	if m.priorities == nil {
+		m.priorities = make(map[string]int)
+	}
+	m.priorities[pattern] = priority
+}
+
+// SetPatterns 用给定模式整体替换匹配器的内容（包括例外模式与模式优先级），新状态构建完成后在一次写锁内替换，
+// 并发的 Match 只会看到替换前或替换后的完整模式集合。无效的模式被忽略，需要错误信息请使用 SetPatternsWithErrors
+func (m *DomainMatcher) SetPatterns(patterns []string) {
+	m.SetPatternsWithErrors(patterns)
+}
+
+// SetPatternsWithErrors 与 SetPatterns 相同，返回无法添加的模式（如无效的正则表达式）对应的错误
+func (m *DomainMatcher) SetPatternsWithErrors(patterns []string) []error {
+	// 在不持有 m.mu 的情况下构建新状态
+	next := NewDomainMatcher()
+	var errs []error
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, RegexPatternPrefix) {
+			if err := next.AddRegexPattern(pattern); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		next.AddPattern(pattern)
+	}
+	// 通配符模式转换后的正则表达式编译失败时不会进入 regexCache，移除后报告错误
+	for _, pattern := range next.ListWildcard() {
+		if _, ok := next.regexCache[pattern]; !ok {
+			next.RemovePattern(pattern)
+			errs = append(errs, fmt.Errorf("无效的通配符模式: %s", pattern))
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.patterns = next.patterns
+	m.regexCache = next.regexCache
+	m.exactMatches = next.exactMatches
+	m.regexPatterns = next.regexPatterns
+	m.rawRegexes = next.rawRegexes
+	m.priorities = nil
+	m.negations = nil
+	m.stats.compileNanos.Add(next.stats.compileNanos.Load())
+	return errs
+}
+
+// AddIDNPattern 添加 Unicode 形式的国际化域名模式，转换为 ACE 形式后存储
+// 与 AddPattern 不同，转换失败时返回错误而不是按原样存储
+func (m *DomainMatcher) AddIDNPattern(unicodePattern string) error {
+	ace, err := toASCIIDomain(unicodePattern)
+	if err != nil {
+		return fmt.Errorf("转换国际化域名 %s 失败: %w", unicodePattern, err)
+	}
+	m.AddPattern(ace)
+	return nil
+}
+
+// AddRegexPattern 添加正则表达式匹配模式，可带或不带 re: 前缀
+// 正则表达式在添加时编译，编译失败时返回错误
+func (m *DomainMatcher) AddRegexPattern(pattern string) error {
+	reg, err := m.compileRawRegex(pattern)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.addRegexLocked(strings.TrimPrefix(pattern, RegexPatternPrefix), reg)
+	return nil
+}
+
+// compileRawRegex 编译可带 re: 前缀的正则表达式模式，并累计编译耗时
+func (m *DomainMatcher) compileRawRegex(pattern string) (*regexp.Regexp, error) {
+	expr := strings.TrimPrefix(pattern, RegexPatternPrefix)
+	start := time.Now()
+	reg, err := CompileRegex(expr)
+	m.stats.compileNanos.Add(int64(time.Since(start)))
+	if err != nil {
+		return nil, fmt.Errorf("编译正则表达式 %s 失败: %w", expr, err)
+	}
+	return reg, nil
+}
+
+// addRegexLocked 添加已编译的正则表达式模式，调用方需持有写锁
+func (m *DomainMatcher) addRegexLocked(expr string, reg *regexp.Regexp) {
+	if _, exists := m.rawRegexes[expr]; exists {
+		return
+	}
+	m.regexPatterns = append(m.regexPatterns, expr)
+	m.rawRegexes[expr] = reg
+}
+
+// AddNegationPattern 添加例外模式，语法与 AddPattern 相同，匹配例外模式的域名总是视为不匹配
+func (m *DomainMatcher) AddNegationPattern(pattern string) {
+	m.mu.Lock()
+	if m.negations == nil {
+		m.negations = NewDomainMatcher()
+	}
+	negations := m.negations
+	m.mu.Unlock()
+
+	negations.AddPattern(pattern)
+}
+
+// maxPatternLineSize 从文件或流加载模式时单行的长度上限
+const maxPatternLineSize = 1 << 20
+
+// LoadFromReader 从 r 中逐行读取域名模式并调用 AddPattern 添加，返回成功新增的模式数量。
+// 空行与 # 开头的注释被忽略，已存在的模式和无效的正则表达式不计入数量。
+// 输入按行流式处理，不会整体读入内存，适用于标准输入、HTTP 响应体等大体积来源
+func (m *DomainMatcher) LoadFromReader(r io.Reader) (int, error) {
+	added := 0
+	err := scanLines(r, func(_ int, line string) error {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			return nil
+		}
+		before := m.Count()
+		if strings.HasPrefix(line, RegexPatternPrefix) {
+			if err := m.AddRegexPattern(line); err != nil {
+				return nil
+			}
+		} else {
+			m.AddPattern(line)
+		}
+		if m.Count() > before {
+			added++
+		}
+		return nil
+	})
+	return added, err
+}
+
+// ImportFromFile 从文件中逐行加载域名模式，格式与 LoadFromReader 相同
+func (m *DomainMatcher) ImportFromFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	added, err := m.LoadFromReader(f)
+	if err != nil {
+		return added, fmt.Errorf("读取 %s 失败: %w", path, err)
+	}
+	return added, nil
+}
+
+// scanLines 逐行读取 r 并对每一行调用 fn（行号从 1 开始），fn 返回错误时停止读取并返回该错误
+func scanLines(r io.Reader, fn func(lineNo int, line string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxPatternLineSize)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		if err := fn(lineNo, scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// GetNegationPatterns 获取所有例外模式
+func (m *DomainMatcher) GetNegationPatterns() []string {
+	m.mu.RLock()
+	negations := m.negations
+	m.mu.RUnlock()
+
+	if negations == nil {
+		return []string{}
+	}
+	return negations.GetPatterns()
+}
+
 // compileRegex 将通配符模式编译为正则表达式
 func (m *DomainMatcher) compileRegex(pattern string) {
 	// 转义特殊字符
@@ -55,7 +314,10 @@ func (m *DomainMatcher) compileRegex(pattern string) {
 	regexPattern = strings.Replace(regexPattern, "?", ".", -1)
 	regexPattern = "^" + regexPattern + "$"
 
-	if reg, err := regexp.Compile(regexPattern); err == nil {
+	start := time.Now()
+	reg, err := regexp.Compile(regexPattern)
+	m.stats.compileNanos.Add(int64(time.Since(start)))
+	if err == nil {
 		m.regexCache[pattern] = reg
 	}
 }
@@ -65,37 +327,159 @@ func (m *DomainMatcher) RemovePattern(pattern string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if strings.HasPrefix(pattern, RegexPatternPrefix) {
+		expr := strings.TrimPrefix(pattern, RegexPatternPrefix)
+		for i, p := range m.regexPatterns {
+			if p == expr {
+				m.regexPatterns = append(m.regexPatterns[:i], m.regexPatterns[i+1:]...)
+				delete(m.rawRegexes, expr)
+				delete(m.priorities, RegexPatternPrefix+expr)
+				break
+			}
+		}
+		return
+	}
+
 	for i, p := range m.patterns {
 		if p == pattern {
 			m.patterns = append(m.patterns[:i], m.patterns[i+1:]...)
 			delete(m.exactMatches, pattern)
 			delete(m.regexCache, pattern)
+			delete(m.priorities, pattern)
 			break
 		}
 	}
 }
 
-// Match 检查域名是否匹配任何模式
+// Match 检查域名是否匹配任何模式，等价于以 context.Background() 调用 MatchContext
 func (m *DomainMatcher) Match(domain string) bool {
+	matched, _ := m.MatchContext(context.Background(), domain)
+	return matched
+}
+
+// MatchContext 检查域名是否匹配任何模式，在当前协程中同步执行。ctx 在逐个正则表达式模式之间检查，
+// 结束时返回 (false, ctx.Err())；单个正则表达式的匹配耗时由 CompileRegex 的复杂度上限约束
+func (m *DomainMatcher) MatchContext(ctx context.Context, domain string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return m.match(ctx, domain)
+}
+
+// BenchmarkIterations Benchmark 对每个域名执行 Match 的次数
+const BenchmarkIterations = 100
+
+// Benchmark 对每个域名执行 BenchmarkIterations 次 Match，返回单次匹配的平均耗时与 P99 耗时，
+// 用于调优大规模模式集时评估匹配延迟。只读取模式，可在运行中调用。domains 为空时返回 0
+func (m *DomainMatcher) Benchmark(domains []string) (avgDuration time.Duration, p99Duration time.Duration) {
+	if len(domains) == 0 {
+		return 0, 0
+	}
+
+	samples := make([]time.Duration, 0, len(domains)*BenchmarkIterations)
+	var total time.Duration
+	for _, domain := range domains {
+		for i := 0; i < BenchmarkIterations; i++ {
+			start := time.Now()
+			m.Match(domain)
+			elapsed := time.Since(start)
+			samples = append(samples, elapsed)
+			total += elapsed
+		}
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	p99Index := (len(samples)*99+99)/100 - 1
+	return total / time.Duration(len(samples)), samples[p99Index]
+}
+
+// match 执行实际的匹配逻辑
+func (m *DomainMatcher) match(ctx context.Context, domain string) (bool, error) {
 	// 标准化域名
 	domain = normalizeDomain(domain)
 
 	m.mu.RLock()
 	defer m.mu.RUnlock()
+	m.stats.matchCalls.Add(1)
+
+	// 命中例外模式的域名不匹配
+	if m.negations != nil {
+		if negated, err := m.negations.match(ctx, domain); negated || err != nil {
+			return false, err
+		}
+	}
 
 	// 首先检查精确匹配
 	if m.exactMatches[domain] {
-		return true
+		m.stats.exactHits.Add(1)
+		return true, nil
 	}
 
 	// 然后检查泛域名匹配
 	for _, pattern := range m.patterns {
 		if m.matchPattern(pattern, domain) {
-			return true
+			m.stats.wildcardHits.Add(1)
+			return true, nil
 		}
 	}
 
-	return false
+	// 最后检查 re: 正则表达式模式
+	for _, expr := range m.regexPatterns {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		if m.rawRegexes[expr].MatchString(domain) {
+			m.stats.regexHits.Add(1)
+			return true, nil
+		}
+		m.stats.regexMisses.Add(1)
+	}
+
+	return false, nil
+}
+
+// MatchWithPriority 返回域名命中的优先级最高的模式 (正则表达式模式带 re: 前缀) 及其优先级，
+// 优先级相同时返回先添加的模式 (精确与通配符模式先于正则表达式模式)。
+// 与 Match 不同，需要检查全部模式；命中例外模式或未命中任何模式时 matched 为 false
+func (m *DomainMatcher) MatchWithPriority(domain string) (pattern string, priority int, matched bool) {
+	domain = normalizeDomain(domain)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	m.stats.matchCalls.Add(1)
+
+	if m.negations != nil && m.negations.Match(domain) {
+		return "", 0, false
+	}
+
+	consider := func(p string) {
+		if prio := m.priorities[p]; !matched || prio > priority {
+			pattern, priority, matched = p, prio, true
+		}
+	}
+	for _, p := range m.patterns {
+		if m.matchPattern(p, domain) {
+			consider(p)
+		}
+	}
+	for _, expr := range m.regexPatterns {
+		if m.rawRegexes[expr].MatchString(domain) {
+			consider(RegexPatternPrefix + expr)
+		} else {
+			m.stats.regexMisses.Add(1)
+		}
+	}
+
+	switch {
+	case !matched:
+	case strings.HasPrefix(pattern, RegexPatternPrefix):
+		m.stats.regexHits.Add(1)
+	case m.exactMatches[pattern]:
+		m.stats.exactHits.Add(1)
+	default:
+		m.stats.wildcardHits.Add(1)
+	}
+	return pattern, priority, matched
 }
 
 // matchPattern 检查域名是否匹配特定模式
@@ -141,13 +525,16 @@ func (m *DomainMatcher) matchPattern(pattern, domain string) bool {
 	return false
 }
 
-// GetPatterns 获取所有匹配模式
+// GetPatterns 获取所有匹配模式，正则表达式模式带 re: 前缀排在最后
 func (m *DomainMatcher) GetPatterns() []string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	result := make([]string, len(m.patterns))
+	result := make([]string, len(m.patterns), len(m.patterns)+len(m.regexPatterns))
 	copy(result, m.patterns)
+	for _, expr := range m.regexPatterns {
+		result = append(result, RegexPatternPrefix+expr)
+	}
 	return result
 }
 
@@ -159,13 +546,96 @@ func (m *DomainMatcher) Clear() {
 	m.patterns = make([]string, 0)
 	m.regexCache = make(map[string]*regexp.Regexp)
 	m.exactMatches = make(map[string]bool)
+	m.regexPatterns = nil
+	m.rawRegexes = make(map[string]*regexp.Regexp)
+	m.priorities = nil
+	m.negations = nil
 }
 
 // Count 返回匹配模式数量
 func (m *DomainMatcher) Count() int {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return len(m.patterns)
+	return len(m.patterns) + len(m.regexPatterns)
+}
+
+// 模式类型，用于 CountByType
+const (
+	PatternTypeExact    = "exact"
+	PatternTypeWildcard = "wildcard"
+	PatternTypeRegex    = "regex"
+)
+
+// CountByType 按模式类型统计数量，返回 {"exact": N, "wildcard": M, "regex": K}
+func (m *DomainMatcher) CountByType() map[string]int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	exact := len(m.exactMatches)
+	return map[string]int{
+		PatternTypeExact:    exact,
+		PatternTypeWildcard: len(m.patterns) - exact,
+		PatternTypeRegex:    len(m.regexPatterns),
+	}
+}
+
+// ListExact 返回所有精确匹配模式
+func (m *DomainMatcher) ListExact() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]string, 0, len(m.exactMatches))
+	for _, p := range m.patterns {
+		if m.exactMatches[p] {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// ListWildcard 返回所有通配符模式
+func (m *DomainMatcher) ListWildcard() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]string, 0, len(m.patterns)-len(m.exactMatches))
+	for _, p := range m.patterns {
+		if !m.exactMatches[p] {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// ListRegex 返回所有正则表达式模式（带 re: 前缀）
+func (m *DomainMatcher) ListRegex() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]string, 0, len(m.regexPatterns))
+	for _, expr := range m.regexPatterns {
+		result = append(result, RegexPatternPrefix+expr)
+	}
+	return result
+}
+
+// MatchPrefix 返回位于 prefix 区域之内的所有精确与通配符模式（即 prefix 是模式的域名后缀），按添加顺序排列。
+// 例如 prefix 为 example.com 时返回 example.com、*.example.com、www.cdn.example.com 等，不返回 notexample.com。
+// prefix 为空或 "." 时表示根区域，返回全部精确与通配符模式；正则表达式模式无法确定所属区域，不参与枚举
+func (m *DomainMatcher) MatchPrefix(prefix string) []string {
+	zone := normalizeDomain(strings.TrimSpace(prefix))
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []string
+	for _, p := range m.patterns {
+		name := strings.ToLower(p)
+		if zone == "" || name == zone || strings.HasSuffix(name, "."+zone) {
+			result = append(result, p)
+		}
+	}
+	return result
 }
 
 // normalizeDomain 标准化域名
@@ -174,47 +644,83 @@ func normalizeDomain(domain string) string {
 	if len(domain) > 0 && domain[len(domain)-1] == '.' {
 		domain = domain[:len(domain)-1]
 	}
+	// 国际化域名统一转换为 punycode 形式
+	if ace, err := toASCIIDomain(domain); err == nil {
+		return ace
+	}
 	return strings.ToLower(domain)
 }
 
-// MatchDomain 检查域名是否匹配模式（静态方法）
+// MatchDomain 检查域名是否匹配模式（静态方法）。每次调用都会重新编译模式，
+// 需要反复匹配同一模式时应使用 CompileDomainPattern
 func MatchDomain(pattern, domain string) bool {
-	// 标准化域名和模式
+	return CompileDomainPattern(pattern).Match(domain)
+}
+
+// DomainPattern 预编译的域名模式，匹配语义与 MatchDomain 相同
+type DomainPattern struct {
+	pattern string         // 规范化后的模式，re: 正则时为空
+	regex   bool           // 是否为 re: 正则
+	re      *regexp.Regexp // re: 正则或含通配符的模式编译出的正则，无效时为 nil
+}
+
+// CompileDomainPattern 编译域名模式，支持精确域名、*.example.com 泛域名、含 * / ? 的通配符与 re: 正则。
+// 无法编译的正则不匹配任何域名
+func CompileDomainPattern(pattern string) *DomainPattern {
+	if strings.HasPrefix(pattern, RegexPatternPrefix) {
+		reg, err := CompileRegex(strings.TrimPrefix(pattern, RegexPatternPrefix))
+		if err != nil {
+			reg = nil
+		}
+		return &DomainPattern{regex: true, re: reg}
+	}
+	if ace, err := toASCIIDomain(pattern); err == nil {
+		pattern = ace
+	} else {
+		pattern = strings.ToLower(pattern)
+	}
+
+	p := &DomainPattern{pattern: pattern}
+	if strings.Contains(pattern, "*") || strings.Contains(pattern, "?") {
+		// 转义特殊字符
+		regexPattern := strings.Replace(pattern, ".", "\\.", -1)
+		// 将通配符转换为正则表达式
+		regexPattern = strings.Replace(regexPattern, "*", ".*", -1)
+		regexPattern = strings.Replace(regexPattern, "?", ".", -1)
+		if reg, err := regexp.Compile("^" + regexPattern + "$"); err == nil {
+			p.re = reg
+		}
+	}
+	return p
+}
+
+// Match 检查域名是否匹配模式
+func (p *DomainPattern) Match(domain string) bool {
+	// 标准化域名
 	domain = normalizeDomain(domain)
-	pattern = strings.ToLower(pattern)
+	if p.regex {
+		return p.re != nil && p.re.MatchString(domain)
+	}
 
 	// 精确匹配
-	if pattern == domain {
+	if p.pattern == domain {
 		return true
 	}
 
 	// 泛域名匹配
-	if strings.HasPrefix(pattern, "*.") {
-		suffix := pattern[1:] // 包含开头的点
-		
+	if strings.HasPrefix(p.pattern, "*.") {
+		suffix := p.pattern[1:] // 包含开头的点
+
 		// 检查是否以后缀结尾
 		if domain == suffix[1:] { // 去掉点后的部分完全匹配
 			return false // 不匹配根域名
 		}
-		
+
 		if strings.HasSuffix(domain, suffix) {
 			return true
 		}
 	}
 
-	// 正则表达式匹配
-	if strings.Contains(pattern, "*") || strings.Contains(pattern, "?") {
-		// 转义特殊字符
-		regexPattern := strings.Replace(pattern, ".", "\\.", -1)
-		// 将通配符转换为正则表达式
-		regexPattern = strings.Replace(regexPattern, "*", ".*", -1)
-		regexPattern = strings.Replace(regexPattern, "?", ".", -1)
-		regexPattern = "^" + regexPattern + "$"
-		
-		if reg, err := regexp.Compile(regexPattern); err == nil {
-			return reg.MatchString(domain)
-		}
-	}
-
-	return false
+	// 通配符匹配
+	return p.re != nil && p.re.MatchString(domain)
 }
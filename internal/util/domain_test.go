@@ -1,7 +1,15 @@
 package util
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDomainMatcher(t *testing.T) {
@@ -57,3 +65,447 @@ func TestDomainMatcher(t *testing.T) {
 		t.Error("空域名不应该匹配任何模式")
 	}
 }
+
+func TestDomainMatcherIDN(t *testing.T) {
+	matcher := NewDomainMatcher()
+	matcher.AddPattern("münchen.de")
+	if err := matcher.AddIDNPattern("*.bücher.example"); err != nil {
+		t.Fatalf("添加国际化域名模式失败: %v", err)
+	}
+	matcher.AddPattern("xn--fiqs8s.cn") // 中国.cn 的 punycode 形式
+
+	testCases := []struct {
+		domain   string
+		expected bool
+	}{
+		{"münchen.de", true},
+		{"xn--mnchen-3ya.de.", true},
+		{"MÜNCHEN.DE", true},
+		{"www.bücher.example", true},
+		{"www.xn--bcher-kva.example", true},
+		{"中国.cn", true},
+		{"xn--fiqs8s.cn", true},
+		{"munchen.de", false},
+	}
+	for _, tc := range testCases {
+		if result := matcher.Match(tc.domain); result != tc.expected {
+			t.Errorf("域名 '%s' 匹配结果错误, 期望: %v, 实际: %v", tc.domain, tc.expected, result)
+		}
+	}
+
+	// 模式以 ACE 形式存储
+	patterns := matcher.GetPatterns()
+	if patterns[0] != "xn--mnchen-3ya.de" || patterns[1] != "*.xn--bcher-kva.example" {
+		t.Errorf("模式未转换为 ACE 形式: %v", patterns)
+	}
+
+	// 静态方法同样支持国际化域名
+	if !MatchDomain("*.bücher.example", "shop.xn--bcher-kva.example") {
+		t.Error("MatchDomain 应该匹配国际化域名的 punycode 形式")
+	}
+
+	if err := matcher.AddIDNPattern("-münchen.de"); err == nil {
+		t.Error("无效的国际化域名应该返回错误")
+	}
+}
+
+func TestDomainMatcherRegex(t *testing.T) {
+	matcher := NewDomainMatcher()
+	matcher.AddPattern("exact.example.org")
+	if err := matcher.AddRegexPattern(`re:^(mail|smtp)\..*\.example\.com$`); err != nil {
+		t.Fatalf("添加正则表达式模式失败: %v", err)
+	}
+	// 不带前缀同样可以添加
+	if err := matcher.AddRegexPattern(`^cdn[0-9]+\.example\.net$`); err != nil {
+		t.Fatalf("添加正则表达式模式失败: %v", err)
+	}
+	// 通过 AddPattern 添加 re: 模式时大小写不应被改写
+	matcher.AddPattern(`re:^\d+\.internal$`)
+
+	testCases := []struct {
+		domain   string
+		expected bool
+	}{
+		{"mail.eu.example.com", true},
+		{"smtp.us.example.com.", true},
+		{"www.eu.example.com", false},
+		{"mail.example.com", false},
+		{"cdn12.example.net", true},
+		{"cdnx.example.net", false},
+		{"42.internal", true},
+		{"exact.example.org", true},
+	}
+	for _, tc := range testCases {
+		if result := matcher.Match(tc.domain); result != tc.expected {
+			t.Errorf("域名 '%s' 匹配结果错误, 期望: %v, 实际: %v", tc.domain, tc.expected, result)
+		}
+	}
+
+	if err := matcher.AddRegexPattern("re:(unclosed"); err == nil {
+		t.Error("无效的正则表达式应该返回错误")
+	}
+	matcher.AddPattern("re:(unclosed")
+
+	if matcher.Count() != 4 {
+		t.Errorf("模式数量错误, 期望: 4, 实际: %d", matcher.Count())
+	}
+	patterns := matcher.GetPatterns()
+	if patterns[len(patterns)-1] != `re:^\d+\.internal$` {
+		t.Errorf("正则表达式模式应带 re: 前缀排在最后: %v", patterns)
+	}
+
+	matcher.RemovePattern(`re:^\d+\.internal$`)
+	if matcher.Match("42.internal") {
+		t.Error("移除正则表达式模式后不应再匹配")
+	}
+
+	if !MatchDomain(`re:^(mail|smtp)\.`, "mail.example.com") {
+		t.Error("MatchDomain 应该支持 re: 模式")
+	}
+}
+
+func TestDomainMatcherCountByType(t *testing.T) {
+	matcher := NewDomainMatcher()
+	matcher.AddPattern("example.com")
+	matcher.AddPattern("static.example.org")
+	matcher.AddPattern("*.cdn.example.com")
+	matcher.AddPattern("img?.example.net")
+	matcher.AddPattern(`re:^(mail|smtp)\.example\.com$`)
+
+	counts := matcher.CountByType()
+	expected := map[string]int{PatternTypeExact: 2, PatternTypeWildcard: 2, PatternTypeRegex: 1}
+	for typ, n := range expected {
+		if counts[typ] != n {
+			t.Errorf("%s 模式数量错误, 期望: %d, 实际: %d", typ, n, counts[typ])
+		}
+	}
+
+	if got := matcher.ListExact(); len(got) != 2 || got[0] != "example.com" || got[1] != "static.example.org" {
+		t.Errorf("ListExact 结果错误: %v", got)
+	}
+	if got := matcher.ListWildcard(); len(got) != 2 || got[0] != "*.cdn.example.com" || got[1] != "img?.example.net" {
+		t.Errorf("ListWildcard 结果错误: %v", got)
+	}
+	if got := matcher.ListRegex(); len(got) != 1 || got[0] != `re:^(mail|smtp)\.example\.com$` {
+		t.Errorf("ListRegex 结果错误: %v", got)
+	}
+
+	matcher.RemovePattern("example.com")
+	if counts := matcher.CountByType(); counts[PatternTypeExact] != 1 {
+		t.Errorf("移除后精确匹配模式数量错误, 期望: 1, 实际: %d", counts[PatternTypeExact])
+	}
+}
+
+func TestDomainMatcherSetPatterns(t *testing.T) {
+	matcher := NewDomainMatcher()
+	matcher.AddPattern("old.example.com")
+	matcher.AddNegationPattern("skip.example.org")
+
+	errs := matcher.SetPatternsWithErrors([]string{"example.com", "*.example.org", "re:^mail\\d+\\.example\\.net$", "re:(", "bad(*.example.com"})
+	if len(errs) != 2 {
+		t.Errorf("错误数量不符, 期望: 2, 实际: %d (%v)", len(errs), errs)
+	}
+
+	expected := []string{"example.com", "*.example.org", "re:^mail\\d+\\.example\\.net$"}
+	if got := matcher.GetPatterns(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("替换后的模式错误, 期望: %v, 实际: %v", expected, got)
+	}
+	if got := matcher.GetNegationPatterns(); len(got) != 0 {
+		t.Errorf("替换后应清除例外模式, 实际: %v", got)
+	}
+
+	testCases := []struct {
+		domain   string
+		expected bool
+	}{
+		{"old.example.com", false},
+		{"example.com", true},
+		{"skip.example.org", true},
+		{"mail1.example.net", true},
+	}
+	for _, tc := range testCases {
+		if got := matcher.Match(tc.domain); got != tc.expected {
+			t.Errorf("域名 %s 匹配结果错误, 期望: %v, 实际: %v", tc.domain, tc.expected, got)
+		}
+	}
+}
+
+func TestDomainMatcherSetPatternsConcurrent(t *testing.T) {
+	matcher := NewDomainMatcher()
+	a := []string{"a.example.com", "*.a.example.com"}
+	b := []string{"b.example.com", "*.b.example.com"}
+	matcher.SetPatterns(a)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			if i%2 == 0 {
+				matcher.SetPatterns(b)
+			} else {
+				matcher.SetPatterns(a)
+			}
+		}
+	}()
+
+	// 替换过程中任何时刻都应恰好有一组模式完整生效
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if n := matcher.Count(); n != 2 {
+			t.Fatalf("观察到不完整的模式集合, 数量: %d", n)
+		}
+	}
+}
+
+func TestDomainMatcherMatchContext(t *testing.T) {
+	m := NewDomainMatcher()
+	m.AddPattern("*.example.com")
+	if err := m.AddRegexPattern(`re:^img[0-9]+\.test\.org$`); err != nil {
+		t.Fatalf("添加正则表达式失败: %v", err)
+	}
+
+	// 正常情况下与 Match 结果一致
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if matched, err := m.MatchContext(ctx, "www.example.com"); !matched || err != nil {
+		t.Errorf("www.example.com 应匹配, 实际: %v, %v", matched, err)
+	}
+	if matched, err := m.MatchContext(ctx, "img12.test.org"); !matched || err != nil {
+		t.Errorf("img12.test.org 应匹配, 实际: %v, %v", matched, err)
+	}
+
+	// 已取消的 ctx 直接返回错误
+	canceled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	if matched, err := m.MatchContext(canceled, "www.example.com"); matched || !errors.Is(err, context.Canceled) {
+		t.Errorf("已取消的 ctx 应返回 context.Canceled, 实际: %v, %v", matched, err)
+	}
+}
+
+func TestCompileRegexLimits(t *testing.T) {
+	if _, err := CompileRegex(`^([a-z0-9-]{1,63}\.){1,10}example\.com$`); err != nil {
+		t.Errorf("常规正则表达式不应被拒绝: %v", err)
+	}
+	if _, err := CompileRegex(`(?:[a-z]{1,100}){1,10}(?:[0-9]{1,100}){1,5}`); !errors.Is(err, ErrRegexTooComplex) {
+		t.Errorf("编译后指令数过多的正则表达式应返回 ErrRegexTooComplex, 实际: %v", err)
+	}
+	if _, err := CompileRegex(strings.Repeat("a", MaxRegexPatternLength+1)); !errors.Is(err, ErrRegexTooComplex) {
+		t.Errorf("过长的正则表达式应返回 ErrRegexTooComplex, 实际: %v", err)
+	}
+	if _, err := CompileRegex(`(`); err == nil || errors.Is(err, ErrRegexTooComplex) {
+		t.Errorf("语法错误应原样返回, 实际: %v", err)
+	}
+
+	m := NewDomainMatcher()
+	if err := m.AddRegexPattern(`re:(?:[a-z]{1,100}){1,10}(?:[0-9]{1,100}){1,5}`); !errors.Is(err, ErrRegexTooComplex) {
+		t.Errorf("匹配器应拒绝过于复杂的正则表达式, 实际: %v", err)
+	}
+}
+
+func TestCompileDomainPattern(t *testing.T) {
+	tests := []struct {
+		pattern, domain string
+		want            bool
+	}{
+		{"example.com", "Example.COM.", true},
+		{"example.com", "www.example.com", false},
+		{"*.example.com", "a.b.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"img?.example.net", "img1.example.net", true},
+		{"img?.example.net", "img12.example.net", false},
+		{"*.bücher.example", "shop.xn--bcher-kva.example", true},
+		{`re:^(mail|smtp)\.example\.com$`, "smtp.example.com", true},
+		{`re:^(mail|smtp)\.example\.com$`, "www.example.com", false},
+		{"re:[", "[", false},
+	}
+	for _, tt := range tests {
+		p := CompileDomainPattern(tt.pattern)
+		for i := 0; i < 2; i++ {
+			if got := p.Match(tt.domain); got != tt.want {
+				t.Errorf("%s 匹配 %s 结果错误, 期望: %v, 实际: %v", tt.pattern, tt.domain, tt.want, got)
+			}
+		}
+		if got := MatchDomain(tt.pattern, tt.domain); got != tt.want {
+			t.Errorf("MatchDomain(%s, %s) 应与预编译结果一致, 期望: %v, 实际: %v", tt.pattern, tt.domain, tt.want, got)
+		}
+	}
+}
+
+func TestDomainMatcherBenchmark(t *testing.T) {
+	m := NewDomainMatcher()
+	m.SetPatterns([]string{"example.com", "*.cdn.example.net", "re:^img[0-9]+\\.test\\.org$"})
+
+	avg, p99 := m.Benchmark([]string{"example.com", "www.cdn.example.net", "img12.test.org", "nomatch.io"})
+	if avg <= 0 || p99 <= 0 {
+		t.Errorf("平均耗时与 P99 耗时应大于 0, 实际: %v, %v", avg, p99)
+	}
+
+	if avg, p99 := m.Benchmark(nil); avg != 0 || p99 != 0 {
+		t.Errorf("空域名列表应返回 0, 实际: %v, %v", avg, p99)
+	}
+}
+
+func TestDomainMatcherLoadFromReader(t *testing.T) {
+	input := `# 示例模式列表
+example.com
+*.example.org
+
+  cdn.example.net  
+example.com
+re:^api[0-9]+\.example\.io$
+re:[
+`
+	m := NewDomainMatcher()
+	added, err := m.LoadFromReader(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("加载模式失败: %v", err)
+	}
+	if added != 4 {
+		t.Errorf("新增数量错误, 期望: 4, 实际: %d (%v)", added, m.GetPatterns())
+	}
+
+	for _, domain := range []string{"example.com", "www.example.org", "cdn.example.net", "api1.example.io"} {
+		if !m.Match(domain) {
+			t.Errorf("域名 %s 应匹配", domain)
+		}
+	}
+	if m.Match("example.net") {
+		t.Error("域名 example.net 不应匹配")
+	}
+
+	// 再次加载相同内容时不新增模式
+	added, err = m.LoadFromReader(strings.NewReader(input))
+	if err != nil || added != 0 {
+		t.Errorf("重复加载结果错误, 期望: 0, nil, 实际: %d, %v", added, err)
+	}
+}
+
+func TestDomainMatcherLoadFromReaderLarge(t *testing.T) {
+	const n = 20000
+	pr, pw := io.Pipe()
+	go func() {
+		w := bufio.NewWriter(pw)
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(w, "host%d.example.com\n", i)
+		}
+		w.Flush()
+		pw.Close()
+	}()
+
+	m := NewDomainMatcher()
+	added, err := m.LoadFromReader(pr)
+	if err != nil {
+		t.Fatalf("加载模式失败: %v", err)
+	}
+	if added != n || m.Count() != n {
+		t.Errorf("新增数量错误, 期望: %d, 实际: %d (Count: %d)", n, added, m.Count())
+	}
+	if !m.Match("host19999.example.com") {
+		t.Error("最后一行的模式应被加载")
+	}
+}
+
+func TestDomainMatcherLoadFromReaderLineTooLong(t *testing.T) {
+	m := NewDomainMatcher()
+	input := "example.com\n" + strings.Repeat("a", maxPatternLineSize+1) + "\n"
+	added, err := m.LoadFromReader(strings.NewReader(input))
+	if err == nil {
+		t.Error("超长行应返回错误")
+	}
+	if added != 1 {
+		t.Errorf("出错前的新增数量错误, 期望: 1, 实际: %d", added)
+	}
+}
+
+func TestDomainMatcherMatchPrefix(t *testing.T) {
+	m := NewDomainMatcher()
+	for _, p := range []string{
+		"example.com",
+		"*.example.com",
+		"www.example.com",
+		"img.cdn.example.com",
+		"*.static.cdn.example.com",
+		"notexample.com",
+		"example.org",
+		"re:^api\\.example\\.com$",
+	} {
+		m.AddPattern(p)
+	}
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"example.com", []string{"example.com", "*.example.com", "www.example.com", "img.cdn.example.com", "*.static.cdn.example.com"}},
+		{"Example.COM.", []string{"example.com", "*.example.com", "www.example.com", "img.cdn.example.com", "*.static.cdn.example.com"}},
+		{"cdn.example.com", []string{"img.cdn.example.com", "*.static.cdn.example.com"}},
+		{"static.cdn.example.com", []string{"*.static.cdn.example.com"}},
+		{"www.example.com", []string{"www.example.com"}},
+		{"org", []string{"example.org"}},
+		{"example.net", nil},
+		{".", []string{"example.com", "*.example.com", "www.example.com", "img.cdn.example.com", "*.static.cdn.example.com", "notexample.com", "example.org"}},
+	}
+	for _, tt := range tests {
+		if got := m.MatchPrefix(tt.prefix); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("MatchPrefix(%q) 错误, 期望: %v, 实际: %v", tt.prefix, tt.want, got)
+		}
+	}
+}
+
+func TestDomainMatcherMatchWithPriority(t *testing.T) {
+	matcher := NewDomainMatcher()
+	matcher.AddPattern("*.example.com")
+	matcher.AddPatternPriority("*.cdn.example.com", 10)
+	matcher.AddPatternPriority("img.cdn.example.com", 5)
+	matcher.AddPatternPriority(`re:^img\d+\.cdn\.example\.com$`, 20)
+	matcher.AddPatternPriority("*.example.org", 1)
+	matcher.AddPatternPriority("www.example.org", 1)
+
+	testCases := []struct {
+		domain   string
+		pattern  string
+		priority int
+		matched  bool
+	}{
+		{"www.example.com", "*.example.com", 0, true},
+		{"img.cdn.example.com.", "*.cdn.example.com", 10, true}, // 精确模式优先级更低
+		{"img1.cdn.example.com", `re:^img\d+\.cdn\.example\.com$`, 20, true},
+		{"www.example.org", "*.example.org", 1, true}, // 优先级相同时取先添加的模式
+		{"example.net", "", 0, false},
+	}
+	for _, tc := range testCases {
+		pattern, priority, matched := matcher.MatchWithPriority(tc.domain)
+		if pattern != tc.pattern || priority != tc.priority || matched != tc.matched {
+			t.Errorf("%s: 期望 (%q, %d, %v), 实际 (%q, %d, %v)", tc.domain, tc.pattern, tc.priority, tc.matched, pattern, priority, matched)
+		}
+		if got := matcher.Match(tc.domain); got != tc.matched {
+			t.Errorf("%s: Match 期望 %v, 实际 %v", tc.domain, tc.matched, got)
+		}
+	}
+
+	// 已存在的模式只更新优先级
+	matcher.AddPatternPriority("img.cdn.example.com", 30)
+	if pattern, priority, _ := matcher.MatchWithPriority("img.cdn.example.com"); pattern != "img.cdn.example.com" || priority != 30 {
+		t.Errorf("更新优先级后期望 (img.cdn.example.com, 30), 实际 (%s, %d)", pattern, priority)
+	}
+	if n := matcher.Count(); n != 6 {
+		t.Errorf("更新优先级不应新增模式, 期望 6, 实际 %d", n)
+	}
+
+	// 移除后重新添加的模式优先级恢复为 0
+	matcher.RemovePattern("*.cdn.example.com")
+	matcher.AddPattern("*.cdn.example.com")
+	matcher.RemovePattern("img.cdn.example.com")
+	if pattern, priority, _ := matcher.MatchWithPriority("img.cdn.example.com"); pattern != "*.example.com" || priority != 0 {
+		t.Errorf("移除后期望 (*.example.com, 0), 实际 (%s, %d)", pattern, priority)
+	}
+
+	matcher.AddNegationPattern("*.example.org")
+	if _, _, matched := matcher.MatchWithPriority("www.example.org"); matched {
+		t.Error("命中例外模式的域名不应匹配")
+	}
+}
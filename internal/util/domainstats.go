@@ -0,0 +1,61 @@
+package util
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// MatcherStats 域名匹配器的模式数量与匹配计数快照，用于运行时性能分析
+type MatcherStats struct {
+	TotalPatterns    int `json:"total_patterns"`
+	ExactPatterns    int `json:"exact_patterns"`
+	WildcardPatterns int `json:"wildcard_patterns"`
+	RegexPatterns    int `json:"regex_patterns"`
+	// RegexCompileTime 编译通配符与 re: 正则表达式的累计耗时
+	RegexCompileTime time.Duration `json:"regex_compile_ns"`
+	// TotalMatchCalls Match 的调用次数
+	TotalMatchCalls uint64 `json:"total_match_calls"`
+	// ExactHits、WildcardHits、RegexHits 分别为由精确、通配符、re: 正则表达式模式命中的匹配次数
+	ExactHits    uint64 `json:"exact_hits"`
+	WildcardHits uint64 `json:"wildcard_hits"`
+	RegexHits    uint64 `json:"regex_hits"`
+	// RegexMisses re: 正则表达式未匹配的次数，每个被执行但未匹配的正则表达式计一次
+	RegexMisses uint64 `json:"regex_misses"`
+}
+
+// matcherCounters DomainMatcher 的匹配计数，各字段原子更新，Match 时无需持有写锁
+type matcherCounters struct {
+	compileNanos atomic.Int64
+	matchCalls   atomic.Uint64
+	exactHits    atomic.Uint64
+	wildcardHits atomic.Uint64
+	regexHits    atomic.Uint64
+	regexMisses  atomic.Uint64
+}
+
+// Stats 返回模式数量与匹配计数的快照。例外模式的匹配不计入
+func (m *DomainMatcher) Stats() MatcherStats {
+	counts := m.CountByType()
+	return MatcherStats{
+		TotalPatterns:    counts[PatternTypeExact] + counts[PatternTypeWildcard] + counts[PatternTypeRegex],
+		ExactPatterns:    counts[PatternTypeExact],
+		WildcardPatterns: counts[PatternTypeWildcard],
+		RegexPatterns:    counts[PatternTypeRegex],
+		RegexCompileTime: time.Duration(m.stats.compileNanos.Load()),
+		TotalMatchCalls:  m.stats.matchCalls.Load(),
+		ExactHits:        m.stats.exactHits.Load(),
+		WildcardHits:     m.stats.wildcardHits.Load(),
+		RegexHits:        m.stats.regexHits.Load(),
+		RegexMisses:      m.stats.regexMisses.Load(),
+	}
+}
+
+// Reset 将编译耗时与匹配计数清零，模式数量不受影响
+func (m *DomainMatcher) Reset() {
+	m.stats.compileNanos.Store(0)
+	m.stats.matchCalls.Store(0)
+	m.stats.exactHits.Store(0)
+	m.stats.wildcardHits.Store(0)
+	m.stats.regexHits.Store(0)
+	m.stats.regexMisses.Store(0)
+}
@@ -0,0 +1,52 @@
+package util
+
+import "testing"
+
+func TestDomainMatcherStats(t *testing.T) {
+	matcher := NewDomainMatcher()
+	matcher.SetPatterns([]string{
+		"example.com",
+		"*.cdn.example.com",
+		`re:^mail\.`,
+		`re:^smtp\.`,
+	})
+	matcher.AddNegationPattern("blocked.cdn.example.com")
+
+	matcher.Match("example.com")             // 精确命中
+	matcher.Match("img.cdn.example.com")     // 通配符命中
+	matcher.Match("smtp.example.org")        // ^mail\. 未匹配，^smtp\. 命中
+	matcher.Match("www.example.org")         // 两个正则均未匹配
+	matcher.Match("blocked.cdn.example.com") // 命中例外模式，只计调用次数
+
+	stats := matcher.Stats()
+	expected := MatcherStats{
+		TotalPatterns:    4,
+		ExactPatterns:    1,
+		WildcardPatterns: 1,
+		RegexPatterns:    2,
+		RegexCompileTime: stats.RegexCompileTime,
+		TotalMatchCalls:  5,
+		ExactHits:        1,
+		WildcardHits:     1,
+		RegexHits:        1,
+		RegexMisses:      3,
+	}
+	if stats != expected {
+		t.Errorf("统计结果错误\n期望: %+v\n实际: %+v", expected, stats)
+	}
+	if stats.RegexCompileTime <= 0 {
+		t.Errorf("正则表达式编译耗时应大于 0, 实际: %v", stats.RegexCompileTime)
+	}
+
+	// 替换模式保留计数
+	matcher.SetPatterns([]string{"example.net"})
+	matcher.Match("example.net")
+	if stats := matcher.Stats(); stats.TotalMatchCalls != 6 || stats.ExactHits != 2 || stats.TotalPatterns != 1 {
+		t.Errorf("SetPatterns 后计数错误: %+v", stats)
+	}
+
+	matcher.Reset()
+	if stats := matcher.Stats(); stats != (MatcherStats{TotalPatterns: 1, ExactPatterns: 1}) {
+		t.Errorf("Reset 后计数应清零: %+v", stats)
+	}
+}
@@ -0,0 +1,130 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxDomainListSize 从 URL 同步域名列表时响应体的读取上限
+const maxDomainListSize = 32 << 20
+
+// domainListFetcher 下载域名列表，记录上次响应的 ETag 与 Last-Modified 用于条件请求
+type domainListFetcher struct {
+	url          string
+	etag         string
+	lastModified string
+}
+
+// fetch 下载并解析域名列表。服务器返回 304 Not Modified 时 changed 为 false
+func (f *domainListFetcher) fetch(ctx context.Context) (patterns []string, changed bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.url, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("创建请求失败: %w", err)
+	}
+	if f.etag != "" {
+		req.Header.Set("If-None-Match", f.etag)
+	}
+	if f.lastModified != "" {
+		req.Header.Set("If-Modified-Since", f.lastModified)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("下载 %s 失败: %w", f.url, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, false, nil
+	default:
+		return nil, false, fmt.Errorf("下载 %s 失败: 状态码 %d", f.url, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDomainListSize+1))
+	if err != nil {
+		return nil, false, fmt.Errorf("读取 %s 失败: %w", f.url, err)
+	}
+	if len(body) > maxDomainListSize {
+		return nil, false, fmt.Errorf("%s 的响应超过 %d 字节上限", f.url, maxDomainListSize)
+	}
+	if patterns, err = parseDomainLines(body); err != nil {
+		return nil, false, fmt.Errorf("解析 %s 失败: %w", f.url, err)
+	}
+
+	f.etag = resp.Header.Get("ETag")
+	f.lastModified = resp.Header.Get("Last-Modified")
+	return patterns, true, nil
+}
+
+// parseDomainLines 解析每行一个域名模式的纯文本列表，忽略空行与 # 注释
+func parseDomainLines(data []byte) ([]string, error) {
+	patterns := []string{}
+	err := scanLines(bytes.NewReader(data), func(_ int, line string) error {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+		return nil
+	})
+	return patterns, err
+}
+
+// SyncFromURL 从 URL 下载每行一个模式的域名列表（忽略空行与 # 注释）并以 SetPatterns 整体替换匹配器中的模式，
+// 之后每隔 interval 重新下载。重新下载时携带上次响应的 ETag / Last-Modified，服务器返回 304 时不修改匹配器。
+// 第一次下载同步进行，失败时返回错误且不启动后台同步；后台下载失败只记录日志并保留原有模式。
+// 调用返回的 cancel 或取消 ctx 均停止后台同步，cancel 在同步协程退出后返回
+func (m *DomainMatcher) SyncFromURL(ctx context.Context, url string, interval time.Duration) (cancel func(), err error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("无效的同步间隔: %v", interval)
+	}
+
+	f := &domainListFetcher{url: url}
+	if err := m.syncOnce(ctx, f); err != nil {
+		return nil, err
+	}
+
+	ctx, stop := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := m.syncOnce(ctx, f); err != nil && !errors.Is(err, context.Canceled) {
+					log.Printf("同步域名列表失败，继续使用原有模式: %v", err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			stop()
+			wg.Wait()
+		})
+	}, nil
+}
+
+// syncOnce 下载一次域名列表，内容有变化时替换匹配器中的模式
+func (m *DomainMatcher) syncOnce(ctx context.Context, f *domainListFetcher) error {
+	patterns, changed, err := f.fetch(ctx)
+	if err != nil || !changed {
+		return err
+	}
+	for _, err := range m.SetPatternsWithErrors(patterns) {
+		log.Printf("同步域名列表 %s 时忽略无效的模式: %v", f.url, err)
+	}
+	return nil
+}
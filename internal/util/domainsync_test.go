@@ -0,0 +1,161 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// domainListServer 依次返回 lists 中的列表，每个列表带有各自的 ETag，客户端携带当前 ETag 时返回 304
+type domainListServer struct {
+	mu          sync.Mutex
+	lists       []string
+	current     int
+	downloads   atomic.Int32
+	notModified atomic.Int32
+}
+
+func (s *domainListServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	etag := `"v` + string(rune('0'+s.current)) + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		s.notModified.Add(1)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	s.downloads.Add(1)
+	w.Header().Set("ETag", etag)
+	w.Write([]byte(s.lists[s.current]))
+}
+
+// advance 切换到下一个列表
+func (s *domainListServer) advance() {
+	s.mu.Lock()
+	s.current++
+	s.mu.Unlock()
+}
+
+// waitPatterns 等待匹配器中的模式变为 want
+func waitPatterns(t *testing.T, m *DomainMatcher, want []string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got := m.GetPatterns()
+		sort.Strings(got)
+		if reflect.DeepEqual(got, want) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("模式期望 %v, 实际 %v", want, got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDomainMatcherSyncFromURL(t *testing.T) {
+	lists := &domainListServer{lists: []string{
+		"# 第一版\na.example.com\n*.cdn.example.com\n\n",
+		"b.example.com\n",
+	}}
+	server := httptest.NewServer(lists)
+	defer server.Close()
+
+	m := NewDomainMatcher()
+	m.AddPattern("old.example.com")
+	cancel, err := m.SyncFromURL(context.Background(), server.URL, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("SyncFromURL 失败: %v", err)
+	}
+	defer cancel()
+
+	// 第一次下载同步完成，原有模式被整体替换
+	got := m.GetPatterns()
+	sort.Strings(got)
+	if want := []string{"*.cdn.example.com", "a.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("模式期望 %v, 实际 %v", want, got)
+	}
+	if !m.Match("img.cdn.example.com") || m.Match("old.example.com") {
+		t.Error("同步后的匹配结果错误")
+	}
+
+	// 列表未变化时服务器返回 304，不重复下载
+	deadline := time.Now().Add(2 * time.Second)
+	for lists.notModified.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if lists.notModified.Load() < 2 || lists.downloads.Load() != 1 {
+		t.Fatalf("列表未变化时应使用条件请求, 下载 %d 次, 304 %d 次", lists.downloads.Load(), lists.notModified.Load())
+	}
+
+	lists.advance()
+	waitPatterns(t, m, []string{"b.example.com"})
+
+	// cancel 后不再同步
+	cancel()
+	cancel()
+	before := lists.downloads.Load() + lists.notModified.Load()
+	time.Sleep(60 * time.Millisecond)
+	if after := lists.downloads.Load() + lists.notModified.Load(); after != before {
+		t.Errorf("cancel 后不应继续请求, 之前 %d 次, 之后 %d 次", before, after)
+	}
+}
+
+func TestDomainMatcherSyncFromURLErrors(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	m := NewDomainMatcher()
+	m.AddPattern("keep.example.com")
+	if _, err := m.SyncFromURL(context.Background(), server.URL, time.Second); err == nil {
+		t.Error("第一次下载失败时应返回错误")
+	}
+	if !m.Match("keep.example.com") {
+		t.Error("下载失败时不应修改匹配器")
+	}
+
+	oversized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 上限内是有效列表，截断后同样可以解析
+		w.Write([]byte("new.example.com\n"))
+		w.Write(bytes.Repeat([]byte("# padding\n"), maxDomainListSize/10+1))
+	}))
+	defer oversized.Close()
+	if _, err := m.SyncFromURL(context.Background(), oversized.URL, time.Second); err == nil {
+		t.Error("响应超过上限时应返回错误")
+	}
+	if !m.Match("keep.example.com") || m.Match("new.example.com") {
+		t.Errorf("响应超过上限时不应修改匹配器, 实际包含: %v", m.GetPatterns())
+	}
+	if _, err := m.SyncFromURL(context.Background(), server.URL, 0); err == nil {
+		t.Error("同步间隔为 0 时应返回错误")
+	}
+}
+
+func TestDomainMatcherSyncFromURLContextCancel(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte("a.example.com\n"))
+	}))
+	defer server.Close()
+
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	cancel, err := NewDomainMatcher().SyncFromURL(ctx, server.URL, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("SyncFromURL 失败: %v", err)
+	}
+	cancelCtx()
+	cancel()
+	before := requests.Load()
+	time.Sleep(50 * time.Millisecond)
+	if requests.Load() != before {
+		t.Error("取消 ctx 后不应继续同步")
+	}
+}
@@ -0,0 +1,40 @@
+package util
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// toASCIIDomain 将包含 Unicode 字符的域名（或域名模式）逐标签转换为 punycode (ACE) 形式。
+// 纯 ASCII 的标签（包括通配符标签）保持不变，结果统一转为小写。
+func toASCIIDomain(domain string) (string, error) {
+	if isASCII(domain) {
+		return strings.ToLower(domain), nil
+	}
+
+	labels := strings.Split(domain, ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			labels[i] = strings.ToLower(label)
+			continue
+		}
+		ace, err := idna.Lookup.ToASCII(label)
+		if err != nil {
+			return "", err
+		}
+		labels[i] = ace
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// isASCII 判断字符串是否只包含 ASCII 字符
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}